@@ -37,7 +37,7 @@ export default function ForgotPasswordPage() {
       setIsSubmitted(true)
       toast.success('Password reset instructions sent to your email')
     } catch (error: any) {
-      const errorMsg = error.response?.data?.message || error.response?.data?.error || 'Failed to send reset email. Please try again.'
+      const errorMsg = error.response?.data?.message || error.response?.data?.detail || error.response?.data?.error || 'Failed to send reset email. Please try again.'
       toast.error(errorMsg)
     } finally {
       setIsLoading(false)
@@ -25,7 +25,7 @@ export default function LoginPage() {
 
   const fetchSchools = async () => {
     try {
-      const response = await schoolAPI.list({ limit: 100, offset: 0 })
+      const response = await schoolAPI.list({ limit: 100 })
       // Handle both response.data.data and response.data formats
       const schoolsData = response.data.data || response.data || []
       setSchools(Array.isArray(schoolsData) ? schoolsData : [])
@@ -99,7 +99,7 @@ export default function LoginPage() {
       toast.success('Login successful!')
       router.push('/dashboard')
     } catch (error: any) {
-      const errorMsg = error.response?.data?.error || 'Login failed. Please try again.'
+      const errorMsg = error.response?.data?.detail || error.response?.data?.error || 'Login failed. Please try again.'
       toast.error(errorMsg)
     }
   }
@@ -32,7 +32,7 @@ export default function RegisterPage() {
   useEffect(() => {
     const fetchSchools = async () => {
       try {
-        const response = await schoolAPI.list({ limit: 100, offset: 0 })
+        const response = await schoolAPI.list({ limit: 100 })
         // Handle both response.data.data and response.data formats
         const schoolsData = response.data.data || response.data || []
         const activeSchools = (Array.isArray(schoolsData) ? schoolsData : []).filter(
@@ -138,7 +138,7 @@ export default function RegisterPage() {
       toast.success('Registration successful! Redirecting to login...')
       router.push('/auth/login')
     } catch (error: any) {
-      const errorMsg = error.response?.data?.error || 'Registration failed. Please try again.'
+      const errorMsg = error.response?.data?.detail || error.response?.data?.error || 'Registration failed. Please try again.'
       toast.error(errorMsg)
     }
   }
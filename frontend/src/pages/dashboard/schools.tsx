@@ -59,7 +59,12 @@ function SchoolsPage() {
   const [showForm, setShowForm] = useState(false)
   const [editingId, setEditingId] = useState<string | null>(null)
   const [formData, setFormData] = useState<FormData>(DEFAULT_FORM_STATE)
-  const [pagination, setPagination] = useState({ limit: 10, offset: 0 })
+  const [pagination, setPagination] = useState<{ limit: number; cursor: string | null; history: (string | null)[] }>({
+    limit: 10,
+    cursor: null,
+    history: [],
+  })
+  const [nextCursor, setNextCursor] = useState<string | null>(null)
   const [stats, setStats] = useState<Record<string, any>>({})
   const [openMenuId, setOpenMenuId] = useState<string | null>(null)
   const [uploadingLogo, setUploadingLogo] = useState(false)
@@ -101,8 +106,9 @@ function SchoolsPage() {
     try {
       const response = await schoolAPI.list({
         limit: pagination.limit,
-        offset: pagination.offset,
+        ...(pagination.cursor ? { cursor: pagination.cursor } : {}),
       })
+      setNextCursor(response.data.pagination?.next_cursor || null)
       // Handle both response.data.data and response.data formats
       const schoolsData = response.data.data || response.data || []
       const schoolsList = Array.isArray(schoolsData) ? schoolsData : []
@@ -124,7 +130,7 @@ function SchoolsPage() {
       if (err.response?.data?.data === null) {
         setSchools([])
       } else {
-        const errorMessage = err.response?.data?.error || err.message || 'Failed to fetch schools'
+        const errorMessage = err.response?.data?.detail || err.response?.data?.error || err.message || 'Failed to fetch schools'
         console.error('Fetch schools error:', err)
         setError(errorMessage)
         setSchools([]) // Clear schools on error
@@ -191,7 +197,7 @@ function SchoolsPage() {
       setShowForm(false)
       fetchSchools()
     } catch (err: any) {
-      setError(err.response?.data?.error || 'Failed to save school')
+      setError(err.response?.data?.detail || err.response?.data?.error || 'Failed to save school')
     } finally {
       setLoading(false)
     }
@@ -222,7 +228,7 @@ function SchoolsPage() {
       setSuccess('School deleted successfully')
       fetchSchools()
     } catch (err: any) {
-      setError(err.response?.data?.error || 'Failed to delete school')
+      setError(err.response?.data?.detail || err.response?.data?.error || 'Failed to delete school')
     } finally {
       setLoading(false)
     }
@@ -281,7 +287,7 @@ function SchoolsPage() {
       setFormData((prev) => ({ ...prev, logo_url: response.data.url }))
       setSuccess('Logo uploaded successfully')
     } catch (err: any) {
-      setError(err.response?.data?.error || 'Failed to upload logo')
+      setError(err.response?.data?.detail || err.response?.data?.error || 'Failed to upload logo')
     } finally {
       setUploadingLogo(false)
     }
@@ -821,21 +827,32 @@ function SchoolsPage() {
             {schools.length > 0 && (
               <div className="bg-gray-50 px-6 py-4 border-t border-gray-200 flex justify-between items-center">
                 <div className="text-sm text-gray-600">
-                  Showing {pagination.offset + 1} to {pagination.offset + schools.length} schools
+                  Showing {pagination.history.length * pagination.limit + 1} to{' '}
+                  {pagination.history.length * pagination.limit + schools.length} schools
                 </div>
                 <div className="flex gap-2">
                   <button
                     onClick={() =>
-                      setPagination({ ...pagination, offset: Math.max(0, pagination.offset - pagination.limit) })
+                      setPagination({
+                        ...pagination,
+                        cursor: pagination.history[pagination.history.length - 1] ?? null,
+                        history: pagination.history.slice(0, -1),
+                      })
                     }
-                    disabled={pagination.offset === 0}
+                    disabled={pagination.history.length === 0}
                     className="px-4 py-2 border border-gray-300 rounded-lg text-sm font-medium text-gray-700 hover:bg-gray-50 disabled:opacity-50 disabled:cursor-not-allowed"
                   >
                     Previous
                   </button>
                   <button
-                    onClick={() => setPagination({ ...pagination, offset: pagination.offset + pagination.limit })}
-                    disabled={schools.length < pagination.limit}
+                    onClick={() =>
+                      setPagination({
+                        ...pagination,
+                        cursor: nextCursor,
+                        history: [...pagination.history, pagination.cursor],
+                      })
+                    }
+                    disabled={!nextCursor}
                     className="px-4 py-2 border border-gray-300 rounded-lg text-sm font-medium text-gray-700 hover:bg-gray-50 disabled:opacity-50 disabled:cursor-not-allowed"
                   >
                     Next
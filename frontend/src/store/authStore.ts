@@ -64,7 +64,7 @@ export const useAuthStore = create<AuthStore>()(
               // Refresh token is stored in HttpOnly cookie
             }
           } catch (error: any) {
-            const message = error.response?.data?.error || 'Login failed'
+            const message = error.response?.data?.detail || error.response?.data?.error || 'Login failed'
             set({ error: message, isLoading: false })
             throw error
           }
@@ -92,7 +92,7 @@ export const useAuthStore = create<AuthStore>()(
             // Profile creation is now handled by the backend via NATS events
             // based on the role provided during registration.
           } catch (error: any) {
-            const message = error.response?.data?.error || 'Registration failed'
+            const message = error.response?.data?.detail || error.response?.data?.error || 'Registration failed'
             set({ error: message, isLoading: false })
             throw error
           }
@@ -5,10 +5,18 @@ import (
 	"log"
 
 	"github.com/jackc/pgx/v5/pgxpool"
+
+	"school-erp/pkg/academic"
+	"school-erp/pkg/classes"
+	"school-erp/pkg/tenant"
 )
 
 func RunMigrations(pool *pgxpool.Pool) error {
-	migrations := []string{createAttendanceTable}
+	migrations := []string{
+		createAttendanceTable, addAttendanceAcademicYears, academic.Backfill("attendance", "t.date"),
+		classes.Migration, normalizeAttendanceClasses,
+		tenant.RLSMigration("attendance"), tenant.RLSMigration(classes.Tables...),
+	}
 
 	for _, migration := range migrations {
 		if _, err := pool.Exec(context.Background(), migration); err != nil {
@@ -40,3 +48,44 @@ CREATE INDEX IF NOT EXISTS idx_attendance_school_id ON attendance(school_id);
 CREATE INDEX IF NOT EXISTS idx_attendance_student_id ON attendance(student_id);
 CREATE INDEX IF NOT EXISTS idx_attendance_date ON attendance(date);
 `
+
+// addAttendanceAcademicYears stamps attendance with the academic year of its
+// date; years are kept in the main database's academic_years
+const addAttendanceAcademicYears = `
+ALTER TABLE attendance ADD COLUMN IF NOT EXISTS academic_year_id UUID;
+
+CREATE INDEX IF NOT EXISTS idx_attendance_academic_year_id ON attendance(academic_year_id);
+`
+
+// normalizeAttendanceClasses points attendance at the class catalog and,
+// for attendance taken by section, its section. The free-text class of
+// existing rows becomes a class, matched whatever its case and spacing, and
+// is cleared once the row points at it.
+const normalizeAttendanceClasses = `
+ALTER TABLE attendance ADD COLUMN IF NOT EXISTS class_id BIGINT REFERENCES classes(id);
+ALTER TABLE attendance ADD COLUMN IF NOT EXISTS section_id BIGINT REFERENCES sections(id);
+
+DO $$
+BEGIN
+	IF NOT EXISTS (SELECT FROM pg_constraint WHERE conname = 'attendance_section_class_fkey') THEN
+		ALTER TABLE attendance ADD CONSTRAINT attendance_section_class_fkey
+			FOREIGN KEY (section_id, class_id) REFERENCES sections(id, class_id);
+	END IF;
+END
+$$;
+
+INSERT INTO classes (school_id, name)
+SELECT DISTINCT ON (school_id, lower(btrim(class))) school_id, btrim(class)
+FROM attendance WHERE class_id IS NULL AND btrim(class) <> ''
+ORDER BY school_id, lower(btrim(class)), btrim(class)
+ON CONFLICT DO NOTHING;
+
+UPDATE attendance a SET class_id = c.id
+FROM classes c
+WHERE a.class_id IS NULL AND c.school_id = a.school_id AND lower(c.name) = lower(btrim(a.class));
+
+UPDATE attendance SET class = NULL WHERE class IS NOT NULL AND class_id IS NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_attendance_class_id ON attendance(class_id);
+CREATE INDEX IF NOT EXISTS idx_attendance_section_id ON attendance(section_id);
+`
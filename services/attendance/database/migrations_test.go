@@ -0,0 +1,90 @@
+package database
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// testDB opens the database of ATTENDANCE_TEST_DATABASE_URL, a Postgres
+// superuser DSN of a scratch database, with the tables of other services
+// attendance references and the migrations applied
+func testDB(t *testing.T) *pgxpool.Pool {
+	t.Helper()
+	dsn := os.Getenv("ATTENDANCE_TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("ATTENDANCE_TEST_DATABASE_URL not set")
+	}
+	ctx := context.Background()
+	db, err := pgxpool.New(ctx, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(db.Close)
+	for _, sql := range []string{
+		`CREATE TABLE IF NOT EXISTS users (id BIGSERIAL PRIMARY KEY)`,
+		`CREATE TABLE IF NOT EXISTS students (id BIGSERIAL PRIMARY KEY)`,
+	} {
+		if _, err := db.Exec(ctx, sql); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := RunMigrations(db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// TestNormalizeAttendanceClasses merges the class names of a school's
+// attendance that differ in case and surrounding spaces, and keeps schools
+// apart
+func TestNormalizeAttendanceClasses(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+	school := time.Now().UnixNano() % 1e12
+	other := school + 1
+
+	var student int64
+	if err := db.QueryRow(ctx, `INSERT INTO students DEFAULT VALUES RETURNING id`).Scan(&student); err != nil {
+		t.Fatal(err)
+	}
+	marks := []struct {
+		school int64
+		class  string
+	}{
+		{school, "Grade 5"}, {school, " grade 5 "}, {school, "GRADE 5"}, {school, " "}, {other, "grade 5"},
+	}
+	for i, m := range marks {
+		if _, err := db.Exec(ctx, `INSERT INTO attendance (school_id, student_id, class, date) VALUES ($1, $2, $3, $4)`,
+			m.school, student, m.class, time.Date(2024, 4, 1+i, 0, 0, 0, 0, time.UTC)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := db.Exec(ctx, normalizeAttendanceClasses); err != nil {
+		t.Fatal(err)
+	}
+
+	var classes, linked, kept, blank int
+	err := db.QueryRow(ctx, `
+	SELECT (SELECT COUNT(*) FROM classes WHERE school_id = $1),
+		(SELECT COUNT(DISTINCT class_id) FROM attendance WHERE school_id = $1 AND class_id IS NOT NULL AND class IS NULL),
+		(SELECT COUNT(*) FROM attendance WHERE school_id = $1 AND class_id IS NOT NULL AND class IS NOT NULL),
+		(SELECT COUNT(*) FROM attendance WHERE school_id = $1 AND class_id IS NULL)`, school,
+	).Scan(&classes, &linked, &kept, &blank)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if classes != 1 || linked != 1 || kept != 0 || blank != 1 {
+		t.Errorf("%d classes, marks in %d, %d keeping their name, %d unlinked; want 1, 1, 0 and 1", classes, linked, kept, blank)
+	}
+
+	var otherClass string
+	if err := db.QueryRow(ctx, `
+	SELECT c.name FROM attendance a JOIN classes c ON c.id = a.class_id WHERE a.school_id = $1`, other,
+	).Scan(&otherClass); err != nil || otherClass != "grade 5" {
+		t.Errorf("other school's class = %q, %v, want its own grade 5", otherClass, err)
+	}
+}
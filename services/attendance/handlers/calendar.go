@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"school-erp/pkg/bs"
+	"school-erp/pkg/problem"
+	"school-erp/pkg/settings"
+	"school-erp/pkg/tenant"
+)
+
+// calendar returns the calendar the request's dates are given and shown in:
+// the calendar query parameter, or else the calendar of the school's
+// academic settings. Dates are stored in AD either way.
+func (h *Handler) calendar(c *fiber.Ctx) (bs.Calendar, error) {
+	if name := c.Query("calendar"); name != "" {
+		cal := bs.Calendar(strings.ToUpper(name))
+		if !cal.Valid() {
+			return "", problem.BadRequest(problem.CodeInvalidQuery, "calendar must be AD or BS")
+		}
+		return cal, nil
+	}
+	var s settings.Academic
+	if err := h.settings.Load(c.Context(), tenant.CurrentSchool(c).ID, &s); err != nil {
+		return "", problem.Internal("Failed to read the school's settings", err)
+	}
+	return bs.Calendar(s.Calendar), nil
+}
@@ -3,14 +3,24 @@ package handlers
 import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/jackc/pgx/v5/pgxpool"
+
+	"school-erp/pkg/academic"
+	"school-erp/pkg/calendar"
+	"school-erp/pkg/settings"
 )
 
+// Handler serves the attendance API. Percentages are of the working days of
+// the schools' calendars in calendars; reports of a session are of the
+// academic years in years.
 type Handler struct {
-	db *pgxpool.Pool
+	db        *pgxpool.Pool
+	calendars *calendar.Client
+	years     *academic.Client
+	settings  *settings.Client
 }
 
-func NewHandler(db *pgxpool.Pool) *Handler {
-	return &Handler{db: db}
+func NewHandler(db *pgxpool.Pool, calendars *calendar.Client, years *academic.Client, prefs *settings.Client) *Handler {
+	return &Handler{db: db, calendars: calendars, years: years, settings: prefs}
 }
 
 func (h *Handler) Health(c *fiber.Ctx) error {
@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"school-erp/pkg/academic"
+	"school-erp/pkg/bs"
+	"school-erp/pkg/calendar"
+	"school-erp/pkg/problem"
+	"school-erp/pkg/tenant"
+)
+
+// Summary is the attendance of a class, or a section of it, over a range of
+// days, optionally of one academic year. From and To are days of the
+// calendar of the request.
+type Summary struct {
+	ClassID        string              `json:"class_id"`
+	SectionID      string              `json:"section_id,omitempty"`
+	AcademicYearID string              `json:"academic_year_id,omitempty"`
+	From           string              `json:"from"`
+	To             string              `json:"to"`
+	WorkingDays    int                 `json:"working_days"`
+	Students       []StudentAttendance `json:"students"`
+}
+
+// StudentAttendance counts a student's marks on the working days of a
+// summary. Unmarked working days count as neither present nor absent.
+type StudentAttendance struct {
+	StudentID  string  `json:"student_id"`
+	Present    int     `json:"present"`
+	Absent     int     `json:"absent"`
+	Late       int     `json:"late"`
+	Excused    int     `json:"excused"`
+	Unmarked   int     `json:"unmarked"`
+	Percentage float64 `json:"percentage" doc:"Present and late days of the working days, leaving out excused ones"`
+}
+
+// percentage of the working days the student attended. Excused days are
+// left out, so an excused absence does not lower it.
+func (s *StudentAttendance) percentage(workingDays int) float64 {
+	days := workingDays - s.Excused
+	if days <= 0 {
+		return 0
+	}
+	return math.Round(float64(s.Present+s.Late)*10000/float64(days)) / 100
+}
+
+// summaryRange reads the days a summary covers: month, a YYYY-MM month of
+// cal, or else from and to, YYYY-MM-DD days of cal at most
+// calendar.MaxSpanDays days apart. With a year, from and to default to its
+// first and last day.
+func summaryRange(c *fiber.Ctx, cal bs.Calendar, year *academic.Year) (from, to time.Time, err error) {
+	if month := c.Query("month"); month != "" {
+		if c.Query("from") != "" || c.Query("to") != "" {
+			return from, to, problem.BadRequest(problem.CodeInvalidQuery, "month cannot be combined with from or to")
+		}
+		from, to, err = cal.ParseMonth(month)
+		if err != nil {
+			return from, to, problem.BadRequest(problem.CodeInvalidQuery, "month must be a YYYY-MM month of the "+string(cal)+" calendar")
+		}
+		return from, to, nil
+	}
+
+	var start, end string
+	if year != nil {
+		start, end = year.StartDate, year.EndDate
+	}
+	from, err = rangeDay(cal, c.Query("from"), start)
+	if err != nil {
+		return from, to, problem.BadRequest(problem.CodeInvalidQuery, "from must be a YYYY-MM-DD day of the "+string(cal)+" calendar")
+	}
+	to, err = rangeDay(cal, c.Query("to"), end)
+	if err != nil {
+		return from, to, problem.BadRequest(problem.CodeInvalidQuery, "to must be a YYYY-MM-DD day of the "+string(cal)+" calendar")
+	}
+	if to.Before(from) || to.Sub(from) >= calendar.MaxSpanDays*24*time.Hour {
+		return from, to, problem.BadRequest(problem.CodeInvalidQuery, fmt.Sprintf("to must be from or up to %d days after it", calendar.MaxSpanDays-1))
+	}
+	return from, to, nil
+}
+
+// rangeDay reads day, a day of cal, or else fallback, an AD day such as the
+// bounds of an academic year
+func rangeDay(cal bs.Calendar, day, fallback string) (time.Time, error) {
+	if day == "" {
+		return time.Parse(calendar.DateLayout, fallback)
+	}
+	return cal.Parse(day)
+}
+
+// GetSummary handles GET /api/v1/attendance/summary, the attendance of the
+// students of class_id, or of its section_id, over month or from from to to.
+// Days are of the calendar query parameter or else of the school's settings,
+// Bikram Sambat or AD. With academic_year, the ID or name of a year or
+// "current", only marks of that year count, and from and to default to its
+// bounds. Marks on days the class does not work, such as holidays, are not
+// counted.
+func (h *Handler) GetSummary(c *fiber.Ctx) error {
+	classID, sectionID := c.Query("class_id"), c.Query("section_id")
+	if classID == "" {
+		return problem.BadRequest(problem.CodeInvalidQuery, "class_id is required")
+	}
+	schoolID := tenant.CurrentSchool(c).ID
+
+	var year *academic.Year
+	yearID := ""
+	if ref := c.Query("academic_year"); ref != "" {
+		var err error
+		year, err = h.years.Resolve(c.Context(), schoolID, ref)
+		switch {
+		case errors.Is(err, academic.ErrUnknownYear), errors.Is(err, academic.ErrNoCurrentYear):
+			return problem.BadRequest(problem.CodeInvalidQuery, err.Error())
+		case err != nil:
+			return problem.Internal("Failed to read the school's academic years", err)
+		}
+		yearID = year.ID
+	}
+	days, err := h.calendar(c)
+	if err != nil {
+		return err
+	}
+	from, to, err := summaryRange(c, days, year)
+	if err != nil {
+		return err
+	}
+
+	cal, err := h.calendars.Calendar(c.Context(), schoolID)
+	if err != nil {
+		return problem.Internal("Failed to read the school's calendar", err)
+	}
+
+	// The last mark of each student and day counts
+	rows, err := tenant.DB(c).Query(c.Context(), `
+	SELECT DISTINCT ON (student_id, date::date) student_id::text, date::date, COALESCE(status, 'present')
+	FROM attendance
+	WHERE class_id::text = $1 AND ($2 = '' OR section_id::text = $2) AND date::date BETWEEN $3 AND $4
+		AND ($5 = '' OR academic_year_id::text = $5)
+	ORDER BY student_id, date::date, updated_at DESC`, classID, sectionID, from, to, yearID)
+	if err != nil {
+		return problem.FromDB(err, "Attendance")
+	}
+	defer rows.Close()
+
+	summary := Summary{
+		ClassID: classID, SectionID: sectionID, AcademicYearID: yearID,
+		From: days.Format(from), To: days.Format(to),
+		WorkingDays: cal.WorkingDaysBetween(classID, from, to),
+		Students:    []StudentAttendance{},
+	}
+	for rows.Next() {
+		var studentID, status string
+		var day time.Time
+		if err := rows.Scan(&studentID, &day, &status); err != nil {
+			return problem.FromDB(err, "Attendance")
+		}
+		if !cal.IsWorkingDay(classID, day) {
+			continue
+		}
+		if n := len(summary.Students); n == 0 || summary.Students[n-1].StudentID != studentID {
+			summary.Students = append(summary.Students, StudentAttendance{StudentID: studentID})
+		}
+		s := &summary.Students[len(summary.Students)-1]
+		switch status {
+		case "present":
+			s.Present++
+		case "absent":
+			s.Absent++
+		case "late":
+			s.Late++
+		case "excused":
+			s.Excused++
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return problem.FromDB(err, "Attendance")
+	}
+
+	for i := range summary.Students {
+		s := &summary.Students[i]
+		s.Unmarked = summary.WorkingDays - s.Present - s.Absent - s.Late - s.Excused
+		s.Percentage = s.percentage(summary.WorkingDays)
+	}
+	return c.JSON(summary)
+}
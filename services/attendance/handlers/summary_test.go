@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+
+	"school-erp/pkg/academic"
+	"school-erp/pkg/bs"
+	"school-erp/pkg/calendar"
+	"school-erp/pkg/problem"
+)
+
+// rangeOf returns the days summaryRange reads from query in cal, as
+// "from to", or the status of its problem
+func rangeOf(t *testing.T, cal bs.Calendar, year *academic.Year, query string) (string, int) {
+	t.Helper()
+	app := fiber.New(fiber.Config{ErrorHandler: problem.ErrorHandler})
+	app.Get("/", func(c *fiber.Ctx) error {
+		from, to, err := summaryRange(c, cal, year)
+		if err != nil {
+			return err
+		}
+		return c.SendString(from.Format(calendar.DateLayout) + " " + to.Format(calendar.DateLayout))
+	})
+	resp, err := app.Test(httptest.NewRequest("GET", "/?"+query, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	return string(body), resp.StatusCode
+}
+
+func TestSummaryRange(t *testing.T) {
+	year := &academic.Year{StartDate: "2024-04-13", EndDate: "2025-04-13"}
+	cases := []struct {
+		name  string
+		cal   bs.Calendar
+		year  *academic.Year
+		query string
+		want  string
+	}{
+		// Chaitra 2081, the last BS month of the year, ends the day before
+		// Baisakh 2082 starts on 2025-04-14
+		{"BS month", bs.BS, nil, "month=2081-12", "2025-03-14 2025-04-13"},
+		{"BS month after a year end", bs.BS, nil, "month=2082-01", "2025-04-14 2025-05-14"},
+		{"BS days across the new year", bs.BS, nil, "from=2081-12-31&to=2082-01-01", "2025-04-13 2025-04-14"},
+		{"AD month", bs.AD, nil, "month=2024-02", "2024-02-01 2024-02-29"},
+		{"AD days", bs.AD, nil, "from=2024-02-29&to=2024-03-01", "2024-02-29 2024-03-01"},
+		{"year bounds", bs.BS, year, "", "2024-04-13 2025-04-13"},
+		{"BS from within a year", bs.BS, year, "from=2081-12-01", "2025-03-14 2025-04-13"},
+	}
+	for _, tc := range cases {
+		if got, status := rangeOf(t, tc.cal, tc.year, tc.query); status != fiber.StatusOK || got != tc.want {
+			t.Errorf("%s: got %q (%d), want %q", tc.name, got, status, tc.want)
+		}
+	}
+}
+
+func TestSummaryRangeRejects(t *testing.T) {
+	for name, query := range map[string]string{
+		"month with from":       "month=2081-12&from=2081-12-01",
+		"month 13":              "month=2081-13",
+		"AD day as BS":          "from=2025-02-30&to=2081-12-01",
+		"Chaitra 32":            "from=2081-12-32&to=2082-01-01",
+		"to before from":        "from=2082-01-02&to=2082-01-01",
+		"no days without year":  "",
+		"more than a long year": "from=2081-01-01&to=2082-12-30",
+	} {
+		if got, status := rangeOf(t, bs.BS, nil, query); status != fiber.StatusBadRequest {
+			t.Errorf("%s: got %q (%d), want 400", name, got, status)
+		}
+	}
+}
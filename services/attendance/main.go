@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
@@ -8,11 +9,18 @@ import (
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/joho/godotenv"
+	"github.com/nats-io/nats.go"
+	"github.com/prometheus/client_golang/prometheus"
 
 	"school-erp/attendance/config"
 	"school-erp/attendance/database"
 	"school-erp/attendance/messaging"
 	"school-erp/attendance/routes"
+	"school-erp/pkg/academic"
+	"school-erp/pkg/calendar"
+	"school-erp/pkg/problem"
+	"school-erp/pkg/settings"
+	"school-erp/pkg/tenant"
 )
 
 // Helper function to check if an origin is in the allowed list
@@ -27,7 +35,10 @@ func contains(allowedOrigins string, origin string) bool {
 }
 func main() {
 	godotenv.Load()
-	cfg := config.LoadConfig()
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
 
 	db, err := database.InitDB(cfg)
 	if err != nil {
@@ -39,33 +50,87 @@ func main() {
 		log.Fatalf("Failed to run migrations: %v", err)
 	}
 
+	// Tenant passwords are encrypted with the keyring in ENCRYPTION_KEY;
+	// production refuses a weak or padded primary key
+	keys, err := tenant.LoadKeyring(cfg.EncryptionKey, strings.EqualFold(cfg.Environment, "production"))
+	if err != nil {
+		log.Fatalf("Invalid ENCRYPTION_KEY: %v", err)
+	}
+
+	// Requests are served from the database of the school they name
+	tenantManager := tenant.NewTenantManager(
+		keys,
+		tenant.PoolLimits{
+			MaxConns:            int32(cfg.TenantMaxConns),
+			MaxTotalConns:       int32(cfg.TenantMaxTotalConns),
+			MaxConnLifetime:     cfg.TenantConnMaxLifetime,
+			MaxConnIdleTime:     cfg.TenantConnMaxIdleTime,
+			IdleTimeout:         cfg.TenantPoolIdleTimeout,
+			HealthCheckInterval: cfg.TenantHealthCheckInterval,
+		},
+		// Only connects to existing tenant databases; creating them is the
+		// school service's job
+		tenant.Admin{SSLMode: cfg.DBSSLMode},
+	)
+	defer tenantManager.CloseAllConnections()
+	prometheus.MustRegister(tenantManager)
+
 	messaging.ConnectNATS()
 	defer messaging.NatsConnection.Close()
 
-	app := fiber.New(fiber.Config{AppName: "School ERP Attendance Service"})
-	setupMiddleware(app)
+	// Verified custom domains name their school; the school service
+	// announces changes with SchoolUpdated events
+	domains := tenant.NewDomainMap(db)
+	if _, err := messaging.NatsConnection.Subscribe(tenant.SubjectSchoolUpdated, func(m *nats.Msg) {
+		domains.HandleEvent(m.Data)
+	}); err != nil {
+		log.Fatalf("Failed to subscribe to %s: %v", tenant.SubjectSchoolUpdated, err)
+	}
+	if err := domains.Refresh(context.Background()); err != nil {
+		log.Fatalf("Failed to load tenant domains: %v", err)
+	}
 
-	app.Get("/", func(c *fiber.Ctx) error {
-		return c.JSON(fiber.Map{
-			"service": "School ERP Attendance Service",
-			"version": "v1.0.0",
-			"status": "running",
-			"endpoints": fiber.Map{
-				"health": "/health",
-				"metrics": "/metrics",
-				"attendance": "/api/v1/attendance",
-			},
-		})
-	})
+	// Attendance percentages count the working days of the school's calendar
+	// and of the working week in its settings
+	prefs := settings.NewClient(db, cfg.SettingsCacheTTL)
+	if _, err := messaging.NatsConnection.Subscribe(settings.SubjectSettingsChanged, func(m *nats.Msg) {
+		prefs.HandleEvent(m.Data)
+	}); err != nil {
+		log.Fatalf("Failed to subscribe to %s: %v", settings.SubjectSettingsChanged, err)
+	}
+	cal := calendar.NewClient(db, prefs, cfg.CalendarCacheTTL)
+	if _, err := messaging.NatsConnection.Subscribe(calendar.SubjectCalendarChanged, func(m *nats.Msg) {
+		cal.HandleEvent(m.Data)
+	}); err != nil {
+		log.Fatalf("Failed to subscribe to %s: %v", calendar.SubjectCalendarChanged, err)
+	}
 
-	routes.SetupRoutes(app, db)
+	// Summaries of a session are of the school's academic years
+	years := academic.NewClient(db, cfg.AcademicYearCacheTTL)
+	if _, err := messaging.NatsConnection.Subscribe(academic.SubjectYearChanged, func(m *nats.Msg) {
+		years.HandleEvent(m.Data)
+	}); err != nil {
+		log.Fatalf("Failed to subscribe to %s: %v", academic.SubjectYearChanged, err)
+	}
 
-	app.Get("/health", func(c *fiber.Ctx) error {
-		return c.JSON(fiber.Map{"status": "healthy", "service": "attendance"})
+	tenants := tenant.New(tenant.Config{
+		Manager:   tenantManager,
+		Directory: tenant.NewPostgresDirectory(db),
+		Domains:   domains,
+		Shared:    db,
+		JWTSecret: cfg.JWTSecret,
 	})
-	app.Get("/metrics", func(c *fiber.Ctx) error {
-		return c.JSON(fiber.Map{"uptime": "N/A", "status": "operational"})
+
+	app := fiber.New(fiber.Config{
+		AppName:      "School ERP Attendance Service",
+		ErrorHandler: problem.ErrorHandler,
 	})
+	setupMiddleware(app)
+
+	routes.SetupRoutes(app, db, tenants, cal, years, prefs)
+
+	// Welcome, health, metrics and API document
+	routes.SetupSystemRoutes(app)
 
 	port := cfg.Port
 	log.Printf("Starting Attendance Service on port %s\n", port)
@@ -92,7 +157,7 @@ func setupMiddleware(app *fiber.App) {
 		}
 
 		c.Set("Access-Control-Allow-Methods", "GET,PUT,POST,DELETE,OPTIONS,PATCH")
-		c.Set("Access-Control-Allow-Headers", "Content-Type,Authorization,X-Requested-With")
+		c.Set("Access-Control-Allow-Headers", "Content-Type,Authorization,X-Requested-With,X-Tenant-Code")
 		c.Set("Access-Control-Allow-Credentials", "true")
 
 		if c.Method() == "OPTIONS" {
@@ -5,22 +5,24 @@ import (
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v5"
+
+	"school-erp/pkg/problem"
 )
 
 func AuthMiddleware(c *fiber.Ctx) error {
 	authHeader := c.Get("Authorization")
 	if authHeader == "" {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Missing auth header"})
+		return problem.Unauthorized(problem.CodeUnauthorized, "Missing auth header")
 	}
 
 	parts := strings.Split(authHeader, " ")
 	if len(parts) != 2 || parts[0] != "Bearer" {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Invalid auth format"})
+		return problem.Unauthorized(problem.CodeUnauthorized, "Invalid auth format")
 	}
 
 	token := parts[1]
 	if token == "" {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "Empty token"})
+		return problem.Unauthorized(problem.CodeUnauthorized, "Empty token")
 	}
 
 	claims := jwt.MapClaims{}
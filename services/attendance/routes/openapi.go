@@ -0,0 +1,41 @@
+package routes
+
+import (
+	"school-erp/attendance/handlers"
+	"school-erp/pkg/openapi"
+	"school-erp/pkg/tenant"
+)
+
+// tenantParam names the school whose database serves the request. It may
+// instead come from the subdomain or the token's tenant_code claim.
+var tenantParam = openapi.Param{Name: tenant.HeaderCode, In: "header", Description: "School code", Schema: &openapi.Schema{Type: "string"}}
+
+var calendarParam = openapi.Param{Name: "calendar", In: "query", Description: "Calendar of the dates, AD or BS; the school's calendar setting when omitted", Schema: &openapi.Schema{Type: "string", Enum: []interface{}{"AD", "BS"}}}
+
+// APIInfo describes the service in its OpenAPI document.
+var APIInfo = openapi.Info{
+	Title:   "School ERP Attendance Service",
+	Version: "1.0.0",
+}
+
+// Operations documents every route mounted by SetupRoutes and main.
+var Operations = []openapi.Operation{
+	{Method: "GET", Path: "/api/v1/", Summary: "API status", Responses: openapi.Responses{200: openapi.Any}},
+
+	{Method: "GET", Path: "/api/v1/attendance/summary", Summary: "Summarize a class's attendance over the working days of the school's calendar", Tags: []string{"Attendance"}, Auth: true,
+		Params: []openapi.Param{tenantParam,
+			{Name: "class_id", In: "query", Required: true, Schema: &openapi.Schema{Type: "string"}},
+			{Name: "section_id", In: "query", Schema: &openapi.Schema{Type: "string"}},
+			{Name: "academic_year", In: "query", Description: "ID or name of an academic year, or current; only its marks count", Schema: &openapi.Schema{Type: "string"}},
+			calendarParam,
+			{Name: "month", In: "query", Description: "YYYY-MM month of the calendar, instead of from and to", Schema: &openapi.Schema{Type: "string"}},
+			{Name: "from", In: "query", Description: "Day of the calendar; required without month or academic_year, whose first day it defaults to", Schema: &openapi.Schema{Type: "string"}},
+			{Name: "to", In: "query", Description: "Day of the calendar; required without month or academic_year, whose last day it defaults to", Schema: &openapi.Schema{Type: "string"}}},
+		Responses: openapi.Responses{200: handlers.Summary{}}},
+
+	{Method: "GET", Path: "/", Summary: "Service information", Responses: openapi.Responses{200: openapi.Any}},
+	{Method: "GET", Path: "/health", Summary: "Health check", Responses: openapi.Responses{200: openapi.Health{}}},
+	{Method: "GET", Path: "/metrics", Summary: "Prometheus metrics, including tenant connection pools",
+		Responses: openapi.Responses{200: openapi.Raw{ContentType: "text/plain", Schema: &openapi.Schema{Type: "string"}}}},
+	{Method: "GET", Path: "/openapi.json", Summary: "OpenAPI document", Responses: openapi.Responses{200: openapi.Any}},
+}
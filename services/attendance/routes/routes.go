@@ -5,12 +5,27 @@ import (
 	"github.com/jackc/pgx/v5/pgxpool"
 
 	"school-erp/attendance/handlers"
+	"school-erp/attendance/middleware"
+	"school-erp/pkg/academic"
+	"school-erp/pkg/calendar"
+	"school-erp/pkg/settings"
 )
 
-func SetupRoutes(app *fiber.App, db *pgxpool.Pool) {
-	h := handlers.NewHandler(db)
+// SetupRoutes mounts the API. tenants resolves the caller's school; routes
+// registered after it run against that school's database (tenant.DB).
+// Attendance is counted over the working days of the calendars in
+// calendars, and of a session over the academic years in years; dates follow
+// the calendar of the school's settings in prefs.
+func SetupRoutes(app *fiber.App, db *pgxpool.Pool, tenants fiber.Handler, calendars *calendar.Client, years *academic.Client, prefs *settings.Client) {
+	h := handlers.NewHandler(db, calendars, years, prefs)
 	api := app.Group("/api/v1")
-	
-	// Add service-specific routes here
 	api.Get("/", h.Health)
+
+	api.Use(tenants)
+
+	// Attendance of a class over a range of days, as a percentage of the
+	// class's working days
+	api.Get("/attendance/summary", middleware.AuthMiddleware, h.GetSummary)
+
+	// Add service-specific routes here
 }
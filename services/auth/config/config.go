@@ -1,65 +1,34 @@
 package config
 
 import (
-	"os"
+	"log"
 	"time"
+
+	pkgconfig "school-erp/pkg/config"
 )
 
 type Config struct {
-	Port               string
-	Environment        string
-	DatabaseURL        string
-	JWTSecret          string
-	JWTRefreshSecret   string
-	AccessTokenExpiry  time.Duration
-	RefreshTokenExpiry time.Duration
-	BcryptCost         int
-	ServerReadTimeout  time.Duration
-	ServerWriteTimeout time.Duration
-	MaxConnections     int
-	SuperAdminEmail    string
-	SuperAdminPassword string
-}
-
-func LoadConfig() *Config {
-	accessExpiry := 15 * time.Minute
-	if env := os.Getenv("ACCESS_TOKEN_EXPIRY_MINS"); env != "" {
-		// Parse if needed, for now using default
-	}
-
-	return &Config{
-		Port:               getEnv("PORT", "3001"),
-		Environment:        getEnv("ENVIRONMENT", "development"),
-		DatabaseURL:        getRequiredEnv("DATABASE_URL"),
-		JWTSecret:          getRequiredEnv("JWT_SECRET"),
-		JWTRefreshSecret:   getRequiredEnv("REFRESH_TOKEN_SECRET"),
-		AccessTokenExpiry:  accessExpiry,
-		RefreshTokenExpiry: 7 * 24 * time.Hour,
-		BcryptCost:         12,
-		ServerReadTimeout:  10 * time.Second,
-		ServerWriteTimeout: 10 * time.Second,
-		MaxConnections:     25,
-		SuperAdminEmail:    getEnv("SUPER_ADMIN_EMAIL", ""),
-		SuperAdminPassword: getEnv("SUPER_ADMIN_PASSWORD", ""),
-	}
-}
-
-func getEnv(key, defaultVal string) string {
-	if value, exists := os.LookupEnv(key); exists {
-		return value
-	}
-	return defaultVal
+	Port               string        `env:"PORT" default:"3001"`
+	Environment        string        `env:"ENVIRONMENT" default:"development"`
+	DatabaseURL        string        `env:"DATABASE_URL" required:"true" secret:"true"`
+	JWTSecret          string        `env:"JWT_SECRET" required:"true" secret:"true"`
+	JWTRefreshSecret   string        `env:"REFRESH_TOKEN_SECRET" required:"true" secret:"true"`
+	AccessTokenExpiry  time.Duration `env:"ACCESS_TOKEN_EXPIRY" default:"15m"`
+	RefreshTokenExpiry time.Duration `env:"REFRESH_TOKEN_EXPIRY" default:"168h"`
+	BcryptCost         int           `env:"BCRYPT_COST" default:"12"`
+	ServerReadTimeout  time.Duration `env:"SERVER_READ_TIMEOUT" default:"10s"`
+	ServerWriteTimeout time.Duration `env:"SERVER_WRITE_TIMEOUT" default:"10s"`
+	MaxConnections     int           `env:"MAX_CONNECTIONS" default:"25"`
+	SuperAdminEmail    string        `env:"SUPER_ADMIN_EMAIL"`
+	SuperAdminPassword string        `env:"SUPER_ADMIN_PASSWORD" secret:"true"`
 }
 
-func getRequiredEnv(key string) string {
-	value, exists := os.LookupEnv(key)
-	if !exists {
-		if os.Getenv("ENVIRONMENT") == "production" {
-			// Panic in production if secret is missing
-			panic("Missing required environment variable: " + key)
-		}
-		// For local dev, we might want to allow empty or warn, but strict is better
-		panic("Missing required environment variable: " + key)
+func LoadConfig() (*Config, error) {
+	cfg := &Config{}
+	report, err := pkgconfig.Load(cfg)
+	if err != nil {
+		return nil, err
 	}
-	return value
+	report.Print(log.Writer(), "Auth Service")
+	return cfg, nil
 }
@@ -8,6 +8,7 @@ import (
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 
 	"school-erp/auth/config"
@@ -16,6 +17,7 @@ import (
 	"school-erp/auth/pkg/logger"
 	"school-erp/auth/pkg/monitoring"
 	"school-erp/auth/utils"
+	"school-erp/pkg/problem"
 )
 
 type AuthHandler struct {
@@ -29,7 +31,9 @@ type RegisterRequest struct {
 	FirstName string `json:"first_name" validate:"required"`
 	LastName  string `json:"last_name" validate:"required"`
 	SchoolID  int64  `json:"school_id" validate:"required"`
-	Role      string `json:"role" validate:"required,oneof=admin teacher student parent staff"`
+	// Administrators are never self-registered: the admin role guards the
+	// school administration routes
+	Role string `json:"role" validate:"required,oneof=teacher student parent staff"`
 }
 
 type LoginRequest struct {
@@ -52,6 +56,39 @@ type UserResponse struct {
 	CreatedAt time.Time `json:"created_at"`
 }
 
+// TokenResponse carries the access token; the refresh token is set as an
+// HttpOnly cookie.
+type TokenResponse struct {
+	AccessToken string `json:"accessToken"`
+}
+
+type RegisteredUser struct {
+	UserID int64  `json:"user_id"`
+	Email  string `json:"email"`
+}
+
+type RegisterResponse struct {
+	Message string         `json:"message"`
+	Data    RegisteredUser `json:"data"`
+	Tokens  TokenResponse  `json:"tokens"`
+}
+
+type LoginResponse struct {
+	Message string        `json:"message"`
+	Data    UserResponse  `json:"data"`
+	Tokens  TokenResponse `json:"tokens"`
+}
+
+type RefreshResponse struct {
+	Message string        `json:"message"`
+	Tokens  TokenResponse `json:"tokens"`
+}
+
+type MeResponse struct {
+	Message string       `json:"message"`
+	Data    UserResponse `json:"data"`
+}
+
 func NewAuthHandler(db *pgxpool.Pool, cfg *config.Config) *AuthHandler {
 	return &AuthHandler{
 		db:  db,
@@ -62,17 +99,16 @@ func NewAuthHandler(db *pgxpool.Pool, cfg *config.Config) *AuthHandler {
 func (h *AuthHandler) Register(c *fiber.Ctx) error {
 	var req RegisterRequest
 	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid request body",
-		})
+		return problem.BadRequest(problem.CodeInvalidBody, "Invalid request body")
+	}
+	if err := problem.Validate(req); err != nil {
+		return err
 	}
 
 	// Hash password
 	hashedPassword, err := utils.GeneratePasswordHash(h.cfg, req.Password)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to process password",
-		})
+		return problem.Internal("Failed to process password", err)
 	}
 
 	// Insert user
@@ -86,29 +122,26 @@ func (h *AuthHandler) Register(c *fiber.Ctx) error {
 	).Scan(&userID)
 
 	if err != nil {
-		if err.Error() == "duplicate key value violates unique constraint \"users_school_id_email_key\"" {
-			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
-				"error": "Email already registered",
-			})
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.ConstraintName == "users_school_id_email_key" {
+			return problem.Conflict(problem.CodeAlreadyExists, "Email already registered").Wrap(err)
 		}
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to register user",
-		})
+		return problem.FromDB(err, "User")
 	}
 
 	// Generate tokens
-	tokens, err := utils.GenerateTokens(h.cfg, userID, req.Email, req.Role, req.SchoolID)
+	code, err := h.tenantCode(c.Context(), req.SchoolID)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to generate tokens",
-		})
+		return problem.Internal("Failed to generate tokens", err)
+	}
+	tokens, err := utils.GenerateTokens(h.cfg, userID, req.Email, req.Role, req.SchoolID, code)
+	if err != nil {
+		return problem.Internal("Failed to generate tokens", err)
 	}
 
 	// Store refresh token in database
 	if err := h.storeRefreshToken(c.Context(), userID, tokens.RefreshToken); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to store token",
-		})
+		return problem.Internal("Failed to store token", err)
 	}
 
 	// Set refresh token in HttpOnly cookie
@@ -159,25 +192,24 @@ func (h *AuthHandler) Register(c *fiber.Ctx) error {
 	// Record metrics
 	monitoring.GetMetrics().RecordRegistration()
 
-	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
-		"message": "User registered successfully",
-		"data": fiber.Map{
-			"user_id": userID,
-			"email":   req.Email,
-		},
-		"tokens": fiber.Map{
-			"accessToken": tokens.AccessToken,
-			// Refresh token is now in cookie
+	return c.Status(fiber.StatusCreated).JSON(RegisterResponse{
+		Message: "User registered successfully",
+		Data: RegisteredUser{
+			UserID: userID,
+			Email:  req.Email,
 		},
+		// Refresh token is now in cookie
+		Tokens: TokenResponse{AccessToken: tokens.AccessToken},
 	})
 }
 
 func (h *AuthHandler) Login(c *fiber.Ctx) error {
 	var req LoginRequest
 	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid request body",
-		})
+		return problem.BadRequest(problem.CodeInvalidBody, "Invalid request body")
+	}
+	if err := problem.Validate(req); err != nil {
+		return err
 	}
 
 	// Find user
@@ -194,20 +226,14 @@ func (h *AuthHandler) Login(c *fiber.Ctx) error {
 
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": "Invalid email or password",
-			})
+			return problem.Unauthorized(problem.CodeInvalidCredentials, "Invalid email or password")
 		}
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Database error",
-		})
+		return problem.Internal("Database error", err)
 	}
 
 	// Check status
 	if user.Status != "active" {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-			"error": "User account is not active",
-		})
+		return problem.Forbidden(problem.CodeForbidden, "User account is not active")
 	}
 
 	// Verify password
@@ -216,24 +242,22 @@ func (h *AuthHandler) Login(c *fiber.Ctx) error {
 		logger.SecurityLog("failed_login", user.ID, c.IP(), map[string]interface{}{
 			"email": req.Email,
 		})
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"error": "Invalid email or password",
-		})
+		return problem.Unauthorized(problem.CodeInvalidCredentials, "Invalid email or password")
 	}
 
 	// Generate tokens
-	tokens, err := utils.GenerateTokens(h.cfg, user.ID, user.Email, user.Role, user.SchoolID)
+	code, err := h.tenantCode(c.Context(), user.SchoolID)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to generate tokens",
-		})
+		return problem.Internal("Failed to generate tokens", err)
+	}
+	tokens, err := utils.GenerateTokens(h.cfg, user.ID, user.Email, user.Role, user.SchoolID, code)
+	if err != nil {
+		return problem.Internal("Failed to generate tokens", err)
 	}
 
 	// Store refresh token
 	if err := h.storeRefreshToken(c.Context(), user.ID, tokens.RefreshToken); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to store token",
-		})
+		return problem.Internal("Failed to store token", err)
 	}
 
 	// Set refresh token in HttpOnly cookie
@@ -259,9 +283,9 @@ func (h *AuthHandler) Login(c *fiber.Ctx) error {
 	// Record metrics
 	monitoring.GetMetrics().RecordLoginAttempt(true)
 
-	return c.JSON(fiber.Map{
-		"message": "Login successful",
-		"data": UserResponse{
+	return c.JSON(LoginResponse{
+		Message: "Login successful",
+		Data: UserResponse{
 			ID:        user.ID,
 			Email:     user.Email,
 			FirstName: user.FirstName,
@@ -271,9 +295,7 @@ func (h *AuthHandler) Login(c *fiber.Ctx) error {
 			Status:    user.Status,
 			CreatedAt: user.CreatedAt,
 		},
-		"tokens": fiber.Map{
-			"accessToken": tokens.AccessToken,
-		},
+		Tokens: TokenResponse{AccessToken: tokens.AccessToken},
 	})
 }
 
@@ -289,17 +311,13 @@ func (h *AuthHandler) RefreshToken(c *fiber.Ctx) error {
 	}
 
 	if refreshToken == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Refresh token required",
-		})
+		return problem.BadRequest(problem.CodeInvalidToken, "Refresh token required")
 	}
 
 	// Verify refresh token
 	claims, err := utils.VerifyRefreshToken(h.cfg, refreshToken)
 	if err != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"error": "Invalid refresh token",
-		})
+		return problem.Unauthorized(problem.CodeInvalidToken, "Invalid refresh token")
 	}
 
 	// Get user from database to get fresh data
@@ -313,24 +331,22 @@ func (h *AuthHandler) RefreshToken(c *fiber.Ctx) error {
 	)
 
 	if err != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"error": "User not found",
-		})
+		return problem.Unauthorized(problem.CodeUnauthorized, "User not found")
 	}
 
 	// Generate new tokens
-	tokens, err := utils.GenerateTokens(h.cfg, user.ID, user.Email, user.Role, user.SchoolID)
+	code, err := h.tenantCode(c.Context(), user.SchoolID)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to generate tokens",
-		})
+		return problem.Internal("Failed to generate tokens", err)
+	}
+	tokens, err := utils.GenerateTokens(h.cfg, user.ID, user.Email, user.Role, user.SchoolID, code)
+	if err != nil {
+		return problem.Internal("Failed to generate tokens", err)
 	}
 
 	// Store new refresh token
 	if err := h.storeRefreshToken(c.Context(), user.ID, tokens.RefreshToken); err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to store token",
-		})
+		return problem.Internal("Failed to store token", err)
 	}
 
 	// Set new refresh token in HttpOnly cookie
@@ -344,11 +360,9 @@ func (h *AuthHandler) RefreshToken(c *fiber.Ctx) error {
 		Path:     "/api/v1/auth/refresh",
 	})
 
-	return c.JSON(fiber.Map{
-		"message": "Token refreshed successfully",
-		"tokens": fiber.Map{
-			"accessToken": tokens.AccessToken,
-		},
+	return c.JSON(RefreshResponse{
+		Message: "Token refreshed successfully",
+		Tokens:  TokenResponse{AccessToken: tokens.AccessToken},
 	})
 }
 
@@ -356,9 +370,7 @@ func (h *AuthHandler) GetMe(c *fiber.Ctx) error {
 	// Extract user from context (set by middleware)
 	userID, ok := c.Locals("user_id").(int64)
 	if !ok {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"error": "User not authenticated",
-		})
+		return problem.Unauthorized(problem.CodeUnauthorized, "User not authenticated")
 	}
 
 	// Get user from database
@@ -372,14 +384,12 @@ func (h *AuthHandler) GetMe(c *fiber.Ctx) error {
 	)
 
 	if err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error": "User not found",
-		})
+		return problem.NotFound("User not found")
 	}
 
-	return c.JSON(fiber.Map{
-		"message": "User retrieved successfully",
-		"data": UserResponse{
+	return c.JSON(MeResponse{
+		Message: "User retrieved successfully",
+		Data: UserResponse{
 			ID:        user.ID,
 			Email:     user.Email,
 			FirstName: user.FirstName,
@@ -395,9 +405,7 @@ func (h *AuthHandler) GetMe(c *fiber.Ctx) error {
 func (h *AuthHandler) Logout(c *fiber.Ctx) error {
 	userID, ok := c.Locals("user_id").(int64)
 	if !ok {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"error": "User not authenticated",
-		})
+		return problem.Unauthorized(problem.CodeUnauthorized, "User not authenticated")
 	}
 
 	// Revoke all refresh tokens for the user
@@ -408,9 +416,7 @@ func (h *AuthHandler) Logout(c *fiber.Ctx) error {
 	)
 
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to logout",
-		})
+		return problem.Internal("Failed to logout", err)
 	}
 
 	if err := h.logAudit(c.Context(), userID, "LOGOUT", "user", c.IP()); err != nil {
@@ -440,6 +446,18 @@ func (h *AuthHandler) Logout(c *fiber.Ctx) error {
 	})
 }
 
+// tenantCode returns the code of the school whose shared_id is schoolID, for
+// the token's tenant_code claim. Users of no school, such as the seeded super
+// admin, get no code and so no access to any school's data.
+func (h *AuthHandler) tenantCode(ctx context.Context, schoolID int64) (string, error) {
+	var code string
+	err := h.db.QueryRow(ctx, `SELECT code FROM schools WHERE shared_id = $1`, schoolID).Scan(&code)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", nil
+	}
+	return code, err
+}
+
 func (h *AuthHandler) storeRefreshToken(ctx context.Context, userID int64, token string) error {
 	expiresAt := time.Now().Add(h.cfg.RefreshTokenExpiry)
 	_, err := h.db.Exec(
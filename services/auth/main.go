@@ -15,9 +15,9 @@ import (
 	"school-erp/auth/database"
 	"school-erp/auth/messaging"
 	"school-erp/auth/pkg/logger"
-	"school-erp/auth/pkg/monitoring"
 	"school-erp/auth/routes"
 	"school-erp/auth/utils"
+	"school-erp/pkg/problem"
 )
 
 // Helper function to check if an origin is in the allowed list
@@ -36,7 +36,10 @@ func main() {
 	godotenv.Load()
 
 	// Initialize configuration
-	cfg := config.LoadConfig()
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		panic(err)
+	}
 
 	// Initialize structured logger
 	logger.InitLogger(cfg.Environment)
@@ -70,60 +73,20 @@ func main() {
 
 	// Create Fiber app
 	app := fiber.New(fiber.Config{
-		AppName: "School ERP Auth Service",
+		AppName:      "School ERP Auth Service",
+		ReadTimeout:  cfg.ServerReadTimeout,
+		WriteTimeout: cfg.ServerWriteTimeout,
+		ErrorHandler: problem.ErrorHandler,
 	})
 
 	// Setup middleware
 	setupMiddleware(app)
 
-	// Welcome route
-	app.Get("/", func(c *fiber.Ctx) error {
-		return c.JSON(fiber.Map{
-			"service": "School ERP Auth Service",
-			"version": "v1.0.0",
-			"status":  "running",
-			"endpoints": fiber.Map{
-				"health":   "/health",
-				"metrics":  "/metrics",
-				"auth":     "/api/v1/auth",
-				"register": "/api/v1/auth/register",
-				"login":    "/api/v1/auth/login",
-				"refresh":  "/api/v1/auth/refresh",
-			},
-		})
-	})
-
 	// Setup routes
-	routes.SetupRoutes(app, db)
-
-	// Health check with monitoring
-	app.Get("/health", func(c *fiber.Ctx) error {
-		health := monitoring.GetMetrics().Health()
-		status := health["status"].(string)
-
-		httpStatus := fiber.StatusOK
-		if status == "unhealthy" {
-			httpStatus = fiber.StatusServiceUnavailable
-		} else if status == "degraded" {
-			httpStatus = fiber.StatusOK // Still return 200 but indicate degraded state
-		}
-
-		return c.Status(httpStatus).JSON(fiber.Map{
-			"status":  status,
-			"service": "auth",
-			"health":  health,
-		})
-	})
+	routes.SetupRoutes(app, db, cfg)
 
-	// Metrics endpoint with comprehensive stats
-	app.Get("/metrics", func(c *fiber.Ctx) error {
-		stats := monitoring.GetMetrics().GetStats()
-		return c.JSON(fiber.Map{
-			"service": "auth",
-			"status":  "operational",
-			"metrics": stats,
-		})
-	})
+	// Welcome, health, metrics and API document
+	routes.SetupSystemRoutes(app)
 
 	// Start server with graceful shutdown
 	port := cfg.Port
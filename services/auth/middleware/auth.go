@@ -7,23 +7,20 @@ import (
 
 	"school-erp/auth/config"
 	"school-erp/auth/utils"
+	"school-erp/pkg/problem"
 )
 
 func JWTMiddleware(cfg *config.Config) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		authHeader := c.Get("Authorization")
 		if authHeader == "" {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": "Missing authorization header",
-			})
+			return problem.Unauthorized(problem.CodeUnauthorized, "Missing authorization header")
 		}
 
 		// Extract token from "Bearer <token>"
 		parts := strings.Split(authHeader, " ")
 		if len(parts) != 2 || parts[0] != "Bearer" {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": "Invalid authorization header format",
-			})
+			return problem.Unauthorized(problem.CodeUnauthorized, "Invalid authorization header format")
 		}
 
 		tokenString := parts[1]
@@ -31,9 +28,7 @@ func JWTMiddleware(cfg *config.Config) fiber.Handler {
 		// Verify token
 		claims, err := utils.VerifyToken(cfg, tokenString)
 		if err != nil {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": "Invalid or expired token",
-			})
+			return problem.Unauthorized(problem.CodeInvalidToken, "Invalid or expired token")
 		}
 
 		// Store claims in context
@@ -50,9 +45,7 @@ func RoleMiddleware(allowedRoles ...string) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		userRole, ok := c.Locals("role").(string)
 		if !ok {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"error": "User role not found",
-			})
+			return problem.Unauthorized(problem.CodeUnauthorized, "User role not found")
 		}
 
 		for _, role := range allowedRoles {
@@ -61,8 +54,6 @@ func RoleMiddleware(allowedRoles ...string) fiber.Handler {
 			}
 		}
 
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
-			"error": "Insufficient permissions",
-		})
+		return problem.Forbidden(problem.CodeForbidden, "Insufficient permissions")
 	}
 }
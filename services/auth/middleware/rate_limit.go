@@ -5,7 +5,9 @@ import (
 	"time"
 
 	"github.com/gofiber/fiber/v2"
+
 	"school-erp/auth/pkg/logger"
+	"school-erp/pkg/problem"
 )
 
 // RateLimiter implements a simple in-memory rate limiter using sliding window
@@ -119,9 +121,7 @@ func (rl *RateLimiter) Middleware() fiber.Handler {
 		ip := c.IP()
 
 		if !rl.Allow(ip) {
-			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
-				"error": "Too many requests. Please try again later.",
-			})
+			return problem.New(fiber.StatusTooManyRequests, problem.CodeRateLimited, "Too many requests. Please try again later.")
 		}
 
 		return c.Next()
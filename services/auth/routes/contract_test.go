@@ -0,0 +1,107 @@
+package routes
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"school-erp/auth/config"
+	"school-erp/auth/utils"
+	"school-erp/pkg/openapi"
+	"school-erp/pkg/problem"
+)
+
+var testConfig = &config.Config{
+	JWTSecret:          "contract-test-secret",
+	JWTRefreshSecret:   "contract-test-refresh-secret",
+	AccessTokenExpiry:  15 * time.Minute,
+	RefreshTokenExpiry: time.Hour,
+}
+
+// newContractApp mounts every route. There is no database, so only paths
+// that return before touching it are exercised.
+func newContractApp() *fiber.App {
+	app := fiber.New(fiber.Config{ErrorHandler: problem.ErrorHandler})
+	SetupRoutes(app, nil, testConfig)
+	SetupSystemRoutes(app)
+	return app
+}
+
+func bearer(t *testing.T, role string) string {
+	tokens, err := utils.GenerateTokens(testConfig, 1, "admin@example.com", role, 1, "eis")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return "Bearer " + tokens.AccessToken
+}
+
+func TestOperationsCoverEveryRoute(t *testing.T) {
+	doc := openapi.Build(newContractApp(), APIInfo, Operations)
+	for _, d := range doc.Drift {
+		t.Error(d)
+	}
+}
+
+func TestResponsesMatchSpec(t *testing.T) {
+	app := newContractApp()
+	doc := openapi.Build(app, APIInfo, Operations)
+
+	cases := []struct {
+		method, path, body, auth string
+		status                   int
+	}{
+		{"POST", "/api/v1/auth/register", `{"email":`, "", 400},
+		{"POST", "/api/v1/auth/register", `{"email":"not-an-email","password":"short","role":"janitor"}`, "", 422},
+		{"POST", "/api/v1/auth/login", `{"email":"admin@example.com"}`, "", 422},
+		{"POST", "/api/v1/auth/refresh", `{}`, "", 400},
+		{"POST", "/api/v1/auth/refresh", `{"refresh_token":"garbage"}`, "", 401},
+		{"GET", "/api/v1/auth/me", "", "", 401},
+		{"GET", "/api/v1/auth/me", "", "Bearer garbage", 401},
+		{"POST", "/api/v1/auth/logout", "", "", 401},
+		{"GET", "/api/v1/admin/users", "", bearer(t, "teacher"), 403},
+		{"GET", "/api/v1/admin/users", "", bearer(t, "admin"), 200},
+		{"GET", "/", "", "", 200},
+		{"GET", "/health", "", "", 200},
+		{"GET", "/metrics", "", "", 200},
+		{"GET", "/openapi.json", "", "", 200},
+	}
+
+	for _, tc := range cases {
+		req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+		if tc.body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if tc.auth != "" {
+			req.Header.Set("Authorization", tc.auth)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", tc.method, tc.path, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != tc.status {
+			t.Errorf("%s %s: status %d, want %d: %s", tc.method, tc.path, resp.StatusCode, tc.status, body)
+			continue
+		}
+		if err := doc.ValidateResponse(tc.method, tc.path, resp.StatusCode, resp.Header.Get("Content-Type"), body); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestRegisterRefusesAdmins(t *testing.T) {
+	body := `{"email":"head@example.com","password":"password123","first_name":"Head","last_name":"Teacher","school_id":1,"role":"admin"}`
+	req := httptest.NewRequest("POST", "/api/v1/auth/register", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := newContractApp().Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != fiber.StatusUnprocessableEntity {
+		t.Errorf("status = %d, want 422", resp.StatusCode)
+	}
+}
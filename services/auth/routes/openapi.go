@@ -0,0 +1,34 @@
+package routes
+
+import (
+	"school-erp/auth/handlers"
+	"school-erp/pkg/openapi"
+)
+
+// APIInfo describes the auth service in its OpenAPI document.
+var APIInfo = openapi.Info{
+	Title:       "School ERP Auth Service",
+	Version:     "1.0.0",
+	Description: "Registration, login and JWT issuance. Refresh tokens are set as an HttpOnly cookie.",
+}
+
+// Operations documents every route mounted by SetupRoutes and SetupSystemRoutes.
+var Operations = []openapi.Operation{
+	{Method: "POST", Path: "/api/v1/auth/register", Summary: "Register a user", Tags: []string{"Auth"},
+		Request: handlers.RegisterRequest{}, Responses: openapi.Responses{201: handlers.RegisterResponse{}}},
+	{Method: "POST", Path: "/api/v1/auth/login", Summary: "Log in", Tags: []string{"Auth"},
+		Request: handlers.LoginRequest{}, Responses: openapi.Responses{200: handlers.LoginResponse{}}},
+	{Method: "POST", Path: "/api/v1/auth/refresh", Summary: "Exchange the refresh token cookie for a new access token", Tags: []string{"Auth"},
+		Request: handlers.RefreshTokenRequest{}, Responses: openapi.Responses{200: handlers.RefreshResponse{}}},
+	{Method: "GET", Path: "/api/v1/auth/me", Summary: "Get the current user", Tags: []string{"Auth"}, Auth: true,
+		Responses: openapi.Responses{200: handlers.MeResponse{}}},
+	{Method: "POST", Path: "/api/v1/auth/logout", Summary: "Revoke all refresh tokens of the current user", Tags: []string{"Auth"}, Auth: true,
+		Responses: openapi.Responses{200: openapi.Message{}}},
+	{Method: "GET", Path: "/api/v1/admin/users", Summary: "Admin users endpoint", Tags: []string{"Admin"}, Auth: true,
+		Responses: openapi.Responses{200: openapi.Message{}}},
+
+	{Method: "GET", Path: "/", Summary: "Service information", Responses: openapi.Responses{200: openapi.Any}},
+	{Method: "GET", Path: "/health", Summary: "Health check", Responses: openapi.Responses{200: HealthResponse{}, 503: HealthResponse{}}},
+	{Method: "GET", Path: "/metrics", Summary: "Service metrics", Responses: openapi.Responses{200: MetricsResponse{}}},
+	{Method: "GET", Path: "/openapi.json", Summary: "OpenAPI document", Responses: openapi.Responses{200: openapi.Any}},
+}
@@ -9,8 +9,7 @@ import (
 	"school-erp/auth/middleware"
 )
 
-func SetupRoutes(app *fiber.App, db *pgxpool.Pool) {
-	cfg := config.LoadConfig()
+func SetupRoutes(app *fiber.App, db *pgxpool.Pool, cfg *config.Config) {
 	authHandler := handlers.NewAuthHandler(db, cfg)
 
 	// Create rate limiters
@@ -0,0 +1,72 @@
+package routes
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"school-erp/auth/pkg/monitoring"
+	"school-erp/pkg/openapi"
+)
+
+type HealthResponse struct {
+	Status  string                 `json:"status"`
+	Service string                 `json:"service"`
+	Health  map[string]interface{} `json:"health"`
+}
+
+type MetricsResponse struct {
+	Service string                 `json:"service"`
+	Status  string                 `json:"status"`
+	Metrics map[string]interface{} `json:"metrics"`
+}
+
+// SetupSystemRoutes mounts the welcome, health, metrics and OpenAPI routes.
+func SetupSystemRoutes(app *fiber.App) {
+	// Welcome route
+	app.Get("/", func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{
+			"service": "School ERP Auth Service",
+			"version": "v1.0.0",
+			"status":  "running",
+			"endpoints": fiber.Map{
+				"health":   "/health",
+				"metrics":  "/metrics",
+				"openapi":  "/openapi.json",
+				"auth":     "/api/v1/auth",
+				"register": "/api/v1/auth/register",
+				"login":    "/api/v1/auth/login",
+				"refresh":  "/api/v1/auth/refresh",
+			},
+		})
+	})
+
+	// Health check with monitoring
+	app.Get("/health", func(c *fiber.Ctx) error {
+		health := monitoring.GetMetrics().Health()
+		status := health["status"].(string)
+
+		httpStatus := fiber.StatusOK
+		if status == "unhealthy" {
+			httpStatus = fiber.StatusServiceUnavailable
+		} else if status == "degraded" {
+			httpStatus = fiber.StatusOK // Still return 200 but indicate degraded state
+		}
+
+		return c.Status(httpStatus).JSON(HealthResponse{
+			Status:  status,
+			Service: "auth",
+			Health:  health,
+		})
+	})
+
+	// Metrics endpoint with comprehensive stats
+	app.Get("/metrics", func(c *fiber.Ctx) error {
+		stats := monitoring.GetMetrics().GetStats()
+		return c.JSON(MetricsResponse{
+			Service: "auth",
+			Status:  "operational",
+			Metrics: stats,
+		})
+	})
+
+	app.Get("/openapi.json", openapi.Handler(app, APIInfo, Operations))
+}
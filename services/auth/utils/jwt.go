@@ -14,6 +14,10 @@ type JWTClaims struct {
 	Email    string `json:"email"`
 	Role     string `json:"role"`
 	SchoolID int64  `json:"school_id"`
+
+	// TenantCode is the code of the user's school. The gateway and the
+	// services only accept the token for that school's data.
+	TenantCode string `json:"tenant_code,omitempty"`
 	jwt.RegisteredClaims
 }
 
@@ -24,9 +28,11 @@ type TokenResponse struct {
 	TokenType    string    `json:"token_type"`
 }
 
-func GenerateTokens(cfg *config.Config, userID int64, email, role string, schoolID int64) (*TokenResponse, error) {
+// GenerateTokens mints an access token for the user of the school with code
+// tenantCode, and a refresh token
+func GenerateTokens(cfg *config.Config, userID int64, email, role string, schoolID int64, tenantCode string) (*TokenResponse, error) {
 	// Generate Access Token
-	accessToken, err := generateAccessToken(cfg, userID, email, role, schoolID)
+	accessToken, err := generateAccessToken(cfg, userID, email, role, schoolID, tenantCode)
 	if err != nil {
 		return nil, err
 	}
@@ -45,12 +51,13 @@ func GenerateTokens(cfg *config.Config, userID int64, email, role string, school
 	}, nil
 }
 
-func generateAccessToken(cfg *config.Config, userID int64, email, role string, schoolID int64) (string, error) {
+func generateAccessToken(cfg *config.Config, userID int64, email, role string, schoolID int64, tenantCode string) (string, error) {
 	claims := JWTClaims{
-		UserID:   userID,
-		Email:    email,
-		Role:     role,
-		SchoolID: schoolID,
+		UserID:     userID,
+		Email:      email,
+		Role:       role,
+		SchoolID:   schoolID,
+		TenantCode: tenantCode,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(cfg.AccessTokenExpiry)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
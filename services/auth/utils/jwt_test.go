@@ -0,0 +1,28 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"school-erp/auth/config"
+)
+
+func TestAccessTokenNamesTheSchool(t *testing.T) {
+	cfg := &config.Config{
+		JWTSecret:          "jwt-test-secret",
+		JWTRefreshSecret:   "jwt-test-refresh-secret",
+		AccessTokenExpiry:  time.Minute,
+		RefreshTokenExpiry: time.Hour,
+	}
+	tokens, err := GenerateTokens(cfg, 42, "teacher@eis.edu.np", "teacher", 7, "eis")
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := VerifyToken(cfg, tokens.AccessToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.TenantCode != "eis" || claims.SchoolID != 7 || claims.UserID != 42 {
+		t.Errorf("claims = %+v", claims)
+	}
+}
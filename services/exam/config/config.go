@@ -2,52 +2,48 @@ package config
 
 import (
 	"log"
-	"os"
 	"time"
+
+	pkgconfig "school-erp/pkg/config"
 )
 
 type Config struct {
-	Port        string
-	Environment string
-	DBHost      string
-	DBPort      string
-	DBUser      string
-	DBPassword  string
-	DBName      string
-	DBSSLMode   string
-	JWTSecret   string
-	NATSUrl     string
-	RedisURL    string
-	LogLevel    string
-}
+	Port        string `env:"EXAM_SERVICE_PORT" default:"3006"`
+	Environment string `env:"ENVIRONMENT" default:"development"`
+	DBHost      string `env:"DB_HOST" default:"postgres"`
+	DBPort      string `env:"DB_PORT" default:"5432"`
+	DBUser      string `env:"DB_USER" default:"postgres"`
+	DBPassword  string `env:"DB_PASSWORD" default:"postgres" secret:"true"`
+	DBName      string `env:"DB_NAME" default:"school_erp"`
+	DBSSLMode   string `env:"DB_SSL_MODE" default:"disable"`
+	JWTSecret   string `env:"JWT_SECRET" default:"change-me" secret:"true"`
+	NATSUrl     string `env:"NATS_URL" default:"nats://localhost:4222"`
+	RedisURL    string `env:"REDIS_URL" default:"redis://localhost:6379"`
+	LogLevel    string `env:"LOG_LEVEL" default:"info"`
 
-func LoadConfig() *Config {
-	cfg := &Config{
-		Port:        getEnv("EXAM_SERVICE_PORT", "3006"),
-		Environment: getEnv("ENVIRONMENT", "development"),
-		DBHost:      getEnv("DB_HOST", "postgres"),
-		DBPort:      getEnv("DB_PORT", "5432"),
-		DBUser:      getEnv("DB_USER", "postgres"),
-		DBPassword:  getEnv("DB_PASSWORD", "postgres"),
-		DBName:      getEnv("DB_NAME", "school_erp"),
-		DBSSLMode:   getEnv("DB_SSL_MODE", "disable"),
-		JWTSecret:   getEnv("JWT_SECRET", "change-me"),
-		NATSUrl:     getEnv("NATS_URL", "nats://localhost:4222"),
-		RedisURL:    getEnv("REDIS_URL", "redis://localhost:6379"),
-		LogLevel:    getEnv("LOG_LEVEL", "info"),
-	}
-	log.Printf("[Exam Service] Environment: %s, Port: %s", cfg.Environment, cfg.Port)
-	return cfg
-}
+	// Tenant databases. Credentials in the schools table are decrypted with
+	// EncryptionKey, which must match the school service's.
+	EncryptionKey string `env:"ENCRYPTION_KEY" default:"default-key-change-in-production" secret:"true"`
+	// Each school's pool reserves TenantMaxConns of TenantMaxTotalConns;
+	// least recently used idle pools are closed to make room
+	TenantMaxConns            int           `env:"TENANT_MAX_CONNECTIONS" default:"10"`
+	TenantMaxTotalConns       int           `env:"TENANT_MAX_TOTAL_CONNECTIONS" default:"100"`
+	TenantConnMaxLifetime     time.Duration `env:"TENANT_CONN_MAX_LIFETIME" default:"5m"`
+	TenantConnMaxIdleTime     time.Duration `env:"TENANT_CONN_MAX_IDLE_TIME" default:"1m"`
+	TenantPoolIdleTimeout     time.Duration `env:"TENANT_POOL_IDLE_TIMEOUT" default:"10m"`
+	TenantHealthCheckInterval time.Duration `env:"TENANT_HEALTH_CHECK_INTERVAL" default:"30s"`
 
-func getEnv(key, defaultVal string) string {
-	if value, exists := os.LookupEnv(key); exists {
-		return value
-	}
-	return defaultVal
+	// How long a school's modules are cached between SchoolFeaturesChanged
+	// events
+	FeatureCacheTTL time.Duration `env:"FEATURE_CACHE_TTL" default:"5m"`
 }
 
-func parseDuration(s string) time.Duration {
-	d, _ := time.ParseDuration(s)
-	return d
+func LoadConfig() (*Config, error) {
+	cfg := &Config{}
+	report, err := pkgconfig.Load(cfg)
+	if err != nil {
+		return nil, err
+	}
+	report.Print(log.Writer(), "Exam Service")
+	return cfg, nil
 }
@@ -5,10 +5,19 @@ import (
 	"log"
 
 	"github.com/jackc/pgx/v5/pgxpool"
+
+	"school-erp/pkg/academic"
+	"school-erp/pkg/classes"
+	"school-erp/pkg/tenant"
 )
 
 func RunMigrations(pool *pgxpool.Pool) error {
-	migrations := []string{createExamsTable, createMarksTable}
+	migrations := []string{
+		createExamsTable, createMarksTable, addMarksSchoolID, addExamAcademicYears,
+		academic.Backfill("exams", "COALESCE(t.exam_date, t.created_at)"),
+		classes.Migration, normalizeExamClasses,
+		tenant.RLSMigration("exams", "marks"), tenant.RLSMigration(classes.Tables...),
+	}
 
 	for _, migration := range migrations {
 		if _, err := pool.Exec(context.Background(), migration); err != nil {
@@ -53,3 +62,61 @@ CREATE TABLE IF NOT EXISTS marks (
 CREATE INDEX IF NOT EXISTS idx_marks_exam_id ON marks(exam_id);
 CREATE INDEX IF NOT EXISTS idx_marks_student_id ON marks(student_id);
 `
+
+// addMarksSchoolID copies the school of each mark from its exam so that marks
+// can be isolated per school like every other shared table
+const addMarksSchoolID = `
+ALTER TABLE marks ADD COLUMN IF NOT EXISTS school_id BIGINT;
+UPDATE marks m SET school_id = e.school_id FROM exams e WHERE m.exam_id = e.id AND m.school_id IS NULL;
+ALTER TABLE marks ALTER COLUMN school_id SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_marks_school_id ON marks(school_id);
+`
+
+// addExamAcademicYears stamps exams with the academic year they are held in;
+// years are kept in the main database's academic_years
+const addExamAcademicYears = `
+ALTER TABLE exams ADD COLUMN IF NOT EXISTS academic_year_id UUID;
+
+CREATE INDEX IF NOT EXISTS idx_exams_academic_year_id ON exams(academic_year_id);
+`
+
+// normalizeExamClasses points exams at the class catalog. The free-text
+// class and subject of existing exams become classes and subjects, matched
+// whatever their case and spacing, and are cleared once the exam points at
+// them. New subjects are coded by the letters and digits of their name; a
+// subject whose code another subject already has stays a string for the
+// school to map by hand.
+const normalizeExamClasses = `
+ALTER TABLE exams ADD COLUMN IF NOT EXISTS class_id BIGINT REFERENCES classes(id);
+ALTER TABLE exams ADD COLUMN IF NOT EXISTS subject_id BIGINT REFERENCES subjects(id);
+
+INSERT INTO classes (school_id, name)
+SELECT DISTINCT ON (school_id, lower(btrim(class))) school_id, btrim(class)
+FROM exams WHERE class_id IS NULL AND btrim(class) <> ''
+ORDER BY school_id, lower(btrim(class)), btrim(class)
+ON CONFLICT DO NOTHING;
+
+UPDATE exams e SET class_id = c.id
+FROM classes c
+WHERE e.class_id IS NULL AND c.school_id = e.school_id AND lower(c.name) = lower(btrim(e.class));
+
+INSERT INTO subjects (school_id, code, name)
+SELECT DISTINCT ON (school_id, lower(btrim(subject))) school_id,
+	COALESCE(NULLIF(left(upper(regexp_replace(subject, '[^A-Za-z0-9]', '', 'g')), 20), ''),
+		'SUBJECT-' || substr(md5(lower(btrim(subject))), 1, 8)),
+	btrim(subject)
+FROM exams WHERE subject_id IS NULL AND btrim(subject) <> ''
+ORDER BY school_id, lower(btrim(subject)), btrim(subject)
+ON CONFLICT DO NOTHING;
+
+UPDATE exams e SET subject_id = s.id
+FROM subjects s
+WHERE e.subject_id IS NULL AND s.school_id = e.school_id AND lower(s.name) = lower(btrim(e.subject));
+
+UPDATE exams SET class = NULL WHERE class IS NOT NULL AND class_id IS NOT NULL;
+UPDATE exams SET subject = NULL WHERE subject IS NOT NULL AND subject_id IS NOT NULL;
+
+CREATE INDEX IF NOT EXISTS idx_exams_class_id ON exams(class_id);
+CREATE INDEX IF NOT EXISTS idx_exams_subject_id ON exams(subject_id);
+`
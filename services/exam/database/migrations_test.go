@@ -0,0 +1,109 @@
+package database
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// testDB opens the database of EXAM_TEST_DATABASE_URL, a Postgres superuser
+// DSN of a scratch database, with the tables of other services the catalog
+// references and the migrations applied
+func testDB(t *testing.T) *pgxpool.Pool {
+	t.Helper()
+	dsn := os.Getenv("EXAM_TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("EXAM_TEST_DATABASE_URL not set")
+	}
+	ctx := context.Background()
+	db, err := pgxpool.New(ctx, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(db.Close)
+	if _, err := db.Exec(ctx, `CREATE TABLE IF NOT EXISTS users (id BIGSERIAL PRIMARY KEY)`); err != nil {
+		t.Fatal(err)
+	}
+	if err := RunMigrations(db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// TestNormalizeExamClasses turns the class and subject names of a school's
+// exams into classes and subjects, merging names that differ in case and
+// surrounding spaces. Of two subjects whose names code alike, one keeps its
+// name for the school to map.
+func TestNormalizeExamClasses(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+	school := time.Now().UnixNano() % 1e12
+
+	exams := []struct{ class, subject string }{
+		{"Grade 5", "Maths"},
+		{" grade 5", " maths "},
+		{"GRADE 5 ", "Science & Tech"},
+		{"Grade 6", "Math-s"},
+	}
+	for _, e := range exams {
+		if _, err := db.Exec(ctx, `INSERT INTO exams (school_id, name, class, subject) VALUES ($1, 'Terminal', $2, $3)`,
+			school, e.class, e.subject); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := db.Exec(ctx, normalizeExamClasses); err != nil {
+		t.Fatal(err)
+	}
+
+	var classes int
+	if err := db.QueryRow(ctx, `SELECT COUNT(*) FROM classes WHERE school_id = $1`, school).Scan(&classes); err != nil {
+		t.Fatal(err)
+	}
+	if classes != 2 {
+		t.Errorf("%d classes, want Grade 5 and Grade 6", classes)
+	}
+
+	codes := map[string]string{}
+	rows, err := db.Query(ctx, `SELECT upper(code), lower(name) FROM subjects WHERE school_id = $1`, school)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var code, name string
+		if err := rows.Scan(&code, &name); err != nil {
+			t.Fatal(err)
+		}
+		codes[code] = name
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != 2 || codes["SCIENCETECH"] != "science & tech" || codes["MATHS"] == "" {
+		t.Errorf("subjects = %v, want MATHS and SCIENCETECH", codes)
+	}
+
+	// Exams point at their class and subject and drop the names, but for
+	// those of the subject whose code was taken
+	loser, kept := "maths", 2
+	if codes["MATHS"] == "maths" {
+		loser, kept = "math-s", 1
+	}
+	var unplaced, unlinked, linked int
+	err = db.QueryRow(ctx, `
+	SELECT COUNT(*) FILTER (WHERE class_id IS NULL OR class IS NOT NULL),
+		COUNT(*) FILTER (WHERE subject_id IS NULL AND lower(btrim(subject)) = $2),
+		COUNT(*) FILTER (WHERE subject_id IS NOT NULL AND subject IS NULL)
+	FROM exams WHERE school_id = $1`, school, loser,
+	).Scan(&unplaced, &unlinked, &linked)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if unplaced != 0 || unlinked != kept || linked != len(exams)-kept {
+		t.Errorf("%d exams without their class, %d of %s keeping the name, %d linked; want 0, %d and %d",
+			unplaced, unlinked, loser, linked, kept, len(exams)-kept)
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
@@ -8,11 +9,16 @@ import (
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/joho/godotenv"
+	"github.com/nats-io/nats.go"
+	"github.com/prometheus/client_golang/prometheus"
 
 	"school-erp/exam/config"
 	"school-erp/exam/database"
 	"school-erp/exam/messaging"
 	"school-erp/exam/routes"
+	"school-erp/pkg/features"
+	"school-erp/pkg/problem"
+	"school-erp/pkg/tenant"
 )
 
 // Helper function to check if an origin is in the allowed list
@@ -27,7 +33,10 @@ func contains(allowedOrigins string, origin string) bool {
 }
 func main() {
 	godotenv.Load()
-	cfg := config.LoadConfig()
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
 
 	db, err := database.InitDB(cfg)
 	if err != nil {
@@ -39,33 +48,72 @@ func main() {
 		log.Fatalf("Failed to run migrations: %v", err)
 	}
 
+	// Tenant passwords are encrypted with the keyring in ENCRYPTION_KEY;
+	// production refuses a weak or padded primary key
+	keys, err := tenant.LoadKeyring(cfg.EncryptionKey, strings.EqualFold(cfg.Environment, "production"))
+	if err != nil {
+		log.Fatalf("Invalid ENCRYPTION_KEY: %v", err)
+	}
+
+	// Requests are served from the database of the school they name
+	tenantManager := tenant.NewTenantManager(
+		keys,
+		tenant.PoolLimits{
+			MaxConns:            int32(cfg.TenantMaxConns),
+			MaxTotalConns:       int32(cfg.TenantMaxTotalConns),
+			MaxConnLifetime:     cfg.TenantConnMaxLifetime,
+			MaxConnIdleTime:     cfg.TenantConnMaxIdleTime,
+			IdleTimeout:         cfg.TenantPoolIdleTimeout,
+			HealthCheckInterval: cfg.TenantHealthCheckInterval,
+		},
+		// Only connects to existing tenant databases; creating them is the
+		// school service's job
+		tenant.Admin{SSLMode: cfg.DBSSLMode},
+	)
+	defer tenantManager.CloseAllConnections()
+	prometheus.MustRegister(tenantManager)
+
 	messaging.ConnectNATS()
 	defer messaging.NatsConnection.Close()
 
-	app := fiber.New(fiber.Config{AppName: "School ERP Exam Service"})
-	setupMiddleware(app)
-
-	app.Get("/", func(c *fiber.Ctx) error {
-		return c.JSON(fiber.Map{
-			"service": "School ERP Exam Service",
-			"version": "v1.0.0",
-			"status": "running",
-			"endpoints": fiber.Map{
-				"health": "/health",
-				"metrics": "/metrics",
-				"exams": "/api/v1/exams",
-			},
-		})
-	})
+	// Verified custom domains name their school; the school service
+	// announces changes with SchoolUpdated events
+	domains := tenant.NewDomainMap(db)
+	if _, err := messaging.NatsConnection.Subscribe(tenant.SubjectSchoolUpdated, func(m *nats.Msg) {
+		domains.HandleEvent(m.Data)
+	}); err != nil {
+		log.Fatalf("Failed to subscribe to %s: %v", tenant.SubjectSchoolUpdated, err)
+	}
+	if err := domains.Refresh(context.Background()); err != nil {
+		log.Fatalf("Failed to load tenant domains: %v", err)
+	}
 
-	routes.SetupRoutes(app, db)
+	// Schools that turned the exams module off are refused with 403
+	modules := features.NewClient(db, cfg.FeatureCacheTTL)
+	if _, err := messaging.NatsConnection.Subscribe(features.SubjectFeaturesChanged, func(m *nats.Msg) {
+		modules.HandleEvent(m.Data)
+	}); err != nil {
+		log.Fatalf("Failed to subscribe to %s: %v", features.SubjectFeaturesChanged, err)
+	}
 
-	app.Get("/health", func(c *fiber.Ctx) error {
-		return c.JSON(fiber.Map{"status": "healthy", "service": "exam"})
+	tenants := tenant.New(tenant.Config{
+		Manager:   tenantManager,
+		Directory: tenant.NewPostgresDirectory(db),
+		Domains:   domains,
+		Shared:    db,
+		JWTSecret: cfg.JWTSecret,
 	})
-	app.Get("/metrics", func(c *fiber.Ctx) error {
-		return c.JSON(fiber.Map{"uptime": "N/A", "status": "operational"})
+
+	app := fiber.New(fiber.Config{
+		AppName:      "School ERP Exam Service",
+		ErrorHandler: problem.ErrorHandler,
 	})
+	setupMiddleware(app)
+
+	routes.SetupRoutes(app, db, tenants, features.Require(modules, features.ModuleExams))
+
+	// Welcome, health, metrics and API document
+	routes.SetupSystemRoutes(app)
 
 	port := cfg.Port
 	log.Printf("Starting Exam Service on port %s\n", port)
@@ -90,7 +138,7 @@ func setupMiddleware(app *fiber.App) {
 			c.Set("Access-Control-Allow-Credentials", "true")
 		}
 		c.Set("Access-Control-Allow-Methods", "GET,PUT,POST,DELETE,OPTIONS")
-		c.Set("Access-Control-Allow-Headers", "Content-Type,Authorization")
+		c.Set("Access-Control-Allow-Headers", "Content-Type,Authorization,X-Tenant-Code")
 		if c.Method() == "OPTIONS" {
 			return c.SendStatus(204)
 		}
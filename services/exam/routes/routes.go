@@ -7,10 +7,14 @@ import (
 	"school-erp/exam/handlers"
 )
 
-func SetupRoutes(app *fiber.App, db *pgxpool.Pool) {
+// SetupRoutes mounts the API. tenants resolves the caller's school; routes
+// registered after it run against that school's database (tenant.DB), and
+// are refused by modules when the school has the exams module off.
+func SetupRoutes(app *fiber.App, db *pgxpool.Pool, tenants, modules fiber.Handler) {
 	h := handlers.NewHandler(db)
 	api := app.Group("/api/v1")
-	
-	// Add service-specific routes here
 	api.Get("/", h.Health)
+
+	// Add service-specific routes here
+	api.Use(tenants, modules)
 }
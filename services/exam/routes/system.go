@@ -0,0 +1,35 @@
+package routes
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"school-erp/pkg/openapi"
+)
+
+// SetupSystemRoutes mounts the welcome, health and metrics routes and the
+// API document
+func SetupSystemRoutes(app *fiber.App) {
+	// Welcome route
+	app.Get("/", func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{
+			"service": "School ERP Exam Service",
+			"version": "v1.0.0",
+			"status":  "running",
+			"endpoints": fiber.Map{
+				"health":  "/health",
+				"openapi": "/openapi.json",
+				"metrics": "/metrics",
+				"exams":   "/api/v1/exams",
+			},
+		})
+	})
+
+	// Health check
+	app.Get("/health", func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{"status": "healthy", "service": "exam"})
+	})
+	app.Get("/metrics", adaptor.HTTPHandler(promhttp.Handler()))
+	app.Get("/openapi.json", openapi.Handler(app, APIInfo, Operations))
+}
@@ -5,10 +5,22 @@ import (
 	"log"
 
 	"github.com/jackc/pgx/v5/pgxpool"
+
+	"school-erp/pkg/academic"
+	"school-erp/pkg/idempotency"
+	"school-erp/pkg/tenant"
 )
 
 func RunMigrations(pool *pgxpool.Pool) error {
-	migrations := []string{createFeeStructureTable, createInvoiceTable}
+	migrations := []string{
+		createFeeStructureTable,
+		createInvoiceTable,
+		idempotency.Migration,
+		createFeeReceiptsTable,
+		addInvoiceAcademicYears,
+		academic.Backfill("invoices", "COALESCE(t.due_date, t.created_at)"),
+		tenant.RLSMigration("fee_structures", "invoices", "fee_receipts"),
+	}
 
 	for _, migration := range migrations {
 		if _, err := pool.Exec(context.Background(), migration); err != nil {
@@ -48,3 +60,33 @@ CREATE TABLE IF NOT EXISTS invoices (
 
 CREATE INDEX IF NOT EXISTS idx_invoices_student_id ON invoices(student_id);
 `
+
+// addInvoiceAcademicYears stamps invoices with the academic year they bill
+// for; years are kept in the main database's academic_years
+const addInvoiceAcademicYears = `
+ALTER TABLE invoices ADD COLUMN IF NOT EXISTS academic_year_id UUID;
+
+CREATE INDEX IF NOT EXISTS idx_invoices_academic_year_id ON invoices(academic_year_id);
+`
+
+// createFeeReceiptsTable holds uploaded receipts and deposit slips of fee
+// payments; the files are in the file store under file_key. Students with
+// receipts cannot be deleted.
+const createFeeReceiptsTable = `
+CREATE TABLE IF NOT EXISTS fee_receipts (
+	id BIGSERIAL PRIMARY KEY,
+	school_id BIGINT NOT NULL,
+	student_id BIGINT NOT NULL,
+	invoice_id BIGINT,
+	reference VARCHAR(100),
+	file_key TEXT NOT NULL UNIQUE,
+	content_type VARCHAR(100) NOT NULL,
+	size BIGINT NOT NULL,
+	uploaded_by VARCHAR(255),
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (student_id) REFERENCES students(id),
+	FOREIGN KEY (invoice_id) REFERENCES invoices(id) ON DELETE SET NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_fee_receipts_student_id ON fee_receipts(student_id);
+`
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"school-erp/pkg/bs"
+	"school-erp/pkg/problem"
+	"school-erp/pkg/settings"
+	"school-erp/pkg/tenant"
+)
+
+// calendar returns the calendar the request's dates are given and shown in:
+// the calendar query parameter, or else the calendar of the school's
+// academic settings. Dates are stored in AD either way.
+func (h *Handler) calendar(c *fiber.Ctx) (bs.Calendar, error) {
+	if name := c.Query("calendar"); name != "" {
+		cal := bs.Calendar(strings.ToUpper(name))
+		if !cal.Valid() {
+			return "", problem.BadRequest(problem.CodeInvalidQuery, "calendar must be AD or BS")
+		}
+		return cal, nil
+	}
+	var s settings.Academic
+	if err := h.settings.Load(c.Context(), tenant.CurrentSchool(c).ID, &s); err != nil {
+		return "", problem.Internal("Failed to read the school's settings", err)
+	}
+	return bs.Calendar(s.Calendar), nil
+}
+
+// reportRange reads the AD days a report covers: month, a YYYY-MM month of
+// cal, or else from and to, YYYY-MM-DD days of cal. ok is false when the
+// request names no days.
+func reportRange(c *fiber.Ctx, cal bs.Calendar) (from, to time.Time, ok bool, err error) {
+	month, fromDay, toDay := c.Query("month"), c.Query("from"), c.Query("to")
+	switch {
+	case month != "" && (fromDay != "" || toDay != ""):
+		return from, to, false, problem.BadRequest(problem.CodeInvalidQuery, "month cannot be combined with from or to")
+	case month != "":
+		if from, to, err = cal.ParseMonth(month); err != nil {
+			return from, to, false, problem.BadRequest(problem.CodeInvalidQuery, "month must be a YYYY-MM month of the "+string(cal)+" calendar")
+		}
+		return from, to, true, nil
+	case fromDay == "" && toDay == "":
+		return from, to, false, nil
+	}
+
+	if from, err = cal.Parse(fromDay); err != nil {
+		return from, to, false, problem.BadRequest(problem.CodeInvalidQuery, "from must be a YYYY-MM-DD day of the "+string(cal)+" calendar")
+	}
+	if to, err = cal.Parse(toDay); err != nil {
+		return from, to, false, problem.BadRequest(problem.CodeInvalidQuery, "to must be a YYYY-MM-DD day of the "+string(cal)+" calendar")
+	}
+	if to.Before(from) {
+		return from, to, false, problem.BadRequest(problem.CodeInvalidQuery, "to must not be before from")
+	}
+	return from, to, true, nil
+}
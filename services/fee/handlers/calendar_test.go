@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+
+	"school-erp/pkg/bs"
+	"school-erp/pkg/problem"
+)
+
+// rangeOf returns the days reportRange reads from query in cal, as
+// "from to", or the status of its problem
+func rangeOf(t *testing.T, cal bs.Calendar, query string) (string, int) {
+	t.Helper()
+	app := fiber.New(fiber.Config{ErrorHandler: problem.ErrorHandler})
+	app.Get("/", func(c *fiber.Ctx) error {
+		from, to, ok, err := reportRange(c, cal)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return c.SendString("all")
+		}
+		return c.SendString(from.Format("2006-01-02") + " " + to.Format("2006-01-02"))
+	})
+	resp, err := app.Test(httptest.NewRequest("GET", "/?"+query, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	return string(body), resp.StatusCode
+}
+
+func TestReportRange(t *testing.T) {
+	cases := []struct {
+		cal   bs.Calendar
+		query string
+		want  string
+	}{
+		// Chaitra 2081 ends the day before Baisakh 2082 starts on 2025-04-14
+		{bs.BS, "month=2081-12", "2025-03-14 2025-04-13"},
+		{bs.BS, "month=2082-1", "2025-04-14 2025-05-14"},
+		{bs.BS, "from=2081-12-31&to=2082-01-01", "2025-04-13 2025-04-14"},
+		{bs.AD, "month=2025-04", "2025-04-01 2025-04-30"},
+		{bs.AD, "from=2025-04-13&to=2025-04-14", "2025-04-13 2025-04-14"},
+		{bs.BS, "", "all"},
+	}
+	for _, tc := range cases {
+		if got, status := rangeOf(t, tc.cal, tc.query); status != fiber.StatusOK || got != tc.want {
+			t.Errorf("%s %s: got %q (%d), want %q", tc.cal, tc.query, got, status, tc.want)
+		}
+	}
+
+	for _, query := range []string{
+		"month=2081-12&from=2081-12-01",
+		"month=2081-13",
+		"from=2081-12-32&to=2082-01-01",
+		"from=2081-12-01",
+		"from=2082-01-02&to=2082-01-01",
+	} {
+		if got, status := rangeOf(t, bs.BS, query); status != fiber.StatusBadRequest {
+			t.Errorf("%s: got %q (%d), want 400", query, got, status)
+		}
+	}
+}
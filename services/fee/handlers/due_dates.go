@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"school-erp/pkg/problem"
+	"school-erp/pkg/settings"
+	"school-erp/pkg/tenant"
+)
+
+// DueDate is when the fees of a month fall due. Year, Month and dates, as
+// YYYY-MM-DD days, are of the calendar of the request.
+type DueDate struct {
+	Year      int    `json:"year"`
+	Month     int    `json:"month"`
+	Scheduled string `json:"scheduled" doc:"The due day of the fee settings in the month"`
+	Due       string `json:"due" doc:"The first working day from the scheduled day"`
+	GraceEnds string `json:"grace_ends" doc:"The last day paid without a late fee"`
+}
+
+// ListDueDates handles GET /api/v1/fees/due-dates, the due dates of the
+// months of year, or of the current year, in the calendar query parameter or
+// else the school's calendar. Fees scheduled on a holiday or weekly off are
+// due the next working day.
+func (h *Handler) ListDueDates(c *fiber.Ctx) error {
+	schoolID := tenant.CurrentSchool(c).ID
+	var fee settings.Fee
+	if err := h.settings.Load(c.Context(), schoolID, &fee); err != nil {
+		return problem.Internal("Failed to read the school's settings", err)
+	}
+	months, err := h.calendar(c)
+	if err != nil {
+		return err
+	}
+
+	year, _, err := months.MonthOf(time.Now())
+	if err != nil {
+		return problem.Internal("Failed to read the current year", err)
+	}
+	if c.Query("year") != "" {
+		if year = c.QueryInt("year"); year == 0 {
+			return problem.BadRequest(problem.CodeInvalidQuery, "year must be a number")
+		}
+	}
+
+	cal, err := h.calendars.Calendar(c.Context(), schoolID)
+	if err != nil {
+		return problem.Internal("Failed to read the school's calendar", err)
+	}
+	dates := make([]DueDate, 0, 12)
+	for month := 1; month <= 12; month++ {
+		first, _, err := months.MonthBounds(year, month)
+		if err != nil {
+			return problem.BadRequest(problem.CodeInvalidQuery, "year is outside the "+string(months)+" calendar")
+		}
+		scheduled := first.AddDate(0, 0, fee.DueDay-1)
+		due := cal.NextWorkingDay("", scheduled)
+		dates = append(dates, DueDate{
+			Year:      year,
+			Month:     month,
+			Scheduled: months.Format(scheduled),
+			Due:       months.Format(due),
+			GraceEnds: months.Format(due.AddDate(0, 0, fee.GraceDays)),
+		})
+	}
+	return c.JSON(dates)
+}
@@ -3,14 +3,26 @@ package handlers
 import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/jackc/pgx/v5/pgxpool"
+
+	"school-erp/pkg/calendar"
+	"school-erp/pkg/plans"
+	"school-erp/pkg/settings"
+	"school-erp/pkg/storage"
 )
 
+// Handler serves the fee API. Receipts are kept in files, up to the storage
+// limits of the plans in limits. Fees fall due by the schools' fee settings
+// in prefs, on working days of their calendars in calendars.
 type Handler struct {
-	db *pgxpool.Pool
+	db        *pgxpool.Pool
+	plans     *plans.Client
+	files     *storage.Files
+	settings  *settings.Client
+	calendars *calendar.Client
 }
 
-func NewHandler(db *pgxpool.Pool) *Handler {
-	return &Handler{db: db}
+func NewHandler(db *pgxpool.Pool, limits *plans.Client, files *storage.Files, prefs *settings.Client, calendars *calendar.Client) *Handler {
+	return &Handler{db: db, plans: limits, files: files, settings: prefs, calendars: calendars}
 }
 
 func (h *Handler) Health(c *fiber.Ctx) error {
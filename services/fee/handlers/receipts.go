@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5"
+
+	"school-erp/pkg/plans"
+	"school-erp/pkg/problem"
+	"school-erp/pkg/storage"
+	"school-erp/pkg/tenant"
+)
+
+// Receipt is an uploaded receipt or deposit slip of a fee payment. URL
+// downloads it until it expires; ask again for a fresh one.
+type Receipt struct {
+	ID          string    `json:"id"`
+	StudentID   string    `json:"student_id"`
+	InvoiceID   *string   `json:"invoice_id"`
+	Reference   string    `json:"reference"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	UploadedBy  string    `json:"uploaded_by"`
+	CreatedAt   time.Time `json:"created_at"`
+	URL         string    `json:"url"`
+	fileKey     string
+}
+
+// UploadReceiptRequest is the form of a receipt upload, besides its file
+type UploadReceiptRequest struct {
+	StudentID string `form:"student_id" validate:"required,max=64"`
+	InvoiceID string `form:"invoice_id" validate:"omitempty,max=64"`
+	Reference string `form:"reference" validate:"omitempty,max=100"`
+}
+
+const receiptColumns = `id::text, student_id::text, invoice_id::text, COALESCE(reference, ''), content_type, size,
+	COALESCE(uploaded_by, ''), created_at, file_key`
+
+func scanReceipt(row pgx.Row, r *Receipt) error {
+	return row.Scan(&r.ID, &r.StudentID, &r.InvoiceID, &r.Reference, &r.ContentType, &r.Size,
+		&r.UploadedBy, &r.CreatedAt, &r.fileKey)
+}
+
+// withURL sets the receipt's download URL
+func (h *Handler) withURL(r *Receipt) error {
+	url, err := h.files.URL(r.fileKey)
+	if err != nil {
+		return storage.Problem(err)
+	}
+	r.URL = url
+	return nil
+}
+
+// ListReceipts handles GET /api/v1/fees/receipts, optionally of one student
+// and uploaded in month or from from to to, days of the calendar query
+// parameter or else of the school's settings
+func (h *Handler) ListReceipts(c *fiber.Ctx) error {
+	cal, err := h.calendar(c)
+	if err != nil {
+		return err
+	}
+	from, to, byDay, err := reportRange(c, cal)
+	if err != nil {
+		return err
+	}
+
+	where, args := []string{}, []any{}
+	if id := c.Query("student_id"); id != "" {
+		args = append(args, id)
+		where = append(where, fmt.Sprintf("student_id = $%d", len(args)))
+	}
+	if byDay {
+		args = append(args, from, to)
+		where = append(where, fmt.Sprintf("created_at::date BETWEEN $%d AND $%d", len(args)-1, len(args)))
+	}
+	sql := `SELECT ` + receiptColumns + ` FROM fee_receipts`
+	if len(where) > 0 {
+		sql += ` WHERE ` + strings.Join(where, " AND ")
+	}
+	rows, err := tenant.DB(c).Query(c.Context(), sql+` ORDER BY created_at DESC, id`, args...)
+	if err != nil {
+		return problem.FromDB(err, "Receipt")
+	}
+	defer rows.Close()
+
+	receipts := []Receipt{}
+	for rows.Next() {
+		var r Receipt
+		if err := scanReceipt(rows, &r); err != nil {
+			return problem.FromDB(err, "Receipt")
+		}
+		if err := h.withURL(&r); err != nil {
+			return err
+		}
+		receipts = append(receipts, r)
+	}
+	if err := rows.Err(); err != nil {
+		return problem.FromDB(err, "Receipt")
+	}
+	return c.JSON(receipts)
+}
+
+// GetReceipt handles GET /api/v1/fees/receipts/:id
+func (h *Handler) GetReceipt(c *fiber.Ctx) error {
+	var r Receipt
+	err := scanReceipt(tenant.DB(c).QueryRow(c.Context(),
+		`SELECT `+receiptColumns+` FROM fee_receipts WHERE id = $1`, c.Params("id")), &r)
+	if err != nil {
+		return problem.FromDB(err, "Receipt")
+	}
+	if err := h.withURL(&r); err != nil {
+		return err
+	}
+	return c.JSON(r)
+}
+
+// UploadReceipt handles POST /api/v1/fees/receipts. The file is checked by
+// its content, scanned and stored under the school's prefix, up to the
+// storage limit of the school's plan.
+func (h *Handler) UploadReceipt(c *fiber.Ctx) error {
+	var req UploadReceiptRequest
+	if err := c.BodyParser(&req); err != nil {
+		return problem.BadRequest(problem.CodeInvalidBody, "Invalid form")
+	}
+	if err := problem.Validate(req); err != nil {
+		return err
+	}
+	data, err := storage.Upload(c, "file", storage.ReceiptPolicy)
+	if err != nil {
+		return err
+	}
+
+	// Storage is sampled by the school service, so the check lags behind
+	// uploads made since
+	school := tenant.CurrentSchool(c)
+	verdict, err := h.plans.Check(c.Context(), school.ID, plans.MetricStorage, int64(len(data)))
+	if err != nil {
+		return problem.Internal("Failed to read the school's plan", err)
+	}
+	if err := plans.Enforce(c, verdict); err != nil {
+		return err
+	}
+
+	file, err := h.files.Save(c.Context(), storage.SchoolPrefix(school.ID), "receipts", data, storage.ReceiptPolicy)
+	if err != nil {
+		return storage.Problem(err)
+	}
+	// The student and invoice IDs take the type of their columns: UUIDs in
+	// school databases, numbers in the shared one
+	var invoiceID *string
+	if req.InvoiceID != "" {
+		invoiceID = &req.InvoiceID
+	}
+	var r Receipt
+	err = scanReceipt(tenant.DB(c).QueryRow(c.Context(), `
+	INSERT INTO fee_receipts (student_id, invoice_id, reference, file_key, content_type, size, uploaded_by)
+	VALUES ($1, $2, NULLIF($3, ''), $4, $5, $6, $7)
+	RETURNING `+receiptColumns,
+		req.StudentID, invoiceID, req.Reference, file.Key, file.ContentType, file.Size, actor(c),
+	), &r)
+	if err != nil {
+		_ = h.files.Delete(c.Context(), file.Key)
+		return problem.FromDB(err, "Receipt")
+	}
+	if err := h.withURL(&r); err != nil {
+		return err
+	}
+	return c.Status(fiber.StatusCreated).JSON(r)
+}
+
+// DeleteReceipt handles DELETE /api/v1/fees/receipts/:id
+func (h *Handler) DeleteReceipt(c *fiber.Ctx) error {
+	var key string
+	err := tenant.DB(c).QueryRow(c.Context(),
+		`DELETE FROM fee_receipts WHERE id = $1 RETURNING file_key`, c.Params("id")).Scan(&key)
+	if err != nil {
+		return problem.FromDB(err, "Receipt")
+	}
+	if err := h.files.Delete(c.Context(), key); err != nil {
+		return storage.Problem(err)
+	}
+	return c.JSON(fiber.Map{"message": "Receipt deleted"})
+}
+
+// actor is who made the request, as forwarded by the gateway
+func actor(c *fiber.Ctx) string {
+	if id := c.Get("X-User-ID"); id != "" {
+		return "user:" + id
+	}
+	return "api"
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
@@ -8,11 +9,20 @@ import (
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/joho/godotenv"
+	"github.com/nats-io/nats.go"
+	"github.com/prometheus/client_golang/prometheus"
 
 	"school-erp/fee/config"
 	"school-erp/fee/database"
 	"school-erp/fee/messaging"
 	"school-erp/fee/routes"
+	"school-erp/pkg/calendar"
+	"school-erp/pkg/idempotency"
+	"school-erp/pkg/plans"
+	"school-erp/pkg/problem"
+	"school-erp/pkg/settings"
+	"school-erp/pkg/storage"
+	"school-erp/pkg/tenant"
 )
 
 // Helper function to check if an origin is in the allowed list
@@ -27,7 +37,10 @@ func contains(allowedOrigins string, origin string) bool {
 }
 func main() {
 	godotenv.Load()
-	cfg := config.LoadConfig()
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
 
 	db, err := database.InitDB(cfg)
 	if err != nil {
@@ -39,33 +52,100 @@ func main() {
 		log.Fatalf("Failed to run migrations: %v", err)
 	}
 
+	// Delete expired idempotency keys in the background
+	if cfg.IdempotencyPurgeInterval > 0 {
+		purgeCtx, stopPurge := context.WithCancel(context.Background())
+		defer stopPurge()
+		go idempotency.NewPostgresStore(db).Run(purgeCtx, cfg.IdempotencyPurgeInterval)
+	}
+
+	// Tenant passwords are encrypted with the keyring in ENCRYPTION_KEY;
+	// production refuses a weak or padded primary key
+	keys, err := tenant.LoadKeyring(cfg.EncryptionKey, strings.EqualFold(cfg.Environment, "production"))
+	if err != nil {
+		log.Fatalf("Invalid ENCRYPTION_KEY: %v", err)
+	}
+
+	// Requests are served from the database of the school they name
+	tenantManager := tenant.NewTenantManager(
+		keys,
+		tenant.PoolLimits{
+			MaxConns:            int32(cfg.TenantMaxConns),
+			MaxTotalConns:       int32(cfg.TenantMaxTotalConns),
+			MaxConnLifetime:     cfg.TenantConnMaxLifetime,
+			MaxConnIdleTime:     cfg.TenantConnMaxIdleTime,
+			IdleTimeout:         cfg.TenantPoolIdleTimeout,
+			HealthCheckInterval: cfg.TenantHealthCheckInterval,
+		},
+		// Only connects to existing tenant databases; creating them is the
+		// school service's job
+		tenant.Admin{SSLMode: cfg.DBSSLMode},
+	)
+	defer tenantManager.CloseAllConnections()
+	prometheus.MustRegister(tenantManager)
+
 	messaging.ConnectNATS()
 	defer messaging.NatsConnection.Close()
 
-	app := fiber.New(fiber.Config{AppName: "School ERP Fee Service"})
-	setupMiddleware(app)
+	// Verified custom domains name their school; the school service
+	// announces changes with SchoolUpdated events
+	domains := tenant.NewDomainMap(db)
+	if _, err := messaging.NatsConnection.Subscribe(tenant.SubjectSchoolUpdated, func(m *nats.Msg) {
+		domains.HandleEvent(m.Data)
+	}); err != nil {
+		log.Fatalf("Failed to subscribe to %s: %v", tenant.SubjectSchoolUpdated, err)
+	}
+	if err := domains.Refresh(context.Background()); err != nil {
+		log.Fatalf("Failed to load tenant domains: %v", err)
+	}
 
-	app.Get("/", func(c *fiber.Ctx) error {
-		return c.JSON(fiber.Map{
-			"service": "School ERP Fee Service",
-			"version": "v1.0.0",
-			"status": "running",
-			"endpoints": fiber.Map{
-				"health": "/health",
-				"metrics": "/metrics",
-				"fees": "/api/v1/fees",
-			},
-		})
-	})
+	// Receipts count against the storage limit of the school's plan
+	limits := plans.NewClient(db, cfg.PlanCacheTTL)
+	if _, err := messaging.NatsConnection.Subscribe(plans.SubjectPlanChanged, func(m *nats.Msg) {
+		limits.HandleEvent(m.Data)
+	}); err != nil {
+		log.Fatalf("Failed to subscribe to %s: %v", plans.SubjectPlanChanged, err)
+	}
 
-	routes.SetupRoutes(app, db)
+	// Fees fall due on the due day of the school's fee settings, moved past
+	// holidays of its calendar
+	prefs := settings.NewClient(db, cfg.SettingsCacheTTL)
+	if _, err := messaging.NatsConnection.Subscribe(settings.SubjectSettingsChanged, func(m *nats.Msg) {
+		prefs.HandleEvent(m.Data)
+	}); err != nil {
+		log.Fatalf("Failed to subscribe to %s: %v", settings.SubjectSettingsChanged, err)
+	}
+	cal := calendar.NewClient(db, prefs, cfg.CalendarCacheTTL)
+	if _, err := messaging.NatsConnection.Subscribe(calendar.SubjectCalendarChanged, func(m *nats.Msg) {
+		cal.HandleEvent(m.Data)
+	}); err != nil {
+		log.Fatalf("Failed to subscribe to %s: %v", calendar.SubjectCalendarChanged, err)
+	}
 
-	app.Get("/health", func(c *fiber.Ctx) error {
-		return c.JSON(fiber.Map{"status": "healthy", "service": "fee"})
+	// Receipts share the school service's file store
+	files, err := storage.OpenFiles(cfg.Storage())
+	if err != nil {
+		log.Fatalf("Failed to open file storage: %v", err)
+	}
+
+	tenants := tenant.New(tenant.Config{
+		Manager:   tenantManager,
+		Directory: tenant.NewPostgresDirectory(db),
+		Domains:   domains,
+		Shared:    db,
+		JWTSecret: cfg.JWTSecret,
 	})
-	app.Get("/metrics", func(c *fiber.Ctx) error {
-		return c.JSON(fiber.Map{"uptime": "N/A", "status": "operational"})
+
+	app := fiber.New(fiber.Config{
+		AppName:      "School ERP Fee Service",
+		ErrorHandler: problem.ErrorHandler,
 	})
+	setupMiddleware(app)
+
+	routes.SetupRoutes(app, db, tenants, limits, files, prefs, cal)
+
+	// Welcome, health, metrics and API document
+	routes.SetupSystemRoutes(app)
 
 	port := cfg.Port
 	log.Printf("Starting Fee Service on port %s\n", port)
@@ -90,7 +170,7 @@ func setupMiddleware(app *fiber.App) {
 			c.Set("Access-Control-Allow-Credentials", "true")
 		}
 		c.Set("Access-Control-Allow-Methods", "GET,PUT,POST,DELETE,OPTIONS")
-		c.Set("Access-Control-Allow-Headers", "Content-Type,Authorization")
+		c.Set("Access-Control-Allow-Headers", "Content-Type,Authorization,X-Tenant-Code,Idempotency-Key")
 		if c.Method() == "OPTIONS" {
 			return c.SendStatus(204)
 		}
@@ -0,0 +1,65 @@
+package routes
+
+import (
+	"school-erp/fee/handlers"
+	"school-erp/pkg/idempotency"
+	"school-erp/pkg/openapi"
+	"school-erp/pkg/tenant"
+)
+
+// tenantParam names the school whose database serves the request. It may
+// instead come from the subdomain or the token's tenant_code claim.
+var tenantParam = openapi.Param{Name: tenant.HeaderCode, In: "header", Description: "School code", Schema: &openapi.Schema{Type: "string"}}
+
+var idempotencyParam = openapi.Param{Name: idempotency.HeaderKey, In: "header", Description: "Replays the first response for retries with the same key", Schema: &openapi.Schema{Type: "string"}}
+
+var calendarParam = openapi.Param{Name: "calendar", In: "query", Description: "Calendar of the dates, AD or BS; the school's calendar setting when omitted", Schema: &openapi.Schema{Type: "string", Enum: []interface{}{"AD", "BS"}}}
+
+var receiptUpload = openapi.Raw{
+	ContentType: "multipart/form-data",
+	Schema: &openapi.Schema{
+		Type: "object",
+		Properties: map[string]*openapi.Schema{
+			"file":       {Type: "string", Format: "binary"},
+			"student_id": {Type: "string"},
+			"invoice_id": {Type: "string"},
+			"reference":  {Type: "string"},
+		},
+		Required: []string{"file", "student_id"},
+	},
+}
+
+// APIInfo describes the service in its OpenAPI document.
+var APIInfo = openapi.Info{
+	Title:   "School ERP Fee Service",
+	Version: "1.0.0",
+}
+
+// Operations documents every route mounted by SetupRoutes and main.
+var Operations = []openapi.Operation{
+	{Method: "GET", Path: "/api/v1/", Summary: "API status", Responses: openapi.Responses{200: openapi.Any}},
+
+	{Method: "GET", Path: "/api/v1/fees/receipts/", Summary: "List fee receipts with download URLs", Tags: []string{"Receipts"}, Auth: true,
+		Params: []openapi.Param{tenantParam, calendarParam,
+			{Name: "student_id", In: "query", Description: "Only the student's receipts", Schema: &openapi.Schema{Type: "string"}},
+			{Name: "month", In: "query", Description: "Only receipts uploaded in this YYYY-MM month of the calendar", Schema: &openapi.Schema{Type: "string"}},
+			{Name: "from", In: "query", Description: "Only receipts uploaded from this day of the calendar, with to", Schema: &openapi.Schema{Type: "string"}},
+			{Name: "to", In: "query", Description: "Only receipts uploaded up to this day of the calendar, with from", Schema: &openapi.Schema{Type: "string"}}},
+		Responses: openapi.Responses{200: openapi.List(handlers.Receipt{})}},
+	{Method: "GET", Path: "/api/v1/fees/receipts/:id", Summary: "Get a fee receipt with a download URL", Tags: []string{"Receipts"}, Auth: true,
+		Params: []openapi.Param{tenantParam}, Responses: openapi.Responses{200: handlers.Receipt{}}},
+	{Method: "POST", Path: "/api/v1/fees/receipts/", Summary: "Upload a receipt or deposit slip, up to the storage limit of the school's plan", Tags: []string{"Receipts"}, Auth: true,
+		Params: []openapi.Param{tenantParam, idempotencyParam}, Request: receiptUpload, Responses: openapi.Responses{201: handlers.Receipt{}}},
+	{Method: "DELETE", Path: "/api/v1/fees/receipts/:id", Summary: "Delete a fee receipt", Tags: []string{"Receipts"}, Auth: true,
+		Params: []openapi.Param{tenantParam, idempotencyParam}, Responses: openapi.Responses{200: openapi.Message{}}},
+
+	{Method: "GET", Path: "/api/v1/fees/due-dates", Summary: "List when a year's monthly fees fall due, moved past holidays to working days", Tags: []string{"Fees"}, Auth: true,
+		Params:    []openapi.Param{tenantParam, calendarParam, {Name: "year", In: "query", Description: "Year of the calendar; the current year when omitted", Schema: &openapi.Schema{Type: "integer"}}},
+		Responses: openapi.Responses{200: openapi.List(handlers.DueDate{})}},
+
+	{Method: "GET", Path: "/", Summary: "Service information", Responses: openapi.Responses{200: openapi.Any}},
+	{Method: "GET", Path: "/health", Summary: "Health check", Responses: openapi.Responses{200: openapi.Health{}}},
+	{Method: "GET", Path: "/metrics", Summary: "Prometheus metrics, including tenant connection pools",
+		Responses: openapi.Responses{200: openapi.Raw{ContentType: "text/plain", Schema: &openapi.Schema{Type: "string"}}}},
+	{Method: "GET", Path: "/openapi.json", Summary: "OpenAPI document", Responses: openapi.Responses{200: openapi.Any}},
+}
@@ -5,12 +5,46 @@ import (
 	"github.com/jackc/pgx/v5/pgxpool"
 
 	"school-erp/fee/handlers"
+	"school-erp/fee/middleware"
+	"school-erp/pkg/calendar"
+	"school-erp/pkg/idempotency"
+	"school-erp/pkg/plans"
+	"school-erp/pkg/settings"
+	"school-erp/pkg/storage"
+	"school-erp/pkg/tenant"
 )
 
-func SetupRoutes(app *fiber.App, db *pgxpool.Pool) {
-	h := handlers.NewHandler(db)
+// SetupRoutes mounts the API. tenants resolves the caller's school; routes
+// registered after it run against that school's database (tenant.DB).
+// Receipts are kept in files, up to the storage limits of the plans in
+// limits. Due dates follow the fee settings in prefs and the working days of
+// the calendars in calendars.
+func SetupRoutes(app *fiber.App, db *pgxpool.Pool, tenants fiber.Handler, limits *plans.Client, files *storage.Files, prefs *settings.Client, calendars *calendar.Client) {
+	h := handlers.NewHandler(db, limits, files, prefs, calendars)
 	api := app.Group("/api/v1")
-	
-	// Add service-specific routes here
 	api.Get("/", h.Health)
+
+	// Receipt uploads retried with the same Idempotency-Key are replayed, never
+	// stored twice
+	idempotent := idempotency.New(idempotency.Config{
+		Store:      idempotency.NewPostgresStore(db),
+		TenantFunc: tenant.Code,
+	})
+
+	// Every route below needs a token; only authenticated requests are
+	// recorded against their Idempotency-Key
+	api.Use(tenants, middleware.AuthMiddleware, idempotent)
+
+	// Receipts and deposit slips of payments; downloads are by the signed
+	// URLs in the responses
+	receipts := api.Group("/fees/receipts")
+	receipts.Get("/", h.ListReceipts)
+	receipts.Get("/:id", h.GetReceipt)
+	receipts.Post("/", h.UploadReceipt)
+	receipts.Delete("/:id", h.DeleteReceipt)
+
+	// Due dates of a year's monthly fees, moved to working days
+	api.Get("/fees/due-dates", h.ListDueDates)
+
+	// Add service-specific routes here
 }
@@ -0,0 +1,82 @@
+package config
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	pkgconfig "school-erp/pkg/config"
+)
+
+// Config holds the gateway configuration
+type Config struct {
+	// App
+	Port        int    `env:"PORT" default:"8080"`
+	Environment string `env:"ENVIRONMENT" default:"development"`
+	AppName     string `env:"APP_NAME" default:"School ERP API Gateway"`
+
+	// Security
+	JWTSecret        string `env:"JWT_SECRET" required:"true" secret:"true"`
+	CORSAllowOrigins string `env:"CORS_ALLOW_ORIGINS" default:"http://localhost:3000"`
+
+	// Main database, used to resolve tenants
+	DBHost         string        `env:"DB_HOST" default:"postgres"`
+	DBPort         int           `env:"DB_PORT" default:"5432"`
+	DBName         string        `env:"DB_NAME" default:"school_erp"`
+	DBUser         string        `env:"DB_USER" default:"postgres"`
+	DBPassword     string        `env:"DB_PASSWORD" default:"postgres" secret:"true"`
+	TenantCacheTTL time.Duration `env:"TENANT_CACHE_TTL" default:"30s"`
+
+	// How long a school's modules are cached; the gateway does not receive
+	// SchoolFeaturesChanged events, so toggles take up to this long to apply
+	FeatureCacheTTL time.Duration `env:"FEATURE_CACHE_TTL" default:"30s"`
+
+	// How often the verified custom domains of schools are reloaded
+	TenantDomainRefresh time.Duration `env:"TENANT_DOMAIN_REFRESH" default:"1m"`
+
+	// Rate limits per user (or per IP for anonymous callers)
+	RateLimit       int           `env:"RATE_LIMIT" default:"300"`
+	RateLimitWindow time.Duration `env:"RATE_LIMIT_WINDOW" default:"1m"`
+	AuthRateLimit   int           `env:"AUTH_RATE_LIMIT" default:"20"`
+
+	// Upstream defaults; individual routes may override the timeout
+	UpstreamTimeout  time.Duration `env:"UPSTREAM_TIMEOUT" default:"10s"`
+	UpstreamRetries  int           `env:"UPSTREAM_RETRIES" default:"2"`
+	BreakerThreshold int           `env:"BREAKER_THRESHOLD" default:"5"`
+	BreakerCooldown  time.Duration `env:"BREAKER_COOLDOWN" default:"30s"`
+
+	// Services
+	AuthServiceURL         string `env:"AUTH_SERVICE_URL" default:"http://auth-service:3001"`
+	UserServiceURL         string `env:"USER_SERVICE_URL" default:"http://user-service:3002"`
+	StudentServiceURL      string `env:"STUDENT_SERVICE_URL" default:"http://student-service:3003"`
+	AttendanceServiceURL   string `env:"ATTENDANCE_SERVICE_URL" default:"http://attendance-service:3004"`
+	FeeServiceURL          string `env:"FEE_SERVICE_URL" default:"http://fee-service:3005"`
+	ExamServiceURL         string `env:"EXAM_SERVICE_URL" default:"http://exam-service:3006"`
+	NotificationServiceURL string `env:"NOTIFICATION_SERVICE_URL" default:"http://notification-service:3007"`
+	TransportServiceURL    string `env:"TRANSPORT_SERVICE_URL" default:"http://transport-service:3009"`
+	SchoolServiceURL       string `env:"SCHOOL_SERVICE_URL" default:"http://school-service:3011"`
+}
+
+// LoadConfig loads configuration from defaults, CONFIG_FILE, environment
+// variables and *_FILE secrets, and prints the redacted result
+func LoadConfig() (*Config, error) {
+	cfg := &Config{}
+	report, err := pkgconfig.Load(cfg)
+	if err != nil {
+		return nil, err
+	}
+	report.Print(log.Writer(), cfg.AppName)
+	return cfg, nil
+}
+
+// GetMainDSN returns the main database connection string
+func (c *Config) GetMainDSN() string {
+	return fmt.Sprintf(
+		"postgres://%s:%s@%s:%d/%s?sslmode=disable",
+		c.DBUser,
+		c.DBPassword,
+		c.DBHost,
+		c.DBPort,
+		c.DBName,
+	)
+}
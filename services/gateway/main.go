@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/cors"
+	"github.com/gofiber/fiber/v2/middleware/logger"
+	"github.com/gofiber/fiber/v2/middleware/recover"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"school-erp/gateway/config"
+	"school-erp/gateway/middleware"
+	"school-erp/gateway/routes"
+	"school-erp/pkg/features"
+	"school-erp/pkg/problem"
+	"school-erp/pkg/tenant"
+)
+
+func main() {
+	// Load configuration
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v\n", err)
+	}
+
+	// Main database, used to check that tenants exist and are active
+	mainDB, err := pgxpool.New(context.Background(), cfg.GetMainDSN())
+	if err != nil {
+		log.Fatalf("Failed to connect to main database: %v\n", err)
+	}
+	defer mainDB.Close()
+
+	directory := middleware.NewCachedDirectory(middleware.NewPostgresDirectory(mainDB), cfg.TenantCacheTTL)
+
+	// Requests for verified custom domains go to their school. The gateway
+	// does not receive SchoolUpdated events, so the domains are reloaded
+	// every TENANT_DOMAIN_REFRESH.
+	domains := tenant.NewDomainMap(mainDB)
+	if err := domains.Refresh(context.Background()); err != nil {
+		log.Printf("Failed to load tenant domains: %v\n", err)
+	}
+	refreshCtx, stopRefresh := context.WithCancel(context.Background())
+	defer stopRefresh()
+	go domains.Run(refreshCtx, cfg.TenantDomainRefresh)
+
+	// Routes of modules a school has turned off are refused with 403
+	modules := features.NewClient(mainDB, cfg.FeatureCacheTTL)
+
+	// Create Fiber app
+	app := fiber.New(fiber.Config{
+		AppName:      cfg.AppName,
+		ErrorHandler: problem.ErrorHandler,
+		// Bodies are forwarded as-is; uploads are bounded by the services
+		BodyLimit: 20 * 1024 * 1024,
+	})
+
+	// Setup middleware
+	setupMiddleware(app, cfg)
+
+	// Proxy routes, then welcome, health, API document and 404 handler
+	proxies := routes.SetupRoutes(app, cfg, routes.Table(cfg), directory, domains, modules)
+	routes.SetupSystemRoutes(app, proxies)
+
+	// Start server with graceful shutdown
+	port := fmt.Sprintf(":%d", cfg.Port)
+	log.Printf("Starting API Gateway on port %d...\n", cfg.Port)
+
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		if err := app.Listen(port); err != nil {
+			log.Fatalf("Failed to start server: %v\n", err)
+		}
+	}()
+
+	<-c
+	log.Println("Gracefully shutting down...")
+	_ = app.Shutdown()
+	log.Println("Server stopped")
+}
+
+// setupMiddleware configures all application middleware
+func setupMiddleware(app *fiber.App, cfg *config.Config) {
+	// Request ID, forwarded to the services as X-Request-ID
+	app.Use(requestid.New())
+
+	// Logger middleware
+	app.Use(logger.New(logger.Config{
+		Format: "${time} - ${locals:requestid} - ${method} ${path} - ${status} - ${latency}\n",
+	}))
+
+	// Recover middleware - catches panics and returns 500
+	app.Use(recover.New())
+
+	// CORS is answered here so preflight requests never reach the services
+	app.Use(cors.New(cors.Config{
+		AllowOrigins:     cfg.CORSAllowOrigins,
+		AllowMethods:     "GET,POST,PUT,DELETE,PATCH,OPTIONS",
+		AllowHeaders:     "Content-Type,Authorization,X-Requested-With,X-Tenant-Code,Idempotency-Key",
+		ExposeHeaders:    "Content-Length,X-Total-Count,X-Request-ID,Idempotent-Replayed,Retry-After",
+		AllowCredentials: true,
+		MaxAge:           300,
+	}))
+
+	app.Use(func(c *fiber.Ctx) error {
+		c.Set("X-Service", "api-gateway")
+		c.Request().Header.Set(fiber.HeaderXRequestID, c.GetRespHeader(fiber.HeaderXRequestID))
+		return c.Next()
+	})
+}
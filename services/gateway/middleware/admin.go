@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"school-erp/pkg/problem"
+)
+
+// Roles of the auth service that administer schools
+const (
+	RoleSuperAdmin = "super_admin"
+	RoleAdmin      = "admin"
+)
+
+// schoolsPath is the prefix of the school administration API
+const schoolsPath = "/api/v1/schools"
+
+// Sub-resources of /api/v1/schools/:id that every user of the school may
+// read, and those its admins may also change
+var (
+	schoolReadable = map[string]bool{"settings": true, "academic-years": true, "calendar": true, "features": true}
+	schoolWritable = map[string]bool{"settings": true, "academic-years": true, "calendar": true, "domain": true}
+)
+
+// Administer guards the school administration routes. Super admins may call
+// all of them. Other callers only reach the /api/v1/schools/:id routes of
+// the school their token names: any user may read its settings, academic
+// years, calendar and features, and its admins may also change its
+// settings, academic years, calendar and domain and read the school, its
+// stats and its usage. Outside /api/v1/schools, such as plans and feature
+// flags, everyone may read and only super admins may write.
+func Administer(dir Directory) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		claims := GetClaims(c)
+		if claims == nil {
+			return problem.Unauthorized(problem.CodeUnauthorized, "Missing authorization header")
+		}
+		if claims.Role == RoleSuperAdmin {
+			return c.Next()
+		}
+		read := c.Method() == fiber.MethodGet || c.Method() == fiber.MethodHead
+
+		// Routing ignores case, so /API/V1/Schools reaches the same routes
+		path := strings.ToLower(c.Path())
+		rest, ok := strings.CutPrefix(path, schoolsPath+"/")
+		if !ok {
+			if read && path != schoolsPath {
+				return c.Next()
+			}
+			return superAdminOnly()
+		}
+
+		// /api/v1/schools/:id/<sub>/...; stats are looked up by code
+		segments := strings.Split(strings.Trim(rest, "/"), "/")
+		school, sub := segments[0], ""
+		if len(segments) > 1 {
+			sub = segments[1]
+		}
+		admin := claims.Role == RoleAdmin
+		switch {
+		case read && schoolReadable[sub]:
+		case admin && read && (sub == "" || sub == "usage" || sub == "stats"):
+		case admin && !read && schoolWritable[sub]:
+		default:
+			return superAdminOnly()
+		}
+
+		code := school
+		if sub != "stats" {
+			var err error
+			code, err = dir.SchoolCode(c.Context(), school)
+			if errors.Is(err, ErrSchoolNotFound) {
+				return problem.Forbidden(problem.CodeForbidden, "Token is not valid for this school")
+			}
+			if err != nil {
+				return problem.New(fiber.StatusServiceUnavailable, problem.CodeUnavailable,
+					"Failed to resolve school").Wrap(err)
+			}
+		}
+		if claims.TenantCode == "" || !strings.EqualFold(code, claims.TenantCode) {
+			return problem.Forbidden(problem.CodeForbidden, "Token is not valid for this school")
+		}
+		return c.Next()
+	}
+}
+
+func superAdminOnly() error {
+	return problem.Forbidden(problem.CodeForbidden, "Only super admins may do this")
+}
@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/limiter"
+
+	"school-erp/pkg/problem"
+)
+
+// RateLimit allows max requests per window for each caller: the user of a
+// verified token, otherwise the client IP. It must run after Authenticate.
+// Responses carry X-RateLimit-* headers and Retry-After when limited.
+func RateLimit(max int, window time.Duration) fiber.Handler {
+	return limiter.New(limiter.Config{
+		Max:        max,
+		Expiration: window,
+		KeyGenerator: func(c *fiber.Ctx) string {
+			if claims := GetClaims(c); claims != nil {
+				return "user:" + strconv.FormatInt(claims.UserID, 10)
+			}
+			return "ip:" + c.IP()
+		},
+		LimitReached: func(c *fiber.Ctx) error {
+			return problem.New(fiber.StatusTooManyRequests, problem.CodeRateLimited, "Too many requests. Please try again later.")
+		},
+	})
+}
@@ -0,0 +1,169 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"school-erp/pkg/problem"
+	"school-erp/pkg/tenant"
+)
+
+// HeaderTenantCode carries the resolved school code to the services.
+const HeaderTenantCode = tenant.HeaderCode
+
+// TenantCodeContextKey stores the resolved tenant code in Locals.
+const TenantCodeContextKey = "tenant_code"
+
+// ErrSchoolNotFound is returned by a Directory for unknown or inactive schools.
+var ErrSchoolNotFound = errors.New("school not found or inactive")
+
+// Directory looks up the status of the school with a code, tenant.StatusActive
+// or tenant.StatusSuspended, and the code of a school by its ID.
+type Directory interface {
+	Status(ctx context.Context, code string) (string, error)
+	SchoolCode(ctx context.Context, id string) (string, error)
+}
+
+// PostgresDirectory reads the schools table of the main database.
+type PostgresDirectory struct {
+	db *pgxpool.Pool
+}
+
+func NewPostgresDirectory(db *pgxpool.Pool) *PostgresDirectory {
+	return &PostgresDirectory{db: db}
+}
+
+// Status returns the status of the school with code, if it is active or
+// suspended; other schools are not found.
+func (d *PostgresDirectory) Status(ctx context.Context, code string) (string, error) {
+	var status string
+	err := d.db.QueryRow(ctx,
+		`SELECT status FROM schools WHERE code = $1 AND status IN ($2, $3)`, code, tenant.StatusActive, tenant.StatusSuspended,
+	).Scan(&status)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", ErrSchoolNotFound
+	}
+	return status, err
+}
+
+// SchoolCode returns the code of the school with id, whatever its status.
+func (d *PostgresDirectory) SchoolCode(ctx context.Context, id string) (string, error) {
+	var code string
+	err := d.db.QueryRow(ctx, `SELECT code FROM schools WHERE id::text = $1`, id).Scan(&code)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", ErrSchoolNotFound
+	}
+	return code, err
+}
+
+// CachedDirectory remembers lookups for ttl so the main database is not hit
+// on every request. Lookup errors other than ErrSchoolNotFound are not cached.
+type CachedDirectory struct {
+	next    Directory
+	ttl     time.Duration
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+	codes   map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	code    string // or status, of entries
+	err     error
+	expires time.Time
+}
+
+func NewCachedDirectory(next Directory, ttl time.Duration) *CachedDirectory {
+	return &CachedDirectory{next: next, ttl: ttl, entries: make(map[string]cacheEntry), codes: make(map[string]cacheEntry)}
+}
+
+func (d *CachedDirectory) Status(ctx context.Context, code string) (string, error) {
+	now := time.Now()
+	d.mu.Lock()
+	if e, ok := d.entries[code]; ok && now.Before(e.expires) {
+		d.mu.Unlock()
+		return e.code, e.err
+	}
+	d.mu.Unlock()
+
+	status, err := d.next.Status(ctx, code)
+	if err == nil || errors.Is(err, ErrSchoolNotFound) {
+		d.mu.Lock()
+		d.entries[code] = cacheEntry{code: status, err: err, expires: now.Add(d.ttl)}
+		d.mu.Unlock()
+	}
+	return status, err
+}
+
+func (d *CachedDirectory) SchoolCode(ctx context.Context, id string) (string, error) {
+	now := time.Now()
+	d.mu.Lock()
+	if e, ok := d.codes[id]; ok && now.Before(e.expires) {
+		d.mu.Unlock()
+		return e.code, e.err
+	}
+	d.mu.Unlock()
+
+	code, err := d.next.SchoolCode(ctx, id)
+	if err == nil || errors.Is(err, ErrSchoolNotFound) {
+		d.mu.Lock()
+		d.codes[id] = cacheEntry{code: code, err: err, expires: now.Add(d.ttl)}
+		d.mu.Unlock()
+	}
+	return code, err
+}
+
+// TenantResolver resolves the school the same way the services do (see
+// tenant.New), checks that it is active, or suspended and the request only
+// reads, and forwards it as X-Tenant-Code. The caller's token must name the
+// school: tokens without a tenant_code claim are valid for no school's
+// data. domains may be nil.
+func TenantResolver(dir Directory, domains *tenant.DomainMap) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		tenantCode, err := tenant.RequestCode(c, domains)
+		if err != nil {
+			return err
+		}
+		claims := GetClaims(c)
+		if claims == nil {
+			return problem.Unauthorized(problem.CodeUnauthorized, "Missing authorization header")
+		}
+		if claims.TenantCode == "" {
+			return problem.Forbidden(problem.CodeForbidden, "Token is not valid for any school")
+		}
+		if tenantCode != "" && !strings.EqualFold(tenantCode, claims.TenantCode) {
+			return problem.Forbidden(problem.CodeForbidden,
+				fmt.Sprintf("Token is not valid for school %q", tenantCode))
+		}
+		tenantCode = claims.TenantCode
+
+		status, err := dir.Status(c.Context(), tenantCode)
+		if err != nil {
+			if errors.Is(err, ErrSchoolNotFound) {
+				return problem.NotFound(fmt.Sprintf("School %q not found or inactive", tenantCode))
+			}
+			return problem.New(fiber.StatusServiceUnavailable, problem.CodeUnavailable,
+				"Failed to resolve tenant").Wrap(err)
+		}
+		if status == tenant.StatusSuspended && !readOnly(c.Method()) {
+			return problem.Forbidden(problem.CodeSchoolSuspended,
+				fmt.Sprintf("School %q is suspended and read-only", tenantCode))
+		}
+
+		c.Locals(TenantCodeContextKey, tenantCode)
+		c.Request().Header.Set(HeaderTenantCode, tenantCode)
+		return c.Next()
+	}
+}
+
+// readOnly reports whether requests of method may reach suspended schools
+func readOnly(method string) bool {
+	return method == fiber.MethodGet || method == fiber.MethodHead || method == fiber.MethodOptions
+}
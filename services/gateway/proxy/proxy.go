@@ -0,0 +1,186 @@
+// Package proxy forwards gateway requests to the domain services with
+// per-route timeouts, retries and circuit breaking.
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+
+	"school-erp/pkg/idempotency"
+	"school-erp/pkg/problem"
+)
+
+// Route maps a path prefix to an upstream service.
+type Route struct {
+	Name     string        // service name used in errors and logs
+	Prefix   string        // request path prefix, e.g. /api/v1/students
+	Upstream string        // base URL, e.g. http://student-service:3003
+	Public   []string      // path prefixes served without a token
+	Strict   bool          // public paths take credentials; rate limit them strictly
+	Tenant   bool          // requests must resolve to an active school
+	Admin    bool          // school administration; callers need an admin role
+	Module   string        // module the school must have on, e.g. transport
+	Timeout  time.Duration // per attempt
+	Retries  int           // extra attempts for idempotent requests
+}
+
+// IsPublic reports whether path may be called without a token.
+func (r *Route) IsPublic(path string) bool {
+	for _, p := range r.Public {
+		if path == p || strings.HasPrefix(path, p+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// hopHeaders are connection-scoped and never forwarded.
+var hopHeaders = []string{
+	fiber.HeaderConnection, "Keep-Alive", fiber.HeaderProxyAuthenticate, fiber.HeaderProxyAuthorization,
+	fiber.HeaderTE, fiber.HeaderTrailer, fiber.HeaderTransferEncoding, fiber.HeaderUpgrade,
+}
+
+// retryBackoff is the delay before the first retry; it doubles each attempt.
+var retryBackoff = 100 * time.Millisecond
+
+// Proxy forwards requests for one route.
+type Proxy struct {
+	route   Route
+	client  *fasthttp.Client
+	breaker *Breaker
+}
+
+// New creates a proxy for route sharing client with other routes.
+func New(route Route, client *fasthttp.Client, breaker *Breaker) *Proxy {
+	route.Upstream = strings.TrimSuffix(route.Upstream, "/")
+	return &Proxy{route: route, client: client, breaker: breaker}
+}
+
+// Route returns the proxied route.
+func (p *Proxy) Route() Route {
+	return p.route
+}
+
+// Breaker returns the route's circuit breaker.
+func (p *Proxy) Breaker() *Breaker {
+	return p.breaker
+}
+
+// Handler forwards the request upstream and copies the response back.
+func (p *Proxy) Handler() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !p.breaker.Allow() {
+			return problem.New(fiber.StatusServiceUnavailable, problem.CodeUnavailable,
+				fmt.Sprintf("The %s service is temporarily unavailable", p.route.Name))
+		}
+
+		req := fasthttp.AcquireRequest()
+		defer fasthttp.ReleaseRequest(req)
+		c.Request().CopyTo(req)
+		req.SetRequestURI(p.route.Upstream + string(c.Request().URI().RequestURI()))
+		req.Header.SetHost(string(req.URI().Host()))
+		for _, h := range hopHeaders {
+			req.Header.Del(h)
+		}
+		req.Header.Set(fiber.HeaderXForwardedFor, c.IP())
+		req.Header.Set(fiber.HeaderXForwardedHost, c.Hostname())
+		req.Header.Set(fiber.HeaderXForwardedProto, c.Protocol())
+
+		resp := fasthttp.AcquireResponse()
+		defer fasthttp.ReleaseResponse(resp)
+
+		attempts := 1
+		if retryable(c) {
+			attempts += p.route.Retries
+		}
+
+		var err error
+		for attempt := 0; attempt < attempts; attempt++ {
+			if attempt > 0 {
+				time.Sleep(retryBackoff << (attempt - 1))
+			}
+			resp.Reset()
+			err = p.client.DoTimeout(req, resp, p.route.Timeout)
+			if err == nil && resp.StatusCode() < fiber.StatusInternalServerError {
+				p.breaker.Success()
+				break
+			}
+			p.breaker.Failure()
+			if err == nil && !retryStatus(resp.StatusCode()) {
+				break
+			}
+			if attempt+1 < attempts {
+				log.Printf("gateway: retrying %s %s on %s (attempt %d): %v", c.Method(), c.Path(), p.route.Name, attempt+2, upstreamError(err, resp))
+			}
+		}
+
+		if err != nil {
+			if errors.Is(err, fasthttp.ErrTimeout) {
+				return problem.New(fiber.StatusGatewayTimeout, problem.CodeTimeout,
+					fmt.Sprintf("The %s service did not respond in time", p.route.Name)).Wrap(err)
+			}
+			return problem.New(fiber.StatusBadGateway, problem.CodeUpstream,
+				fmt.Sprintf("The %s service is unreachable", p.route.Name)).Wrap(err)
+		}
+
+		copyResponse(c, resp)
+		return nil
+	}
+}
+
+// copyResponse writes the upstream response to c, keeping headers the gateway
+// already set. CORS is answered by the gateway, so the upstream's
+// Access-Control-* headers are dropped rather than duplicated.
+func copyResponse(c *fiber.Ctx, resp *fasthttp.Response) {
+	c.Status(resp.StatusCode())
+	seen := map[string]bool{}
+	resp.Header.VisitAll(func(k, v []byte) {
+		key := string(k)
+		if isHopHeader(key) || strings.HasPrefix(strings.ToLower(key), "access-control-") {
+			return
+		}
+		if seen[key] || strings.EqualFold(key, fiber.HeaderSetCookie) {
+			c.Response().Header.Add(key, string(v))
+		} else {
+			c.Response().Header.Set(key, string(v))
+		}
+		seen[key] = true
+	})
+	c.Response().SetBody(resp.Body())
+}
+
+func isHopHeader(key string) bool {
+	for _, h := range hopHeaders {
+		if strings.EqualFold(key, h) {
+			return true
+		}
+	}
+	return false
+}
+
+// retryable reports whether repeating the request is safe: the method is
+// idempotent, or the client supplied an Idempotency-Key the service honours.
+func retryable(c *fiber.Ctx) bool {
+	switch c.Method() {
+	case fiber.MethodGet, fiber.MethodHead, fiber.MethodOptions, fiber.MethodPut, fiber.MethodDelete:
+		return true
+	}
+	return c.Get(idempotency.HeaderKey) != ""
+}
+
+func retryStatus(status int) bool {
+	return status == fiber.StatusBadGateway || status == fiber.StatusServiceUnavailable || status == fiber.StatusGatewayTimeout
+}
+
+func upstreamError(err error, resp *fasthttp.Response) error {
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("status %d", resp.StatusCode())
+}
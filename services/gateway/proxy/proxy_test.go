@@ -0,0 +1,163 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+
+	"school-erp/pkg/problem"
+)
+
+func init() {
+	retryBackoff = time.Millisecond
+}
+
+// newProxyApp proxies /api/v1/things to an upstream answering with handler.
+func newProxyApp(t *testing.T, breaker *Breaker, handler http.HandlerFunc) (*fiber.App, *int32) {
+	var calls int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		handler(w, r)
+	}))
+	t.Cleanup(upstream.Close)
+
+	p := New(Route{
+		Name:     "things",
+		Prefix:   "/api/v1/things",
+		Upstream: upstream.URL + "/",
+		Timeout:  200 * time.Millisecond,
+		Retries:  2,
+	}, &fasthttp.Client{}, breaker)
+
+	app := fiber.New(fiber.Config{ErrorHandler: problem.ErrorHandler})
+	app.Use("/api/v1/things", p.Handler())
+	return app, &calls
+}
+
+func do(t *testing.T, app *fiber.App, req *http.Request) (*http.Response, string) {
+	t.Helper()
+	resp, err := app.Test(req, 5000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	return resp, string(body)
+}
+
+func TestForwardsPathQueryAndHeaders(t *testing.T) {
+	app, _ := newProxyApp(t, NewBreaker(5, time.Minute), func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Connection") == "keep-alive-custom" || r.Header.Get("X-Forwarded-For") == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Add("Set-Cookie", "a=1")
+		w.Header().Add("Set-Cookie", "b=2")
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, r.Method+" "+r.URL.RequestURI())
+	})
+
+	req := httptest.NewRequest("POST", "/api/v1/things/7?x=1", strings.NewReader(`{}`))
+	req.Header.Set("Connection", "keep-alive-custom")
+	resp, body := do(t, app, req)
+	if resp.StatusCode != http.StatusCreated || body != "POST /api/v1/things/7?x=1" {
+		t.Fatalf("got %d %q", resp.StatusCode, body)
+	}
+	if got := resp.Header.Values("Set-Cookie"); len(got) != 2 {
+		t.Errorf("Set-Cookie = %v, want both cookies", got)
+	}
+	if got := resp.Header.Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("upstream CORS header forwarded: %q", got)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	unavailable := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	cases := []struct {
+		name   string
+		method string
+		key    string
+		calls  int32
+	}{
+		{"idempotent method", "GET", "", 3},
+		{"unsafe method", "POST", "", 1},
+		{"unsafe method with key", "POST", "k-1", 3},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			app, calls := newProxyApp(t, NewBreaker(0, 0), unavailable)
+			req := httptest.NewRequest(tc.method, "/api/v1/things", nil)
+			if tc.key != "" {
+				req.Header.Set("Idempotency-Key", tc.key)
+			}
+			resp, _ := do(t, app, req)
+			if resp.StatusCode != http.StatusServiceUnavailable {
+				t.Errorf("status = %d, want upstream 503", resp.StatusCode)
+			}
+			if got := atomic.LoadInt32(calls); got != tc.calls {
+				t.Errorf("upstream calls = %d, want %d", got, tc.calls)
+			}
+		})
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	app, _ := newProxyApp(t, NewBreaker(0, 0), func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Second)
+	})
+	resp, body := do(t, app, httptest.NewRequest("POST", "/api/v1/things", nil))
+	if resp.StatusCode != http.StatusGatewayTimeout || !strings.Contains(body, problem.CodeTimeout) {
+		t.Fatalf("got %d %s", resp.StatusCode, body)
+	}
+}
+
+func TestBreakerOpens(t *testing.T) {
+	breaker := NewBreaker(2, time.Minute)
+	app, calls := newProxyApp(t, breaker, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	for i := 0; i < 2; i++ {
+		do(t, app, httptest.NewRequest("GET", "/api/v1/things", nil))
+	}
+	if breaker.State() != Open {
+		t.Fatalf("state = %s, want open", breaker.State())
+	}
+
+	resp, body := do(t, app, httptest.NewRequest("GET", "/api/v1/things", nil))
+	if resp.StatusCode != http.StatusServiceUnavailable || !strings.Contains(body, problem.CodeUnavailable) {
+		t.Fatalf("got %d %s", resp.StatusCode, body)
+	}
+	if got := atomic.LoadInt32(calls); got != 2 {
+		t.Errorf("upstream calls = %d, want 2", got)
+	}
+}
+
+func TestBreakerHalfOpen(t *testing.T) {
+	now := time.Now()
+	b := NewBreaker(1, time.Minute)
+	b.now = func() time.Time { return now }
+
+	b.Failure()
+	if b.Allow() {
+		t.Fatal("open breaker allowed a request")
+	}
+	now = now.Add(time.Minute)
+	if !b.Allow() || b.Allow() {
+		t.Fatal("half-open breaker must allow exactly one trial")
+	}
+	b.Success()
+	if b.State() != Closed || !b.Allow() {
+		t.Fatalf("state = %s after a successful trial", b.State())
+	}
+}
@@ -0,0 +1,20 @@
+package routes
+
+import (
+	"school-erp/pkg/openapi"
+)
+
+// APIInfo describes the gateway in its OpenAPI document. Proxied APIs are
+// documented by each service's own /openapi.json.
+var APIInfo = openapi.Info{
+	Title:       "School ERP - API Gateway",
+	Version:     "1.0.0",
+	Description: "Single entry point that verifies tokens, resolves tenants and proxies to the domain services.",
+}
+
+// Operations documents the routes mounted by SetupSystemRoutes.
+var Operations = []openapi.Operation{
+	{Method: "GET", Path: "/", Summary: "Service information", Responses: openapi.Responses{200: openapi.Any}},
+	{Method: "GET", Path: "/health", Summary: "Health check", Responses: openapi.Responses{200: HealthResponse{}}},
+	{Method: "GET", Path: "/openapi.json", Summary: "OpenAPI document", Responses: openapi.Responses{200: openapi.Any}},
+}
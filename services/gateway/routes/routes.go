@@ -0,0 +1,133 @@
+package routes
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+
+	"school-erp/gateway/config"
+	"school-erp/gateway/middleware"
+	"school-erp/gateway/proxy"
+	"school-erp/pkg/features"
+	"school-erp/pkg/storage"
+	"school-erp/pkg/tenant"
+)
+
+// Table returns the gateway's routes. Prefixes are matched on whole path
+// segments; the realtime service's websocket endpoint is not proxied.
+func Table(cfg *config.Config) []proxy.Route {
+	route := func(name, prefix, upstream string, tenant bool) proxy.Route {
+		return proxy.Route{
+			Name:     name,
+			Prefix:   prefix,
+			Upstream: upstream,
+			Tenant:   tenant,
+			Timeout:  cfg.UpstreamTimeout,
+			Retries:  cfg.UpstreamRetries,
+		}
+	}
+
+	// Routes of modules a school can turn off
+	module := func(r proxy.Route, key string) proxy.Route {
+		r.Module = key
+		return r
+	}
+
+	auth := route("auth", "/api/v1/auth", cfg.AuthServiceURL, false)
+	auth.Public = []string{"/api/v1/auth/login", "/api/v1/auth/register", "/api/v1/auth/refresh"}
+	auth.Strict = true
+
+	// Downloads are authorized by their signed URL, and logos are public
+	files := route("school", storage.FilesPath, cfg.SchoolServiceURL, false)
+	files.Public = []string{storage.FilesPath}
+	uploads := route("school", "/uploads", cfg.SchoolServiceURL, false)
+	uploads.Public = []string{"/uploads"}
+
+	// School administration is for super admins, and a school's admins for
+	// their own school; the school service's other APIs are for everyone to
+	// read and super admins to change (see middleware.Administer)
+	admin := func(r proxy.Route) proxy.Route {
+		r.Admin = true
+		return r
+	}
+
+	return []proxy.Route{
+		auth,
+		route("auth", "/api/v1/admin", cfg.AuthServiceURL, false),
+		admin(route("school", "/api/v1/schools", cfg.SchoolServiceURL, false)),
+		admin(route("school", "/api/v1/settings", cfg.SchoolServiceURL, false)),
+		admin(route("school", "/api/v1/features", cfg.SchoolServiceURL, false)),
+		admin(route("school", "/api/v1/plans", cfg.SchoolServiceURL, false)),
+		files,
+		uploads,
+		route("user", "/api/v1/users", cfg.UserServiceURL, true),
+		route("user", "/api/v1/teachers", cfg.UserServiceURL, true),
+		route("user", "/api/v1/parents", cfg.UserServiceURL, true),
+		route("user", "/api/v1/staff", cfg.UserServiceURL, true),
+		route("student", "/api/v1/students", cfg.StudentServiceURL, true),
+		route("student", "/api/v1/enrollments", cfg.StudentServiceURL, true),
+		route("student", "/api/v1/classes", cfg.StudentServiceURL, true),
+		route("student", "/api/v1/sections", cfg.StudentServiceURL, true),
+		route("student", "/api/v1/subjects", cfg.StudentServiceURL, true),
+		route("student", "/api/v1/teacher-assignments", cfg.StudentServiceURL, true),
+		module(route("attendance", "/api/v1/attendance", cfg.AttendanceServiceURL, true), features.ModuleAttendance),
+		module(route("fee", "/api/v1/fees", cfg.FeeServiceURL, true), features.ModuleFees),
+		module(route("exam", "/api/v1/exams", cfg.ExamServiceURL, true), features.ModuleExams),
+		module(route("notification", "/api/v1/notifications", cfg.NotificationServiceURL, true), features.ModuleNotifications),
+		module(route("transport", "/api/v1/transport", cfg.TransportServiceURL, true), features.ModuleTransport),
+	}
+}
+
+// SetupRoutes mounts a proxy for every route behind token verification,
+// rate limiting, the role check of school administration routes and, for
+// tenant routes, tenant resolution and the check that the school has the
+// route's module. Routes to the same service share a circuit breaker. It returns the mounted proxies. domains, which may be
+// nil, maps custom domains to schools.
+func SetupRoutes(app *fiber.App, cfg *config.Config, table []proxy.Route, dir middleware.Directory, domains *tenant.DomainMap, modules features.Checker) []*proxy.Proxy {
+	client := &fasthttp.Client{
+		Name:                     "school-erp-gateway",
+		NoDefaultUserAgentHeader: true,
+		MaxConnsPerHost:          512,
+		ReadBufferSize:           16 * 1024,
+	}
+
+	general := middleware.RateLimit(cfg.RateLimit, cfg.RateLimitWindow)
+	strict := middleware.RateLimit(cfg.AuthRateLimit, cfg.RateLimitWindow)
+
+	breakers := map[string]*proxy.Breaker{}
+	proxies := make([]*proxy.Proxy, 0, len(table))
+
+	for _, route := range table {
+		route := route
+		breaker, ok := breakers[route.Name]
+		if !ok {
+			breaker = proxy.NewBreaker(cfg.BreakerThreshold, cfg.BreakerCooldown)
+			breakers[route.Name] = breaker
+		}
+		p := proxy.New(route, client, breaker)
+		proxies = append(proxies, p)
+
+		handlers := []interface{}{
+			route.Prefix,
+			middleware.Authenticate(cfg.JWTSecret, route.IsPublic),
+			func(c *fiber.Ctx) error {
+				if route.Strict && route.IsPublic(c.Path()) {
+					return strict(c)
+				}
+				return general(c)
+			},
+		}
+		if route.Admin {
+			handlers = append(handlers, middleware.Administer(dir))
+		}
+		if route.Tenant {
+			handlers = append(handlers, middleware.TenantResolver(dir, domains))
+			if route.Module != "" {
+				handlers = append(handlers, features.Require(modules, route.Module))
+			}
+		}
+		handlers = append(handlers, p.Handler())
+		app.Use(handlers...)
+	}
+
+	return proxies
+}
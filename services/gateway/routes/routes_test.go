@@ -0,0 +1,306 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+
+	"school-erp/gateway/config"
+	"school-erp/gateway/middleware"
+	"school-erp/pkg/features"
+	"school-erp/pkg/openapi"
+	"school-erp/pkg/problem"
+	"school-erp/pkg/tenant"
+)
+
+const testSecret = "gateway-test-secret"
+
+// fakeDirectory has the status of each school by code
+type fakeDirectory map[string]string
+
+func (d fakeDirectory) Status(_ context.Context, code string) (string, error) {
+	if d[code] == "" {
+		return "", middleware.ErrSchoolNotFound
+	}
+	return d[code], nil
+}
+
+// SchoolCode knows the schools of d by the IDs "id-" + code
+func (d fakeDirectory) SchoolCode(_ context.Context, id string) (string, error) {
+	code, ok := strings.CutPrefix(id, "id-")
+	if !ok || d[code] == "" {
+		return "", middleware.ErrSchoolNotFound
+	}
+	return code, nil
+}
+
+// fakeModules has every module on except those listed per school
+type fakeModules map[string][]string
+
+func (m fakeModules) Enabled(_ context.Context, code, key string) (bool, error) {
+	for _, off := range m[code] {
+		if off == key {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// newGatewayApp points every route at an upstream that echoes the identity
+// and tenant headers it receives.
+func newGatewayApp(t *testing.T) *fiber.App {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{
+			"path":   r.URL.Path,
+			"user":   r.Header.Get(middleware.HeaderUserID),
+			"role":   r.Header.Get(middleware.HeaderUserRole),
+			"school": r.Header.Get(middleware.HeaderSchoolID),
+			"tenant": r.Header.Get(middleware.HeaderTenantCode),
+		})
+	}))
+	t.Cleanup(upstream.Close)
+
+	cfg := &config.Config{
+		JWTSecret:        testSecret,
+		RateLimit:        100,
+		RateLimitWindow:  time.Minute,
+		AuthRateLimit:    2,
+		UpstreamTimeout:  time.Second,
+		BreakerThreshold: 5,
+		BreakerCooldown:  time.Minute,
+	}
+	table := Table(cfg)
+	for i := range table {
+		table[i].Upstream = upstream.URL
+	}
+
+	app := fiber.New(fiber.Config{ErrorHandler: problem.ErrorHandler})
+	proxies := SetupRoutes(app, cfg, table, fakeDirectory{"eis": tenant.StatusActive, "hms": tenant.StatusSuspended}, nil, fakeModules{"eis": {features.ModuleTransport}})
+	SetupSystemRoutes(app, proxies)
+	return app
+}
+
+func token(t *testing.T, secret string, expires time.Time) string {
+	return schoolToken(t, secret, expires, "teacher", "eis")
+}
+
+// schoolToken is a token of a user with role at the school with code
+func schoolToken(t *testing.T, secret string, expires time.Time, role, code string) string {
+	claims := middleware.Claims{
+		UserID: 42, Email: "a@eis.edu", Role: role, SchoolID: 7, TenantCode: code,
+		RegisteredClaims: jwt.RegisteredClaims{Issuer: middleware.Issuer, ExpiresAt: jwt.NewNumericDate(expires)},
+	}
+	s, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestGateway(t *testing.T) {
+	app := newGatewayApp(t)
+	valid := token(t, testSecret, time.Now().Add(time.Hour))
+	superAdmin := schoolToken(t, testSecret, time.Now().Add(time.Hour), middleware.RoleSuperAdmin, "")
+
+	cases := []struct {
+		name    string
+		method  string
+		path    string
+		headers map[string]string
+		status  int
+		want    map[string]string
+	}{
+		{name: "missing token", method: "GET", path: "/api/v1/students", status: 401},
+		{name: "expired token", method: "GET", path: "/api/v1/students",
+			headers: map[string]string{"Authorization": "Bearer " + token(t, testSecret, time.Now().Add(-time.Minute))}, status: 401},
+		{name: "wrong secret", method: "GET", path: "/api/v1/students",
+			headers: map[string]string{"Authorization": "Bearer " + token(t, "other", time.Now().Add(time.Hour))}, status: 401},
+		{name: "tenant from token", method: "GET", path: "/api/v1/students",
+			headers: map[string]string{"Authorization": "Bearer " + valid, "Host": "localhost:8080"},
+			status:  200, want: map[string]string{"tenant": "eis"}},
+		{name: "token for another tenant", method: "GET", path: "/api/v1/students",
+			headers: map[string]string{"Authorization": "Bearer " + valid, "X-Tenant-Code": "kmc"}, status: 403},
+		{name: "token for no tenant", method: "GET", path: "/api/v1/students",
+			headers: map[string]string{"Authorization": "Bearer " + schoolToken(t, testSecret, time.Now().Add(time.Hour), "teacher", ""), "X-Tenant-Code": "eis"}, status: 403},
+		{name: "unknown tenant", method: "GET", path: "/api/v1/students",
+			headers: map[string]string{"Authorization": "Bearer " + schoolToken(t, testSecret, time.Now().Add(time.Hour), "teacher", "nope"), "Host": "localhost:8080"}, status: 404},
+		{name: "identity forwarded and spoofing stripped", method: "GET", path: "/api/v1/students/3",
+			headers: map[string]string{"Authorization": "Bearer " + valid, "X-Tenant-Code": "eis", "X-User-ID": "1", "X-User-Role": "super_admin"},
+			status:  200, want: map[string]string{"path": "/api/v1/students/3", "user": "42", "role": "teacher", "school": "7", "tenant": "eis"}},
+		{name: "tenant from subdomain", method: "GET", path: "/api/v1/fees",
+			headers: map[string]string{"Authorization": "Bearer " + valid, "Host": "eis.school-erp.com"},
+			status:  200, want: map[string]string{"tenant": "eis"}},
+		{name: "public route", method: "POST", path: "/api/v1/auth/login",
+			headers: map[string]string{"X-User-ID": "1"}, status: 200, want: map[string]string{"user": ""}},
+		{name: "public route with stale token", method: "POST", path: "/api/v1/auth/refresh",
+			headers: map[string]string{"Authorization": "Bearer stale"}, status: 200},
+		{name: "disabled module", method: "GET", path: "/api/v1/transport/routes",
+			headers: map[string]string{"Authorization": "Bearer " + valid, "X-Tenant-Code": "eis"}, status: 403},
+		{name: "enabled module", method: "GET", path: "/api/v1/exams",
+			headers: map[string]string{"Authorization": "Bearer " + valid, "X-Tenant-Code": "eis"},
+			status:  200, want: map[string]string{"path": "/api/v1/exams"}},
+		{name: "schools need no tenant", method: "GET", path: "/api/v1/schools",
+			headers: map[string]string{"Authorization": "Bearer " + superAdmin}, status: 200, want: map[string]string{"tenant": ""}},
+		{name: "signed file link needs no token", method: "GET", path: "/api/v1/files/schools/7/documents/a.pdf?expires=1&signature=x",
+			status: 200, want: map[string]string{"path": "/api/v1/files/schools/7/documents/a.pdf", "user": "", "tenant": ""}},
+		{name: "unknown route", method: "GET", path: "/api/v1/unknown", status: 404},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.path, nil)
+			for k, v := range tc.headers {
+				if k == "Host" {
+					req.Host = v
+				}
+				req.Header.Set(k, v)
+			}
+			resp, err := app.Test(req, 5000)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode != tc.status {
+				t.Fatalf("status = %d, want %d: %s", resp.StatusCode, tc.status, body)
+			}
+			if tc.want == nil {
+				return
+			}
+			var got map[string]string
+			if err := json.Unmarshal(body, &got); err != nil {
+				t.Fatal(err)
+			}
+			for k, v := range tc.want {
+				if got[k] != v {
+					t.Errorf("upstream saw %s = %q, want %q", k, got[k], v)
+				}
+			}
+		})
+	}
+}
+
+// TestSuspendedSchool lets users of a suspended school read, but not write,
+// as the services do
+func TestSuspendedSchool(t *testing.T) {
+	app := newGatewayApp(t)
+	suspended := schoolToken(t, testSecret, time.Now().Add(time.Hour), "teacher", "hms")
+
+	for method, status := range map[string]int{"GET": 200, "HEAD": 200, "POST": 403, "PUT": 403, "PATCH": 403, "DELETE": 403} {
+		req := httptest.NewRequest(method, "/api/v1/students", nil)
+		req.Host = "localhost:8080"
+		req.Header.Set("Authorization", "Bearer "+suspended)
+		resp, err := app.Test(req, 5000)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != status {
+			t.Fatalf("%s: status = %d, want %d", method, resp.StatusCode, status)
+		}
+		if status != 403 {
+			continue
+		}
+		var p problem.Problem
+		if err := json.NewDecoder(resp.Body).Decode(&p); err != nil || p.Code != problem.CodeSchoolSuspended {
+			t.Errorf("%s: problem = %+v, %v, want %s", method, p, err, problem.CodeSchoolSuspended)
+		}
+	}
+}
+
+func TestSchoolAdministration(t *testing.T) {
+	app := newGatewayApp(t)
+	expires := time.Now().Add(time.Hour)
+	superAdmin := schoolToken(t, testSecret, expires, middleware.RoleSuperAdmin, "")
+	admin := schoolToken(t, testSecret, expires, middleware.RoleAdmin, "eis")
+	teacher := schoolToken(t, testSecret, expires, "teacher", "eis")
+	otherAdmin := schoolToken(t, testSecret, expires, middleware.RoleAdmin, "kmc")
+
+	cases := []struct {
+		name   string
+		token  string
+		method string
+		path   string
+		status int
+	}{
+		{"super admin lists schools", superAdmin, "GET", "/api/v1/schools", 200},
+		{"super admin purges", superAdmin, "POST", "/api/v1/schools/id-kmc/purge", 200},
+		{"admin cannot list schools", admin, "GET", "/api/v1/schools", 403},
+		{"admin cannot create schools", admin, "POST", "/api/v1/schools", 403},
+		{"admin cannot delete own school", admin, "DELETE", "/api/v1/schools/id-eis", 403},
+		{"admin cannot purge", admin, "POST", "/api/v1/schools/id-eis/purge", 403},
+		{"admin cannot rotate credentials", admin, "POST", "/api/v1/schools/id-eis/rotate-credentials", 403},
+		{"admin cannot change plan", admin, "PUT", "/api/v1/schools/id-eis/plan", 403},
+		{"admin cannot toggle features", admin, "PUT", "/api/v1/schools/id-eis/features/transport", 403},
+		{"admin reads own school", admin, "GET", "/api/v1/schools/id-eis", 200},
+		{"admin reads own usage", admin, "GET", "/api/v1/schools/id-eis/usage", 200},
+		{"admin reads own stats", admin, "GET", "/api/v1/schools/eis/stats", 200},
+		{"admin changes own settings", admin, "PUT", "/api/v1/schools/id-eis/settings/fee", 200},
+		{"admin adds own holidays", admin, "POST", "/api/v1/schools/id-eis/calendar/events", 200},
+		{"admin changes another school's settings", otherAdmin, "PUT", "/api/v1/schools/id-eis/settings/fee", 403},
+		{"admin reads another school's calendar", otherAdmin, "GET", "/api/v1/schools/id-eis/calendar/events", 403},
+		{"admin of unknown school", admin, "PUT", "/api/v1/schools/id-nope/settings/fee", 403},
+		{"teacher reads own settings", teacher, "GET", "/api/v1/schools/id-eis/settings/fee", 200},
+		{"teacher reads own features", teacher, "GET", "/api/v1/schools/id-eis/features", 200},
+		{"teacher cannot change settings", teacher, "PUT", "/api/v1/schools/id-eis/settings/fee", 403},
+		{"teacher cannot read usage", teacher, "GET", "/api/v1/schools/id-eis/usage", 403},
+		{"teacher cannot list schools in mixed case", teacher, "GET", "/api/v1/Schools", 403},
+		{"teacher cannot list schools with a trailing slash", teacher, "GET", "/api/v1/schools/", 403},
+		{"teacher cannot read another school in upper case", teacher, "GET", "/API/V1/SCHOOLS/ID-KMC", 403},
+		{"admin cannot purge in mixed case", admin, "POST", "/api/v1/Schools/id-eis/Purge", 403},
+		{"admin cannot change flags in mixed case", admin, "PUT", "/api/v1/Features/Flags/beta", 403},
+		{"teacher reads settings schemas", teacher, "GET", "/api/v1/settings/schemas/grading", 200},
+		{"admin cannot write settings schemas", admin, "PUT", "/api/v1/settings/schemas/grading", 403},
+		{"teacher reads modules", teacher, "GET", "/api/v1/features/modules", 200},
+		{"teacher reads flags", teacher, "GET", "/api/v1/features/flags", 200},
+		{"admin cannot define flags", admin, "PUT", "/api/v1/features/flags/beta", 403},
+		{"admin cannot remove flags", admin, "DELETE", "/api/v1/features/flags/beta", 403},
+		{"super admin defines flags", superAdmin, "PUT", "/api/v1/features/flags/beta", 200},
+		{"super admin removes flags", superAdmin, "DELETE", "/api/v1/features/flags/beta", 200},
+		{"teacher reads plans", teacher, "GET", "/api/v1/plans", 200},
+		{"admin cannot change plans", admin, "PUT", "/api/v1/plans/basic", 403},
+		{"super admin changes plans", superAdmin, "PUT", "/api/v1/plans/basic", 200},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.path, nil)
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+			resp, err := app.Test(req, 5000)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tc.status {
+				body, _ := io.ReadAll(resp.Body)
+				t.Fatalf("status = %d, want %d: %s", resp.StatusCode, tc.status, body)
+			}
+		})
+	}
+}
+
+func TestAuthRateLimit(t *testing.T) {
+	app := newGatewayApp(t)
+	var last int
+	for i := 0; i < 3; i++ {
+		resp, err := app.Test(httptest.NewRequest("POST", "/api/v1/auth/login", nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		last = resp.StatusCode
+	}
+	if last != http.StatusTooManyRequests {
+		t.Fatalf("third login: status = %d, want 429", last)
+	}
+}
+
+func TestOperationsCoverEveryRoute(t *testing.T) {
+	doc := openapi.Build(newGatewayApp(t), APIInfo, Operations)
+	for _, d := range doc.Drift {
+		t.Error(d)
+	}
+}
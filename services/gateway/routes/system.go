@@ -0,0 +1,55 @@
+package routes
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"school-erp/gateway/proxy"
+	"school-erp/pkg/openapi"
+	"school-erp/pkg/problem"
+)
+
+// HealthResponse reports the gateway's health and the circuit breaker state
+// of each upstream service.
+type HealthResponse struct {
+	Status    string            `json:"status" validate:"required"`
+	Service   string            `json:"service" validate:"required"`
+	Upstreams map[string]string `json:"upstreams" validate:"required" doc:"Breaker state per service: closed, open or half-open"`
+}
+
+// SetupSystemRoutes mounts the welcome route, health check, API document and
+// the 404 handler. Call it after SetupRoutes.
+func SetupSystemRoutes(app *fiber.App, proxies []*proxy.Proxy) {
+	// Welcome route
+	app.Get("/", func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{
+			"service": "School ERP API Gateway",
+			"version": "v1.0.0",
+			"status":  "running",
+			"endpoints": fiber.Map{
+				"health":  "/health",
+				"openapi": "/openapi.json",
+				"api":     "/api/v1",
+			},
+		})
+	})
+
+	// Health check endpoint; degraded while any upstream breaker is open
+	app.Get("/health", func(c *fiber.Ctx) error {
+		resp := HealthResponse{Status: "healthy", Service: "api-gateway", Upstreams: map[string]string{}}
+		for _, p := range proxies {
+			state := p.Breaker().State()
+			resp.Upstreams[p.Route().Name] = state.String()
+			if state == proxy.Open {
+				resp.Status = "degraded"
+			}
+		}
+		return c.JSON(resp)
+	})
+
+	app.Get("/openapi.json", openapi.Handler(app, APIInfo, Operations))
+
+	// 404 handler
+	app.All("*", func(c *fiber.Ctx) error {
+		return problem.NotFound("Route not found")
+	})
+}
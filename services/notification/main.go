@@ -13,6 +13,7 @@ import (
 	"school-erp/notification/database"
 	"school-erp/notification/messaging"
 	"school-erp/notification/routes"
+	"school-erp/pkg/problem"
 )
 
 // Helper function to check if an origin is in the allowed list
@@ -27,7 +28,10 @@ func contains(allowedOrigins string, origin string) bool {
 }
 func main() {
 	godotenv.Load()
-	cfg := config.LoadConfig()
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
 
 	db, err := database.InitDB(cfg)
 	if err != nil {
@@ -42,30 +46,16 @@ func main() {
 	messaging.ConnectNATS()
 	defer messaging.NatsConnection.Close()
 
-	app := fiber.New(fiber.Config{AppName: "School ERP Notification Service"})
-	setupMiddleware(app)
-
-	app.Get("/", func(c *fiber.Ctx) error {
-		return c.JSON(fiber.Map{
-			"service": "School ERP Notification Service",
-			"version": "v1.0.0",
-			"status": "running",
-			"endpoints": fiber.Map{
-				"health": "/health",
-				"metrics": "/metrics",
-				"notifications": "/api/v1/notifications",
-			},
-		})
+	app := fiber.New(fiber.Config{
+		AppName:      "School ERP Notification Service",
+		ErrorHandler: problem.ErrorHandler,
 	})
+	setupMiddleware(app)
 
 	routes.SetupRoutes(app, db)
 
-	app.Get("/health", func(c *fiber.Ctx) error {
-		return c.JSON(fiber.Map{"status": "healthy", "service": "notification"})
-	})
-	app.Get("/metrics", func(c *fiber.Ctx) error {
-		return c.JSON(fiber.Map{"uptime": "N/A", "status": "operational"})
-	})
+	// Welcome, health, metrics and API document
+	routes.SetupSystemRoutes(app)
 
 	port := cfg.Port
 	log.Printf("Starting Notification Service on port %s\n", port)
@@ -0,0 +1,19 @@
+package routes
+
+import "school-erp/pkg/openapi"
+
+// APIInfo describes the service in its OpenAPI document.
+var APIInfo = openapi.Info{
+	Title:   "School ERP Notification Service",
+	Version: "1.0.0",
+}
+
+// Operations documents every route mounted by SetupRoutes and main.
+var Operations = []openapi.Operation{
+	{Method: "GET", Path: "/api/v1/", Summary: "API status", Responses: openapi.Responses{200: openapi.Any}},
+
+	{Method: "GET", Path: "/", Summary: "Service information", Responses: openapi.Responses{200: openapi.Any}},
+	{Method: "GET", Path: "/health", Summary: "Health check", Responses: openapi.Responses{200: openapi.Health{}}},
+	{Method: "GET", Path: "/metrics", Summary: "Service metrics", Responses: openapi.Responses{200: openapi.Any}},
+	{Method: "GET", Path: "/openapi.json", Summary: "OpenAPI document", Responses: openapi.Responses{200: openapi.Any}},
+}
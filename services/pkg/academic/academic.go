@@ -0,0 +1,197 @@
+// Package academic keeps schools' academic years and their terms. A school
+// has at most one current year; enrollments, invoices, exams and attendance
+// are stamped with the year they belong to so that reports can be filtered
+// by session. Years are kept in the main database and read by the services
+// through a Client.
+package academic
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Calendars a school may count its years in. Dates are always stored in AD;
+// the calendar decides how they are named and shown.
+const (
+	Gregorian    = "gregorian"
+	BikramSambat = "bikram_sambat"
+)
+
+// DateLayout is the layout of the dates of years and terms
+const DateLayout = "2006-01-02"
+
+// maxYearDays bounds the length of a year, leaving room for sessions
+// stretched while a school moves its calendar
+const maxYearDays = 550
+
+// Errors of the store and client; store errors other than these are the
+// database's
+var (
+	ErrUnknownYear   = errors.New("unknown academic year")
+	ErrNoCurrentYear = errors.New("school has no current academic year")
+	ErrInvalid       = errors.New("invalid academic year")
+	ErrOverlap       = errors.New("academic years overlap")
+	ErrClosed        = errors.New("academic year is closed")
+	ErrCurrent       = errors.New("academic year is current")
+)
+
+// Year is an academic year of a school, such as "2081" or "2025-26"
+type Year struct {
+	ID        string     `json:"id"`
+	SchoolID  string     `json:"school_id"`
+	Name      string     `json:"name"`
+	Calendar  string     `json:"calendar"`
+	StartDate string     `json:"start_date"`
+	EndDate   string     `json:"end_date"`
+	Current   bool       `json:"current"`
+	ClosedAt  *time.Time `json:"closed_at,omitempty"`
+	Terms     []Term     `json:"terms"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// Term is a term or semester of a year, in order of Position from 1
+type Term struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Position  int    `json:"position"`
+	StartDate string `json:"start_date"`
+	EndDate   string `json:"end_date"`
+}
+
+// Contains reports whether the year runs on day, formatted with DateLayout
+func (y *Year) Contains(day string) bool {
+	return y.StartDate <= day && day <= y.EndDate
+}
+
+// TermOn returns the term running on day, or nil between terms
+func (y *Year) TermOn(day string) *Term {
+	for i := range y.Terms {
+		if t := &y.Terms[i]; t.StartDate <= day && day <= t.EndDate {
+			return t
+		}
+	}
+	return nil
+}
+
+// YearInput creates or replaces a year; terms are given in order. The store
+// takes AD dates; the school service reads those of Bikram Sambat years in
+// BS, so Check rather than validation makes sure they are days.
+type YearInput struct {
+	Name      string      `json:"name" validate:"required,max=50"`
+	Calendar  string      `json:"calendar" validate:"omitempty,oneof=gregorian bikram_sambat"`
+	StartDate string      `json:"start_date" validate:"required"`
+	EndDate   string      `json:"end_date" validate:"required"`
+	Terms     []TermInput `json:"terms" validate:"dive"`
+}
+
+// TermInput is a term of a YearInput
+type TermInput struct {
+	Name      string `json:"name" validate:"required,max=50"`
+	StartDate string `json:"start_date" validate:"required"`
+	EndDate   string `json:"end_date" validate:"required"`
+}
+
+// RolloverInput names the year that follows the current one. StartDate
+// defaults to the day after the current year ends; without Terms the
+// current year's terms are copied, moved by as many days as the year.
+type RolloverInput struct {
+	Name      string      `json:"name" validate:"required,max=50"`
+	StartDate string      `json:"start_date"`
+	Terms     []TermInput `json:"terms" validate:"dive"`
+}
+
+// Check reports whether the year's dates are consistent: it ends after it
+// starts and within maxYearDays, and its terms run inside it in order
+// without overlapping. Errors wrap ErrInvalid.
+func (in *YearInput) Check() error {
+	if in.Calendar == "" {
+		in.Calendar = Gregorian
+	}
+	if in.Calendar != Gregorian && in.Calendar != BikramSambat {
+		return fmt.Errorf("%w: unknown calendar %q", ErrInvalid, in.Calendar)
+	}
+	start, end, err := span(in.StartDate, in.EndDate)
+	if err != nil {
+		return err
+	}
+	if end.Sub(start) > maxYearDays*24*time.Hour {
+		return fmt.Errorf("%w: a year may last at most %d days", ErrInvalid, maxYearDays)
+	}
+
+	names := make(map[string]bool, len(in.Terms))
+	prev := ""
+	for _, t := range in.Terms {
+		if _, _, err := span(t.StartDate, t.EndDate); err != nil {
+			return fmt.Errorf("term %q: %w", t.Name, err)
+		}
+		if t.StartDate < in.StartDate || t.EndDate > in.EndDate {
+			return fmt.Errorf("%w: term %q runs outside the year", ErrInvalid, t.Name)
+		}
+		if t.StartDate <= prev {
+			return fmt.Errorf("%w: term %q overlaps or precedes the term before it", ErrInvalid, t.Name)
+		}
+		if names[t.Name] {
+			return fmt.Errorf("%w: term %q is given twice", ErrInvalid, t.Name)
+		}
+		names[t.Name] = true
+		prev = t.EndDate
+	}
+	return nil
+}
+
+// span parses the dates of a year or term, which may not end before it
+// starts
+func span(startDate, endDate string) (time.Time, time.Time, error) {
+	start, err := time.Parse(DateLayout, startDate)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("%w: start date %q is not a date", ErrInvalid, startDate)
+	}
+	end, err := time.Parse(DateLayout, endDate)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("%w: end date %q is not a date", ErrInvalid, endDate)
+	}
+	if end.Before(start) {
+		return time.Time{}, time.Time{}, fmt.Errorf("%w: it ends before it starts", ErrInvalid)
+	}
+	return start, end, nil
+}
+
+// Next returns the year that follows cur as asked by in. The new year lasts
+// as many days as cur, so its dates only move with leap days.
+func Next(cur *Year, in RolloverInput) (YearInput, error) {
+	curStart, curEnd, err := span(cur.StartDate, cur.EndDate)
+	if err != nil {
+		return YearInput{}, err
+	}
+	start := curEnd.AddDate(0, 0, 1)
+	if in.StartDate != "" {
+		if start, err = time.Parse(DateLayout, in.StartDate); err != nil {
+			return YearInput{}, fmt.Errorf("%w: start date %q is not a date", ErrInvalid, in.StartDate)
+		}
+	}
+	if start.Before(curStart) {
+		return YearInput{}, fmt.Errorf("%w: the next year starts before the current one", ErrInvalid)
+	}
+	days := int(start.Sub(curStart).Hours() / 24)
+	shift := func(d string) string {
+		t, _ := time.Parse(DateLayout, d)
+		return t.AddDate(0, 0, days).Format(DateLayout)
+	}
+
+	next := YearInput{
+		Name:      in.Name,
+		Calendar:  cur.Calendar,
+		StartDate: start.Format(DateLayout),
+		EndDate:   shift(cur.EndDate),
+		Terms:     in.Terms,
+	}
+	if next.Terms == nil {
+		next.Terms = make([]TermInput, 0, len(cur.Terms))
+		for _, t := range cur.Terms {
+			next.Terms = append(next.Terms, TermInput{Name: t.Name, StartDate: shift(t.StartDate), EndDate: shift(t.EndDate)})
+		}
+	}
+	return next, next.Check()
+}
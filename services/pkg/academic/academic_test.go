@@ -0,0 +1,150 @@
+package academic
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"school-erp/pkg/cache"
+)
+
+func TestCheck(t *testing.T) {
+	valid := YearInput{
+		Name: "2025-26", StartDate: "2025-04-01", EndDate: "2026-03-31",
+		Terms: []TermInput{
+			{Name: "First", StartDate: "2025-04-01", EndDate: "2025-09-30"},
+			{Name: "Second", StartDate: "2025-10-01", EndDate: "2026-03-31"},
+		},
+	}
+	if err := valid.Check(); err != nil || valid.Calendar != Gregorian {
+		t.Fatalf("valid year: %v, calendar %q", err, valid.Calendar)
+	}
+
+	cases := map[string]func(in *YearInput){
+		"unknown calendar":    func(in *YearInput) { in.Calendar = "lunar" },
+		"not a date":          func(in *YearInput) { in.StartDate = "2025-02-30" },
+		"ends before starts":  func(in *YearInput) { in.EndDate = "2025-03-31" },
+		"too long":            func(in *YearInput) { in.EndDate = "2027-03-31" },
+		"term outside year":   func(in *YearInput) { in.Terms[1].EndDate = "2026-04-01" },
+		"terms overlap":       func(in *YearInput) { in.Terms[1].StartDate = "2025-09-30" },
+		"terms out of order":  func(in *YearInput) { in.Terms[0], in.Terms[1] = in.Terms[1], in.Terms[0] },
+		"term ends early":     func(in *YearInput) { in.Terms[0].EndDate = "2025-03-31" },
+		"term named twice":    func(in *YearInput) { in.Terms[1].Name = "First" },
+		"term without a date": func(in *YearInput) { in.Terms[0].StartDate = "" },
+	}
+	for name, change := range cases {
+		in := valid
+		in.Terms = append([]TermInput(nil), valid.Terms...)
+		change(&in)
+		if err := in.Check(); !errors.Is(err, ErrInvalid) {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	cur := &Year{
+		Name: "2081", Calendar: BikramSambat, StartDate: "2024-04-13", EndDate: "2025-04-13",
+		Terms: []Term{
+			{Name: "First", Position: 1, StartDate: "2024-04-13", EndDate: "2024-09-15"},
+			{Name: "Second", Position: 2, StartDate: "2024-10-01", EndDate: "2025-03-30"},
+		},
+	}
+
+	next, err := Next(cur, RolloverInput{Name: "2082"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.StartDate != "2025-04-14" || next.EndDate != "2026-04-14" || next.Calendar != BikramSambat {
+		t.Errorf("next year: %+v", next)
+	}
+	if len(next.Terms) != 2 || next.Terms[0].StartDate != "2025-04-14" || next.Terms[1].EndDate != "2026-03-31" {
+		t.Errorf("next terms: %+v", next.Terms)
+	}
+
+	// A later start moves the whole year
+	next, err = Next(cur, RolloverInput{Name: "2082", StartDate: "2025-05-01"})
+	if err != nil || next.EndDate != "2026-05-01" || next.Terms[0].EndDate != "2025-10-03" {
+		t.Errorf("later start: %+v, %v", next, err)
+	}
+
+	// Given terms replace the copied ones
+	terms := []TermInput{{Name: "Only", StartDate: "2025-04-14", EndDate: "2026-04-14"}}
+	if next, err = Next(cur, RolloverInput{Name: "2082", Terms: terms}); err != nil || len(next.Terms) != 1 {
+		t.Errorf("given terms: %+v, %v", next.Terms, err)
+	}
+
+	if _, err := Next(cur, RolloverInput{Name: "2080", StartDate: "2023-04-14"}); !errors.Is(err, ErrInvalid) {
+		t.Errorf("start before the current year: %v", err)
+	}
+}
+
+func TestYearLookup(t *testing.T) {
+	y := &Year{StartDate: "2025-04-01", EndDate: "2026-03-31", Terms: []Term{
+		{Name: "First", StartDate: "2025-04-01", EndDate: "2025-09-30"},
+		{Name: "Second", StartDate: "2025-10-15", EndDate: "2026-03-31"},
+	}}
+	for day, want := range map[string]bool{"2025-03-31": false, "2025-04-01": true, "2026-03-31": true, "2026-04-01": false} {
+		if y.Contains(day) != want {
+			t.Errorf("Contains(%s) = %v", day, !want)
+		}
+	}
+	if term := y.TermOn("2025-10-20"); term == nil || term.Name != "Second" {
+		t.Errorf("TermOn in the second term = %+v", term)
+	}
+	if term := y.TermOn("2025-10-01"); term != nil {
+		t.Errorf("TermOn between terms = %+v", term)
+	}
+}
+
+func TestClient(t *testing.T) {
+	fetches := 0
+	years := map[string][]Year{"1": {
+		{ID: "b", Name: "2025-26", StartDate: "2025-04-01", EndDate: "2026-03-31"},
+		{ID: "a", Name: "2024-25", StartDate: "2024-04-01", EndDate: "2025-03-31", Current: true},
+	}}
+	c := &Client{
+		cache: cache.NewTTL[string, []Year](time.Minute),
+		fetch: func(_ context.Context, schoolID string) ([]Year, error) {
+			fetches++
+			return years[schoolID], nil
+		},
+	}
+	ctx := context.Background()
+
+	if y, err := c.Current(ctx, "1"); err != nil || y.ID != "a" {
+		t.Fatalf("Current = %+v, %v", y, err)
+	}
+	for ref, want := range map[string]string{"": "a", "current": "a", "b": "b", "2024-25": "a"} {
+		if y, err := c.Resolve(ctx, "1", ref); err != nil || y.ID != want {
+			t.Errorf("Resolve(%q) = %+v, %v", ref, y, err)
+		}
+	}
+	if _, err := c.Resolve(ctx, "1", "2019"); !errors.Is(err, ErrUnknownYear) {
+		t.Errorf("Resolve of an unknown year: %v", err)
+	}
+	if y, err := c.On(ctx, "1", time.Date(2025, 12, 1, 10, 0, 0, 0, time.UTC)); err != nil || y.ID != "b" {
+		t.Errorf("On = %+v, %v", y, err)
+	}
+	if _, err := c.On(ctx, "1", time.Date(2023, 12, 1, 0, 0, 0, 0, time.UTC)); !errors.Is(err, ErrUnknownYear) {
+		t.Errorf("On a day of no year: %v", err)
+	}
+	if _, err := c.Current(ctx, "2"); !errors.Is(err, ErrNoCurrentYear) {
+		t.Errorf("Current of a school without years: %v", err)
+	}
+
+	years["1"] = []Year{
+		{ID: "b", Name: "2025-26", StartDate: "2025-04-01", EndDate: "2026-03-31", Current: true},
+		{ID: "a", Name: "2024-25", StartDate: "2024-04-01", EndDate: "2025-03-31"},
+	}
+	if y, _ := c.Current(ctx, "1"); y.ID != "a" || fetches != 2 {
+		t.Fatalf("cached years: current %s after %d fetches", y.ID, fetches)
+	}
+	event, _ := json.Marshal(YearChanged{SchoolID: "1", YearID: "b"})
+	c.HandleEvent(event)
+	if y, _ := c.Current(ctx, "1"); y.ID != "b" || fetches != 3 {
+		t.Fatalf("years after event: current %s after %d fetches", y.ID, fetches)
+	}
+}
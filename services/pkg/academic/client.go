@@ -0,0 +1,103 @@
+package academic
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"school-erp/pkg/cache"
+)
+
+// Client reads schools' academic years for the services, which stamp their
+// records with them. A school's years are cached for ttl or until a
+// YearChanged event for the school is passed to HandleEvent.
+type Client struct {
+	fetch func(ctx context.Context, schoolID string) ([]Year, error)
+	cache *cache.TTL[string, []Year]
+}
+
+// NewClient creates a client reading the main database
+func NewClient(db *pgxpool.Pool, ttl time.Duration) *Client {
+	return &Client{fetch: NewStore(db, nil).List, cache: cache.NewTTL[string, []Year](ttl)}
+}
+
+// Years returns the school's years, latest first. The slice is shared;
+// callers must not change it.
+func (c *Client) Years(ctx context.Context, schoolID string) ([]Year, error) {
+	return c.cache.Get(schoolID, func() ([]Year, error) {
+		return c.fetch(ctx, schoolID)
+	})
+}
+
+// Current returns the school's current year, or ErrNoCurrentYear
+func (c *Client) Current(ctx context.Context, schoolID string) (*Year, error) {
+	years, err := c.Years(ctx, schoolID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range years {
+		if years[i].Current {
+			return &years[i], nil
+		}
+	}
+	return nil, ErrNoCurrentYear
+}
+
+// On returns the school's year running on day, or ErrUnknownYear for days
+// outside every year
+func (c *Client) On(ctx context.Context, schoolID string, day time.Time) (*Year, error) {
+	years, err := c.Years(ctx, schoolID)
+	if err != nil {
+		return nil, err
+	}
+	d := day.Format(DateLayout)
+	for i := range years {
+		if years[i].Contains(d) {
+			return &years[i], nil
+		}
+	}
+	return nil, fmt.Errorf("%w on %s", ErrUnknownYear, d)
+}
+
+// Resolve returns the school's year named by ref, as given in requests: its
+// ID or name, or "current" or nothing for the current year
+func (c *Client) Resolve(ctx context.Context, schoolID, ref string) (*Year, error) {
+	if ref == "" || ref == "current" {
+		return c.Current(ctx, schoolID)
+	}
+	years, err := c.Years(ctx, schoolID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range years {
+		if years[i].ID == ref || years[i].Name == ref {
+			return &years[i], nil
+		}
+	}
+	return nil, fmt.Errorf("%w %q", ErrUnknownYear, ref)
+}
+
+// Invalidate drops the cached years of the school, or with an empty ID of
+// every school
+func (c *Client) Invalidate(schoolID string) {
+	if schoolID == "" {
+		c.cache.Clear()
+	} else {
+		c.cache.Invalidate(schoolID)
+	}
+}
+
+// HandleEvent invalidates the years of the school named by a YearChanged
+// message; malformed ones are logged
+func (c *Client) HandleEvent(data []byte) {
+	var e YearChanged
+	if err := json.Unmarshal(data, &e); err != nil {
+		log.Printf("Invalid %s event: %v\n", SubjectYearChanged, err)
+		return
+	}
+	c.Invalidate(e.SchoolID)
+}
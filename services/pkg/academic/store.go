@@ -0,0 +1,425 @@
+package academic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"school-erp/pkg/events"
+)
+
+// Migration creates the academic year and term tables in the main database,
+// after the schools table. The school service includes it in its migration
+// list. At most one year of a school is current.
+const Migration = `
+CREATE TABLE IF NOT EXISTS academic_years (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	school_id UUID NOT NULL REFERENCES schools(id) ON DELETE CASCADE,
+	name VARCHAR(50) NOT NULL,
+	calendar VARCHAR(20) NOT NULL DEFAULT 'gregorian' CHECK (calendar IN ('gregorian', 'bikram_sambat')),
+	start_date DATE NOT NULL,
+	end_date DATE NOT NULL,
+	is_current BOOLEAN NOT NULL DEFAULT false,
+	closed_at TIMESTAMP,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	CHECK (end_date >= start_date),
+	UNIQUE (school_id, name)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_academic_years_current ON academic_years(school_id) WHERE is_current;
+
+CREATE TABLE IF NOT EXISTS academic_terms (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	year_id UUID NOT NULL REFERENCES academic_years(id) ON DELETE CASCADE,
+	name VARCHAR(50) NOT NULL,
+	position INTEGER NOT NULL,
+	start_date DATE NOT NULL,
+	end_date DATE NOT NULL,
+	CHECK (end_date >= start_date),
+	UNIQUE (year_id, position)
+);
+`
+
+// Backfill returns the migration linking the rows of a shared table, such as
+// attendance, to the academic year their day falls in. date is an SQL
+// expression of a row's day, with the table aliased t; rows outside every
+// year are left unlinked.
+// It does nothing before the school service has created academic_years, and
+// may be run again to link rows of years added since.
+func Backfill(table, date string) string {
+	return fmt.Sprintf(`
+DO $$
+BEGIN
+	IF to_regclass('academic_years') IS NOT NULL THEN
+		UPDATE %[1]s t SET academic_year_id = y.id
+		FROM schools s JOIN academic_years y ON y.school_id = s.id
+		WHERE t.academic_year_id IS NULL AND s.shared_id = t.school_id
+			AND (%[2]s)::date BETWEEN y.start_date AND y.end_date;
+	END IF;
+END
+$$;
+`, table, date)
+}
+
+// SubjectYearChanged is the subject of YearChanged events
+const SubjectYearChanged = "AcademicYearChanged"
+
+// YearChanged is published when a year of a school is created, changed or
+// deleted, or another year becomes current. RolledOver is set when the
+// current year was closed for the next.
+type YearChanged struct {
+	SchoolID   string    `json:"school_id"`
+	YearID     string    `json:"year_id"`
+	RolledOver bool      `json:"rolled_over,omitempty"`
+	ChangedAt  time.Time `json:"changed_at"`
+}
+
+func send(publish events.Publisher, e YearChanged) {
+	e.ChangedAt = time.Now().UTC()
+	events.Send(publish, SubjectYearChanged, e)
+}
+
+// Store reads and writes academic years in the main database. Writes to a
+// school's years lock its row in schools, so that checks for overlapping
+// years are not raced.
+type Store struct {
+	db      *pgxpool.Pool
+	publish events.Publisher
+}
+
+func NewStore(db *pgxpool.Pool, publish events.Publisher) *Store {
+	return &Store{db: db, publish: publish}
+}
+
+const yearColumns = `id::text, school_id::text, name, calendar, to_char(start_date, 'YYYY-MM-DD'),
+	to_char(end_date, 'YYYY-MM-DD'), is_current, closed_at, created_at, updated_at`
+
+func scanYear(row pgx.Row, y *Year) error {
+	return row.Scan(&y.ID, &y.SchoolID, &y.Name, &y.Calendar, &y.StartDate, &y.EndDate,
+		&y.Current, &y.ClosedAt, &y.CreatedAt, &y.UpdatedAt)
+}
+
+// querier is a pool or a transaction
+type querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// List returns the school's years, latest first, with their terms
+func (s *Store) List(ctx context.Context, schoolID string) ([]Year, error) {
+	return list(ctx, s.db, schoolID)
+}
+
+func list(ctx context.Context, q querier, schoolID string) ([]Year, error) {
+	rows, err := q.Query(ctx, `
+	SELECT `+yearColumns+` FROM academic_years WHERE school_id = $1 ORDER BY start_date DESC`, schoolID)
+	if err != nil {
+		return nil, err
+	}
+	years := []Year{}
+	index := make(map[string]int)
+	for rows.Next() {
+		var y Year
+		if err := scanYear(rows, &y); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		y.Terms = []Term{}
+		index[y.ID] = len(years)
+		years = append(years, y)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = q.Query(ctx, `
+	SELECT t.year_id::text, t.id::text, t.name, t.position, to_char(t.start_date, 'YYYY-MM-DD'), to_char(t.end_date, 'YYYY-MM-DD')
+	FROM academic_terms t JOIN academic_years y ON y.id = t.year_id
+	WHERE y.school_id = $1 ORDER BY t.position`, schoolID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var yearID string
+		var t Term
+		if err := rows.Scan(&yearID, &t.ID, &t.Name, &t.Position, &t.StartDate, &t.EndDate); err != nil {
+			return nil, err
+		}
+		y := &years[index[yearID]]
+		y.Terms = append(y.Terms, t)
+	}
+	return years, rows.Err()
+}
+
+// Get returns the school's year with id, or ErrUnknownYear
+func (s *Store) Get(ctx context.Context, schoolID, id string) (*Year, error) {
+	return get(ctx, s.db, schoolID, id)
+}
+
+func get(ctx context.Context, q querier, schoolID, id string) (*Year, error) {
+	years, err := list(ctx, q, schoolID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range years {
+		if years[i].ID == id {
+			return &years[i], nil
+		}
+	}
+	return nil, fmt.Errorf("%w %q", ErrUnknownYear, id)
+}
+
+// Current returns the school's current year, or ErrNoCurrentYear
+func (s *Store) Current(ctx context.Context, schoolID string) (*Year, error) {
+	return current(ctx, s.db, schoolID)
+}
+
+func current(ctx context.Context, q querier, schoolID string) (*Year, error) {
+	years, err := list(ctx, q, schoolID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range years {
+		if years[i].Current {
+			return &years[i], nil
+		}
+	}
+	return nil, ErrNoCurrentYear
+}
+
+// Create adds a year to the school; the school's first year becomes
+// current. It returns pgx.ErrNoRows for unknown schools.
+func (s *Store) Create(ctx context.Context, schoolID string, in YearInput) (*Year, error) {
+	if err := in.Check(); err != nil {
+		return nil, err
+	}
+	var y *Year
+	err := s.write(ctx, schoolID, func(tx pgx.Tx) error {
+		if err := checkOverlap(ctx, tx, schoolID, "", in); err != nil {
+			return err
+		}
+		var id string
+		err := tx.QueryRow(ctx, `
+		INSERT INTO academic_years (school_id, name, calendar, start_date, end_date, is_current)
+		VALUES ($1, $2, $3, $4, $5, NOT EXISTS (SELECT 1 FROM academic_years WHERE school_id = $1 AND is_current))
+		RETURNING id::text`, schoolID, in.Name, in.Calendar, in.StartDate, in.EndDate).Scan(&id)
+		if err != nil {
+			return err
+		}
+		if err := putTerms(ctx, tx, id, in.Terms); err != nil {
+			return err
+		}
+		y, err = get(ctx, tx, schoolID, id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	send(s.publish, YearChanged{SchoolID: schoolID, YearID: y.ID})
+	return y, nil
+}
+
+// Update replaces the name, dates and terms of the school's year, and its
+// calendar when one is given. Closed years cannot be changed.
+func (s *Store) Update(ctx context.Context, schoolID, id string, in YearInput) (*Year, error) {
+	var y *Year
+	err := s.write(ctx, schoolID, func(tx pgx.Tx) error {
+		old, err := get(ctx, tx, schoolID, id)
+		if err != nil {
+			return err
+		}
+		if old.ClosedAt != nil {
+			return fmt.Errorf("%w: %s", ErrClosed, old.Name)
+		}
+		if in.Calendar == "" {
+			in.Calendar = old.Calendar
+		}
+		if err := in.Check(); err != nil {
+			return err
+		}
+		if err := checkOverlap(ctx, tx, schoolID, id, in); err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, `
+		UPDATE academic_years SET name = $2, calendar = $3, start_date = $4, end_date = $5, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1`, id, in.Name, in.Calendar, in.StartDate, in.EndDate)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, `DELETE FROM academic_terms WHERE year_id = $1`, id); err != nil {
+			return err
+		}
+		if err := putTerms(ctx, tx, id, in.Terms); err != nil {
+			return err
+		}
+		y, err = get(ctx, tx, schoolID, id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	send(s.publish, YearChanged{SchoolID: schoolID, YearID: id})
+	return y, nil
+}
+
+// Delete removes a year that is neither current nor closed. Records of the
+// services stamped with it are not checked: only years no one has used yet
+// should be deleted.
+func (s *Store) Delete(ctx context.Context, schoolID, id string) error {
+	err := s.write(ctx, schoolID, func(tx pgx.Tx) error {
+		y, err := get(ctx, tx, schoolID, id)
+		if err != nil {
+			return err
+		}
+		switch {
+		case y.Current:
+			return fmt.Errorf("%w: %s", ErrCurrent, y.Name)
+		case y.ClosedAt != nil:
+			return fmt.Errorf("%w: %s", ErrClosed, y.Name)
+		}
+		_, err = tx.Exec(ctx, `DELETE FROM academic_years WHERE id = $1`, id)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	send(s.publish, YearChanged{SchoolID: schoolID, YearID: id})
+	return nil
+}
+
+// Activate makes the school's year current. The year it replaces stays
+// open; Rollover closes it.
+func (s *Store) Activate(ctx context.Context, schoolID, id string) (*Year, error) {
+	var y *Year
+	err := s.write(ctx, schoolID, func(tx pgx.Tx) error {
+		var err error
+		if y, err = get(ctx, tx, schoolID, id); err != nil {
+			return err
+		}
+		if y.ClosedAt != nil {
+			return fmt.Errorf("%w: %s", ErrClosed, y.Name)
+		}
+		if err := setCurrent(ctx, tx, schoolID, id); err != nil {
+			return err
+		}
+		y, err = get(ctx, tx, schoolID, id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	send(s.publish, YearChanged{SchoolID: schoolID, YearID: id})
+	return y, nil
+}
+
+// Rollover closes the school's current year and makes the year that
+// follows it current, creating it as Next describes. It returns the new
+// year, or ErrNoCurrentYear.
+func (s *Store) Rollover(ctx context.Context, schoolID string, in RolloverInput) (*Year, error) {
+	var y *Year
+	err := s.write(ctx, schoolID, func(tx pgx.Tx) error {
+		cur, err := current(ctx, tx, schoolID)
+		if err != nil {
+			return err
+		}
+		next, err := Next(cur, in)
+		if err != nil {
+			return err
+		}
+		if err := checkOverlap(ctx, tx, schoolID, "", next); err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, `
+		UPDATE academic_years SET is_current = false, closed_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1`, cur.ID)
+		if err != nil {
+			return err
+		}
+		var id string
+		err = tx.QueryRow(ctx, `
+		INSERT INTO academic_years (school_id, name, calendar, start_date, end_date, is_current)
+		VALUES ($1, $2, $3, $4, $5, true)
+		RETURNING id::text`, schoolID, next.Name, next.Calendar, next.StartDate, next.EndDate).Scan(&id)
+		if err != nil {
+			return err
+		}
+		if err := putTerms(ctx, tx, id, next.Terms); err != nil {
+			return err
+		}
+		y, err = get(ctx, tx, schoolID, id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	send(s.publish, YearChanged{SchoolID: schoolID, YearID: y.ID, RolledOver: true})
+	return y, nil
+}
+
+// write runs fn in a transaction holding the school's row
+func (s *Store) write(ctx context.Context, schoolID string, fn func(tx pgx.Tx) error) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var found bool
+	if err := tx.QueryRow(ctx, `SELECT true FROM schools WHERE id = $1 FOR UPDATE`, schoolID).Scan(&found); err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// checkOverlap returns ErrOverlap if another year of the school than id
+// shares a day with in
+func checkOverlap(ctx context.Context, tx pgx.Tx, schoolID, id string, in YearInput) error {
+	var name string
+	err := tx.QueryRow(ctx, `
+	SELECT name FROM academic_years
+	WHERE school_id = $1 AND id::text <> $2 AND start_date <= $4 AND end_date >= $3
+	LIMIT 1`, schoolID, id, in.StartDate, in.EndDate).Scan(&name)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("%w: %s runs on some of the same days", ErrOverlap, name)
+}
+
+// setCurrent makes the year current in two steps, as the unique index on
+// current years is checked row by row
+func setCurrent(ctx context.Context, tx pgx.Tx, schoolID, id string) error {
+	_, err := tx.Exec(ctx, `
+	UPDATE academic_years SET is_current = false, updated_at = CURRENT_TIMESTAMP
+	WHERE school_id = $1 AND is_current AND id <> $2`, schoolID, id)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, `
+	UPDATE academic_years SET is_current = true, updated_at = CURRENT_TIMESTAMP WHERE id = $1 AND NOT is_current`, id)
+	return err
+}
+
+func putTerms(ctx context.Context, tx pgx.Tx, yearID string, terms []TermInput) error {
+	for i, t := range terms {
+		_, err := tx.Exec(ctx, `
+		INSERT INTO academic_terms (year_id, name, position, start_date, end_date) VALUES ($1, $2, $3, $4, $5)`,
+			yearID, t.Name, i+1, t.StartDate, t.EndDate)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
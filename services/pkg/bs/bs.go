@@ -0,0 +1,282 @@
+// Package bs converts between the Bikram Sambat (BS) calendar, the official
+// calendar of Nepal, and the Gregorian (AD) one. BS months follow the sun,
+// so their lengths vary from year to year and are only known from the
+// published calendars; Months holds them for the years the package
+// supports. Dates are stored in AD everywhere and converted at the edges:
+// Calendar formats and parses them as a school's settings ask.
+package bs
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Years supported by the month table
+const (
+	MinYear = 2000
+	MaxYear = 2090
+)
+
+var (
+	// ErrOutOfRange is returned for dates outside the years of the table
+	ErrOutOfRange = errors.New("date is outside the supported Bikram Sambat years")
+	// ErrInvalid is returned for dates that do not exist in the calendar
+	ErrInvalid = errors.New("invalid Bikram Sambat date")
+)
+
+// epoch is the AD day of 1 Baisakh MinYear
+var epoch = time.Date(1943, time.April, 14, 0, 0, 0, 0, time.UTC)
+
+// Months holds the number of days of the months of each year from MinYear,
+// Baisakh first, as published by the Nepal Panchanga Nirnayak Samiti up to
+// 2082. Later years are projected on the four-year cycle of the years
+// before them until their calendars are published; correct them here then.
+var Months = [MaxYear - MinYear + 1][12]int{
+	{30, 32, 31, 32, 31, 30, 30, 30, 29, 30, 29, 31}, // 2000
+	{31, 31, 32, 31, 31, 31, 30, 29, 30, 29, 30, 30},
+	{31, 31, 32, 32, 31, 30, 30, 29, 30, 29, 30, 30},
+	{31, 32, 31, 32, 31, 30, 30, 30, 29, 29, 30, 31},
+	{30, 32, 31, 32, 31, 30, 30, 30, 29, 30, 29, 31},
+	{31, 31, 32, 31, 31, 31, 30, 29, 30, 29, 30, 30},
+	{31, 31, 32, 32, 31, 30, 30, 29, 30, 29, 30, 30},
+	{31, 32, 31, 32, 31, 30, 30, 30, 29, 29, 30, 31},
+	{31, 31, 31, 32, 31, 31, 29, 30, 30, 29, 29, 31},
+	{31, 31, 32, 31, 31, 31, 30, 29, 30, 29, 30, 30},
+	{31, 31, 32, 32, 31, 30, 30, 29, 30, 29, 30, 30}, // 2010
+	{31, 32, 31, 32, 31, 30, 30, 30, 29, 29, 30, 31},
+	{31, 31, 31, 32, 31, 31, 29, 30, 30, 29, 30, 30},
+	{31, 31, 32, 31, 31, 31, 30, 29, 30, 29, 30, 30},
+	{31, 31, 32, 32, 31, 30, 30, 29, 30, 29, 30, 30},
+	{31, 32, 31, 32, 31, 30, 30, 30, 29, 29, 30, 31},
+	{31, 31, 31, 32, 31, 31, 29, 30, 30, 29, 30, 30},
+	{31, 31, 32, 31, 31, 31, 30, 29, 30, 29, 30, 30},
+	{31, 32, 31, 32, 31, 30, 30, 29, 30, 29, 30, 30},
+	{31, 32, 31, 32, 31, 30, 30, 30, 29, 30, 29, 31},
+	{31, 31, 31, 32, 31, 31, 30, 29, 30, 29, 30, 30}, // 2020
+	{31, 31, 32, 31, 31, 31, 30, 29, 30, 29, 30, 30},
+	{31, 32, 31, 32, 31, 30, 30, 30, 29, 29, 30, 30},
+	{31, 32, 31, 32, 31, 30, 30, 30, 29, 30, 29, 31},
+	{31, 31, 31, 32, 31, 31, 30, 29, 30, 29, 30, 30},
+	{31, 31, 32, 31, 31, 31, 30, 29, 30, 29, 30, 30},
+	{31, 32, 31, 32, 31, 30, 30, 30, 29, 29, 30, 31},
+	{30, 32, 31, 32, 31, 30, 30, 30, 29, 30, 29, 31},
+	{31, 31, 32, 31, 31, 31, 30, 29, 30, 29, 30, 30},
+	{31, 31, 32, 31, 32, 30, 30, 29, 30, 29, 30, 30},
+	{31, 32, 31, 32, 31, 30, 30, 30, 29, 29, 30, 31}, // 2030
+	{30, 32, 31, 32, 31, 30, 30, 30, 29, 30, 29, 31},
+	{31, 31, 32, 31, 31, 31, 30, 29, 30, 29, 30, 30},
+	{31, 31, 32, 32, 31, 30, 30, 29, 30, 29, 30, 30},
+	{31, 32, 31, 32, 31, 30, 30, 30, 29, 29, 30, 31},
+	{30, 32, 31, 32, 31, 31, 29, 30, 30, 29, 29, 31},
+	{31, 31, 32, 31, 31, 31, 30, 29, 30, 29, 30, 30},
+	{31, 31, 32, 32, 31, 30, 30, 29, 30, 29, 30, 30},
+	{31, 32, 31, 32, 31, 30, 30, 30, 29, 29, 30, 31},
+	{31, 31, 31, 32, 31, 31, 29, 30, 30, 29, 30, 30},
+	{31, 31, 32, 31, 31, 31, 30, 29, 30, 29, 30, 30}, // 2040
+	{31, 31, 32, 32, 31, 30, 30, 29, 30, 29, 30, 30},
+	{31, 32, 31, 32, 31, 30, 30, 30, 29, 29, 30, 31},
+	{31, 31, 31, 32, 31, 31, 29, 30, 30, 29, 30, 30},
+	{31, 31, 32, 31, 31, 31, 30, 29, 30, 29, 30, 30},
+	{31, 32, 31, 32, 31, 30, 30, 29, 30, 29, 30, 30},
+	{31, 32, 31, 32, 31, 30, 30, 30, 29, 29, 30, 31},
+	{31, 31, 31, 32, 31, 31, 30, 29, 30, 29, 30, 30},
+	{31, 31, 32, 31, 31, 31, 30, 29, 30, 29, 30, 30},
+	{31, 32, 31, 32, 31, 30, 30, 30, 29, 29, 30, 30},
+	{31, 32, 31, 32, 31, 30, 30, 30, 29, 30, 29, 31}, // 2050
+	{31, 31, 31, 32, 31, 31, 30, 29, 30, 29, 30, 30},
+	{31, 31, 32, 31, 31, 31, 30, 29, 30, 29, 30, 30},
+	{31, 32, 31, 32, 31, 30, 30, 30, 29, 29, 30, 30},
+	{31, 32, 31, 32, 31, 30, 30, 30, 29, 30, 29, 31},
+	{31, 31, 32, 31, 31, 31, 30, 29, 30, 29, 30, 30},
+	{31, 31, 32, 31, 32, 30, 30, 29, 30, 29, 30, 30},
+	{31, 32, 31, 32, 31, 30, 30, 30, 29, 29, 30, 31},
+	{30, 32, 31, 32, 31, 30, 30, 30, 29, 30, 29, 31},
+	{31, 31, 32, 31, 31, 31, 30, 29, 30, 29, 30, 30},
+	{31, 31, 32, 32, 31, 30, 30, 29, 30, 29, 30, 30}, // 2060
+	{31, 32, 31, 32, 31, 30, 30, 30, 29, 29, 30, 31},
+	{30, 32, 31, 32, 31, 31, 29, 30, 29, 30, 29, 31},
+	{31, 31, 32, 31, 31, 31, 30, 29, 30, 29, 30, 30},
+	{31, 31, 32, 32, 31, 30, 30, 29, 30, 29, 30, 30},
+	{31, 32, 31, 32, 31, 30, 30, 30, 29, 29, 30, 31},
+	{31, 31, 31, 32, 31, 31, 29, 30, 30, 29, 29, 31},
+	{31, 31, 32, 31, 31, 31, 30, 29, 30, 29, 30, 30},
+	{31, 31, 32, 32, 31, 30, 30, 29, 30, 29, 30, 30},
+	{31, 32, 31, 32, 31, 30, 30, 30, 29, 29, 30, 31},
+	{31, 31, 31, 32, 31, 31, 29, 30, 30, 29, 30, 30}, // 2070
+	{31, 31, 32, 31, 31, 31, 30, 29, 30, 29, 30, 30},
+	{31, 32, 31, 32, 31, 30, 30, 29, 30, 29, 30, 30},
+	{31, 32, 31, 32, 31, 30, 30, 30, 29, 29, 30, 31},
+	{31, 31, 31, 32, 31, 31, 30, 29, 30, 29, 30, 30},
+	{31, 31, 32, 31, 31, 31, 30, 29, 30, 29, 30, 30},
+	{31, 32, 31, 32, 31, 30, 30, 30, 29, 29, 30, 30},
+	{31, 32, 31, 32, 31, 30, 30, 30, 29, 30, 29, 31},
+	{31, 31, 31, 32, 31, 31, 30, 29, 30, 29, 30, 30},
+	{31, 31, 32, 31, 31, 31, 30, 29, 30, 29, 30, 30},
+	{31, 32, 31, 32, 31, 30, 30, 30, 29, 29, 30, 30}, // 2080
+	{31, 32, 31, 32, 31, 30, 30, 30, 29, 30, 29, 31},
+	{31, 31, 32, 31, 31, 31, 30, 29, 30, 29, 30, 30},
+	{31, 31, 32, 31, 31, 31, 30, 29, 30, 29, 30, 30}, // projected from here
+	{31, 32, 31, 32, 31, 30, 30, 30, 29, 29, 30, 30},
+	{31, 32, 31, 32, 31, 30, 30, 30, 29, 30, 29, 31},
+	{31, 31, 32, 31, 31, 31, 30, 29, 30, 29, 30, 30},
+	{31, 31, 32, 31, 31, 31, 30, 29, 30, 29, 30, 30},
+	{31, 32, 31, 32, 31, 30, 30, 30, 29, 29, 30, 30},
+	{31, 32, 31, 32, 31, 30, 30, 30, 29, 30, 29, 31},
+	{31, 31, 32, 31, 31, 31, 30, 29, 30, 29, 30, 30}, // 2090
+}
+
+// MonthNames are the names of the BS months, Baisakh first
+var MonthNames = [12]string{
+	"Baisakh", "Jestha", "Asar", "Shrawan", "Bhadra", "Ashwin",
+	"Kartik", "Mangsir", "Poush", "Magh", "Falgun", "Chaitra",
+}
+
+// yearStarts holds the days from epoch to 1 Baisakh of each year, and of
+// the year after the last
+var yearStarts [len(Months) + 1]int
+
+func init() {
+	for i, months := range Months {
+		days := 0
+		for _, n := range months {
+			days += n
+		}
+		yearStarts[i+1] = yearStarts[i] + days
+	}
+}
+
+// Date is a day of the BS calendar. Months run from 1 (Baisakh) to 12
+// (Chaitra).
+type Date struct {
+	Year  int
+	Month int
+	Day   int
+}
+
+// New returns the date after checking that it exists
+func New(year, month, day int) (Date, error) {
+	d := Date{year, month, day}
+	n, err := DaysInMonth(year, month)
+	if err != nil {
+		return d, err
+	}
+	if day < 1 || day > n {
+		return d, fmt.Errorf("%w: %s %d has %d days", ErrInvalid, MonthNames[month-1], year, n)
+	}
+	return d, nil
+}
+
+// DaysInMonth returns the number of days of the month of year
+func DaysInMonth(year, month int) (int, error) {
+	if year < MinYear || year > MaxYear {
+		return 0, fmt.Errorf("%w: %d", ErrOutOfRange, year)
+	}
+	if month < 1 || month > 12 {
+		return 0, fmt.Errorf("%w: month %d", ErrInvalid, month)
+	}
+	return Months[year-MinYear][month-1], nil
+}
+
+// DaysInYear returns the number of days of year
+func DaysInYear(year int) (int, error) {
+	if year < MinYear || year > MaxYear {
+		return 0, fmt.Errorf("%w: %d", ErrOutOfRange, year)
+	}
+	return yearStarts[year-MinYear+1] - yearStarts[year-MinYear], nil
+}
+
+// FromAD returns the BS date of the day of t, in t's location
+func FromAD(t time.Time) (Date, error) {
+	days := int(civil(t).Sub(epoch).Hours() / 24)
+	if days < 0 || days >= yearStarts[len(Months)] {
+		return Date{}, fmt.Errorf("%w: %s", ErrOutOfRange, t.Format(time.DateOnly))
+	}
+	// Years are at least 365 days long, so the estimate is never early
+	i := min(days/365, len(Months)-1)
+	for yearStarts[i] > days {
+		i--
+	}
+	days -= yearStarts[i]
+	month := 0
+	for days >= Months[i][month] {
+		days -= Months[i][month]
+		month++
+	}
+	return Date{Year: MinYear + i, Month: month + 1, Day: days + 1}, nil
+}
+
+// AD returns the day as midnight UTC. d must exist; see New.
+func (d Date) AD() time.Time {
+	days := yearStarts[d.Year-MinYear]
+	for m := 0; m < d.Month-1; m++ {
+		days += Months[d.Year-MinYear][m]
+	}
+	return epoch.AddDate(0, 0, days+d.Day-1)
+}
+
+// ToAD returns the AD day of the BS date as midnight UTC
+func ToAD(year, month, day int) (time.Time, error) {
+	d, err := New(year, month, day)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return d.AD(), nil
+}
+
+// String returns the date as YYYY-MM-DD
+func (d Date) String() string {
+	return fmt.Sprintf("%04d-%02d-%02d", d.Year, d.Month, d.Day)
+}
+
+// Long returns the date as, for example, 15 Baisakh 2081. d must exist.
+func (d Date) Long() string {
+	return fmt.Sprintf("%d %s %d", d.Day, MonthNames[d.Month-1], d.Year)
+}
+
+// Parse reads a YYYY-MM-DD date; months and days may have one digit
+func Parse(s string) (Date, error) {
+	parts := strings.Split(s, "-")
+	if len(parts) == 3 {
+		year, ok1 := number(parts[0], 4, 4)
+		month, ok2 := number(parts[1], 1, 2)
+		day, ok3 := number(parts[2], 1, 2)
+		if ok1 && ok2 && ok3 {
+			return New(year, month, day)
+		}
+	}
+	return Date{}, fmt.Errorf("%w: %q is not YYYY-MM-DD", ErrInvalid, s)
+}
+
+// number reads s as a number of minLen to maxLen ASCII digits
+func number(s string, minLen, maxLen int) (int, bool) {
+	if len(s) < minLen || len(s) > maxLen {
+		return 0, false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return 0, false
+		}
+	}
+	n, err := strconv.Atoi(s)
+	return n, err == nil
+}
+
+// MonthBounds returns the first and last AD days of the month of year, for
+// reports by BS month
+func MonthBounds(year, month int) (first, last time.Time, err error) {
+	n, err := DaysInMonth(year, month)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	first = Date{year, month, 1}.AD()
+	return first, first.AddDate(0, 0, n-1), nil
+}
+
+// civil returns the day of t as midnight UTC
+func civil(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
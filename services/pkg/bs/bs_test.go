@@ -0,0 +1,256 @@
+package bs
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func day(s string) time.Time {
+	t, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// TestEveryDay walks every day of the table: each converts to the AD day
+// after the one before it and back to itself.
+func TestEveryDay(t *testing.T) {
+	want := epoch
+	total := 0
+	for year := MinYear; year <= MaxYear; year++ {
+		for month := 1; month <= 12; month++ {
+			n, err := DaysInMonth(year, month)
+			if err != nil || n < 29 || n > 32 {
+				t.Fatalf("DaysInMonth(%d, %d) = %d, %v", year, month, n, err)
+			}
+			for d := 1; d <= n; d++ {
+				date := Date{year, month, d}
+				ad, err := ToAD(year, month, d)
+				if err != nil || !ad.Equal(want) {
+					t.Fatalf("ToAD(%s) = %s, %v; want %s", date, ad, err, want)
+				}
+				back, err := FromAD(ad)
+				if err != nil || back != date {
+					t.Fatalf("FromAD(%s) = %s, %v; want %s", ad, back, err, date)
+				}
+				want = want.AddDate(0, 0, 1)
+				total++
+			}
+		}
+	}
+	if last := yearStarts[len(Months)]; total != last {
+		t.Errorf("walked %d days, table has %d", total, last)
+	}
+}
+
+// TestNewYears checks that every year starts on 13 or 14 April, as the sun
+// enters Aries then, and that its length agrees with the next start.
+func TestNewYears(t *testing.T) {
+	for year := MinYear; year <= MaxYear; year++ {
+		start, _ := ToAD(year, 1, 1)
+		if start.Month() != time.April || start.Day() < 13 || start.Day() > 14 {
+			t.Errorf("%d starts on %s", year, start.Format(time.DateOnly))
+		}
+		n, err := DaysInYear(year)
+		if err != nil || n < 365 || n > 366 {
+			t.Errorf("DaysInYear(%d) = %d, %v", year, n, err)
+		}
+		if year < MaxYear {
+			next, _ := ToAD(year+1, 1, 1)
+			if got := int(next.Sub(start).Hours() / 24); got != n {
+				t.Errorf("%d lasts %d days, table says %d", year, got, n)
+			}
+		}
+	}
+}
+
+// TestKnownDays checks days of published calendars
+func TestKnownDays(t *testing.T) {
+	known := map[string]string{
+		"2000-01-01": "1943-04-14",
+		"2045-01-01": "1988-04-13",
+		"2057-01-01": "2000-04-13",
+		"2060-01-01": "2003-04-14",
+		"2068-01-01": "2011-04-14",
+		"2070-01-01": "2013-04-14",
+		"2073-01-01": "2016-04-13",
+		"2076-06-01": "2019-09-18", // Ashwin, before Dashain
+		"2077-01-01": "2020-04-13",
+		"2079-01-01": "2022-04-14",
+		"2080-07-01": "2023-10-18", // Kartik
+		"2081-01-01": "2024-04-13",
+		"2081-06-17": "2024-10-03", // Ghatasthapana
+		"2081-07-16": "2024-11-01", // Laxmi Puja
+		"2081-10-01": "2025-01-14", // Maghe Sankranti
+		"2081-12-31": "2025-04-13",
+		"2082-01-01": "2025-04-14",
+		"2082-06-16": "2025-10-02", // Vijaya Dashami
+		"2082-07-01": "2025-10-18",
+	}
+	for bsDay, adDay := range known {
+		d, err := Parse(bsDay)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := d.AD(); !got.Equal(day(adDay)) {
+			t.Errorf("%s is %s, want %s", bsDay, got.Format(time.DateOnly), adDay)
+		}
+		if got, err := FromAD(day(adDay)); err != nil || got != d {
+			t.Errorf("FromAD(%s) = %s, %v; want %s", adDay, got, err, bsDay)
+		}
+	}
+}
+
+func TestFromADLocation(t *testing.T) {
+	// Late evening in Kathmandu is the same day there, but the next in UTC
+	kathmandu := time.FixedZone("NPT", 5*3600+45*60)
+	d, err := FromAD(time.Date(2024, 4, 13, 23, 30, 0, 0, kathmandu))
+	if err != nil || d != (Date{2081, 1, 1}) {
+		t.Errorf("FromAD in Kathmandu = %s, %v", d, err)
+	}
+	d, err = FromAD(time.Date(2024, 4, 12, 20, 0, 0, 0, time.UTC))
+	if err != nil || d != (Date{2080, 12, 30}) {
+		t.Errorf("FromAD in UTC = %s, %v", d, err)
+	}
+}
+
+func TestRange(t *testing.T) {
+	for _, ad := range []string{"1943-04-13", "1900-01-01", "2034-04-14", "2100-01-01"} {
+		if _, err := FromAD(day(ad)); !errors.Is(err, ErrOutOfRange) {
+			t.Errorf("FromAD(%s): %v", ad, err)
+		}
+	}
+	last, _ := ToAD(MaxYear, 12, Months[len(Months)-1][11])
+	if d, err := FromAD(last); err != nil || d.Year != MaxYear || d.Month != 12 {
+		t.Errorf("FromAD of the last day = %s, %v", d, err)
+	}
+	if _, err := ToAD(MinYear-1, 12, 30); !errors.Is(err, ErrOutOfRange) {
+		t.Errorf("ToAD before the table: %v", err)
+	}
+	if _, err := ToAD(MaxYear+1, 1, 1); !errors.Is(err, ErrOutOfRange) {
+		t.Errorf("ToAD after the table: %v", err)
+	}
+	if _, err := DaysInYear(MaxYear + 1); !errors.Is(err, ErrOutOfRange) {
+		t.Errorf("DaysInYear after the table: %v", err)
+	}
+}
+
+func TestParse(t *testing.T) {
+	valid := map[string]Date{
+		"2081-01-01": {2081, 1, 1},
+		"2081-2-32":  {2081, 2, 32},
+		"2081-12-31": {2081, 12, 31},
+		"2000-01-30": {2000, 1, 30},
+	}
+	for s, want := range valid {
+		if d, err := Parse(s); err != nil || d != want {
+			t.Errorf("Parse(%q) = %v, %v", s, d, err)
+		}
+	}
+
+	invalid := []string{
+		"", "2081", "2081-01", "2081-01-01-01", "81-01-01", "2081/01/01", "2081-001-01",
+		"2081-01-+1", "2081-01-1a", " 2081-01-01", "2081-13-01", "2081-00-10",
+		"2081-01-00", "2081-01-32", "2080-12-31", "2000-01-31",
+	}
+	for _, s := range invalid {
+		if _, err := Parse(s); !errors.Is(err, ErrInvalid) {
+			t.Errorf("Parse(%q): %v", s, err)
+		}
+	}
+	if _, err := Parse("1999-01-01"); !errors.Is(err, ErrOutOfRange) {
+		t.Errorf("Parse before the table: %v", err)
+	}
+}
+
+func TestFormat(t *testing.T) {
+	d := Date{2081, 2, 5}
+	if d.String() != "2081-02-05" || d.Long() != "5 Jestha 2081" {
+		t.Errorf("formats of %v: %s, %s", d, d.String(), d.Long())
+	}
+}
+
+func TestMonthBounds(t *testing.T) {
+	first, last, err := MonthBounds(2081, 2)
+	if err != nil || !first.Equal(day("2024-05-14")) || !last.Equal(day("2024-06-14")) {
+		t.Errorf("Jestha 2081 = %s to %s, %v", first, last, err)
+	}
+	// Months follow each other without gaps
+	for year := MinYear; year <= MaxYear; year++ {
+		for month := 1; month <= 12; month++ {
+			first, last, err := MonthBounds(year, month)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d, _ := FromAD(first); d != (Date{year, month, 1}) {
+				t.Fatalf("%d-%d starts on %s", year, month, d)
+			}
+			if d, _ := FromAD(last.AddDate(0, 0, 1)); d.Day != 1 && !(year == MaxYear && month == 12) {
+				t.Fatalf("%d-%d is followed by %s", year, month, d)
+			}
+		}
+	}
+	if _, _, err := MonthBounds(2081, 13); !errors.Is(err, ErrInvalid) {
+		t.Errorf("MonthBounds of month 13: %v", err)
+	}
+}
+
+func TestCalendar(t *testing.T) {
+	ad := day("2025-04-14")
+	if BS.Format(ad) != "2082-01-01" || AD.Format(ad) != "2025-04-14" {
+		t.Errorf("Format: %s, %s", BS.Format(ad), AD.Format(ad))
+	}
+	if got := BS.Format(day("1900-01-01")); got != "1900-01-01" {
+		t.Errorf("Format outside the table = %s", got)
+	}
+	if got := BS.FormatDay("2025-04-14"); got != "2082-01-01" {
+		t.Errorf("FormatDay = %s", got)
+	}
+	if got := BS.FormatDay("not a day"); got != "not a day" {
+		t.Errorf("FormatDay of garbage = %s", got)
+	}
+
+	for cal, s := range map[Calendar]string{BS: "2082-01-01", AD: "2025-04-14"} {
+		if got, err := cal.ParseDay(s); err != nil || got != "2025-04-14" {
+			t.Errorf("%s.ParseDay(%s) = %s, %v", cal, s, got, err)
+		}
+	}
+	if _, err := BS.ParseDay("2082-02-33"); err == nil {
+		t.Error("BS.ParseDay accepted Jestha 33")
+	}
+	if _, err := AD.ParseDay("2025-02-30"); err == nil {
+		t.Error("AD.ParseDay accepted 30 February")
+	}
+
+	first, last, err := AD.MonthBounds(2024, 2)
+	if err != nil || !first.Equal(day("2024-02-01")) || !last.Equal(day("2024-02-29")) {
+		t.Errorf("AD February 2024 = %s to %s, %v", first, last, err)
+	}
+	if _, _, err := AD.MonthBounds(2024, 0); err == nil {
+		t.Error("AD.MonthBounds accepted month 0")
+	}
+	// Chaitra, the last month of 2081, ends the day before 2082 starts
+	first, last, err = BS.ParseMonth("2081-12")
+	if err != nil || !first.Equal(day("2025-03-14")) || !last.Equal(day("2025-04-13")) {
+		t.Errorf("BS.ParseMonth(2081-12) = %s to %s, %v", first, last, err)
+	}
+	if first, last, err = AD.ParseMonth("2024-2"); err != nil || !first.Equal(day("2024-02-01")) || !last.Equal(day("2024-02-29")) {
+		t.Errorf("AD.ParseMonth(2024-2) = %s to %s, %v", first, last, err)
+	}
+	for _, s := range []string{"2081", "2081-13", "81-01", "2081-01-01"} {
+		if _, _, err := BS.ParseMonth(s); err == nil {
+			t.Errorf("BS.ParseMonth accepted %q", s)
+		}
+	}
+	if y, m, err := BS.MonthOf(day("2024-11-01")); err != nil || y != 2081 || m != 7 {
+		t.Errorf("BS.MonthOf = %d-%d, %v", y, m, err)
+	}
+	if y, m, _ := AD.MonthOf(day("2024-11-01")); y != 2024 || m != 11 {
+		t.Errorf("AD.MonthOf = %d-%d", y, m)
+	}
+	if !BS.Valid() || Calendar("NS").Valid() {
+		t.Error("Valid")
+	}
+}
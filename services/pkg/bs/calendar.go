@@ -0,0 +1,104 @@
+package bs
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Calendar is a calendar dates are shown in, as named by the calendar of a
+// school's academic settings
+type Calendar string
+
+// Calendars
+const (
+	AD Calendar = "AD"
+	BS Calendar = "BS"
+)
+
+// Valid reports whether c is a known calendar
+func (c Calendar) Valid() bool {
+	return c == AD || c == BS
+}
+
+// Format returns the day of t as YYYY-MM-DD in the calendar. Days the BS
+// month table does not cover are given in AD.
+func (c Calendar) Format(t time.Time) string {
+	if c == BS {
+		if d, err := FromAD(t); err == nil {
+			return d.String()
+		}
+	}
+	return t.Format(time.DateOnly)
+}
+
+// Parse reads a YYYY-MM-DD day of the calendar and returns it as midnight
+// UTC of the AD day
+func (c Calendar) Parse(s string) (time.Time, error) {
+	if c == BS {
+		d, err := Parse(s)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return d.AD(), nil
+	}
+	t, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is not a YYYY-MM-DD date", s)
+	}
+	return t, nil
+}
+
+// FormatDay converts a YYYY-MM-DD AD day, as the databases store them, into
+// the calendar. Anything else is returned as it is.
+func (c Calendar) FormatDay(day string) string {
+	t, err := time.Parse(time.DateOnly, day)
+	if err != nil {
+		return day
+	}
+	return c.Format(t)
+}
+
+// ParseDay converts a YYYY-MM-DD day of the calendar into the AD day to be
+// stored
+func (c Calendar) ParseDay(s string) (string, error) {
+	t, err := c.Parse(s)
+	if err != nil {
+		return "", err
+	}
+	return t.Format(time.DateOnly), nil
+}
+
+// MonthBounds returns the first and last AD days of month of year in the
+// calendar, for reports by month
+func (c Calendar) MonthBounds(year, month int) (first, last time.Time, err error) {
+	if c == BS {
+		return MonthBounds(year, month)
+	}
+	if month < 1 || month > 12 {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid month %d", month)
+	}
+	first = time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC)
+	return first, first.AddDate(0, 1, -1), nil
+}
+
+// ParseMonth reads a YYYY-MM month of the calendar and returns its first and
+// last AD days
+func (c Calendar) ParseMonth(s string) (first, last time.Time, err error) {
+	y, m, ok := strings.Cut(s, "-")
+	year, ok1 := number(y, 4, 4)
+	month, ok2 := number(m, 1, 2)
+	if !ok || !ok1 || !ok2 {
+		return time.Time{}, time.Time{}, fmt.Errorf("%w: %q is not YYYY-MM", ErrInvalid, s)
+	}
+	return c.MonthBounds(year, month)
+}
+
+// MonthOf returns the year and month of the calendar that the day of t is in
+func (c Calendar) MonthOf(t time.Time) (year, month int, err error) {
+	if c == BS {
+		d, err := FromAD(t)
+		return d.Year, d.Month, err
+	}
+	return t.Year(), int(t.Month()), nil
+}
@@ -0,0 +1,71 @@
+// Package cache keeps what the services read from the main database, such
+// as schools' settings and plans, for a while.
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+// TTL caches values by key for ttl or until they are invalidated. Values
+// are fetched by the caller on a miss; a fetch that raced an invalidation is
+// returned but not cached, so a stale value is never kept.
+type TTL[K comparable, V any] struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[K]entry[V]
+	// gen counts invalidations, so a fetch that raced one is not cached
+	gen uint64
+}
+
+type entry[V any] struct {
+	value   V
+	expires time.Time
+}
+
+// NewTTL returns an empty cache of values kept for ttl
+func NewTTL[K comparable, V any](ttl time.Duration) *TTL[K, V] {
+	return &TTL[K, V]{ttl: ttl, entries: make(map[K]entry[V])}
+}
+
+// Get returns the cached value of key, or the one fetch returns when there
+// is none or it expired
+func (c *TTL[K, V]) Get(key K, fetch func() (V, error)) (V, error) {
+	now := time.Now()
+
+	c.mu.Lock()
+	e, ok := c.entries[key]
+	gen := c.gen
+	c.mu.Unlock()
+	if ok && now.Before(e.expires) {
+		return e.value, nil
+	}
+
+	v, err := fetch()
+	if err != nil {
+		return v, err
+	}
+	c.mu.Lock()
+	if c.gen == gen {
+		c.entries[key] = entry[V]{value: v, expires: now.Add(c.ttl)}
+	}
+	c.mu.Unlock()
+	return v, nil
+}
+
+// Invalidate drops the value of key
+func (c *TTL[K, V]) Invalidate(key K) {
+	c.mu.Lock()
+	delete(c.entries, key)
+	c.gen++
+	c.mu.Unlock()
+}
+
+// Clear drops every value
+func (c *TTL[K, V]) Clear() {
+	c.mu.Lock()
+	c.entries = make(map[K]entry[V])
+	c.gen++
+	c.mu.Unlock()
+}
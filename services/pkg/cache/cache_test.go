@@ -0,0 +1,64 @@
+package cache
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTTL(t *testing.T) {
+	c := NewTTL[string, int](time.Hour)
+	fetches := 0
+	fetch := func(v int) func() (int, error) {
+		return func() (int, error) {
+			fetches++
+			return v, nil
+		}
+	}
+
+	if v, _ := c.Get("a", fetch(1)); v != 1 {
+		t.Errorf("Get() = %d, want 1", v)
+	}
+	if v, _ := c.Get("a", fetch(2)); v != 1 || fetches != 1 {
+		t.Errorf("cached Get() = %d after %d fetches, want 1 after 1", v, fetches)
+	}
+	c.Invalidate("a")
+	if v, _ := c.Get("a", fetch(3)); v != 3 {
+		t.Errorf("Get() after Invalidate = %d, want 3", v)
+	}
+	c.Clear()
+	if v, _ := c.Get("a", fetch(4)); v != 4 {
+		t.Errorf("Get() after Clear = %d, want 4", v)
+	}
+
+	// Errors are not cached
+	if _, err := c.Get("b", func() (int, error) { return 0, errors.New("down") }); err == nil {
+		t.Error("Get() error = nil, want the fetch's")
+	}
+	if v, _ := c.Get("b", fetch(5)); v != 5 {
+		t.Errorf("Get() after an error = %d, want 5", v)
+	}
+}
+
+func TestTTLExpires(t *testing.T) {
+	c := NewTTL[string, int](0)
+	c.Get("a", func() (int, error) { return 1, nil })
+	if v, _ := c.Get("a", func() (int, error) { return 2, nil }); v != 2 {
+		t.Errorf("Get() of an expired value = %d, want 2", v)
+	}
+}
+
+// A fetch that raced an invalidation is returned but not kept
+func TestTTLInvalidatedDuringFetch(t *testing.T) {
+	c := NewTTL[string, int](time.Hour)
+	v, _ := c.Get("a", func() (int, error) {
+		c.Invalidate("a")
+		return 1, nil
+	})
+	if v != 1 {
+		t.Errorf("Get() = %d, want 1", v)
+	}
+	if v, _ := c.Get("a", func() (int, error) { return 2, nil }); v != 2 {
+		t.Errorf("Get() after a raced fetch = %d, want 2", v)
+	}
+}
@@ -0,0 +1,257 @@
+// Package calendar keeps schools' holiday and working-day calendars. A
+// school works on the days of the working week of its academic settings,
+// except on the holidays and weekly offs it records; exam days and extra
+// working days open days it would otherwise be closed. Events may apply to
+// some classes only. Events are kept in the main database and read by the
+// services through a Client.
+package calendar
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DateLayout is the layout of the dates of events
+const DateLayout = "2006-01-02"
+
+// Kinds of events
+const (
+	KindHoliday    = "holiday"     // public holiday or vacation; closed
+	KindWeeklyOff  = "weekly_off"  // closed on its weekdays between its dates
+	KindEvent      = "event"       // school event; leaves the day as it is
+	KindExam       = "exam"        // exam days; open
+	KindWorkingDay = "working_day" // open, such as a Saturday making up a lost day
+)
+
+// Kinds lists the kinds of events
+var Kinds = []string{KindHoliday, KindWeeklyOff, KindEvent, KindExam, KindWorkingDay}
+
+// MaxSpanDays bounds the length of events and of the ranges days are
+// counted over
+const MaxSpanDays = 400
+
+// Errors of the store; store errors other than these are the database's
+var (
+	ErrUnknownEvent = errors.New("unknown calendar event")
+	ErrInvalid      = errors.New("invalid calendar event")
+)
+
+// Event is a holiday, weekly off, school event, exam or extra working day
+// of a school. It applies to the classes in ClassIDs, or to the whole school
+// when there are none.
+type Event struct {
+	ID          string    `json:"id"`
+	SchoolID    string    `json:"school_id"`
+	UID         string    `json:"uid"`
+	Kind        string    `json:"kind"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	StartDate   string    `json:"start_date"`
+	EndDate     string    `json:"end_date"`
+	Weekdays    []string  `json:"weekdays"`
+	ClassIDs    []string  `json:"class_ids"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// covers reports whether the event falls on day, formatted with DateLayout,
+// which is a weekday
+func (e *Event) covers(day string, weekday time.Weekday) bool {
+	if day < e.StartDate || day > e.EndDate {
+		return false
+	}
+	if e.Kind != KindWeeklyOff {
+		return true
+	}
+	for _, d := range e.Weekdays {
+		if d == weekdayName(weekday) {
+			return true
+		}
+	}
+	return false
+}
+
+// AppliesTo reports whether the event applies to the class. Only events of
+// the whole school apply to an empty class ID.
+func (e *Event) AppliesTo(classID string) bool {
+	if len(e.ClassIDs) == 0 {
+		return true
+	}
+	for _, id := range e.ClassIDs {
+		if id == classID {
+			return true
+		}
+	}
+	return false
+}
+
+// EventInput creates or replaces an event. EndDate defaults to StartDate.
+type EventInput struct {
+	Kind        string   `json:"kind" validate:"required,oneof=holiday weekly_off event exam working_day"`
+	Title       string   `json:"title" validate:"required,max=255"`
+	Description string   `json:"description" validate:"max=2000"`
+	StartDate   string   `json:"start_date" validate:"required,datetime=2006-01-02"`
+	EndDate     string   `json:"end_date" validate:"omitempty,datetime=2006-01-02"`
+	Weekdays    []string `json:"weekdays" validate:"max=7,unique,dive,oneof=sunday monday tuesday wednesday thursday friday saturday" doc:"Days of the week off, for weekly offs only"`
+	ClassIDs    []string `json:"class_ids" validate:"max=200,unique,dive,required,max=64" doc:"Classes the event applies to; the whole school when empty"`
+	UID         string   `json:"uid" validate:"omitempty,max=255" doc:"iCalendar UID; imports replace the event with the same UID"`
+}
+
+// Check reports whether the event's dates and weekdays are consistent: it
+// ends after it starts and within MaxSpanDays, and only weekly offs have
+// weekdays, which they must. Errors wrap ErrInvalid.
+func (in *EventInput) Check() error {
+	if in.EndDate == "" {
+		in.EndDate = in.StartDate
+	}
+	start, err := time.Parse(DateLayout, in.StartDate)
+	if err != nil {
+		return fmt.Errorf("%w: start date %q is not a date", ErrInvalid, in.StartDate)
+	}
+	end, err := time.Parse(DateLayout, in.EndDate)
+	if err != nil {
+		return fmt.Errorf("%w: end date %q is not a date", ErrInvalid, in.EndDate)
+	}
+	if end.Before(start) {
+		return fmt.Errorf("%w: it ends before it starts", ErrInvalid)
+	}
+	if end.Sub(start) >= MaxSpanDays*24*time.Hour {
+		return fmt.Errorf("%w: an event may last at most %d days", ErrInvalid, MaxSpanDays)
+	}
+	switch {
+	case in.Kind == KindWeeklyOff && len(in.Weekdays) == 0:
+		return fmt.Errorf("%w: a weekly off needs the weekdays it falls on", ErrInvalid)
+	case in.Kind != KindWeeklyOff && len(in.Weekdays) > 0:
+		return fmt.Errorf("%w: only weekly offs have weekdays", ErrInvalid)
+	}
+	if in.Weekdays == nil {
+		in.Weekdays = []string{}
+	}
+	if in.ClassIDs == nil {
+		in.ClassIDs = []string{}
+	}
+	return nil
+}
+
+// Calendar answers which days a school works: the days of its working week,
+// unless the events of the day say otherwise
+type Calendar struct {
+	week   [7]bool
+	events []Event
+}
+
+// New returns the calendar of a school working on workingDays, the
+// lower-case weekday names of settings.Academic, with events
+func New(workingDays []string, events []Event) *Calendar {
+	cal := &Calendar{events: events}
+	for _, name := range workingDays {
+		for d := time.Sunday; d <= time.Saturday; d++ {
+			if weekdayName(d) == name {
+				cal.week[d] = true
+			}
+		}
+	}
+	return cal
+}
+
+func weekdayName(d time.Weekday) string {
+	return strings.ToLower(d.String())
+}
+
+// IsWorkingDay reports whether the class, or with an empty ID the whole
+// school, works on the day of t. The events of the class take precedence
+// over those of the school; among events of either, an exam or extra
+// working day opens a holiday or weekly off. A day without events follows
+// the working week.
+func (cal *Calendar) IsWorkingDay(classID string, t time.Time) bool {
+	day := t.Format(DateLayout)
+	var open, closed [2]bool // of the school, and of the class
+	for i := range cal.events {
+		e := &cal.events[i]
+		if !e.AppliesTo(classID) || !e.covers(day, t.Weekday()) {
+			continue
+		}
+		scope := 0
+		if len(e.ClassIDs) > 0 {
+			scope = 1
+		}
+		switch e.Kind {
+		case KindExam, KindWorkingDay:
+			open[scope] = true
+		case KindHoliday, KindWeeklyOff:
+			closed[scope] = true
+		}
+	}
+	for scope := 1; scope >= 0; scope-- {
+		if open[scope] {
+			return true
+		}
+		if closed[scope] {
+			return false
+		}
+	}
+	return cal.week[t.Weekday()]
+}
+
+// WorkingDaysBetween counts the days from the day of from to the day of to,
+// both included, that the class works
+func (cal *Calendar) WorkingDaysBetween(classID string, from, to time.Time) int {
+	n := 0
+	for d := civil(from); !d.After(civil(to)); d = d.AddDate(0, 0, 1) {
+		if cal.IsWorkingDay(classID, d) {
+			n++
+		}
+	}
+	return n
+}
+
+// NextWorkingDay returns the first day from the day of t on that the class
+// works, such as the day a fee falling due on a holiday is due. Calendars
+// without a working day in the year after t return the day of t.
+func (cal *Calendar) NextWorkingDay(classID string, t time.Time) time.Time {
+	start := civil(t)
+	for d, i := start, 0; i <= 366; d, i = d.AddDate(0, 0, 1), i+1 {
+		if cal.IsWorkingDay(classID, d) {
+			return d
+		}
+	}
+	return start
+}
+
+// Day is a day of a calendar with the events falling on it
+type Day struct {
+	Date    string     `json:"date"`
+	Working bool       `json:"working"`
+	Events  []DayEvent `json:"events"`
+}
+
+// DayEvent is an event falling on a Day
+type DayEvent struct {
+	ID    string `json:"id"`
+	Kind  string `json:"kind"`
+	Title string `json:"title"`
+}
+
+// Days returns the days from the day of from to the day of to, both
+// included, as the class sees them
+func (cal *Calendar) Days(classID string, from, to time.Time) []Day {
+	days := []Day{}
+	for d := civil(from); !d.After(civil(to)); d = d.AddDate(0, 0, 1) {
+		day := Day{Date: d.Format(DateLayout), Working: cal.IsWorkingDay(classID, d), Events: []DayEvent{}}
+		for i := range cal.events {
+			if e := &cal.events[i]; e.AppliesTo(classID) && e.covers(day.Date, d.Weekday()) {
+				day.Events = append(day.Events, DayEvent{ID: e.ID, Kind: e.Kind, Title: e.Title})
+			}
+		}
+		days = append(days, day)
+	}
+	return days
+}
+
+// civil returns midnight UTC of the day of t where t is
+func civil(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,165 @@
+package calendar
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"school-erp/pkg/cache"
+)
+
+func day(s string) time.Time {
+	t, err := time.Parse(DateLayout, s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// week is Nepal's: Sunday to Friday
+var week = []string{"sunday", "monday", "tuesday", "wednesday", "thursday", "friday"}
+
+func TestIsWorkingDay(t *testing.T) {
+	cal := New(week, []Event{
+		{ID: "dashain", Kind: KindHoliday, Title: "Dashain", StartDate: "2025-09-28", EndDate: "2025-10-06"},
+		{ID: "winter", Kind: KindWeeklyOff, Title: "Winter Fridays", StartDate: "2025-12-01", EndDate: "2026-01-31", Weekdays: []string{"friday"}},
+		{ID: "sports", Kind: KindEvent, Title: "Sports day", StartDate: "2025-11-14", EndDate: "2025-11-14"},
+		{ID: "makeup", Kind: KindWorkingDay, Title: "Make-up day", StartDate: "2025-10-11", EndDate: "2025-10-11"},
+		{ID: "see", Kind: KindExam, Title: "Pre-board", StartDate: "2025-10-03", EndDate: "2025-10-04", ClassIDs: []string{"10"}},
+		{ID: "trip", Kind: KindHoliday, Title: "Grade 9 trip", StartDate: "2025-10-11", EndDate: "2025-10-11", ClassIDs: []string{"9"}},
+	})
+
+	cases := []struct {
+		class, day string
+		want       bool
+	}{
+		{"", "2025-09-26", true},    // Friday
+		{"", "2025-09-27", false},   // Saturday
+		{"", "2025-09-29", false},   // Dashain
+		{"10", "2025-09-29", false}, // Dashain applies to every class
+		{"10", "2025-10-03", true},  // exams of grade 10 over Dashain
+		{"10", "2025-10-04", true},  // and on a Saturday
+		{"9", "2025-10-03", false},  // but not of grade 9
+		{"", "2025-10-03", false},   // nor the school
+		{"", "2025-10-11", true},    // Saturday made a working day
+		{"9", "2025-10-11", false},  // except for grade 9, away on a trip
+		{"", "2025-11-14", true},    // events leave the day as it is
+		{"", "2025-12-05", false},   // a winter Friday
+		{"", "2025-12-04", true},    // a winter Thursday
+		{"", "2026-02-06", true},    // a Friday after the winter
+	}
+	for _, tc := range cases {
+		if got := cal.IsWorkingDay(tc.class, day(tc.day)); got != tc.want {
+			t.Errorf("IsWorkingDay(%q, %s) = %v", tc.class, tc.day, got)
+		}
+	}
+
+	// The day is of the time's own zone
+	kathmandu := time.FixedZone("NPT", 5*3600+45*60)
+	if !cal.IsWorkingDay("", time.Date(2025, 9, 26, 23, 0, 0, 0, kathmandu)) {
+		t.Error("Friday night in Kathmandu is not a working day")
+	}
+}
+
+func TestWorkingDaysBetween(t *testing.T) {
+	cal := New(week, []Event{
+		{Kind: KindHoliday, Title: "Tihar", StartDate: "2025-10-20", EndDate: "2025-10-23"},
+	})
+	// 19-25 October 2025 is Sunday to Saturday
+	if n := cal.WorkingDaysBetween("", day("2025-10-19"), day("2025-10-25")); n != 2 {
+		t.Errorf("working days of Tihar week = %d", n)
+	}
+	if n := cal.WorkingDaysBetween("", day("2025-10-05"), day("2025-10-11")); n != 6 {
+		t.Errorf("working days of a plain week = %d", n)
+	}
+	if n := cal.WorkingDaysBetween("", day("2025-10-24"), day("2025-10-24")); n != 1 {
+		t.Errorf("working days of one Friday = %d", n)
+	}
+	if n := cal.WorkingDaysBetween("", day("2025-10-25"), day("2025-10-24")); n != 0 {
+		t.Errorf("working days of an empty range = %d", n)
+	}
+}
+
+func TestNextWorkingDay(t *testing.T) {
+	cal := New(week, []Event{
+		{Kind: KindHoliday, Title: "Tihar", StartDate: "2025-10-20", EndDate: "2025-10-23"},
+	})
+	for from, want := range map[string]string{
+		"2025-10-19": "2025-10-19",
+		"2025-10-20": "2025-10-24",
+		"2025-10-25": "2025-10-26",
+	} {
+		if got := cal.NextWorkingDay("", day(from)); !got.Equal(day(want)) {
+			t.Errorf("NextWorkingDay(%s) = %s", from, got.Format(DateLayout))
+		}
+	}
+	if got := New(nil, nil).NextWorkingDay("", day("2025-10-20")); !got.Equal(day("2025-10-20")) {
+		t.Errorf("NextWorkingDay without working days = %s", got.Format(DateLayout))
+	}
+}
+
+func TestDays(t *testing.T) {
+	cal := New(week, []Event{
+		{ID: "1", Kind: KindEvent, Title: "Parents' day", StartDate: "2025-10-24", EndDate: "2025-10-24"},
+		{ID: "2", Kind: KindExam, Title: "Unit test", StartDate: "2025-10-24", EndDate: "2025-10-24", ClassIDs: []string{"5"}},
+	})
+	days := cal.Days("", day("2025-10-24"), day("2025-10-25"))
+	if len(days) != 2 || !days[0].Working || days[1].Working || len(days[0].Events) != 1 || len(days[1].Events) != 0 {
+		t.Errorf("days of the school: %+v", days)
+	}
+	if days := cal.Days("5", day("2025-10-24"), day("2025-10-24")); len(days[0].Events) != 2 {
+		t.Errorf("days of class 5: %+v", days)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	valid := EventInput{Kind: KindHoliday, Title: "Dashain", StartDate: "2025-09-28"}
+	if err := valid.Check(); err != nil || valid.EndDate != "2025-09-28" || valid.ClassIDs == nil || valid.Weekdays == nil {
+		t.Fatalf("valid event: %+v, %v", valid, err)
+	}
+
+	cases := map[string]func(in *EventInput){
+		"not a date":            func(in *EventInput) { in.StartDate = "2025-02-30" },
+		"ends before starts":    func(in *EventInput) { in.EndDate = "2025-09-27" },
+		"too long":              func(in *EventInput) { in.EndDate = "2026-12-01" },
+		"weekdays of a holiday": func(in *EventInput) { in.Weekdays = []string{"friday"} },
+		"weekly off without days": func(in *EventInput) {
+			in.Kind = KindWeeklyOff
+		},
+	}
+	for name, change := range cases {
+		in := valid
+		change(&in)
+		if err := in.Check(); !errors.Is(err, ErrInvalid) {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+}
+
+func TestClient(t *testing.T) {
+	fetches := 0
+	events := map[string][]Event{"1": {{ID: "a", Kind: KindHoliday, Title: "Dashain", StartDate: "2025-09-28", EndDate: "2025-10-06"}}}
+	c := &Client{
+		cache: cache.NewTTL[string, []Event](time.Minute),
+		fetch: func(_ context.Context, schoolID string) ([]Event, error) {
+			fetches++
+			return events[schoolID], nil
+		},
+	}
+	ctx := context.Background()
+
+	if got, err := c.Events(ctx, "1"); err != nil || len(got) != 1 {
+		t.Fatalf("Events = %+v, %v", got, err)
+	}
+	events["1"] = nil
+	if got, _ := c.Events(ctx, "1"); len(got) != 1 || fetches != 1 {
+		t.Fatalf("cached events: %d after %d fetches", len(got), fetches)
+	}
+	event, _ := json.Marshal(CalendarChanged{SchoolID: "1"})
+	c.HandleEvent(event)
+	if got, _ := c.Events(ctx, "1"); len(got) != 0 || fetches != 2 {
+		t.Fatalf("events after the change: %d after %d fetches", len(got), fetches)
+	}
+}
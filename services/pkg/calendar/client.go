@@ -0,0 +1,95 @@
+package calendar
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"school-erp/pkg/cache"
+	"school-erp/pkg/settings"
+)
+
+// Client reads schools' calendars for the services, which count attendance
+// and fee due dates by working days. A school's events are cached for ttl
+// or until a CalendarChanged event for the school is passed to
+// HandleEvent; its working week is read with prefs.
+type Client struct {
+	fetch func(ctx context.Context, schoolID string) ([]Event, error)
+	prefs *settings.Client
+	cache *cache.TTL[string, []Event]
+}
+
+// NewClient creates a client reading the main database
+func NewClient(db *pgxpool.Pool, prefs *settings.Client, ttl time.Duration) *Client {
+	store := NewStore(db, nil)
+	fetch := func(ctx context.Context, schoolID string) ([]Event, error) {
+		return store.List(ctx, schoolID, "", "")
+	}
+	return &Client{fetch: fetch, prefs: prefs, cache: cache.NewTTL[string, []Event](ttl)}
+}
+
+// Events returns the school's events in order of their start. The slice is
+// shared; callers must not change it.
+func (c *Client) Events(ctx context.Context, schoolID string) ([]Event, error) {
+	return c.cache.Get(schoolID, func() ([]Event, error) {
+		return c.fetch(ctx, schoolID)
+	})
+}
+
+// Calendar returns the school's calendar: the working week of its academic
+// settings and its events
+func (c *Client) Calendar(ctx context.Context, schoolID string) (*Calendar, error) {
+	var week settings.Academic
+	if err := c.prefs.Load(ctx, schoolID, &week); err != nil {
+		return nil, err
+	}
+	events, err := c.Events(ctx, schoolID)
+	if err != nil {
+		return nil, err
+	}
+	return New(week.WorkingDays, events), nil
+}
+
+// IsWorkingDay reports whether the class of the school, or with an empty
+// ID the whole school, works on the day of t
+func (c *Client) IsWorkingDay(ctx context.Context, schoolID, classID string, t time.Time) (bool, error) {
+	cal, err := c.Calendar(ctx, schoolID)
+	if err != nil {
+		return false, err
+	}
+	return cal.IsWorkingDay(classID, t), nil
+}
+
+// WorkingDaysBetween counts the days from the day of from to the day of to,
+// both included, that the class of the school works
+func (c *Client) WorkingDaysBetween(ctx context.Context, schoolID, classID string, from, to time.Time) (int, error) {
+	cal, err := c.Calendar(ctx, schoolID)
+	if err != nil {
+		return 0, err
+	}
+	return cal.WorkingDaysBetween(classID, from, to), nil
+}
+
+// Invalidate drops the cached events of the school, or with an empty ID of
+// every school
+func (c *Client) Invalidate(schoolID string) {
+	if schoolID == "" {
+		c.cache.Clear()
+	} else {
+		c.cache.Invalidate(schoolID)
+	}
+}
+
+// HandleEvent invalidates the events of the school named by a
+// CalendarChanged message; malformed ones are logged
+func (c *Client) HandleEvent(data []byte) {
+	var e CalendarChanged
+	if err := json.Unmarshal(data, &e); err != nil {
+		log.Printf("Invalid %s event: %v\n", SubjectCalendarChanged, err)
+		return
+	}
+	c.Invalidate(e.SchoolID)
+}
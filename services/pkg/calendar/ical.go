@@ -0,0 +1,445 @@
+package calendar
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ContentType is the media type of iCalendar documents
+const ContentType = "text/calendar"
+
+// icalClasses is the property carrying the classes an event applies to,
+// which iCalendar has no property for
+const icalClasses = "X-SCHOOL-ERP-CLASSES"
+
+const icalDate = "20060102"
+
+// icalDays are the iCalendar names of the weekdays, from Sunday
+var icalDays = [7]string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+// Encode writes the events as an iCalendar (RFC 5545) document named name.
+// Events are all-day; the kind is the event's category, and weekly offs
+// recur weekly on their weekdays.
+func Encode(w io.Writer, name string, events []Event) error {
+	bw := bufio.NewWriter(w)
+	line := func(s string) {
+		// Lines are folded at 75 octets, between characters; continuation
+		// lines start with a space
+		for limit := 75; len(s) > limit; limit = 74 {
+			n := limit
+			for !utf8.RuneStart(s[n]) {
+				n--
+			}
+			bw.WriteString(s[:n] + "\r\n ")
+			s = s[n:]
+		}
+		bw.WriteString(s + "\r\n")
+	}
+
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//School ERP//School Calendar//EN")
+	line("CALSCALE:GREGORIAN")
+	line("X-WR-CALNAME:" + escapeText(name))
+	for i := range events {
+		e := &events[i]
+		start, err := time.Parse(DateLayout, e.StartDate)
+		if err != nil {
+			return fmt.Errorf("event %s: %w", e.ID, err)
+		}
+		end, err := time.Parse(DateLayout, e.EndDate)
+		if err != nil {
+			return fmt.Errorf("event %s: %w", e.ID, err)
+		}
+		var rule string
+		if e.Kind == KindWeeklyOff {
+			days := make([]string, 0, len(e.Weekdays))
+			for d := time.Sunday; d <= time.Saturday; d++ {
+				for _, name := range e.Weekdays {
+					if name == weekdayName(d) {
+						days = append(days, icalDays[d])
+					}
+				}
+			}
+			// The first instance is the first of its weekdays
+			for !e.covers(start.Format(DateLayout), start.Weekday()) && start.Before(end) {
+				start = start.AddDate(0, 0, 1)
+			}
+			rule = "FREQ=WEEKLY;BYDAY=" + strings.Join(days, ",") + ";UNTIL=" + end.Format(icalDate)
+			end = start
+		}
+
+		line("BEGIN:VEVENT")
+		line("UID:" + escapeText(e.UID))
+		line("DTSTAMP:" + e.UpdatedAt.UTC().Format("20060102T150405Z"))
+		line("DTSTART;VALUE=DATE:" + start.Format(icalDate))
+		// All-day events end the day after their last
+		line("DTEND;VALUE=DATE:" + end.AddDate(0, 0, 1).Format(icalDate))
+		if rule != "" {
+			line("RRULE:" + rule)
+		}
+		line("SUMMARY:" + escapeText(e.Title))
+		if e.Description != "" {
+			line("DESCRIPTION:" + escapeText(e.Description))
+		}
+		line("CATEGORIES:" + strings.ToUpper(e.Kind))
+		if len(e.ClassIDs) > 0 {
+			line(icalClasses + ":" + strings.Join(e.ClassIDs, ","))
+		}
+		line("TRANSP:TRANSPARENT")
+		line("END:VEVENT")
+	}
+	line("END:VCALENDAR")
+	return bw.Flush()
+}
+
+// Decode reads the events of an iCalendar document, such as a feed of
+// public holidays or a calendar written by Encode. An event is a holiday
+// unless its categories name another kind; an event recurring weekly is a
+// weekly off. Events without a UID are given one made of their contents,
+// so that importing them again replaces them. Cancelled events are
+// skipped. Errors wrap ErrInvalid.
+func Decode(r io.Reader) ([]EventInput, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+
+	events := []EventInput{}
+	var cur *icalEvent
+	depth, calendars := 0, 0
+	for n, l := range lines {
+		name, params, value, ok := parseLine(l)
+		if !ok {
+			return nil, fmt.Errorf("%w: line %d is not an iCalendar property", ErrInvalid, n+1)
+		}
+		switch {
+		case name == "BEGIN":
+			depth++
+			switch {
+			case strings.EqualFold(value, "VCALENDAR") && depth == 1:
+				calendars++
+			case strings.EqualFold(value, "VEVENT") && depth == 2:
+				cur = &icalEvent{line: n + 1}
+			}
+		case name == "END":
+			if depth == 2 && cur != nil {
+				in, skip, err := cur.input()
+				if err != nil {
+					return nil, err
+				}
+				if !skip {
+					events = append(events, in)
+				}
+				cur = nil
+			}
+			depth--
+		case cur != nil && depth == 2:
+			// Properties of nested components, such as alarms, are left out
+			if err := cur.set(name, params, value); err != nil {
+				return nil, fmt.Errorf("%w: line %d: %v", ErrInvalid, n+1, err)
+			}
+		}
+	}
+	if calendars == 0 {
+		return nil, fmt.Errorf("%w: not an iCalendar document", ErrInvalid)
+	}
+	if depth != 0 {
+		return nil, fmt.Errorf("%w: the document ends inside a component", ErrInvalid)
+	}
+	return events, nil
+}
+
+// unfold returns the content lines of the document, joining folded ones
+func unfold(r io.Reader) ([]string, error) {
+	var lines []string
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	for sc.Scan() {
+		l := strings.TrimRight(sc.Text(), "\r")
+		switch {
+		case l == "":
+		case (l[0] == ' ' || l[0] == '\t') && len(lines) > 0:
+			lines[len(lines)-1] += l[1:]
+		default:
+			lines = append(lines, l)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	return lines, nil
+}
+
+// parseLine splits a content line into its upper-case name, its parameters
+// and its value. Quoted parameter values may hold colons and semicolons.
+func parseLine(l string) (name string, params map[string]string, value string, ok bool) {
+	quoted := false
+	colon := -1
+	for i := 0; i < len(l) && colon < 0; i++ {
+		switch l[i] {
+		case '"':
+			quoted = !quoted
+		case ':':
+			if !quoted {
+				colon = i
+			}
+		}
+	}
+	if colon <= 0 {
+		return "", nil, "", false
+	}
+	parts := strings.Split(l[:colon], ";")
+	params = make(map[string]string, len(parts)-1)
+	for _, p := range parts[1:] {
+		k, v, _ := strings.Cut(p, "=")
+		params[strings.ToUpper(k)] = strings.Trim(v, `"`)
+	}
+	return strings.ToUpper(parts[0]), params, l[colon+1:], true
+}
+
+// icalEvent collects the properties of a VEVENT
+type icalEvent struct {
+	line                     int
+	uid, summary, desc       string
+	start, end               time.Time
+	endExclusive, hasEnd     bool
+	duration                 int
+	categories, classes      []string
+	rule                     map[string]string
+	cancelled, hasExceptions bool
+}
+
+func (e *icalEvent) set(name string, params map[string]string, value string) error {
+	var err error
+	switch name {
+	case "UID":
+		e.uid = unescapeText(value)
+	case "SUMMARY":
+		e.summary = unescapeText(value)
+	case "DESCRIPTION":
+		e.desc = unescapeText(value)
+	case "DTSTART":
+		e.start, _, err = parseDate(params, value)
+	case "DTEND":
+		var allDay bool
+		e.end, allDay, err = parseDate(params, value)
+		// All-day events end the day after their last, and so do events
+		// ending at midnight
+		e.endExclusive = allDay || strings.Contains(value, "T000000")
+		e.hasEnd = true
+	case "DURATION":
+		e.duration, err = parseDuration(value)
+	case "CATEGORIES":
+		e.categories = append(e.categories, splitText(value)...)
+	case icalClasses:
+		for _, id := range strings.Split(value, ",") {
+			if id = strings.TrimSpace(id); id != "" {
+				e.classes = append(e.classes, id)
+			}
+		}
+	case "RRULE":
+		e.rule = make(map[string]string)
+		for _, part := range strings.Split(value, ";") {
+			k, v, _ := strings.Cut(part, "=")
+			e.rule[strings.ToUpper(k)] = strings.ToUpper(v)
+		}
+	case "RDATE", "EXDATE":
+		e.hasExceptions = true
+	case "STATUS":
+		e.cancelled = strings.EqualFold(value, "CANCELLED")
+	}
+	return err
+}
+
+// input returns the event as an EventInput, or skip for cancelled events
+func (e *icalEvent) input() (in EventInput, skip bool, err error) {
+	fail := func(format string, args ...any) (EventInput, bool, error) {
+		return EventInput{}, false, fmt.Errorf("%w: event at line %d: %s", ErrInvalid, e.line, fmt.Sprintf(format, args...))
+	}
+	if e.cancelled {
+		return EventInput{}, true, nil
+	}
+	if e.start.IsZero() {
+		return fail("no DTSTART")
+	}
+	if e.summary == "" {
+		return fail("no SUMMARY")
+	}
+
+	end := e.start
+	switch {
+	case e.hasEnd && e.endExclusive && e.end.After(e.start):
+		end = e.end.AddDate(0, 0, -1)
+	case e.hasEnd && e.end.After(e.start):
+		end = e.end
+	case e.duration > 1:
+		end = e.start.AddDate(0, 0, e.duration-1)
+	}
+
+	in = EventInput{Kind: KindHoliday, Title: e.summary, Description: e.desc, ClassIDs: e.classes, UID: e.uid}
+	for _, c := range e.categories {
+		kind := strings.ToLower(strings.NewReplacer(" ", "_", "-", "_").Replace(strings.TrimSpace(c)))
+		if isKind(kind) {
+			in.Kind = kind
+			break
+		}
+	}
+
+	if e.rule != nil {
+		if e.hasExceptions {
+			return fail("recurrence exceptions are not supported")
+		}
+		if e.rule["FREQ"] != "WEEKLY" || (e.rule["INTERVAL"] != "" && e.rule["INTERVAL"] != "1") {
+			return fail("only weekly recurrences are supported")
+		}
+		in.Kind = KindWeeklyOff
+		in.Weekdays, err = ruleWeekdays(e.rule["BYDAY"], e.start.Weekday())
+		if err != nil {
+			return fail("%v", err)
+		}
+		switch until, count := e.rule["UNTIL"], e.rule["COUNT"]; {
+		case until != "":
+			if len(until) < 8 {
+				return fail("UNTIL %q is not a date", until)
+			}
+			if end, err = time.Parse(icalDate, until[:8]); err != nil {
+				return fail("UNTIL %q is not a date", until)
+			}
+		case count != "":
+			n, err := strconv.Atoi(count)
+			if err != nil || n < 1 {
+				return fail("COUNT %q is not a number", count)
+			}
+			// Each week holds one instance of each weekday
+			weeks := (n + len(in.Weekdays) - 1) / len(in.Weekdays)
+			end = e.start.AddDate(0, 0, weeks*7-1)
+		default:
+			// Weekly offs without an end last a year
+			end = e.start.AddDate(1, 0, -1)
+		}
+	}
+
+	in.StartDate = e.start.Format(DateLayout)
+	in.EndDate = end.Format(DateLayout)
+	if in.UID == "" {
+		sum := sha1.Sum([]byte(in.Kind + "\n" + in.Title + "\n" + in.StartDate + "\n" + in.EndDate))
+		in.UID = hex.EncodeToString(sum[:]) + "@import"
+	}
+	if err := in.Check(); err != nil {
+		return fail("%v", err)
+	}
+	return in, false, nil
+}
+
+func isKind(kind string) bool {
+	for _, k := range Kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// ruleWeekdays returns the weekday names of a BYDAY rule part, or of the
+// day the event starts without one
+func ruleWeekdays(byDay string, start time.Weekday) ([]string, error) {
+	if byDay == "" {
+		return []string{weekdayName(start)}, nil
+	}
+	var days []string
+	for _, code := range strings.Split(byDay, ",") {
+		found := false
+		for d, name := range icalDays {
+			if code == name {
+				days, found = append(days, weekdayName(time.Weekday(d))), true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("BYDAY %q is not a weekday", code)
+		}
+	}
+	return days, nil
+}
+
+// parseDate returns the day of a DATE or DATE-TIME value and whether it is
+// a DATE. Times are taken in the zone they are written in.
+func parseDate(params map[string]string, value string) (time.Time, bool, error) {
+	allDay := params["VALUE"] == "DATE" || len(value) == len(icalDate)
+	if len(value) < len(icalDate) {
+		return time.Time{}, false, fmt.Errorf("%q is not a date", value)
+	}
+	t, err := time.Parse(icalDate, value[:len(icalDate)])
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("%q is not a date", value)
+	}
+	return t, allDay, nil
+}
+
+// parseDuration returns the days of a DURATION value such as P1D or P2W;
+// durations of hours or less are a day
+func parseDuration(value string) (int, error) {
+	v := strings.TrimPrefix(strings.TrimPrefix(value, "+"), "P")
+	v, _, _ = strings.Cut(v, "T")
+	if v == "" {
+		return 1, nil
+	}
+	unit := v[len(v)-1]
+	n, err := strconv.Atoi(v[:len(v)-1])
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%q is not a duration", value)
+	}
+	switch unit {
+	case 'D':
+		return n, nil
+	case 'W':
+		return n * 7, nil
+	}
+	return 0, fmt.Errorf("%q is not a duration", value)
+}
+
+var textEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+
+func escapeText(s string) string {
+	return textEscaper.Replace(s)
+}
+
+func unescapeText(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+			if s[i] == 'n' || s[i] == 'N' {
+				b.WriteByte('\n')
+			} else {
+				b.WriteByte(s[i])
+			}
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// splitText splits a list of TEXT values at unescaped commas
+func splitText(s string) []string {
+	var parts []string
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case ',':
+			parts = append(parts, unescapeText(s[start:i]))
+			start = i + 1
+		}
+	}
+	return append(parts, unescapeText(s[start:]))
+}
@@ -0,0 +1,146 @@
+package calendar
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestICalRoundTrip(t *testing.T) {
+	events := []Event{
+		{UID: "dashain-2082", Kind: KindHoliday, Title: "Dashain; Vijaya Dashami, Tika", StartDate: "2025-09-28", EndDate: "2025-10-06",
+			Description: "Bada Dashain\nSchool closed", Weekdays: []string{}, ClassIDs: []string{}},
+		{UID: "winter", Kind: KindWeeklyOff, Title: "Winter Fridays", StartDate: "2025-12-05", EndDate: "2026-01-30",
+			Weekdays: []string{"friday"}, ClassIDs: []string{"a1", "b2"}},
+		{UID: "pre-board", Kind: KindExam, Title: strings.Repeat("परीक्षा ", 20), StartDate: "2025-10-03", EndDate: "2025-10-04",
+			Weekdays: []string{}, ClassIDs: []string{"a1"}},
+	}
+	for i := range events {
+		events[i].UpdatedAt = time.Date(2025, 8, 1, 10, 0, 0, 0, time.UTC)
+	}
+
+	var buf bytes.Buffer
+	if err := Encode(&buf, "EIS, Kathmandu", events); err != nil {
+		t.Fatal(err)
+	}
+	for _, l := range strings.Split(strings.TrimSuffix(buf.String(), "\r\n"), "\r\n") {
+		if len(l) > 75 {
+			t.Errorf("line of %d octets: %q", len(l), l)
+		}
+	}
+	if !strings.Contains(buf.String(), "RRULE:FREQ=WEEKLY;BYDAY=FR;UNTIL=20260130\r\n") {
+		t.Errorf("weekly off without its rule:\n%s", buf.String())
+	}
+
+	got, err := Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(events) {
+		t.Fatalf("decoded %d events", len(got))
+	}
+	for i, e := range events {
+		want := EventInput{Kind: e.Kind, Title: e.Title, Description: e.Description, StartDate: e.StartDate, EndDate: e.EndDate,
+			Weekdays: e.Weekdays, ClassIDs: e.ClassIDs, UID: e.UID}
+		if !reflect.DeepEqual(got[i], want) {
+			t.Errorf("event %d:\n got %+v\nwant %+v", i, got[i], want)
+		}
+	}
+}
+
+func TestDecodeFeed(t *testing.T) {
+	// A feed of public holidays, as calendar services publish them
+	feed := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"PRODID:-//Example//Holidays//EN",
+		"VERSION:2.0",
+		"BEGIN:VEVENT",
+		"DTSTART;VALUE=DATE:20251020",
+		"DTEND;VALUE=DATE:20251024",
+		"UID:tihar@example.com",
+		"SUMMARY:Tihar",
+		"BEGIN:VALARM",
+		"ACTION:DISPLAY",
+		"SUMMARY:Reminder",
+		"END:VALARM",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"DTSTART;TZID=Asia/Kathmandu:20251225T000000",
+		"DTEND;TZID=Asia/Kathmandu:20251226T000000",
+		"SUMMARY:Christmas",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"DTSTART:20260101",
+		"DURATION:P2D",
+		"SUMMARY:Staff ",
+		" training",
+		"CATEGORIES:Meeting,Working Day",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"DTSTART;VALUE=DATE:20260102",
+		"RRULE:FREQ=WEEKLY;BYDAY=FR,SA;COUNT=4",
+		"SUMMARY:Winter break Fridays",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"DTSTART;VALUE=DATE:20260115",
+		"STATUS:CANCELLED",
+		"SUMMARY:Cancelled",
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}, "\r\n")
+
+	events, err := Decode(strings.NewReader(feed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 4 {
+		t.Fatalf("decoded %d events: %+v", len(events), events)
+	}
+	tihar, christmas, training, fridays := events[0], events[1], events[2], events[3]
+	if tihar.Kind != KindHoliday || tihar.StartDate != "2025-10-20" || tihar.EndDate != "2025-10-23" || tihar.UID != "tihar@example.com" {
+		t.Errorf("Tihar: %+v", tihar)
+	}
+	if christmas.StartDate != "2025-12-25" || christmas.EndDate != "2025-12-25" || !strings.HasSuffix(christmas.UID, "@import") {
+		t.Errorf("Christmas: %+v", christmas)
+	}
+	if training.Kind != KindWorkingDay || training.Title != "Staff training" || training.EndDate != "2026-01-02" {
+		t.Errorf("training: %+v", training)
+	}
+	if fridays.Kind != KindWeeklyOff || !reflect.DeepEqual(fridays.Weekdays, []string{"friday", "saturday"}) || fridays.EndDate != "2026-01-15" {
+		t.Errorf("weekly off: %+v", fridays)
+	}
+
+	// Importing the same feed again gives the same UIDs
+	again, _ := Decode(strings.NewReader(feed))
+	if again[1].UID != christmas.UID {
+		t.Errorf("UIDs differ between imports: %s, %s", christmas.UID, again[1].UID)
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	wrap := func(lines ...string) string {
+		return "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nBEGIN:VEVENT\r\n" + strings.Join(lines, "\r\n") + "\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"
+	}
+	cases := map[string]string{
+		"empty":          "",
+		"not iCalendar":  "name,date\nDashain,2025-09-28\n",
+		"unterminated":   "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\n",
+		"no start":       wrap("SUMMARY:Dashain"),
+		"no summary":     wrap("DTSTART:20250928"),
+		"bad start":      wrap("DTSTART:2025-09-28", "SUMMARY:Dashain"),
+		"bad duration":   wrap("DTSTART:20250928", "DURATION:P1Y", "SUMMARY:Dashain"),
+		"yearly":         wrap("DTSTART:20250928", "RRULE:FREQ=YEARLY", "SUMMARY:Dashain"),
+		"bad weekday":    wrap("DTSTART:20250928", "RRULE:FREQ=WEEKLY;BYDAY=1FR", "SUMMARY:Fridays"),
+		"exceptions":     wrap("DTSTART:20250928", "RRULE:FREQ=WEEKLY", "EXDATE:20251005", "SUMMARY:Sundays"),
+		"too long":       wrap("DTSTART:20250928", "DTEND:20270101", "SUMMARY:Forever"),
+		"ends too early": wrap("DTSTART:20250928", "RRULE:FREQ=WEEKLY;UNTIL=20250901", "SUMMARY:Sundays"),
+	}
+	for name, doc := range cases {
+		if _, err := Decode(strings.NewReader(doc)); !errors.Is(err, ErrInvalid) {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package calendar
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"school-erp/pkg/events"
+)
+
+// Migration creates the calendar events table in the main database, after
+// the schools table. The school service includes it in its migration list.
+// Class IDs are of the school's database, so they reference nothing here.
+const Migration = `
+CREATE TABLE IF NOT EXISTS calendar_events (
+	id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+	school_id UUID NOT NULL REFERENCES schools(id) ON DELETE CASCADE,
+	uid VARCHAR(255) NOT NULL DEFAULT gen_random_uuid()::text,
+	kind VARCHAR(20) NOT NULL CHECK (kind IN ('holiday', 'weekly_off', 'event', 'exam', 'working_day')),
+	title VARCHAR(255) NOT NULL,
+	description TEXT NOT NULL DEFAULT '',
+	start_date DATE NOT NULL,
+	end_date DATE NOT NULL,
+	weekdays TEXT[] NOT NULL DEFAULT '{}',
+	class_ids TEXT[] NOT NULL DEFAULT '{}',
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	CHECK (end_date >= start_date),
+	UNIQUE (school_id, uid)
+);
+
+CREATE INDEX IF NOT EXISTS idx_calendar_events_school_dates ON calendar_events(school_id, start_date, end_date);
+`
+
+// SubjectCalendarChanged is the subject of CalendarChanged events
+const SubjectCalendarChanged = "SchoolCalendarChanged"
+
+// CalendarChanged is published when events of a school are created,
+// changed, deleted or imported
+type CalendarChanged struct {
+	SchoolID  string    `json:"school_id"`
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+func send(publish events.Publisher, e CalendarChanged) {
+	e.ChangedAt = time.Now().UTC()
+	events.Send(publish, SubjectCalendarChanged, e)
+}
+
+// Store reads and writes calendar events in the main database
+type Store struct {
+	db      *pgxpool.Pool
+	publish events.Publisher
+}
+
+func NewStore(db *pgxpool.Pool, publish events.Publisher) *Store {
+	return &Store{db: db, publish: publish}
+}
+
+const eventColumns = `id::text, school_id::text, uid, kind, title, description, to_char(start_date, 'YYYY-MM-DD'),
+	to_char(end_date, 'YYYY-MM-DD'), weekdays, class_ids, created_at, updated_at`
+
+func scanEvent(row pgx.Row, e *Event) error {
+	return row.Scan(&e.ID, &e.SchoolID, &e.UID, &e.Kind, &e.Title, &e.Description, &e.StartDate,
+		&e.EndDate, &e.Weekdays, &e.ClassIDs, &e.CreatedAt, &e.UpdatedAt)
+}
+
+// List returns the school's events in order of their start, those running
+// between from and to when given
+func (s *Store) List(ctx context.Context, schoolID, from, to string) ([]Event, error) {
+	rows, err := s.db.Query(ctx, `
+	SELECT `+eventColumns+` FROM calendar_events
+	WHERE school_id = $1
+		AND end_date >= COALESCE(NULLIF($2, '')::date, end_date)
+		AND start_date <= COALESCE(NULLIF($3, '')::date, start_date)
+	ORDER BY start_date, end_date, id`, schoolID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (Event, error) {
+		var e Event
+		err := scanEvent(row, &e)
+		return e, err
+	})
+}
+
+// Get returns the school's event with id, or ErrUnknownEvent
+func (s *Store) Get(ctx context.Context, schoolID, id string) (*Event, error) {
+	var e Event
+	err := scanEvent(s.db.QueryRow(ctx, `
+	SELECT `+eventColumns+` FROM calendar_events WHERE school_id = $1 AND id::text = $2`, schoolID, id), &e)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("%w %q", ErrUnknownEvent, id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// Create adds an event to the school. It returns pgx.ErrNoRows for unknown
+// schools.
+func (s *Store) Create(ctx context.Context, schoolID string, in EventInput) (*Event, error) {
+	if err := in.Check(); err != nil {
+		return nil, err
+	}
+	var e Event
+	err := scanEvent(s.db.QueryRow(ctx, `
+	INSERT INTO calendar_events (school_id, uid, kind, title, description, start_date, end_date, weekdays, class_ids)
+	SELECT id, COALESCE(NULLIF($2, ''), gen_random_uuid()::text), $3, $4, $5, $6, $7, $8, $9 FROM schools WHERE id = $1
+	RETURNING `+eventColumns,
+		schoolID, in.UID, in.Kind, in.Title, in.Description, in.StartDate, in.EndDate, in.Weekdays, in.ClassIDs), &e)
+	if err != nil {
+		return nil, err
+	}
+	send(s.publish, CalendarChanged{SchoolID: schoolID})
+	return &e, nil
+}
+
+// Update replaces the school's event, keeping its UID unless one is given
+func (s *Store) Update(ctx context.Context, schoolID, id string, in EventInput) (*Event, error) {
+	if err := in.Check(); err != nil {
+		return nil, err
+	}
+	var e Event
+	err := scanEvent(s.db.QueryRow(ctx, `
+	UPDATE calendar_events SET uid = COALESCE(NULLIF($3, ''), uid), kind = $4, title = $5, description = $6,
+		start_date = $7, end_date = $8, weekdays = $9, class_ids = $10, updated_at = CURRENT_TIMESTAMP
+	WHERE school_id = $1 AND id::text = $2
+	RETURNING `+eventColumns,
+		schoolID, id, in.UID, in.Kind, in.Title, in.Description, in.StartDate, in.EndDate, in.Weekdays, in.ClassIDs), &e)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("%w %q", ErrUnknownEvent, id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	send(s.publish, CalendarChanged{SchoolID: schoolID})
+	return &e, nil
+}
+
+// Delete removes the school's event, or returns ErrUnknownEvent
+func (s *Store) Delete(ctx context.Context, schoolID, id string) error {
+	tag, err := s.db.Exec(ctx, `DELETE FROM calendar_events WHERE school_id = $1 AND id::text = $2`, schoolID, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%w %q", ErrUnknownEvent, id)
+	}
+	send(s.publish, CalendarChanged{SchoolID: schoolID})
+	return nil
+}
+
+// ImportResult counts the events an import wrote
+type ImportResult struct {
+	Created int `json:"created"`
+	Updated int `json:"updated"`
+	Deleted int `json:"deleted"`
+}
+
+// Import writes the events, as Decode reads them, in one transaction.
+// Events whose UID the school has already are replaced; with replace, the
+// school's events missing from the import are deleted. It returns
+// pgx.ErrNoRows for unknown schools.
+func (s *Store) Import(ctx context.Context, schoolID string, events []EventInput, replace bool) (*ImportResult, error) {
+	uids := make([]string, 0, len(events))
+	for i := range events {
+		if err := events[i].Check(); err != nil {
+			return nil, fmt.Errorf("event %q: %w", events[i].Title, err)
+		}
+		if events[i].UID == "" {
+			return nil, fmt.Errorf("event %q: %w: imported events need a UID", events[i].Title, ErrInvalid)
+		}
+		uids = append(uids, events[i].UID)
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var found bool
+	if err := tx.QueryRow(ctx, `SELECT true FROM schools WHERE id = $1 FOR UPDATE`, schoolID).Scan(&found); err != nil {
+		return nil, err
+	}
+	var res ImportResult
+	if replace {
+		tag, err := tx.Exec(ctx, `DELETE FROM calendar_events WHERE school_id = $1 AND NOT uid = ANY($2)`, schoolID, uids)
+		if err != nil {
+			return nil, err
+		}
+		res.Deleted = int(tag.RowsAffected())
+	}
+	for _, in := range events {
+		var created bool
+		err := tx.QueryRow(ctx, `
+		INSERT INTO calendar_events (school_id, uid, kind, title, description, start_date, end_date, weekdays, class_ids)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (school_id, uid) DO UPDATE SET kind = EXCLUDED.kind, title = EXCLUDED.title,
+			description = EXCLUDED.description, start_date = EXCLUDED.start_date, end_date = EXCLUDED.end_date,
+			weekdays = EXCLUDED.weekdays, class_ids = EXCLUDED.class_ids, updated_at = CURRENT_TIMESTAMP
+		RETURNING xmax = 0`,
+			schoolID, in.UID, in.Kind, in.Title, in.Description, in.StartDate, in.EndDate, in.Weekdays, in.ClassIDs,
+		).Scan(&created)
+		if err != nil {
+			return nil, err
+		}
+		if created {
+			res.Created++
+		} else {
+			res.Updated++
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	send(s.publish, CalendarChanged{SchoolID: schoolID})
+	return &res, nil
+}
@@ -0,0 +1,68 @@
+// Package classes holds the migration of the class catalog of the shared
+// database: classes (grades), their sections, subjects and the teachers
+// assigned to teach a subject to a section in an academic year. Students,
+// enrollments, exams and attendance reference it, so every service owning
+// one of those tables runs Migration before its own; the student service
+// serves the catalog. School databases get the same tables from the school
+// service's tenant migrations.
+package classes
+
+// Tables are the tables Migration creates, for tenant.RLSMigration
+var Tables = []string{"classes", "sections", "subjects", "teacher_assignments"}
+
+// Migration creates the catalog tables. Names are unique per school, or per
+// class for sections, whatever their case; subject codes likewise.
+const Migration = `
+CREATE TABLE IF NOT EXISTS classes (
+	id BIGSERIAL PRIMARY KEY,
+	school_id BIGINT NOT NULL,
+	name VARCHAR(50) NOT NULL,
+	position INTEGER NOT NULL DEFAULT 0,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_classes_school_name ON classes(school_id, lower(name));
+
+CREATE TABLE IF NOT EXISTS sections (
+	id BIGSERIAL PRIMARY KEY,
+	school_id BIGINT NOT NULL,
+	class_id BIGINT NOT NULL REFERENCES classes(id) ON DELETE CASCADE,
+	name VARCHAR(10) NOT NULL,
+	capacity INTEGER CHECK (capacity > 0),
+	class_teacher_id BIGINT REFERENCES users(id) ON DELETE SET NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE (id, class_id)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_sections_class_name ON sections(class_id, lower(name));
+
+CREATE TABLE IF NOT EXISTS subjects (
+	id BIGSERIAL PRIMARY KEY,
+	school_id BIGINT NOT NULL,
+	code VARCHAR(20) NOT NULL,
+	name VARCHAR(255) NOT NULL,
+	credit_hours NUMERIC(4,2) NOT NULL DEFAULT 0 CHECK (credit_hours >= 0),
+	theory_percent SMALLINT NOT NULL DEFAULT 100 CHECK (theory_percent BETWEEN 0 AND 100),
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_subjects_school_code ON subjects(school_id, upper(code));
+CREATE UNIQUE INDEX IF NOT EXISTS idx_subjects_school_name ON subjects(school_id, lower(name));
+
+CREATE TABLE IF NOT EXISTS teacher_assignments (
+	id BIGSERIAL PRIMARY KEY,
+	school_id BIGINT NOT NULL,
+	teacher_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	subject_id BIGINT NOT NULL REFERENCES subjects(id) ON DELETE CASCADE,
+	section_id BIGINT NOT NULL REFERENCES sections(id) ON DELETE CASCADE,
+	academic_year_id UUID NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE (teacher_id, subject_id, section_id, academic_year_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_teacher_assignments_section_id ON teacher_assignments(section_id);
+CREATE INDEX IF NOT EXISTS idx_teacher_assignments_subject_id ON teacher_assignments(subject_id);
+`
@@ -0,0 +1,280 @@
+// Package config loads typed service configuration from defaults, an optional
+// YAML file, environment variables and *_FILE secret files.
+//
+// Fields are described with struct tags:
+//
+//	type Config struct {
+//		Port       int           `env:"PORT" default:"3004"`
+//		DBPassword string        `env:"DB_PASSWORD" default:"postgres" secret:"true"`
+//		JWTSecret  string        `env:"JWT_SECRET" required:"true" secret:"true"`
+//		Timeout    time.Duration `env:"TIMEOUT" default:"5s"`
+//	}
+//
+// Values are resolved in increasing priority: the default tag, the YAML file
+// named by CONFIG_FILE, the environment variable, and finally the file named
+// by the <ENV>_FILE variable (the layout used by Kubernetes secrets).
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Source records where a field's effective value came from.
+type Source string
+
+const (
+	SourceUnset   Source = "unset"
+	SourceDefault Source = "default"
+	SourceYAML    Source = "yaml"
+	SourceEnv     Source = "env"
+	SourceFile    Source = "file"
+)
+
+// ConfigFileEnv names the environment variable pointing at the YAML file.
+const ConfigFileEnv = "CONFIG_FILE"
+
+// insecureValues are well-known placeholder secrets that must never reach production.
+var insecureValues = map[string]bool{
+	"":                                 true,
+	"change-me":                        true,
+	"changeme":                         true,
+	"postgres":                         true,
+	"password":                         true,
+	"secret":                           true,
+	"admin":                            true,
+	"default-key-change-in-production": true,
+	"your-super-secret-jwt-key":        true,
+}
+
+// Field describes a single resolved configuration field.
+type Field struct {
+	Name   string
+	Env    string
+	Value  string
+	Source Source
+	Secret bool
+}
+
+// Report is the outcome of a successful Load.
+type Report struct {
+	Fields []Field
+}
+
+// Load populates dst, which must be a pointer to a struct, and validates it.
+// Parse failures, missing required fields and, when ENVIRONMENT=production,
+// secrets left at their default or at a well-known placeholder are returned
+// as a single joined error.
+func Load(dst interface{}) (*Report, error) {
+	rv := reflect.ValueOf(dst)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("config: destination must be a pointer to a struct, got %T", dst)
+	}
+
+	fileValues, err := readYAML(os.Getenv(ConfigFileEnv))
+	if err != nil {
+		return nil, err
+	}
+
+	production := strings.EqualFold(lookup("ENVIRONMENT", fileValues), "production")
+
+	var (
+		report Report
+		errs   []error
+	)
+
+	elem := rv.Elem()
+	typ := elem.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		sf := typ.Field(i)
+		env := sf.Tag.Get("env")
+		if env == "" || !sf.IsExported() {
+			continue
+		}
+
+		raw, source, err := resolve(sf, env, fileValues)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		secret := sf.Tag.Get("secret") == "true"
+		if source == SourceUnset && sf.Tag.Get("required") == "true" {
+			errs = append(errs, fmt.Errorf("%s is required (set %s or %s_FILE)", env, env, env))
+			continue
+		}
+
+		if source != SourceUnset {
+			if err := setField(elem.Field(i), raw); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", env, err))
+				continue
+			}
+		}
+
+		if production && secret && source != SourceUnset {
+			switch {
+			case source == SourceDefault:
+				errs = append(errs, fmt.Errorf("%s must be set explicitly in production", env))
+			case insecureValues[strings.ToLower(raw)]:
+				errs = append(errs, fmt.Errorf("%s uses an insecure placeholder value in production", env))
+			}
+		}
+
+		report.Fields = append(report.Fields, Field{
+			Name:   sf.Name,
+			Env:    env,
+			Value:  raw,
+			Source: source,
+			Secret: secret,
+		})
+	}
+
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("invalid configuration: %w", errors.Join(errs...))
+	}
+	return &report, nil
+}
+
+// Print writes the effective configuration with secrets redacted.
+func (r *Report) Print(w io.Writer, service string) {
+	fmt.Fprintf(w, "[%s] effective configuration:\n", service)
+	for _, f := range r.Fields {
+		value := f.Value
+		if f.Secret && value != "" {
+			value = "********"
+		}
+		fmt.Fprintf(w, "  %-28s %-40s (%s)\n", f.Env, value, f.Source)
+	}
+}
+
+// resolve finds the raw string value for a field and where it came from.
+func resolve(sf reflect.StructField, env string, fileValues map[string]string) (string, Source, error) {
+	if path, ok := os.LookupEnv(env + "_FILE"); ok && path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", SourceUnset, fmt.Errorf("%s_FILE: %w", env, err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), SourceFile, nil
+	}
+	if value, ok := os.LookupEnv(env); ok {
+		return value, SourceEnv, nil
+	}
+	key := sf.Tag.Get("yaml")
+	if key == "" {
+		key = strings.ToLower(env)
+	}
+	if value, ok := fileValues[key]; ok {
+		return value, SourceYAML, nil
+	}
+	if value, ok := sf.Tag.Lookup("default"); ok {
+		return value, SourceDefault, nil
+	}
+	return "", SourceUnset, nil
+}
+
+// lookup returns a value from the environment, falling back to the YAML file.
+func lookup(env string, fileValues map[string]string) string {
+	if value, ok := os.LookupEnv(env); ok {
+		return value
+	}
+	return fileValues[strings.ToLower(env)]
+}
+
+// readYAML reads a flat YAML mapping of keys to scalar values.
+func readYAML(path string) (map[string]string, error) {
+	values := map[string]string{}
+	if path == "" {
+		return values, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("config: read %s: %w", path, err)
+	}
+
+	var raw map[string]interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("config: parse %s: %w", path, err)
+	}
+
+	for key, value := range raw {
+		switch v := value.(type) {
+		case nil:
+			values[strings.ToLower(key)] = ""
+		case []interface{}:
+			parts := make([]string, len(v))
+			for i, item := range v {
+				parts[i] = fmt.Sprint(item)
+			}
+			values[strings.ToLower(key)] = strings.Join(parts, ",")
+		case map[string]interface{}:
+			return nil, fmt.Errorf("config: %s: nested key %q is not supported", path, key)
+		default:
+			values[strings.ToLower(key)] = fmt.Sprint(v)
+		}
+	}
+	return values, nil
+}
+
+// setField converts raw into the field's type.
+func setField(field reflect.Value, raw string) error {
+	if field.Type() == reflect.TypeOf(time.Duration(0)) {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", raw)
+		}
+		field.SetInt(int64(d))
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(raw)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(strings.TrimSpace(raw), 10, field.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", raw)
+		}
+		field.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(strings.TrimSpace(raw), 10, field.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid unsigned integer %q", raw)
+		}
+		field.SetUint(n)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(strings.TrimSpace(raw))
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", raw)
+		}
+		field.SetBool(b)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(strings.TrimSpace(raw), field.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid number %q", raw)
+		}
+		field.SetFloat(f)
+	case reflect.Slice:
+		if field.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported slice type %s", field.Type())
+		}
+		var items []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		field.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported field type %s", field.Type())
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testConfig struct {
+	Port       int           `env:"TEST_PORT" default:"3000"`
+	Host       string        `env:"TEST_HOST" default:"localhost"`
+	Password   string        `env:"TEST_PASSWORD" default:"postgres" secret:"true"`
+	Secret     string        `env:"TEST_SECRET" required:"true" secret:"true"`
+	Timeout    time.Duration `env:"TEST_TIMEOUT" default:"5s"`
+	Origins    []string      `env:"TEST_ORIGINS" default:"http://a, http://b"`
+	Debug      bool          `env:"TEST_DEBUG" default:"false"`
+	unexported string
+}
+
+func TestLoadDefaultsAndEnv(t *testing.T) {
+	t.Setenv("TEST_SECRET", "s3cr3t")
+	t.Setenv("TEST_PORT", "4000")
+
+	var cfg testConfig
+	report, err := Load(&cfg)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	if cfg.Port != 4000 {
+		t.Errorf("Port = %d, want 4000", cfg.Port)
+	}
+	if cfg.Host != "localhost" {
+		t.Errorf("Host = %q, want localhost", cfg.Host)
+	}
+	if cfg.Timeout != 5*time.Second {
+		t.Errorf("Timeout = %v, want 5s", cfg.Timeout)
+	}
+	if len(cfg.Origins) != 2 || cfg.Origins[1] != "http://b" {
+		t.Errorf("Origins = %v", cfg.Origins)
+	}
+
+	var out bytes.Buffer
+	report.Print(&out, "test")
+	if strings.Contains(out.String(), "s3cr3t") {
+		t.Errorf("Print() leaked a secret:\n%s", out.String())
+	}
+	if !strings.Contains(out.String(), "TEST_PORT") {
+		t.Errorf("Print() missing field:\n%s", out.String())
+	}
+}
+
+func TestLoadRequired(t *testing.T) {
+	var cfg testConfig
+	_, err := Load(&cfg)
+	if err == nil || !strings.Contains(err.Error(), "TEST_SECRET is required") {
+		t.Fatalf("Load() error = %v, want required error", err)
+	}
+}
+
+func TestLoadParseErrors(t *testing.T) {
+	t.Setenv("TEST_SECRET", "x")
+	t.Setenv("TEST_TIMEOUT", "five seconds")
+	t.Setenv("TEST_PORT", "eighty")
+
+	var cfg testConfig
+	_, err := Load(&cfg)
+	if err == nil {
+		t.Fatal("Load() expected error for invalid values")
+	}
+	for _, want := range []string{"TEST_TIMEOUT", "TEST_PORT"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Load() error = %v, want mention of %s", err, want)
+		}
+	}
+}
+
+func TestLoadSecretFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(path, []byte("from-file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TEST_SECRET", "from-env")
+	t.Setenv("TEST_SECRET_FILE", path)
+
+	var cfg testConfig
+	report, err := Load(&cfg)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.Secret != "from-file" {
+		t.Errorf("Secret = %q, want from-file", cfg.Secret)
+	}
+	for _, f := range report.Fields {
+		if f.Env == "TEST_SECRET" && f.Source != SourceFile {
+			t.Errorf("TEST_SECRET source = %s, want file", f.Source)
+		}
+	}
+}
+
+func TestLoadYAML(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	data := "test_host: db.internal\ntest_secret: yaml-secret\ntest_origins:\n  - http://x\n  - http://y\n"
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(ConfigFileEnv, path)
+	t.Setenv("TEST_HOST", "env.internal")
+
+	var cfg testConfig
+	if _, err := Load(&cfg); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.Host != "env.internal" {
+		t.Errorf("Host = %q, env should override yaml", cfg.Host)
+	}
+	if cfg.Secret != "yaml-secret" {
+		t.Errorf("Secret = %q, want yaml-secret", cfg.Secret)
+	}
+	if len(cfg.Origins) != 2 || cfg.Origins[0] != "http://x" {
+		t.Errorf("Origins = %v", cfg.Origins)
+	}
+}
+
+func TestLoadProductionRejectsInsecureDefaults(t *testing.T) {
+	t.Setenv("ENVIRONMENT", "production")
+	t.Setenv("TEST_SECRET", "change-me")
+
+	var cfg testConfig
+	_, err := Load(&cfg)
+	if err == nil {
+		t.Fatal("Load() expected production error")
+	}
+	if !strings.Contains(err.Error(), "TEST_PASSWORD must be set explicitly") {
+		t.Errorf("error = %v, want default password rejected", err)
+	}
+	if !strings.Contains(err.Error(), "TEST_SECRET uses an insecure placeholder") {
+		t.Errorf("error = %v, want placeholder secret rejected", err)
+	}
+
+	t.Setenv("TEST_PASSWORD", "a-real-password")
+	t.Setenv("TEST_SECRET", "a-real-secret")
+	if _, err := Load(&cfg); err != nil {
+		t.Errorf("Load() with real secrets error = %v", err)
+	}
+}
@@ -0,0 +1,26 @@
+// Package events publishes the events by which services learn of changes
+// made by others, such as a school's settings, on NATS subjects.
+package events
+
+import (
+	"encoding/json"
+	"log"
+)
+
+// Publisher sends an event; nil drops events
+type Publisher func(subject string, data []byte) error
+
+// Send publishes e as JSON on subject. It is best effort: failures are
+// logged, and readers' caches expire on their own.
+func Send(publish Publisher, subject string, e any) {
+	if publish == nil {
+		return
+	}
+	data, err := json.Marshal(e)
+	if err == nil {
+		err = publish(subject, data)
+	}
+	if err != nil {
+		log.Printf("Failed to publish %s: %v\n", subject, err)
+	}
+}
@@ -0,0 +1,149 @@
+package features
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"school-erp/pkg/cache"
+	"school-erp/pkg/problem"
+	"school-erp/pkg/tenant"
+)
+
+// ErrUnknownSchool is returned by Client for codes of no school
+var ErrUnknownSchool = errors.New("unknown school")
+
+// Checker reports whether a feature is on for the school with a code
+type Checker interface {
+	Enabled(ctx context.Context, code, key string) (bool, error)
+}
+
+// Client checks features for the gateway and the services. A school's
+// toggles and the defined flags are cached for ttl or until a
+// FeaturesChanged event for them is passed to HandleEvent.
+type Client struct {
+	fetchSchool func(ctx context.Context, code string) (*State, error)
+	fetchFlags  func(ctx context.Context) (map[string]Flag, error)
+	schools     *cache.TTL[string, *State] // without Flags
+	flags       *cache.TTL[struct{}, map[string]Flag]
+}
+
+// NewClient creates a client reading the main database
+func NewClient(db *pgxpool.Pool, ttl time.Duration) *Client {
+	fetchSchool := func(ctx context.Context, code string) (*State, error) {
+		var st State
+		err := db.QueryRow(ctx, `
+		SELECT sc.id, p.modules FROM schools sc LEFT JOIN plans p ON p.code = sc.plan_code
+		WHERE sc.code = $1`, code,
+		).Scan(&st.SchoolID, &st.PlanModules)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("%w %q", ErrUnknownSchool, code)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if st.Toggles, err = loadToggles(ctx, db, st.SchoolID); err != nil {
+			return nil, err
+		}
+		return &st, nil
+	}
+	fetchFlags := func(ctx context.Context) (map[string]Flag, error) {
+		return loadFlags(ctx, db)
+	}
+	return &Client{
+		fetchSchool: fetchSchool,
+		fetchFlags:  fetchFlags,
+		schools:     cache.NewTTL[string, *State](ttl),
+		flags:       cache.NewTTL[struct{}, map[string]Flag](ttl),
+	}
+}
+
+// State returns what the school with code has of every module and flag
+func (c *Client) State(ctx context.Context, code string) (*State, error) {
+	school, err := c.schools.Get(code, func() (*State, error) {
+		return c.fetchSchool(ctx, code)
+	})
+	if err != nil {
+		return nil, err
+	}
+	flags, err := c.flags.Get(struct{}{}, func() (map[string]Flag, error) {
+		return c.fetchFlags(ctx)
+	})
+	if err != nil {
+		return nil, err
+	}
+	st := *school
+	st.Flags = flags
+	return &st, nil
+}
+
+// Enabled reports whether key is on for the school with code
+func (c *Client) Enabled(ctx context.Context, code, key string) (bool, error) {
+	st, err := c.State(ctx, code)
+	if err != nil {
+		return false, err
+	}
+	return st.Enabled(key), nil
+}
+
+// Invalidate drops the cached toggles of the school with code, or with an
+// empty code everything cached, as flag and plan changes concern every school
+func (c *Client) Invalidate(code string) {
+	if code == "" {
+		c.flags.Clear()
+		c.schools.Clear()
+	} else {
+		c.schools.Invalidate(code)
+	}
+}
+
+// HandleEvent invalidates what a FeaturesChanged message names; malformed
+// ones are logged
+func (c *Client) HandleEvent(data []byte) {
+	var e FeaturesChanged
+	if err := json.Unmarshal(data, &e); err != nil {
+		log.Printf("Invalid %s event: %v\n", SubjectFeaturesChanged, err)
+		return
+	}
+	c.Invalidate(e.Code)
+}
+
+// Require returns middleware that rejects requests with 403 unless module
+// is on for the request's school. Mount it after tenant resolution, which
+// stores the school's code in Locals (tenant.Code); requests without one are
+// rejected.
+func Require(checker Checker, module string) fiber.Handler {
+	name := module
+	if m := LookupModule(module); m != nil {
+		name = m.Name
+	}
+
+	return func(c *fiber.Ctx) error {
+		code := tenant.Code(c)
+		if code == "" {
+			return problem.BadRequest(problem.CodeBadRequest,
+				fmt.Sprintf("The %s module is only available for a school", name))
+		}
+		enabled, err := checker.Enabled(c.Context(), code, module)
+		if errors.Is(err, ErrUnknownSchool) {
+			return problem.NotFound(fmt.Sprintf("School %q not found or inactive", code))
+		}
+		if err != nil {
+			log.Printf("Failed to check module %s for tenant %s: %v\n", module, code, err)
+			return problem.New(fiber.StatusServiceUnavailable, problem.CodeUnavailable,
+				"Failed to check the school's modules").Wrap(err)
+		}
+		if !enabled {
+			return problem.Forbidden(problem.CodeModuleDisabled,
+				fmt.Sprintf("The %s module is not enabled for school %q", name, code))
+		}
+		return c.Next()
+	}
+}
@@ -0,0 +1,217 @@
+// Package features decides which modules and feature flags are on for a
+// school. Modules are the parts of the ERP a school pays for and uses, such
+// as transport or exams; flags gate new behaviour and can be rolled out to a
+// percentage of schools. The school service keeps per-school toggles and
+// rollouts in the main database with a Store; the gateway and the services
+// check them with a Client and the Require middleware.
+package features
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+)
+
+// Modules of the ERP
+const (
+	ModuleStudents      = "students"
+	ModuleStaff         = "staff"
+	ModuleAttendance    = "attendance"
+	ModuleFees          = "fees"
+	ModuleExams         = "exams"
+	ModuleNotifications = "notifications"
+	ModuleTransport     = "transport"
+)
+
+// Module is a part of the ERP that can be turned on or off per school
+type Module struct {
+	Key         string `json:"key"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// Core modules are always on
+	Core bool `json:"core"`
+	// Default is whether schools that never toggled the module have it
+	Default bool `json:"default"`
+}
+
+// modules are the registered modules, in the order they are listed
+var modules = []Module{
+	{Key: ModuleStudents, Name: "Students", Description: "Student records and enrollments", Core: true, Default: true},
+	{Key: ModuleStaff, Name: "Staff", Description: "Teachers, parents and staff", Core: true, Default: true},
+	{Key: ModuleAttendance, Name: "Attendance", Description: "Daily and period attendance", Default: true},
+	{Key: ModuleFees, Name: "Fees", Description: "Fee structures, invoices and payments", Default: true},
+	{Key: ModuleExams, Name: "Exams", Description: "Exams, marks and report cards", Default: true},
+	{Key: ModuleNotifications, Name: "Notifications", Description: "Email and SMS to parents and staff", Default: true},
+	{Key: ModuleTransport, Name: "Transport", Description: "Routes, vehicles and student pickup", Default: false},
+}
+
+var (
+	// ErrUnknownFeature is returned for keys that are neither a module nor a
+	// defined flag
+	ErrUnknownFeature = errors.New("unknown feature")
+	// ErrCoreModule is returned when a core module would be turned off
+	ErrCoreModule = errors.New("core modules cannot be disabled")
+	// ErrNotInPlan is returned when a module the school's plan lacks would
+	// be turned on
+	ErrNotInPlan = errors.New("module is not in the school's plan")
+	// ErrInvalidKey is returned for flag keys that are malformed or taken by
+	// a module
+	ErrInvalidKey = errors.New("invalid flag key")
+)
+
+// flagKey is the form of flag keys, e.g. "exams.online-marking"
+var flagKey = regexp.MustCompile(`^[a-z][a-z0-9]*([._-][a-z0-9]+)*$`)
+
+// Modules returns the registered modules
+func Modules() []Module {
+	return append([]Module(nil), modules...)
+}
+
+// LookupModule returns the module with key, or nil
+func LookupModule(key string) *Module {
+	for i := range modules {
+		if modules[i].Key == key {
+			m := modules[i]
+			return &m
+		}
+	}
+	return nil
+}
+
+// CheckFlagKey returns ErrInvalidKey unless key can name a flag
+func CheckFlagKey(key string) error {
+	if len(key) > 100 || !flagKey.MatchString(key) {
+		return fmt.Errorf("%w %q: use lowercase letters and digits separated by '.', '_' or '-'", ErrInvalidKey, key)
+	}
+	if LookupModule(key) != nil {
+		return fmt.Errorf("%w %q: it is the key of a module", ErrInvalidKey, key)
+	}
+	return nil
+}
+
+// Flag is a feature flag. Schools without a toggle of their own get it when
+// they fall in the first Rollout percent of schools.
+type Flag struct {
+	Key         string `json:"key" validate:"required,max=100"`
+	Description string `json:"description" validate:"max=500"`
+	Rollout     int    `json:"rollout_percent" validate:"min=0,max=100" doc:"Percentage of schools without a toggle of their own that get the flag"`
+}
+
+// Sources of a feature's state
+const (
+	SourceCore    = "core"    // core modules are always on
+	SourcePlan    = "plan"    // the school's plan lacks the module
+	SourceSchool  = "school"  // the school's own toggle
+	SourceDefault = "default" // the module's default
+	SourceRollout = "rollout" // the flag's percentage rollout
+)
+
+// Kinds of features
+const (
+	KindModule = "module"
+	KindFlag   = "flag"
+)
+
+// State is what a school has of every module and flag
+type State struct {
+	SchoolID string
+	// Toggles are the school's own choices by key
+	Toggles map[string]bool
+	// PlanModules are the modules the school's plan includes; nil allows
+	// every module
+	PlanModules []string
+	// Flags are the defined flags by key
+	Flags map[string]Flag
+}
+
+// Feature is the evaluated state of one module or flag for a school
+type Feature struct {
+	Key     string `json:"key"`
+	Kind    string `json:"kind" doc:"module or flag"`
+	Name    string `json:"name,omitempty"`
+	Enabled bool   `json:"enabled"`
+	Source  string `json:"source" doc:"Why it is on or off: core, plan, school, default or rollout"`
+}
+
+// Evaluate returns the state of key for the school. Unknown keys are off.
+func (s *State) Evaluate(key string) Feature {
+	if m := LookupModule(key); m != nil {
+		f := Feature{Key: key, Kind: KindModule, Name: m.Name}
+		switch on, toggled := s.Toggles[key]; {
+		case m.Core:
+			f.Enabled, f.Source = true, SourceCore
+		case !s.InPlan(key):
+			f.Enabled, f.Source = false, SourcePlan
+		case toggled:
+			f.Enabled, f.Source = on, SourceSchool
+		default:
+			f.Enabled, f.Source = m.Default, SourceDefault
+		}
+		return f
+	}
+
+	f := Feature{Key: key, Kind: KindFlag}
+	flag, defined := s.Flags[key]
+	if !defined {
+		f.Source = SourceDefault
+		return f
+	}
+	if on, toggled := s.Toggles[key]; toggled {
+		f.Enabled, f.Source = on, SourceSchool
+		return f
+	}
+	f.Enabled, f.Source = InRollout(s.SchoolID, key, flag.Rollout), SourceRollout
+	return f
+}
+
+// InPlan reports whether the school's plan includes the module
+func (s *State) InPlan(module string) bool {
+	if s.PlanModules == nil {
+		return true
+	}
+	for _, m := range s.PlanModules {
+		if m == module {
+			return true
+		}
+	}
+	return false
+}
+
+// Enabled reports whether key is on for the school
+func (s *State) Enabled(key string) bool {
+	return s.Evaluate(key).Enabled
+}
+
+// All returns the state of every module, then every defined flag by key
+func (s *State) All() []Feature {
+	all := make([]Feature, 0, len(modules)+len(s.Flags))
+	for _, m := range modules {
+		all = append(all, s.Evaluate(m.Key))
+	}
+	keys := make([]string, 0, len(s.Flags))
+	for key := range s.Flags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		all = append(all, s.Evaluate(key))
+	}
+	return all
+}
+
+// InRollout reports whether the school is in the first percent of schools
+// for the flag. Each flag buckets schools differently, so the same schools
+// do not get every new flag first, and raising percent only adds schools.
+func InRollout(schoolID, key string, percent int) bool {
+	if percent <= 0 {
+		return false
+	}
+	if percent >= 100 {
+		return true
+	}
+	sum := sha256.Sum256([]byte(key + "/" + schoolID))
+	return int(binary.BigEndian.Uint64(sum[:8])%100) < percent
+}
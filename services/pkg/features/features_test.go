@@ -0,0 +1,174 @@
+package features
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"school-erp/pkg/cache"
+	"school-erp/pkg/problem"
+	"school-erp/pkg/tenant"
+)
+
+func TestEvaluate(t *testing.T) {
+	st := &State{
+		SchoolID: "8f14e45f-ceea-467f-a0e6-3c9d1c2e3b41",
+		Toggles:  map[string]bool{ModuleExams: false, ModuleTransport: true, ModuleStudents: false, "exams.online": true},
+		Flags: map[string]Flag{
+			"exams.online": {Key: "exams.online"},
+			"fees.esewa":   {Key: "fees.esewa", Rollout: 100},
+			"beta":         {Key: "beta", Rollout: 0},
+		},
+	}
+	cases := []struct {
+		key     string
+		enabled bool
+		source  string
+	}{
+		{ModuleStudents, true, SourceCore},
+		{ModuleExams, false, SourceSchool},
+		{ModuleTransport, true, SourceSchool},
+		{ModuleFees, true, SourceDefault},
+		{"exams.online", true, SourceSchool},
+		{"fees.esewa", true, SourceRollout},
+		{"beta", false, SourceRollout},
+		{"undefined", false, SourceDefault},
+	}
+	for _, tc := range cases {
+		f := st.Evaluate(tc.key)
+		if f.Enabled != tc.enabled || f.Source != tc.source {
+			t.Errorf("%s = %+v, want enabled %v from %s", tc.key, f, tc.enabled, tc.source)
+		}
+	}
+	if all := st.All(); len(all) != len(modules)+3 || all[len(modules)].Key != "beta" {
+		t.Errorf("All() = %+v", all)
+	}
+
+	// Modules outside the plan are off whatever the school chose
+	st.PlanModules = []string{ModuleFees}
+	if f := st.Evaluate(ModuleTransport); f.Enabled || f.Source != SourcePlan {
+		t.Errorf("transport outside the plan = %+v", f)
+	}
+	if f := st.Evaluate(ModuleStudents); !f.Enabled {
+		t.Errorf("core module outside the plan = %+v", f)
+	}
+}
+
+func TestInRollout(t *testing.T) {
+	in := map[int]int{}
+	for i := 0; i < 2000; i++ {
+		id := fmt.Sprintf("school-%d", i)
+		for _, percent := range []int{10, 50} {
+			if InRollout(id, "beta", percent) {
+				in[percent]++
+			}
+		}
+		// Raising the percentage keeps the schools that had the flag
+		if InRollout(id, "beta", 10) && !InRollout(id, "beta", 50) {
+			t.Fatalf("%s dropped out when the rollout grew", id)
+		}
+	}
+	if in[10] < 140 || in[10] > 260 || in[50] < 900 || in[50] > 1100 {
+		t.Errorf("schools in rollout = %v of 2000", in)
+	}
+	if InRollout("school-1", "beta", 0) || !InRollout("school-1", "beta", 100) {
+		t.Error("0 and 100 percent are not none and all")
+	}
+}
+
+func TestCheckFlagKey(t *testing.T) {
+	for _, key := range []string{"beta", "exams.online-marking", "fees.esewa_v2"} {
+		if err := CheckFlagKey(key); err != nil {
+			t.Errorf("%s: %v", key, err)
+		}
+	}
+	for _, key := range []string{"", "Beta", "exams..online", ".beta", "beta.", ModuleTransport} {
+		if err := CheckFlagKey(key); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("%q: err = %v", key, err)
+		}
+	}
+}
+
+func newTestClient(toggles map[string]map[string]bool, fetches *int) *Client {
+	return &Client{
+		schools: cache.NewTTL[string, *State](time.Minute),
+		flags:   cache.NewTTL[struct{}, map[string]Flag](time.Minute),
+		fetchSchool: func(_ context.Context, code string) (*State, error) {
+			*fetches++
+			t, ok := toggles[code]
+			if !ok {
+				return nil, fmt.Errorf("%w %q", ErrUnknownSchool, code)
+			}
+			return &State{SchoolID: "id-" + code, Toggles: t}, nil
+		},
+		fetchFlags: func(context.Context) (map[string]Flag, error) {
+			return map[string]Flag{}, nil
+		},
+	}
+}
+
+func TestClientCache(t *testing.T) {
+	toggles := map[string]map[string]bool{"eis": {ModuleTransport: true}}
+	fetches := 0
+	c := newTestClient(toggles, &fetches)
+	ctx := context.Background()
+
+	if on, err := c.Enabled(ctx, "eis", ModuleTransport); err != nil || !on {
+		t.Fatalf("transport = %v, %v", on, err)
+	}
+	toggles["eis"] = map[string]bool{ModuleTransport: false}
+	if on, _ := c.Enabled(ctx, "eis", ModuleTransport); !on || fetches != 1 {
+		t.Fatalf("cached transport = %v after %d fetches", on, fetches)
+	}
+
+	event, _ := json.Marshal(FeaturesChanged{SchoolID: "id-eis", Code: "eis", Key: ModuleTransport})
+	c.HandleEvent(event)
+	if on, _ := c.Enabled(ctx, "eis", ModuleTransport); on || fetches != 2 {
+		t.Fatalf("transport after event = %v after %d fetches", on, fetches)
+	}
+
+	if _, err := c.Enabled(ctx, "nope", ModuleTransport); !errors.Is(err, ErrUnknownSchool) {
+		t.Errorf("unknown school: %v", err)
+	}
+}
+
+func TestRequire(t *testing.T) {
+	fetches := 0
+	c := newTestClient(map[string]map[string]bool{"eis": {ModuleExams: false}, "ktm": {}}, &fetches)
+
+	app := fiber.New(fiber.Config{ErrorHandler: problem.ErrorHandler})
+	app.Use(func(ctx *fiber.Ctx) error {
+		if code := ctx.Get(tenant.HeaderCode); code != "" {
+			ctx.Locals(tenant.CodeContextKey, code)
+		}
+		return ctx.Next()
+	})
+	app.Get("/exams", Require(c, ModuleExams), func(ctx *fiber.Ctx) error {
+		return ctx.SendString("ok")
+	})
+
+	for code, want := range map[string]int{"eis": 403, "ktm": 200, "nope": 404, "": 400} {
+		req := httptest.NewRequest("GET", "/exams", nil)
+		req.Header.Set(tenant.HeaderCode, code)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != want {
+			t.Errorf("school %q: status %d, want %d", code, resp.StatusCode, want)
+		}
+		if want == 403 {
+			var p problem.Problem
+			json.NewDecoder(resp.Body).Decode(&p)
+			if p.Code != problem.CodeModuleDisabled {
+				t.Errorf("code = %q, want %q", p.Code, problem.CodeModuleDisabled)
+			}
+		}
+	}
+}
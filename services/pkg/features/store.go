@@ -0,0 +1,266 @@
+package features
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"school-erp/pkg/events"
+)
+
+// Migration creates the tables used by Store in the main database, after
+// the schools and plans tables. The school service includes it in its
+// migration list.
+const Migration = `
+CREATE TABLE IF NOT EXISTS feature_flags (
+	key VARCHAR(100) PRIMARY KEY,
+	description TEXT NOT NULL DEFAULT '',
+	rollout_percent INTEGER NOT NULL DEFAULT 0 CHECK (rollout_percent BETWEEN 0 AND 100),
+	updated_by VARCHAR(255) NOT NULL,
+	updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS school_features (
+	school_id UUID NOT NULL REFERENCES schools(id) ON DELETE CASCADE,
+	key VARCHAR(100) NOT NULL,
+	enabled BOOLEAN NOT NULL,
+	updated_by VARCHAR(255) NOT NULL,
+	updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (school_id, key)
+);
+`
+
+// SubjectFeaturesChanged is the NATS subject of FeaturesChanged events
+const SubjectFeaturesChanged = "SchoolFeaturesChanged"
+
+// FeaturesChanged is published when a school's toggle, plan or a flag
+// changes. Changes that concern every school have no SchoolID or Code.
+type FeaturesChanged struct {
+	SchoolID  string    `json:"school_id,omitempty"`
+	Code      string    `json:"code,omitempty"`
+	Key       string    `json:"key"`
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+// Store reads and writes toggles and flags in the main database
+type Store struct {
+	db      *pgxpool.Pool
+	publish events.Publisher
+}
+
+func NewStore(db *pgxpool.Pool, publish events.Publisher) *Store {
+	return &Store{db: db, publish: publish}
+}
+
+// State returns the school's toggles and plan, and the defined flags. It
+// returns pgx.ErrNoRows for unknown schools.
+func (s *Store) State(ctx context.Context, schoolID string) (*State, error) {
+	_, planModules, err := s.school(ctx, schoolID)
+	if err != nil {
+		return nil, err
+	}
+	toggles, err := loadToggles(ctx, s.db, schoolID)
+	if err != nil {
+		return nil, err
+	}
+	flags, err := loadFlags(ctx, s.db)
+	if err != nil {
+		return nil, err
+	}
+	return &State{SchoolID: schoolID, Toggles: toggles, PlanModules: planModules, Flags: flags}, nil
+}
+
+// school returns the school's code and the modules of its plan
+func (s *Store) school(ctx context.Context, schoolID string) (code string, planModules []string, err error) {
+	err = s.db.QueryRow(ctx, `
+	SELECT sc.code, p.modules FROM schools sc LEFT JOIN plans p ON p.code = sc.plan_code
+	WHERE sc.id = $1`, schoolID,
+	).Scan(&code, &planModules)
+	return code, planModules, err
+}
+
+// List returns the state of every module and flag for the school
+func (s *Store) List(ctx context.Context, schoolID string) ([]Feature, error) {
+	st, err := s.State(ctx, schoolID)
+	if err != nil {
+		return nil, err
+	}
+	return st.All(), nil
+}
+
+// Toggle turns key on or off for the school, overriding the module's
+// default or the flag's rollout. Core modules cannot be turned off, modules
+// outside the school's plan cannot be turned on, and only modules and
+// defined flags can be toggled.
+func (s *Store) Toggle(ctx context.Context, schoolID, key string, enabled bool, actor string) (*Feature, error) {
+	if err := s.toggleable(ctx, key, enabled); err != nil {
+		return nil, err
+	}
+	code, planModules, err := s.school(ctx, schoolID)
+	if err != nil {
+		return nil, err
+	}
+	if st := (State{PlanModules: planModules}); enabled && LookupModule(key) != nil && !st.InPlan(key) {
+		return nil, fmt.Errorf("%w: %s", ErrNotInPlan, key)
+	}
+	_, err = s.db.Exec(ctx, `
+	INSERT INTO school_features (school_id, key, enabled, updated_by)
+	VALUES ($1, $2, $3, $4)
+	ON CONFLICT (school_id, key) DO UPDATE
+	SET enabled = EXCLUDED.enabled, updated_by = EXCLUDED.updated_by, updated_at = CURRENT_TIMESTAMP`,
+		schoolID, key, enabled, actor)
+	if err != nil {
+		return nil, err
+	}
+	s.announce(FeaturesChanged{SchoolID: schoolID, Code: code, Key: key, ChangedAt: time.Now().UTC()})
+	return s.evaluate(ctx, schoolID, key)
+}
+
+// Reset drops the school's toggle of key, so the module's default or the
+// flag's rollout applies again
+func (s *Store) Reset(ctx context.Context, schoolID, key string) (*Feature, error) {
+	if err := s.toggleable(ctx, key, true); err != nil {
+		return nil, err
+	}
+	code, _, err := s.school(ctx, schoolID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.db.Exec(ctx, `DELETE FROM school_features WHERE school_id = $1 AND key = $2`, schoolID, key); err != nil {
+		return nil, err
+	}
+	s.announce(FeaturesChanged{SchoolID: schoolID, Code: code, Key: key, ChangedAt: time.Now().UTC()})
+	return s.evaluate(ctx, schoolID, key)
+}
+
+// toggleable returns ErrUnknownFeature for keys that are neither a module
+// nor a defined flag, and ErrCoreModule for turning a core module off
+func (s *Store) toggleable(ctx context.Context, key string, enabled bool) error {
+	if m := LookupModule(key); m != nil {
+		if m.Core && !enabled {
+			return fmt.Errorf("%w: %s", ErrCoreModule, key)
+		}
+		return nil
+	}
+	var exists bool
+	err := s.db.QueryRow(ctx, `SELECT true FROM feature_flags WHERE key = $1`, key).Scan(&exists)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("%w %q", ErrUnknownFeature, key)
+	}
+	return err
+}
+
+func (s *Store) evaluate(ctx context.Context, schoolID, key string) (*Feature, error) {
+	st, err := s.State(ctx, schoolID)
+	if err != nil {
+		return nil, err
+	}
+	f := st.Evaluate(key)
+	return &f, nil
+}
+
+// Flags returns the defined flags by key
+func (s *Store) Flags(ctx context.Context) ([]Flag, error) {
+	defined, err := loadFlags(ctx, s.db)
+	if err != nil {
+		return nil, err
+	}
+	flags := make([]Flag, 0, len(defined))
+	for _, f := range defined {
+		flags = append(flags, f)
+	}
+	sort.Slice(flags, func(i, j int) bool { return flags[i].Key < flags[j].Key })
+	return flags, nil
+}
+
+// PutFlag defines the flag or changes its description and rollout
+func (s *Store) PutFlag(ctx context.Context, f Flag, actor string) error {
+	if err := CheckFlagKey(f.Key); err != nil {
+		return err
+	}
+	_, err := s.db.Exec(ctx, `
+	INSERT INTO feature_flags (key, description, rollout_percent, updated_by)
+	VALUES ($1, $2, $3, $4)
+	ON CONFLICT (key) DO UPDATE
+	SET description = EXCLUDED.description, rollout_percent = EXCLUDED.rollout_percent,
+		updated_by = EXCLUDED.updated_by, updated_at = CURRENT_TIMESTAMP`,
+		f.Key, f.Description, f.Rollout, actor)
+	if err != nil {
+		return err
+	}
+	s.announce(FeaturesChanged{Key: f.Key, ChangedAt: time.Now().UTC()})
+	return nil
+}
+
+// DeleteFlag removes the flag and every school's toggle of it. It returns
+// ErrUnknownFeature when the flag is not defined.
+func (s *Store) DeleteFlag(ctx context.Context, key string) error {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `DELETE FROM feature_flags WHERE key = $1`, key)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%w %q", ErrUnknownFeature, key)
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM school_features WHERE key = $1`, key); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+	s.announce(FeaturesChanged{Key: key, ChangedAt: time.Now().UTC()})
+	return nil
+}
+
+func loadToggles(ctx context.Context, db *pgxpool.Pool, schoolID string) (map[string]bool, error) {
+	rows, err := db.Query(ctx, `SELECT key, enabled FROM school_features WHERE school_id = $1`, schoolID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	toggles := map[string]bool{}
+	for rows.Next() {
+		var key string
+		var enabled bool
+		if err := rows.Scan(&key, &enabled); err != nil {
+			return nil, err
+		}
+		toggles[key] = enabled
+	}
+	return toggles, rows.Err()
+}
+
+func loadFlags(ctx context.Context, db *pgxpool.Pool) (map[string]Flag, error) {
+	rows, err := db.Query(ctx, `SELECT key, description, rollout_percent FROM feature_flags`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	flags := map[string]Flag{}
+	for rows.Next() {
+		var f Flag
+		if err := rows.Scan(&f.Key, &f.Description, &f.Rollout); err != nil {
+			return nil, err
+		}
+		flags[f.Key] = f
+	}
+	return flags, rows.Err()
+}
+
+// announce publishes a FeaturesChanged event
+func (s *Store) announce(e FeaturesChanged) {
+	events.Send(s.publish, SubjectFeaturesChanged, e)
+}
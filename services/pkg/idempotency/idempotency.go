@@ -0,0 +1,195 @@
+// Package idempotency provides an Idempotency-Key middleware for Fiber services.
+//
+// A client sends the same Idempotency-Key header when it retries a mutating
+// request. The first request is executed and its response stored per tenant
+// and key; retries with the same payload get the stored response replayed,
+// and retries with a different payload are rejected.
+package idempotency
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"school-erp/pkg/problem"
+)
+
+// HeaderKey is the request header carrying the client's idempotency key.
+const HeaderKey = "Idempotency-Key"
+
+// HeaderReplayed is set on responses served from the store.
+const HeaderReplayed = "Idempotent-Replayed"
+
+// ErrNotFound is returned by Store.Get when no live record exists for a key.
+var ErrNotFound = errors.New("idempotency: key not found")
+
+// Record is a stored request fingerprint and, once completed, its response.
+type Record struct {
+	Tenant      string
+	Key         string
+	Fingerprint string
+	Completed   bool
+	StatusCode  int
+	ContentType string
+	Body        []byte
+	ExpiresAt   time.Time
+}
+
+// Store persists idempotency records.
+type Store interface {
+	// Get returns the live record for tenant/key or ErrNotFound.
+	Get(ctx context.Context, tenant, key string) (*Record, error)
+	// Reserve inserts an in-flight record. It returns false without error when
+	// a live record already exists for tenant/key.
+	Reserve(ctx context.Context, rec *Record) (bool, error)
+	// Complete stores the response for a reserved record.
+	Complete(ctx context.Context, rec *Record) error
+	// Release removes a reserved record so the request can be retried.
+	Release(ctx context.Context, tenant, key string) error
+}
+
+// Config configures the middleware.
+type Config struct {
+	Store Store
+	// TTL is how long a key and its response are remembered. Defaults to 24h.
+	TTL time.Duration
+	// Required rejects mutating requests that carry no Idempotency-Key.
+	Required bool
+	// TenantFunc scopes keys to a tenant. It is required and must return the
+	// tenant resolved for the request, such as tenant.Code, never a value the
+	// client sends.
+	TenantFunc func(c *fiber.Ctx) string
+}
+
+// New returns the Idempotency-Key middleware. It panics when cfg has no
+// TenantFunc.
+func New(cfg Config) fiber.Handler {
+	if cfg.TenantFunc == nil {
+		panic("idempotency: Config.TenantFunc is required")
+	}
+	if cfg.TTL <= 0 {
+		cfg.TTL = 24 * time.Hour
+	}
+
+	return func(c *fiber.Ctx) error {
+		if !isMutating(c.Method()) {
+			return c.Next()
+		}
+
+		key := c.Get(HeaderKey)
+		if key == "" {
+			if cfg.Required {
+				return problem.BadRequest(problem.CodeBadRequest, "Idempotency-Key header is required")
+			}
+			return c.Next()
+		}
+		if len(key) > 255 {
+			return problem.BadRequest(problem.CodeBadRequest, "Idempotency-Key must be at most 255 characters")
+		}
+
+		ctx := c.UserContext()
+		tenant := cfg.TenantFunc(c)
+		fingerprint := Fingerprint(c.Method(), c.Path(), c.Body())
+
+		rec := &Record{
+			Tenant:      tenant,
+			Key:         key,
+			Fingerprint: fingerprint,
+			ExpiresAt:   time.Now().Add(cfg.TTL),
+		}
+
+		reserved, err := cfg.Store.Reserve(ctx, rec)
+		if err != nil {
+			return problem.Internal("Failed to process idempotency key", err)
+		}
+
+		if !reserved {
+			existing, err := cfg.Store.Get(ctx, tenant, key)
+			if err != nil {
+				if errors.Is(err, ErrNotFound) {
+					// The previous record expired between Reserve and Get.
+					return problem.Conflict(problem.CodeIdempotencyInFlight, "Request with this Idempotency-Key is being retried, please try again")
+				}
+				return problem.Internal("Failed to process idempotency key", err)
+			}
+			return replay(c, existing, fingerprint)
+		}
+
+		// A panicking handler must not leave the key in flight until it expires
+		defer func() {
+			if r := recover(); r != nil {
+				releaseKey(ctx, cfg.Store, tenant, key)
+				panic(r)
+			}
+		}()
+
+		if err := c.Next(); err != nil {
+			// Render the error now so client errors are stored and replayed too.
+			if herr := c.App().Config().ErrorHandler(c, err); herr != nil {
+				releaseKey(ctx, cfg.Store, tenant, key)
+				return herr
+			}
+		}
+
+		status := c.Response().StatusCode()
+		if status >= fiber.StatusInternalServerError {
+			releaseKey(ctx, cfg.Store, tenant, key)
+			return nil
+		}
+
+		rec.Completed = true
+		rec.StatusCode = status
+		rec.ContentType = string(c.Response().Header.ContentType())
+		rec.Body = append([]byte(nil), c.Response().Body()...)
+		if err := cfg.Store.Complete(ctx, rec); err != nil {
+			log.Printf("Idempotency store complete failed for key %s: %v\n", key, err)
+		}
+		return nil
+	}
+}
+
+// Fingerprint identifies a request by method, path and body.
+func Fingerprint(method, path string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(method))
+	h.Write([]byte{0})
+	h.Write([]byte(path))
+	h.Write([]byte{0})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// replay answers a retried request from an existing record.
+func replay(c *fiber.Ctx, rec *Record, fingerprint string) error {
+	if rec.Fingerprint != fingerprint {
+		return problem.Unprocessable(problem.CodeIdempotencyMismatch, "Idempotency-Key was already used with a different request payload")
+	}
+	if !rec.Completed {
+		return problem.Conflict(problem.CodeIdempotencyInFlight, "A request with this Idempotency-Key is still in progress")
+	}
+
+	c.Set(HeaderReplayed, "true")
+	if rec.ContentType != "" {
+		c.Set(fiber.HeaderContentType, rec.ContentType)
+	}
+	return c.Status(rec.StatusCode).Send(rec.Body)
+}
+
+func releaseKey(ctx context.Context, store Store, tenant, key string) {
+	if err := store.Release(ctx, tenant, key); err != nil {
+		log.Printf("Idempotency store release failed for key %s: %v\n", key, err)
+	}
+}
+
+func isMutating(method string) bool {
+	switch method {
+	case fiber.MethodPost, fiber.MethodPut, fiber.MethodPatch, fiber.MethodDelete:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,163 @@
+package idempotency
+
+import (
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	fiberrecover "github.com/gofiber/fiber/v2/middleware/recover"
+
+	"school-erp/pkg/problem"
+)
+
+func newTestApp(store Store, calls *int) *fiber.App {
+	app := fiber.New(fiber.Config{ErrorHandler: problem.ErrorHandler})
+	app.Use(fiberrecover.New())
+	// The header stands in for the tenant a resolver middleware would set
+	app.Use(New(Config{Store: store, TenantFunc: func(c *fiber.Ctx) string {
+		return c.Get("X-Tenant-Code")
+	}}))
+	app.Post("/payments", func(c *fiber.Ctx) error {
+		*calls++
+		return c.Status(fiber.StatusCreated).JSON(fiber.Map{"payment": *calls})
+	})
+	app.Post("/fail", func(c *fiber.Ctx) error {
+		*calls++
+		return errors.New("boom")
+	})
+	app.Post("/panic", func(c *fiber.Ctx) error {
+		*calls++
+		panic("boom")
+	})
+	app.Post("/conflict", func(c *fiber.Ctx) error {
+		*calls++
+		return problem.Conflict(problem.CodeAlreadyExists, "Payment already exists")
+	})
+	return app
+}
+
+func doRequest(t *testing.T, app *fiber.App, path, key, tenant, body string) (int, string, string) {
+	t.Helper()
+	req := httptest.NewRequest("POST", path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if key != "" {
+		req.Header.Set(HeaderKey, key)
+	}
+	if tenant != "" {
+		req.Header.Set("X-Tenant-Code", tenant)
+	}
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("app.Test() error = %v", err)
+	}
+	data, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(data), resp.Header.Get(HeaderReplayed)
+}
+
+func TestReplaysStoredResponse(t *testing.T) {
+	calls := 0
+	app := newTestApp(NewMemoryStore(), &calls)
+
+	status, body, replayed := doRequest(t, app, "/payments", "k1", "eis", `{"amount":100}`)
+	if status != fiber.StatusCreated || replayed != "" {
+		t.Fatalf("first request status = %d replayed = %q", status, replayed)
+	}
+
+	status2, body2, replayed2 := doRequest(t, app, "/payments", "k1", "eis", `{"amount":100}`)
+	if status2 != fiber.StatusCreated || body2 != body || replayed2 != "true" {
+		t.Errorf("retry status = %d body = %s replayed = %q, want replay of %s", status2, body2, replayed2, body)
+	}
+	if calls != 1 {
+		t.Errorf("handler called %d times, want 1", calls)
+	}
+}
+
+func TestRejectsDifferentPayload(t *testing.T) {
+	calls := 0
+	app := newTestApp(NewMemoryStore(), &calls)
+
+	doRequest(t, app, "/payments", "k1", "eis", `{"amount":100}`)
+	status, _, _ := doRequest(t, app, "/payments", "k1", "eis", `{"amount":200}`)
+	if status != fiber.StatusUnprocessableEntity {
+		t.Errorf("status = %d, want 422", status)
+	}
+	if calls != 1 {
+		t.Errorf("handler called %d times, want 1", calls)
+	}
+}
+
+func TestKeysAreScopedPerTenant(t *testing.T) {
+	calls := 0
+	app := newTestApp(NewMemoryStore(), &calls)
+
+	doRequest(t, app, "/payments", "k1", "eis", `{"amount":100}`)
+	status, _, replayed := doRequest(t, app, "/payments", "k1", "kmc", `{"amount":100}`)
+	if status != fiber.StatusCreated || replayed != "" {
+		t.Errorf("other tenant status = %d replayed = %q, want fresh execution", status, replayed)
+	}
+	if calls != 2 {
+		t.Errorf("handler called %d times, want 2", calls)
+	}
+}
+
+func TestServerErrorsReleaseKey(t *testing.T) {
+	calls := 0
+	app := newTestApp(NewMemoryStore(), &calls)
+
+	doRequest(t, app, "/fail", "k1", "eis", `{}`)
+	doRequest(t, app, "/fail", "k1", "eis", `{}`)
+	if calls != 2 {
+		t.Errorf("handler called %d times, want failed requests to be retryable", calls)
+	}
+}
+
+func TestPanicsReleaseKey(t *testing.T) {
+	calls := 0
+	app := newTestApp(NewMemoryStore(), &calls)
+
+	status, _, _ := doRequest(t, app, "/panic", "k1", "eis", `{}`)
+	if status != fiber.StatusInternalServerError {
+		t.Fatalf("status = %d, want 500", status)
+	}
+	doRequest(t, app, "/panic", "k1", "eis", `{}`)
+	if calls != 2 {
+		t.Errorf("handler called %d times, want the key released after a panic", calls)
+	}
+}
+
+func TestRequiresTenantFunc(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("New without TenantFunc did not panic")
+		}
+	}()
+	New(Config{Store: NewMemoryStore()})
+}
+
+func TestWithoutKeyPassesThrough(t *testing.T) {
+	calls := 0
+	app := newTestApp(NewMemoryStore(), &calls)
+
+	doRequest(t, app, "/payments", "", "eis", `{}`)
+	doRequest(t, app, "/payments", "", "eis", `{}`)
+	if calls != 2 {
+		t.Errorf("handler called %d times, want 2", calls)
+	}
+}
+
+func TestClientErrorsAreReplayed(t *testing.T) {
+	calls := 0
+	app := newTestApp(NewMemoryStore(), &calls)
+
+	doRequest(t, app, "/conflict", "k1", "eis", `{}`)
+	status, _, replayed := doRequest(t, app, "/conflict", "k1", "eis", `{}`)
+	if status != fiber.StatusConflict || replayed != "true" {
+		t.Errorf("retry status = %d replayed = %q, want replayed 409", status, replayed)
+	}
+	if calls != 1 {
+		t.Errorf("handler called %d times, want 1", calls)
+	}
+}
@@ -0,0 +1,201 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Migration creates the table used by PostgresStore. Services include it in
+// their migration list.
+const Migration = `
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+	tenant VARCHAR(100) NOT NULL DEFAULT '',
+	key VARCHAR(255) NOT NULL,
+	fingerprint VARCHAR(64) NOT NULL,
+	completed BOOLEAN NOT NULL DEFAULT false,
+	status_code INT,
+	content_type VARCHAR(255),
+	response BYTEA,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	expires_at TIMESTAMP NOT NULL,
+	PRIMARY KEY (tenant, key)
+);
+
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_expires_at ON idempotency_keys(expires_at);
+`
+
+// PostgresStore keeps idempotency records in the idempotency_keys table.
+type PostgresStore struct {
+	db *pgxpool.Pool
+}
+
+// NewPostgresStore creates a store backed by db.
+func NewPostgresStore(db *pgxpool.Pool) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+// Get returns the live record for tenant/key.
+func (s *PostgresStore) Get(ctx context.Context, tenant, key string) (*Record, error) {
+	rec := &Record{Tenant: tenant, Key: key}
+	var statusCode *int
+	var contentType *string
+	err := s.db.QueryRow(ctx, `
+		SELECT fingerprint, completed, status_code, content_type, response, expires_at
+		FROM idempotency_keys
+		WHERE tenant = $1 AND key = $2 AND expires_at > NOW()`,
+		tenant, key,
+	).Scan(&rec.Fingerprint, &rec.Completed, &statusCode, &contentType, &rec.Body, &rec.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("failed to load idempotency key: %w", err)
+	}
+	if statusCode != nil {
+		rec.StatusCode = *statusCode
+	}
+	if contentType != nil {
+		rec.ContentType = *contentType
+	}
+	return rec, nil
+}
+
+// Reserve inserts an in-flight record, taking over an expired one if present.
+func (s *PostgresStore) Reserve(ctx context.Context, rec *Record) (bool, error) {
+	tag, err := s.db.Exec(ctx, `
+		INSERT INTO idempotency_keys (tenant, key, fingerprint, expires_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (tenant, key) DO UPDATE
+		SET fingerprint = EXCLUDED.fingerprint,
+			completed = false,
+			status_code = NULL,
+			content_type = NULL,
+			response = NULL,
+			created_at = CURRENT_TIMESTAMP,
+			expires_at = EXCLUDED.expires_at
+		WHERE idempotency_keys.expires_at <= NOW()`,
+		rec.Tenant, rec.Key, rec.Fingerprint, rec.ExpiresAt,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to reserve idempotency key: %w", err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// Complete stores the response for a reserved record.
+func (s *PostgresStore) Complete(ctx context.Context, rec *Record) error {
+	_, err := s.db.Exec(ctx, `
+		UPDATE idempotency_keys
+		SET completed = true, status_code = $3, content_type = $4, response = $5
+		WHERE tenant = $1 AND key = $2`,
+		rec.Tenant, rec.Key, rec.StatusCode, rec.ContentType, rec.Body,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to store idempotent response: %w", err)
+	}
+	return nil
+}
+
+// Release removes an in-flight record.
+func (s *PostgresStore) Release(ctx context.Context, tenant, key string) error {
+	_, err := s.db.Exec(ctx,
+		`DELETE FROM idempotency_keys WHERE tenant = $1 AND key = $2 AND completed = false`,
+		tenant, key,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to release idempotency key: %w", err)
+	}
+	return nil
+}
+
+// PurgeExpired deletes expired records and returns how many were removed.
+func (s *PostgresStore) PurgeExpired(ctx context.Context) (int64, error) {
+	tag, err := s.db.Exec(ctx, `DELETE FROM idempotency_keys WHERE expires_at <= NOW()`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge idempotency keys: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// Run purges expired records every interval until ctx is done, so the
+// table only keeps live keys
+func (s *PostgresStore) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if n, err := s.PurgeExpired(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("Idempotency purge: %v\n", err)
+		} else if n > 0 {
+			log.Printf("Purged %d expired idempotency keys\n", n)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// MemoryStore is an in-process Store for tests and single-instance development.
+type MemoryStore struct {
+	mu      sync.Mutex
+	records map[string]*Record
+}
+
+// NewMemoryStore creates an empty in-memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{records: make(map[string]*Record)}
+}
+
+func (s *MemoryStore) Get(_ context.Context, tenant, key string) (*Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rec, ok := s.records[tenant+"\x00"+key]
+	if !ok || time.Now().After(rec.ExpiresAt) {
+		return nil, ErrNotFound
+	}
+	copied := *rec
+	return &copied, nil
+}
+
+func (s *MemoryStore) Reserve(_ context.Context, rec *Record) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := rec.Tenant + "\x00" + rec.Key
+	if existing, ok := s.records[id]; ok && time.Now().Before(existing.ExpiresAt) {
+		return false, nil
+	}
+	copied := *rec
+	s.records[id] = &copied
+	return true, nil
+}
+
+func (s *MemoryStore) Complete(_ context.Context, rec *Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	copied := *rec
+	s.records[rec.Tenant+"\x00"+rec.Key] = &copied
+	return nil
+}
+
+func (s *MemoryStore) Release(_ context.Context, tenant, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := tenant + "\x00" + key
+	if rec, ok := s.records[id]; ok && !rec.Completed {
+		delete(s.records, id)
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// Model is the schema of a Go type with the components it refers to. It
+// validates JSON documents that are not request or response bodies, such as
+// stored settings, and serves as their JSON Schema.
+type Model struct {
+	Schema     *Schema `json:"schema"`
+	Components struct {
+		Schemas map[string]*Schema `json:"schemas,omitempty"`
+	} `json:"components"`
+}
+
+// ModelOf generates the model of v's type the way Build documents bodies
+func ModelOf(v interface{}) *Model {
+	gen := newGenerator()
+	m := &Model{Schema: gen.schemaFor(v)}
+	m.Components.Schemas = gen.schemas
+	return m
+}
+
+// Validate checks that data is one JSON value matching the model. Like
+// ValidateResponse it rejects properties the schema does not declare.
+func (m *Model) Validate(data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var value interface{}
+	if err := dec.Decode(&value); err != nil {
+		return fmt.Errorf("invalid JSON: %v", err)
+	}
+	if dec.More() {
+		return fmt.Errorf("invalid JSON: data after the value")
+	}
+	return schemaSet(m.Components.Schemas).validate(m.Schema, value, "$")
+}
@@ -0,0 +1,328 @@
+// Package openapi generates an OpenAPI 3 document for a Fiber app from the
+// routes registered on it and the Go types its handlers bind and return,
+// and validates real responses against that document in contract tests.
+//
+// Each service lists its operations next to its route registrations:
+//
+//	var Operations = []openapi.Operation{
+//		{Method: "POST", Path: "/api/v1/transport/buses", Summary: "Create a bus", Auth: true,
+//			Request: models.Bus{}, Responses: openapi.Responses{201: models.Bus{}}},
+//	}
+//
+//	app.Get("/openapi.json", openapi.Handler(app, info, routes.Operations))
+//
+// Every route registered on the app appears in the document. Routes without
+// an Operation, and Operations without a route, are reported in
+// Document.Drift so a test can fail when the two fall out of step.
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+
+	"school-erp/pkg/problem"
+	"school-erp/pkg/query"
+)
+
+// Version is the OpenAPI version of generated documents.
+const Version = "3.0.3"
+
+// MethodAll documents a route registered with app.All.
+const MethodAll = "ALL"
+
+// Info describes the service.
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// Responses maps a success status to the value the handler returns. A nil
+// value documents an empty body. Error responses are always documented as
+// problem+json and need not be listed.
+type Responses map[int]interface{}
+
+// Param is an OpenAPI parameter object.
+type Param struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+// Operation documents one route.
+type Operation struct {
+	Method    string // HTTP method, or MethodAll
+	Path      string // Fiber syntax, e.g. /api/v1/schools/:id
+	Summary   string
+	Tags      []string
+	Auth      bool        // requires a bearer token
+	Params    []Param     // query and header parameters; path parameters are derived
+	Request   interface{} // request body value; nil for none
+	Responses Responses
+}
+
+// Document is a generated OpenAPI document.
+type Document struct {
+	OpenAPI    string                                 `json:"openapi"`
+	Info       Info                                   `json:"info"`
+	Paths      map[string]map[string]*operationObject `json:"paths"`
+	Components components                             `json:"components"`
+
+	// Drift lists registered routes without an Operation and Operations
+	// without a registered route. It is empty when the document is complete.
+	Drift []string `json:"-"`
+}
+
+type components struct {
+	Schemas         map[string]*Schema     `json:"schemas"`
+	SecuritySchemes map[string]interface{} `json:"securitySchemes"`
+}
+
+type operationObject struct {
+	Summary     string                `json:"summary,omitempty"`
+	Tags        []string              `json:"tags,omitempty"`
+	Parameters  []Param               `json:"parameters,omitempty"`
+	RequestBody *requestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]*response  `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+}
+
+type requestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]mediaType `json:"content"`
+}
+
+type response struct {
+	Description string               `json:"description"`
+	Content     map[string]mediaType `json:"content,omitempty"`
+}
+
+type mediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// skippedMethods are added implicitly by Fiber or never documented.
+var skippedMethods = map[string]bool{
+	fiber.MethodHead:    true,
+	fiber.MethodOptions: true,
+	fiber.MethodConnect: true,
+	fiber.MethodTrace:   true,
+}
+
+// Build generates the document for every route registered on app.
+func Build(app *fiber.App, info Info, ops []Operation) *Document {
+	gen := newGenerator()
+	doc := &Document{
+		OpenAPI: Version,
+		Info:    info,
+		Paths:   map[string]map[string]*operationObject{},
+		Components: components{
+			Schemas: gen.schemas,
+			SecuritySchemes: map[string]interface{}{
+				"bearerAuth": map[string]string{"type": "http", "scheme": "bearer", "bearerFormat": "JWT"},
+			},
+		},
+	}
+	problemSchema := gen.schemaFor(problem.Problem{})
+
+	documented := make(map[string]*Operation, len(ops))
+	used := make(map[string]bool, len(ops))
+	for i := range ops {
+		documented[ops[i].Method+" "+ops[i].Path] = &ops[i]
+	}
+
+	for _, route := range app.GetRoutes(true) {
+		if skippedMethods[route.Method] || route.Path == "*" || route.Path == "/*" {
+			continue
+		}
+		key := route.Method + " " + route.Path
+		op, ok := documented[key]
+		if !ok {
+			key = MethodAll + " " + route.Path
+			op, ok = documented[key]
+		}
+		if ok {
+			used[key] = true
+		} else {
+			doc.Drift = append(doc.Drift, "undocumented route "+route.Method+" "+route.Path)
+			op = &Operation{}
+		}
+
+		path, params := convertPath(route.Path)
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = map[string]*operationObject{}
+		}
+		doc.Paths[path][strings.ToLower(route.Method)] = buildOperation(gen, op, params, problemSchema)
+	}
+
+	for key := range documented {
+		if !used[key] {
+			doc.Drift = append(doc.Drift, "documented operation has no route: "+key)
+		}
+	}
+	sort.Strings(doc.Drift)
+	return doc
+}
+
+func buildOperation(gen *generator, op *Operation, params []Param, problemSchema *Schema) *operationObject {
+	obj := &operationObject{
+		Summary:    op.Summary,
+		Tags:       op.Tags,
+		Parameters: append(params, op.Params...),
+		Responses: map[string]*response{
+			"default": {
+				Description: "Error",
+				Content:     map[string]mediaType{problem.ContentType: {Schema: problemSchema}},
+			},
+		},
+	}
+	if op.Auth {
+		obj.Security = []map[string][]string{{"bearerAuth": {}}}
+	}
+	if op.Request != nil {
+		obj.RequestBody = &requestBody{Required: true, Content: content(gen, op.Request)}
+	}
+	for status, body := range op.Responses {
+		obj.Responses[strconv.Itoa(status)] = &response{
+			Description: http.StatusText(status),
+			Content:     content(gen, body),
+		}
+	}
+	return obj
+}
+
+func content(gen *generator, body interface{}) map[string]mediaType {
+	if body == nil {
+		return nil
+	}
+	contentType := fiber.MIMEApplicationJSON
+	if raw, ok := body.(Raw); ok {
+		contentType = raw.ContentType
+	}
+	return map[string]mediaType{contentType: {Schema: gen.schemaFor(body)}}
+}
+
+// convertPath turns Fiber route syntax into an OpenAPI path template and
+// its path parameters.
+func convertPath(path string) (string, []Param) {
+	var params []Param
+	segments := strings.Split(path, "/")
+	for i, seg := range segments {
+		name := ""
+		switch {
+		case strings.HasPrefix(seg, ":"):
+			name = strings.TrimSuffix(seg[1:], "?")
+		case seg == "*" || seg == "+":
+			name = "path"
+		case strings.HasSuffix(seg, "*"):
+			// Wildcard suffixes such as "/files*".
+			segments[i] = strings.TrimSuffix(seg, "*")
+			segments = append(segments, "{path}")
+			params = append(params, pathParam("path"))
+			continue
+		default:
+			continue
+		}
+		segments[i] = "{" + name + "}"
+		params = append(params, pathParam(name))
+	}
+	return strings.Join(segments, "/"), params
+}
+
+func pathParam(name string) Param {
+	return Param{Name: name, In: "path", Required: true, Schema: &Schema{Type: "string"}}
+}
+
+// ListParams documents the query parameters a list endpoint accepts for r.
+func ListParams(r *query.Resource) []Param {
+	var sortable, names []string
+	for name, f := range r.Fields {
+		names = append(names, name)
+		if f.Sort {
+			sortable = append(sortable, name)
+		}
+	}
+	sort.Strings(names)
+	sort.Strings(sortable)
+
+	params := []Param{
+		{Name: "limit", In: "query", Description: fmt.Sprintf("Page size, at most %d", r.MaxLimit), Schema: &Schema{Type: "integer"}},
+		{Name: "cursor", In: "query", Description: "next_cursor from the previous page", Schema: &Schema{Type: "string"}},
+		{Name: "sort", In: "query", Description: fmt.Sprintf("Comma-separated fields, \"-\" for descending. Default %q. Sortable: %s",
+			r.DefaultSort, strings.Join(sortable, ", ")), Schema: &Schema{Type: "string"}},
+		{Name: "fields", In: "query", Description: "Comma-separated sparse fieldset", Schema: &Schema{Type: "string"}},
+	}
+	for _, name := range names {
+		f := r.Fields[name]
+		if !f.Filter {
+			continue
+		}
+		params = append(params, Param{
+			Name:        "filter[" + name + "]",
+			In:          "query",
+			Description: "Equality filter; filter[" + name + "][op] accepts eq ne gt gte lt lte like in",
+			Schema:      fieldSchema(f.Type),
+		})
+	}
+	return params
+}
+
+func fieldSchema(t query.Type) *Schema {
+	switch t {
+	case query.Int:
+		return &Schema{Type: "integer"}
+	case query.Float:
+		return &Schema{Type: "number"}
+	case query.Bool:
+		return &Schema{Type: "boolean"}
+	case query.Time:
+		return &Schema{Type: "string", Format: "date-time"}
+	case query.UUID:
+		return &Schema{Type: "string", Format: "uuid"}
+	}
+	return &Schema{Type: "string"}
+}
+
+// Handler serves the document as JSON. It is built on first request, after
+// all routes have been registered.
+func Handler(app *fiber.App, info Info, ops []Operation) fiber.Handler {
+	var (
+		once sync.Once
+		body []byte
+		err  error
+	)
+	return func(c *fiber.Ctx) error {
+		once.Do(func() {
+			body, err = json.Marshal(Build(app, info, ops))
+		})
+		if err != nil {
+			return problem.Internal("Failed to generate API document", err)
+		}
+		c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		return c.Send(body)
+	}
+}
+
+// operation returns the documented operation for an OpenAPI path template
+// and method, or nil.
+func (d *Document) operation(method, template string) *operationObject {
+	return d.Paths[template][strings.ToLower(method)]
+}
+
+// schemaType reports the reflected type name, used in error messages.
+func schemaType(v interface{}) string {
+	if v == nil {
+		return "null"
+	}
+	return reflect.TypeOf(v).String()
+}
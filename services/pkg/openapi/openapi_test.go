@@ -0,0 +1,230 @@
+package openapi
+
+import (
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"school-erp/pkg/problem"
+	"school-erp/pkg/query"
+)
+
+type widget struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name" validate:"required,min=2,max=50"`
+	Kind      string    `json:"kind" validate:"oneof=small large"`
+	Count     int       `json:"count"`
+	Owner     *owner    `json:"owner,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	secret    string
+}
+
+type owner struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+var widgetResource = &query.Resource{
+	Fields: map[string]query.Field{
+		"id":   {Column: "id", Type: query.String, Sort: true},
+		"name": {Column: "name", Type: query.String, Filter: true, Sort: true},
+	},
+	Key:          "id",
+	DefaultSort:  "name",
+	DefaultLimit: 10,
+	MaxLimit:     50,
+}
+
+func newTestApp(ops []Operation) *fiber.App {
+	app := fiber.New(fiber.Config{ErrorHandler: problem.ErrorHandler})
+	app.Get("/openapi.json", Handler(app, Info{Title: "Widgets", Version: "1.0.0"}, ops))
+	app.Get("/widgets", func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{"data": []widget{{ID: "w1", Name: "Gear", Kind: "small"}}, "pagination": fiber.Map{"limit": 10, "has_more": false, "next_cursor": nil}})
+	})
+	app.Get("/widgets/:id", func(c *fiber.Ctx) error {
+		if c.Params("id") == "missing" {
+			return problem.NotFound("Widget not found")
+		}
+		return c.JSON(fiber.Map{"id": c.Params("id"), "name": "Gear", "colour": "red"})
+	})
+	return app
+}
+
+var testOps = []Operation{
+	{Method: "GET", Path: "/openapi.json", Summary: "API document", Responses: Responses{200: Any}},
+	{Method: "GET", Path: "/widgets", Summary: "List widgets", Params: ListParams(widgetResource), Responses: Responses{200: Page(widget{})}},
+	{Method: "GET", Path: "/widgets/:id", Summary: "Get a widget", Auth: true, Responses: Responses{200: widget{}}},
+}
+
+func TestBuildGeneratesSchemasFromStructs(t *testing.T) {
+	doc := Build(newTestApp(testOps), Info{Title: "Widgets", Version: "1.0.0"}, testOps)
+	if len(doc.Drift) != 0 {
+		t.Fatalf("unexpected drift: %v", doc.Drift)
+	}
+
+	w := doc.Components.Schemas["widget"]
+	if w == nil {
+		t.Fatalf("widget schema not registered: %v", doc.Components.Schemas)
+	}
+	if _, ok := w.Properties["secret"]; ok {
+		t.Error("unexported field documented")
+	}
+	if len(w.Required) != 1 || w.Required[0] != "name" {
+		t.Errorf("required = %v, want [name]", w.Required)
+	}
+	name := w.Properties["name"]
+	if *name.MinLength != 2 || *name.MaxLength != 50 {
+		t.Errorf("name bounds = %d..%d", *name.MinLength, *name.MaxLength)
+	}
+	if kind := w.Properties["kind"]; len(kind.Enum) != 2 {
+		t.Errorf("kind enum = %v", kind.Enum)
+	}
+	if f := w.Properties["created_at"].Format; f != "date-time" {
+		t.Errorf("created_at format = %q", f)
+	}
+	if ref := w.Properties["owner"].Ref; ref != "#/components/schemas/owner" {
+		t.Errorf("owner ref = %q", ref)
+	}
+	if f := doc.Components.Schemas["owner"].Properties["email"].Format; f != "email" {
+		t.Errorf("email format = %q", f)
+	}
+
+	get := doc.Paths["/widgets/{id}"]["get"]
+	if get == nil || len(get.Parameters) != 1 || get.Parameters[0].In != "path" {
+		t.Fatalf("path parameter not generated: %+v", get)
+	}
+	if len(get.Security) != 1 {
+		t.Error("auth operation has no security requirement")
+	}
+	if _, ok := get.Responses["default"].Content[problem.ContentType]; !ok {
+		t.Error("default response is not problem+json")
+	}
+
+	var filter bool
+	for _, p := range doc.Paths["/widgets"]["get"].Parameters {
+		filter = filter || p.Name == "filter[name]"
+	}
+	if !filter {
+		t.Error("list parameters missing filter[name]")
+	}
+}
+
+func TestBuildReportsDrift(t *testing.T) {
+	ops := append([]Operation{{Method: "DELETE", Path: "/widgets/:id", Summary: "Delete a widget"}}, testOps[1:]...)
+	doc := Build(newTestApp(testOps), Info{}, ops)
+
+	want := []string{
+		"documented operation has no route: DELETE /widgets/:id",
+		"undocumented route GET /openapi.json",
+	}
+	if strings.Join(doc.Drift, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("drift = %q, want %q", doc.Drift, want)
+	}
+}
+
+func TestHandlerServesDocument(t *testing.T) {
+	app := newTestApp(testOps)
+	resp, err := app.Test(httptest.NewRequest("GET", "/openapi.json", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc["openapi"] != Version {
+		t.Errorf("openapi = %v", doc["openapi"])
+	}
+	if _, ok := doc["paths"].(map[string]interface{})["/widgets/{id}"]; !ok {
+		t.Error("document missing /widgets/{id}")
+	}
+}
+
+func TestValidateResponse(t *testing.T) {
+	app := newTestApp(testOps)
+	doc := Build(app, Info{}, testOps)
+
+	check := func(path string) error {
+		resp, err := app.Test(httptest.NewRequest("GET", path, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		return doc.ValidateResponse("GET", path, resp.StatusCode, resp.Header.Get("Content-Type"), body)
+	}
+
+	if err := check("/widgets"); err != nil {
+		t.Errorf("list: %v", err)
+	}
+	if err := check("/widgets/missing"); err != nil {
+		t.Errorf("problem response: %v", err)
+	}
+	err := check("/widgets/w1")
+	if err == nil || !strings.Contains(err.Error(), `undocumented property "colour"`) {
+		t.Errorf("expected undocumented property error, got %v", err)
+	}
+}
+
+func TestValidateResponseTypes(t *testing.T) {
+	doc := Build(newTestApp(testOps), Info{}, testOps)
+
+	cases := []struct {
+		body string
+		want string
+	}{
+		{`{"id":"w1","name":"Gear","count":"3"}`, "$.count: expected integer"},
+		{`{"id":"w1","name":"Gear","kind":"huge"}`, "$.kind: huge is not one of"},
+		{`{"id":"w1"}`, `missing required property "name"`},
+		{`{"name":"Gear","created_at":"yesterday"}`, "is not a date-time"},
+		{`{"name":"Gear","owner":{"email":1}}`, "$.owner.email: expected string"},
+		{`{"name":"G"}`, "$.name: length 1 is out of bounds"},
+	}
+	for _, tc := range cases {
+		err := doc.ValidateResponse("GET", "/widgets/w1", 200, "application/json", []byte(tc.body))
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: got %v, want %q", tc.body, err, tc.want)
+		}
+	}
+
+	if err := doc.ValidateResponse("GET", "/widgets/w1", 201, "application/json", []byte(`{}`)); err == nil {
+		t.Error("undocumented status accepted")
+	}
+	if err := doc.ValidateResponse("GET", "/gadgets", 200, "application/json", []byte(`{}`)); err == nil {
+		t.Error("undocumented path accepted")
+	}
+}
+
+func TestModelValidate(t *testing.T) {
+	m := ModelOf(widget{})
+	if err := m.Validate([]byte(`{"name":"Gear","owner":{"email":"a@b.c"}}`)); err != nil {
+		t.Fatal(err)
+	}
+	for _, body := range []string{`{"name":"Gear","colour":"red"}`, `{"name":"Gear","owner":{}}`, `{"name":"Gear"} {}`, `[]`} {
+		if err := m.Validate([]byte(body)); err == nil {
+			t.Errorf("%s was accepted", body)
+		}
+	}
+
+	data, _ := json.Marshal(m)
+	if !strings.Contains(string(data), `"$ref":"#/components/schemas/owner"`) || !strings.Contains(string(data), `"components":{"schemas":{"owner":`) {
+		t.Errorf("model = %s", data)
+	}
+}
+
+func TestConvertPath(t *testing.T) {
+	cases := map[string]string{
+		"/api/v1/schools/:id":         "/api/v1/schools/{id}",
+		"/api/v1/schools/:code/stats": "/api/v1/schools/{code}/stats",
+		"/api/v1/transport/traccar/*": "/api/v1/transport/traccar/{path}",
+		"/uploads*":                   "/uploads/{path}",
+	}
+	for in, want := range cases {
+		if got, _ := convertPath(in); got != want {
+			t.Errorf("convertPath(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
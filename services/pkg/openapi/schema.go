@@ -0,0 +1,312 @@
+package openapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schema is the subset of the OpenAPI 3.0 schema object the generator emits.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties interface{}        `json:"additionalProperties,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+}
+
+// Raw is a body documented with an explicit media type and schema, for
+// endpoints that do not return JSON.
+type Raw struct {
+	ContentType string
+	Schema      *Schema
+}
+
+// Text documents a text/plain body.
+var Text = Raw{ContentType: "text/plain", Schema: &Schema{Type: "string"}}
+
+// Binary documents a body of arbitrary bytes.
+var Binary = Raw{ContentType: "application/octet-stream", Schema: &Schema{Type: "string", Format: "binary"}}
+
+// Any documents a JSON body whose shape is not described.
+var Any = Raw{ContentType: "application/json", Schema: &Schema{}}
+
+// Message is the {"message": "..."} body many endpoints return.
+type Message struct {
+	Message string `json:"message"`
+}
+
+// Health is the body of the /health endpoint.
+type Health struct {
+	Status  string `json:"status"`
+	Service string `json:"service"`
+}
+
+// pageOf marks a query.Page envelope around items of the given type.
+type pageOf struct {
+	item reflect.Type
+}
+
+// Page documents a query.Page response whose data items are of v's type.
+func Page(v interface{}) interface{} {
+	return pageOf{item: reflect.TypeOf(v)}
+}
+
+// listOf marks a plain JSON array.
+type listOf struct {
+	item reflect.Type
+}
+
+// List documents a JSON array of v's type.
+func List(v interface{}) interface{} {
+	return listOf{item: reflect.TypeOf(v)}
+}
+
+var (
+	timeType    = reflect.TypeOf(time.Time{})
+	rawJSONType = reflect.TypeOf(json.RawMessage{})
+)
+
+// generator converts Go types to schemas, registering named structs as
+// reusable components.
+type generator struct {
+	schemas map[string]*Schema
+	names   map[reflect.Type]string
+}
+
+func newGenerator() *generator {
+	return &generator{schemas: map[string]*Schema{}, names: map[reflect.Type]string{}}
+}
+
+// schemaFor returns the schema of a documented body value.
+func (g *generator) schemaFor(v interface{}) *Schema {
+	switch b := v.(type) {
+	case nil:
+		return nil
+	case Raw:
+		return b.Schema
+	case *Schema:
+		return b
+	case pageOf:
+		return &Schema{
+			Type: "object",
+			Properties: map[string]*Schema{
+				"data": {Type: "array", Items: g.typeSchema(b.item)},
+				"pagination": {
+					Type: "object",
+					Properties: map[string]*Schema{
+						"limit":       {Type: "integer"},
+						"has_more":    {Type: "boolean"},
+						"next_cursor": {Type: "string", Nullable: true},
+					},
+					Required: []string{"limit", "has_more"},
+				},
+			},
+			Required: []string{"data", "pagination"},
+		}
+	case listOf:
+		return &Schema{Type: "array", Items: g.typeSchema(b.item)}
+	}
+	return g.typeSchema(reflect.TypeOf(v))
+}
+
+func (g *generator) typeSchema(t reflect.Type) *Schema {
+	nullable := false
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+		nullable = true
+	}
+	s := g.baseSchema(t)
+	if nullable && s.Ref == "" {
+		s.Nullable = true
+	}
+	return s
+}
+
+func (g *generator) baseSchema(t reflect.Type) *Schema {
+	switch t {
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case rawJSONType:
+		return &Schema{}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: g.typeSchema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: g.typeSchema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + g.component(t)}
+	}
+	return &Schema{}
+}
+
+// component registers a named struct and returns its component name. Types
+// from different packages that share a name are prefixed with the package.
+func (g *generator) component(t reflect.Type) string {
+	if name, ok := g.names[t]; ok {
+		return name
+	}
+	name := t.Name()
+	if _, taken := g.schemas[name]; taken {
+		pkg := t.PkgPath()
+		prefix := pkg[strings.LastIndex(pkg, "/")+1:]
+		name = strings.ToUpper(prefix[:1]) + prefix[1:] + name
+	}
+	g.names[t] = name
+	g.schemas[name] = &Schema{} // placeholder for recursive types
+	*g.schemas[name] = *g.structSchema(t)
+	return name
+}
+
+func (g *generator) structSchema(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	g.addFields(s, t)
+	return s
+}
+
+func (g *generator) addFields(s *Schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				g.addFields(s, ft)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		fs := g.typeSchema(f.Type)
+		required := applyValidate(fs, f.Tag.Get("validate"))
+		if desc := f.Tag.Get("doc"); desc != "" {
+			if fs.Ref != "" {
+				fs = &Schema{Ref: fs.Ref}
+			}
+			fs.Description = desc
+		}
+		s.Properties[name] = fs
+		if required {
+			s.Required = append(s.Required, name)
+		}
+	}
+}
+
+// applyValidate maps go-playground/validator rules onto schema constraints
+// and reports whether the field is required. Rules after dive constrain the
+// items of an array.
+func applyValidate(s *Schema, tag string) bool {
+	if tag == "" || s.Ref != "" {
+		return strings.Contains(","+tag+",", ",required,")
+	}
+	required := false
+	rules := strings.Split(tag, ",")
+	for i, rule := range rules {
+		key, arg, _ := strings.Cut(rule, "=")
+		switch key {
+		case "dive":
+			// The remaining rules apply to the elements
+			if s.Items != nil && s.Items.Ref == "" {
+				applyValidate(s.Items, strings.Join(rules[i+1:], ","))
+			}
+			return required
+		case "required":
+			required = true
+		case "email":
+			s.Format = "email"
+		case "uuid", "uuid4":
+			s.Format = "uuid"
+		case "url":
+			s.Format = "uri"
+		case "oneof":
+			for _, v := range strings.Fields(arg) {
+				s.Enum = append(s.Enum, enumValue(s.Type, v))
+			}
+		case "min", "max", "len", "gte", "lte":
+			n, err := strconv.ParseFloat(arg, 64)
+			if err != nil {
+				continue
+			}
+			setBound(s, key, n)
+		}
+	}
+	return required
+}
+
+func setBound(s *Schema, key string, n float64) {
+	lower := key == "min" || key == "gte" || key == "len"
+	upper := key == "max" || key == "lte" || key == "len"
+	switch s.Type {
+	case "string":
+		i := int(n)
+		if lower {
+			s.MinLength = &i
+		}
+		if upper {
+			s.MaxLength = &i
+		}
+	case "integer", "number":
+		if lower {
+			s.Minimum = &n
+		}
+		if upper {
+			s.Maximum = &n
+		}
+	}
+}
+
+func enumValue(typ, v string) interface{} {
+	switch typ {
+	case "integer":
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return n
+		}
+	case "number":
+		if n, err := strconv.ParseFloat(v, 64); err == nil {
+			return n
+		}
+	}
+	return v
+}
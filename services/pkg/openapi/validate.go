@@ -0,0 +1,227 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// ValidateResponse checks an actual response against the document. It fails
+// when the route or status is undocumented, the media type differs, or the
+// body does not match the schema, including properties the schema does not
+// declare. Contract tests call it with what the handler really sent.
+func (d *Document) ValidateResponse(method, path string, status int, contentType string, body []byte) error {
+	template := d.match(path)
+	if template == "" {
+		return fmt.Errorf("%s %s: path not documented", method, path)
+	}
+	op := d.operation(method, template)
+	if op == nil {
+		return fmt.Errorf("%s %s: method not documented", method, template)
+	}
+	resp, ok := op.Responses[strconv.Itoa(status)]
+	if !ok {
+		if status < 400 {
+			return fmt.Errorf("%s %s: status %d not documented", method, template, status)
+		}
+		resp = op.Responses["default"]
+	}
+
+	if len(resp.Content) == 0 {
+		if len(body) != 0 {
+			return fmt.Errorf("%s %s %d: expected empty body, got %d bytes", method, template, status, len(body))
+		}
+		return nil
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return fmt.Errorf("%s %s %d: invalid content type %q", method, template, status, contentType)
+	}
+	media, ok := resp.Content[mediaType]
+	if !ok {
+		return fmt.Errorf("%s %s %d: content type %q not documented", method, template, status, mediaType)
+	}
+	if !strings.HasSuffix(mediaType, "json") {
+		return nil
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var value interface{}
+	if err := dec.Decode(&value); err != nil {
+		return fmt.Errorf("%s %s %d: invalid JSON: %v", method, template, status, err)
+	}
+	if err := schemaSet(d.Components.Schemas).validate(media.Schema, value, "$"); err != nil {
+		return fmt.Errorf("%s %s %d: %v", method, template, status, err)
+	}
+	return nil
+}
+
+// match finds the path template for a concrete path, preferring templates
+// with fewer parameters so /schools/upload-logo beats /schools/{id}.
+func (d *Document) match(path string) string {
+	best, bestParams := "", -1
+	segments := strings.Split(path, "/")
+	for template := range d.Paths {
+		params, ok := matchTemplate(strings.Split(template, "/"), segments)
+		if ok && (bestParams < 0 || params < bestParams) {
+			best, bestParams = template, params
+		}
+	}
+	return best
+}
+
+func matchTemplate(template, segments []string) (int, bool) {
+	params := 0
+	for i, seg := range template {
+		if seg == "{path}" && i == len(template)-1 {
+			return params + 1, len(segments) >= len(template)
+		}
+		if i >= len(segments) {
+			return 0, false
+		}
+		if strings.HasPrefix(seg, "{") {
+			params++
+			continue
+		}
+		if seg != segments[i] {
+			return 0, false
+		}
+	}
+	return params, len(segments) == len(template)
+}
+
+// schemaSet holds the components that schemas refer to
+type schemaSet map[string]*Schema
+
+func (set schemaSet) resolve(s *Schema) *Schema {
+	for s != nil && s.Ref != "" {
+		s = set[strings.TrimPrefix(s.Ref, "#/components/schemas/")]
+	}
+	return s
+}
+
+func (set schemaSet) validate(s *Schema, v interface{}, at string) error {
+	s = set.resolve(s)
+	if s == nil {
+		return fmt.Errorf("%s: unresolved schema", at)
+	}
+	if v == nil {
+		if s.Nullable || s.Type == "" {
+			return nil
+		}
+		return fmt.Errorf("%s: null is not allowed for %s", at, s.Type)
+	}
+	if len(s.Enum) > 0 && !inEnum(s.Enum, v) {
+		return fmt.Errorf("%s: %v is not one of %v", at, v, s.Enum)
+	}
+
+	switch s.Type {
+	case "object":
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s: expected object, got %s", at, schemaType(v))
+		}
+		for _, name := range s.Required {
+			if _, ok := obj[name]; !ok {
+				return fmt.Errorf("%s: missing required property %q", at, name)
+			}
+		}
+		for name, pv := range obj {
+			ps, declared := s.Properties[name]
+			if !declared {
+				extra, ok := s.AdditionalProperties.(*Schema)
+				switch {
+				case ok:
+					ps = extra
+				case len(s.Properties) == 0:
+					continue // free-form object
+				default:
+					return fmt.Errorf("%s: undocumented property %q", at, name)
+				}
+			}
+			if err := set.validate(ps, pv, at+"."+name); err != nil {
+				return err
+			}
+		}
+	case "array":
+		items, ok := v.([]interface{})
+		if !ok {
+			return fmt.Errorf("%s: expected array, got %s", at, schemaType(v))
+		}
+		for i, item := range items {
+			if err := set.validate(s.Items, item, fmt.Sprintf("%s[%d]", at, i)); err != nil {
+				return err
+			}
+		}
+	case "string":
+		str, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("%s: expected string, got %s", at, schemaType(v))
+		}
+		if n := utf8.RuneCountInString(str); s.MinLength != nil && n < *s.MinLength || s.MaxLength != nil && n > *s.MaxLength {
+			return fmt.Errorf("%s: length %d is out of bounds", at, n)
+		}
+		switch s.Format {
+		case "date-time":
+			if _, err := time.Parse(time.RFC3339Nano, str); err != nil {
+				return fmt.Errorf("%s: %q is not a date-time", at, str)
+			}
+		case "uuid":
+			if !uuidPattern.MatchString(str) {
+				return fmt.Errorf("%s: %q is not a uuid", at, str)
+			}
+		}
+	case "integer":
+		n, ok := v.(json.Number)
+		if !ok {
+			return fmt.Errorf("%s: expected integer, got %s", at, schemaType(v))
+		}
+		if _, err := n.Int64(); err != nil {
+			return fmt.Errorf("%s: %s is not an integer", at, n)
+		}
+		return checkBounds(s, n, at)
+	case "number":
+		n, ok := v.(json.Number)
+		if !ok {
+			return fmt.Errorf("%s: expected number, got %s", at, schemaType(v))
+		}
+		return checkBounds(s, n, at)
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return fmt.Errorf("%s: expected boolean, got %s", at, schemaType(v))
+		}
+	}
+	return nil
+}
+
+func checkBounds(s *Schema, n json.Number, at string) error {
+	f, err := n.Float64()
+	if err != nil {
+		return fmt.Errorf("%s: %s is not a number", at, n)
+	}
+	if s.Minimum != nil && f < *s.Minimum {
+		return fmt.Errorf("%s: %s is less than %v", at, n, *s.Minimum)
+	}
+	if s.Maximum != nil && f > *s.Maximum {
+		return fmt.Errorf("%s: %s is greater than %v", at, n, *s.Maximum)
+	}
+	return nil
+}
+
+func inEnum(enum []interface{}, v interface{}) bool {
+	for _, e := range enum {
+		if fmt.Sprint(e) == fmt.Sprint(v) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,104 @@
+package plans
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"school-erp/pkg/cache"
+)
+
+// Client reads schools' plans and metered usage for the services. Plans are
+// cached for ttl or until a PlanChanged event for them is passed to
+// HandleEvent; usage is read when asked for.
+type Client struct {
+	fetch func(ctx context.Context, schoolID string) (*Plan, error)
+	used  func(ctx context.Context, schoolID, metric string) (int64, error)
+	cache *cache.TTL[string, *Plan]
+}
+
+// NewClient creates a client reading the main database
+func NewClient(db *pgxpool.Pool, ttl time.Duration) *Client {
+	store := NewStore(db, nil)
+	used := func(ctx context.Context, schoolID, metric string) (int64, error) {
+		return Used(ctx, db, schoolID, metric, time.Now())
+	}
+	return &Client{fetch: store.ForSchool, used: used, cache: cache.NewTTL[string, *Plan](ttl)}
+}
+
+// Plan returns the school's plan
+func (c *Client) Plan(ctx context.Context, schoolID string) (*Plan, error) {
+	return c.cache.Get(schoolID, func() (*Plan, error) {
+		return c.fetch(ctx, schoolID)
+	})
+}
+
+// Check returns the verdict of the school adding to a metric whose usage is
+// metered by the school service, such as SMS this month. Services that can
+// count a metric themselves, such as students, use Plan(...).Check.
+func (c *Client) Check(ctx context.Context, schoolID, metric string, adding int64) (Verdict, error) {
+	p, err := c.Plan(ctx, schoolID)
+	if err != nil {
+		return Verdict{}, err
+	}
+	used, err := c.used(ctx, schoolID, metric)
+	if err != nil {
+		return Verdict{}, err
+	}
+	return p.Check(metric, used, adding), nil
+}
+
+// Invalidate drops the cached plan of the school, or with an empty ID every
+// cached plan
+func (c *Client) Invalidate(schoolID string) {
+	if schoolID == "" {
+		c.cache.Clear()
+	} else {
+		c.cache.Invalidate(schoolID)
+	}
+}
+
+// HandleEvent invalidates the plans named by a PlanChanged message;
+// malformed ones are logged
+func (c *Client) HandleEvent(data []byte) {
+	var e PlanChanged
+	if err := json.Unmarshal(data, &e); err != nil {
+		log.Printf("Invalid %s event: %v\n", SubjectPlanChanged, err)
+		return
+	}
+	c.Invalidate(e.SchoolID)
+}
+
+// Used returns the school's metered usage of metric at now: the month's
+// total of counters, or the last reported level of gauges
+func Used(ctx context.Context, db *pgxpool.Pool, schoolID, metric string, now time.Time) (int64, error) {
+	info, _ := LookupMetric(metric)
+	var used int64
+	var err error
+	if info.Kind == Counter {
+		err = db.QueryRow(ctx, `
+		SELECT value FROM school_usage WHERE school_id = $1 AND metric = $2 AND month = $3`,
+			schoolID, metric, MonthOf(now),
+		).Scan(&used)
+	} else {
+		err = db.QueryRow(ctx, `
+		SELECT last FROM school_usage WHERE school_id = $1 AND metric = $2
+		ORDER BY month DESC LIMIT 1`, schoolID, metric,
+		).Scan(&used)
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, nil
+	}
+	return used, err
+}
+
+// MonthOf returns the first day of t's month in UTC
+func MonthOf(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,157 @@
+// Package plans holds the subscription plans schools are on and the usage
+// they are metered for. A plan caps students, storage and SMS each month and
+// lists the modules its schools may turn on. Services check a plan's limits
+// with a Client before adding to a metric and report the new usage with
+// UsageReported events, which the school service meters into monthly
+// statements.
+package plans
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/gofiber/fiber/v2"
+
+	"school-erp/pkg/features"
+	"school-erp/pkg/problem"
+)
+
+// Metrics schools are metered for
+const (
+	MetricStudents = "students"      // students on the roll
+	MetricStorage  = "storage_bytes" // database and file storage
+	MetricSMS      = "sms"           // SMS sent in the month; nothing sends SMS yet
+)
+
+// Kinds of metrics
+const (
+	// Gauge metrics report their current level; statements bill the peak
+	Gauge = "gauge"
+	// Counter metrics report increments; statements bill the month's total
+	Counter = "counter"
+)
+
+// MetricInfo describes a metric
+type MetricInfo struct {
+	Kind string
+	Unit string
+}
+
+var metrics = map[string]MetricInfo{
+	MetricStudents: {Kind: Gauge, Unit: "students"},
+	MetricStorage:  {Kind: Gauge, Unit: "bytes"},
+	MetricSMS:      {Kind: Counter, Unit: "messages"},
+}
+
+// Metrics returns the metered metrics in statement order
+func Metrics() []string {
+	return []string{MetricStudents, MetricStorage, MetricSMS}
+}
+
+// LookupMetric returns the metric's description
+func LookupMetric(metric string) (MetricInfo, bool) {
+	info, ok := metrics[metric]
+	return info, ok
+}
+
+// HeaderLimitWarning is set on responses of requests that brought a school
+// past a soft limit, e.g. "students: 460 of 500"
+const HeaderLimitWarning = "X-Plan-Limit-Warning"
+
+// planCode is the form of plan codes
+var planCode = regexp.MustCompile(`^[a-z][a-z0-9-]{0,49}$`)
+
+// Plan is a subscription plan. Nil limits are unlimited.
+type Plan struct {
+	Code         string   `json:"code"`
+	Name         string   `json:"name" validate:"required,max=255"`
+	MaxStudents  *int64   `json:"max_students" validate:"omitempty,min=0" doc:"Students on the roll; null is unlimited"`
+	StorageQuota *int64   `json:"storage_quota_bytes" validate:"omitempty,min=0" doc:"Database and file storage; null is unlimited"`
+	SMSCredits   *int64   `json:"sms_credits" validate:"omitempty,min=0" doc:"SMS a month; null is unlimited"`
+	Modules      []string `json:"modules" validate:"dive,required" doc:"Modules schools on the plan may turn on; core modules are always included"`
+	SoftPercent  int      `json:"soft_limit_percent" validate:"min=1,max=100" doc:"Share of a limit at which warnings start"`
+}
+
+// CheckCode returns an error unless code can name a plan
+func CheckCode(code string) error {
+	if !planCode.MatchString(code) {
+		return fmt.Errorf("invalid plan code %q: use lowercase letters, digits and hyphens", code)
+	}
+	return nil
+}
+
+// CheckModules returns an error for modules that are not registered
+func (p *Plan) CheckModules() error {
+	for _, m := range p.Modules {
+		if features.LookupModule(m) == nil {
+			return fmt.Errorf("%w %q", features.ErrUnknownFeature, m)
+		}
+	}
+	return nil
+}
+
+// Limit returns the plan's limit of metric, or nil when it is unlimited
+func (p *Plan) Limit(metric string) *int64 {
+	switch metric {
+	case MetricStudents:
+		return p.MaxStudents
+	case MetricStorage:
+		return p.StorageQuota
+	case MetricSMS:
+		return p.SMSCredits
+	}
+	return nil
+}
+
+// Verdict is how a school's usage of a metric stands against its plan
+type Verdict struct {
+	Metric string `json:"metric"`
+	Used   int64  `json:"used"`
+	Limit  *int64 `json:"limit" doc:"null is unlimited"`
+	// Soft is set once usage reaches the plan's soft limit
+	Soft bool `json:"soft"`
+	// Exceeded is set when usage would go past the limit
+	Exceeded bool `json:"exceeded"`
+}
+
+// Check returns the verdict of adding to a metric of which used is already
+// used. Pass adding 0 to see where usage stands.
+func (p *Plan) Check(metric string, used, adding int64) Verdict {
+	v := Verdict{Metric: metric, Used: used + adding, Limit: p.Limit(metric)}
+	if v.Limit == nil {
+		return v
+	}
+	limit := *v.Limit
+	v.Exceeded = v.Used > limit
+	v.Soft = v.Used*100 >= limit*int64(p.SoftPercent)
+	return v
+}
+
+// Err returns a 403 problem when the verdict exceeds the limit
+func (v Verdict) Err() error {
+	if !v.Exceeded {
+		return nil
+	}
+	return problem.Forbidden(problem.CodePlanLimitReached,
+		fmt.Sprintf("The school's plan allows %d %s; upgrade the plan to add more", *v.Limit, metrics[v.Metric].Unit))
+}
+
+// Warning describes a verdict past the soft limit, or returns ""
+func (v Verdict) Warning() string {
+	if !v.Soft || v.Limit == nil {
+		return ""
+	}
+	return fmt.Sprintf("%s: %d of %d", v.Metric, v.Used, *v.Limit)
+}
+
+// Enforce refuses the request when v exceeds the hard limit, and otherwise
+// warns the caller with HeaderLimitWarning once v is past the soft limit
+func Enforce(c *fiber.Ctx, v Verdict) error {
+	if err := v.Err(); err != nil {
+		return err
+	}
+	if w := v.Warning(); w != "" {
+		c.Set(HeaderLimitWarning, w)
+	}
+	return nil
+}
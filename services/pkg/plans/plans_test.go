@@ -0,0 +1,130 @@
+package plans
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"school-erp/pkg/cache"
+	"school-erp/pkg/problem"
+)
+
+func limit(n int64) *int64 { return &n }
+
+func TestCheck(t *testing.T) {
+	p := &Plan{Code: "standard", MaxStudents: limit(500), SoftPercent: 80}
+
+	cases := []struct {
+		used, adding   int64
+		soft, exceeded bool
+	}{
+		{used: 100, adding: 1},
+		{used: 399, adding: 1, soft: true},
+		{used: 499, adding: 1, soft: true},
+		{used: 500, adding: 1, soft: true, exceeded: true},
+		{used: 600, adding: 0, soft: true, exceeded: true},
+	}
+	for _, tc := range cases {
+		v := p.Check(MetricStudents, tc.used, tc.adding)
+		if v.Soft != tc.soft || v.Exceeded != tc.exceeded {
+			t.Errorf("%d+%d: %+v", tc.used, tc.adding, v)
+		}
+	}
+
+	var pr *problem.Problem
+	if err := p.Check(MetricStudents, 500, 1).Err(); !errors.As(err, &pr) || pr.Code != problem.CodePlanLimitReached {
+		t.Errorf("over the limit: %v", err)
+	}
+	// Unlimited metrics are never soft or exceeded
+	if v := p.Check(MetricSMS, 1e9, 1); v.Soft || v.Exceeded || v.Limit != nil {
+		t.Errorf("unlimited sms: %+v", v)
+	}
+	if v := (&Plan{SMSCredits: limit(0), SoftPercent: 80}).Check(MetricSMS, 0, 1); !v.Exceeded {
+		t.Errorf("plan without SMS: %+v", v)
+	}
+}
+
+func TestEnforce(t *testing.T) {
+	p := &Plan{MaxStudents: limit(10), SoftPercent: 80}
+	app := fiber.New(fiber.Config{ErrorHandler: problem.ErrorHandler})
+	app.Post("/:used", func(c *fiber.Ctx) error {
+		used, _ := c.ParamsInt("used")
+		if err := Enforce(c, p.Check(MetricStudents, int64(used), 1)); err != nil {
+			return err
+		}
+		return c.SendStatus(201)
+	})
+
+	for used, want := range map[string]struct {
+		status  int
+		warning string
+	}{
+		"2":  {201, ""},
+		"8":  {201, "students: 9 of 10"},
+		"10": {403, ""},
+	} {
+		resp, err := app.Test(httptest.NewRequest("POST", "/"+used, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != want.status || resp.Header.Get(HeaderLimitWarning) != want.warning {
+			t.Errorf("%s used: status %d, warning %q", used, resp.StatusCode, resp.Header.Get(HeaderLimitWarning))
+		}
+	}
+}
+
+func TestPlanValidation(t *testing.T) {
+	for _, code := range []string{"free", "school-plus", "p2"} {
+		if err := CheckCode(code); err != nil {
+			t.Errorf("%s: %v", code, err)
+		}
+	}
+	for _, code := range []string{"", "Free", "-free", "free plan"} {
+		if err := CheckCode(code); err == nil {
+			t.Errorf("%q accepted", code)
+		}
+	}
+	if err := (&Plan{Modules: []string{"transport", "library"}}).CheckModules(); err == nil {
+		t.Error("unknown module accepted")
+	}
+}
+
+func TestClientCache(t *testing.T) {
+	fetches := 0
+	plans := map[string]*Plan{"1": {Code: "free", SMSCredits: limit(0), SoftPercent: 80}}
+	c := &Client{
+		cache: cache.NewTTL[string, *Plan](time.Minute),
+		fetch: func(_ context.Context, schoolID string) (*Plan, error) {
+			fetches++
+			return plans[schoolID], nil
+		},
+		used: func(context.Context, string, string) (int64, error) { return 40, nil },
+	}
+	ctx := context.Background()
+
+	if v, err := c.Check(ctx, "1", MetricSMS, 1); err != nil || !v.Exceeded {
+		t.Fatalf("free plan sms = %+v, %v", v, err)
+	}
+	plans["1"] = &Plan{Code: "standard", SMSCredits: limit(2000), SoftPercent: 80}
+	if v, _ := c.Check(ctx, "1", MetricSMS, 1); !v.Exceeded || fetches != 1 {
+		t.Fatalf("cached plan: %+v after %d fetches", v, fetches)
+	}
+
+	event, _ := json.Marshal(PlanChanged{SchoolID: "1", Plan: "standard"})
+	c.HandleEvent(event)
+	if v, _ := c.Check(ctx, "1", MetricSMS, 1); v.Exceeded || v.Used != 41 || fetches != 2 {
+		t.Fatalf("plan after event: %+v after %d fetches", v, fetches)
+	}
+}
+
+func TestMonthOf(t *testing.T) {
+	at := time.Date(2026, 10, 31, 23, 30, 0, 0, time.FixedZone("NPT", 5*3600+45*60))
+	if got := MonthOf(at); !got.Equal(time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("MonthOf = %v", got)
+	}
+}
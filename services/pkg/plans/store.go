@@ -0,0 +1,200 @@
+package plans
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"school-erp/pkg/events"
+	"school-erp/pkg/features"
+)
+
+// Migration creates the plans, assigns every school a plan and creates the
+// usage tables in the main database, after the schools table. The school
+// service includes it in its migration list. Existing schools are put on the
+// standard plan.
+const Migration = `
+CREATE TABLE IF NOT EXISTS plans (
+	code VARCHAR(50) PRIMARY KEY,
+	name VARCHAR(255) NOT NULL,
+	max_students BIGINT,
+	storage_quota_bytes BIGINT,
+	sms_credits BIGINT,
+	modules TEXT[] NOT NULL DEFAULT '{}',
+	soft_limit_percent INTEGER NOT NULL DEFAULT 80 CHECK (soft_limit_percent BETWEEN 1 AND 100),
+	updated_by VARCHAR(255) NOT NULL,
+	updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO plans (code, name, max_students, storage_quota_bytes, sms_credits, modules, updated_by) VALUES
+	('free', 'Free', 100, 1073741824, 0, '{attendance}', 'migration'),
+	('standard', 'Standard', 1000, 10737418240, 2000, '{attendance,fees,exams,notifications}', 'migration'),
+	('premium', 'Premium', NULL, 107374182400, 10000, '{attendance,fees,exams,notifications,transport}', 'migration')
+ON CONFLICT (code) DO NOTHING;
+
+ALTER TABLE schools ADD COLUMN IF NOT EXISTS plan_code VARCHAR(50) NOT NULL DEFAULT 'standard' REFERENCES plans(code);
+
+CREATE TABLE IF NOT EXISTS school_usage (
+	school_id UUID NOT NULL REFERENCES schools(id) ON DELETE CASCADE,
+	metric VARCHAR(50) NOT NULL,
+	month DATE NOT NULL,
+	value BIGINT NOT NULL DEFAULT 0,
+	last BIGINT NOT NULL DEFAULT 0,
+	updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (school_id, metric, month)
+);
+
+CREATE TABLE IF NOT EXISTS usage_statements (
+	school_id UUID NOT NULL REFERENCES schools(id) ON DELETE CASCADE,
+	month DATE NOT NULL,
+	plan_code VARCHAR(50) NOT NULL,
+	lines JSONB NOT NULL,
+	generated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (school_id, month)
+);
+`
+
+// Subjects of the NATS events of this package
+const (
+	SubjectUsageReported = "SchoolUsageReported"
+	SubjectPlanChanged   = "SchoolPlanChanged"
+)
+
+// UsageReported is published by the services when a school's usage of a
+// metric changes
+type UsageReported struct {
+	SchoolID string `json:"school_id"`
+	Metric   string `json:"metric"`
+	// Value is the new level of a gauge, or the increment of a counter
+	Value int64     `json:"value"`
+	At    time.Time `json:"at"`
+}
+
+// PlanChanged is published when a school moves to another plan, or without
+// SchoolID when a plan's limits change
+type PlanChanged struct {
+	SchoolID  string    `json:"school_id,omitempty"`
+	Plan      string    `json:"plan"`
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+// ErrUnknownPlan is returned for codes of no plan
+var ErrUnknownPlan = errors.New("unknown plan")
+
+// Report publishes a UsageReported event. It is best effort: failures are
+// logged, and storage is sampled again by the school service.
+func Report(publish events.Publisher, e UsageReported) {
+	if e.At.IsZero() {
+		e.At = time.Now().UTC()
+	}
+	events.Send(publish, SubjectUsageReported, e)
+}
+
+// Store reads and writes plans in the main database
+type Store struct {
+	db      *pgxpool.Pool
+	publish events.Publisher
+}
+
+func NewStore(db *pgxpool.Pool, publish events.Publisher) *Store {
+	return &Store{db: db, publish: publish}
+}
+
+const planColumns = `code, name, max_students, storage_quota_bytes, sms_credits, modules, soft_limit_percent`
+
+func scanPlan(row pgx.Row) (*Plan, error) {
+	var p Plan
+	if err := row.Scan(&p.Code, &p.Name, &p.MaxStudents, &p.StorageQuota, &p.SMSCredits, &p.Modules, &p.SoftPercent); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// List returns every plan by code
+func (s *Store) List(ctx context.Context) ([]Plan, error) {
+	rows, err := s.db.Query(ctx, `SELECT `+planColumns+` FROM plans ORDER BY code`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	plans := []Plan{}
+	for rows.Next() {
+		p, err := scanPlan(rows)
+		if err != nil {
+			return nil, err
+		}
+		plans = append(plans, *p)
+	}
+	return plans, rows.Err()
+}
+
+// Get returns the plan with code, or ErrUnknownPlan
+func (s *Store) Get(ctx context.Context, code string) (*Plan, error) {
+	p, err := scanPlan(s.db.QueryRow(ctx, `SELECT `+planColumns+` FROM plans WHERE code = $1`, code))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("%w %q", ErrUnknownPlan, code)
+	}
+	return p, err
+}
+
+// ForSchool returns the school's plan. It returns pgx.ErrNoRows for unknown
+// schools.
+func (s *Store) ForSchool(ctx context.Context, schoolID string) (*Plan, error) {
+	return scanPlan(s.db.QueryRow(ctx, `
+	SELECT `+planColumns+` FROM plans WHERE code = (SELECT plan_code FROM schools WHERE id = $1)`, schoolID))
+}
+
+// Put creates the plan or changes its limits and modules. Schools on the
+// plan get the new limits at once; modules dropped from it turn off.
+func (s *Store) Put(ctx context.Context, p Plan, actor string) error {
+	if err := CheckCode(p.Code); err != nil {
+		return err
+	}
+	if err := p.CheckModules(); err != nil {
+		return err
+	}
+	if p.Modules == nil {
+		p.Modules = []string{}
+	}
+	_, err := s.db.Exec(ctx, `
+	INSERT INTO plans (`+planColumns+`, updated_by)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	ON CONFLICT (code) DO UPDATE
+	SET name = EXCLUDED.name, max_students = EXCLUDED.max_students,
+		storage_quota_bytes = EXCLUDED.storage_quota_bytes, sms_credits = EXCLUDED.sms_credits,
+		modules = EXCLUDED.modules, soft_limit_percent = EXCLUDED.soft_limit_percent,
+		updated_by = EXCLUDED.updated_by, updated_at = CURRENT_TIMESTAMP`,
+		p.Code, p.Name, p.MaxStudents, p.StorageQuota, p.SMSCredits, p.Modules, p.SoftPercent, actor)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	events.Send(s.publish, SubjectPlanChanged, PlanChanged{Plan: p.Code, ChangedAt: now})
+	events.Send(s.publish, features.SubjectFeaturesChanged, features.FeaturesChanged{Key: "plan", ChangedAt: now})
+	return nil
+}
+
+// Assign moves the school to the plan with code. It returns ErrUnknownPlan
+// for unknown plans and pgx.ErrNoRows for unknown schools.
+func (s *Store) Assign(ctx context.Context, schoolID, code string) (*Plan, error) {
+	p, err := s.Get(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+	var schoolCode string
+	err = s.db.QueryRow(ctx, `
+	UPDATE schools SET plan_code = $2 WHERE id = $1 RETURNING code`, schoolID, code,
+	).Scan(&schoolCode)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	events.Send(s.publish, SubjectPlanChanged, PlanChanged{SchoolID: schoolID, Plan: code, ChangedAt: now})
+	events.Send(s.publish, features.SubjectFeaturesChanged, features.FeaturesChanged{SchoolID: schoolID, Code: schoolCode, Key: "plan", ChangedAt: now})
+	return p, nil
+}
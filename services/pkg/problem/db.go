@@ -0,0 +1,82 @@
+package problem
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// PostgreSQL SQLSTATE codes mapped by FromDB.
+const (
+	pgUniqueViolation     = "23505"
+	pgForeignKeyViolation = "23503"
+	pgCheckViolation      = "23514"
+	pgNotNullViolation    = "23502"
+	pgInvalidTextRepr     = "22P02"
+)
+
+// keyColumns extracts the column list from a constraint detail such as
+// `Key (school_id, email)=(1, a@b.c) already exists.`
+var keyColumns = regexp.MustCompile(`^Key \(([^)]+)\)=`)
+
+// FromDB maps a database error to a problem. resource names the entity in
+// client-facing messages, e.g. "School". Errors that are not recognised
+// become a 500 with the original error kept for logging only.
+func FromDB(err error, resource string) *Problem {
+	if errors.Is(err, pgx.ErrNoRows) {
+		return NotFound(resource + " not found").Wrap(err)
+	}
+
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return Internal("Failed to process "+strings.ToLower(resource), err)
+	}
+
+	switch pgErr.Code {
+	case pgUniqueViolation:
+		p := Conflict(CodeAlreadyExists, resource+" already exists")
+		for _, column := range constraintColumns(pgErr) {
+			p.Errors = append(p.Errors, FieldError{Field: column, Code: "unique", Message: "is already taken"})
+		}
+		return p.Wrap(err)
+	case pgForeignKeyViolation:
+		p := Unprocessable(CodeReferenceViolation, resource+" references a record that does not exist or is still referenced")
+		for _, column := range constraintColumns(pgErr) {
+			p.Errors = append(p.Errors, FieldError{Field: column, Code: "reference", Message: "references a missing record"})
+		}
+		return p.Wrap(err)
+	case pgCheckViolation:
+		p := Unprocessable(CodeConstraintViolation, resource+" violates a data constraint")
+		if pgErr.ColumnName != "" {
+			p.Errors = append(p.Errors, FieldError{Field: pgErr.ColumnName, Code: "check", Message: "has an invalid value"})
+		}
+		return p.Wrap(err)
+	case pgNotNullViolation:
+		p := Unprocessable(CodeValidationFailed, resource+" is missing a required value")
+		if pgErr.ColumnName != "" {
+			p.Errors = append(p.Errors, FieldError{Field: pgErr.ColumnName, Code: "required", Message: "is required"})
+		}
+		return p.Wrap(err)
+	case pgInvalidTextRepr:
+		return BadRequest(CodeBadRequest, "Malformed identifier or value").Wrap(err)
+	}
+	return Internal("Failed to process "+strings.ToLower(resource), err)
+}
+
+func constraintColumns(pgErr *pgconn.PgError) []string {
+	if pgErr.ColumnName != "" {
+		return []string{pgErr.ColumnName}
+	}
+	m := keyColumns.FindStringSubmatch(pgErr.Detail)
+	if m == nil {
+		return nil
+	}
+	var columns []string
+	for _, column := range strings.Split(m[1], ",") {
+		columns = append(columns, strings.TrimSpace(column))
+	}
+	return columns
+}
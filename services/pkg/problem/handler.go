@@ -0,0 +1,69 @@
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// statusCodes gives a stable code to errors raised by Fiber itself
+// (unknown routes, body limits, timeouts).
+var statusCodes = map[int]string{
+	fiber.StatusBadRequest:            CodeBadRequest,
+	fiber.StatusUnauthorized:          CodeUnauthorized,
+	fiber.StatusForbidden:             CodeForbidden,
+	fiber.StatusNotFound:              CodeNotFound,
+	fiber.StatusMethodNotAllowed:      CodeMethodNotAllowed,
+	fiber.StatusRequestTimeout:        CodeTimeout,
+	fiber.StatusConflict:              CodeConflict,
+	fiber.StatusRequestEntityTooLarge: CodePayloadTooLarge,
+	fiber.StatusUnprocessableEntity:   CodeValidationFailed,
+	fiber.StatusTooManyRequests:       CodeRateLimited,
+	fiber.StatusServiceUnavailable:    CodeUnavailable,
+	fiber.StatusGatewayTimeout:        CodeTimeout,
+}
+
+// From converts any error into a problem.
+func From(err error) *Problem {
+	var p *Problem
+	if errors.As(err, &p) {
+		return p
+	}
+	var fe *fiber.Error
+	if errors.As(err, &fe) {
+		code, ok := statusCodes[fe.Code]
+		if !ok {
+			code = CodeBadRequest
+			if fe.Code >= fiber.StatusInternalServerError {
+				code = CodeInternal
+			}
+		}
+		return New(fe.Code, code, fe.Message)
+	}
+	return Internal("An unexpected error occurred", err)
+}
+
+// ErrorHandler is a fiber.Config.ErrorHandler that renders every error as
+// problem+json. Server errors are logged with their cause.
+func ErrorHandler(c *fiber.Ctx, err error) error {
+	p := *From(err)
+	if p.Instance == "" {
+		p.Instance = c.Path()
+	}
+	if p.Status >= fiber.StatusInternalServerError {
+		log.Printf("[%s %s] %v\n", c.Method(), c.Path(), err)
+	}
+	return Write(c, &p)
+}
+
+// Write sends p as the response.
+func Write(c *fiber.Ctx, p *Problem) error {
+	body, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	c.Set(fiber.HeaderContentType, ContentType)
+	return c.Status(p.Status).Send(body)
+}
@@ -0,0 +1,134 @@
+// Package problem implements RFC 7807 problem+json error responses with
+// stable, machine-readable codes.
+//
+// Handlers return a *Problem as their error and the service's Fiber
+// ErrorHandler renders it:
+//
+//	app := fiber.New(fiber.Config{ErrorHandler: problem.ErrorHandler})
+//
+//	if err := c.BodyParser(&req); err != nil {
+//		return problem.BadRequest(problem.CodeInvalidBody, "Invalid request body")
+//	}
+package problem
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// ContentType is the media type of problem responses.
+const ContentType = "application/problem+json"
+
+// TypeBase prefixes the code to form the problem type URI.
+const TypeBase = "urn:school-erp:problem:"
+
+// Stable error codes. Clients may switch on these; never change an existing value.
+const (
+	CodeBadRequest          = "bad_request"
+	CodeInvalidBody         = "invalid_body"
+	CodeInvalidQuery        = "invalid_query"
+	CodeValidationFailed    = "validation_failed"
+	CodeUnauthorized        = "unauthorized"
+	CodeInvalidCredentials  = "invalid_credentials"
+	CodeInvalidToken        = "invalid_token"
+	CodeForbidden           = "forbidden"
+	CodeSchoolSuspended     = "school_suspended"
+	CodeModuleDisabled      = "module_disabled"
+	CodePlanLimitReached    = "plan_limit_reached"
+	CodeNotFound            = "not_found"
+	CodeMethodNotAllowed    = "method_not_allowed"
+	CodeConflict            = "conflict"
+	CodeAlreadyExists       = "already_exists"
+	CodeReferenceViolation  = "reference_violation"
+	CodeConstraintViolation = "constraint_violation"
+	CodeDomainUnverified    = "domain_not_verified"
+	CodeIdempotencyMismatch = "idempotency_key_mismatch"
+	CodeIdempotencyInFlight = "idempotency_key_in_flight"
+	CodePayloadTooLarge     = "payload_too_large"
+	CodeUnsupportedMedia    = "unsupported_media_type"
+	CodeFileInfected        = "file_infected"
+	CodeLinkExpired         = "link_expired"
+	CodeRateLimited         = "rate_limited"
+	CodeInternal            = "internal_error"
+	CodeUpstream            = "upstream_error"
+	CodeUnavailable         = "service_unavailable"
+	CodeTimeout             = "timeout"
+)
+
+// FieldError describes one invalid request field.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Problem is an RFC 7807 problem details object. It implements error.
+type Problem struct {
+	Type     string       `json:"type"`
+	Title    string       `json:"title"`
+	Status   int          `json:"status"`
+	Detail   string       `json:"detail,omitempty"`
+	Instance string       `json:"instance,omitempty"`
+	Code     string       `json:"code"`
+	Errors   []FieldError `json:"errors,omitempty"`
+
+	cause error
+}
+
+// New creates a problem with the given status, code and human-readable detail.
+func New(status int, code, detail string) *Problem {
+	return &Problem{
+		Type:   TypeBase + code,
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}
+}
+
+func (p *Problem) Error() string {
+	if p.cause != nil {
+		return fmt.Sprintf("%s: %s: %v", p.Code, p.Detail, p.cause)
+	}
+	return fmt.Sprintf("%s: %s", p.Code, p.Detail)
+}
+
+// Unwrap returns the underlying error, if any.
+func (p *Problem) Unwrap() error {
+	return p.cause
+}
+
+// Wrap records the underlying error for logging. It is never sent to clients.
+func (p *Problem) Wrap(err error) *Problem {
+	p.cause = err
+	return p
+}
+
+func BadRequest(code, detail string) *Problem {
+	return New(http.StatusBadRequest, code, detail)
+}
+
+func Unauthorized(code, detail string) *Problem {
+	return New(http.StatusUnauthorized, code, detail)
+}
+
+func Forbidden(code, detail string) *Problem {
+	return New(http.StatusForbidden, code, detail)
+}
+
+func NotFound(detail string) *Problem {
+	return New(http.StatusNotFound, CodeNotFound, detail)
+}
+
+func Conflict(code, detail string) *Problem {
+	return New(http.StatusConflict, code, detail)
+}
+
+func Unprocessable(code, detail string) *Problem {
+	return New(http.StatusUnprocessableEntity, code, detail)
+}
+
+// Internal hides err from the client and keeps it for the error log.
+func Internal(detail string, err error) *Problem {
+	return New(http.StatusInternalServerError, CodeInternal, detail).Wrap(err)
+}
@@ -0,0 +1,127 @@
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestFromDB(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   string
+		fields []string
+	}{
+		{"no rows", pgx.ErrNoRows, 404, CodeNotFound, nil},
+		{"unique", &pgconn.PgError{Code: "23505", Detail: "Key (school_id, email)=(1, a@b.c) already exists."}, 409, CodeAlreadyExists, []string{"school_id", "email"}},
+		{"foreign key", fmt.Errorf("insert: %w", &pgconn.PgError{Code: "23503", Detail: "Key (student_id)=(9) is not present in table \"students\"."}), 422, CodeReferenceViolation, []string{"student_id"}},
+		{"check", &pgconn.PgError{Code: "23514", ColumnName: "status"}, 422, CodeConstraintViolation, []string{"status"}},
+		{"bad uuid", &pgconn.PgError{Code: "22P02"}, 400, CodeBadRequest, nil},
+		{"other", errors.New("connection refused"), 500, CodeInternal, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := FromDB(tt.err, "User")
+			if p.Status != tt.status || p.Code != tt.code {
+				t.Errorf("FromDB() = %d %s, want %d %s", p.Status, p.Code, tt.status, tt.code)
+			}
+			if len(p.Errors) != len(tt.fields) {
+				t.Fatalf("Errors = %+v, want fields %v", p.Errors, tt.fields)
+			}
+			for i, field := range tt.fields {
+				if p.Errors[i].Field != field {
+					t.Errorf("Errors[%d].Field = %q, want %q", i, p.Errors[i].Field, field)
+				}
+			}
+			if !errors.Is(p, tt.err) && !errors.Is(tt.err, p.Unwrap()) {
+				t.Errorf("FromDB() does not wrap the original error")
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	type address struct {
+		City string `json:"city" validate:"required"`
+	}
+	type request struct {
+		Email   string  `json:"email" validate:"required,email"`
+		Role    string  `json:"role" validate:"oneof=admin teacher"`
+		Address address `json:"address"`
+	}
+
+	err := Validate(request{Email: "nope", Role: "root"})
+	var p *Problem
+	if !errors.As(err, &p) {
+		t.Fatalf("Validate() error = %v, want *Problem", err)
+	}
+	if p.Status != 422 || p.Code != CodeValidationFailed {
+		t.Errorf("Validate() = %d %s, want 422 %s", p.Status, p.Code, CodeValidationFailed)
+	}
+	got := map[string]string{}
+	for _, fe := range p.Errors {
+		got[fe.Field] = fe.Code
+	}
+	want := map[string]string{"email": "email", "role": "oneof", "address.city": "required"}
+	for field, code := range want {
+		if got[field] != code {
+			t.Errorf("field %q code = %q, want %q (all: %v)", field, got[field], code, got)
+		}
+	}
+
+	if err := Validate(request{Email: "a@b.c", Role: "admin", Address: address{City: "Kathmandu"}}); err != nil {
+		t.Errorf("Validate(valid) = %v, want nil", err)
+	}
+}
+
+func TestErrorHandler(t *testing.T) {
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	app.Get("/conflict", func(c *fiber.Ctx) error {
+		return Conflict(CodeAlreadyExists, "School already exists")
+	})
+	app.Get("/boom", func(c *fiber.Ctx) error {
+		return errors.New("secret connection string leaked")
+	})
+
+	tests := []struct {
+		path   string
+		status int
+		code   string
+	}{
+		{"/conflict", 409, CodeAlreadyExists},
+		{"/boom", 500, CodeInternal},
+		{"/missing", 404, CodeNotFound},
+	}
+	for _, tt := range tests {
+		resp, err := app.Test(httptest.NewRequest("GET", tt.path, nil))
+		if err != nil {
+			t.Fatalf("app.Test(%s) error = %v", tt.path, err)
+		}
+		if ct := resp.Header.Get("Content-Type"); ct != ContentType {
+			t.Errorf("%s Content-Type = %q, want %q", tt.path, ct, ContentType)
+		}
+		data, _ := io.ReadAll(resp.Body)
+		var body Problem
+		if err := json.Unmarshal(data, &body); err != nil {
+			t.Fatalf("%s body = %s: %v", tt.path, data, err)
+		}
+		if resp.StatusCode != tt.status || body.Status != tt.status || body.Code != tt.code {
+			t.Errorf("%s = %d %+v, want %d %s", tt.path, resp.StatusCode, body, tt.status, tt.code)
+		}
+		if body.Instance != tt.path || body.Type != TypeBase+tt.code {
+			t.Errorf("%s instance/type = %q %q", tt.path, body.Instance, body.Type)
+		}
+		if tt.status == 500 && body.Detail != "An unexpected error occurred" {
+			t.Errorf("500 detail = %q, internal error text must not leak", body.Detail)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package problem
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
+var validate = NewValidator()
+
+// NewValidator returns a validator that reports fields by their JSON names.
+func NewValidator() *validator.Validate {
+	v := validator.New()
+	v.RegisterTagNameFunc(func(f reflect.StructField) string {
+		name := strings.SplitN(f.Tag.Get("json"), ",", 2)[0]
+		if name == "-" {
+			return ""
+		}
+		if name == "" {
+			return f.Name
+		}
+		return name
+	})
+	return v
+}
+
+// Validate checks s against its `validate` tags and returns a 422 problem
+// listing each invalid field, or nil.
+func Validate(s interface{}) error {
+	if err := validate.Struct(s); err != nil {
+		return FromValidation(err)
+	}
+	return nil
+}
+
+// FromValidation converts a go-playground/validator error into a problem.
+func FromValidation(err error) *Problem {
+	var verrs validator.ValidationErrors
+	if !errors.As(err, &verrs) {
+		return BadRequest(CodeInvalidBody, "Invalid request body").Wrap(err)
+	}
+
+	p := Unprocessable(CodeValidationFailed, "One or more fields are invalid")
+	for _, fe := range verrs {
+		p.Errors = append(p.Errors, FieldError{
+			Field:   fieldPath(fe),
+			Code:    fe.Tag(),
+			Message: message(fe),
+		})
+	}
+	return p
+}
+
+// fieldPath drops the top-level struct name from the namespace.
+func fieldPath(fe validator.FieldError) string {
+	ns := fe.Namespace()
+	if i := strings.Index(ns, "."); i >= 0 {
+		return ns[i+1:]
+	}
+	return fe.Field()
+}
+
+func message(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "email":
+		return "must be a valid email address"
+	case "url":
+		return "must be a valid URL"
+	case "uuid", "uuid4":
+		return "must be a valid UUID"
+	case "oneof":
+		return "must be one of: " + strings.ReplaceAll(fe.Param(), " ", ", ")
+	case "min":
+		if fe.Kind() == reflect.String {
+			return fmt.Sprintf("must be at least %s characters", fe.Param())
+		}
+		return "must be at least " + fe.Param()
+	case "max":
+		if fe.Kind() == reflect.String {
+			return fmt.Sprintf("must be at most %s characters", fe.Param())
+		}
+		return "must be at most " + fe.Param()
+	case "len":
+		return "must have length " + fe.Param()
+	case "gt", "gte", "lt", "lte":
+		return fmt.Sprintf("must be %s %s", comparisons[fe.Tag()], fe.Param())
+	}
+	return "failed the " + fe.Tag() + " rule"
+}
+
+var comparisons = map[string]string{
+	"gt":  "greater than",
+	"gte": "greater than or equal to",
+	"lt":  "less than",
+	"lte": "less than or equal to",
+}
@@ -0,0 +1,163 @@
+package query
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Page is the standard list response envelope.
+type Page struct {
+	Data       []interface{} `json:"data"`
+	Pagination Pagination    `json:"pagination"`
+}
+
+// Pagination describes how to fetch the next page.
+type Pagination struct {
+	Limit      int     `json:"limit"`
+	HasMore    bool    `json:"has_more"`
+	NextCursor *string `json:"next_cursor"`
+}
+
+// cursor is the decoded form of the opaque cursor parameter.
+type cursor struct {
+	Sort   string   `json:"s"`
+	Values []string `json:"v"`
+}
+
+// NewPage builds the envelope from rows fetched with Spec.Query, which asks
+// for one row more than the limit. The cursor values are read from the JSON
+// form of the last row, so sort field names must match JSON names.
+func NewPage[T any](s *Spec, rows []T) (*Page, error) {
+	page := &Page{Data: make([]interface{}, 0, len(rows)), Pagination: Pagination{Limit: s.Limit}}
+
+	if len(rows) > s.Limit {
+		rows = rows[:s.Limit]
+		page.Pagination.HasMore = true
+	}
+
+	for _, row := range rows {
+		if len(s.Fields) == 0 {
+			page.Data = append(page.Data, row)
+			continue
+		}
+		obj, err := toObject(row)
+		if err != nil {
+			return nil, err
+		}
+		sparse := make(map[string]json.RawMessage, len(s.Fields))
+		for _, name := range s.Fields {
+			if v, ok := obj[name]; ok {
+				sparse[name] = v
+			}
+		}
+		page.Data = append(page.Data, sparse)
+	}
+
+	if page.Pagination.HasMore && len(rows) > 0 {
+		next, err := s.encodeCursor(rows[len(rows)-1])
+		if err != nil {
+			return nil, err
+		}
+		page.Pagination.NextCursor = &next
+	}
+	return page, nil
+}
+
+// signature identifies the ordering a cursor was issued for.
+func (s *Spec) signature() string {
+	keys := make([]string, len(s.Sort))
+	for i, key := range s.Sort {
+		keys[i] = key.Field
+		if key.Desc {
+			keys[i] = "-" + key.Field
+		}
+	}
+	return strings.Join(keys, ",")
+}
+
+func (s *Spec) encodeCursor(row interface{}) (string, error) {
+	obj, err := toObject(row)
+	if err != nil {
+		return "", err
+	}
+
+	c := cursor{Sort: s.signature()}
+	for _, key := range s.Sort {
+		raw, ok := obj[key.Field]
+		if !ok {
+			return "", fmt.Errorf("query: sort field %q is missing from the response row", key.Field)
+		}
+		value, err := scalar(raw)
+		if err != nil {
+			return "", fmt.Errorf("query: sort field %q: %w", key.Field, err)
+		}
+		c.Values = append(c.Values, value)
+	}
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+func decodeCursor(raw string, s *Spec) ([]interface{}, error) {
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, errors.New("malformed cursor")
+	}
+	var c cursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, errors.New("malformed cursor")
+	}
+	if c.Sort != s.signature() || len(c.Values) != len(s.Sort) {
+		return nil, errors.New("cursor does not match the requested sort")
+	}
+
+	values := make([]interface{}, len(c.Values))
+	for i, key := range s.Sort {
+		v, err := convert(s.resource.Fields[key.Field].Type, c.Values[i])
+		if err != nil {
+			return nil, errors.New("malformed cursor")
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+func toObject(row interface{}) (map[string]json.RawMessage, error) {
+	data, err := json.Marshal(row)
+	if err != nil {
+		return nil, err
+	}
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return nil, fmt.Errorf("query: rows must encode as JSON objects: %w", err)
+	}
+	return obj, nil
+}
+
+// scalar turns a JSON string, number or boolean into its query-string form.
+func scalar(raw json.RawMessage) (string, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return "", err
+	}
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	default:
+		return "", errors.New("value is null or not a scalar")
+	}
+}
@@ -0,0 +1,364 @@
+// Package query parses list-endpoint query strings into a validated Spec and
+// renders it as SQL.
+//
+// Supported parameters:
+//
+//	filter[status]=active            equality shorthand
+//	filter[capacity][gte]=40         operators: eq ne gt gte lt lte like in
+//	filter[status][in]=active,inactive
+//	sort=-created_at,name            "-" sorts descending
+//	limit=20                         clamped to the resource maximum
+//	cursor=<opaque>                  next_cursor from the previous page
+//	fields=id,name                   sparse fieldset
+//
+// Every field must be declared on the Resource allowlist; column names are
+// only ever taken from the allowlist, never from the request, and values are
+// always passed as query arguments.
+package query
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Type is the value type of a field, used to parse filter and cursor values.
+type Type int
+
+const (
+	String Type = iota
+	Int
+	Float
+	Bool
+	Time
+	UUID
+	// ID is a UUID or integer key, passed as text so that the column's type,
+	// which differs between tenancy modes, decides
+	ID
+)
+
+// Op is a filter operator.
+type Op string
+
+const (
+	OpEq   Op = "eq"
+	OpNe   Op = "ne"
+	OpGt   Op = "gt"
+	OpGte  Op = "gte"
+	OpLt   Op = "lt"
+	OpLte  Op = "lte"
+	OpLike Op = "like"
+	OpIn   Op = "in"
+)
+
+var sqlOps = map[Op]string{
+	OpEq:  "=",
+	OpNe:  "<>",
+	OpGt:  ">",
+	OpGte: ">=",
+	OpLt:  "<",
+	OpLte: "<=",
+}
+
+// Field declares one field of a resource. The map key in Resource.Fields is
+// the public name, which must match the JSON name of the response field.
+type Field struct {
+	Column string // SQL column or expression, trusted
+	Type   Type
+	Filter bool // may appear in filter[...]
+	Sort   bool // may appear in sort; the column must be NOT NULL
+}
+
+// Resource is the allowlist for one list endpoint.
+type Resource struct {
+	Fields map[string]Field
+	// Key names a unique sortable field used as the final tie-breaker so
+	// cursors are stable. Usually "id".
+	Key string
+	// DefaultSort is used when the request has no sort parameter, e.g. "-created_at".
+	DefaultSort  string
+	DefaultLimit int
+	MaxLimit     int
+}
+
+// Filter is one parsed filter condition.
+type Filter struct {
+	Field  string
+	Op     Op
+	Values []interface{}
+}
+
+// SortKey is one parsed sort key.
+type SortKey struct {
+	Field string
+	Desc  bool
+}
+
+// Spec is a validated list request.
+type Spec struct {
+	resource *Resource
+	Filters  []Filter
+	Sort     []SortKey
+	Limit    int
+	Fields   []string
+	after    []interface{}
+}
+
+// Error is returned for invalid query parameters.
+type Error struct {
+	Param   string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("invalid %s: %s", e.Param, e.Message)
+}
+
+var filterParam = regexp.MustCompile(`^filter\[([A-Za-z0-9_]+)\](?:\[([a-z]+)\])?$`)
+
+// FromCtx parses the query string of a Fiber request.
+func FromCtx(c *fiber.Ctx, r *Resource) (*Spec, error) {
+	values, err := url.ParseQuery(string(c.Request().URI().QueryString()))
+	if err != nil {
+		return nil, &Error{Param: "query", Message: "malformed query string"}
+	}
+	return Parse(values, r)
+}
+
+// Parse validates values against the resource allowlist.
+func Parse(values url.Values, r *Resource) (*Spec, error) {
+	spec := &Spec{resource: r}
+
+	for param, vals := range values {
+		m := filterParam.FindStringSubmatch(param)
+		if m == nil {
+			if strings.HasPrefix(param, "filter") {
+				return nil, &Error{Param: param, Message: "expected filter[field] or filter[field][op]"}
+			}
+			continue
+		}
+		name, op := m[1], Op(m[2])
+		if op == "" {
+			op = OpEq
+		}
+		field, ok := r.Fields[name]
+		if !ok || !field.Filter {
+			return nil, &Error{Param: param, Message: fmt.Sprintf("filtering on %q is not allowed", name)}
+		}
+		if _, known := sqlOps[op]; !known && op != OpLike && op != OpIn {
+			return nil, &Error{Param: param, Message: fmt.Sprintf("unknown operator %q", op)}
+		}
+		if op == OpLike && field.Type != String {
+			return nil, &Error{Param: param, Message: "like is only supported on text fields"}
+		}
+
+		for _, raw := range vals {
+			items := []string{raw}
+			if op == OpIn {
+				items = splitList(raw)
+				if len(items) == 0 {
+					return nil, &Error{Param: param, Message: "in requires at least one value"}
+				}
+			}
+			f := Filter{Field: name, Op: op}
+			for _, item := range items {
+				v, err := convert(field.Type, item)
+				if err != nil {
+					return nil, &Error{Param: param, Message: err.Error()}
+				}
+				f.Values = append(f.Values, v)
+			}
+			spec.Filters = append(spec.Filters, f)
+		}
+	}
+
+	sortParam := values.Get("sort")
+	if sortParam == "" {
+		sortParam = r.DefaultSort
+	}
+	seen := map[string]bool{}
+	for _, item := range splitList(sortParam) {
+		key := SortKey{Field: item}
+		if strings.HasPrefix(item, "-") {
+			key = SortKey{Field: item[1:], Desc: true}
+		}
+		field, ok := r.Fields[key.Field]
+		if !ok || !field.Sort {
+			return nil, &Error{Param: "sort", Message: fmt.Sprintf("sorting on %q is not allowed", key.Field)}
+		}
+		if seen[key.Field] {
+			continue
+		}
+		seen[key.Field] = true
+		spec.Sort = append(spec.Sort, key)
+	}
+	if r.Key != "" && !seen[r.Key] {
+		spec.Sort = append(spec.Sort, SortKey{Field: r.Key})
+	}
+
+	spec.Limit = r.DefaultLimit
+	if spec.Limit <= 0 {
+		spec.Limit = 20
+	}
+	if raw := values.Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 {
+			return nil, &Error{Param: "limit", Message: "must be a positive integer"}
+		}
+		spec.Limit = n
+	}
+	if r.MaxLimit > 0 && spec.Limit > r.MaxLimit {
+		spec.Limit = r.MaxLimit
+	}
+
+	if raw := values.Get("fields"); raw != "" {
+		for _, name := range splitList(raw) {
+			if _, ok := r.Fields[name]; !ok {
+				return nil, &Error{Param: "fields", Message: fmt.Sprintf("unknown field %q", name)}
+			}
+			spec.Fields = append(spec.Fields, name)
+		}
+	}
+
+	if raw := values.Get("cursor"); raw != "" {
+		after, err := decodeCursor(raw, spec)
+		if err != nil {
+			return nil, &Error{Param: "cursor", Message: err.Error()}
+		}
+		spec.after = after
+	}
+
+	return spec, nil
+}
+
+// Query appends the spec's filters, cursor condition, ordering and limit to
+// selectFrom ("SELECT ... FROM table"). where holds fixed conditions already
+// referring to args as $1..$n. One extra row is fetched so NewPage can tell
+// whether another page exists.
+func (s *Spec) Query(selectFrom string, where []string, args ...interface{}) (string, []interface{}) {
+	conds := append([]string(nil), where...)
+	next := func(v interface{}) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	for _, f := range s.Filters {
+		column := s.resource.Fields[f.Field].Column
+		switch f.Op {
+		case OpIn:
+			placeholders := make([]string, len(f.Values))
+			for i, v := range f.Values {
+				placeholders[i] = next(v)
+			}
+			conds = append(conds, fmt.Sprintf("%s IN (%s)", column, strings.Join(placeholders, ", ")))
+		case OpLike:
+			conds = append(conds, fmt.Sprintf("%s ILIKE %s", column, next("%"+escapeLike(f.Values[0].(string))+"%")))
+		default:
+			conds = append(conds, fmt.Sprintf("%s %s %s", column, sqlOps[f.Op], next(f.Values[0])))
+		}
+	}
+
+	if s.after != nil {
+		// (a, b, c) after (x, y, z) expands to
+		// a>x OR (a=x AND b>y) OR (a=x AND b=y AND c>z), honouring each direction.
+		var ors []string
+		for i, key := range s.Sort {
+			var ands []string
+			for j := 0; j < i; j++ {
+				ands = append(ands, fmt.Sprintf("%s = %s", s.resource.Fields[s.Sort[j].Field].Column, next(s.after[j])))
+			}
+			op := ">"
+			if key.Desc {
+				op = "<"
+			}
+			ands = append(ands, fmt.Sprintf("%s %s %s", s.resource.Fields[key.Field].Column, op, next(s.after[i])))
+			ors = append(ors, "("+strings.Join(ands, " AND ")+")")
+		}
+		conds = append(conds, "("+strings.Join(ors, " OR ")+")")
+	}
+
+	sql := selectFrom
+	if len(conds) > 0 {
+		sql += " WHERE " + strings.Join(conds, " AND ")
+	}
+	if len(s.Sort) > 0 {
+		order := make([]string, len(s.Sort))
+		for i, key := range s.Sort {
+			order[i] = s.resource.Fields[key.Field].Column
+			if key.Desc {
+				order[i] += " DESC"
+			}
+		}
+		sql += " ORDER BY " + strings.Join(order, ", ")
+	}
+	sql += " LIMIT " + next(s.Limit+1)
+	return sql, args
+}
+
+// convert parses a raw query value according to t.
+func convert(t Type, raw string) (interface{}, error) {
+	switch t {
+	case Int:
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an integer", raw)
+		}
+		return n, nil
+	case Float:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a number", raw)
+		}
+		return f, nil
+	case Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a boolean", raw)
+		}
+		return b, nil
+	case Time:
+		if t, err := time.Parse(time.RFC3339Nano, raw); err == nil {
+			return t, nil
+		}
+		if t, err := time.Parse("2006-01-02", raw); err == nil {
+			return t, nil
+		}
+		return nil, fmt.Errorf("%q is not an RFC 3339 timestamp or YYYY-MM-DD date", raw)
+	case UUID:
+		if !uuidPattern.MatchString(raw) {
+			return nil, fmt.Errorf("%q is not a UUID", raw)
+		}
+		return strings.ToLower(raw), nil
+	case ID:
+		if !uuidPattern.MatchString(raw) && !intPattern.MatchString(raw) {
+			return nil, fmt.Errorf("%q is not an ID", raw)
+		}
+		return strings.ToLower(raw), nil
+	default:
+		return raw, nil
+	}
+}
+
+var (
+	uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	intPattern  = regexp.MustCompile(`^[0-9]{1,18}$`)
+)
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+func splitList(raw string) []string {
+	var items []string
+	for _, item := range strings.Split(raw, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
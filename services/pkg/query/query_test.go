@@ -0,0 +1,200 @@
+package query
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var busResource = &Resource{
+	Fields: map[string]Field{
+		"id":        {Column: "id", Type: UUID, Filter: true, Sort: true},
+		"busNumber": {Column: "bus_number", Type: String, Filter: true, Sort: true},
+		"capacity":  {Column: "capacity", Type: Int, Filter: true, Sort: true},
+		"status":    {Column: "status", Type: String, Filter: true},
+		"createdAt": {Column: "created_at", Type: Time, Sort: true},
+		"model":     {Column: "model", Type: String},
+	},
+	Key:          "id",
+	DefaultSort:  "-createdAt",
+	DefaultLimit: 20,
+	MaxLimit:     100,
+}
+
+type bus struct {
+	ID        string    `json:"id"`
+	BusNumber string    `json:"busNumber"`
+	Capacity  int       `json:"capacity"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func parse(t *testing.T, raw string) (*Spec, error) {
+	t.Helper()
+	values, err := url.ParseQuery(raw)
+	if err != nil {
+		t.Fatalf("ParseQuery(%q) error = %v", raw, err)
+	}
+	return Parse(values, busResource)
+}
+
+func TestParseDefaults(t *testing.T) {
+	spec, err := parse(t, "")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	want := []SortKey{{Field: "createdAt", Desc: true}, {Field: "id"}}
+	if !reflect.DeepEqual(spec.Sort, want) {
+		t.Errorf("Sort = %+v, want %+v", spec.Sort, want)
+	}
+	if spec.Limit != 20 {
+		t.Errorf("Limit = %d, want 20", spec.Limit)
+	}
+
+	sql, args := spec.Query("SELECT id FROM buses", nil)
+	wantSQL := "SELECT id FROM buses ORDER BY created_at DESC, id LIMIT $1"
+	if sql != wantSQL || !reflect.DeepEqual(args, []interface{}{21}) {
+		t.Errorf("Query() = %q %v, want %q [21]", sql, args, wantSQL)
+	}
+}
+
+func TestParseFiltersBuildParameterisedSQL(t *testing.T) {
+	spec, err := parse(t, "filter[capacity][gte]=40&filter[status][in]=Active,Maintenance&filter[busNumber][like]=5_%25&sort=busNumber&limit=500")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if spec.Limit != 100 {
+		t.Errorf("Limit = %d, want clamp to 100", spec.Limit)
+	}
+
+	sql, args := spec.Query("SELECT id FROM buses", []string{"deleted_at IS NULL"})
+	for _, fragment := range []string{
+		"deleted_at IS NULL",
+		"capacity >= $",
+		"status IN ($",
+		"bus_number ILIKE $",
+		"ORDER BY bus_number, id",
+	} {
+		if !strings.Contains(sql, fragment) {
+			t.Errorf("Query() = %q, missing %q", sql, fragment)
+		}
+	}
+	if strings.Contains(sql, "Active") || strings.Contains(sql, "40") {
+		t.Errorf("Query() = %q, values must not be inlined", sql)
+	}
+	found := false
+	for _, a := range args {
+		if a == `%5\_\%%` {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("args = %v, want escaped like pattern", args)
+	}
+}
+
+func TestParseIDsOfEitherType(t *testing.T) {
+	r := &Resource{Fields: map[string]Field{"id": {Column: "id", Type: ID, Filter: true, Sort: true}}, Key: "id", DefaultLimit: 20, MaxLimit: 100}
+	for raw, want := range map[string]interface{}{
+		"filter[id]=42": "42",
+		"filter[id]=8F14E45F-CEEA-467F-A0A6-9C3D1B2C4E5A": "8f14e45f-ceea-467f-a0a6-9c3d1b2c4e5a",
+	} {
+		values, _ := url.ParseQuery(raw)
+		spec, err := Parse(values, r)
+		if err != nil {
+			t.Fatalf("Parse(%q) error = %v", raw, err)
+		}
+		if got := spec.Filters[0].Values[0]; got != want {
+			t.Errorf("Parse(%q) value = %v, want %v", raw, got, want)
+		}
+	}
+	for _, raw := range []string{"filter[id]=4x", "filter[id]=-1", "filter[id][like]=4"} {
+		values, _ := url.ParseQuery(raw)
+		if _, err := Parse(values, r); err == nil {
+			t.Errorf("Parse(%q) error = nil, want one", raw)
+		}
+	}
+}
+
+func TestParseRejectsUnlistedFields(t *testing.T) {
+	tests := []string{
+		"filter[model]=x",
+		"filter[password][eq]=x",
+		"filter[capacity][regex]=x",
+		"filter[capacity]=forty",
+		"filter[id]=1%3BDROP%20TABLE%20buses",
+		"sort=status",
+		"sort=created_at%3BDROP%20TABLE%20buses",
+		"fields=secret",
+		"limit=0",
+		"cursor=garbage!",
+	}
+	for _, raw := range tests {
+		_, err := parse(t, raw)
+		var qerr *Error
+		if !errors.As(err, &qerr) {
+			t.Errorf("Parse(%q) error = %v, want *Error", raw, err)
+		}
+	}
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	spec, err := parse(t, "limit=2")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	base := time.Date(2025, 1, 1, 10, 0, 0, 123456000, time.UTC)
+	rows := []bus{
+		{ID: "00000000-0000-0000-0000-000000000003", CreatedAt: base.Add(2 * time.Hour)},
+		{ID: "00000000-0000-0000-0000-000000000002", CreatedAt: base.Add(time.Hour)},
+		{ID: "00000000-0000-0000-0000-000000000001", CreatedAt: base},
+	}
+	page, err := NewPage(spec, rows)
+	if err != nil {
+		t.Fatalf("NewPage() error = %v", err)
+	}
+	if len(page.Data) != 2 || !page.Pagination.HasMore || page.Pagination.NextCursor == nil {
+		t.Fatalf("page = %+v, want 2 rows and a next cursor", page.Pagination)
+	}
+
+	next, err := parse(t, "limit=2&cursor="+*page.Pagination.NextCursor)
+	if err != nil {
+		t.Fatalf("Parse(cursor) error = %v", err)
+	}
+	sql, args := next.Query("SELECT id FROM buses", nil)
+	if !strings.Contains(sql, "((created_at < $1) OR (created_at = $2 AND id > $3))") {
+		t.Errorf("Query() = %q, want keyset condition", sql)
+	}
+	if got := args[0].(time.Time); !got.Equal(rows[1].CreatedAt) {
+		t.Errorf("cursor createdAt = %v, want %v", got, rows[1].CreatedAt)
+	}
+	if args[2] != rows[1].ID {
+		t.Errorf("cursor id = %v, want %v", args[2], rows[1].ID)
+	}
+
+	if _, err := parse(t, "sort=capacity&cursor="+*page.Pagination.NextCursor); err == nil {
+		t.Error("Parse() accepted a cursor issued for a different sort")
+	}
+}
+
+func TestSparseFields(t *testing.T) {
+	spec, err := parse(t, "fields=id,capacity")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	page, err := NewPage(spec, []bus{{ID: "a", BusNumber: "B-1", Capacity: 40}})
+	if err != nil {
+		t.Fatalf("NewPage() error = %v", err)
+	}
+	if page.Pagination.NextCursor != nil {
+		t.Errorf("NextCursor = %v, want nil on the last page", *page.Pagination.NextCursor)
+	}
+	row := page.Data[0].(map[string]json.RawMessage)
+	if len(row) != 2 || string(row["capacity"]) != "40" {
+		t.Errorf("row = %v, want only id and capacity", row)
+	}
+}
@@ -0,0 +1,73 @@
+package settings
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"school-erp/pkg/cache"
+)
+
+// Client reads settings for the services. Documents are cached for ttl or
+// until a SettingsChanged event for them is passed to HandleEvent.
+type Client struct {
+	fetch func(ctx context.Context, schoolID, namespace string) ([]byte, error)
+	cache *cache.TTL[cacheKey, []byte] // nil data when nothing was stored
+}
+
+type cacheKey struct {
+	schoolID, namespace string
+}
+
+// NewClient creates a client reading the main database
+func NewClient(db *pgxpool.Pool, ttl time.Duration) *Client {
+	fetch := func(ctx context.Context, schoolID, namespace string) ([]byte, error) {
+		var data []byte
+		err := db.QueryRow(ctx, `
+		SELECT data FROM school_settings WHERE school_id = $1 AND namespace = $2`, schoolID, namespace,
+		).Scan(&data)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return data, err
+	}
+	return &Client{fetch: fetch, cache: cache.NewTTL[cacheKey, []byte](ttl)}
+}
+
+// Load fills s with the school's settings of s's namespace. Properties that
+// were never set, and every property of a school without settings, take
+// their defaults.
+//
+//	var grading settings.Grading
+//	err := client.Load(ctx, tenant.CurrentSchool(c).ID, &grading)
+func (c *Client) Load(ctx context.Context, schoolID string, s Settings) error {
+	key := cacheKey{schoolID, s.Namespace()}
+	data, err := c.cache.Get(key, func() ([]byte, error) {
+		return c.fetch(ctx, schoolID, key.namespace)
+	})
+	if err != nil {
+		return err
+	}
+	return decode(data, s)
+}
+
+// Invalidate drops the cached settings of the school in namespace
+func (c *Client) Invalidate(schoolID, namespace string) {
+	c.cache.Invalidate(cacheKey{schoolID, namespace})
+}
+
+// HandleEvent invalidates the settings named by a SettingsChanged message;
+// malformed ones are logged
+func (c *Client) HandleEvent(data []byte) {
+	var e SettingsChanged
+	if err := json.Unmarshal(data, &e); err != nil {
+		log.Printf("Invalid %s event: %v\n", SubjectSettingsChanged, err)
+		return
+	}
+	c.Invalidate(e.SchoolID, e.Namespace)
+}
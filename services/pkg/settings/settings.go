@@ -0,0 +1,217 @@
+// Package settings holds the typed per-school settings. The school service
+// keeps them in the main database with a Store, one versioned JSON document
+// per school and namespace; other services read them with a Client.
+package settings
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"school-erp/pkg/openapi"
+	"school-erp/pkg/problem"
+)
+
+// Namespaces of settings
+const (
+	NamespaceAcademic     = "academic"
+	NamespaceFee          = "fee"
+	NamespaceNotification = "notification"
+	NamespaceBranding     = "branding"
+	NamespaceGrading      = "grading"
+)
+
+// ErrUnknownNamespace is returned for namespaces that are not registered
+var ErrUnknownNamespace = errors.New("unknown settings namespace")
+
+// Settings is the document of one namespace
+type Settings interface {
+	Namespace() string
+}
+
+// Academic configures the school year and week
+type Academic struct {
+	Calendar       string   `json:"calendar" validate:"oneof=BS AD" doc:"Calendar dates are shown in: Bikram Sambat or Gregorian"`
+	YearStartMonth int      `json:"year_start_month" validate:"min=1,max=12" doc:"Month of the calendar the academic year starts in"`
+	WeekStart      string   `json:"week_start" validate:"oneof=sunday monday saturday"`
+	WorkingDays    []string `json:"working_days" validate:"min=1,max=7,unique,dive,oneof=sunday monday tuesday wednesday thursday friday saturday"`
+	AttendanceMode string   `json:"attendance_mode" validate:"oneof=daily period" doc:"Attendance is taken once a day or every period"`
+}
+
+func (Academic) Namespace() string { return NamespaceAcademic }
+
+// Fee configures billing
+type Fee struct {
+	Currency       string  `json:"currency" validate:"len=3,uppercase" doc:"ISO 4217 code"`
+	DueDay         int     `json:"due_day" validate:"min=1,max=28" doc:"Day of the month fees are due"`
+	GraceDays      int     `json:"grace_days" validate:"min=0,max=90"`
+	LateFeePercent float64 `json:"late_fee_percent" validate:"min=0,max=100"`
+	ReceiptPrefix  string  `json:"receipt_prefix" validate:"omitempty,max=10,alphanum"`
+}
+
+func (Fee) Namespace() string { return NamespaceFee }
+
+// Notification configures messages to parents and staff
+type Notification struct {
+	EmailEnabled          bool   `json:"email_enabled"`
+	SMSEnabled            bool   `json:"sms_enabled"`
+	SenderName            string `json:"sender_name" validate:"max=50"`
+	AbsenceAlerts         bool   `json:"absence_alerts" doc:"Tell parents when a student is marked absent"`
+	FeeReminderDaysBefore int    `json:"fee_reminder_days_before" validate:"min=0,max=30" doc:"0 disables fee reminders"`
+}
+
+func (Notification) Namespace() string { return NamespaceNotification }
+
+// Branding is how the school's apps and documents look
+type Branding struct {
+	DisplayName  string `json:"display_name" validate:"max=255" doc:"Defaults to the school's name when empty"`
+	LogoURL      string `json:"logo_url" validate:"omitempty,url,max=2048"`
+	FaviconURL   string `json:"favicon_url" validate:"omitempty,url,max=2048"`
+	PrimaryColor string `json:"primary_color" validate:"hexcolor"`
+	AccentColor  string `json:"accent_color" validate:"hexcolor"`
+}
+
+func (Branding) Namespace() string { return NamespaceBranding }
+
+// GradeBand is the grade of marks from MinPercent up to the next band
+type GradeBand struct {
+	Grade      string  `json:"grade" validate:"required,max=10"`
+	MinPercent float64 `json:"min_percent" validate:"min=0,max=100"`
+	Point      float64 `json:"point" validate:"min=0,max=10"`
+}
+
+// Grading configures how marks become grades
+type Grading struct {
+	Scale       string      `json:"scale" validate:"oneof=percentage gpa letter"`
+	PassPercent float64     `json:"pass_percent" validate:"min=0,max=100"`
+	Bands       []GradeBand `json:"bands" validate:"min=1,dive" doc:"Grade bands, highest first"`
+}
+
+func (Grading) Namespace() string { return NamespaceGrading }
+
+// Grade returns the band of percent, or nil when it is below every band
+func (g *Grading) Grade(percent float64) *GradeBand {
+	var best *GradeBand
+	for i := range g.Bands {
+		b := &g.Bands[i]
+		if percent >= b.MinPercent && (best == nil || b.MinPercent > best.MinPercent) {
+			best = b
+		}
+	}
+	return best
+}
+
+// defaults returns a new document of each namespace with its default values
+var defaults = map[string]func() Settings{
+	NamespaceAcademic: func() Settings {
+		return &Academic{
+			Calendar:       "BS",
+			YearStartMonth: 1,
+			WeekStart:      "sunday",
+			WorkingDays:    []string{"sunday", "monday", "tuesday", "wednesday", "thursday", "friday"},
+			AttendanceMode: "daily",
+		}
+	},
+	NamespaceFee: func() Settings {
+		return &Fee{Currency: "NPR", DueDay: 10, ReceiptPrefix: "RCP"}
+	},
+	NamespaceNotification: func() Settings {
+		return &Notification{EmailEnabled: true, AbsenceAlerts: true, FeeReminderDaysBefore: 3}
+	},
+	NamespaceBranding: func() Settings {
+		return &Branding{PrimaryColor: "#1e3a8a", AccentColor: "#f59e0b"}
+	},
+	NamespaceGrading: func() Settings {
+		// The letter grades of Nepal's National Examinations Board
+		return &Grading{Scale: "gpa", PassPercent: 35, Bands: []GradeBand{
+			{Grade: "A+", MinPercent: 90, Point: 4.0},
+			{Grade: "A", MinPercent: 80, Point: 3.6},
+			{Grade: "B+", MinPercent: 70, Point: 3.2},
+			{Grade: "B", MinPercent: 60, Point: 2.8},
+			{Grade: "C+", MinPercent: 50, Point: 2.4},
+			{Grade: "C", MinPercent: 40, Point: 2.0},
+			{Grade: "D", MinPercent: 35, Point: 1.6},
+			{Grade: "NG", MinPercent: 0, Point: 0},
+		}}
+	},
+}
+
+// models are the JSON schemas of the namespaces
+var models = func() map[string]*openapi.Model {
+	m := make(map[string]*openapi.Model, len(defaults))
+	for ns, def := range defaults {
+		m[ns] = openapi.ModelOf(def())
+	}
+	return m
+}()
+
+// Namespaces returns the registered namespaces in order
+func Namespaces() []string {
+	names := make([]string, 0, len(defaults))
+	for ns := range defaults {
+		names = append(names, ns)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Default returns the default settings of namespace
+func Default(namespace string) (Settings, error) {
+	def, ok := defaults[namespace]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownNamespace, namespace)
+	}
+	return def(), nil
+}
+
+// Schema returns the JSON schema of namespace
+func Schema(namespace string) (*openapi.Model, error) {
+	m, ok := models[namespace]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownNamespace, namespace)
+	}
+	return m, nil
+}
+
+// Parse validates a document of namespace against its schema and rules.
+// Properties it omits take their defaults. Invalid documents are returned
+// as 422 problems.
+func Parse(namespace string, data []byte) (Settings, error) {
+	s, err := Default(namespace)
+	if err != nil {
+		return nil, err
+	}
+	if err := models[namespace].Validate(data); err != nil {
+		return nil, problem.Unprocessable(problem.CodeValidationFailed,
+			fmt.Sprintf("Invalid %s settings: %v", namespace, err))
+	}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, problem.Unprocessable(problem.CodeValidationFailed,
+			fmt.Sprintf("Invalid %s settings: %v", namespace, err))
+	}
+	if err := problem.Validate(s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// decode fills s with its defaults and then the stored document, which may
+// be nil, so properties added since it was written take their defaults
+func decode(data []byte, s Settings) error {
+	def, err := Default(s.Namespace())
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(def)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(b, s); err != nil {
+		return err
+	}
+	if data == nil {
+		return nil
+	}
+	return json.Unmarshal(data, s)
+}
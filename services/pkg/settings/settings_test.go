@@ -0,0 +1,94 @@
+package settings
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"school-erp/pkg/cache"
+	"school-erp/pkg/problem"
+)
+
+func TestParse(t *testing.T) {
+	s, err := Parse(NamespaceFee, []byte(`{"currency":"USD","due_day":5}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fee := s.(*Fee)
+	if fee.Currency != "USD" || fee.DueDay != 5 || fee.ReceiptPrefix != "RCP" {
+		t.Errorf("fee = %+v", fee)
+	}
+
+	invalid := map[string]string{
+		NamespaceFee:      `{"due_day":31}`,
+		NamespaceBranding: `{"primary_color":"blue"}`,
+		NamespaceAcademic: `{"working_days":["someday"]}`,
+		NamespaceGrading:  `{"bands":[{"grade":"A","min_percent":"high"}]}`,
+	}
+	for ns, data := range invalid {
+		var p *problem.Problem
+		if _, err := Parse(ns, []byte(data)); !errors.As(err, &p) || p.Status != 422 {
+			t.Errorf("%s %s: err = %v, want 422", ns, data, err)
+		}
+	}
+	if _, err := Parse(NamespaceNotification, []byte(`{"sms":true}`)); err == nil {
+		t.Error("unknown property accepted")
+	}
+	if _, err := Parse("colours", []byte(`{}`)); !errors.Is(err, ErrUnknownNamespace) {
+		t.Errorf("unknown namespace: %v", err)
+	}
+}
+
+func TestDefaultsAreValid(t *testing.T) {
+	for _, ns := range Namespaces() {
+		def, _ := Default(ns)
+		data, _ := json.Marshal(def)
+		if _, err := Parse(ns, data); err != nil {
+			t.Errorf("%s defaults: %v", ns, err)
+		}
+	}
+}
+
+func TestGrade(t *testing.T) {
+	def, _ := Default(NamespaceGrading)
+	g := def.(*Grading)
+	for percent, want := range map[float64]string{95: "A+", 90: "A+", 89.9: "A", 35: "D", 12: "NG"} {
+		if b := g.Grade(percent); b == nil || b.Grade != want {
+			t.Errorf("Grade(%v) = %+v, want %s", percent, b, want)
+		}
+	}
+}
+
+func TestClientCache(t *testing.T) {
+	stored := map[string][]byte{"1/fee": []byte(`{"currency":"USD"}`)}
+	fetches := 0
+	c := &Client{cache: cache.NewTTL[cacheKey, []byte](time.Minute)}
+	c.fetch = func(_ context.Context, schoolID, namespace string) ([]byte, error) {
+		fetches++
+		return stored[schoolID+"/"+namespace], nil
+	}
+	ctx := context.Background()
+
+	var fee Fee
+	if err := c.Load(ctx, "1", &fee); err != nil || fee.Currency != "USD" || fee.DueDay != 10 {
+		t.Fatalf("fee = %+v, %v", fee, err)
+	}
+	stored["1/fee"] = []byte(`{"currency":"EUR"}`)
+	if err := c.Load(ctx, "1", &fee); err != nil || fee.Currency != "USD" || fetches != 1 {
+		t.Fatalf("cached fee = %+v after %d fetches, %v", fee, fetches, err)
+	}
+
+	event, _ := json.Marshal(SettingsChanged{SchoolID: "1", Namespace: NamespaceFee, Version: 2})
+	c.HandleEvent(event)
+	if err := c.Load(ctx, "1", &fee); err != nil || fee.Currency != "EUR" || fetches != 2 {
+		t.Fatalf("fee after event = %+v after %d fetches, %v", fee, fetches, err)
+	}
+
+	// Schools without settings get the defaults
+	var branding Branding
+	if err := c.Load(ctx, "2", &branding); err != nil || branding.PrimaryColor != "#1e3a8a" {
+		t.Errorf("branding = %+v, %v", branding, err)
+	}
+}
@@ -0,0 +1,246 @@
+package settings
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"school-erp/pkg/events"
+)
+
+// Migration creates the tables used by Store in the main database, after
+// the schools table. The school service includes it in its migration list.
+const Migration = `
+CREATE TABLE IF NOT EXISTS school_settings (
+	school_id UUID NOT NULL REFERENCES schools(id) ON DELETE CASCADE,
+	namespace VARCHAR(50) NOT NULL,
+	version INTEGER NOT NULL,
+	data JSONB NOT NULL,
+	updated_by VARCHAR(255) NOT NULL,
+	updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (school_id, namespace)
+);
+
+CREATE TABLE IF NOT EXISTS school_settings_history (
+	id BIGSERIAL PRIMARY KEY,
+	school_id UUID NOT NULL REFERENCES schools(id) ON DELETE CASCADE,
+	namespace VARCHAR(50) NOT NULL,
+	version INTEGER NOT NULL,
+	data JSONB NOT NULL,
+	changed_by VARCHAR(255) NOT NULL,
+	changed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE (school_id, namespace, version)
+);
+`
+
+// SubjectSettingsChanged is the NATS subject of SettingsChanged events
+const SubjectSettingsChanged = "SchoolSettingsChanged"
+
+// SettingsChanged is published when a new version of a school's settings
+// is stored
+type SettingsChanged struct {
+	SchoolID  string    `json:"school_id"`
+	Namespace string    `json:"namespace"`
+	Version   int       `json:"version"`
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+// ErrVersionConflict is returned by Store.Put when the stored version is
+// not the one the change was based on
+var ErrVersionConflict = errors.New("settings were changed by someone else")
+
+// Document is one version of a school's settings in a namespace. Version 0
+// is the defaults, before anything was stored.
+type Document struct {
+	SchoolID  string          `json:"school_id"`
+	Namespace string          `json:"namespace"`
+	Version   int             `json:"version"`
+	Settings  json.RawMessage `json:"settings"`
+	UpdatedBy string          `json:"updated_by,omitempty"`
+	UpdatedAt *time.Time      `json:"updated_at,omitempty"`
+}
+
+// Store reads and writes settings in the main database. Every version is
+// kept in school_settings_history.
+type Store struct {
+	db      *pgxpool.Pool
+	publish events.Publisher
+}
+
+func NewStore(db *pgxpool.Pool, publish events.Publisher) *Store {
+	return &Store{db: db, publish: publish}
+}
+
+// Get returns the school's current settings of namespace, with defaults for
+// properties that were never set. It returns pgx.ErrNoRows for unknown
+// schools.
+func (s *Store) Get(ctx context.Context, schoolID, namespace string) (*Document, error) {
+	if _, err := Default(namespace); err != nil {
+		return nil, err
+	}
+	docs, err := s.get(ctx, schoolID, []string{namespace})
+	if err != nil {
+		return nil, err
+	}
+	return &docs[0], nil
+}
+
+// List returns the school's current settings of every namespace
+func (s *Store) List(ctx context.Context, schoolID string) ([]Document, error) {
+	return s.get(ctx, schoolID, Namespaces())
+}
+
+func (s *Store) get(ctx context.Context, schoolID string, namespaces []string) ([]Document, error) {
+	rows, err := s.db.Query(ctx, `
+	SELECT n.namespace, ss.version, ss.data, ss.updated_by, ss.updated_at
+	FROM schools sc
+	CROSS JOIN unnest($2::text[]) AS n(namespace)
+	LEFT JOIN school_settings ss ON ss.school_id = sc.id AND ss.namespace = n.namespace
+	WHERE sc.id = $1
+	ORDER BY n.namespace`, schoolID, namespaces)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var docs []Document
+	for rows.Next() {
+		d := Document{SchoolID: schoolID}
+		var version *int
+		var data []byte
+		var updatedBy *string
+		if err := rows.Scan(&d.Namespace, &version, &data, &updatedBy, &d.UpdatedAt); err != nil {
+			return nil, err
+		}
+		if version != nil {
+			d.Version, d.UpdatedBy = *version, *updatedBy
+		}
+		if d.Settings, err = complete(d.Namespace, data); err != nil {
+			return nil, err
+		}
+		docs = append(docs, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(docs) == 0 {
+		return nil, pgx.ErrNoRows
+	}
+	return docs, nil
+}
+
+// complete returns the stored document of namespace with defaults for the
+// properties it lacks
+func complete(namespace string, data []byte) (json.RawMessage, error) {
+	s, err := Default(namespace)
+	if err != nil {
+		return nil, err
+	}
+	if err := decode(data, s); err != nil {
+		return nil, err
+	}
+	return json.Marshal(s)
+}
+
+// Put validates data and stores it as the next version of the school's
+// settings. When base is not nil the change is refused with
+// ErrVersionConflict unless the current version is *base.
+func (s *Store) Put(ctx context.Context, schoolID, namespace string, data []byte, base *int, actor string) (*Document, error) {
+	parsed, err := Parse(namespace, data)
+	if err != nil {
+		return nil, err
+	}
+	normalized, err := json.Marshal(parsed)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	// The school's row lock orders concurrent changes, including the first
+	// one of a namespace, which has no settings row to lock
+	var exists bool
+	if err := tx.QueryRow(ctx, `SELECT true FROM schools WHERE id = $1 FOR NO KEY UPDATE`, schoolID).Scan(&exists); err != nil {
+		return nil, err
+	}
+	var current int
+	err = tx.QueryRow(ctx, `
+	SELECT version FROM school_settings WHERE school_id = $1 AND namespace = $2`, schoolID, namespace,
+	).Scan(&current)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, err
+	}
+	if base != nil && *base != current {
+		return nil, fmt.Errorf("%w: version %d is current, not %d", ErrVersionConflict, current, *base)
+	}
+
+	d := Document{SchoolID: schoolID, Namespace: namespace, Version: current + 1, Settings: normalized, UpdatedBy: actor}
+	err = tx.QueryRow(ctx, `
+	INSERT INTO school_settings (school_id, namespace, version, data, updated_by)
+	VALUES ($1, $2, $3, $4, $5)
+	ON CONFLICT (school_id, namespace) DO UPDATE
+	SET version = EXCLUDED.version, data = EXCLUDED.data, updated_by = EXCLUDED.updated_by, updated_at = CURRENT_TIMESTAMP
+	RETURNING updated_at`, schoolID, namespace, d.Version, normalized, actor,
+	).Scan(&d.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(ctx, `
+	INSERT INTO school_settings_history (school_id, namespace, version, data, changed_by, changed_at)
+	VALUES ($1, $2, $3, $4, $5, $6)`, schoolID, namespace, d.Version, normalized, actor, d.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	s.announce(d)
+	return &d, nil
+}
+
+// History returns up to limit versions of the school's settings of
+// namespace, newest first
+func (s *Store) History(ctx context.Context, schoolID, namespace string, limit int) ([]Document, error) {
+	if _, err := Default(namespace); err != nil {
+		return nil, err
+	}
+	rows, err := s.db.Query(ctx, `
+	SELECT version, data, changed_by, changed_at FROM school_settings_history
+	WHERE school_id = $1 AND namespace = $2
+	ORDER BY version DESC LIMIT $3`, schoolID, namespace, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	docs := []Document{}
+	for rows.Next() {
+		d := Document{SchoolID: schoolID, Namespace: namespace}
+		var data []byte
+		if err := rows.Scan(&d.Version, &data, &d.UpdatedBy, &d.UpdatedAt); err != nil {
+			return nil, err
+		}
+		d.Settings = data
+		docs = append(docs, d)
+	}
+	return docs, rows.Err()
+}
+
+// announce publishes a SettingsChanged event
+func (s *Store) announce(d Document) {
+	events.Send(s.publish, SubjectSettingsChanged, SettingsChanged{
+		SchoolID:  d.SchoolID,
+		Namespace: d.Namespace,
+		Version:   d.Version,
+		ChangedAt: *d.UpdatedAt,
+	})
+}
@@ -0,0 +1,204 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif" // decoded, and re-encoded as PNG
+	"image/jpeg"
+	"image/png"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+)
+
+var (
+	// ErrTooLarge is returned for files over their policy's MaxSize
+	ErrTooLarge = errors.New("file is too large")
+	// ErrUnsupportedType is returned for files whose content is not of a
+	// type their policy accepts, whatever their name says
+	ErrUnsupportedType = errors.New("unsupported file type")
+)
+
+// Content types of files
+const (
+	TypeJPEG = "image/jpeg"
+	TypePNG  = "image/png"
+	TypeGIF  = "image/gif"
+	TypePDF  = "application/pdf"
+)
+
+var extensions = map[string]string{
+	TypeJPEG: ".jpg",
+	TypePNG:  ".png",
+	TypeGIF:  ".gif",
+	TypePDF:  ".pdf",
+}
+
+// Extension returns the extension keys of files of contentType get
+func Extension(contentType string) string {
+	return extensions[contentType]
+}
+
+// ContentType returns the content type of the file under key, by the
+// extension its key was given
+func ContentType(key string) string {
+	for t, ext := range extensions {
+		if strings.EqualFold(path.Ext(key), ext) {
+			return t
+		}
+	}
+	if t := mime.TypeByExtension(path.Ext(key)); t != "" {
+		return t
+	}
+	return "application/octet-stream"
+}
+
+// Policy is what a kind of upload may be
+type Policy struct {
+	MaxSize int64
+	// Types are the accepted content types, as sniffed from the content
+	Types []string
+	// Images larger than MaxWidth by MaxHeight are scaled down to fit
+	MaxWidth, MaxHeight int
+}
+
+// Policies of the uploads of the services
+var (
+	// LogoPolicy accepts small images, scaled down to 512 pixels
+	LogoPolicy = Policy{MaxSize: 5 << 20, Types: []string{TypeJPEG, TypePNG, TypeGIF}, MaxWidth: 512, MaxHeight: 512}
+	// DocumentPolicy accepts scans and PDFs, such as birth certificates;
+	// scans are scaled down to A4 at 300 dpi
+	DocumentPolicy = Policy{MaxSize: 10 << 20, Types: []string{TypeJPEG, TypePNG, TypePDF}, MaxWidth: 2480, MaxHeight: 3508}
+	// ReceiptPolicy accepts photos and PDFs of receipts and deposit slips
+	ReceiptPolicy = Policy{MaxSize: 5 << 20, Types: []string{TypeJPEG, TypePNG, TypePDF}, MaxWidth: 2000, MaxHeight: 2000}
+)
+
+// maxPixels bounds the images decoded, so a small file cannot claim a huge
+// canvas
+const maxPixels = 50_000_000
+
+// ReadAll reads at most limit bytes of r, and returns ErrTooLarge when
+// there are more
+func ReadAll(r io.Reader, limit int64) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("%w: the limit is %d bytes", ErrTooLarge, limit)
+	}
+	return data, nil
+}
+
+// Sniff returns the content type of data by its content
+func Sniff(data []byte) string {
+	t, _, _ := mime.ParseMediaType(http.DetectContentType(data))
+	return t
+}
+
+// Process checks data against p by its content and returns it ready to
+// store. Images are decoded and re-encoded, which drops metadata and
+// anything appended to them, and scaled down to fit p; GIFs become PNGs.
+func Process(data []byte, p Policy) ([]byte, string, error) {
+	if int64(len(data)) > p.MaxSize {
+		return nil, "", fmt.Errorf("%w: the limit is %d bytes", ErrTooLarge, p.MaxSize)
+	}
+	t := Sniff(data)
+	accepted := false
+	for _, a := range p.Types {
+		accepted = accepted || a == t
+	}
+	if !accepted {
+		return nil, "", fmt.Errorf("%w %s: accepted are %s", ErrUnsupportedType, t, strings.Join(p.Types, ", "))
+	}
+
+	switch t {
+	case TypePDF:
+		return data, t, nil
+	case TypeJPEG, TypePNG, TypeGIF:
+		return reencode(data, t, p)
+	}
+	return nil, "", fmt.Errorf("%w %s", ErrUnsupportedType, t)
+}
+
+func reencode(data []byte, t string, p Policy) ([]byte, string, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: unreadable image: %v", ErrUnsupportedType, err)
+	}
+	if cfg.Width*cfg.Height > maxPixels {
+		return nil, "", fmt.Errorf("%w: %dx%d pixels", ErrTooLarge, cfg.Width, cfg.Height)
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: unreadable image: %v", ErrUnsupportedType, err)
+	}
+	img = Fit(img, p.MaxWidth, p.MaxHeight)
+
+	var out bytes.Buffer
+	if t == TypeJPEG {
+		err = jpeg.Encode(&out, img, &jpeg.Options{Quality: 85})
+	} else {
+		t = TypePNG
+		err = (&png.Encoder{CompressionLevel: png.BestCompression}).Encode(&out, img)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return out.Bytes(), t, nil
+}
+
+// Fit scales img down, keeping its aspect ratio, to fit maxWidth by
+// maxHeight; zero bounds do not limit. Pixels are averaged over the area
+// they cover.
+func Fit(img image.Image, maxWidth, maxHeight int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	scale := 1.0
+	if maxWidth > 0 && w > maxWidth {
+		scale = float64(maxWidth) / float64(w)
+	}
+	if maxHeight > 0 && float64(h)*scale > float64(maxHeight) {
+		scale = float64(maxHeight) / float64(h)
+	}
+	if scale == 1.0 {
+		return img
+	}
+	dw, dh := max(1, int(float64(w)*scale)), max(1, int(float64(h)*scale))
+
+	src := image.NewNRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(src, src.Bounds(), img, b.Min, draw.Src)
+	dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		y0, y1 := y*h/dh, max((y+1)*h/dh, y*h/dh+1)
+		for x := 0; x < dw; x++ {
+			x0, x1 := x*w/dw, max((x+1)*w/dw, x*w/dw+1)
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					px := row[sx*4 : sx*4+4]
+					// Weigh colours by alpha so transparent pixels do not darken edges
+					pa := uint64(px[3])
+					r += uint64(px[0]) * pa
+					g += uint64(px[1]) * pa
+					bl += uint64(px[2]) * pa
+					a += pa
+					n++
+				}
+			}
+			c := color.NRGBA{A: uint8(a / n)}
+			if a > 0 {
+				c.R, c.G, c.B = uint8(r/a), uint8(g/a), uint8(bl/a)
+			}
+			dst.SetNRGBA(x, y, c)
+		}
+	}
+	return dst
+}
@@ -0,0 +1,174 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"school-erp/pkg/problem"
+)
+
+// File is a stored upload
+type File struct {
+	Key         string `json:"key"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+}
+
+// Files stores the uploads of the services. Uploads are checked against a
+// policy by their content, re-encoded when they are images, scanned when a
+// scanner is set, and stored under the prefix of their school.
+type Files struct {
+	store   Store
+	signer  *Signer
+	scanner Scanner
+	ttl     time.Duration
+}
+
+// NewFiles creates Files storing in store. Download URLs last ttl and are
+// signed by signer unless the store presigns them; scanner may be nil.
+func NewFiles(store Store, signer *Signer, scanner Scanner, ttl time.Duration) *Files {
+	return &Files{store: store, signer: signer, scanner: scanner, ttl: ttl}
+}
+
+// Store returns the store files are kept in
+func (f *Files) Store() Store {
+	return f.store
+}
+
+// Save processes data by p and stores it under prefix, such as
+// SchoolPrefix(id), in category
+func (f *Files) Save(ctx context.Context, prefix, category string, data []byte, p Policy) (*File, error) {
+	data, contentType, err := Process(data, p)
+	if err != nil {
+		return nil, err
+	}
+	if f.scanner != nil {
+		if err := f.scanner.Scan(ctx, data); err != nil {
+			return nil, err
+		}
+	}
+	file := &File{Key: NewKey(prefix, category, Extension(contentType)), ContentType: contentType, Size: int64(len(data))}
+	if err := f.store.Put(ctx, file.Key, bytes.NewReader(data), file.Size, contentType); err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// Delete deletes the file under key
+func (f *Files) Delete(ctx context.Context, key string) error {
+	return f.store.Delete(ctx, key)
+}
+
+// URL returns a download URL of the file under key that lasts the TTL
+func (f *Files) URL(key string) (string, error) {
+	if p, ok := f.store.(Presigner); ok {
+		return p.PresignGet(key, f.ttl)
+	}
+	if err := CheckKey(key); err != nil {
+		return "", err
+	}
+	return f.signer.URL(key, f.ttl), nil
+}
+
+// Serve serves the files of the URLs of f; see Serve
+func (f *Files) Serve() fiber.Handler {
+	return Serve(f.store, f.signer)
+}
+
+// TTL returns how long download URLs last
+func (f *Files) TTL() time.Duration {
+	return f.ttl
+}
+
+// Upload reads the file of the multipart form field, refusing files over
+// p.MaxSize
+func Upload(c *fiber.Ctx, field string, p Policy) ([]byte, error) {
+	fh, err := c.FormFile(field)
+	if err != nil {
+		return nil, problem.BadRequest(problem.CodeBadRequest, fmt.Sprintf("No file uploaded in %q", field))
+	}
+	if fh.Size > p.MaxSize {
+		return nil, Problem(fmt.Errorf("%w: the limit is %d bytes", ErrTooLarge, p.MaxSize))
+	}
+	r, err := fh.Open()
+	if err != nil {
+		return nil, problem.BadRequest(problem.CodeBadRequest, "Unreadable upload")
+	}
+	defer r.Close()
+	data, err := ReadAll(r, p.MaxSize)
+	if err != nil {
+		return nil, Problem(err)
+	}
+	return data, nil
+}
+
+// Problem maps errors of this package onto problems
+func Problem(err error) error {
+	switch {
+	case errors.Is(err, ErrTooLarge):
+		return problem.New(fiber.StatusRequestEntityTooLarge, problem.CodePayloadTooLarge, err.Error())
+	case errors.Is(err, ErrUnsupportedType):
+		return problem.New(fiber.StatusUnsupportedMediaType, problem.CodeUnsupportedMedia, err.Error())
+	case errors.Is(err, ErrInfected):
+		return problem.Unprocessable(problem.CodeFileInfected, "The file was refused by the virus scanner")
+	case errors.Is(err, ErrNotFound):
+		return problem.NotFound("File not found")
+	case errors.Is(err, ErrExpired):
+		return problem.Forbidden(problem.CodeLinkExpired, "The download link has expired")
+	case errors.Is(err, ErrBadSignature):
+		return problem.Forbidden(problem.CodeForbidden, "The download link is invalid")
+	}
+	return problem.Internal("File storage failed", err)
+}
+
+// Serve serves the files of URLs signed by signer, mounted at the signer's
+// base with a trailing wildcard, e.g. /api/v1/files/*
+func Serve(store Store, signer *Signer) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		key := c.Params("*")
+		if err := signer.Verify(key, c.Query("expires"), c.Query("signature")); err != nil {
+			return Problem(err)
+		}
+		return send(c, store, key, "private, max-age=300")
+	}
+}
+
+// ServePublic serves the files under PublicPrefix without a signature,
+// mounted with a trailing wildcard, e.g. /uploads/*. Logos uploaded before
+// there was a store, named school-logo-<n>.<ext> at the root of the upload
+// directory, are served too.
+func ServePublic(store Store) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		key := c.Params("*")
+		legacy := strings.HasPrefix(key, "school-logo-") && !strings.Contains(key, "/")
+		if !strings.HasPrefix(key, PublicPrefix) && !legacy {
+			return problem.NotFound("File not found")
+		}
+		return send(c, store, key, "public, max-age=86400")
+	}
+}
+
+func send(c *fiber.Ctx, store Store, key, cacheControl string) error {
+	if err := CheckKey(key); err != nil {
+		return problem.NotFound("File not found")
+	}
+	r, err := store.Get(c.Context(), key)
+	if err != nil {
+		return Problem(err)
+	}
+	contentType := ContentType(key)
+	c.Set(fiber.HeaderContentType, contentType)
+	c.Set(fiber.HeaderCacheControl, cacheControl)
+	c.Set(fiber.HeaderXContentTypeOptions, "nosniff")
+	if contentType == TypePDF || !strings.HasPrefix(contentType, "image/") {
+		c.Set(fiber.HeaderContentDisposition, "attachment")
+	}
+	// The stream is closed once sent
+	return c.SendStream(r)
+}
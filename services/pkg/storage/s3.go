@@ -0,0 +1,276 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// S3Config locates a bucket on S3 or an S3-compatible server such as MinIO
+type S3Config struct {
+	Endpoint  string // host[:port], without scheme
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	UseSSL    bool
+}
+
+// S3Store keeps files in an S3 bucket, addressed path-style so that MinIO
+// and other S3-compatible servers work without DNS per bucket. Requests are
+// signed with AWS Signature Version 4.
+type S3Store struct {
+	cfg    S3Config
+	scheme string
+	client *http.Client
+	now    func() time.Time
+}
+
+// NewS3Store creates a store of the bucket. It does not connect; the first
+// request reports a missing bucket or wrong credentials.
+func NewS3Store(cfg S3Config) (*S3Store, error) {
+	if cfg.Endpoint == "" || cfg.Bucket == "" {
+		return nil, fmt.Errorf("invalid S3 configuration: endpoint and bucket are required")
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	scheme := "http"
+	if cfg.UseSSL {
+		scheme = "https"
+	}
+	return &S3Store{cfg: cfg, scheme: scheme, client: &http.Client{Timeout: 5 * time.Minute}, now: time.Now}, nil
+}
+
+// unsignedPayload stands in for the body hash; bodies are not hashed
+const unsignedPayload = "UNSIGNED-PAYLOAD"
+
+func (s *S3Store) objectPath(key string) string {
+	return "/" + s.cfg.Bucket + "/" + key
+}
+
+// do signs and sends a request for path with query
+func (s *S3Store) do(ctx context.Context, method, path string, query url.Values, body io.Reader, size int64, header http.Header) (*http.Response, error) {
+	u := url.URL{Scheme: s.scheme, Host: s.cfg.Endpoint, Path: path, RawPath: escapePath(path), RawQuery: canonicalQuery(query)}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+
+	now := s.now().UTC()
+	req.Header.Set("X-Amz-Date", now.Format(amzDateFormat))
+	req.Header.Set("X-Amz-Content-Sha256", unsignedPayload)
+	signed := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	headers := "host:" + s.cfg.Endpoint + "\n" +
+		"x-amz-content-sha256:" + unsignedPayload + "\n" +
+		"x-amz-date:" + now.Format(amzDateFormat) + "\n"
+	canonical := strings.Join([]string{method, escapePath(path), canonicalQuery(query), headers, strings.Join(signed, ";"), unsignedPayload}, "\n")
+	scope, signature := s.signature(now, canonical)
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.cfg.AccessKey, scope, strings.Join(signed, ";"), signature))
+	return s.client.Do(req)
+}
+
+const amzDateFormat = "20060102T150405Z"
+
+// signature returns the credential scope and the signature of a canonical
+// request made at now
+func (s *S3Store) signature(now time.Time, canonical string) (string, string) {
+	day := now.Format("20060102")
+	scope := day + "/" + s.cfg.Region + "/s3/aws4_request"
+	sum := sha256.Sum256([]byte(canonical))
+	toSign := "AWS4-HMAC-SHA256\n" + now.Format(amzDateFormat) + "\n" + scope + "\n" + hex.EncodeToString(sum[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.cfg.SecretKey), day)
+	key = hmacSHA256(key, s.cfg.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	return scope, hex.EncodeToString(hmacSHA256(key, toSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// escape percent-encodes everything but unreserved characters, and slashes
+// when keepSlash is set, as Signature Version 4 requires
+func escape(s string, keepSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/' && keepSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func escapePath(path string) string {
+	return escape(path, true)
+}
+
+// canonicalQuery encodes query sorted by key
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		for _, v := range query[k] {
+			parts = append(parts, escape(k, false)+"="+escape(v, false))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// s3Error reads the error response of a request
+func s3Error(resp *http.Response) error {
+	var e struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if xml.Unmarshal(data, &e) == nil && e.Code != "" {
+		return fmt.Errorf("s3: %s: %s", e.Code, e.Message)
+	}
+	return fmt.Errorf("s3: %s", resp.Status)
+}
+
+func (s *S3Store) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	if err := CheckKey(key); err != nil {
+		return err
+	}
+	resp, err := s.do(ctx, http.MethodPut, s.objectPath(key), nil, r, size, http.Header{"Content-Type": {contentType}})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return s3Error(resp)
+	}
+	return nil
+}
+
+func (s *S3Store) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	if err := CheckKey(key); err != nil {
+		return nil, err
+	}
+	resp, err := s.do(ctx, http.MethodGet, s.objectPath(key), nil, nil, 0, nil)
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp.Body, nil
+	case http.StatusNotFound:
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, key)
+	}
+	defer resp.Body.Close()
+	return nil, s3Error(resp)
+}
+
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	if err := CheckKey(key); err != nil {
+		return err
+	}
+	resp, err := s.do(ctx, http.MethodDelete, s.objectPath(key), nil, nil, 0, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return s3Error(resp)
+	}
+	return nil
+}
+
+// List lists the objects under prefix with ListObjectsV2
+func (s *S3Store) List(ctx context.Context, prefix string) ([]Object, error) {
+	var objects []Object
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		resp, err := s.do(ctx, http.MethodGet, "/"+s.cfg.Bucket, query, nil, 0, nil)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			err := s3Error(resp)
+			resp.Body.Close()
+			return nil, err
+		}
+		var page struct {
+			Contents []struct {
+				Key  string `xml:"Key"`
+				Size int64  `xml:"Size"`
+			} `xml:"Contents"`
+			IsTruncated           bool   `xml:"IsTruncated"`
+			NextContinuationToken string `xml:"NextContinuationToken"`
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range page.Contents {
+			objects = append(objects, Object{Key: c.Key, Size: c.Size})
+		}
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			return objects, nil
+		}
+		token = page.NextContinuationToken
+	}
+}
+
+// PresignGet returns a URL that downloads the file for ttl, at most 7 days,
+// straight from the bucket
+func (s *S3Store) PresignGet(key string, ttl time.Duration) (string, error) {
+	if err := CheckKey(key); err != nil {
+		return "", err
+	}
+	return s.presign(http.MethodGet, s.cfg.Endpoint, s.objectPath(key), ttl, s.now().UTC()), nil
+}
+
+// presign returns the query-signed URL of a request for path on host
+func (s *S3Store) presign(method, host, path string, ttl time.Duration, now time.Time) string {
+	day := now.Format("20060102")
+	query := url.Values{
+		"X-Amz-Algorithm":     {"AWS4-HMAC-SHA256"},
+		"X-Amz-Credential":    {s.cfg.AccessKey + "/" + day + "/" + s.cfg.Region + "/s3/aws4_request"},
+		"X-Amz-Date":          {now.Format(amzDateFormat)},
+		"X-Amz-Expires":       {strconv.FormatInt(int64(ttl/time.Second), 10)},
+		"X-Amz-SignedHeaders": {"host"},
+	}
+	canonical := strings.Join([]string{method, escapePath(path), canonicalQuery(query), "host:" + host + "\n", "host", unsignedPayload}, "\n")
+	_, signature := s.signature(now, canonical)
+	query.Set("X-Amz-Signature", signature)
+	return s.scheme + "://" + host + escapePath(path) + "?" + canonicalQuery(query)
+}
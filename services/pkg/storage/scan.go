@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// ErrInfected is returned for uploads a scanner found malware in
+var ErrInfected = errors.New("file is infected")
+
+// Scanner checks uploads for malware before they are stored. It returns an
+// error wrapping ErrInfected for infected files.
+type Scanner interface {
+	Scan(ctx context.Context, data []byte) error
+}
+
+// ClamdScanner scans with a clamd daemon over TCP, streaming the file with
+// the INSTREAM command
+type ClamdScanner struct {
+	Addr    string // host:port
+	Timeout time.Duration
+}
+
+// clamdChunk is the size of the chunks streamed to clamd
+const clamdChunk = 64 << 10
+
+func (s *ClamdScanner) Scan(ctx context.Context, data []byte) error {
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", s.Addr)
+	if err != nil {
+		return fmt.Errorf("clamd: %w", err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	w := bufio.NewWriter(conn)
+	w.WriteString("zINSTREAM\x00")
+	var size [4]byte
+	for len(data) > 0 {
+		n := min(len(data), clamdChunk)
+		binary.BigEndian.PutUint32(size[:], uint32(n))
+		w.Write(size[:])
+		w.Write(data[:n])
+		data = data[n:]
+	}
+	w.Write([]byte{0, 0, 0, 0})
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("clamd: %w", err)
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil {
+		return fmt.Errorf("clamd: %w", err)
+	}
+	reply = strings.TrimSpace(strings.TrimSuffix(reply, "\x00"))
+	switch {
+	case strings.HasSuffix(reply, " OK"):
+		return nil
+	case strings.HasSuffix(reply, " FOUND"):
+		name := strings.TrimSuffix(strings.TrimPrefix(reply, "stream: "), " FOUND")
+		return fmt.Errorf("%w: %s", ErrInfected, name)
+	}
+	return fmt.Errorf("clamd: %s", reply)
+}
@@ -0,0 +1,135 @@
+// Package storage keeps uploaded files, such as school logos, student
+// documents and fee receipts, on local disk or in an S3-compatible bucket.
+// Files checks, re-encodes and scans uploads before storing them under the
+// prefix of their school, and hands out time-limited signed URLs to them.
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned by Store.Get for missing files
+var ErrNotFound = errors.New("file not found")
+
+// Store holds files by key, a slash-separated relative path
+type Store interface {
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete succeeds for missing files
+	Delete(ctx context.Context, key string) error
+	// List returns the files under prefix
+	List(ctx context.Context, prefix string) ([]Object, error)
+}
+
+// Object is a stored file
+type Object struct {
+	Key  string
+	Size int64
+}
+
+// Size returns the total size of the files under prefix
+func Size(ctx context.Context, s Store, prefix string) (int64, error) {
+	objects, err := s.List(ctx, prefix)
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	for _, o := range objects {
+		total += o.Size
+	}
+	return total, nil
+}
+
+// Presigner is implemented by stores that sign download URLs themselves;
+// Files hands out their URLs instead of ones served by the service
+type Presigner interface {
+	PresignGet(key string, ttl time.Duration) (string, error)
+}
+
+// CheckKey returns an error unless key is a relative path without empty,
+// "." or ".." segments
+func CheckKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return fmt.Errorf("invalid file key %q", key)
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return fmt.Errorf("invalid file key %q", key)
+		}
+	}
+	return nil
+}
+
+// Kinds of stores of Config
+const (
+	KindLocal = "local"
+	KindS3    = "s3"
+)
+
+// Config selects and locates a store, and configures Files of it
+type Config struct {
+	Kind string // KindLocal or KindS3
+	Dir  string // root of KindLocal
+	S3   S3Config
+
+	// URLSecret signs download URLs of local files; every service shares it
+	URLSecret string
+	// URLTTL is how long download URLs last
+	URLTTL time.Duration
+	// ClamdAddr, if set, is the clamd daemon uploads are scanned with
+	ClamdAddr string
+}
+
+// FilesPath is where the school service serves files by signed URL
+const FilesPath = "/api/v1/files"
+
+// Open opens the store cfg describes
+func Open(cfg Config) (Store, error) {
+	switch cfg.Kind {
+	case KindLocal:
+		return NewLocalStore(cfg.Dir), nil
+	case KindS3:
+		return NewS3Store(cfg.S3)
+	}
+	return nil, fmt.Errorf("unknown storage %q, want %s or %s", cfg.Kind, KindLocal, KindS3)
+}
+
+// OpenFiles opens the store cfg describes and returns Files of it
+func OpenFiles(cfg Config) (*Files, error) {
+	store, err := Open(cfg)
+	if err != nil {
+		return nil, err
+	}
+	var scanner Scanner
+	if cfg.ClamdAddr != "" {
+		scanner = &ClamdScanner{Addr: cfg.ClamdAddr}
+	}
+	return NewFiles(store, NewSigner(cfg.URLSecret, FilesPath), scanner, cfg.URLTTL), nil
+}
+
+// PublicPrefix holds files anyone may download without a signed URL, such
+// as the logos uploaded before their school exists
+const PublicPrefix = "public/"
+
+// SchoolPrefix returns the prefix of the school's files. Files of a school
+// are metered against its plan's storage quota.
+func SchoolPrefix(schoolID string) string {
+	return "schools/" + schoolID + "/"
+}
+
+// NewKey returns a fresh key under prefix for a file of category, such as
+// "documents", with extension ext
+func NewKey(prefix, category, ext string) string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	return prefix + category + "/" + hex.EncodeToString(b[:]) + ext
+}
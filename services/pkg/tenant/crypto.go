@@ -0,0 +1,237 @@
+package tenant
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// LegacyKeyID names a key given without an ID. It decrypts values written
+// before key IDs were embedded, which carry no prefix.
+const LegacyKeyID = "legacy"
+
+// ciphertextVersion prefixes ciphertexts that name their key:
+// "v1:<key id>:<base64 nonce+sealed>"
+const ciphertextVersion = "v1"
+
+// MinPassphraseLength is the shortest passphrase a strict keyring accepts
+const MinPassphraseLength = 20
+
+var keyIDPattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,32}$`)
+
+// ErrUnknownKey is returned when a ciphertext names a key not in the keyring
+var ErrUnknownKey = errors.New("ciphertext was encrypted with a key that is not in the keyring")
+
+// Keyring encrypts with its primary key and decrypts with any of its keys,
+// found by the key ID embedded in each ciphertext. Keys are AES-256-GCM.
+type Keyring struct {
+	primary string
+	keys    map[string]*keyringKey
+	order   []string
+}
+
+type keyringKey struct {
+	aead cipher.AEAD
+	// weak is why the key may not be used in production, or ""
+	weak string
+}
+
+// ParseKeyring reads a comma-separated list of keys; the first one is the
+// primary. Each entry is "<id>:<material>", where material is one of
+//
+//	base64:<32 bytes in standard base64>
+//	hex:<32 bytes in hex>
+//	passphrase:<text>   stretched with scrypt, salted with the key ID
+//	<text>              same as passphrase:
+//
+// An entry without an ID is the pre-keyring key: it gets LegacyKeyID and,
+// for compatibility, is zero-padded or truncated to 32 bytes.
+func ParseKeyring(spec string) (*Keyring, error) {
+	k := &Keyring{keys: map[string]*keyringKey{}}
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		id, material, ok := strings.Cut(entry, ":")
+		var key []byte
+		var weak string
+		if !ok || !keyIDPattern.MatchString(id) {
+			id, key, weak = LegacyKeyID, legacyKey(entry), "a key without an ID is zero-padded or truncated"
+		} else {
+			var err error
+			if key, weak, err = deriveKey(id, material); err != nil {
+				return nil, fmt.Errorf("key %q: %w", id, err)
+			}
+		}
+		if _, dup := k.keys[id]; dup {
+			return nil, fmt.Errorf("key %q is listed twice", id)
+		}
+
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", id, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", id, err)
+		}
+		k.keys[id] = &keyringKey{aead: aead, weak: weak}
+		k.order = append(k.order, id)
+	}
+	if len(k.order) == 0 {
+		return nil, errors.New("no encryption key configured")
+	}
+	k.primary = k.order[0]
+	return k, nil
+}
+
+// LoadKeyring parses spec and, when strict, refuses a weak or padded
+// primary key. Services run strict in production.
+func LoadKeyring(spec string, strict bool) (*Keyring, error) {
+	k, err := ParseKeyring(spec)
+	if err != nil {
+		return nil, err
+	}
+	if strict {
+		if weak := k.keys[k.primary].weak; weak != "" {
+			return nil, fmt.Errorf("primary key %q is not allowed in production: %s", k.primary, weak)
+		}
+	}
+	return k, nil
+}
+
+func deriveKey(id, material string) (key []byte, weak string, err error) {
+	switch {
+	case strings.HasPrefix(material, "base64:"):
+		key, err = base64.StdEncoding.DecodeString(strings.TrimPrefix(material, "base64:"))
+	case strings.HasPrefix(material, "hex:"):
+		key, err = hex.DecodeString(strings.TrimPrefix(material, "hex:"))
+	default:
+		passphrase := strings.TrimPrefix(material, "passphrase:")
+		if passphrase == "" {
+			return nil, "", errors.New("empty passphrase")
+		}
+		if len(passphrase) < MinPassphraseLength {
+			weak = fmt.Sprintf("passphrase is shorter than %d characters", MinPassphraseLength)
+		}
+		key, err = scrypt.Key([]byte(passphrase), []byte("school-erp/keyring/"+id), 1<<15, 8, 1, 32)
+		return key, weak, err
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid key encoding: %w", err)
+	}
+	if len(key) != 32 {
+		return nil, "", fmt.Errorf("raw key is %d bytes, want 32", len(key))
+	}
+	if strings.Count(string(key), string(key[:1])) == len(key) {
+		weak = "raw key repeats a single byte"
+	}
+	return key, weak, nil
+}
+
+// legacyKey is how keys were derived before the keyring
+func legacyKey(s string) []byte {
+	key := make([]byte, 32)
+	copy(key, s)
+	return key
+}
+
+// Primary returns the ID of the key new values are encrypted with
+func (k *Keyring) Primary() string {
+	return k.primary
+}
+
+// KeyIDs lists the keyring's key IDs, primary first
+func (k *Keyring) KeyIDs() []string {
+	return append([]string(nil), k.order...)
+}
+
+// AEAD returns the cipher of key id, for callers that encrypt more than fits
+// a string, such as backup archives. Pass Primary() to encrypt.
+func (k *Keyring) AEAD(id string) (cipher.AEAD, error) {
+	key, ok := k.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKey, id)
+	}
+	return key.aead, nil
+}
+
+// KeyID returns the ID of the key a ciphertext was encrypted with
+func KeyID(ciphertext string) string {
+	if version, rest, ok := strings.Cut(ciphertext, ":"); ok && version == ciphertextVersion {
+		id, _, _ := strings.Cut(rest, ":")
+		return id
+	}
+	return LegacyKeyID
+}
+
+// Encrypt encrypts plaintext with the primary key
+func (k *Keyring) Encrypt(plaintext string) (string, error) {
+	aead := k.keys[k.primary].aead
+
+	// Create nonce
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	// The key ID is authenticated, so a ciphertext cannot be moved to another key
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), []byte(k.primary))
+	return ciphertextVersion + ":" + k.primary + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt decrypts a ciphertext with the key it names
+func (k *Keyring) Decrypt(ciphertext string) (string, error) {
+	id := KeyID(ciphertext)
+	key, ok := k.keys[id]
+	if !ok {
+		return "", fmt.Errorf("%w: %q", ErrUnknownKey, id)
+	}
+
+	encoded, additional := ciphertext, []byte(id)
+	if id == LegacyKeyID && !strings.HasPrefix(ciphertext, ciphertextVersion+":") {
+		// Written before the keyring: no prefix and no additional data
+		additional = nil
+	} else {
+		encoded = strings.TrimPrefix(ciphertext, ciphertextVersion+":"+id+":")
+	}
+
+	// Decode from base64
+	ct, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode base64: %w", err)
+	}
+
+	// Extract nonce
+	nonceSize := key.aead.NonceSize()
+	if len(ct) < nonceSize {
+		return "", fmt.Errorf("ciphertext too short")
+	}
+
+	nonce, ct := ct[:nonceSize], ct[nonceSize:]
+
+	// Decrypt
+	plaintext, err := key.aead.Open(nil, nonce, ct, additional)
+	if err != nil {
+		return "", fmt.Errorf("decryption failed: %w", err)
+	}
+
+	return string(plaintext), nil
+}
+
+// NeedsRotation reports whether a ciphertext is not encrypted with the
+// primary key
+func (k *Keyring) NeedsRotation(ciphertext string) bool {
+	return KeyID(ciphertext) != k.primary || !strings.HasPrefix(ciphertext, ciphertextVersion+":")
+}
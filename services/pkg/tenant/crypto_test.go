@@ -0,0 +1,134 @@
+package tenant
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+const (
+	testKeyA = "a:base64:MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="
+	testKeyB = "b:hex:000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"
+)
+
+func testKeyring(t *testing.T) *Keyring {
+	t.Helper()
+	k, err := ParseKeyring(testKeyA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+// legacyEncrypt encrypts the way the pre-keyring Cipher did
+func legacyEncrypt(t *testing.T, key, plaintext string) string {
+	block, _ := aes.NewCipher(legacyKey(key))
+	gcm, _ := cipher.NewGCM(block)
+	nonce := make([]byte, gcm.NonceSize())
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, []byte(plaintext), nil))
+}
+
+func TestKeyringRotation(t *testing.T) {
+	old, err := ParseKeyring(testKeyA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ct, err := old.Encrypt("s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(ct, "v1:a:") || KeyID(ct) != "a" {
+		t.Fatalf("ciphertext %q does not name key a", ct)
+	}
+
+	// b is primary now; a still decrypts
+	rotated, err := ParseKeyring(testKeyB + "," + testKeyA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := rotated.Decrypt(ct); err != nil || got != "s3cret" {
+		t.Fatalf("Decrypt = %q, %v", got, err)
+	}
+	if !rotated.NeedsRotation(ct) {
+		t.Error("ciphertext under a does not need rotation")
+	}
+	ct2, _ := rotated.Encrypt("s3cret")
+	if KeyID(ct2) != "b" || rotated.NeedsRotation(ct2) {
+		t.Errorf("new ciphertext %q is not under b", ct2)
+	}
+
+	// Once a is removed its ciphertexts are unreadable
+	newOnly, _ := ParseKeyring(testKeyB)
+	if _, err := newOnly.Decrypt(ct); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Decrypt with a removed key = %v, want ErrUnknownKey", err)
+	}
+
+	// The key ID is authenticated: relabelling a ciphertext fails
+	forged := "v1:b:" + strings.TrimPrefix(ct, "v1:a:")
+	if _, err := rotated.Decrypt(forged); err == nil {
+		t.Error("relabelled ciphertext decrypted")
+	}
+}
+
+func TestKeyringLegacy(t *testing.T) {
+	const legacy = "default-key-change-in-production"
+	old := legacyEncrypt(t, legacy, "s3cret")
+
+	k, err := ParseKeyring(testKeyA + "," + legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if KeyID(old) != LegacyKeyID || !k.NeedsRotation(old) {
+		t.Errorf("unprefixed ciphertext has key %q", KeyID(old))
+	}
+	if got, err := k.Decrypt(old); err != nil || got != "s3cret" {
+		t.Errorf("Decrypt legacy = %q, %v", got, err)
+	}
+
+	// A legacy-only keyring keeps working outside production
+	only, err := LoadKeyring(legacy, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := only.Decrypt(old); err != nil || got != "s3cret" {
+		t.Errorf("Decrypt legacy = %q, %v", got, err)
+	}
+	ct, _ := only.Encrypt("again")
+	if got, err := only.Decrypt(ct); err != nil || got != "again" || KeyID(ct) != LegacyKeyID {
+		t.Errorf("legacy round trip = %q, %v (%s)", got, err, ct)
+	}
+}
+
+func TestLoadKeyringStrict(t *testing.T) {
+	cases := []struct {
+		spec string
+		ok   bool
+	}{
+		{testKeyA, true},
+		{"p:passphrase:correct horse battery staple", true},
+		{"p:correct horse battery staple", true},
+		{testKeyA + ",default-key-change-in-production", true}, // legacy key may stay for decryption
+		{"default-key-change-in-production", false},
+		{"p:passphrase:short", false},
+		{"z:hex:" + strings.Repeat("00", 32), false},
+	}
+	for _, tc := range cases {
+		_, err := LoadKeyring(tc.spec, true)
+		if (err == nil) != tc.ok {
+			t.Errorf("LoadKeyring(%q, strict) = %v, want ok %v", tc.spec, err, tc.ok)
+		}
+		if _, err := LoadKeyring(tc.spec, false); err != nil {
+			t.Errorf("LoadKeyring(%q) = %v", tc.spec, err)
+		}
+	}
+
+	invalid := []string{"", " , ", "a:base64:c2hvcnQ=", "a:hex:zz", "a:passphrase:", testKeyA + "," + testKeyA}
+	for _, spec := range invalid {
+		if _, err := ParseKeyring(spec); err == nil {
+			t.Errorf("ParseKeyring(%q) = nil, want error", spec)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package tenant
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrInvalidCode is returned by ValidateCode
+var ErrInvalidCode = errors.New("school code must be 2-20 lowercase letters, digits or hyphens, starting and ending with a letter or digit")
+
+// A school code is a DNS label, since schools are also resolved by subdomain
+var codePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,18}[a-z0-9]$`)
+
+// ValidateCode checks that code can name a school. Database and user names
+// derived from a valid code need no quoting, but all DDL quotes them anyway.
+func ValidateCode(code string) error {
+	if !codePattern.MatchString(code) {
+		return ErrInvalidCode
+	}
+	return nil
+}
+
+// DatabaseName returns the name of a dedicated school's database
+func DatabaseName(code string) string {
+	return "school_" + strings.ReplaceAll(code, "-", "_") + "_db"
+}
+
+// UserName returns the default database user of a dedicated school
+func UserName(code string) string {
+	return "school_" + strings.ReplaceAll(code, "-", "_") + "_user"
+}
+
+// GeneratePassword returns a random password for a tenant database user
+func GeneratePassword() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate password: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Admin is the superuser connection used to create and grant tenant
+// databases; tenant connections use the same SSL mode
+type Admin struct {
+	Host     string
+	Port     int
+	User     string
+	Password string
+	SSLMode  string
+}
+
+// DSN returns the connection string of the admin user for database dbName
+func (a Admin) DSN(dbName string) string {
+	return connString(a.Host, a.Port, a.User, a.Password, dbName, a.SSLMode)
+}
+
+// connString builds a postgres URL; every part is escaped
+func connString(host string, port int, user, password, dbName, sslMode string) string {
+	if sslMode == "" {
+		sslMode = "disable"
+	}
+	u := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(user, password),
+		Host:     net.JoinHostPort(host, strconv.Itoa(port)),
+		Path:     "/" + dbName,
+		RawQuery: url.Values{"sslmode": {sslMode}}.Encode(),
+	}
+	return u.String()
+}
+
+// quoteIdent quotes an identifier for DDL, which cannot take parameters
+func quoteIdent(name string) string {
+	return pgx.Identifier{name}.Sanitize()
+}
+
+// quoteLiteral quotes a string literal for DDL, which cannot take
+// parameters. Backslashes are escaped whatever standard_conforming_strings is.
+func quoteLiteral(s string) string {
+	s = strings.ReplaceAll(s, "\x00", "")
+	s = strings.ReplaceAll(s, `'`, `''`)
+	if strings.Contains(s, `\`) {
+		return fmt.Sprintf(`E'%s'`, strings.ReplaceAll(s, `\`, `\\`))
+	}
+	return "'" + s + "'"
+}
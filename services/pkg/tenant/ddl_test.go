@@ -0,0 +1,235 @@
+package tenant
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func TestValidateCode(t *testing.T) {
+	valid := []string{"eis", "kmc", "st-xaviers", "a1", "school-2024", "abcdefghij0123456789"}
+	invalid := []string{
+		"", "a", "-eis", "eis-", "EIS", "e_is", "e is", "e.is", "école",
+		"abcdefghij01234567890",
+		`eis"; DROP DATABASE school_erp; --`,
+		"eis'--", "eis$$", `eis\`, "eis\x00",
+	}
+	for _, code := range valid {
+		if err := ValidateCode(code); err != nil {
+			t.Errorf("ValidateCode(%q) = %v, want nil", code, err)
+		}
+	}
+	for _, code := range invalid {
+		if err := ValidateCode(code); err == nil {
+			t.Errorf("ValidateCode(%q) = nil, want error", code)
+		}
+	}
+	if got := DatabaseName("st-xaviers"); got != "school_st_xaviers_db" {
+		t.Errorf("DatabaseName = %q", got)
+	}
+}
+
+func TestQuoting(t *testing.T) {
+	literals := map[string]string{
+		"secret":   `'secret'`,
+		"o'brien":  `'o''brien'`,
+		`back\sla`: `E'back\\sla'`,
+		`\'; --`:   `E'\\''; --'`,
+		"nul\x00":  `'nul'`,
+	}
+	for in, want := range literals {
+		if got := quoteLiteral(in); got != want {
+			t.Errorf("quoteLiteral(%q) = %s, want %s", in, got, want)
+		}
+	}
+	if got := quoteIdent(`a"b`); got != `"a""b"` {
+		t.Errorf("quoteIdent = %s", got)
+	}
+
+	dsn := connString("db.internal", 6432, "u@x", "p:@/?#", "school db", "require")
+	u, err := url.Parse(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pw, _ := u.User.Password()
+	if u.User.Username() != "u@x" || pw != "p:@/?#" || u.Host != "db.internal:6432" ||
+		u.Path != "/school db" || u.Query().Get("sslmode") != "require" {
+		t.Errorf("connString = %s", dsn)
+	}
+}
+
+// testAdmin connects to the superuser DSN in TENANT_TEST_DATABASE_URL
+// (postgres://...) or skips the test
+func testAdmin(t *testing.T) (*pgxpool.Pool, Admin) {
+	t.Helper()
+	dsn := os.Getenv("TENANT_TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TENANT_TEST_DATABASE_URL not set")
+	}
+
+	poolConfig, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	admin := Admin{
+		Host:     poolConfig.ConnConfig.Host,
+		Port:     int(poolConfig.ConnConfig.Port),
+		User:     poolConfig.ConnConfig.User,
+		Password: poolConfig.ConnConfig.Password,
+		SSLMode:  u.Query().Get("sslmode"),
+	}
+	mainDB, err := pgxpool.NewWithConfig(context.Background(), poolConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(mainDB.Close)
+	return mainDB, admin
+}
+
+// TestHostileTenantDDL provisions and drops tenants whose database, user and
+// password are built to break out of naive string formatting. It needs a
+// superuser DSN, see testAdmin.
+func TestHostileTenantDDL(t *testing.T) {
+	ctx := context.Background()
+	mainDB, admin := testAdmin(t)
+	tm := NewTenantManager(testKeyring(t), PoolLimits{MaxConns: 2, MaxConnLifetime: time.Minute}, admin)
+	defer tm.CloseAllConnections()
+
+	// Every injection below targets the canary
+	if _, err := mainDB.Exec(ctx, `CREATE TABLE IF NOT EXISTS ddl_canary (id INT)`); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { mainDB.Exec(context.Background(), `DROP TABLE IF EXISTS ddl_canary`) })
+
+	cases := []struct {
+		name, db, user, password string
+	}{
+		{"quotes", `ddltest_q'"; DROP TABLE ddl_canary; --`, `ddltest_q'"; DROP TABLE ddl_canary; --`, `'; DROP TABLE ddl_canary; --`},
+		{"dollar quoting", `ddltest_$$_db`, `ddltest_$$`, `$$; DROP TABLE ddl_canary; $$`},
+		{"backslashes", `ddltest_\_db`, `ddltest_\`, `pa\'ss\\`},
+		{"spaces and unicode", `ddltest ñ 学校`, `ddltest user`, `pässwörd with space@/:?#`},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			code := "ddltest"
+			t.Cleanup(func() {
+				tm.DropTenantDatabase(context.Background(), mainDB, code, tc.db)
+				tm.DropTenantUser(context.Background(), mainDB, tc.user)
+			})
+
+			// Twice: provisioning resumes after partial failures
+			for i := 0; i < 2; i++ {
+				if err := tm.CreateTenantDatabase(ctx, mainDB, code, tc.db, tc.user, tc.password); err != nil {
+					t.Fatalf("CreateTenantDatabase #%d: %v", i+1, err)
+				}
+			}
+
+			encrypted, err := tm.EncryptPassword(tc.password)
+			if err != nil {
+				t.Fatal(err)
+			}
+			db, err := tm.GetConnection(ctx, code, admin.Host, admin.Port, tc.db, tc.user, encrypted)
+			if err != nil {
+				t.Fatalf("GetConnection: %v", err)
+			}
+			var user, database string
+			if err := db.QueryRow(ctx, `SELECT current_user, current_database()`).Scan(&user, &database); err != nil {
+				t.Fatal(err)
+			}
+			if user != tc.user || database != tc.db {
+				t.Errorf("connected as %q to %q, want %q to %q", user, database, tc.user, tc.db)
+			}
+			if _, err := db.Exec(ctx, `CREATE TABLE probe (id INT)`); err != nil {
+				t.Errorf("tenant user cannot create tables: %v", err)
+			}
+
+			if err := tm.DropTenantDatabase(ctx, mainDB, code, tc.db); err != nil {
+				t.Fatalf("DropTenantDatabase: %v", err)
+			}
+			if err := tm.DropTenantUser(ctx, mainDB, tc.user); err != nil {
+				t.Fatalf("DropTenantUser: %v", err)
+			}
+			var dbExists, userExists bool
+			mainDB.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM pg_database WHERE datname = $1),
+				EXISTS (SELECT 1 FROM pg_roles WHERE rolname = $2)`, tc.db, tc.user).Scan(&dbExists, &userExists)
+			if dbExists || userExists {
+				t.Errorf("after drop: database exists %v, user exists %v", dbExists, userExists)
+			}
+		})
+	}
+
+	var canary bool
+	if err := mainDB.QueryRow(ctx, `SELECT to_regclass('ddl_canary') IS NOT NULL`).Scan(&canary); err != nil || !canary {
+		t.Errorf("ddl_canary was dropped (%v)", err)
+	}
+}
+
+// TestSetTenantPassword rotates a tenant's password while a request holds a
+// connection of the cached pool
+func TestSetTenantPassword(t *testing.T) {
+	ctx := context.Background()
+	mainDB, admin := testAdmin(t)
+	tm := NewTenantManager(testKeyring(t), PoolLimits{MaxConns: 2, MaxConnLifetime: time.Minute}, admin)
+	defer tm.CloseAllConnections()
+
+	const code, dbName, dbUser = "rotatetest", "rotatetest_db", "rotatetest_user"
+	t.Cleanup(func() {
+		tm.DropTenantDatabase(context.Background(), mainDB, code, dbName)
+		tm.DropTenantUser(context.Background(), mainDB, dbUser)
+	})
+	if err := tm.CreateTenantDatabase(ctx, mainDB, code, dbName, dbUser, "first-password"); err != nil {
+		t.Fatal(err)
+	}
+
+	first, _ := tm.EncryptPassword("first-password")
+	oldPool, err := tm.GetConnection(ctx, code, admin.Host, admin.Port, dbName, dbUser, first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inFlight, err := oldPool.Acquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inFlight.Release()
+
+	password, err := GeneratePassword()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx, err := mainDB.Begin(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tm.SetTenantPassword(ctx, tx, dbUser, password); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	second, _ := tm.EncryptPassword(password)
+	newPool, err := tm.GetConnection(ctx, code, admin.Host, admin.Port, dbName, dbUser, second)
+	if err != nil {
+		t.Fatalf("GetConnection with the new password: %v", err)
+	}
+	if newPool == oldPool {
+		t.Fatal("pool was not replaced after the password changed")
+	}
+	if again, _ := tm.GetConnection(ctx, code, admin.Host, admin.Port, dbName, dbUser, second); again != newPool {
+		t.Error("replacement pool is not cached")
+	}
+
+	// The replaced pool keeps serving the request that holds it
+	if _, err := inFlight.Exec(ctx, `SELECT 1`); err != nil {
+		t.Errorf("in-flight connection after rotation: %v", err)
+	}
+}
@@ -0,0 +1,64 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ErrNotFound is returned by a Directory for unknown or inactive schools.
+var ErrNotFound = errors.New("school not found or inactive")
+
+// Statuses of schools a Directory returns. Suspended schools are read-only.
+const (
+	StatusActive    = "active"
+	StatusSuspended = "suspended"
+)
+
+// School is the connection record of a tenant in the main database.
+type School struct {
+	ID         string
+	Code       string
+	Tenancy    string // Dedicated or Shared
+	Status     string // StatusActive or StatusSuspended
+	SharedID   int64  // school_id of the school's rows in shared tables
+	DBName     string
+	DBHost     string
+	DBPort     int
+	DBUser     string
+	DBPassword string // encrypted with the TenantManager's cipher
+}
+
+// Directory looks up active schools by code.
+type Directory interface {
+	Lookup(ctx context.Context, code string) (*School, error)
+}
+
+// PostgresDirectory reads the schools table of the main database.
+type PostgresDirectory struct {
+	db *pgxpool.Pool
+}
+
+// NewPostgresDirectory creates a directory backed by the main database
+func NewPostgresDirectory(db *pgxpool.Pool) *PostgresDirectory {
+	return &PostgresDirectory{db: db}
+}
+
+// Lookup returns the active or suspended school with the given code or
+// ErrNotFound
+func (d *PostgresDirectory) Lookup(ctx context.Context, code string) (*School, error) {
+	var s School
+	err := d.db.QueryRow(ctx, `
+	SELECT id::text, code, tenancy, status, shared_id, db_name, db_host, db_port, db_user, db_password
+	FROM schools WHERE code = $1 AND status IN ($2, $3)`, code, StatusActive, StatusSuspended,
+	).Scan(&s.ID, &s.Code, &s.Tenancy, &s.Status, &s.SharedID, &s.DBName, &s.DBHost, &s.DBPort, &s.DBUser, &s.DBPassword)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
@@ -0,0 +1,148 @@
+package tenant
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// SubjectSchoolUpdated is the NATS subject of SchoolUpdated events
+const SubjectSchoolUpdated = "SchoolUpdated"
+
+// SchoolUpdated is published by the school service when a school's domain,
+// its verification or the school's status changes
+type SchoolUpdated struct {
+	SchoolID       string    `json:"school_id"`
+	Code           string    `json:"code"`
+	Domain         string    `json:"domain"`
+	DomainVerified bool      `json:"domain_verified"`
+	Status         string    `json:"status"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// DomainMap maps the verified custom domains of active and suspended
+// schools to their codes. It is filled by Refresh and kept current by
+// Apply, for SchoolUpdated events, or by Run.
+type DomainMap struct {
+	db *pgxpool.Pool
+
+	mu      sync.RWMutex
+	codes   map[string]string // domain -> code
+	domains map[string]string // code -> domain
+}
+
+// NewDomainMap creates an empty map backed by the main database
+func NewDomainMap(db *pgxpool.Pool) *DomainMap {
+	return &DomainMap{db: db, codes: make(map[string]string), domains: make(map[string]string)}
+}
+
+// NormalizeHost lowercases hostname and strips its port and trailing dot,
+// so "EIS.edu.np.:443" and "eis.edu.np" are the same domain
+func NormalizeHost(hostname string) string {
+	host := hostname
+	if strings.HasPrefix(host, "[") {
+		return ""
+	}
+	if i := strings.IndexByte(host, ':'); i >= 0 {
+		host = host[:i]
+	}
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
+
+// Code returns the code of the school whose verified domain is hostname, or
+// "". A nil map knows no domains.
+func (m *DomainMap) Code(hostname string) string {
+	if m == nil {
+		return ""
+	}
+	host := NormalizeHost(hostname)
+	if host == "" {
+		return ""
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.codes[host]
+}
+
+// Refresh replaces the map with the verified domains in the main database
+func (m *DomainMap) Refresh(ctx context.Context) error {
+	rows, err := m.db.Query(ctx, `
+	SELECT code, domain FROM schools
+	WHERE domain_verified_at IS NOT NULL AND status IN ($1, $2)`, StatusActive, StatusSuspended)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	codes, domains := make(map[string]string), make(map[string]string)
+	for rows.Next() {
+		var code, domain string
+		if err := rows.Scan(&code, &domain); err != nil {
+			return err
+		}
+		domain = NormalizeHost(domain)
+		codes[domain], domains[code] = code, domain
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	m.codes, m.domains = codes, domains
+	m.mu.Unlock()
+	return nil
+}
+
+// Apply updates the school's entry from an event: its domain is mapped while
+// verified and the school is served, and removed otherwise
+func (m *DomainMap) Apply(e SchoolUpdated) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if old, ok := m.domains[e.Code]; ok {
+		delete(m.codes, old)
+		delete(m.domains, e.Code)
+	}
+	domain := NormalizeHost(e.Domain)
+	if !e.DomainVerified || domain == "" || (e.Status != StatusActive && e.Status != StatusSuspended) {
+		return
+	}
+	// A domain moved from another school is that school's no longer
+	if other, ok := m.codes[domain]; ok {
+		delete(m.domains, other)
+	}
+	m.codes[domain], m.domains[e.Code] = e.Code, domain
+}
+
+// HandleEvent applies a SchoolUpdated message; malformed ones are logged
+func (m *DomainMap) HandleEvent(data []byte) {
+	var e SchoolUpdated
+	if err := json.Unmarshal(data, &e); err != nil {
+		log.Printf("Invalid %s event: %v\n", SubjectSchoolUpdated, err)
+		return
+	}
+	m.Apply(e)
+}
+
+// Run refreshes the map every interval until ctx is done, for processes
+// that do not receive SchoolUpdated events
+func (m *DomainMap) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := m.Refresh(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("Failed to refresh tenant domains: %v\n", err)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+// Package tenant implements the database-per-school model: the main database
+// lists every school and its encrypted credentials, and each request is
+// served from a connection pool to the database of the school it names.
+package tenant
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"golang.org/x/sync/singleflight"
+)
+
+// TenantManager manages tenant database connections and caching
+type TenantManager struct {
+	keys              *Keyring               // Encrypts the tenant passwords in the schools table
+	dbConnections     map[string]*tenantPool // Cache of tenant DB connections
+	dbMutex           sync.RWMutex
+	limits            PoolLimits
+	reserved          int32              // Connections the open pools may hold, see PoolLimits
+	opening           singleflight.Group // One pool is opened per school at a time
+	stats             managerStats
+	connectionTimeout time.Duration
+	admin             Admin // Superuser for creating and granting tenant databases
+	stop              chan struct{}
+	stopOnce          sync.Once
+}
+
+// NewTenantManager creates a new tenant manager and starts checking its
+// pools in the background until CloseAllConnections
+func NewTenantManager(keys *Keyring, limits PoolLimits, admin Admin) *TenantManager {
+	if limits.MaxConns <= 0 {
+		limits.MaxConns = DefaultMaxConns
+	}
+	if limits.MaxTotalConns > 0 && limits.MaxConns > limits.MaxTotalConns {
+		limits.MaxConns = limits.MaxTotalConns
+	}
+	if limits.HealthCheckInterval <= 0 {
+		limits.HealthCheckInterval = DefaultHealthCheckInterval
+	}
+	tm := &TenantManager{
+		keys:              keys,
+		dbConnections:     make(map[string]*tenantPool),
+		limits:            limits,
+		stats:             managerStats{evictions: map[string]uint64{}},
+		connectionTimeout: 5 * time.Second,
+		admin:             admin,
+		stop:              make(chan struct{}),
+	}
+	go tm.maintain()
+	return tm
+}
+
+// CreateTenantDatabase creates a new tenant database and user on the server
+// of mainDB, an admin connection. It may be called again after a partial
+// failure: existing users and databases are kept.
+func (tm *TenantManager) CreateTenantDatabase(ctx context.Context, mainDB *pgxpool.Pool, schoolCode, dbName, dbUser, dbPassword string) error {
+	// DDL takes no parameters: names are quoted with quoteIdent and the
+	// password with quoteLiteral
+
+	// Create user if it doesn't exist
+	var exists bool
+	if err := mainDB.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM pg_catalog.pg_roles WHERE rolname = $1)`, dbUser).Scan(&exists); err != nil {
+		return fmt.Errorf("failed to check user: %w", err)
+	}
+	if !exists {
+		createUserSQL := fmt.Sprintf(`CREATE USER %s WITH PASSWORD %s;`, quoteIdent(dbUser), quoteLiteral(dbPassword))
+
+		if _, err := mainDB.Exec(ctx, createUserSQL); err != nil {
+			return fmt.Errorf("failed to create user: %w", err)
+		}
+	}
+
+	// Create database
+	if err := mainDB.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM pg_database WHERE datname = $1)`, dbName).Scan(&exists); err != nil {
+		return fmt.Errorf("failed to check database: %w", err)
+	}
+	if !exists {
+		createDBSQL := fmt.Sprintf(`CREATE DATABASE %s ENCODING 'UTF8' TEMPLATE template0;`, quoteIdent(dbName))
+
+		if _, err := mainDB.Exec(ctx, createDBSQL); err != nil {
+			return fmt.Errorf("failed to create database: %w", err)
+		}
+	}
+
+	// Grant privileges to user on database
+	grantSQL := fmt.Sprintf(`GRANT ALL PRIVILEGES ON DATABASE %s TO %s;`, quoteIdent(dbName), quoteIdent(dbUser))
+
+	if _, err := mainDB.Exec(ctx, grantSQL); err != nil {
+		return fmt.Errorf("failed to grant database privileges: %w", err)
+	}
+
+	// Connect to the new database as the admin to grant schema permissions
+	admin := tm.admin
+	admin.Host, admin.Port = mainDB.Config().ConnConfig.Host, int(mainDB.Config().ConnConfig.Port)
+	tenantConn, err := pgxpool.New(ctx, admin.DSN(dbName))
+	if err != nil {
+		return fmt.Errorf("failed to connect to tenant database: %w", err)
+	}
+	defer tenantConn.Close()
+
+	// Grant schema permissions
+	schemaSQL := fmt.Sprintf(`
+		GRANT ALL ON SCHEMA public TO %[1]s;
+		GRANT ALL PRIVILEGES ON ALL TABLES IN SCHEMA public TO %[1]s;
+		GRANT ALL PRIVILEGES ON ALL SEQUENCES IN SCHEMA public TO %[1]s;
+		ALTER DEFAULT PRIVILEGES IN SCHEMA public GRANT ALL ON TABLES TO %[1]s;
+		ALTER DEFAULT PRIVILEGES IN SCHEMA public GRANT ALL ON SEQUENCES TO %[1]s;
+	`, quoteIdent(dbUser))
+
+	if _, err := tenantConn.Exec(ctx, schemaSQL); err != nil {
+		return fmt.Errorf("failed to grant schema privileges: %w", err)
+	}
+
+	return nil
+}
+
+// DropTenantDatabase drops a tenant database
+func (tm *TenantManager) DropTenantDatabase(ctx context.Context, mainDB *pgxpool.Pool, schoolCode, dbName string) error {
+	// Close connection if exists
+	tm.CloseConnection(schoolCode)
+
+	// Drop database
+	dropDBSQL := fmt.Sprintf(`DROP DATABASE IF EXISTS %s WITH (FORCE);`, quoteIdent(dbName))
+
+	if _, err := mainDB.Exec(ctx, dropDBSQL); err != nil {
+		return fmt.Errorf("failed to drop database: %w", err)
+	}
+
+	return nil
+}
+
+// DropTenantUser drops the database user of a tenant. Drop the tenant
+// database first; the user cannot be dropped while it owns objects.
+func (tm *TenantManager) DropTenantUser(ctx context.Context, mainDB *pgxpool.Pool, dbUser string) error {
+	dropUserSQL := fmt.Sprintf(`DROP ROLE IF EXISTS %s;`, quoteIdent(dbUser))
+
+	if _, err := mainDB.Exec(ctx, dropUserSQL); err != nil {
+		return fmt.Errorf("failed to drop user: %w", err)
+	}
+
+	return nil
+}
+
+// SetTenantPassword changes the password of a tenant's database user. Run it
+// in a transaction on the server of the tenant's database (see HostAdmin)
+// and commit it with the one that stores the new encrypted password: ALTER
+// ROLE is transactional, so it takes effect at commit.
+func (tm *TenantManager) SetTenantPassword(ctx context.Context, tx pgx.Tx, dbUser, password string) error {
+	alterSQL := fmt.Sprintf(`ALTER ROLE %s WITH PASSWORD %s;`, quoteIdent(dbUser), quoteLiteral(password))
+
+	if _, err := tx.Exec(ctx, alterSQL); err != nil {
+		return fmt.Errorf("failed to change password: %w", err)
+	}
+
+	return nil
+}
+
+// AdminHost returns the host and port of the admin connection, on which new
+// tenant databases are created
+func (tm *TenantManager) AdminHost() (string, int) {
+	return tm.admin.Host, tm.admin.Port
+}
+
+// HostAdmin connects as the admin to the server at host and port, on which
+// a school's database lives; DDL for the school's database and user runs on
+// it. Every server has the admin connection's user and password. Close the
+// pool when done.
+func (tm *TenantManager) HostAdmin(ctx context.Context, host string, port int) (*pgxpool.Pool, error) {
+	admin := tm.admin
+	admin.Host, admin.Port = host, port
+	pool, err := pgxpool.New(ctx, admin.DSN("postgres"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", host, err)
+	}
+	return pool, nil
+}
+
+// EncryptPassword encrypts a password with the keyring's primary key
+func (tm *TenantManager) EncryptPassword(password string) (string, error) {
+	return tm.keys.Encrypt(password)
+}
+
+// DecryptPassword decrypts a password with the key it was encrypted with
+func (tm *TenantManager) DecryptPassword(encryptedPassword string) (string, error) {
+	return tm.keys.Decrypt(encryptedPassword)
+}
@@ -0,0 +1,83 @@
+package tenant
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	poolConnsDesc = prometheus.NewDesc("tenant_pool_connections",
+		"Connections of a school's pool by state.", []string{"tenant", "state"}, nil)
+	poolMaxConnsDesc = prometheus.NewDesc("tenant_pool_max_connections",
+		"Maximum connections of a school's pool.", []string{"tenant"}, nil)
+	poolAcquiresDesc = prometheus.NewDesc("tenant_pool_acquires_total",
+		"Connections acquired from a school's pool.", []string{"tenant"}, nil)
+	poolEmptyAcquiresDesc = prometheus.NewDesc("tenant_pool_empty_acquires_total",
+		"Acquires from a school's pool that waited for a connection.", []string{"tenant"}, nil)
+	poolCanceledAcquiresDesc = prometheus.NewDesc("tenant_pool_canceled_acquires_total",
+		"Acquires from a school's pool canceled while waiting.", []string{"tenant"}, nil)
+	poolAcquireSecondsDesc = prometheus.NewDesc("tenant_pool_acquire_seconds_total",
+		"Time spent acquiring connections from a school's pool.", []string{"tenant"}, nil)
+	poolIdleSecondsDesc = prometheus.NewDesc("tenant_pool_idle_seconds",
+		"Seconds since a school's pool last served a request.", []string{"tenant"}, nil)
+
+	poolsDesc = prometheus.NewDesc("tenant_pools",
+		"Open tenant pools.", nil, nil)
+	reservedConnsDesc = prometheus.NewDesc("tenant_pool_reserved_connections",
+		"Connections reserved by open tenant pools, including draining ones.", nil, nil)
+	budgetConnsDesc = prometheus.NewDesc("tenant_pool_budget_connections",
+		"Connection budget shared by all tenant pools; 0 is unlimited.", nil, nil)
+	poolsOpenedDesc = prometheus.NewDesc("tenant_pool_opened_total",
+		"Tenant pools opened.", nil, nil)
+	budgetRejectionsDesc = prometheus.NewDesc("tenant_pool_budget_rejections_total",
+		"Pools not opened because the connection budget was spent.", nil, nil)
+	evictionsDesc = prometheus.NewDesc("tenant_pool_evictions_total",
+		"Tenant pools closed by reason.", []string{"reason"}, nil)
+)
+
+// Describe implements prometheus.Collector
+func (tm *TenantManager) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{
+		poolConnsDesc, poolMaxConnsDesc, poolAcquiresDesc, poolEmptyAcquiresDesc,
+		poolCanceledAcquiresDesc, poolAcquireSecondsDesc, poolIdleSecondsDesc,
+		poolsDesc, reservedConnsDesc, budgetConnsDesc, poolsOpenedDesc,
+		budgetRejectionsDesc, evictionsDesc,
+	} {
+		ch <- d
+	}
+}
+
+// Collect implements prometheus.Collector. Per-tenant series exist while
+// the school's pool is open.
+func (tm *TenantManager) Collect(ch chan<- prometheus.Metric) {
+	gauge, counter := prometheus.GaugeValue, prometheus.CounterValue
+	now := time.Now()
+
+	tm.dbMutex.RLock()
+	for code, p := range tm.dbConnections {
+		stat := p.pool.Stat()
+		ch <- prometheus.MustNewConstMetric(poolConnsDesc, gauge, float64(stat.IdleConns()), code, "idle")
+		ch <- prometheus.MustNewConstMetric(poolConnsDesc, gauge, float64(stat.AcquiredConns()), code, "acquired")
+		ch <- prometheus.MustNewConstMetric(poolConnsDesc, gauge, float64(stat.ConstructingConns()), code, "constructing")
+		ch <- prometheus.MustNewConstMetric(poolMaxConnsDesc, gauge, float64(stat.MaxConns()), code)
+		ch <- prometheus.MustNewConstMetric(poolAcquiresDesc, counter, float64(stat.AcquireCount()), code)
+		ch <- prometheus.MustNewConstMetric(poolEmptyAcquiresDesc, counter, float64(stat.EmptyAcquireCount()), code)
+		ch <- prometheus.MustNewConstMetric(poolCanceledAcquiresDesc, counter, float64(stat.CanceledAcquireCount()), code)
+		ch <- prometheus.MustNewConstMetric(poolAcquireSecondsDesc, counter, stat.AcquireDuration().Seconds(), code)
+		ch <- prometheus.MustNewConstMetric(poolIdleSecondsDesc, gauge, p.idleFor(now).Seconds(), code)
+	}
+	ch <- prometheus.MustNewConstMetric(poolsDesc, gauge, float64(len(tm.dbConnections)))
+	ch <- prometheus.MustNewConstMetric(reservedConnsDesc, gauge, float64(tm.reserved))
+	tm.dbMutex.RUnlock()
+
+	ch <- prometheus.MustNewConstMetric(budgetConnsDesc, gauge, float64(tm.limits.MaxTotalConns))
+
+	tm.stats.mu.Lock()
+	defer tm.stats.mu.Unlock()
+	ch <- prometheus.MustNewConstMetric(poolsOpenedDesc, counter, float64(tm.stats.opened))
+	ch <- prometheus.MustNewConstMetric(budgetRejectionsDesc, counter, float64(tm.stats.budgetRejections))
+	for _, reason := range []string{EvictIdle, EvictBudget, EvictUnhealthy, EvictReplaced, EvictClosed} {
+		ch <- prometheus.MustNewConstMetric(evictionsDesc, counter, float64(tm.stats.evictions[reason]), reason)
+	}
+}
@@ -0,0 +1,254 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"school-erp/pkg/problem"
+)
+
+// Request sources naming the tenant.
+const (
+	HeaderCode = "X-Tenant-Code"
+	QueryCode  = "tenant_code"
+	ClaimCode  = "tenant_code"
+)
+
+// Keys for the resolved tenant in Locals.
+const (
+	CodeContextKey   = "tenant_code"
+	SchoolContextKey = "tenant_school"
+	DBContextKey     = "tenant_db"
+)
+
+// Querier runs queries for one school. It is a *pgxpool.Pool for dedicated
+// schools and a *pgxpool.Conn scoped by RLS for shared ones.
+type Querier interface {
+	Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
+
+// Config configures the tenant resolver middleware
+type Config struct {
+	Manager   *TenantManager
+	Directory Directory
+
+	// Domains resolves requests to the verified custom domains of schools.
+	// Leave nil to resolve by code only.
+	Domains *DomainMap
+
+	// Shared is the database holding the rows of shared-tenancy schools.
+	// Requests for such schools are rejected when it is nil.
+	Shared *pgxpool.Pool
+
+	// JWTSecret verifies bearer tokens, whose tenant_code claim names the
+	// only school they are valid for. With it set, requests without such a
+	// token are rejected. Leave empty to resolve by the request alone, as
+	// in development.
+	JWTSecret string
+
+	// Skip bypasses resolution for requests that are not tenant-scoped.
+	Skip func(c *fiber.Ctx) bool
+}
+
+// New returns middleware that resolves the tenant of each request, looks it
+// up in the main database and stores a Querier for the school in Locals:
+// the pool of its own database, or for shared-tenancy schools a connection
+// of the shared database held for the request and scoped by RLS.
+// The tenant code is taken from, in order: the school of a verified custom
+// domain in the Host header, the X-Tenant-Code header, the tenant_code query
+// parameter, the subdomain and the token's tenant_code claim (see
+// RequestCode). With a JWTSecret, a token is required and one without the
+// claim, or naming a different school than the request, is rejected;
+// requests that could write to a suspended school are rejected too.
+func New(cfg Config) fiber.Handler {
+	parser := jwt.NewParser(jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+
+	return func(c *fiber.Ctx) error {
+		if cfg.Skip != nil && cfg.Skip(c) {
+			return c.Next()
+		}
+
+		code, err := RequestCode(c, cfg.Domains)
+		if err != nil {
+			return err
+		}
+		if cfg.JWTSecret != "" {
+			claimed, err := tokenCode(c, parser, cfg.JWTSecret)
+			if err != nil {
+				return err
+			}
+			if code != "" && !strings.EqualFold(code, claimed) {
+				return problem.Forbidden(problem.CodeForbidden,
+					fmt.Sprintf("Token is not valid for school %q", code))
+			}
+			code = claimed
+		}
+		if code == "" {
+			return problem.BadRequest(problem.CodeBadRequest,
+				"Tenant code is required. Provide it via header (X-Tenant-Code), query parameter (tenant_code), or subdomain")
+		}
+
+		school, err := cfg.Directory.Lookup(c.Context(), code)
+		if err != nil {
+			if errors.Is(err, ErrNotFound) {
+				return problem.NotFound(fmt.Sprintf("School %q not found or inactive", code))
+			}
+			log.Printf("Failed to look up tenant %s: %v\n", code, err)
+			return problem.New(fiber.StatusServiceUnavailable, problem.CodeUnavailable,
+				"Failed to resolve tenant").Wrap(err)
+		}
+
+		if school.Status == StatusSuspended && !readOnly(c.Method()) {
+			return problem.Forbidden(problem.CodeSchoolSuspended,
+				fmt.Sprintf("School %q is suspended and read-only", school.Code))
+		}
+
+		c.Locals(CodeContextKey, school.Code)
+		c.Locals(SchoolContextKey, school)
+
+		if school.Tenancy == Shared {
+			if cfg.Shared == nil {
+				return problem.New(fiber.StatusServiceUnavailable, problem.CodeUnavailable,
+					fmt.Sprintf("School %q uses the shared database, which this service does not serve", school.Code))
+			}
+			conn, err := acquireShared(c.Context(), cfg.Shared, school)
+			if err != nil {
+				log.Printf("Failed to get shared database connection for tenant %s: %v\n", school.Code, err)
+				return problem.New(fiber.StatusServiceUnavailable, problem.CodeUnavailable,
+					fmt.Sprintf("Failed to connect to tenant database for %q", school.Code)).Wrap(err)
+			}
+			defer releaseShared(conn)
+			c.Locals(DBContextKey, Querier(conn))
+			return c.Next()
+		}
+
+		db, err := cfg.Manager.GetConnection(c.Context(), school.Code,
+			school.DBHost, school.DBPort, school.DBName, school.DBUser, school.DBPassword)
+		if err != nil {
+			log.Printf("Failed to get tenant database connection for tenant %s: %v\n", school.Code, err)
+			return problem.New(fiber.StatusServiceUnavailable, problem.CodeUnavailable,
+				fmt.Sprintf("Failed to connect to tenant database for %q", school.Code)).Wrap(err)
+		}
+
+		c.Locals(DBContextKey, Querier(db))
+		return c.Next()
+	}
+}
+
+// readOnly reports whether requests of method may reach suspended schools
+func readOnly(method string) bool {
+	return method == fiber.MethodGet || method == fiber.MethodHead || method == fiber.MethodOptions
+}
+
+// Code returns the resolved tenant code, or "" outside the middleware.
+func Code(c *fiber.Ctx) string {
+	code, _ := c.Locals(CodeContextKey).(string)
+	return code
+}
+
+// CurrentSchool returns the resolved school, or nil outside the middleware.
+func CurrentSchool(c *fiber.Ctx) *School {
+	school, _ := c.Locals(SchoolContextKey).(*School)
+	return school
+}
+
+// DB returns the resolved school's Querier, or nil outside the middleware.
+// A shared-tenancy Querier is only valid until the handler returns.
+func DB(c *fiber.Ctx) Querier {
+	db, _ := c.Locals(DBContextKey).(Querier)
+	return db
+}
+
+// RequestCode returns the code of the school whose verified custom domain is
+// the request's host, or else ExtractCode's. A header or query parameter
+// naming another school than the domain is rejected.
+func RequestCode(c *fiber.Ctx, domains *DomainMap) (string, error) {
+	code := domains.Code(c.Hostname())
+	if code == "" {
+		return ExtractCode(c), nil
+	}
+	for _, named := range []string{c.Get(HeaderCode), c.Query(QueryCode)} {
+		if named != "" && !strings.EqualFold(named, code) {
+			return "", problem.Forbidden(problem.CodeForbidden,
+				fmt.Sprintf("Domain %q belongs to another school than %q", NormalizeHost(c.Hostname()), named))
+		}
+	}
+	return code, nil
+}
+
+// ExtractCode returns the tenant code named by the request in the following
+// order:
+// 1. X-Tenant-Code header
+// 2. tenant_code query parameter
+// 3. From subdomain (e.g., "eis.school-erp.com" -> "eis")
+func ExtractCode(c *fiber.Ctx) string {
+	if code := c.Get(HeaderCode); code != "" {
+		return code
+	}
+	if code := c.Query(QueryCode); code != "" {
+		return code
+	}
+	return Subdomain(c.Hostname())
+}
+
+// Subdomain returns the first label of a multi-label hostname, except for
+// www and api. "eis.school-erp.com" -> "eis", "localhost:3000" -> "".
+func Subdomain(hostname string) string {
+	host := hostname
+	if i := strings.IndexByte(host, ':'); i >= 0 {
+		host = host[:i]
+	}
+	if host == "" || host[0] == '[' {
+		return ""
+	}
+	subdomain, rest, found := strings.Cut(host, ".")
+	if !found || rest == "" {
+		return ""
+	}
+	if subdomain == "www" || subdomain == "api" {
+		return ""
+	}
+	// IPv4 addresses have no subdomain.
+	if strings.Trim(host, "0123456789.") == "" {
+		return ""
+	}
+	return subdomain
+}
+
+// tenantClaims is the part of an access token naming the school.
+type tenantClaims struct {
+	TenantCode string `json:"tenant_code"`
+	jwt.RegisteredClaims
+}
+
+// tokenCode returns the tenant_code claim of the request's bearer token.
+// Requests without a valid token, or with one naming no school, are
+// rejected: such a token is not valid for any school's data.
+func tokenCode(c *fiber.Ctx, parser *jwt.Parser, secret string) (string, error) {
+	raw, ok := strings.CutPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+	if !ok {
+		return "", problem.Unauthorized(problem.CodeUnauthorized, "Missing authorization header")
+	}
+	claims := &tenantClaims{}
+	if _, err := parser.ParseWithClaims(raw, claims, func(*jwt.Token) (interface{}, error) {
+		return []byte(secret), nil
+	}); err != nil {
+		return "", problem.Unauthorized(problem.CodeInvalidToken, "Invalid or expired token").Wrap(err)
+	}
+	if claims.TenantCode == "" {
+		return "", problem.Forbidden(problem.CodeForbidden, "Token is not valid for any school")
+	}
+	return claims.TenantCode, nil
+}
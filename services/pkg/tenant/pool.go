@@ -0,0 +1,376 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	// DrainTimeout is how long a pool replaced after a credential change keeps
+	// serving the requests that acquired it before it is closed
+	DrainTimeout = 30 * time.Second
+	// DefaultMaxConns is the per-school pool size when PoolLimits.MaxConns is 0
+	DefaultMaxConns = 10
+	// DefaultHealthCheckInterval applies when PoolLimits.HealthCheckInterval is 0
+	DefaultHealthCheckInterval = 30 * time.Second
+
+	// evictGrace keeps a pool that was just handed to a request from being
+	// evicted for the budget before the request acquires a connection
+	evictGrace = 10 * time.Second
+)
+
+// Eviction reasons, the reason label of tenant_pool_evictions_total
+const (
+	EvictIdle      = "idle"
+	EvictBudget    = "budget"
+	EvictUnhealthy = "unhealthy"
+	EvictReplaced  = "replaced"
+	EvictClosed    = "closed"
+)
+
+// ErrPoolBudget is returned by GetConnection when opening a pool would exceed
+// PoolLimits.MaxTotalConns and every open pool is in use
+var ErrPoolBudget = errors.New("tenant connection budget exhausted")
+
+// PoolLimits bounds the pools of a TenantManager. Every pool reserves
+// MaxConns of the MaxTotalConns budget while it is open, so the tenant
+// connections of one service never exceed MaxTotalConns.
+type PoolLimits struct {
+	// MaxConns of one school's pool
+	MaxConns int32
+	// MaxTotalConns over all pools; 0 is unlimited. When the budget is
+	// spent, the least recently used idle pool is closed to make room.
+	MaxTotalConns int32
+	// MaxConnLifetime and MaxConnIdleTime of a connection; 0 keeps the pgx
+	// defaults. Pools keep no connections open when idle.
+	MaxConnLifetime time.Duration
+	MaxConnIdleTime time.Duration
+	// IdleTimeout closes a pool that served no request for that long;
+	// 0 keeps pools open
+	IdleTimeout time.Duration
+	// HealthCheckInterval between pings of the open pools. A pool that fails
+	// its ping is closed and reopened by the next request.
+	HealthCheckInterval time.Duration
+}
+
+// tenantPool is a cached pool and the connection settings it was opened
+// with. Settings that differ from the school's record, such as a rotated
+// password, replace the pool.
+type tenantPool struct {
+	code     string
+	pool     *pgxpool.Pool
+	settings string
+	maxConns int32
+	lastUsed atomic.Int64 // UnixNano
+	closed   sync.Once
+}
+
+func (p *tenantPool) touch() {
+	p.lastUsed.Store(time.Now().UnixNano())
+}
+
+func (p *tenantPool) idleFor(now time.Time) time.Duration {
+	return now.Sub(time.Unix(0, p.lastUsed.Load()))
+}
+
+// managerStats are the manager-wide counters exported as metrics
+type managerStats struct {
+	mu               sync.Mutex
+	opened           uint64
+	budgetRejections uint64
+	evictions        map[string]uint64
+}
+
+func (s *managerStats) evicted(reason string) {
+	s.mu.Lock()
+	s.evictions[reason]++
+	s.mu.Unlock()
+}
+
+func poolSettings(host string, port int, dbName, user, encryptedPassword string) string {
+	return fmt.Sprintf("%s\x00%d\x00%s\x00%s\x00%s", host, port, dbName, user, encryptedPassword)
+}
+
+// GetConnection retrieves a database connection for a tenant (from cache or
+// creates new). When the school's settings changed since the cached pool was
+// opened, a new pool replaces it and the old one is drained. Cached pools
+// are not pinged; the background health check closes broken ones.
+func (tm *TenantManager) GetConnection(ctx context.Context, schoolCode string, host string, port int, dbName, user, encryptedPassword string) (*pgxpool.Pool, error) {
+	settings := poolSettings(host, port, dbName, user, encryptedPassword)
+
+	// Check cache first
+	if pool := tm.cached(schoolCode, settings); pool != nil {
+		return pool, nil
+	}
+
+	// Concurrent requests for the school wait for one pool to open
+	v, err, _ := tm.opening.Do(schoolCode+"\x00"+settings, func() (interface{}, error) {
+		if pool := tm.cached(schoolCode, settings); pool != nil {
+			return pool, nil
+		}
+		// The pool outlives the request that opens it
+		return tm.open(context.WithoutCancel(ctx), schoolCode, settings, host, port, dbName, user, encryptedPassword)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*pgxpool.Pool), nil
+}
+
+func (tm *TenantManager) cached(schoolCode, settings string) *pgxpool.Pool {
+	tm.dbMutex.RLock()
+	defer tm.dbMutex.RUnlock()
+	if p, exists := tm.dbConnections[schoolCode]; exists && p.settings == settings {
+		p.touch()
+		return p.pool
+	}
+	return nil
+}
+
+func (tm *TenantManager) open(ctx context.Context, schoolCode, settings, host string, port int, dbName, user, encryptedPassword string) (*pgxpool.Pool, error) {
+	// Decrypt password
+	password, err := tm.keys.Decrypt(encryptedPassword)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt password: %w", err)
+	}
+
+	// Create new connection
+	dsn := connString(host, port, user, password, dbName, tm.admin.SSLMode)
+
+	// Create connection pool
+	config, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse DSN: %w", err)
+	}
+
+	// Configure pool; idle schools hold no connections
+	config.MaxConns = tm.limits.MaxConns
+	config.MinConns = 0
+	if tm.limits.MaxConnLifetime > 0 {
+		config.MaxConnLifetime = tm.limits.MaxConnLifetime
+	}
+	if tm.limits.MaxConnIdleTime > 0 {
+		config.MaxConnIdleTime = tm.limits.MaxConnIdleTime
+	}
+	config.ConnConfig.ConnectTimeout = tm.connectionTimeout
+
+	if err := tm.reserve(schoolCode, config.MaxConns); err != nil {
+		return nil, err
+	}
+	p := &tenantPool{code: schoolCode, settings: settings, maxConns: config.MaxConns}
+	p.touch()
+
+	// Connect with timeout
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	p.pool, err = pgxpool.NewWithConfig(ctx, config)
+	if err != nil {
+		tm.release(config.MaxConns)
+		return nil, fmt.Errorf("failed to create connection pool: %w", err)
+	}
+
+	// Test connection
+	if err := p.pool.Ping(ctx); err != nil {
+		tm.closePool(p)
+		return nil, fmt.Errorf("failed to ping database: %w", err)
+	}
+
+	// Cache the connection
+	tm.dbMutex.Lock()
+	replaced, exists := tm.dbConnections[schoolCode]
+	tm.dbConnections[schoolCode] = p
+	tm.dbMutex.Unlock()
+	tm.stats.mu.Lock()
+	tm.stats.opened++
+	tm.stats.mu.Unlock()
+
+	// Requests holding the replaced pool finish on it: connections already
+	// open stay authenticated after a password change
+	if exists {
+		tm.stats.evicted(EvictReplaced)
+		time.AfterFunc(DrainTimeout, func() { tm.closePool(replaced) })
+	}
+
+	return p.pool, nil
+}
+
+// reserve takes n connections of the budget, evicting least recently used
+// idle pools other than schoolCode's while the budget is short
+func (tm *TenantManager) reserve(schoolCode string, n int32) error {
+	tm.dbMutex.Lock()
+	defer tm.dbMutex.Unlock()
+
+	if tm.limits.MaxTotalConns <= 0 {
+		tm.reserved += n
+		return nil
+	}
+
+	var victims []*tenantPool
+	now := time.Now()
+	for _, p := range tm.dbConnections {
+		if p.code != schoolCode && p.pool.Stat().AcquiredConns() == 0 && p.idleFor(now) > evictGrace {
+			victims = append(victims, p)
+		}
+	}
+	sort.Slice(victims, func(i, j int) bool { return victims[i].lastUsed.Load() < victims[j].lastUsed.Load() })
+
+	// Evicted pools give up their reservation at once: they have no
+	// acquired connections
+	free := tm.limits.MaxTotalConns - tm.reserved
+	var evict []*tenantPool
+	for _, p := range victims {
+		if free >= n {
+			break
+		}
+		evict = append(evict, p)
+		free += p.maxConns
+	}
+	if free < n {
+		tm.stats.mu.Lock()
+		tm.stats.budgetRejections++
+		tm.stats.mu.Unlock()
+		return fmt.Errorf("%w: %d of %d connections reserved", ErrPoolBudget, tm.reserved, tm.limits.MaxTotalConns)
+	}
+
+	for _, p := range evict {
+		delete(tm.dbConnections, p.code)
+		tm.stats.evicted(EvictBudget)
+		tm.reserved -= p.maxConns
+	}
+	tm.reserved += n
+	// Closing waits for a request that acquired a connection meanwhile
+	go func() {
+		for _, p := range evict {
+			p.closed.Do(p.pool.Close)
+		}
+	}()
+	return nil
+}
+
+func (tm *TenantManager) release(n int32) {
+	tm.dbMutex.Lock()
+	tm.reserved -= n
+	tm.dbMutex.Unlock()
+}
+
+// closePool closes a pool that is no longer cached, waiting for acquired
+// connections, and returns its reservation
+func (tm *TenantManager) closePool(p *tenantPool) {
+	p.closed.Do(func() {
+		p.pool.Close()
+		tm.release(p.maxConns)
+	})
+}
+
+// evict removes the school's pool if it is still p and closes it
+func (tm *TenantManager) evict(p *tenantPool, reason string) {
+	tm.dbMutex.Lock()
+	current := tm.dbConnections[p.code] == p
+	if current {
+		delete(tm.dbConnections, p.code)
+	}
+	tm.dbMutex.Unlock()
+	if current {
+		tm.stats.evicted(reason)
+		tm.closePool(p)
+	}
+}
+
+// maintain closes idle and broken pools every HealthCheckInterval
+func (tm *TenantManager) maintain() {
+	ticker := time.NewTicker(tm.limits.HealthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-tm.stop:
+			return
+		case <-ticker.C:
+			tm.checkPools()
+		}
+	}
+}
+
+func (tm *TenantManager) checkPools() {
+	tm.dbMutex.RLock()
+	pools := make([]*tenantPool, 0, len(tm.dbConnections))
+	for _, p := range tm.dbConnections {
+		pools = append(pools, p)
+	}
+	tm.dbMutex.RUnlock()
+
+	now := time.Now()
+	for _, p := range pools {
+		stat := p.pool.Stat()
+		if tm.limits.IdleTimeout > 0 && stat.AcquiredConns() == 0 && p.idleFor(now) > tm.limits.IdleTimeout {
+			tm.evict(p, EvictIdle)
+			continue
+		}
+		// A pool without connections has nothing to check and pinging it
+		// would open one
+		if stat.TotalConns() == 0 {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), tm.connectionTimeout)
+		err := p.pool.Ping(ctx)
+		cancel()
+		if err != nil {
+			log.Printf("Tenant pool %s failed its health check: %v\n", p.code, err)
+			tm.evict(p, EvictUnhealthy)
+		}
+	}
+}
+
+// CloseConnection closes a specific tenant connection
+func (tm *TenantManager) CloseConnection(schoolCode string) {
+	tm.dbMutex.RLock()
+	p, exists := tm.dbConnections[schoolCode]
+	tm.dbMutex.RUnlock()
+	if exists {
+		tm.evict(p, EvictClosed)
+	}
+}
+
+// CloseAllConnections closes all tenant connections and stops the health
+// checks. The manager must not be used afterwards.
+func (tm *TenantManager) CloseAllConnections() {
+	tm.stopOnce.Do(func() { close(tm.stop) })
+
+	tm.dbMutex.Lock()
+	pools := tm.dbConnections
+	tm.dbConnections = make(map[string]*tenantPool)
+	tm.dbMutex.Unlock()
+
+	for _, p := range pools {
+		tm.closePool(p)
+	}
+}
+
+// GetStats returns connection pool statistics
+func (tm *TenantManager) GetStats(schoolCode string) map[string]interface{} {
+	tm.dbMutex.RLock()
+	defer tm.dbMutex.RUnlock()
+
+	if conn, exists := tm.dbConnections[schoolCode]; exists {
+		stat := conn.pool.Stat()
+		return map[string]interface{}{
+			"total_conns":    stat.TotalConns(),
+			"idle_conns":     stat.IdleConns(),
+			"acq_count":      stat.AcquiredConns(),
+			"acquired_conns": stat.AcquiredConns(),
+			"max_conns":      stat.MaxConns(),
+			"idle_seconds":   int64(conn.idleFor(time.Now()).Seconds()),
+		}
+	}
+
+	return nil
+}
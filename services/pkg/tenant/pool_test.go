@@ -0,0 +1,109 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// addPool caches a pool that has not connected, last used ago
+func addPool(t *testing.T, tm *TenantManager, code string, ago time.Duration) *tenantPool {
+	t.Helper()
+	config, err := pgxpool.ParseConfig("postgres://u:p@127.0.0.1:1/" + code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.MaxConns = tm.limits.MaxConns
+	pool, err := pgxpool.NewWithConfig(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tm.reserve(code, config.MaxConns); err != nil {
+		t.Fatal(err)
+	}
+	p := &tenantPool{code: code, pool: pool, settings: code, maxConns: config.MaxConns}
+	p.lastUsed.Store(time.Now().Add(-ago).UnixNano())
+	tm.dbConnections[code] = p
+	return p
+}
+
+func TestPoolBudget(t *testing.T) {
+	tm := NewTenantManager(testKeyring(t), PoolLimits{MaxConns: 4, MaxTotalConns: 10}, Admin{})
+	defer tm.CloseAllConnections()
+
+	addPool(t, tm, "old", time.Hour)
+	addPool(t, tm, "older", 2*time.Hour)
+	if tm.reserved != 8 {
+		t.Fatalf("reserved = %d, want 8", tm.reserved)
+	}
+
+	// Only 2 of 10 are left: the least recently used pool makes room
+	addPool(t, tm, "new", 0)
+	if _, ok := tm.dbConnections["older"]; ok {
+		t.Error("least recently used pool was not evicted")
+	}
+	if _, ok := tm.dbConnections["old"]; !ok {
+		t.Error("more recently used pool was evicted")
+	}
+	if tm.reserved != 8 {
+		t.Errorf("reserved = %d, want 8", tm.reserved)
+	}
+
+	// Pools used within evictGrace are not evicted
+	tm.dbConnections["old"].touch()
+	if err := tm.reserve("another", 4); !errors.Is(err, ErrPoolBudget) {
+		t.Errorf("reserve with every pool in use = %v, want ErrPoolBudget", err)
+	}
+	if tm.stats.evictions[EvictBudget] != 1 || tm.stats.budgetRejections != 1 {
+		t.Errorf("evictions %v, rejections %d", tm.stats.evictions, tm.stats.budgetRejections)
+	}
+}
+
+func TestPoolIdleEviction(t *testing.T) {
+	tm := NewTenantManager(testKeyring(t), PoolLimits{MaxConns: 2, IdleTimeout: time.Minute}, Admin{})
+	defer tm.CloseAllConnections()
+
+	idle := addPool(t, tm, "idle", time.Hour)
+	addPool(t, tm, "busy", time.Second)
+	tm.checkPools()
+
+	if _, ok := tm.dbConnections["idle"]; ok {
+		t.Error("idle pool was not evicted")
+	}
+	if _, ok := tm.dbConnections["busy"]; !ok {
+		t.Error("recently used pool was evicted")
+	}
+	if tm.reserved != 2 {
+		t.Errorf("reserved = %d, want 2", tm.reserved)
+	}
+	if err := idle.pool.Ping(context.Background()); err == nil || !strings.Contains(err.Error(), "closed pool") {
+		t.Errorf("evicted pool is not closed: %v", err)
+	}
+}
+
+func TestPoolMetrics(t *testing.T) {
+	tm := NewTenantManager(testKeyring(t), PoolLimits{MaxConns: 2, MaxTotalConns: 4}, Admin{})
+	defer tm.CloseAllConnections()
+	addPool(t, tm, "eis", 0)
+
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(tm)
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]bool{}
+	for _, f := range families {
+		got[f.GetName()] = true
+	}
+	for _, name := range []string{"tenant_pool_connections", "tenant_pool_acquires_total", "tenant_pools", "tenant_pool_evictions_total"} {
+		if !got[name] {
+			t.Errorf("metric %s is missing", name)
+		}
+	}
+}
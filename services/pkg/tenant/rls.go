@@ -0,0 +1,101 @@
+package tenant
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Tenancy modes of a school: its own database, or rows in the shared
+// database isolated by row-level security.
+const (
+	Dedicated = "dedicated"
+	Shared    = "shared"
+)
+
+// SchoolSetting is the session setting a shared-tenancy connection carries
+// for the duration of a request. RLS policies compare each row's school_id
+// with it; when it is unset no rows are visible.
+const SchoolSetting = "app.current_school"
+
+// SharedRole is the role shared-tenancy requests run as. It owns nothing and
+// cannot bypass RLS, so the policies apply even when the service itself
+// connects as the table owner or a superuser.
+const SharedRole = "school_erp_tenant"
+
+// RLSMigration returns idempotent SQL that puts tables, each with a BIGINT
+// school_id column, under row-level security for SharedRole. school_id
+// defaults to the current school so inserts cannot forget it.
+func RLSMigration(tables ...string) string {
+	current := fmt.Sprintf("NULLIF(current_setting('%s', true), '')::bigint", SchoolSetting)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `
+DO $$
+BEGIN
+	CREATE ROLE %[1]s NOLOGIN NOBYPASSRLS;
+EXCEPTION WHEN duplicate_object THEN NULL;
+END
+$$;
+GRANT %[1]s TO CURRENT_USER;
+GRANT USAGE ON SCHEMA public TO %[1]s;
+GRANT USAGE, SELECT ON ALL SEQUENCES IN SCHEMA public TO %[1]s;
+`, SharedRole)
+
+	for _, table := range tables {
+		fmt.Fprintf(&b, `
+GRANT SELECT, INSERT, UPDATE, DELETE ON %[1]s TO %[2]s;
+ALTER TABLE %[1]s ALTER COLUMN school_id SET DEFAULT %[3]s;
+ALTER TABLE %[1]s ENABLE ROW LEVEL SECURITY;
+DO $$
+BEGIN
+	IF NOT EXISTS (SELECT FROM pg_policies WHERE tablename = %[4]s AND policyname = 'tenant_isolation') THEN
+		CREATE POLICY tenant_isolation ON %[1]s
+			USING (school_id = %[3]s)
+			WITH CHECK (school_id = %[3]s);
+	END IF;
+END
+$$;
+`, quoteIdent(table), SharedRole, current, quoteLiteral(table))
+	}
+	return b.String()
+}
+
+// acquireShared checks out a connection of the shared database scoped to
+// school: it carries SchoolSetting and runs as SharedRole until released.
+func acquireShared(ctx context.Context, db *pgxpool.Pool, school *School) (*pgxpool.Conn, error) {
+	conn, err := db.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.Exec(ctx, `SELECT set_config($1, $2, false)`,
+		SchoolSetting, strconv.FormatInt(school.SharedID, 10)); err != nil {
+		discard(conn)
+		return nil, err
+	}
+	if _, err := conn.Exec(ctx, `SET ROLE `+SharedRole); err != nil {
+		discard(conn)
+		return nil, err
+	}
+	return conn, nil
+}
+
+// releaseShared clears the school from conn and returns it to the pool. A
+// connection that cannot be cleared is closed rather than reused.
+func releaseShared(conn *pgxpool.Conn) {
+	if _, err := conn.Exec(context.Background(), `RESET ROLE; RESET `+SchoolSetting); err != nil {
+		log.Printf("Failed to reset shared tenant connection, closing it: %v\n", err)
+		discard(conn)
+		return
+	}
+	conn.Release()
+}
+
+func discard(conn *pgxpool.Conn) {
+	c := conn.Hijack()
+	_ = c.Close(context.Background())
+}
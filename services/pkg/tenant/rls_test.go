@@ -0,0 +1,183 @@
+package tenant
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"school-erp/pkg/problem"
+)
+
+// sharedDirectory maps codes of shared-tenancy schools to their school_id.
+type sharedDirectory map[string]int64
+
+func (d sharedDirectory) Lookup(_ context.Context, code string) (*School, error) {
+	id, ok := d[code]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &School{Code: code, Tenancy: Shared, SharedID: id}, nil
+}
+
+// TestSharedTenancyIsolation needs a Postgres superuser DSN in
+// TENANT_TEST_DATABASE_URL. It creates and drops its own table.
+func TestSharedTenancyIsolation(t *testing.T) {
+	dsn := os.Getenv("TENANT_TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TENANT_TEST_DATABASE_URL not set")
+	}
+	ctx := context.Background()
+
+	// One connection, so every request and check reuses the same session
+	poolConfig, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	poolConfig.MaxConns = 1
+	db, err := pgxpool.NewWithConfig(ctx, poolConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	mustExec := func(sql string, args ...interface{}) {
+		t.Helper()
+		if _, err := db.Exec(ctx, sql, args...); err != nil {
+			t.Fatalf("%s: %v", sql, err)
+		}
+	}
+	mustExec(`DROP TABLE IF EXISTS rls_probe;
+		CREATE TABLE rls_probe (id BIGSERIAL PRIMARY KEY, school_id BIGINT NOT NULL, note TEXT NOT NULL)`)
+	t.Cleanup(func() { db.Exec(context.Background(), `DROP TABLE IF EXISTS rls_probe`) })
+	mustExec(RLSMigration("rls_probe"))
+	mustExec(RLSMigration("rls_probe")) // idempotent
+
+	var foreignID int64
+	mustExec(`INSERT INTO rls_probe (school_id, note) VALUES (1, 'eis')`)
+	if err := db.QueryRow(ctx, `INSERT INTO rls_probe (school_id, note) VALUES (2, 'kmc') RETURNING id`).Scan(&foreignID); err != nil {
+		t.Fatal(err)
+	}
+	foreign := strconv.FormatInt(foreignID, 10)
+
+	app := fiber.New(fiber.Config{ErrorHandler: problem.ErrorHandler})
+	app.Use(New(Config{Directory: sharedDirectory{"eis": 1, "kmc": 2}, Shared: db}))
+	app.Get("/notes", func(c *fiber.Ctx) error {
+		rows, err := DB(c).Query(c.Context(), `SELECT note FROM rls_probe ORDER BY id`)
+		if err != nil {
+			return problem.FromDB(err, "Note")
+		}
+		defer rows.Close()
+		notes := []string{}
+		for rows.Next() {
+			var note string
+			if err := rows.Scan(&note); err != nil {
+				return err
+			}
+			notes = append(notes, note)
+		}
+		return c.JSON(notes)
+	})
+	app.Get("/notes/:id", func(c *fiber.Ctx) error {
+		var note string
+		if err := DB(c).QueryRow(c.Context(), `SELECT note FROM rls_probe WHERE id = $1`, c.Params("id")).Scan(&note); err != nil {
+			return problem.FromDB(err, "Note")
+		}
+		return c.SendString(note)
+	})
+	app.Put("/notes/:id", func(c *fiber.Ctx) error {
+		tag, err := DB(c).Exec(c.Context(), `UPDATE rls_probe SET note = 'changed' WHERE id = $1`, c.Params("id"))
+		if err != nil {
+			return problem.FromDB(err, "Note")
+		}
+		if tag.RowsAffected() == 0 {
+			return problem.NotFound("Note not found")
+		}
+		return c.SendStatus(fiber.StatusNoContent)
+	})
+	app.Post("/notes", func(c *fiber.Ctx) error {
+		var err error
+		if school := c.Query("school_id"); school != "" {
+			_, err = DB(c).Exec(c.Context(), `INSERT INTO rls_probe (school_id, note) VALUES ($1, $2)`, school, string(c.Body()))
+		} else {
+			_, err = DB(c).Exec(c.Context(), `INSERT INTO rls_probe (note) VALUES ($1)`, string(c.Body()))
+		}
+		if err != nil {
+			return problem.FromDB(err, "Note")
+		}
+		return c.SendStatus(fiber.StatusCreated)
+	})
+
+	do := func(method, target, body string) (int, string) {
+		t.Helper()
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set(HeaderCode, "eis")
+		resp, err := app.Test(req, 5000)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(b)
+	}
+
+	status, body := do("GET", "/notes", "")
+	var notes []string
+	json.Unmarshal([]byte(body), &notes)
+	if status != 200 || len(notes) != 1 || notes[0] != "eis" {
+		t.Fatalf("list: %d %s, want only eis's row", status, body)
+	}
+	if status, body := do("GET", "/notes/"+foreign, ""); status != 404 {
+		t.Errorf("read of another school's row: %d %s, want 404", status, body)
+	}
+	if status, body := do("PUT", "/notes/"+foreign, ""); status != 404 {
+		t.Errorf("update of another school's row: %d %s, want 404", status, body)
+	}
+	if status, _ := do("POST", "/notes?school_id=2", "forged"); status == 201 {
+		t.Error("insert into another school succeeded")
+	}
+	if status, body := do("POST", "/notes", "defaulted"); status != 201 {
+		t.Fatalf("insert: %d %s", status, body)
+	}
+
+	// As the owner: kmc's row is untouched and the new row belongs to eis
+	var note string
+	var school int64
+	if err := db.QueryRow(ctx, `SELECT note FROM rls_probe WHERE id = $1`, foreignID).Scan(&note); err != nil || note != "kmc" {
+		t.Errorf("kmc row = %q, %v", note, err)
+	}
+	if err := db.QueryRow(ctx, `SELECT school_id FROM rls_probe WHERE note = 'defaulted'`).Scan(&school); err != nil || school != 1 {
+		t.Errorf("defaulted row school_id = %d, %v", school, err)
+	}
+
+	// The pooled connection was returned without the school or the role
+	var isSessionUser bool
+	var setting string
+	if err := db.QueryRow(ctx, `SELECT current_user = session_user, COALESCE(current_setting($1, true), '')`,
+		SchoolSetting).Scan(&isSessionUser, &setting); err != nil {
+		t.Fatal(err)
+	}
+	if !isSessionUser || setting != "" {
+		t.Errorf("released connection still scoped: role reset %v, %s = %q", isSessionUser, SchoolSetting, setting)
+	}
+
+	// Without a school, the shared role sees nothing
+	var visible int
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback(ctx)
+	if _, err := tx.Exec(ctx, `SET LOCAL ROLE `+SharedRole); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.QueryRow(ctx, `SELECT count(*) FROM rls_probe`).Scan(&visible); err != nil || visible != 0 {
+		t.Errorf("rows visible without a school = %d, %v", visible, err)
+	}
+}
@@ -0,0 +1,179 @@
+package tenant
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+
+	"school-erp/pkg/problem"
+)
+
+const testSecret = "tenant-test-secret"
+
+// fakeDirectory knows one school whose database is unreachable, so a
+// resolved request ends in 503 after the lookup.
+type fakeDirectory struct {
+	password string
+	lookups  []string
+}
+
+func (d *fakeDirectory) Lookup(_ context.Context, code string) (*School, error) {
+	d.lookups = append(d.lookups, code)
+	if code == "small" {
+		return &School{ID: "2", Code: "small", Tenancy: Shared, Status: StatusActive, SharedID: 2}, nil
+	}
+	status := StatusActive
+	switch code {
+	case "eis":
+	case "old":
+		status = StatusSuspended
+	default:
+		return nil, ErrNotFound
+	}
+	return &School{ID: "1", Code: code, Tenancy: Dedicated, Status: status, DBName: "school_" + code + "_db", DBHost: "127.0.0.1", DBPort: 1,
+		DBUser: "school_" + code + "_user", DBPassword: d.password}, nil
+}
+
+func signedToken(t *testing.T, code string) string {
+	t.Helper()
+	s, err := jwt.NewWithClaims(jwt.SigningMethodHS256, tenantClaims{
+		TenantCode:       code,
+		RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))},
+	}).SignedString([]byte(testSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestResolver(t *testing.T) {
+	tm := NewTenantManager(testKeyring(t), PoolLimits{MaxConns: 2, MaxConnLifetime: time.Minute}, Admin{})
+	password, _ := tm.EncryptPassword("secret")
+
+	bearer := func(code string) string { return "Bearer " + signedToken(t, code) }
+	cases := []struct {
+		name    string
+		method  string
+		target  string
+		host    string
+		headers map[string]string
+		status  int
+		lookup  string
+	}{
+		{name: "header", target: "/students", headers: map[string]string{HeaderCode: "eis", "Authorization": bearer("eis")}, status: 503, lookup: "eis"},
+		{name: "query", target: "/students?tenant_code=eis", headers: map[string]string{"Authorization": bearer("eis")}, status: 503, lookup: "eis"},
+		{name: "subdomain", target: "/students", host: "eis.school-erp.com", headers: map[string]string{"Authorization": bearer("eis")}, status: 503, lookup: "eis"},
+		{name: "token claim", target: "/students", headers: map[string]string{"Authorization": bearer("eis")}, status: 503, lookup: "eis"},
+		{name: "token for another school", target: "/students",
+			headers: map[string]string{HeaderCode: "eis", "Authorization": bearer("kmc")}, status: 403},
+		{name: "token for no school", target: "/students",
+			headers: map[string]string{HeaderCode: "eis", "Authorization": bearer("")}, status: 403},
+		{name: "unverifiable token", target: "/students",
+			headers: map[string]string{HeaderCode: "eis", "Authorization": "Bearer not-a-token"}, status: 401},
+		{name: "missing token", target: "/students", headers: map[string]string{HeaderCode: "eis"}, status: 401},
+		{name: "unknown school", target: "/students", headers: map[string]string{"Authorization": bearer("nope")}, status: 404, lookup: "nope"},
+		{name: "shared school without shared database", target: "/students", headers: map[string]string{"Authorization": bearer("small")}, status: 503, lookup: "small"},
+		{name: "skipped", target: "/health", status: 200},
+		{name: "suspended school read", target: "/students", headers: map[string]string{"Authorization": bearer("old")}, status: 503, lookup: "old"},
+		{name: "suspended school write", method: "POST", target: "/students", headers: map[string]string{"Authorization": bearer("old")}, status: 403, lookup: "old"},
+		{name: "custom domain", target: "/students", host: "Portal.EIS.edu.np:443", headers: map[string]string{"Authorization": bearer("eis")}, status: 503, lookup: "eis"},
+		{name: "custom domain and its code", target: "/students", host: "portal.eis.edu.np", headers: map[string]string{HeaderCode: "EIS", "Authorization": bearer("eis")}, status: 503, lookup: "eis"},
+		{name: "custom domain and another code", target: "/students?tenant_code=kmc", host: "portal.eis.edu.np", headers: map[string]string{"Authorization": bearer("kmc")}, status: 403},
+		{name: "unverified custom domain", target: "/students", host: "portal.kmc.edu.np", headers: map[string]string{"Authorization": bearer("kmc")}, status: 403},
+	}
+	domains := NewDomainMap(nil)
+	domains.Apply(SchoolUpdated{Code: "eis", Domain: "portal.eis.edu.np", DomainVerified: true, Status: StatusActive})
+	domains.Apply(SchoolUpdated{Code: "kmc", Domain: "portal.kmc.edu.np", Status: StatusActive})
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := &fakeDirectory{password: password}
+			app := fiber.New(fiber.Config{ErrorHandler: problem.ErrorHandler})
+			app.Use(New(Config{
+				Manager:   tm,
+				Directory: dir,
+				Domains:   domains,
+				JWTSecret: testSecret,
+				Skip:      func(c *fiber.Ctx) bool { return c.Path() == "/health" },
+			}))
+			app.All("/*", func(c *fiber.Ctx) error { return c.SendString("ok") })
+
+			method := tc.method
+			if method == "" {
+				method = "GET"
+			}
+			req := httptest.NewRequest(method, tc.target, nil)
+			req.Host = "localhost:3003"
+			if tc.host != "" {
+				req.Host = tc.host
+			}
+			for k, v := range tc.headers {
+				req.Header.Set(k, v)
+			}
+			resp, err := app.Test(req, 5000)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			if resp.StatusCode != tc.status {
+				t.Fatalf("status = %d, want %d: %s", resp.StatusCode, tc.status, body)
+			}
+			if tc.lookup == "" && len(dir.lookups) > 0 || tc.lookup != "" && (len(dir.lookups) != 1 || dir.lookups[0] != tc.lookup) {
+				t.Errorf("lookups = %v, want [%s]", dir.lookups, tc.lookup)
+			}
+		})
+	}
+}
+
+func TestSubdomain(t *testing.T) {
+	cases := map[string]string{
+		"eis.school-erp.com":      "eis",
+		"eis.localhost:3000":      "eis",
+		"www.school-erp.com":      "",
+		"api.school-erp.com":      "",
+		"localhost":               "",
+		"localhost:8080":          "",
+		"192.168.1.10:8080":       "",
+		"[::1]:8080":              "",
+		"kmc.schools.example.org": "kmc",
+	}
+	for host, want := range cases {
+		if got := Subdomain(host); got != want {
+			t.Errorf("Subdomain(%q) = %q, want %q", host, got, want)
+		}
+	}
+}
+
+func TestDomainMapApply(t *testing.T) {
+	m := NewDomainMap(nil)
+	m.Apply(SchoolUpdated{Code: "eis", Domain: "eis.edu.np", DomainVerified: true, Status: StatusActive})
+	m.Apply(SchoolUpdated{Code: "kmc", Domain: "kmc.edu.np", DomainVerified: true, Status: StatusSuspended})
+	if m.Code("EIS.edu.np.") != "eis" || m.Code("kmc.edu.np:8443") != "kmc" {
+		t.Fatalf("codes = %v", m.codes)
+	}
+
+	// A new domain replaces the old one until it is verified
+	m.Apply(SchoolUpdated{Code: "eis", Domain: "everest.edu.np", Status: StatusActive})
+	if m.Code("eis.edu.np") != "" || m.Code("everest.edu.np") != "" {
+		t.Errorf("unverified domain is mapped: %v", m.codes)
+	}
+	m.Apply(SchoolUpdated{Code: "eis", Domain: "everest.edu.np", DomainVerified: true, Status: StatusActive})
+	if m.Code("everest.edu.np") != "eis" {
+		t.Errorf("verified domain is not mapped: %v", m.codes)
+	}
+
+	// Schools that are not served lose their domain
+	m.Apply(SchoolUpdated{Code: "kmc", Domain: "kmc.edu.np", DomainVerified: true, Status: "deleted"})
+	if m.Code("kmc.edu.np") != "" {
+		t.Errorf("deleted school is mapped: %v", m.codes)
+	}
+
+	var nilMap *DomainMap
+	if nilMap.Code("eis.edu.np") != "" {
+		t.Error("nil map knows a domain")
+	}
+}
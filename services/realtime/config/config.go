@@ -2,52 +2,31 @@ package config
 
 import (
 	"log"
-	"os"
-	"time"
+
+	pkgconfig "school-erp/pkg/config"
 )
 
 type Config struct {
-	Port        string
-	Environment string
-	DBHost      string
-	DBPort      string
-	DBUser      string
-	DBPassword  string
-	DBName      string
-	DBSSLMode   string
-	JWTSecret   string
-	NATSUrl     string
-	RedisURL    string
-	LogLevel    string
-}
-
-func LoadConfig() *Config {
-	cfg := &Config{
-		Port:        getEnv("REALTIME_SERVICE_PORT", "3008"),
-		Environment: getEnv("ENVIRONMENT", "development"),
-		DBHost:      getEnv("DB_HOST", "postgres"),
-		DBPort:      getEnv("DB_PORT", "5432"),
-		DBUser:      getEnv("DB_USER", "postgres"),
-		DBPassword:  getEnv("DB_PASSWORD", "postgres"),
-		DBName:      getEnv("DB_NAME", "school_erp"),
-		DBSSLMode:   getEnv("DB_SSL_MODE", "disable"),
-		JWTSecret:   getEnv("JWT_SECRET", "change-me"),
-		NATSUrl:     getEnv("NATS_URL", "nats://localhost:4222"),
-		RedisURL:    getEnv("REDIS_URL", "redis://localhost:6379"),
-		LogLevel:    getEnv("LOG_LEVEL", "info"),
-	}
-	log.Printf("[Realtime Service] Environment: %s, Port: %s", cfg.Environment, cfg.Port)
-	return cfg
+	Port        string `env:"REALTIME_SERVICE_PORT" default:"3008"`
+	Environment string `env:"ENVIRONMENT" default:"development"`
+	DBHost      string `env:"DB_HOST" default:"postgres"`
+	DBPort      string `env:"DB_PORT" default:"5432"`
+	DBUser      string `env:"DB_USER" default:"postgres"`
+	DBPassword  string `env:"DB_PASSWORD" default:"postgres" secret:"true"`
+	DBName      string `env:"DB_NAME" default:"school_erp"`
+	DBSSLMode   string `env:"DB_SSL_MODE" default:"disable"`
+	JWTSecret   string `env:"JWT_SECRET" default:"change-me" secret:"true"`
+	NATSUrl     string `env:"NATS_URL" default:"nats://localhost:4222"`
+	RedisURL    string `env:"REDIS_URL" default:"redis://localhost:6379"`
+	LogLevel    string `env:"LOG_LEVEL" default:"info"`
 }
 
-func getEnv(key, defaultVal string) string {
-	if value, exists := os.LookupEnv(key); exists {
-		return value
+func LoadConfig() (*Config, error) {
+	cfg := &Config{}
+	report, err := pkgconfig.Load(cfg)
+	if err != nil {
+		return nil, err
 	}
-	return defaultVal
-}
-
-func parseDuration(s string) time.Duration {
-	d, _ := time.ParseDuration(s)
-	return d
+	report.Print(log.Writer(), "Realtime Service")
+	return cfg, nil
 }
@@ -9,6 +9,7 @@ import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/joho/godotenv"
 
+	"school-erp/pkg/problem"
 	"school-erp/realtime/config"
 	"school-erp/realtime/database"
 	"school-erp/realtime/messaging"
@@ -27,7 +28,10 @@ func contains(allowedOrigins string, origin string) bool {
 }
 func main() {
 	godotenv.Load()
-	cfg := config.LoadConfig()
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
 
 	db, err := database.InitDB(cfg)
 	if err != nil {
@@ -42,30 +46,16 @@ func main() {
 	messaging.ConnectNATS()
 	defer messaging.NatsConnection.Close()
 
-	app := fiber.New(fiber.Config{AppName: "School ERP Realtime Service"})
-	setupMiddleware(app)
-
-	app.Get("/", func(c *fiber.Ctx) error {
-		return c.JSON(fiber.Map{
-			"service": "School ERP Realtime Service",
-			"version": "v1.0.0",
-			"status": "running",
-			"endpoints": fiber.Map{
-				"health": "/health",
-				"metrics": "/metrics",
-				"websocket": "/ws",
-			},
-		})
+	app := fiber.New(fiber.Config{
+		AppName:      "School ERP Realtime Service",
+		ErrorHandler: problem.ErrorHandler,
 	})
+	setupMiddleware(app)
 
 	routes.SetupRoutes(app, db)
 
-	app.Get("/health", func(c *fiber.Ctx) error {
-		return c.JSON(fiber.Map{"status": "healthy", "service": "realtime"})
-	})
-	app.Get("/metrics", func(c *fiber.Ctx) error {
-		return c.JSON(fiber.Map{"uptime": "N/A", "status": "operational"})
-	})
+	// Welcome, health, metrics and API document
+	routes.SetupSystemRoutes(app)
 
 	port := cfg.Port
 	log.Printf("Starting Realtime Service on port %s\n", port)
@@ -0,0 +1,35 @@
+package routes
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"school-erp/pkg/openapi"
+)
+
+// SetupSystemRoutes mounts the welcome, health and metrics routes and the
+// API document
+func SetupSystemRoutes(app *fiber.App) {
+	// Welcome route
+	app.Get("/", func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{
+			"service": "School ERP Realtime Service",
+			"version": "v1.0.0",
+			"status":  "running",
+			"endpoints": fiber.Map{
+				"health":    "/health",
+				"openapi":   "/openapi.json",
+				"metrics":   "/metrics",
+				"websocket": "/ws",
+			},
+		})
+	})
+
+	// Health check
+	app.Get("/health", func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{"status": "healthy", "service": "realtime"})
+	})
+	app.Get("/metrics", func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{"uptime": "N/A", "status": "operational"})
+	})
+	app.Get("/openapi.json", openapi.Handler(app, APIInfo, Operations))
+}
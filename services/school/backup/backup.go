@@ -0,0 +1,648 @@
+// Package backup dumps dedicated schools' databases to encrypted archives
+// and restores them. An archive is a pg_dump custom-format dump encrypted
+// with the backup keyring (see crypt.go) and kept in a Storage; the
+// tenant_backups table is its catalog. A restore goes into a new database,
+// is verified, and replaces the school's database only when swapped.
+//
+// Restores are point-in-time at backup granularity: RestoreAt restores the
+// last backup taken at or before the given time.
+package backup
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"school-erp/pkg/tenant"
+)
+
+var (
+	// ErrShared is returned for shared schools, which have no database
+	ErrShared = errors.New("shared schools have no database to back up")
+	// ErrNotProvisioned is returned while a school's database may not exist
+	ErrNotProvisioned = errors.New("school is not provisioned")
+	// ErrArchived is returned for purged schools, which have no database
+	ErrArchived = errors.New("school is archived")
+	// ErrState is returned for restores in the wrong state for an operation
+	ErrState = errors.New("restore is not in a state that allows this")
+)
+
+// Backup statuses
+const (
+	StatusRunning   = "running"
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+)
+
+// Restore statuses; a swapped restore's database serves the school
+const (
+	RestoreRunning   = "running"
+	RestoreRestored  = "restored"
+	RestoreFailed    = "failed"
+	RestoreSwapped   = "swapped"
+	RestoreDiscarded = "discarded"
+)
+
+// Config configures a Service
+type Config struct {
+	PGDump    string // pg_dump binary
+	PGRestore string // pg_restore binary
+	SSLMode   string // of tenant connections
+	// Archives expire after Retention, but the KeepMin newest completed
+	// backups of each school are kept regardless
+	Retention time.Duration
+	KeepMin   int
+}
+
+// Backup is a catalog entry
+type Backup struct {
+	ID          string     `json:"id"`
+	SchoolID    string     `json:"school_id"`
+	SchoolCode  string     `json:"school_code"`
+	DBName      string     `json:"db_name"`
+	StorageKey  string     `json:"storage_key"`
+	Status      string     `json:"status"`
+	KeyID       string     `json:"key_id,omitempty"`
+	SizeBytes   int64      `json:"size_bytes"`
+	SHA256      string     `json:"sha256,omitempty"`
+	Error       string     `json:"error,omitempty"`
+	Actor       string     `json:"actor"`
+	StartedAt   time.Time  `json:"started_at"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+}
+
+// Restore is a backup restored into a new database
+type Restore struct {
+	ID             string           `json:"id"`
+	BackupID       string           `json:"backup_id"`
+	SchoolID       string           `json:"school_id"`
+	SchoolCode     string           `json:"school_code"`
+	DBName         string           `json:"db_name"`
+	Status         string           `json:"status"`
+	TableCounts    map[string]int64 `json:"table_counts,omitempty"`
+	Error          string           `json:"error,omitempty"`
+	ReplacedDBName string           `json:"replaced_db_name,omitempty"`
+	Actor          string           `json:"actor"`
+	CreatedAt      time.Time        `json:"created_at"`
+	CompletedAt    *time.Time       `json:"completed_at,omitempty"`
+	SwappedAt      *time.Time       `json:"swapped_at,omitempty"`
+}
+
+// Service backs up and restores school databases
+type Service struct {
+	db      *pgxpool.Pool
+	tm      *tenant.TenantManager
+	storage Storage
+	keys    *tenant.Keyring
+	cfg     Config
+}
+
+// NewService returns a Service that encrypts archives with keys, which
+// should differ from the keyring of database passwords
+func NewService(db *pgxpool.Pool, tm *tenant.TenantManager, storage Storage, keys *tenant.Keyring, cfg Config) *Service {
+	if cfg.PGDump == "" {
+		cfg.PGDump = "pg_dump"
+	}
+	if cfg.PGRestore == "" {
+		cfg.PGRestore = "pg_restore"
+	}
+	if cfg.SSLMode == "" {
+		cfg.SSLMode = "disable"
+	}
+	return &Service{db: db, tm: tm, storage: storage, keys: keys, cfg: cfg}
+}
+
+// school is a dedicated school's database
+type school struct {
+	id, code, dbName, dbHost, dbUser, password string
+	dbPort                                     int
+}
+
+// querier is a pool or a transaction
+type querier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// school looks up a dedicated school by code or ID. It returns
+// pgx.ErrNoRows for unknown schools.
+func (s *Service) school(ctx context.Context, q querier, ref string, lock bool) (*school, error) {
+	query := `
+	SELECT id::text, code, tenancy, status, db_name, db_host, db_port, db_user, db_password
+	FROM schools WHERE code = $1 OR id::text = $1`
+	if lock {
+		query += ` FOR UPDATE`
+	}
+	var sc school
+	var tenancy, status, encrypted string
+	err := q.QueryRow(ctx, query, ref).Scan(
+		&sc.id, &sc.code, &tenancy, &status, &sc.dbName, &sc.dbHost, &sc.dbPort, &sc.dbUser, &encrypted)
+	if err != nil {
+		return nil, err
+	}
+	if tenancy == tenant.Shared {
+		return nil, ErrShared
+	}
+	if status == "provisioning" || status == "failed" {
+		return nil, ErrNotProvisioned
+	}
+	if status == "archived" {
+		return nil, ErrArchived
+	}
+	if sc.password, err = s.tm.DecryptPassword(encrypted); err != nil {
+		return nil, fmt.Errorf("failed to decrypt password: %w", err)
+	}
+	return &sc, nil
+}
+
+// pgEnv returns the environment of pg_dump and pg_restore; the password is
+// passed in the environment so that it does not show in the process list
+func (s *Service) pgEnv(sc *school, dbName string) []string {
+	return append(os.Environ(),
+		"PGHOST="+sc.dbHost,
+		"PGPORT="+strconv.Itoa(sc.dbPort),
+		"PGUSER="+sc.dbUser,
+		"PGPASSWORD="+sc.password,
+		"PGDATABASE="+dbName,
+		"PGSSLMODE="+s.cfg.SSLMode,
+	)
+}
+
+// Backup dumps the school's database, identified by code or ID, to a new
+// archive. A failed backup stays in the catalog as failed.
+func (s *Service) Backup(ctx context.Context, ref, actor string) (*Backup, error) {
+	sc, err := s.school(ctx, s.db, ref, false)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &Backup{SchoolID: sc.id, SchoolCode: sc.code, DBName: sc.dbName, Status: StatusRunning, KeyID: s.keys.Primary(), Actor: actor}
+	err = s.db.QueryRow(ctx, `
+	INSERT INTO tenant_backups (school_id, school_code, db_name, storage_key, status, key_id, actor)
+	VALUES ($1, $2, $3, '', $4, $5, $6)
+	RETURNING id::text, started_at`, sc.id, sc.code, sc.dbName, StatusRunning, b.KeyID, actor,
+	).Scan(&b.ID, &b.StartedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record backup: %w", err)
+	}
+	b.StorageKey = fmt.Sprintf("%s/%s-%s.dump.enc", sc.code, b.StartedAt.UTC().Format("20060102T150405Z"), b.ID[:8])
+
+	if err := s.dump(ctx, sc, b); err != nil {
+		b.Status, b.Error = StatusFailed, err.Error()
+		_, _ = s.db.Exec(context.WithoutCancel(ctx), `
+		UPDATE tenant_backups SET status = $2, storage_key = $3, error = $4, completed_at = NOW() WHERE id = $1`,
+			b.ID, StatusFailed, b.StorageKey, b.Error)
+		_ = s.storage.Delete(context.WithoutCancel(ctx), b.StorageKey)
+		return b, err
+	}
+
+	err = s.db.QueryRow(ctx, `
+	UPDATE tenant_backups
+	SET status = $2, storage_key = $3, size_bytes = $4, sha256 = $5, completed_at = NOW(),
+		expires_at = NOW() + make_interval(secs => $6)
+	WHERE id = $1 RETURNING completed_at, expires_at`,
+		b.ID, StatusCompleted, b.StorageKey, b.SizeBytes, b.SHA256, s.cfg.Retention.Seconds(),
+	).Scan(&b.CompletedAt, &b.ExpiresAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record backup: %w", err)
+	}
+	b.Status = StatusCompleted
+	return b, nil
+}
+
+// dump streams pg_dump through encryption into storage, recording the
+// archive's size and checksum in b
+func (s *Service) dump(ctx context.Context, sc *school, b *Backup) error {
+	cmd := exec.CommandContext(ctx, s.cfg.PGDump, "--format=custom", "--no-owner", "--no-privileges")
+	cmd.Env = s.pgEnv(sc, sc.dbName)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+
+	pr, pw := io.Pipe()
+	sum := sha256.New()
+	counter := &countWriter{}
+	enc, err := newEncryptWriter(io.MultiWriter(pw, sum, counter), s.keys)
+	if err != nil {
+		return err
+	}
+	cmd.Stdout = enc
+
+	stored := make(chan error, 1)
+	go func() {
+		err := s.storage.Put(ctx, b.StorageKey, pr)
+		// Unblock pg_dump if storage gave up early
+		pr.CloseWithError(err)
+		stored <- err
+	}()
+
+	err = cmd.Run()
+	if err != nil {
+		err = fmt.Errorf("pg_dump failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	} else {
+		err = enc.Close()
+	}
+	// A failed dump must not be stored as complete
+	pw.CloseWithError(err)
+	if serr := <-stored; err == nil && serr != nil {
+		err = fmt.Errorf("failed to store archive: %w", serr)
+	}
+	if err != nil {
+		return err
+	}
+
+	b.SizeBytes, b.SHA256 = counter.n, hex.EncodeToString(sum.Sum(nil))
+	return nil
+}
+
+type countWriter struct{ n int64 }
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return len(p), nil
+}
+
+const backupColumns = `
+	id::text, school_id::text, school_code, db_name, storage_key, status, COALESCE(key_id, ''),
+	size_bytes, COALESCE(sha256, ''), COALESCE(error, ''), actor, started_at, completed_at, expires_at`
+
+func scanBackup(row pgx.Row) (*Backup, error) {
+	var b Backup
+	err := row.Scan(&b.ID, &b.SchoolID, &b.SchoolCode, &b.DBName, &b.StorageKey, &b.Status, &b.KeyID,
+		&b.SizeBytes, &b.SHA256, &b.Error, &b.Actor, &b.StartedAt, &b.CompletedAt, &b.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// List returns the school's backups, newest first
+func (s *Service) List(ctx context.Context, code string) ([]*Backup, error) {
+	rows, err := s.db.Query(ctx, `SELECT `+backupColumns+`
+	FROM tenant_backups WHERE school_code = $1 ORDER BY started_at DESC`, code)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (*Backup, error) { return scanBackup(row) })
+}
+
+// Get returns a backup; pgx.ErrNoRows if there is none
+func (s *Service) Get(ctx context.Context, id string) (*Backup, error) {
+	return scanBackup(s.db.QueryRow(ctx, `SELECT `+backupColumns+` FROM tenant_backups WHERE id::text = $1`, id))
+}
+
+// Latest returns the school's last completed backup started at or before
+// at; pgx.ErrNoRows if there is none
+func (s *Service) Latest(ctx context.Context, code string, at time.Time) (*Backup, error) {
+	return scanBackup(s.db.QueryRow(ctx, `SELECT `+backupColumns+`
+	FROM tenant_backups WHERE school_code = $1 AND status = $2 AND started_at <= $3
+	ORDER BY started_at DESC LIMIT 1`, code, StatusCompleted, at.UTC()))
+}
+
+// RestoreAt restores the school's last backup taken at or before at
+func (s *Service) RestoreAt(ctx context.Context, code string, at time.Time, actor string) (*Restore, error) {
+	b, err := s.Latest(ctx, code, at)
+	if err != nil {
+		return nil, err
+	}
+	return s.Restore(ctx, b.ID, actor)
+}
+
+// Restore restores a completed backup into a new database of the school
+// and verifies it. The school keeps using its database until Swap.
+func (s *Service) Restore(ctx context.Context, backupID, actor string) (*Restore, error) {
+	b, err := s.Get(ctx, backupID)
+	if err != nil {
+		return nil, err
+	}
+	if b.Status != StatusCompleted {
+		return nil, fmt.Errorf("backup %s is %s", b.ID, b.Status)
+	}
+	sc, err := s.school(ctx, s.db, b.SchoolID, false)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Restore{
+		BackupID:   b.ID,
+		SchoolID:   sc.id,
+		SchoolCode: sc.code,
+		DBName:     fmt.Sprintf("%s_restore_%s", tenant.DatabaseName(sc.code), time.Now().UTC().Format("20060102150405")),
+		Status:     RestoreRunning,
+		Actor:      actor,
+	}
+	err = s.db.QueryRow(ctx, `
+	INSERT INTO tenant_restores (backup_id, school_id, school_code, db_name, status, actor)
+	VALUES ($1, $2, $3, $4, $5, $6) RETURNING id::text, created_at`,
+		b.ID, sc.id, sc.code, r.DBName, RestoreRunning, actor,
+	).Scan(&r.ID, &r.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record restore: %w", err)
+	}
+
+	// The restored database is created next to the school's
+	admin, err := s.tm.HostAdmin(ctx, sc.dbHost, sc.dbPort)
+	if err != nil {
+		return nil, err
+	}
+	defer admin.Close()
+
+	if err := s.restore(ctx, admin, sc, b, r); err != nil {
+		r.Status, r.Error = RestoreFailed, err.Error()
+		bg := context.WithoutCancel(ctx)
+		_ = s.tm.DropTenantDatabase(bg, admin, r.DBName, r.DBName)
+		_, _ = s.db.Exec(bg, `
+		UPDATE tenant_restores SET status = $2, error = $3, completed_at = NOW() WHERE id = $1`,
+			r.ID, RestoreFailed, r.Error)
+		return r, err
+	}
+
+	err = s.db.QueryRow(ctx, `
+	UPDATE tenant_restores SET status = $2, table_counts = $3, completed_at = NOW()
+	WHERE id = $1 RETURNING completed_at`, r.ID, RestoreRestored, r.TableCounts,
+	).Scan(&r.CompletedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record restore: %w", err)
+	}
+	r.Status = RestoreRestored
+	return r, nil
+}
+
+// restore creates r's database with admin, loads the archive and counts its
+// rows
+func (s *Service) restore(ctx context.Context, admin *pgxpool.Pool, sc *school, b *Backup, r *Restore) error {
+	if err := s.tm.CreateTenantDatabase(ctx, admin, sc.code, r.DBName, sc.dbUser, sc.password); err != nil {
+		return err
+	}
+
+	archive, err := s.storage.Get(ctx, b.StorageKey)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+	sum := sha256.New()
+	dec, err := newDecryptReader(io.TeeReader(archive, sum), s.keys)
+	if err != nil {
+		return fmt.Errorf("archive encrypted with key %q: %w", b.KeyID, err)
+	}
+
+	// The objects belong to the school's user, as in its database
+	cmd := exec.CommandContext(ctx, s.cfg.PGRestore,
+		"--no-owner", "--no-privileges", "--exit-on-error", "--dbname="+r.DBName)
+	cmd.Env = s.pgEnv(sc, r.DBName)
+	cmd.Stdin = dec
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("pg_restore failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	// pg_restore may stop reading before the end of the archive
+	if _, err := io.Copy(io.Discard, dec); err != nil {
+		return err
+	}
+	if got := hex.EncodeToString(sum.Sum(nil)); got != b.SHA256 {
+		return fmt.Errorf("%w: checksum %s, catalog has %s", ErrCorrupt, got, b.SHA256)
+	}
+
+	r.TableCounts, err = s.countRows(ctx, sc, r.DBName)
+	return err
+}
+
+// countRows returns the exact row count of every table of the database
+func (s *Service) countRows(ctx context.Context, sc *school, dbName string) (map[string]int64, error) {
+	dsn := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(sc.dbUser, sc.password),
+		Host:     net.JoinHostPort(sc.dbHost, strconv.Itoa(sc.dbPort)),
+		Path:     "/" + dbName,
+		RawQuery: url.Values{"sslmode": {s.cfg.SSLMode}}.Encode(),
+	}
+	conn, err := pgx.Connect(ctx, dsn.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to restored database: %w", err)
+	}
+	defer conn.Close(context.WithoutCancel(ctx))
+
+	rows, err := conn.Query(ctx, `
+	SELECT schemaname, tablename FROM pg_catalog.pg_tables
+	WHERE schemaname NOT IN ('pg_catalog', 'information_schema') ORDER BY 1, 2`)
+	if err != nil {
+		return nil, err
+	}
+	tables, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (pgx.Identifier, error) {
+		var schema, table string
+		err := row.Scan(&schema, &table)
+		return pgx.Identifier{schema, table}, err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int64, len(tables))
+	for _, table := range tables {
+		var n int64
+		if err := conn.QueryRow(ctx, `SELECT count(*) FROM `+table.Sanitize()).Scan(&n); err != nil {
+			return nil, fmt.Errorf("failed to count %s: %w", table.Sanitize(), err)
+		}
+		counts[strings.Join(table, ".")] = n
+	}
+	return counts, nil
+}
+
+// GetRestore returns a restore; pgx.ErrNoRows if there is none
+func (s *Service) GetRestore(ctx context.Context, id string) (*Restore, error) {
+	var r Restore
+	err := s.db.QueryRow(ctx, `
+	SELECT id::text, backup_id::text, school_id::text, school_code, db_name, status, table_counts,
+		COALESCE(error, ''), COALESCE(replaced_db_name, ''), actor, created_at, completed_at, swapped_at
+	FROM tenant_restores WHERE id::text = $1`, id,
+	).Scan(&r.ID, &r.BackupID, &r.SchoolID, &r.SchoolCode, &r.DBName, &r.Status, &r.TableCounts,
+		&r.Error, &r.ReplacedDBName, &r.Actor, &r.CreatedAt, &r.CompletedAt, &r.SwappedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// Swap makes a restored database the school's database and records why in
+// the school's audit log. The replaced database is kept until DropReplaced.
+// Services open a pool on the new database on the school's next request.
+func (s *Service) Swap(ctx context.Context, restoreID, actor, reason string) (*Restore, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var schoolID, dbName, status string
+	err = tx.QueryRow(ctx, `SELECT school_id::text, db_name, status FROM tenant_restores WHERE id::text = $1 FOR UPDATE`,
+		restoreID).Scan(&schoolID, &dbName, &status)
+	if err != nil {
+		return nil, err
+	}
+	if status != RestoreRestored {
+		return nil, fmt.Errorf("%w: restore is %s", ErrState, status)
+	}
+	sc, err := s.school(ctx, tx, schoolID, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec(ctx, `UPDATE schools SET db_name = $2 WHERE id = $1`, sc.id, dbName); err != nil {
+		return nil, fmt.Errorf("failed to switch database: %w", err)
+	}
+	_, err = tx.Exec(ctx, `
+	UPDATE tenant_restores SET status = $2, replaced_db_name = $3, swapped_at = NOW() WHERE id::text = $1`,
+		restoreID, RestoreSwapped, sc.dbName)
+	if err != nil {
+		return nil, err
+	}
+	err = audit(ctx, tx, sc.id, actor, "database_swapped", map[string]any{
+		"restore_id": restoreID,
+		"db_name":    dbName,
+		"replaced":   sc.dbName,
+		"reason":     reason,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	s.tm.CloseConnection(sc.code)
+	return s.GetRestore(ctx, restoreID)
+}
+
+// Discard drops a restored database that was not swapped in
+func (s *Service) Discard(ctx context.Context, restoreID string) error {
+	r, err := s.GetRestore(ctx, restoreID)
+	if err != nil {
+		return err
+	}
+	if r.Status != RestoreRestored && r.Status != RestoreFailed {
+		return fmt.Errorf("%w: restore is %s", ErrState, r.Status)
+	}
+	if err := s.dropDatabase(ctx, r.SchoolID, r.DBName); err != nil {
+		return err
+	}
+	_, err = s.db.Exec(ctx, `UPDATE tenant_restores SET status = $2 WHERE id = $1`, r.ID, RestoreDiscarded)
+	return err
+}
+
+// DropReplaced drops the database a swap replaced, once the restored one is
+// known to be good
+func (s *Service) DropReplaced(ctx context.Context, restoreID, actor string) error {
+	r, err := s.GetRestore(ctx, restoreID)
+	if err != nil {
+		return err
+	}
+	if r.Status != RestoreSwapped || r.ReplacedDBName == "" {
+		return fmt.Errorf("%w: restore is %s", ErrState, r.Status)
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	// Never drop the database the school uses, e.g. after swapping back
+	var inUse bool
+	if err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM schools WHERE db_name = $1)`, r.ReplacedDBName).Scan(&inUse); err != nil {
+		return err
+	}
+	if inUse {
+		return fmt.Errorf("%w: database %s is in use", ErrState, r.ReplacedDBName)
+	}
+	if _, err := tx.Exec(ctx, `UPDATE tenant_restores SET replaced_db_name = NULL WHERE id = $1`, r.ID); err != nil {
+		return err
+	}
+	err = audit(ctx, tx, r.SchoolID, actor, "database_dropped", map[string]any{"restore_id": r.ID, "db_name": r.ReplacedDBName})
+	if err != nil {
+		return err
+	}
+	// DROP DATABASE cannot run in a transaction: drop after recording it
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+	return s.dropDatabase(ctx, r.SchoolID, r.ReplacedDBName)
+}
+
+// dropDatabase drops a database of the school on the server of the school's
+// database
+func (s *Service) dropDatabase(ctx context.Context, schoolID, dbName string) error {
+	var host string
+	var port int
+	if err := s.db.QueryRow(ctx, `SELECT db_host, db_port FROM schools WHERE id::text = $1`, schoolID).Scan(&host, &port); err != nil {
+		return fmt.Errorf("failed to find the school's database host: %w", err)
+	}
+	admin, err := s.tm.HostAdmin(ctx, host, port)
+	if err != nil {
+		return err
+	}
+	defer admin.Close()
+	return s.tm.DropTenantDatabase(ctx, admin, dbName, dbName)
+}
+
+func audit(ctx context.Context, tx pgx.Tx, schoolID, actor, action string, details map[string]any) error {
+	_, err := tx.Exec(ctx, `
+	INSERT INTO school_audit_log (school_id, actor, action, details) VALUES ($1, $2, $3, $4)`,
+		schoolID, actor, action, details)
+	if err != nil {
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	return nil
+}
+
+// Prune deletes expired archives, keeping the KeepMin newest completed
+// backups of every school, and returns how many were deleted
+func (s *Service) Prune(ctx context.Context) (int, error) {
+	rows, err := s.db.Query(ctx, `
+	SELECT id::text, storage_key FROM (
+		SELECT id, storage_key, status, expires_at, completed_at,
+			row_number() OVER (PARTITION BY school_id, status = $1 ORDER BY started_at DESC) AS n
+		FROM tenant_backups
+	) b
+	WHERE (status = $1 AND expires_at < NOW() AND n > $2)
+		OR (status = $3 AND completed_at < NOW() - make_interval(secs => $4))`,
+		StatusCompleted, s.cfg.KeepMin, StatusFailed, s.cfg.Retention.Seconds())
+	if err != nil {
+		return 0, err
+	}
+	type expired struct{ id, key string }
+	backups, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (expired, error) {
+		var e expired
+		err := row.Scan(&e.id, &e.key)
+		return e, err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	pruned := 0
+	for _, b := range backups {
+		if b.key != "" {
+			if err := s.storage.Delete(ctx, b.key); err != nil {
+				return pruned, fmt.Errorf("failed to delete %s: %w", b.key, err)
+			}
+		}
+		if _, err := s.db.Exec(ctx, `DELETE FROM tenant_backups WHERE id::text = $1`, b.id); err != nil {
+			return pruned, err
+		}
+		pruned++
+	}
+	return pruned, nil
+}
@@ -0,0 +1,152 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"os"
+	"testing"
+
+	"school-erp/pkg/tenant"
+)
+
+const (
+	testKey1 = "k1:hex:0101010101010101010101010101010101010101010101010101010101010101"
+	testKey2 = "k2:hex:0202020202020202020202020202020202020202020202020202020202020202"
+	testKey3 = "k3:hex:0303030303030303030303030303030303030303030303030303030303030303"
+)
+
+func testKeyring(t *testing.T, spec string) *tenant.Keyring {
+	t.Helper()
+	keys, err := tenant.ParseKeyring(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keys
+}
+
+func encrypt(t *testing.T, keys *tenant.Keyring, plain []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	enc, err := newEncryptWriter(&buf, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Odd-sized writes cross chunk boundaries
+	for p := plain; len(p) > 0; {
+		n := min(len(p), 10007)
+		if _, err := enc.Write(p[:n]); err != nil {
+			t.Fatal(err)
+		}
+		p = p[n:]
+	}
+	if err := enc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func decrypt(keys *tenant.Keyring, archive []byte) ([]byte, error) {
+	dec, err := newDecryptReader(bytes.NewReader(archive), keys)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(dec)
+}
+
+func TestArchiveEncryption(t *testing.T) {
+	keys := testKeyring(t, testKey2+","+testKey1)
+
+	for _, size := range []int{0, 1, chunkSize, 3*chunkSize + 17} {
+		plain := make([]byte, size)
+		rand.Read(plain)
+		archive := encrypt(t, keys, plain)
+
+		got, err := decrypt(keys, archive)
+		if err != nil {
+			t.Fatalf("size %d: %v", size, err)
+		}
+		if !bytes.Equal(got, plain) {
+			t.Fatalf("size %d: round trip changed the data", size)
+		}
+
+		if size > chunkSize {
+			// Dropping the last chunk makes the one before it look last
+			if _, err := decrypt(keys, archive[:len(archive)-(17+16)]); !errors.Is(err, ErrCorrupt) {
+				t.Errorf("size %d: truncated archive: %v", size, err)
+			}
+			tampered := bytes.Clone(archive)
+			tampered[len(tampered)/2] ^= 1
+			if _, err := decrypt(keys, tampered); !errors.Is(err, ErrCorrupt) {
+				t.Errorf("size %d: tampered archive: %v", size, err)
+			}
+		}
+	}
+
+	// Archives of an older key decrypt while it is in the keyring
+	old := encrypt(t, testKeyring(t, testKey1), []byte("dump"))
+	if got, err := decrypt(keys, old); err != nil || string(got) != "dump" {
+		t.Errorf("archive of older key = %q, %v", got, err)
+	}
+	if _, err := decrypt(testKeyring(t, testKey3), old); !errors.Is(err, tenant.ErrUnknownKey) {
+		t.Errorf("archive of unknown key: %v", err)
+	}
+}
+
+func testStorage(t *testing.T, storage Storage) {
+	ctx := context.Background()
+	data := bytes.Repeat([]byte("archive"), 1000)
+	if err := storage.Put(ctx, "eis/test.dump.enc", bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	r, err := storage.Get(ctx, "eis/test.dump.enc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(r)
+	r.Close()
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("Get = %d bytes, %v", len(got), err)
+	}
+
+	if err := storage.Delete(ctx, "eis/test.dump.enc"); err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.Delete(ctx, "eis/test.dump.enc"); err != nil {
+		t.Errorf("deleting a missing archive: %v", err)
+	}
+	if _, err := storage.Get(ctx, "eis/test.dump.enc"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get of deleted archive: %v", err)
+	}
+	if err := storage.Put(ctx, "../escape", bytes.NewReader(data)); err == nil {
+		t.Error("key outside the storage was accepted")
+	}
+}
+
+func TestLocalStorage(t *testing.T) {
+	testStorage(t, NewLocalStorage(t.TempDir()))
+}
+
+// TestS3Storage runs against an S3-compatible server, e.g.
+//
+//	docker run -p 9000:9000 minio/minio server /data
+//	BACKUP_TEST_S3_ENDPOINT=localhost:9000 BACKUP_TEST_S3_BUCKET=backups \
+//	BACKUP_TEST_S3_ACCESS_KEY=minioadmin BACKUP_TEST_S3_SECRET_KEY=minioadmin go test ./backup
+func TestS3Storage(t *testing.T) {
+	endpoint := os.Getenv("BACKUP_TEST_S3_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("BACKUP_TEST_S3_ENDPOINT is not set")
+	}
+	storage, err := NewS3Storage(context.Background(), S3Config{
+		Endpoint:  endpoint,
+		Bucket:    os.Getenv("BACKUP_TEST_S3_BUCKET"),
+		AccessKey: os.Getenv("BACKUP_TEST_S3_ACCESS_KEY"),
+		SecretKey: os.Getenv("BACKUP_TEST_S3_SECRET_KEY"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStorage(t, storage)
+}
@@ -0,0 +1,186 @@
+package backup
+
+import (
+	"bufio"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"school-erp/pkg/tenant"
+)
+
+// An archive is encrypted in chunks so that it can be streamed:
+//
+//	magic | key ID length (1 byte) | key ID | nonce prefix (7 bytes)
+//	chunk*  each chunkSize bytes of plaintext sealed with AES-GCM
+//
+// A chunk's nonce is the prefix, its 4-byte index and a byte that is 1 for
+// the last chunk, so chunks cannot be reordered, dropped or appended. The
+// header is the additional data of every chunk.
+const (
+	magic       = "SERPBAK1"
+	chunkSize   = 64 << 10
+	prefixSize  = 7
+	maxKeyIDLen = 255
+)
+
+// ErrCorrupt is returned for archives that fail authentication
+var ErrCorrupt = errors.New("backup archive is corrupt or was not written by this keyring")
+
+func chunkNonce(prefix []byte, index uint32, last bool) []byte {
+	nonce := make([]byte, 12)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[prefixSize:], index)
+	if last {
+		nonce[11] = 1
+	}
+	return nonce
+}
+
+// encryptWriter encrypts an archive with the keyring's primary key. Close
+// writes the last chunk; it does not close the underlying writer.
+type encryptWriter struct {
+	w      io.Writer
+	aead   cipher.AEAD
+	header []byte
+	prefix []byte
+	buf    []byte
+	index  uint32
+}
+
+func newEncryptWriter(w io.Writer, keys *tenant.Keyring) (*encryptWriter, error) {
+	id := keys.Primary()
+	if len(id) > maxKeyIDLen {
+		return nil, fmt.Errorf("key ID %q is too long", id)
+	}
+	aead, err := keys.AEAD(id)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := make([]byte, prefixSize)
+	if _, err := io.ReadFull(rand.Reader, prefix); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	header := append([]byte(magic), byte(len(id)))
+	header = append(header, id...)
+	header = append(header, prefix...)
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+	return &encryptWriter{w: w, aead: aead, header: header, prefix: prefix, buf: make([]byte, 0, chunkSize+1)}, nil
+}
+
+func (e *encryptWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		// A full chunk is only sealed once more data follows it, so that the
+		// last chunk is always sealed by Close
+		if len(e.buf) == chunkSize {
+			if err := e.seal(false); err != nil {
+				return n - len(p), err
+			}
+		}
+		take := chunkSize - len(e.buf)
+		if take > len(p) {
+			take = len(p)
+		}
+		e.buf = append(e.buf, p[:take]...)
+		p = p[take:]
+	}
+	return n, nil
+}
+
+func (e *encryptWriter) seal(last bool) error {
+	sealed := e.aead.Seal(nil, chunkNonce(e.prefix, e.index, last), e.buf, e.header)
+	e.index++
+	e.buf = e.buf[:0]
+	_, err := e.w.Write(sealed)
+	return err
+}
+
+func (e *encryptWriter) Close() error {
+	return e.seal(true)
+}
+
+// decryptReader decrypts an archive with the keyring key it names
+type decryptReader struct {
+	r      *bufio.Reader
+	aead   cipher.AEAD
+	header []byte
+	prefix []byte
+	frame  []byte
+	plain  []byte
+	index  uint32
+	done   bool
+}
+
+func newDecryptReader(r io.Reader, keys *tenant.Keyring) (*decryptReader, error) {
+	br := bufio.NewReaderSize(r, chunkSize+64)
+	header := make([]byte, len(magic)+1)
+	if _, err := io.ReadFull(br, header); err != nil || string(header[:len(magic)]) != magic {
+		return nil, fmt.Errorf("%w: missing header", ErrCorrupt)
+	}
+	rest := make([]byte, int(header[len(magic)])+prefixSize)
+	if _, err := io.ReadFull(br, rest); err != nil {
+		return nil, fmt.Errorf("%w: missing header", ErrCorrupt)
+	}
+	header = append(header, rest...)
+	id := string(rest[:len(rest)-prefixSize])
+
+	aead, err := keys.AEAD(id)
+	if err != nil {
+		return nil, err
+	}
+	return &decryptReader{
+		r:      br,
+		aead:   aead,
+		header: header,
+		prefix: rest[len(rest)-prefixSize:],
+		frame:  make([]byte, chunkSize+aead.Overhead()),
+	}, nil
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for len(d.plain) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+		if err := d.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, d.plain)
+	d.plain = d.plain[n:]
+	return n, nil
+}
+
+func (d *decryptReader) next() error {
+	n, err := io.ReadFull(d.r, d.frame)
+	last := false
+	switch {
+	case errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, io.EOF):
+		last = true
+	case err != nil:
+		return err
+	default:
+		// A full frame is the last one when nothing follows it
+		if _, err := d.r.Peek(1); errors.Is(err, io.EOF) {
+			last = true
+		} else if err != nil {
+			return err
+		}
+	}
+
+	plain, err := d.aead.Open(nil, chunkNonce(d.prefix, d.index, last), d.frame[:n], d.header)
+	if err != nil {
+		return fmt.Errorf("%w: chunk %d", ErrCorrupt, d.index)
+	}
+	d.index++
+	d.plain = plain
+	d.done = last
+	return nil
+}
@@ -0,0 +1,193 @@
+// Command backup backs up and restores dedicated schools' databases.
+//
+//	backup create  -school CODE
+//	backup list    -school CODE
+//	backup restore -school CODE [-at RFC3339] | -id BACKUP_ID
+//	backup swap    -id RESTORE_ID -reason TEXT
+//	backup discard -id RESTORE_ID
+//	backup drop-replaced -id RESTORE_ID
+//	backup prune
+//
+// A restore goes into a new database and prints its row counts; swap makes
+// it the school's database. Every subcommand takes -actor, which defaults
+// to $USER and is recorded in the catalog and the school's audit log.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"school-erp/pkg/tenant"
+	"school-erp/school/backup"
+	"school-erp/school/config"
+	"school-erp/school/database"
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: backup create|list|restore|swap|discard|drop-replaced|prune [flags]")
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	command := os.Args[1]
+
+	flags := flag.NewFlagSet(command, flag.ExitOnError)
+	code := flags.String("school", "", "school code")
+	id := flags.String("id", "", "backup ID for restore; restore ID for swap, discard and drop-replaced")
+	at := flags.String("at", "", "restore the last backup taken at or before this RFC3339 time")
+	reason := flags.String("reason", "", "why the school's database is swapped")
+	actor := flags.String("actor", os.Getenv("USER"), "who runs the command")
+	_ = flags.Parse(os.Args[2:])
+	if *actor == "" {
+		log.Fatal("-actor is required")
+	}
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v\n", err)
+	}
+	strict := strings.EqualFold(cfg.Environment, "production")
+
+	keys, err := tenant.LoadKeyring(cfg.EncryptionKey, strict)
+	if err != nil {
+		log.Fatalf("Invalid ENCRYPTION_KEY: %v", err)
+	}
+	backupKeys := keys
+	if cfg.BackupEncryptionKey != "" {
+		if backupKeys, err = tenant.LoadKeyring(cfg.BackupEncryptionKey, strict); err != nil {
+			log.Fatalf("Invalid BACKUP_ENCRYPTION_KEY: %v", err)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	storage, err := backup.NewStorage(ctx, cfg.BackupStorage, cfg.BackupDir, cfg.BackupS3())
+	if err != nil {
+		log.Fatalf("Failed to open backup storage: %v", err)
+	}
+
+	db, err := database.InitDB(cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize main database: %v\n", err)
+	}
+	defer db.Close()
+	if err := database.RunMigrations(db); err != nil {
+		log.Fatalf("Failed to run migrations: %v\n", err)
+	}
+
+	tm := tenant.NewTenantManager(keys, tenant.PoolLimits{MaxConns: 2}, tenant.Admin{
+		Host:     cfg.MainDBHost,
+		Port:     cfg.MainDBPort,
+		User:     cfg.MainDBUser,
+		Password: cfg.MainDBPassword,
+		SSLMode:  cfg.MainDBSSLMode,
+	})
+	defer tm.CloseAllConnections()
+
+	svc := backup.NewService(db, tm, storage, backupKeys, backup.Config{
+		PGDump:    cfg.PGDumpPath,
+		PGRestore: cfg.PGRestorePath,
+		SSLMode:   cfg.MainDBSSLMode,
+		Retention: cfg.BackupRetention,
+		KeepMin:   cfg.BackupKeepMin,
+	})
+
+	if err := run(ctx, svc, command, *code, *id, *at, *reason, *actor); err != nil {
+		log.Fatalf("%s: %v", command, err)
+	}
+}
+
+func run(ctx context.Context, svc *backup.Service, command, code, id, at, reason, actor string) error {
+	switch command {
+	case "create":
+		if code == "" {
+			return fmt.Errorf("-school is required")
+		}
+		b, err := svc.Backup(ctx, code, actor)
+		if err != nil {
+			return err
+		}
+		return printJSON(b)
+
+	case "list":
+		if code == "" {
+			return fmt.Errorf("-school is required")
+		}
+		backups, err := svc.List(ctx, code)
+		if err != nil {
+			return err
+		}
+		return printJSON(backups)
+
+	case "restore":
+		var r *backup.Restore
+		var err error
+		switch {
+		case id != "":
+			r, err = svc.Restore(ctx, id, actor)
+		case code != "":
+			t := time.Now()
+			if at != "" {
+				if t, err = time.Parse(time.RFC3339, at); err != nil {
+					return fmt.Errorf("invalid -at: %w", err)
+				}
+			}
+			r, err = svc.RestoreAt(ctx, code, t, actor)
+		default:
+			return fmt.Errorf("-id or -school is required")
+		}
+		if err != nil {
+			return err
+		}
+		return printJSON(r)
+
+	case "swap":
+		if id == "" || reason == "" {
+			return fmt.Errorf("-id and -reason are required")
+		}
+		r, err := svc.Swap(ctx, id, actor, reason)
+		if err != nil {
+			return err
+		}
+		return printJSON(r)
+
+	case "discard":
+		if id == "" {
+			return fmt.Errorf("-id is required")
+		}
+		return svc.Discard(ctx, id)
+
+	case "drop-replaced":
+		if id == "" {
+			return fmt.Errorf("-id is required")
+		}
+		return svc.DropReplaced(ctx, id, actor)
+
+	case "prune":
+		n, err := svc.Prune(ctx)
+		if err != nil {
+			return err
+		}
+		log.Printf("Pruned %d backups", n)
+		return nil
+	}
+	usage()
+	return nil
+}
+
+func printJSON(v any) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
@@ -0,0 +1,103 @@
+// Command rekey re-encrypts every school's database password with the
+// primary key of ENCRYPTION_KEY. Run it after adding a new key in front of
+// the old one; once it reports nothing left to rotate, the old key can be
+// removed from every service.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"strings"
+
+	"school-erp/pkg/tenant"
+	"school-erp/school/config"
+	"school-erp/school/database"
+)
+
+func main() {
+	dryRun := flag.Bool("dry-run", false, "report what would be re-encrypted without writing")
+	flag.Parse()
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v\n", err)
+	}
+
+	keys, err := tenant.LoadKeyring(cfg.EncryptionKey, strings.EqualFold(cfg.Environment, "production"))
+	if err != nil {
+		log.Fatalf("Invalid ENCRYPTION_KEY: %v", err)
+	}
+
+	db, err := database.InitDB(cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize main database: %v\n", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	rows, err := db.Query(ctx, `SELECT id::text, code, db_password FROM schools WHERE db_password <> ''`)
+	if err != nil {
+		log.Fatalf("Failed to list schools: %v", err)
+	}
+	type school struct{ id, code, password string }
+	var schools []school
+	for rows.Next() {
+		var s school
+		if err := rows.Scan(&s.id, &s.code, &s.password); err != nil {
+			log.Fatalf("Failed to read school: %v", err)
+		}
+		schools = append(schools, s)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		log.Fatalf("Failed to list schools: %v", err)
+	}
+
+	var current, rotated, failed int
+	for _, s := range schools {
+		if !keys.NeedsRotation(s.password) {
+			current++
+			continue
+		}
+		plaintext, err := keys.Decrypt(s.password)
+		if err != nil {
+			log.Printf("%s: cannot decrypt (key %q): %v", s.code, tenant.KeyID(s.password), err)
+			failed++
+			continue
+		}
+		if *dryRun {
+			log.Printf("%s: would re-encrypt from key %q to %q", s.code, tenant.KeyID(s.password), keys.Primary())
+			rotated++
+			continue
+		}
+		encrypted, err := keys.Encrypt(plaintext)
+		if err != nil {
+			log.Fatalf("%s: %v", s.code, err)
+		}
+
+		// Skip rows changed since they were read, e.g. by a credential rotation
+		tag, err := db.Exec(ctx, `UPDATE schools SET db_password = $2 WHERE id = $1 AND db_password = $3`, s.id, encrypted, s.password)
+		if err != nil {
+			log.Printf("%s: update failed: %v", s.code, err)
+			failed++
+			continue
+		}
+		if tag.RowsAffected() == 0 {
+			log.Printf("%s: changed concurrently, run again", s.code)
+			failed++
+			continue
+		}
+		log.Printf("%s: re-encrypted from key %q to %q", s.code, tenant.KeyID(s.password), keys.Primary())
+		rotated++
+	}
+
+	verb := "re-encrypted"
+	if *dryRun {
+		verb = "to re-encrypt"
+	}
+	log.Printf("Primary key %q: %d current, %d %s, %d failed", keys.Primary(), current, rotated, verb, failed)
+	if failed > 0 {
+		log.Fatalf("%d schools were not re-encrypted; keep the old keys configured", failed)
+	}
+}
@@ -0,0 +1,145 @@
+// Command school moves a dedicated school between clusters.
+//
+//	school export [-o FILE] CODE
+//	school import [-db-host HOST] [-db-port PORT] FILE
+//
+// Export runs with the source cluster's configuration and import with the
+// target's. Import creates the school's database on -db-host, which
+// defaults to DB_HOST, as DB_USER. Uploaded files are read from and written
+// to the file storage of the configuration (STORAGE_KIND and the like).
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"school-erp/pkg/storage"
+	"school-erp/pkg/tenant"
+	"school-erp/school/config"
+	"school-erp/school/database"
+	"school-erp/school/transfer"
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: school export [-o FILE] CODE | school import [-db-host HOST] [-db-port PORT] FILE")
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	command := os.Args[1]
+
+	flags := flag.NewFlagSet(command, flag.ExitOnError)
+	output := flags.String("o", "", "archive to write; default CODE-<time>.tar.gz")
+	dbHost := flags.String("db-host", "", "host of the imported school's database; default DB_HOST")
+	dbPort := flags.Int("db-port", 0, "port of the imported school's database; default DB_PORT")
+	actor := flags.String("actor", os.Getenv("USER"), "who runs the command")
+	_ = flags.Parse(os.Args[2:])
+	if flags.NArg() != 1 || (command != "export" && command != "import") {
+		usage()
+	}
+	if *actor == "" {
+		log.Fatal("-actor is required")
+	}
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v\n", err)
+	}
+	keys, err := tenant.LoadKeyring(cfg.EncryptionKey, strings.EqualFold(cfg.Environment, "production"))
+	if err != nil {
+		log.Fatalf("Invalid ENCRYPTION_KEY: %v", err)
+	}
+
+	db, err := database.InitDB(cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize main database: %v\n", err)
+	}
+	defer db.Close()
+	if err := database.RunMigrations(db); err != nil {
+		log.Fatalf("Failed to run migrations: %v\n", err)
+	}
+
+	admin := tenant.Admin{
+		Host:     cfg.MainDBHost,
+		Port:     cfg.MainDBPort,
+		User:     cfg.MainDBUser,
+		Password: cfg.MainDBPassword,
+		SSLMode:  cfg.MainDBSSLMode,
+	}
+	tm := tenant.NewTenantManager(keys, tenant.PoolLimits{MaxConns: 2}, admin)
+	defer tm.CloseAllConnections()
+	files, err := storage.Open(cfg.Storage())
+	if err != nil {
+		log.Fatalf("Failed to open file storage: %v\n", err)
+	}
+	svc := transfer.NewService(db, tm, keys, files)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	switch command {
+	case "export":
+		err = export(ctx, svc, flags.Arg(0), *output, *actor)
+	case "import":
+		if *dbHost != "" {
+			admin.Host = *dbHost
+		}
+		if *dbPort != 0 {
+			admin.Port = *dbPort
+		}
+		err = importArchive(ctx, svc, flags.Arg(0), transfer.Target{Admin: admin}, *actor)
+	}
+	if err != nil {
+		log.Fatalf("%s: %v", command, err)
+	}
+}
+
+func export(ctx context.Context, svc *transfer.Service, code, output, actor string) error {
+	if output == "" {
+		output = fmt.Sprintf("%s-%s.tar.gz", code, time.Now().UTC().Format("20060102T150405Z"))
+	}
+	f, err := os.OpenFile(output, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	m, err := svc.Export(ctx, code, f, actor)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(output)
+		return err
+	}
+
+	var rows int64
+	for _, t := range m.Tables {
+		rows += t.Rows
+	}
+	log.Printf("Exported %s to %s: %d tables, %d rows, %d files", code, output, len(m.Tables), rows, len(m.Uploads))
+	return nil
+}
+
+func importArchive(ctx context.Context, svc *transfer.Service, path string, target transfer.Target, actor string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	m, err := svc.Import(ctx, f, target, actor)
+	if err != nil {
+		return err
+	}
+	log.Printf("Imported %s (%s) onto %s:%d, exported %s", m.School.Code, m.School.Status,
+		target.Admin.Host, target.Admin.Port, m.ExportedAt.Format("2006-01-02 15:04:05Z07:00"))
+	return nil
+}
@@ -2,114 +2,175 @@ package config
 
 import (
 	"fmt"
-	"os"
-	"strconv"
+	"log"
+	"net/url"
 	"time"
+
+	pkgconfig "school-erp/pkg/config"
+	"school-erp/pkg/storage"
+	"school-erp/school/backup"
 )
 
 // Config holds the application configuration
 type Config struct {
 	// App
-	Port        int
-	Environment string
-	AppName     string
+	Port        int    `env:"PORT" default:"3011"`
+	Environment string `env:"ENVIRONMENT" default:"development"`
+	AppName     string `env:"APP_NAME" default:"School Management Service"`
 
 	// Main Database (Global DB)
-	MainDBHost     string
-	MainDBPort     int
-	MainDBName     string
-	MainDBUser     string
-	MainDBPassword string
-	MaxConnections int
-	MaxIdleConn    int
-	ConnMaxLifetime time.Duration
+	MainDBHost      string        `env:"DB_HOST" default:"postgres"`
+	MainDBPort      int           `env:"DB_PORT" default:"5432"`
+	MainDBName      string        `env:"DB_NAME" default:"school_erp"`
+	MainDBUser      string        `env:"DB_USER" default:"postgres"`
+	MainDBPassword  string        `env:"DB_PASSWORD" default:"postgres" secret:"true"`
+	MainDBSSLMode   string        `env:"DB_SSL_MODE" default:"disable"`
+	MaxConnections  int           `env:"MAX_CONNECTIONS" default:"25"`
+	MaxIdleConn     int           `env:"MAX_IDLE_CONN" default:"5"`
+	ConnMaxLifetime time.Duration `env:"CONN_MAX_LIFETIME" default:"5m"`
+
+	// Tenant databases. Each school's pool reserves TenantMaxConns of
+	// TenantMaxTotalConns; least recently used idle pools make room.
+	TenantMaxConns            int           `env:"TENANT_MAX_CONNECTIONS" default:"10"`
+	TenantMaxTotalConns       int           `env:"TENANT_MAX_TOTAL_CONNECTIONS" default:"100"`
+	TenantConnMaxLifetime     time.Duration `env:"TENANT_CONN_MAX_LIFETIME" default:"5m"`
+	TenantConnMaxIdleTime     time.Duration `env:"TENANT_CONN_MAX_IDLE_TIME" default:"1m"`
+	TenantPoolIdleTimeout     time.Duration `env:"TENANT_POOL_IDLE_TIMEOUT" default:"10m"`
+	TenantHealthCheckInterval time.Duration `env:"TENANT_HEALTH_CHECK_INTERVAL" default:"30s"`
 
 	// Cache (Redis)
-	RedisHost string
-	RedisPort int
-	RedisDB   int
+	RedisHost string `env:"REDIS_HOST" default:"redis"`
+	RedisPort int    `env:"REDIS_PORT" default:"6379"`
+	RedisDB   int    `env:"REDIS_DB" default:"0"`
 
 	// Security
-	EncryptionKey string
-	JWTSecret     string
+	EncryptionKey string `env:"ENCRYPTION_KEY" default:"default-key-change-in-production" secret:"true"`
+	JWTSecret     string `env:"JWT_SECRET" default:"your-super-secret-jwt-key" secret:"true"`
+
+	// Provisioning worker
+	ProvisionInterval    time.Duration `env:"PROVISION_INTERVAL" default:"2s"`
+	ProvisionLease       time.Duration `env:"PROVISION_LEASE" default:"10m"`
+	ProvisionMaxAttempts int           `env:"PROVISION_MAX_ATTEMPTS" default:"5"`
+	ProvisionBackoff     time.Duration `env:"PROVISION_BACKOFF" default:"10s"`
+
+	// Scheduled credential rotation of dedicated schools; 0 disables it
+	CredentialRotationInterval time.Duration `env:"CREDENTIAL_ROTATION_INTERVAL" default:"1h"`
+	CredentialMaxAge           time.Duration `env:"CREDENTIAL_MAX_AGE" default:"2160h"`
+
+	// Deleted schools are purged, after a final backup, once the grace
+	// period has passed; a PURGE_INTERVAL of 0 disables the purge job
+	SchoolDeleteGracePeriod time.Duration `env:"SCHOOL_DELETE_GRACE_PERIOD" default:"720h"`
+	PurgeInterval           time.Duration `env:"PURGE_INTERVAL" default:"1h"`
+
+	// Usage metering: database sizes of dedicated schools are sampled every
+	// USAGE_SAMPLE_INTERVAL and past months closed into statements every
+	// STATEMENT_INTERVAL; 0 disables either
+	UsageSampleInterval time.Duration `env:"USAGE_SAMPLE_INTERVAL" default:"6h"`
+	StatementInterval   time.Duration `env:"STATEMENT_INTERVAL" default:"1h"`
+
+	// Uploaded files: logos here, student documents and fee receipts in
+	// their services. Every service uses the same store and FILE_URL_SECRET;
+	// with local storage they mount the same STORAGE_DIR. Uploads are scanned
+	// with the clamd daemon at CLAMD_ADDR when it is set.
+	StorageKind        string        `env:"STORAGE_KIND" default:"local"`
+	StorageDir         string        `env:"STORAGE_DIR" default:"/app/uploads"`
+	StorageS3Endpoint  string        `env:"STORAGE_S3_ENDPOINT"`
+	StorageS3Region    string        `env:"STORAGE_S3_REGION"`
+	StorageS3Bucket    string        `env:"STORAGE_S3_BUCKET"`
+	StorageS3AccessKey string        `env:"STORAGE_S3_ACCESS_KEY"`
+	StorageS3SecretKey string        `env:"STORAGE_S3_SECRET_KEY" secret:"true"`
+	StorageS3UseSSL    bool          `env:"STORAGE_S3_USE_SSL" default:"true"`
+	FileURLSecret      string        `env:"FILE_URL_SECRET" default:"change-me" secret:"true"`
+	FileURLTTL         time.Duration `env:"FILE_URL_TTL" default:"15m"`
+	ClamdAddr          string        `env:"CLAMD_ADDR"`
+
+	// Tenant backups (see cmd/backup). Archives are encrypted with
+	// BACKUP_ENCRYPTION_KEY, a keyring like ENCRYPTION_KEY, or with
+	// ENCRYPTION_KEY when it is empty.
+	BackupStorage       string        `env:"BACKUP_STORAGE" default:"local"`
+	BackupDir           string        `env:"BACKUP_DIR" default:"/var/lib/school-erp/backups"`
+	BackupS3Endpoint    string        `env:"BACKUP_S3_ENDPOINT"`
+	BackupS3Region      string        `env:"BACKUP_S3_REGION"`
+	BackupS3Bucket      string        `env:"BACKUP_S3_BUCKET"`
+	BackupS3AccessKey   string        `env:"BACKUP_S3_ACCESS_KEY"`
+	BackupS3SecretKey   string        `env:"BACKUP_S3_SECRET_KEY" secret:"true"`
+	BackupS3UseSSL      bool          `env:"BACKUP_S3_USE_SSL" default:"true"`
+	BackupEncryptionKey string        `env:"BACKUP_ENCRYPTION_KEY" secret:"true"`
+	BackupRetention     time.Duration `env:"BACKUP_RETENTION" default:"720h"`
+	BackupKeepMin       int           `env:"BACKUP_KEEP_MIN" default:"3"`
+	PGDumpPath          string        `env:"PG_DUMP_PATH" default:"pg_dump"`
+	PGRestorePath       string        `env:"PG_RESTORE_PATH" default:"pg_restore"`
 
 	// CORS
-	CORSAllowOrigins string
+	CORSAllowOrigins string `env:"CORS_ALLOW_ORIGINS" default:"http://localhost:3000,http://localhost:3001"`
+
+	// Expired idempotency keys are deleted this often; 0 disables it
+	IdempotencyPurgeInterval time.Duration `env:"IDEMPOTENCY_PURGE_INTERVAL" default:"1h"`
 }
 
-// LoadConfig loads configuration from environment variables
-func LoadConfig() *Config {
-	return &Config{
-		// App
-		Port:        getEnvInt("PORT", 3011),
-		Environment: getEnv("ENVIRONMENT", "development"),
-		AppName:     "School Management Service",
-
-		// Main Database
-		MainDBHost:     getEnv("DB_HOST", "postgres"),
-		MainDBPort:     getEnvInt("DB_PORT", 5432),
-		MainDBName:     getEnv("DB_NAME", "school_erp"),
-		MainDBUser:     getEnv("DB_USER", "postgres"),
-		MainDBPassword: getEnv("DB_PASSWORD", "postgres"),
-		MaxConnections: getEnvInt("MAX_CONNECTIONS", 25),
-		MaxIdleConn:    getEnvInt("MAX_IDLE_CONN", 5),
-		ConnMaxLifetime: time.Duration(getEnvInt("CONN_MAX_LIFETIME", 5)) * time.Minute,
-
-		// Cache
-		RedisHost: getEnv("REDIS_HOST", "redis"),
-		RedisPort: getEnvInt("REDIS_PORT", 6379),
-		RedisDB:   getEnvInt("REDIS_DB", 0),
-
-		// Security
-		EncryptionKey: getEnv("ENCRYPTION_KEY", "default-key-change-in-production"),
-		JWTSecret:     getEnv("JWT_SECRET", "your-super-secret-jwt-key"),
-
-		// CORS
-		CORSAllowOrigins: getEnv("CORS_ALLOW_ORIGINS", "http://localhost:3000,http://localhost:3001"),
+// LoadConfig loads configuration from defaults, CONFIG_FILE, environment
+// variables and *_FILE secrets, and prints the redacted result
+func LoadConfig() (*Config, error) {
+	cfg := &Config{}
+	report, err := pkgconfig.Load(cfg)
+	if err != nil {
+		return nil, err
 	}
+	report.Print(log.Writer(), cfg.AppName)
+	return cfg, nil
 }
 
 // GetMainDSN returns the main database connection string
 func (c *Config) GetMainDSN() string {
 	return fmt.Sprintf(
-		"postgres://%s:%s@%s:%d/%s?sslmode=disable",
-		c.MainDBUser,
-		c.MainDBPassword,
+		"postgres://%s@%s:%d/%s?sslmode=%s",
+		url.UserPassword(c.MainDBUser, c.MainDBPassword),
 		c.MainDBHost,
 		c.MainDBPort,
 		c.MainDBName,
+		c.MainDBSSLMode,
 	)
 }
 
 // GetTenantDSN returns a tenant-specific database connection string
 func (c *Config) GetTenantDSN(host string, port int, dbName, user, password string) string {
 	return fmt.Sprintf(
-		"postgres://%s:%s@%s:%d/%s?sslmode=disable",
-		user,
-		password,
+		"postgres://%s@%s:%d/%s?sslmode=%s",
+		url.UserPassword(user, password),
 		host,
 		port,
 		dbName,
+		c.MainDBSSLMode,
 	)
 }
 
-// Helper functions
-func getEnv(key, defaultValue string) string {
-	value := os.Getenv(key)
-	if value == "" {
-		return defaultValue
+// Storage returns the configuration of the file store
+func (c *Config) Storage() storage.Config {
+	return storage.Config{
+		Kind: c.StorageKind,
+		Dir:  c.StorageDir,
+		S3: storage.S3Config{
+			Endpoint:  c.StorageS3Endpoint,
+			Region:    c.StorageS3Region,
+			Bucket:    c.StorageS3Bucket,
+			AccessKey: c.StorageS3AccessKey,
+			SecretKey: c.StorageS3SecretKey,
+			UseSSL:    c.StorageS3UseSSL,
+		},
+		URLSecret: c.FileURLSecret,
+		URLTTL:    c.FileURLTTL,
+		ClamdAddr: c.ClamdAddr,
 	}
-	return value
 }
 
-func getEnvInt(key string, defaultValue int) int {
-	value := os.Getenv(key)
-	if value == "" {
-		return defaultValue
-	}
-	intVal, err := strconv.Atoi(value)
-	if err != nil {
-		return defaultValue
+// BackupS3 returns the bucket of BACKUP_STORAGE=s3
+func (c *Config) BackupS3() backup.S3Config {
+	return backup.S3Config{
+		Endpoint:  c.BackupS3Endpoint,
+		Region:    c.BackupS3Region,
+		Bucket:    c.BackupS3Bucket,
+		AccessKey: c.BackupS3AccessKey,
+		SecretKey: c.BackupS3SecretKey,
+		UseSSL:    c.BackupS3UseSSL,
 	}
-	return intVal
 }
@@ -0,0 +1,181 @@
+// Package credentials rotates the database passwords of dedicated schools.
+// A rotation changes the user's password on the server of the school's
+// database and stores it, encrypted, in the main database, committing both
+// together; services pick up the new password on the school's next request
+// and swap their cached pool.
+package credentials
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"school-erp/pkg/tenant"
+)
+
+var (
+	// ErrShared is returned for shared schools, which have no database user
+	ErrShared = errors.New("shared schools have no database credentials")
+	// ErrNotProvisioned is returned while a school's database user may not exist
+	ErrNotProvisioned = errors.New("school is not provisioned")
+	// ErrDeleted is returned for deleted schools, whose user is about to be dropped
+	ErrDeleted = errors.New("school is deleted")
+)
+
+// Rotation is the result of rotating a school's password
+type Rotation struct {
+	SchoolID  string    `json:"school_id"`
+	Code      string    `json:"code"`
+	KeyID     string    `json:"key_id"`
+	RotatedAt time.Time `json:"rotated_at"`
+}
+
+// Rotator rotates school database passwords
+type Rotator struct {
+	db *pgxpool.Pool
+	tm *tenant.TenantManager
+}
+
+func NewRotator(db *pgxpool.Pool, tm *tenant.TenantManager) *Rotator {
+	return &Rotator{db: db, tm: tm}
+}
+
+// Rotate gives the school a new database password. It returns
+// pgx.ErrNoRows for unknown schools.
+func (r *Rotator) Rotate(ctx context.Context, schoolID string) (*Rotation, error) {
+	return r.rotate(ctx, schoolID, 0)
+}
+
+// rotate rotates the school's password unless maxAge is positive and the
+// password is younger. It returns nil when nothing was rotated.
+func (r *Rotator) rotate(ctx context.Context, schoolID string, maxAge time.Duration) (*Rotation, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	// The row lock serializes rotations of the school across replicas
+	var code, tenancy, status, dbUser, dbHost string
+	var dbPort int
+	var due bool
+	err = tx.QueryRow(ctx, `
+	SELECT code, tenancy, status, db_user, db_host, db_port,
+		COALESCE(db_password_rotated_at, created_at) < NOW() - make_interval(secs => $2)
+	FROM schools WHERE id = $1 FOR UPDATE`, schoolID, maxAge.Seconds(),
+	).Scan(&code, &tenancy, &status, &dbUser, &dbHost, &dbPort, &due)
+	if err != nil {
+		return nil, err
+	}
+	if tenancy == tenant.Shared {
+		return nil, ErrShared
+	}
+	if status == "provisioning" || status == "failed" {
+		return nil, ErrNotProvisioned
+	}
+	if status == "deleted" || status == "purging" || status == "archived" {
+		return nil, ErrDeleted
+	}
+	if maxAge > 0 && !due {
+		return nil, nil
+	}
+
+	password, err := tenant.GeneratePassword()
+	if err != nil {
+		return nil, err
+	}
+	encrypted, err := r.tm.EncryptPassword(password)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt password: %w", err)
+	}
+	// The user is on the server of the school's database, which need not be
+	// the main database's. Its password changes in a transaction there,
+	// committed right after the main database's: should that commit fail,
+	// rotating again repairs the school.
+	admin, err := r.tm.HostAdmin(ctx, dbHost, dbPort)
+	if err != nil {
+		return nil, err
+	}
+	defer admin.Close()
+	hostTx, err := admin.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer hostTx.Rollback(ctx)
+	if err := r.tm.SetTenantPassword(ctx, hostTx, dbUser, password); err != nil {
+		return nil, err
+	}
+
+	rotation := &Rotation{SchoolID: schoolID, Code: code, KeyID: tenant.KeyID(encrypted)}
+	err = tx.QueryRow(ctx, `
+	UPDATE schools SET db_password = $2, db_password_rotated_at = NOW()
+	WHERE id = $1 RETURNING db_password_rotated_at`, schoolID, encrypted,
+	).Scan(&rotation.RotatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store password: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	if err := hostTx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to change password on %s: %w", dbHost, err)
+	}
+	return rotation, nil
+}
+
+// RotateDue rotates every dedicated school's password older than maxAge and
+// returns how many were rotated. A failed school is logged and skipped.
+func (r *Rotator) RotateDue(ctx context.Context, maxAge time.Duration) (int, error) {
+	rows, err := r.db.Query(ctx, `
+	SELECT id::text FROM schools
+	WHERE tenancy = 'dedicated' AND status IN ('active', 'inactive', 'suspended')
+		AND COALESCE(db_password_rotated_at, created_at) < NOW() - make_interval(secs => $1)
+	ORDER BY COALESCE(db_password_rotated_at, created_at)`, maxAge.Seconds())
+	if err != nil {
+		return 0, fmt.Errorf("failed to list schools: %w", err)
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return 0, fmt.Errorf("failed to list schools: %w", err)
+	}
+
+	rotated := 0
+	for _, id := range ids {
+		if ctx.Err() != nil {
+			return rotated, ctx.Err()
+		}
+		rotation, err := r.rotate(ctx, id, maxAge)
+		if err != nil {
+			log.Printf("Failed to rotate credentials of school %s: %v\n", id, err)
+			continue
+		}
+		if rotation != nil {
+			log.Printf("Rotated database credentials of school %s\n", rotation.Code)
+			rotated++
+		}
+	}
+	return rotated, nil
+}
+
+// Run rotates due passwords every interval until ctx is cancelled
+func (r *Rotator) Run(ctx context.Context, interval, maxAge time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := r.RotateDue(ctx, maxAge); err != nil && ctx.Err() == nil {
+			log.Printf("Credential rotation: %v\n", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
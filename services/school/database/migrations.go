@@ -3,8 +3,17 @@ package database
 import (
 	"context"
 	"fmt"
+	"log"
 
 	"github.com/jackc/pgx/v5/pgxpool"
+
+	"school-erp/pkg/academic"
+	"school-erp/pkg/calendar"
+	"school-erp/pkg/features"
+	"school-erp/pkg/idempotency"
+	"school-erp/pkg/plans"
+	"school-erp/pkg/settings"
+	"school-erp/pkg/tenant"
 )
 
 // RunMigrations executes all database migrations
@@ -16,6 +25,46 @@ func RunMigrations(db *pgxpool.Pool) error {
 		return fmt.Errorf("failed to create schools table: %w", err)
 	}
 
+	// Create provisioning jobs table
+	if err := createProvisioningJobsTable(ctx, db); err != nil {
+		return fmt.Errorf("failed to create provisioning_jobs table: %w", err)
+	}
+
+	// Create backup catalog and audit log tables
+	if err := createBackupTables(ctx, db); err != nil {
+		return fmt.Errorf("failed to create backup tables: %w", err)
+	}
+
+	// Create plan and usage tables; features read the plans' modules
+	if _, err := db.Exec(ctx, plans.Migration); err != nil {
+		return fmt.Errorf("failed to create plan tables: %w", err)
+	}
+
+	// Create school settings tables
+	if _, err := db.Exec(ctx, settings.Migration); err != nil {
+		return fmt.Errorf("failed to create school_settings tables: %w", err)
+	}
+
+	// Create feature flag and school module tables
+	if _, err := db.Exec(ctx, features.Migration); err != nil {
+		return fmt.Errorf("failed to create feature tables: %w", err)
+	}
+
+	// Create academic year and term tables
+	if _, err := db.Exec(ctx, academic.Migration); err != nil {
+		return fmt.Errorf("failed to create academic year tables: %w", err)
+	}
+
+	// Create school calendar tables
+	if _, err := db.Exec(ctx, calendar.Migration); err != nil {
+		return fmt.Errorf("failed to create calendar tables: %w", err)
+	}
+
+	// Create idempotency keys table
+	if _, err := db.Exec(ctx, idempotency.Migration); err != nil {
+		return fmt.Errorf("failed to create idempotency_keys table: %w", err)
+	}
+
 	return nil
 }
 
@@ -34,16 +83,44 @@ func createSchoolsTable(ctx context.Context, db *pgxpool.Pool) error {
 		domain VARCHAR(255) NOT NULL UNIQUE,
 		logo_url TEXT,
 		timezone VARCHAR(50) NOT NULL DEFAULT 'UTC',
-		status VARCHAR(20) NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'inactive', 'suspended')),
+		status VARCHAR(20) NOT NULL DEFAULT 'active' CHECK (status IN ('provisioning', 'active', 'inactive', 'suspended', 'failed')),
 		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
 		updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
 	);
 
+	-- Dedicated schools own a database; shared schools keep their rows in the
+	-- main database, keyed by shared_id and isolated by row-level security
+	ALTER TABLE schools ADD COLUMN IF NOT EXISTS tenancy VARCHAR(20) NOT NULL DEFAULT 'dedicated' CHECK (tenancy IN ('dedicated', 'shared'));
+	ALTER TABLE schools ADD COLUMN IF NOT EXISTS shared_id BIGSERIAL UNIQUE;
+
+	-- Dedicated schools' passwords are rotated (see credentials)
+	ALTER TABLE schools ADD COLUMN IF NOT EXISTS db_password_rotated_at TIMESTAMP;
+
+	-- Schools are provisioning until their database is ready (see provisioning).
+	-- Deleted schools are purged after a grace period and then archived (see
+	-- lifecycle).
+	ALTER TABLE schools DROP CONSTRAINT IF EXISTS schools_status_check;
+	ALTER TABLE schools ADD CONSTRAINT schools_status_check CHECK (status IN ('provisioning', 'active', 'inactive', 'suspended', 'failed', 'deleted', 'purging', 'archived'));
+	ALTER TABLE schools ADD COLUMN IF NOT EXISTS status_before_delete VARCHAR(20);
+	ALTER TABLE schools ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMP;
+	ALTER TABLE schools ADD COLUMN IF NOT EXISTS purge_after TIMESTAMP;
+	ALTER TABLE schools ADD COLUMN IF NOT EXISTS purge_token_hash CHAR(64);
+	ALTER TABLE schools ADD COLUMN IF NOT EXISTS purge_error TEXT;
+	ALTER TABLE schools ADD COLUMN IF NOT EXISTS archived_at TIMESTAMP;
+	ALTER TABLE schools ADD COLUMN IF NOT EXISTS final_backup_id UUID;
+
+	-- Custom domains route requests once verified by a DNS TXT record (see
+	-- domains)
+	ALTER TABLE schools ADD COLUMN IF NOT EXISTS domain_verification_token VARCHAR(64);
+	ALTER TABLE schools ADD COLUMN IF NOT EXISTS domain_verified_at TIMESTAMP;
+
 	-- Create indexes
 	CREATE INDEX IF NOT EXISTS idx_schools_code ON schools(code);
 	CREATE INDEX IF NOT EXISTS idx_schools_status ON schools(status);
 	CREATE INDEX IF NOT EXISTS idx_schools_domain ON schools(domain);
+	CREATE INDEX IF NOT EXISTS idx_schools_verified_domain ON schools(domain) WHERE domain_verified_at IS NOT NULL;
 	CREATE INDEX IF NOT EXISTS idx_schools_created_at ON schools(created_at);
+	CREATE INDEX IF NOT EXISTS idx_schools_purge_after ON schools(purge_after) WHERE status IN ('deleted', 'purging');
 
 	-- Create updated_at trigger
 	CREATE OR REPLACE FUNCTION update_schools_updated_at()
@@ -68,6 +145,95 @@ func createSchoolsTable(ctx context.Context, db *pgxpool.Pool) error {
 	return nil
 }
 
+// createProvisioningJobsTable creates the table of school provisioning jobs,
+// one per school (see the provisioning package)
+func createProvisioningJobsTable(ctx context.Context, db *pgxpool.Pool) error {
+	query := `
+	CREATE TABLE IF NOT EXISTS provisioning_jobs (
+		id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+		school_id UUID NOT NULL UNIQUE REFERENCES schools(id) ON DELETE CASCADE,
+		state VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (state IN ('pending', 'db_created', 'migrated', 'seeded', 'active', 'failed')),
+		attempts INTEGER NOT NULL DEFAULT 0,
+		last_error TEXT,
+		next_run_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		locked_until TIMESTAMP,
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_provisioning_jobs_due ON provisioning_jobs(next_run_at) WHERE state NOT IN ('active', 'failed');
+	`
+
+	if _, err := db.Exec(ctx, query); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// createBackupTables creates the catalog of tenant backups and restores
+// (see the backup package) and the audit log of changes to schools
+func createBackupTables(ctx context.Context, db *pgxpool.Pool) error {
+	query := `
+	CREATE TABLE IF NOT EXISTS tenant_backups (
+		id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+		school_id UUID NOT NULL,
+		school_code VARCHAR(20) NOT NULL,
+		db_name VARCHAR(100) NOT NULL,
+		storage_key TEXT NOT NULL,
+		status VARCHAR(20) NOT NULL CHECK (status IN ('running', 'completed', 'failed')),
+		key_id VARCHAR(255),
+		size_bytes BIGINT NOT NULL DEFAULT 0,
+		sha256 CHAR(64),
+		error TEXT,
+		actor VARCHAR(255) NOT NULL,
+		started_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		completed_at TIMESTAMP,
+		expires_at TIMESTAMP
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_tenant_backups_school ON tenant_backups(school_code, started_at DESC);
+
+	CREATE TABLE IF NOT EXISTS tenant_restores (
+		id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+		backup_id UUID NOT NULL REFERENCES tenant_backups(id) ON DELETE CASCADE,
+		school_id UUID NOT NULL,
+		school_code VARCHAR(20) NOT NULL,
+		db_name VARCHAR(100) NOT NULL UNIQUE,
+		status VARCHAR(20) NOT NULL CHECK (status IN ('running', 'restored', 'failed', 'swapped', 'discarded')),
+		table_counts JSONB,
+		error TEXT,
+		replaced_db_name VARCHAR(100),
+		actor VARCHAR(255) NOT NULL,
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		completed_at TIMESTAMP,
+		swapped_at TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS school_audit_log (
+		id BIGSERIAL PRIMARY KEY,
+		school_id UUID NOT NULL,
+		actor VARCHAR(255) NOT NULL,
+		action VARCHAR(50) NOT NULL,
+		details JSONB NOT NULL DEFAULT '{}',
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_school_audit_log_school ON school_audit_log(school_id, created_at DESC);
+	`
+
+	if _, err := db.Exec(ctx, query); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// TenantSchemaVersion is the version of the tables RunTenantMigrations
+// creates. Bump it with every change to them; school archives record it
+// (see the transfer package).
+const TenantSchemaVersion = 4
+
 // RunTenantMigrations runs migrations for a tenant database
 func RunTenantMigrations(ctx context.Context, db *pgxpool.Pool) error {
 	// Create tables that every tenant database will have
@@ -83,6 +249,126 @@ func RunTenantMigrations(ctx context.Context, db *pgxpool.Pool) error {
 		return fmt.Errorf("failed to create attendance table: %w", err)
 	}
 
+	if err := createTenantEnrollmentsTable(ctx, db); err != nil {
+		return fmt.Errorf("failed to create enrollments table: %w", err)
+	}
+
+	if err := addTenantAcademicYears(ctx, db); err != nil {
+		return fmt.Errorf("failed to add academic years: %w", err)
+	}
+
+	if err := createTenantProfileTable(ctx, db); err != nil {
+		return fmt.Errorf("failed to create school_profile table: %w", err)
+	}
+
+	if err := createTenantStudentDocumentsTable(ctx, db); err != nil {
+		return fmt.Errorf("failed to create student_documents table: %w", err)
+	}
+
+	if err := createTenantFeeReceiptsTable(ctx, db); err != nil {
+		return fmt.Errorf("failed to create fee_receipts table: %w", err)
+	}
+
+	if err := createTenantClassTables(ctx, db); err != nil {
+		return fmt.Errorf("failed to create class tables: %w", err)
+	}
+
+	if err := NormalizeTenantClasses(ctx, db); err != nil {
+		return fmt.Errorf("failed to normalize classes: %w", err)
+	}
+
+	return nil
+}
+
+// UpgradeTenants runs RunTenantMigrations on the database of every
+// provisioned dedicated school, so that databases created by older builds
+// get the tables added since, and links its attendance to the school's
+// academic years. Failures are logged; it returns the number of databases
+// upgraded.
+func UpgradeTenants(ctx context.Context, db *pgxpool.Pool, tm *tenant.TenantManager) (int, error) {
+	rows, err := db.Query(ctx, `
+	SELECT id::text, code, db_host, db_port, db_name, db_user, db_password
+	FROM schools WHERE tenancy = $1 AND status IN ($2, $3)`,
+		tenant.Dedicated, tenant.StatusActive, tenant.StatusSuspended)
+	if err != nil {
+		return 0, err
+	}
+	var schools []tenant.School
+	for rows.Next() {
+		var s tenant.School
+		if err := rows.Scan(&s.ID, &s.Code, &s.DBHost, &s.DBPort, &s.DBName, &s.DBUser, &s.DBPassword); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		schools = append(schools, s)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	upgraded := 0
+	for _, s := range schools {
+		if ctx.Err() != nil {
+			return upgraded, ctx.Err()
+		}
+		pool, err := tm.GetConnection(ctx, s.Code, s.DBHost, s.DBPort, s.DBName, s.DBUser, s.DBPassword)
+		if err != nil {
+			log.Printf("Tenant upgrade: failed to connect to %s: %v\n", s.Code, err)
+			continue
+		}
+		if err := RunTenantMigrations(ctx, pool); err != nil {
+			log.Printf("Tenant upgrade: failed to migrate %s: %v\n", s.Code, err)
+			continue
+		}
+		if err := BackfillTenantAcademicYears(ctx, db, pool, s.ID); err != nil {
+			log.Printf("Tenant upgrade: failed to link %s's academic years: %v\n", s.Code, err)
+			continue
+		}
+		upgraded++
+	}
+	return upgraded, nil
+}
+
+// BackfillTenantAcademicYears links the attendance in the school's tenant
+// database to the academic year of its day, as academic.Backfill does for
+// shared schools. The years are read from the main database, db.
+//
+// Attendance is the only year-linked table to backfill here. Invoices and
+// exams, which shared schools backfill too, are kept in the main database
+// only; teacher assignments always name their year; and enrollments without
+// one are left alone, as the day a record was written does not tell its
+// session and linking by it could break the one enrollment per student and
+// year.
+func BackfillTenantAcademicYears(ctx context.Context, db, tenantDB *pgxpool.Pool, schoolID string) error {
+	var ids, starts, ends []string
+	err := db.QueryRow(ctx, `
+	SELECT COALESCE(array_agg(id::text), '{}'), COALESCE(array_agg(start_date::text), '{}'), COALESCE(array_agg(end_date::text), '{}')
+	FROM academic_years WHERE school_id = $1`, schoolID,
+	).Scan(&ids, &starts, &ends)
+	if err != nil || len(ids) == 0 {
+		return err
+	}
+	_, err = tenantDB.Exec(ctx, `
+	UPDATE attendance a SET academic_year_id = y.id
+	FROM unnest($1::uuid[], $2::date[], $3::date[]) AS y(id, start_date, end_date)
+	WHERE a.academic_year_id IS NULL AND a.date::date BETWEEN y.start_date AND y.end_date`, ids, starts, ends)
+	return err
+}
+
+// SeedTenant writes the initial data of a tenant database. It may be run
+// again; existing rows are updated.
+func SeedTenant(ctx context.Context, db *pgxpool.Pool, code, name, timezone string) error {
+	query := `
+	INSERT INTO school_profile (id, code, name, timezone)
+	VALUES (true, $1, $2, $3)
+	ON CONFLICT (id) DO UPDATE SET code = EXCLUDED.code, name = EXCLUDED.name, timezone = EXCLUDED.timezone
+	`
+
+	if _, err := db.Exec(ctx, query, code, name, timezone); err != nil {
+		return fmt.Errorf("failed to seed school profile: %w", err)
+	}
+
 	return nil
 }
 
@@ -164,3 +450,253 @@ func createTenantAttendanceTable(ctx context.Context, db *pgxpool.Pool) error {
 
 	return nil
 }
+
+// createTenantEnrollmentsTable creates the table of students' enrollments in
+// classes, one per academic year. Years are kept in the main database, so
+// academic_year_id references nothing here.
+func createTenantEnrollmentsTable(ctx context.Context, db *pgxpool.Pool) error {
+	query := `
+	CREATE TABLE IF NOT EXISTS enrollments (
+		id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+		student_id UUID NOT NULL REFERENCES students(id) ON DELETE CASCADE,
+		class_id UUID NOT NULL,
+		academic_year_id UUID,
+		status VARCHAR(50) DEFAULT 'active',
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_enrollments_student_id ON enrollments(student_id);
+	CREATE INDEX IF NOT EXISTS idx_enrollments_class_id ON enrollments(class_id);
+	CREATE INDEX IF NOT EXISTS idx_enrollments_academic_year_id ON enrollments(academic_year_id);
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_enrollments_student_year ON enrollments(student_id, academic_year_id);
+	`
+
+	if _, err := db.Exec(ctx, query); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// addTenantAcademicYears stamps attendance with the academic year of its
+// date (see BackfillTenantAcademicYears)
+func addTenantAcademicYears(ctx context.Context, db *pgxpool.Pool) error {
+	query := `
+	ALTER TABLE attendance ADD COLUMN IF NOT EXISTS academic_year_id UUID;
+
+	CREATE INDEX IF NOT EXISTS idx_attendance_academic_year_id ON attendance(academic_year_id);
+	`
+
+	if _, err := db.Exec(ctx, query); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// createTenantProfileTable creates the single-row table that identifies the
+// school a tenant database belongs to
+func createTenantProfileTable(ctx context.Context, db *pgxpool.Pool) error {
+	query := `
+	CREATE TABLE IF NOT EXISTS school_profile (
+		id BOOLEAN PRIMARY KEY DEFAULT true CHECK (id),
+		code VARCHAR(20) NOT NULL,
+		name VARCHAR(255) NOT NULL,
+		timezone VARCHAR(50) NOT NULL DEFAULT 'UTC',
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+	`
+
+	if _, err := db.Exec(ctx, query); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// createTenantStudentDocumentsTable creates the table of files uploaded for
+// students, such as birth certificates; the files are in the file store
+// under file_key
+func createTenantStudentDocumentsTable(ctx context.Context, db *pgxpool.Pool) error {
+	query := `
+	CREATE TABLE IF NOT EXISTS student_documents (
+		id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+		student_id UUID NOT NULL REFERENCES students(id) ON DELETE CASCADE,
+		kind VARCHAR(50) NOT NULL,
+		file_key TEXT NOT NULL UNIQUE,
+		content_type VARCHAR(100) NOT NULL,
+		size BIGINT NOT NULL,
+		uploaded_by VARCHAR(255),
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_student_documents_student_id ON student_documents(student_id);
+	`
+
+	if _, err := db.Exec(ctx, query); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// createTenantFeeReceiptsTable creates the table of uploaded receipts and
+// deposit slips of fee payments. Students with receipts cannot be deleted.
+func createTenantFeeReceiptsTable(ctx context.Context, db *pgxpool.Pool) error {
+	query := `
+	CREATE TABLE IF NOT EXISTS fee_receipts (
+		id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+		student_id UUID NOT NULL REFERENCES students(id),
+		invoice_id UUID,
+		reference VARCHAR(100),
+		file_key TEXT NOT NULL UNIQUE,
+		content_type VARCHAR(100) NOT NULL,
+		size BIGINT NOT NULL,
+		uploaded_by VARCHAR(255),
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_fee_receipts_student_id ON fee_receipts(student_id);
+	`
+
+	if _, err := db.Exec(ctx, query); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// createTenantClassTables creates the class catalog: classes (grades),
+// their sections, subjects and the teachers assigned to teach a subject to
+// a section in an academic year, and points students, enrollments and
+// attendance at it. Enrollments' class_id predates the catalog, so its
+// reference is not checked for existing rows.
+func createTenantClassTables(ctx context.Context, db *pgxpool.Pool) error {
+	query := `
+	CREATE TABLE IF NOT EXISTS classes (
+		id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+		name VARCHAR(50) NOT NULL,
+		position INTEGER NOT NULL DEFAULT 0,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_classes_name ON classes(lower(name));
+
+	CREATE TABLE IF NOT EXISTS sections (
+		id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+		class_id UUID NOT NULL REFERENCES classes(id) ON DELETE CASCADE,
+		name VARCHAR(10) NOT NULL,
+		capacity INTEGER CHECK (capacity > 0),
+		class_teacher_id UUID REFERENCES users(id) ON DELETE SET NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE (id, class_id)
+	);
+
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_sections_class_name ON sections(class_id, lower(name));
+
+	CREATE TABLE IF NOT EXISTS subjects (
+		id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+		code VARCHAR(20) NOT NULL,
+		name VARCHAR(255) NOT NULL,
+		credit_hours NUMERIC(4,2) NOT NULL DEFAULT 0 CHECK (credit_hours >= 0),
+		theory_percent SMALLINT NOT NULL DEFAULT 100 CHECK (theory_percent BETWEEN 0 AND 100),
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_subjects_code ON subjects(upper(code));
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_subjects_name ON subjects(lower(name));
+
+	CREATE TABLE IF NOT EXISTS teacher_assignments (
+		id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+		teacher_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		subject_id UUID NOT NULL REFERENCES subjects(id) ON DELETE CASCADE,
+		section_id UUID NOT NULL REFERENCES sections(id) ON DELETE CASCADE,
+		academic_year_id UUID NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE (teacher_id, subject_id, section_id, academic_year_id)
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_teacher_assignments_section_id ON teacher_assignments(section_id);
+	CREATE INDEX IF NOT EXISTS idx_teacher_assignments_subject_id ON teacher_assignments(subject_id);
+
+	ALTER TABLE students ADD COLUMN IF NOT EXISTS class_id UUID REFERENCES classes(id);
+	ALTER TABLE students ADD COLUMN IF NOT EXISTS section_id UUID REFERENCES sections(id);
+	ALTER TABLE enrollments ADD COLUMN IF NOT EXISTS section_id UUID REFERENCES sections(id);
+	ALTER TABLE attendance ADD COLUMN IF NOT EXISTS class_id UUID REFERENCES classes(id);
+	ALTER TABLE attendance ADD COLUMN IF NOT EXISTS section_id UUID REFERENCES sections(id);
+
+	DO $$
+	BEGIN
+		IF NOT EXISTS (SELECT FROM pg_constraint WHERE conname = 'students_section_class_fkey') THEN
+			ALTER TABLE students ADD CONSTRAINT students_section_class_fkey
+				FOREIGN KEY (section_id, class_id) REFERENCES sections(id, class_id);
+		END IF;
+		IF NOT EXISTS (SELECT FROM pg_constraint WHERE conname = 'enrollments_class_id_fkey') THEN
+			ALTER TABLE enrollments ADD CONSTRAINT enrollments_class_id_fkey
+				FOREIGN KEY (class_id) REFERENCES classes(id) NOT VALID;
+		END IF;
+		IF NOT EXISTS (SELECT FROM pg_constraint WHERE conname = 'enrollments_section_class_fkey') THEN
+			ALTER TABLE enrollments ADD CONSTRAINT enrollments_section_class_fkey
+				FOREIGN KEY (section_id, class_id) REFERENCES sections(id, class_id) NOT VALID;
+		END IF;
+		IF NOT EXISTS (SELECT FROM pg_constraint WHERE conname = 'attendance_section_class_fkey') THEN
+			ALTER TABLE attendance ADD CONSTRAINT attendance_section_class_fkey
+				FOREIGN KEY (section_id, class_id) REFERENCES sections(id, class_id);
+		END IF;
+	END
+	$$;
+
+	CREATE INDEX IF NOT EXISTS idx_students_class_id ON students(class_id);
+	CREATE INDEX IF NOT EXISTS idx_students_section_id ON students(section_id);
+	CREATE INDEX IF NOT EXISTS idx_attendance_class_id ON attendance(class_id);
+	CREATE INDEX IF NOT EXISTS idx_attendance_section_id ON attendance(section_id);
+	`
+
+	if _, err := db.Exec(ctx, query); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// NormalizeTenantClasses turns the free-text class and section of students
+// into classes and sections, matched whatever their case and spacing, and
+// clears them once the student points at them. It is run by the migrations
+// and again on the tables of imported archives, which may predate the
+// catalog.
+func NormalizeTenantClasses(ctx context.Context, db *pgxpool.Pool) error {
+	query := `
+	INSERT INTO classes (name)
+	SELECT DISTINCT ON (lower(btrim(class))) btrim(class)
+	FROM students WHERE class_id IS NULL AND btrim(class) <> ''
+	ORDER BY lower(btrim(class)), btrim(class)
+	ON CONFLICT DO NOTHING;
+
+	UPDATE students s SET class_id = c.id
+	FROM classes c
+	WHERE s.class_id IS NULL AND lower(c.name) = lower(btrim(s.class));
+
+	INSERT INTO sections (class_id, name)
+	SELECT DISTINCT ON (class_id, lower(btrim(section))) class_id, btrim(section)
+	FROM students WHERE class_id IS NOT NULL AND section_id IS NULL AND btrim(section) <> ''
+	ORDER BY class_id, lower(btrim(section)), btrim(section)
+	ON CONFLICT DO NOTHING;
+
+	UPDATE students s SET section_id = sec.id
+	FROM sections sec
+	WHERE s.section_id IS NULL AND sec.class_id = s.class_id AND lower(sec.name) = lower(btrim(s.section));
+
+	UPDATE students SET class = NULL WHERE class IS NOT NULL AND class_id IS NOT NULL;
+	UPDATE students SET section = NULL WHERE section IS NOT NULL AND section_id IS NOT NULL;
+	`
+
+	if _, err := db.Exec(ctx, query); err != nil {
+		return err
+	}
+
+	return nil
+}
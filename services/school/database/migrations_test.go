@@ -0,0 +1,120 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// tenantDB creates a database with the tenant tables, using the Postgres
+// superuser DSN in SCHOOL_TEST_DATABASE_URL, and drops it after the test
+func tenantDB(t *testing.T) *pgxpool.Pool {
+	t.Helper()
+	dsn := os.Getenv("SCHOOL_TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("SCHOOL_TEST_DATABASE_URL not set")
+	}
+	ctx := context.Background()
+	admin, err := pgx.Connect(ctx, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := fmt.Sprintf("tenant_test_%d", time.Now().UnixNano())
+	if _, err := admin.Exec(ctx, `CREATE DATABASE `+name); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		admin.Exec(context.Background(), `DROP DATABASE IF EXISTS `+name+` WITH (FORCE)`)
+		admin.Close(context.Background())
+	})
+
+	cfg, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.ConnConfig.Database = name
+	db, err := pgxpool.NewWithConfig(ctx, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(db.Close)
+	if err := RunTenantMigrations(ctx, db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// TestNormalizeTenantClasses merges class and section names that differ in
+// case and surrounding spaces, and leaves blank ones alone
+func TestNormalizeTenantClasses(t *testing.T) {
+	db := tenantDB(t)
+	ctx := context.Background()
+
+	students := []struct{ roll, class, section string }{
+		{"1", "Grade 5", "a"},
+		{"2", " grade 5 ", " A"},
+		{"3", "GRADE 5", "B"},
+		{"4", "Grade 6", ""},
+		{"5", "  ", ""},
+	}
+	for _, s := range students {
+		if _, err := db.Exec(ctx, `INSERT INTO students (roll_number, class, section) VALUES ($1, $2, $3)`,
+			s.roll, s.class, s.section); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Once by the migrations, and again as for an imported archive
+	for i := 0; i < 2; i++ {
+		if err := NormalizeTenantClasses(ctx, db); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var classes, sections int
+	if err := db.QueryRow(ctx, `SELECT (SELECT COUNT(*) FROM classes), (SELECT COUNT(*) FROM sections)`).Scan(&classes, &sections); err != nil {
+		t.Fatal(err)
+	}
+	if classes != 2 || sections != 2 {
+		t.Errorf("%d classes and %d sections, want 2 and 2", classes, sections)
+	}
+
+	placed := map[string][2]*string{}
+	rows, err := db.Query(ctx, `SELECT roll_number, class_id::text, section_id::text, class, section FROM students`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var roll string
+		var classID, sectionID, class, section *string
+		if err := rows.Scan(&roll, &classID, &sectionID, &class, &section); err != nil {
+			t.Fatal(err)
+		}
+		if classID != nil && class != nil || sectionID != nil && section != nil {
+			t.Errorf("student %s keeps the name of its class or section", roll)
+		}
+		placed[roll] = [2]*string{classID, sectionID}
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	same := func(a, b *string) bool { return a != nil && b != nil && *a == *b }
+	if !same(placed["1"][0], placed["2"][0]) || !same(placed["1"][0], placed["3"][0]) {
+		t.Errorf("Grade 5 students are in classes %v, %v and %v, want one", placed["1"][0], placed["2"][0], placed["3"][0])
+	}
+	if !same(placed["1"][1], placed["2"][1]) || same(placed["1"][1], placed["3"][1]) {
+		t.Errorf("sections %v, %v and %v, want a, A in one and B in another", placed["1"][1], placed["2"][1], placed["3"][1])
+	}
+	if placed["4"][0] == nil || same(placed["4"][0], placed["1"][0]) || placed["4"][1] != nil {
+		t.Errorf("Grade 6 student placed in %v", placed["4"])
+	}
+	if placed["5"][0] != nil {
+		t.Errorf("student of a blank class placed in class %s", *placed["5"][0])
+	}
+}
@@ -0,0 +1,159 @@
+// Package domains verifies the custom domains of schools. An administrator
+// publishes a DNS TXT record with the school's verification token; once the
+// record is found the domain is verified and a SchoolUpdated event tells the
+// services to route requests for the domain to the school.
+package domains
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"school-erp/pkg/events"
+	"school-erp/pkg/tenant"
+)
+
+// RecordPrefix is prepended to a domain to name its verification record
+const RecordPrefix = "_school-erp-verification."
+
+// valuePrefix starts the value of a verification record
+const valuePrefix = "school-erp-verification="
+
+var (
+	// ErrNoChallenge is returned by Verify before Challenge was called
+	ErrNoChallenge = errors.New("no verification was started for the domain")
+	// ErrNotVerified is returned when the verification record is missing
+	ErrNotVerified = errors.New("verification record not found")
+)
+
+// Resolver looks up TXT records; *net.Resolver is one
+type Resolver interface {
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+}
+
+// Challenge is the TXT record that verifies a school's domain
+type Challenge struct {
+	SchoolID    string     `json:"school_id"`
+	Domain      string     `json:"domain"`
+	RecordName  string     `json:"record_name"`
+	RecordValue string     `json:"record_value"`
+	VerifiedAt  *time.Time `json:"verified_at,omitempty"`
+}
+
+func newChallenge(schoolID, domain, token string, verifiedAt *time.Time) *Challenge {
+	return &Challenge{
+		SchoolID:    schoolID,
+		Domain:      domain,
+		RecordName:  RecordPrefix + domain,
+		RecordValue: valuePrefix + token,
+		VerifiedAt:  verifiedAt,
+	}
+}
+
+// Check looks for the challenge's record. Lookup failures are wrapped in
+// ErrNotVerified, since a missing record is one to most resolvers.
+func Check(ctx context.Context, r Resolver, c *Challenge) error {
+	records, err := r.LookupTXT(ctx, c.RecordName)
+	if err != nil {
+		return fmt.Errorf("%w at %s: %v", ErrNotVerified, c.RecordName, err)
+	}
+	for _, record := range records {
+		if strings.TrimSpace(record) == c.RecordValue {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w at %s", ErrNotVerified, c.RecordName)
+}
+
+// Service runs domain verifications and announces school changes
+type Service struct {
+	db       *pgxpool.Pool
+	resolver Resolver
+	publish  events.Publisher
+}
+
+func NewService(db *pgxpool.Pool, resolver Resolver, publish events.Publisher) *Service {
+	return &Service{db: db, resolver: resolver, publish: publish}
+}
+
+// Challenge returns the record that verifies the school's domain, creating
+// its token on first use. It returns pgx.ErrNoRows for unknown schools.
+func (s *Service) Challenge(ctx context.Context, schoolID string) (*Challenge, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+
+	var domain, token string
+	var verifiedAt *time.Time
+	err := s.db.QueryRow(ctx, `
+	UPDATE schools SET domain_verification_token = COALESCE(domain_verification_token, $2)
+	WHERE id = $1
+	RETURNING domain, domain_verification_token, domain_verified_at`, schoolID, hex.EncodeToString(b),
+	).Scan(&domain, &token, &verifiedAt)
+	if err != nil {
+		return nil, err
+	}
+	return newChallenge(schoolID, domain, token, verifiedAt), nil
+}
+
+// Verify checks the school's verification record and, when it is found,
+// marks the domain verified and announces it
+func (s *Service) Verify(ctx context.Context, schoolID string) (*Challenge, error) {
+	var domain string
+	var token *string
+	var verifiedAt *time.Time
+	err := s.db.QueryRow(ctx, `
+	SELECT domain, domain_verification_token, domain_verified_at FROM schools WHERE id = $1`, schoolID,
+	).Scan(&domain, &token, &verifiedAt)
+	if err != nil {
+		return nil, err
+	}
+	if token == nil {
+		return nil, ErrNoChallenge
+	}
+	c := newChallenge(schoolID, domain, *token, verifiedAt)
+	if verifiedAt != nil {
+		return c, nil
+	}
+	if err := Check(ctx, s.resolver, c); err != nil {
+		return nil, err
+	}
+
+	// The token must still be the checked one: a domain changed meanwhile
+	// is not verified by the old domain's record
+	err = s.db.QueryRow(ctx, `
+	UPDATE schools SET domain_verified_at = NOW()
+	WHERE id = $1 AND domain = $2 AND domain_verification_token = $3
+	RETURNING domain_verified_at`, schoolID, domain, *token,
+	).Scan(&c.VerifiedAt)
+	if err != nil {
+		return nil, err
+	}
+	s.Announce(ctx, schoolID)
+	return c, nil
+}
+
+// Announce publishes a SchoolUpdated event with the school's current domain
+// and status. It is best effort: failures are logged.
+func (s *Service) Announce(ctx context.Context, schoolID string) {
+	if s.publish == nil {
+		return
+	}
+	e := tenant.SchoolUpdated{SchoolID: schoolID}
+	err := s.db.QueryRow(ctx, `
+	SELECT code, domain, domain_verified_at IS NOT NULL, status, updated_at FROM schools WHERE id = $1`, schoolID,
+	).Scan(&e.Code, &e.Domain, &e.DomainVerified, &e.Status, &e.UpdatedAt)
+	if err != nil {
+		log.Printf("Failed to publish %s for school %s: %v\n", tenant.SubjectSchoolUpdated, schoolID, err)
+		return
+	}
+	events.Send(s.publish, tenant.SubjectSchoolUpdated, e)
+}
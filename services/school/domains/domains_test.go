@@ -0,0 +1,46 @@
+package domains
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// fakeResolver answers from a map of TXT records
+type fakeResolver map[string][]string
+
+func (r fakeResolver) LookupTXT(_ context.Context, name string) ([]string, error) {
+	records, ok := r[name]
+	if !ok {
+		return nil, errors.New("no such host")
+	}
+	return records, nil
+}
+
+func TestCheck(t *testing.T) {
+	c := newChallenge("1", "portal.eis.edu.np", "0123abcd", nil)
+	if c.RecordName != "_school-erp-verification.portal.eis.edu.np" || c.RecordValue != "school-erp-verification=0123abcd" {
+		t.Fatalf("challenge = %+v", c)
+	}
+
+	cases := []struct {
+		name     string
+		resolver fakeResolver
+		ok       bool
+	}{
+		{"record", fakeResolver{c.RecordName: {"v=spf1 -all", c.RecordValue}}, true},
+		{"record with spaces", fakeResolver{c.RecordName: {" " + c.RecordValue + " "}}, true},
+		{"other token", fakeResolver{c.RecordName: {"school-erp-verification=ffff"}}, false},
+		{"record on the domain itself", fakeResolver{c.Domain: {c.RecordValue}}, false},
+		{"no record", fakeResolver{}, false},
+	}
+	for _, tc := range cases {
+		err := Check(context.Background(), tc.resolver, c)
+		if tc.ok && err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+		}
+		if !tc.ok && !errors.Is(err, ErrNotVerified) {
+			t.Errorf("%s: err = %v, want ErrNotVerified", tc.name, err)
+		}
+	}
+}
@@ -0,0 +1,249 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5"
+
+	"school-erp/pkg/academic"
+	"school-erp/pkg/bs"
+	"school-erp/pkg/problem"
+	"school-erp/pkg/settings"
+)
+
+// AcademicHandler handles schools' academic years and terms. New years are
+// counted in the calendar of the school's academic settings unless they
+// name one, and their dates are given and shown in it.
+type AcademicHandler struct {
+	store    *academic.Store
+	settings *settings.Store
+}
+
+func NewAcademicHandler(store *academic.Store, settings *settings.Store) *AcademicHandler {
+	return &AcademicHandler{store: store, settings: settings}
+}
+
+// academicError maps store errors onto problems. Years are looked up by
+// the store itself, so missing rows are of unknown schools.
+func academicError(err error) error {
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return problem.FromDB(err, "School")
+	case errors.Is(err, academic.ErrUnknownYear), errors.Is(err, academic.ErrNoCurrentYear):
+		return problem.NotFound(err.Error())
+	case errors.Is(err, academic.ErrInvalid):
+		return problem.Unprocessable(problem.CodeValidationFailed, err.Error())
+	case errors.Is(err, academic.ErrOverlap), errors.Is(err, academic.ErrClosed), errors.Is(err, academic.ErrCurrent):
+		return problem.Conflict(problem.CodeConflict, err.Error())
+	}
+	return problem.FromDB(err, "Academic year")
+}
+
+// yearCalendar returns the calendar the dates of a year of calendar are
+// given and shown in: BS for Bikram Sambat years, AD otherwise. They are
+// stored in AD either way.
+func yearCalendar(calendar string) bs.Calendar {
+	if calendar == academic.BikramSambat {
+		return bs.BS
+	}
+	return bs.AD
+}
+
+// parseDay converts the day of field from cal into AD, adding to p when it
+// is not a day of cal
+func parseDay(cal bs.Calendar, field string, day *string, p **problem.Problem) {
+	if day == nil || *day == "" {
+		return
+	}
+	ad, err := cal.ParseDay(*day)
+	if err != nil {
+		if *p == nil {
+			*p = problem.Unprocessable(problem.CodeValidationFailed, "One or more fields are invalid")
+		}
+		(*p).Errors = append((*p).Errors, problem.FieldError{Field: field, Code: "date", Message: "must be a YYYY-MM-DD day of the " + string(cal) + " calendar"})
+		return
+	}
+	*day = ad
+}
+
+// parseDays converts the dates of a year and its terms from cal into AD
+func parseDays(cal bs.Calendar, start, end *string, terms []academic.TermInput) error {
+	var p *problem.Problem
+	parseDay(cal, "start_date", start, &p)
+	parseDay(cal, "end_date", end, &p)
+	for i := range terms {
+		parseDay(cal, fmt.Sprintf("terms[%d].start_date", i), &terms[i].StartDate, &p)
+		parseDay(cal, fmt.Sprintf("terms[%d].end_date", i), &terms[i].EndDate, &p)
+	}
+	if p != nil {
+		return p
+	}
+	return nil
+}
+
+// showYear converts the dates of y and its terms into the calendar of y
+func showYear(y *academic.Year) *academic.Year {
+	cal := yearCalendar(y.Calendar)
+	y.StartDate, y.EndDate = cal.FormatDay(y.StartDate), cal.FormatDay(y.EndDate)
+	for i := range y.Terms {
+		t := &y.Terms[i]
+		t.StartDate, t.EndDate = cal.FormatDay(t.StartDate), cal.FormatDay(t.EndDate)
+	}
+	return y
+}
+
+// parseYear reads and checks the year in the request body. Without a
+// calendar it takes the one returned by fallback. Its dates are days of its
+// calendar, BS for bikram_sambat and AD otherwise, and are returned in AD.
+func parseYear(c *fiber.Ctx, fallback func() (string, error)) (academic.YearInput, error) {
+	var in academic.YearInput
+	if err := c.BodyParser(&in); err != nil {
+		return in, problem.BadRequest(problem.CodeInvalidBody, "Invalid request body")
+	}
+	if err := problem.Validate(&in); err != nil {
+		return in, err
+	}
+	if in.Calendar == "" {
+		calendar, err := fallback()
+		if err != nil {
+			return in, academicError(err)
+		}
+		in.Calendar = calendar
+	}
+	if err := parseDays(yearCalendar(in.Calendar), &in.StartDate, &in.EndDate, in.Terms); err != nil {
+		return in, err
+	}
+	probe := in
+	if err := probe.Check(); err != nil {
+		return in, academicError(err)
+	}
+	return in, nil
+}
+
+// defaultCalendar returns the calendar of the school's academic settings
+func (h *AcademicHandler) defaultCalendar(ctx context.Context, schoolID string) (string, error) {
+	doc, err := h.settings.Get(ctx, schoolID, settings.NamespaceAcademic)
+	if err != nil {
+		return "", err
+	}
+	var s settings.Academic
+	if err := json.Unmarshal(doc.Settings, &s); err != nil {
+		return "", err
+	}
+	if s.Calendar == "BS" {
+		return academic.BikramSambat, nil
+	}
+	return academic.Gregorian, nil
+}
+
+// ListYears handles GET /api/v1/schools/:id/academic-years
+func (h *AcademicHandler) ListYears(c *fiber.Ctx) error {
+	years, err := h.store.List(c.Context(), c.Params("id"))
+	if err != nil {
+		return academicError(err)
+	}
+	for i := range years {
+		showYear(&years[i])
+	}
+	return c.JSON(years)
+}
+
+// GetCurrentYear handles GET /api/v1/schools/:id/academic-years/current
+func (h *AcademicHandler) GetCurrentYear(c *fiber.Ctx) error {
+	y, err := h.store.Current(c.Context(), c.Params("id"))
+	if err != nil {
+		return academicError(err)
+	}
+	return c.JSON(showYear(y))
+}
+
+// GetYear handles GET /api/v1/schools/:id/academic-years/:yearId
+func (h *AcademicHandler) GetYear(c *fiber.Ctx) error {
+	y, err := h.store.Get(c.Context(), c.Params("id"), c.Params("yearId"))
+	if err != nil {
+		return academicError(err)
+	}
+	return c.JSON(showYear(y))
+}
+
+// CreateYear handles POST /api/v1/schools/:id/academic-years
+func (h *AcademicHandler) CreateYear(c *fiber.Ctx) error {
+	in, err := parseYear(c, func() (string, error) {
+		return h.defaultCalendar(c.Context(), c.Params("id"))
+	})
+	if err != nil {
+		return err
+	}
+	y, err := h.store.Create(c.Context(), c.Params("id"), in)
+	if err != nil {
+		return academicError(err)
+	}
+	return c.Status(fiber.StatusCreated).JSON(showYear(y))
+}
+
+// UpdateYear handles PUT /api/v1/schools/:id/academic-years/:yearId. The
+// year keeps its calendar unless the body names one.
+func (h *AcademicHandler) UpdateYear(c *fiber.Ctx) error {
+	in, err := parseYear(c, func() (string, error) {
+		y, err := h.store.Get(c.Context(), c.Params("id"), c.Params("yearId"))
+		if err != nil {
+			return "", err
+		}
+		return y.Calendar, nil
+	})
+	if err != nil {
+		return err
+	}
+	y, err := h.store.Update(c.Context(), c.Params("id"), c.Params("yearId"), in)
+	if err != nil {
+		return academicError(err)
+	}
+	return c.JSON(showYear(y))
+}
+
+// DeleteYear handles DELETE /api/v1/schools/:id/academic-years/:yearId
+func (h *AcademicHandler) DeleteYear(c *fiber.Ctx) error {
+	if err := h.store.Delete(c.Context(), c.Params("id"), c.Params("yearId")); err != nil {
+		return academicError(err)
+	}
+	return c.JSON(fiber.Map{"message": "Academic year deleted"})
+}
+
+// ActivateYear handles POST /api/v1/schools/:id/academic-years/:yearId/activate
+func (h *AcademicHandler) ActivateYear(c *fiber.Ctx) error {
+	y, err := h.store.Activate(c.Context(), c.Params("id"), c.Params("yearId"))
+	if err != nil {
+		return academicError(err)
+	}
+	return c.JSON(showYear(y))
+}
+
+// Rollover handles POST /api/v1/schools/:id/academic-years/rollover. The
+// next year keeps the calendar of the current one, whose days its dates are.
+func (h *AcademicHandler) Rollover(c *fiber.Ctx) error {
+	var in academic.RolloverInput
+	if err := c.BodyParser(&in); err != nil {
+		return problem.BadRequest(problem.CodeInvalidBody, "Invalid request body")
+	}
+	if err := problem.Validate(&in); err != nil {
+		return err
+	}
+	if in.StartDate != "" || len(in.Terms) > 0 {
+		cur, err := h.store.Current(c.Context(), c.Params("id"))
+		if err != nil {
+			return academicError(err)
+		}
+		if err := parseDays(yearCalendar(cur.Calendar), &in.StartDate, nil, in.Terms); err != nil {
+			return err
+		}
+	}
+	y, err := h.store.Rollover(c.Context(), c.Params("id"), in)
+	if err != nil {
+		return academicError(err)
+	}
+	return c.Status(fiber.StatusCreated).JSON(showYear(y))
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+
+	"school-erp/pkg/academic"
+	"school-erp/pkg/problem"
+)
+
+// parse runs parseYear on body and returns the input it read, or the
+// status of its problem
+func parse(t *testing.T, body string) (academic.YearInput, int) {
+	t.Helper()
+	var in academic.YearInput
+	app := fiber.New(fiber.Config{ErrorHandler: problem.ErrorHandler})
+	app.Post("/", func(c *fiber.Ctx) error {
+		var err error
+		in, err = parseYear(c, func() (string, error) { return academic.Gregorian, nil })
+		return err
+	})
+	req := httptest.NewRequest("POST", "/", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	return in, resp.StatusCode
+}
+
+func TestBikramSambatYearRoundTrip(t *testing.T) {
+	stored := academic.Year{
+		Name: "2081", Calendar: academic.BikramSambat,
+		StartDate: "2024-04-13", EndDate: "2025-04-13",
+		Terms: []academic.Term{
+			{Name: "First", Position: 1, StartDate: "2024-04-13", EndDate: "2024-10-16"},
+			{Name: "Second", Position: 2, StartDate: "2024-10-17", EndDate: "2025-04-13"},
+		},
+	}
+	shown := stored
+	shown.Terms = append([]academic.Term(nil), stored.Terms...)
+	showYear(&shown)
+
+	// Baisakh 1 to Chaitra 31 2081; Kartik 1 is 2024-10-17
+	if shown.StartDate != "2081-01-01" || shown.EndDate != "2081-12-31" || shown.Terms[1].StartDate != "2081-07-01" {
+		t.Fatalf("shown = %s to %s, second term from %s", shown.StartDate, shown.EndDate, shown.Terms[1].StartDate)
+	}
+
+	body, err := json.Marshal(shown)
+	if err != nil {
+		t.Fatal(err)
+	}
+	in, status := parse(t, string(body))
+	if status != fiber.StatusOK {
+		t.Fatalf("status = %d, want 200", status)
+	}
+	want := academic.YearInput{
+		Name: stored.Name, Calendar: stored.Calendar, StartDate: stored.StartDate, EndDate: stored.EndDate,
+		Terms: []academic.TermInput{
+			{Name: "First", StartDate: "2024-04-13", EndDate: "2024-10-16"},
+			{Name: "Second", StartDate: "2024-10-17", EndDate: "2025-04-13"},
+		},
+	}
+	if !reflect.DeepEqual(in, want) {
+		t.Errorf("parsed %+v, want %+v", in, want)
+	}
+}
+
+func TestGregorianYearsStayAD(t *testing.T) {
+	y := academic.Year{Calendar: academic.Gregorian, StartDate: "2025-01-01", EndDate: "2025-12-31"}
+	if showYear(&y); y.StartDate != "2025-01-01" || y.EndDate != "2025-12-31" {
+		t.Errorf("shown = %s to %s", y.StartDate, y.EndDate)
+	}
+	in, status := parse(t, `{"name":"2025","start_date":"2025-01-01","end_date":"2025-12-31"}`)
+	if status != fiber.StatusOK || in.Calendar != academic.Gregorian || in.StartDate != "2025-01-01" || in.EndDate != "2025-12-31" {
+		t.Errorf("parsed %s %s to %s (%d)", in.Calendar, in.StartDate, in.EndDate, status)
+	}
+}
+
+func TestParseYearRefusesOtherDays(t *testing.T) {
+	for _, body := range []string{
+		// Baisakh 2081 has 31 days
+		`{"name":"2081","calendar":"bikram_sambat","start_date":"2081-01-32","end_date":"2081-12-30"}`,
+		`{"name":"2081","calendar":"bikram_sambat","start_date":"2081-01-01","end_date":"2081-12-30","terms":[{"name":"First","start_date":"2081-01-01","end_date":"2081-13-01"}]}`,
+		`{"name":"2025","start_date":"2025-02-30","end_date":"2025-12-31"}`,
+	} {
+		if _, status := parse(t, body); status != fiber.StatusUnprocessableEntity {
+			t.Errorf("%s: status = %d, want 422", body, status)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5"
+
+	"school-erp/pkg/calendar"
+	"school-erp/pkg/problem"
+	"school-erp/pkg/settings"
+)
+
+// CalendarHandler handles schools' holiday and working-day calendars. The
+// working week is that of the school's academic settings.
+type CalendarHandler struct {
+	store    *calendar.Store
+	settings *settings.Store
+}
+
+func NewCalendarHandler(store *calendar.Store, settings *settings.Store) *CalendarHandler {
+	return &CalendarHandler{store: store, settings: settings}
+}
+
+// WorkingDays is a range of days of a school's calendar, as a class sees
+// them
+type WorkingDays struct {
+	From        string         `json:"from"`
+	To          string         `json:"to"`
+	ClassID     string         `json:"class_id,omitempty"`
+	WorkingDays int            `json:"working_days"`
+	Days        []calendar.Day `json:"days"`
+}
+
+// calendarError maps store errors onto problems. Missing rows are of
+// unknown schools.
+func calendarError(err error) error {
+	switch {
+	case errors.Is(err, pgx.ErrNoRows):
+		return problem.FromDB(err, "School")
+	case errors.Is(err, calendar.ErrUnknownEvent):
+		return problem.NotFound(err.Error())
+	case errors.Is(err, calendar.ErrInvalid):
+		return problem.Unprocessable(problem.CodeValidationFailed, err.Error())
+	}
+	return problem.FromDB(err, "Calendar event")
+}
+
+// parseEvent reads and checks the event in the request body
+func parseEvent(c *fiber.Ctx) (calendar.EventInput, error) {
+	var in calendar.EventInput
+	if err := c.BodyParser(&in); err != nil {
+		return in, problem.BadRequest(problem.CodeInvalidBody, "Invalid request body")
+	}
+	if err := problem.Validate(&in); err != nil {
+		return in, err
+	}
+	if err := in.Check(); err != nil {
+		return in, calendarError(err)
+	}
+	return in, nil
+}
+
+// queryDate reads the date in the query parameter, which may be empty
+func queryDate(c *fiber.Ctx, param string) (string, error) {
+	day := c.Query(param)
+	if day == "" {
+		return "", nil
+	}
+	if _, err := time.Parse(calendar.DateLayout, day); err != nil {
+		return "", problem.BadRequest(problem.CodeInvalidQuery, param+" must be a YYYY-MM-DD date")
+	}
+	return day, nil
+}
+
+// workingWeek returns the working days of the school's academic settings
+func (h *CalendarHandler) workingWeek(ctx context.Context, schoolID string) ([]string, error) {
+	doc, err := h.settings.Get(ctx, schoolID, settings.NamespaceAcademic)
+	if err != nil {
+		return nil, err
+	}
+	var s settings.Academic
+	if err := json.Unmarshal(doc.Settings, &s); err != nil {
+		return nil, err
+	}
+	return s.WorkingDays, nil
+}
+
+// ListEvents handles GET /api/v1/schools/:id/calendar/events, of the events
+// running between from and to when given
+func (h *CalendarHandler) ListEvents(c *fiber.Ctx) error {
+	from, err := queryDate(c, "from")
+	if err != nil {
+		return err
+	}
+	to, err := queryDate(c, "to")
+	if err != nil {
+		return err
+	}
+	events, err := h.store.List(c.Context(), c.Params("id"), from, to)
+	if err != nil {
+		return calendarError(err)
+	}
+	return c.JSON(events)
+}
+
+// GetEvent handles GET /api/v1/schools/:id/calendar/events/:eventId
+func (h *CalendarHandler) GetEvent(c *fiber.Ctx) error {
+	e, err := h.store.Get(c.Context(), c.Params("id"), c.Params("eventId"))
+	if err != nil {
+		return calendarError(err)
+	}
+	return c.JSON(e)
+}
+
+// CreateEvent handles POST /api/v1/schools/:id/calendar/events
+func (h *CalendarHandler) CreateEvent(c *fiber.Ctx) error {
+	in, err := parseEvent(c)
+	if err != nil {
+		return err
+	}
+	e, err := h.store.Create(c.Context(), c.Params("id"), in)
+	if err != nil {
+		return calendarError(err)
+	}
+	return c.Status(fiber.StatusCreated).JSON(e)
+}
+
+// UpdateEvent handles PUT /api/v1/schools/:id/calendar/events/:eventId
+func (h *CalendarHandler) UpdateEvent(c *fiber.Ctx) error {
+	in, err := parseEvent(c)
+	if err != nil {
+		return err
+	}
+	e, err := h.store.Update(c.Context(), c.Params("id"), c.Params("eventId"), in)
+	if err != nil {
+		return calendarError(err)
+	}
+	return c.JSON(e)
+}
+
+// DeleteEvent handles DELETE /api/v1/schools/:id/calendar/events/:eventId
+func (h *CalendarHandler) DeleteEvent(c *fiber.Ctx) error {
+	if err := h.store.Delete(c.Context(), c.Params("id"), c.Params("eventId")); err != nil {
+		return calendarError(err)
+	}
+	return c.JSON(fiber.Map{"message": "Calendar event deleted"})
+}
+
+// ExportCalendar handles GET /api/v1/schools/:id/calendar/ical, the
+// school's events as an iCalendar document
+func (h *CalendarHandler) ExportCalendar(c *fiber.Ctx) error {
+	events, err := h.store.List(c.Context(), c.Params("id"), "", "")
+	if err != nil {
+		return calendarError(err)
+	}
+	var buf bytes.Buffer
+	if err := calendar.Encode(&buf, "School calendar", events); err != nil {
+		return problem.Internal("Failed to export the calendar", err)
+	}
+	c.Set(fiber.HeaderContentType, calendar.ContentType+"; charset=utf-8")
+	c.Set(fiber.HeaderContentDisposition, `attachment; filename="calendar.ics"`)
+	return c.Send(buf.Bytes())
+}
+
+// ImportCalendar handles POST /api/v1/schools/:id/calendar/ical. Events of
+// the document replace the school's events with the same UID; with
+// ?replace=true the school's other events are deleted.
+func (h *CalendarHandler) ImportCalendar(c *fiber.Ctx) error {
+	events, err := calendar.Decode(bytes.NewReader(c.Body()))
+	if err != nil {
+		return calendarError(err)
+	}
+	for i := range events {
+		if err := problem.Validate(&events[i]); err != nil {
+			var p *problem.Problem
+			if errors.As(err, &p) {
+				p.Detail = fmt.Sprintf("Event %q of the calendar is invalid", events[i].Title)
+			}
+			return err
+		}
+	}
+	res, err := h.store.Import(c.Context(), c.Params("id"), events, c.QueryBool("replace"))
+	if err != nil {
+		return calendarError(err)
+	}
+	return c.JSON(res)
+}
+
+// GetDays handles GET /api/v1/schools/:id/calendar/days, the days from
+// from to to with whether the school, or the class given by class_id,
+// works on them
+func (h *CalendarHandler) GetDays(c *fiber.Ctx) error {
+	from, err := queryDate(c, "from")
+	if err != nil {
+		return err
+	}
+	to, err := queryDate(c, "to")
+	if err != nil {
+		return err
+	}
+	if from == "" || to == "" {
+		return problem.BadRequest(problem.CodeInvalidQuery, "from and to are required")
+	}
+	start, _ := time.Parse(calendar.DateLayout, from)
+	end, _ := time.Parse(calendar.DateLayout, to)
+	if end.Before(start) || end.Sub(start) >= calendar.MaxSpanDays*24*time.Hour {
+		return problem.BadRequest(problem.CodeInvalidQuery, fmt.Sprintf("to must be from or up to %d days after it", calendar.MaxSpanDays-1))
+	}
+
+	week, err := h.workingWeek(c.Context(), c.Params("id"))
+	if err != nil {
+		return settingsError(err)
+	}
+	events, err := h.store.List(c.Context(), c.Params("id"), from, to)
+	if err != nil {
+		return calendarError(err)
+	}
+	cal := calendar.New(week, events)
+	classID := c.Query("class_id")
+	return c.JSON(WorkingDays{
+		From:        from,
+		To:          to,
+		ClassID:     classID,
+		WorkingDays: cal.WorkingDaysBetween(classID, start, end),
+		Days:        cal.Days(classID, start, end),
+	})
+}
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+
+	"school-erp/pkg/features"
+	"school-erp/pkg/problem"
+)
+
+// FeaturesHandler handles the modules and feature flags of schools
+type FeaturesHandler struct {
+	store *features.Store
+}
+
+func NewFeaturesHandler(store *features.Store) *FeaturesHandler {
+	return &FeaturesHandler{store: store}
+}
+
+// ToggleFeatureRequest turns a module or flag on or off for a school
+type ToggleFeatureRequest struct {
+	Enabled *bool `json:"enabled" validate:"required"`
+}
+
+// PutFlagRequest defines a flag or changes its rollout
+type PutFlagRequest struct {
+	Description string `json:"description" validate:"max=500"`
+	Rollout     int    `json:"rollout_percent" validate:"min=0,max=100" doc:"Percentage of schools without a toggle of their own that get the flag"`
+}
+
+// featuresError maps store errors onto problems
+func featuresError(err error) error {
+	switch {
+	case errors.Is(err, features.ErrUnknownFeature):
+		return problem.NotFound(err.Error())
+	case errors.Is(err, features.ErrCoreModule), errors.Is(err, features.ErrNotInPlan):
+		return problem.Conflict(problem.CodeConflict, err.Error())
+	case errors.Is(err, features.ErrInvalidKey):
+		return problem.Unprocessable(problem.CodeValidationFailed, err.Error())
+	}
+	return problem.FromDB(err, "School")
+}
+
+// ListModules handles GET /api/v1/features/modules
+func (h *FeaturesHandler) ListModules(c *fiber.Ctx) error {
+	return c.JSON(features.Modules())
+}
+
+// ListFlags handles GET /api/v1/features/flags
+func (h *FeaturesHandler) ListFlags(c *fiber.Ctx) error {
+	flags, err := h.store.Flags(c.Context())
+	if err != nil {
+		return featuresError(err)
+	}
+	return c.JSON(flags)
+}
+
+// PutFlag handles PUT /api/v1/features/flags/:key
+func (h *FeaturesHandler) PutFlag(c *fiber.Ctx) error {
+	var req PutFlagRequest
+	if err := c.BodyParser(&req); err != nil {
+		return problem.BadRequest(problem.CodeInvalidBody, "Invalid request body")
+	}
+	if err := problem.Validate(&req); err != nil {
+		return err
+	}
+
+	flag := features.Flag{Key: c.Params("key"), Description: req.Description, Rollout: req.Rollout}
+	if err := h.store.PutFlag(c.Context(), flag, actor(c)); err != nil {
+		return featuresError(err)
+	}
+	return c.JSON(flag)
+}
+
+// DeleteFlag handles DELETE /api/v1/features/flags/:key
+func (h *FeaturesHandler) DeleteFlag(c *fiber.Ctx) error {
+	if err := h.store.DeleteFlag(c.Context(), c.Params("key")); err != nil {
+		return featuresError(err)
+	}
+	return c.JSON(fiber.Map{"message": "Flag deleted"})
+}
+
+// ListFeatures handles GET /api/v1/schools/:id/features
+func (h *FeaturesHandler) ListFeatures(c *fiber.Ctx) error {
+	all, err := h.store.List(c.Context(), c.Params("id"))
+	if err != nil {
+		return featuresError(err)
+	}
+	return c.JSON(all)
+}
+
+// ToggleFeature handles PUT /api/v1/schools/:id/features/:key
+func (h *FeaturesHandler) ToggleFeature(c *fiber.Ctx) error {
+	var req ToggleFeatureRequest
+	if err := c.BodyParser(&req); err != nil {
+		return problem.BadRequest(problem.CodeInvalidBody, "Invalid request body")
+	}
+	if err := problem.Validate(&req); err != nil {
+		return err
+	}
+
+	f, err := h.store.Toggle(c.Context(), c.Params("id"), c.Params("key"), *req.Enabled, actor(c))
+	if err != nil {
+		return featuresError(err)
+	}
+	return c.JSON(f)
+}
+
+// ResetFeature handles DELETE /api/v1/schools/:id/features/:key. The
+// module's default or the flag's rollout applies again.
+func (h *FeaturesHandler) ResetFeature(c *fiber.Ctx) error {
+	f, err := h.store.Reset(c.Context(), c.Params("id"), c.Params("key"))
+	if err != nil {
+		return featuresError(err)
+	}
+	return c.JSON(f)
+}
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+
+	"school-erp/pkg/features"
+	"school-erp/pkg/plans"
+	"school-erp/pkg/problem"
+	"school-erp/school/usage"
+)
+
+// PlansHandler handles subscription plans and the usage schools are metered for
+type PlansHandler struct {
+	store *plans.Store
+	meter *usage.Meter
+}
+
+func NewPlansHandler(store *plans.Store, meter *usage.Meter) *PlansHandler {
+	return &PlansHandler{store: store, meter: meter}
+}
+
+// AssignPlanRequest moves a school to another plan
+type AssignPlanRequest struct {
+	Plan string `json:"plan" validate:"required"`
+}
+
+// UsageResponse is where a school's usage stands against its plan
+type UsageResponse struct {
+	Plan  string          `json:"plan"`
+	Usage []plans.Verdict `json:"usage"`
+}
+
+// defaultSoftPercent is the soft limit of plans stored without one
+const defaultSoftPercent = 80
+
+// plansError maps store and meter errors onto problems
+func plansError(err error) error {
+	switch {
+	case errors.Is(err, plans.ErrUnknownPlan), errors.Is(err, usage.ErrNoStatement):
+		return problem.NotFound(err.Error())
+	case errors.Is(err, features.ErrUnknownFeature), errors.Is(err, usage.ErrInvalidMonth):
+		return problem.Unprocessable(problem.CodeValidationFailed, err.Error())
+	}
+	return problem.FromDB(err, "School")
+}
+
+// ListPlans handles GET /api/v1/plans
+func (h *PlansHandler) ListPlans(c *fiber.Ctx) error {
+	list, err := h.store.List(c.Context())
+	if err != nil {
+		return plansError(err)
+	}
+	return c.JSON(list)
+}
+
+// PutPlan handles PUT /api/v1/plans/:code
+func (h *PlansHandler) PutPlan(c *fiber.Ctx) error {
+	var p plans.Plan
+	if err := c.BodyParser(&p); err != nil {
+		return problem.BadRequest(problem.CodeInvalidBody, "Invalid request body")
+	}
+	p.Code = c.Params("code")
+	if err := plans.CheckCode(p.Code); err != nil {
+		return problem.Unprocessable(problem.CodeValidationFailed, err.Error())
+	}
+	if p.SoftPercent == 0 {
+		p.SoftPercent = defaultSoftPercent
+	}
+	if err := problem.Validate(&p); err != nil {
+		return err
+	}
+
+	if err := h.store.Put(c.Context(), p, actor(c)); err != nil {
+		return plansError(err)
+	}
+	return c.JSON(p)
+}
+
+// AssignPlan handles PUT /api/v1/schools/:id/plan
+func (h *PlansHandler) AssignPlan(c *fiber.Ctx) error {
+	var req AssignPlanRequest
+	if err := c.BodyParser(&req); err != nil {
+		return problem.BadRequest(problem.CodeInvalidBody, "Invalid request body")
+	}
+	if err := problem.Validate(&req); err != nil {
+		return err
+	}
+
+	p, err := h.store.Assign(c.Context(), c.Params("id"), req.Plan)
+	if err != nil {
+		return plansError(err)
+	}
+	return c.JSON(p)
+}
+
+// GetUsage handles GET /api/v1/schools/:id/usage
+func (h *PlansHandler) GetUsage(c *fiber.Ctx) error {
+	p, verdicts, err := h.meter.Current(c.Context(), c.Params("id"))
+	if err != nil {
+		return plansError(err)
+	}
+	return c.JSON(UsageResponse{Plan: p.Code, Usage: verdicts})
+}
+
+// ListStatements handles GET /api/v1/schools/:id/usage/statements
+func (h *PlansHandler) ListStatements(c *fiber.Ctx) error {
+	list, err := h.meter.Statements(c.Context(), c.Params("id"))
+	if err != nil {
+		return plansError(err)
+	}
+	return c.JSON(list)
+}
+
+// GetStatement handles GET /api/v1/schools/:id/usage/statements/:month
+func (h *PlansHandler) GetStatement(c *fiber.Ctx) error {
+	month, err := usage.ParseMonth(c.Params("month"))
+	if err != nil {
+		return plansError(err)
+	}
+	st, err := h.meter.Statement(c.Context(), c.Params("id"), month)
+	if err != nil {
+		return plansError(err)
+	}
+	return c.JSON(st)
+}
@@ -2,43 +2,59 @@ package handlers
 
 import (
 	"context"
-	"crypto/rand"
-	"encoding/base64"
+	"errors"
 	"fmt"
 	"log"
-	"os"
-	"path/filepath"
+	"regexp"
 	"time"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/gofiber/fiber/v2"
 	"github.com/jackc/pgx/v5/pgxpool"
 
-	"school-erp/school/pkg/tenant"
+	"school-erp/pkg/problem"
+	"school-erp/pkg/query"
+	"school-erp/pkg/storage"
+	"school-erp/pkg/tenant"
+	"school-erp/school/credentials"
+	"school-erp/school/domains"
+	"school-erp/school/lifecycle"
+	"school-erp/school/provisioning"
 )
 
 // SchoolHandler handles school-related requests
 type SchoolHandler struct {
-	db             *pgxpool.Pool
-	tenantManager  *tenant.TenantManager
-	validator      *validator.Validate
+	db            *pgxpool.Pool
+	tenantManager *tenant.TenantManager
+	jobs          *provisioning.PostgresStore
+	rotator       *credentials.Rotator
+	lifecycle     *lifecycle.Manager
+	domains       *domains.Service
+	files         *storage.Files
+	validator     *validator.Validate
 }
 
 // NewSchoolHandler creates a new school handler
-func NewSchoolHandler(db *pgxpool.Pool, tm *tenant.TenantManager) *SchoolHandler {
+func NewSchoolHandler(db *pgxpool.Pool, tm *tenant.TenantManager, lc *lifecycle.Manager, dm *domains.Service, files *storage.Files) *SchoolHandler {
 	return &SchoolHandler{
 		db:            db,
 		tenantManager: tm,
-		validator:     validator.New(),
+		jobs:          provisioning.NewPostgresStore(db),
+		rotator:       credentials.NewRotator(db, tm),
+		lifecycle:     lc,
+		domains:       dm,
+		files:         files,
+		validator:     problem.NewValidator(),
 	}
 }
 
 // School represents the school model in response
 type School struct {
-	ID        int64     `json:"id" db:"id"`
+	ID        string    `json:"id" db:"id"`
 	Name      string    `json:"name" db:"name"`
 	Code      string    `json:"code" db:"code"`
 	DBName    string    `json:"db_name" db:"db_name"`
+	Tenancy   string    `json:"tenancy" db:"tenancy"`
 	Domain    string    `json:"domain" db:"domain"`
 	LogoURL   string    `json:"logo_url" db:"logo_url"`
 	Timezone  string    `json:"timezone" db:"timezone"`
@@ -47,123 +63,169 @@ type School struct {
 	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
 }
 
+// SchoolListResource is the filter/sort allowlist for GET /api/v1/schools
+var SchoolListResource = &query.Resource{
+	Fields: map[string]query.Field{
+		"id":         {Column: "id", Type: query.UUID, Filter: true, Sort: true},
+		"name":       {Column: "name", Type: query.String, Filter: true, Sort: true},
+		"code":       {Column: "code", Type: query.String, Filter: true, Sort: true},
+		"db_name":    {Column: "db_name", Type: query.String},
+		"tenancy":    {Column: "tenancy", Type: query.String, Filter: true},
+		"domain":     {Column: "domain", Type: query.String, Filter: true},
+		"logo_url":   {Column: "logo_url", Type: query.String},
+		"timezone":   {Column: "timezone", Type: query.String, Filter: true},
+		"status":     {Column: "status", Type: query.String, Filter: true},
+		"created_at": {Column: "created_at", Type: query.Time, Filter: true, Sort: true},
+		"updated_at": {Column: "updated_at", Type: query.Time, Filter: true, Sort: true},
+	},
+	Key:          "id",
+	DefaultSort:  "-created_at",
+	DefaultLimit: 10,
+	MaxLimit:     100,
+}
+
 // CreateSchoolRequest is the request body for creating a school
 type CreateSchoolRequest struct {
-	Name     string `json:"name" validate:"required,min=2,max=255"`
-	Code     string `json:"code" validate:"required,min=2,max=20"`
-	Domain   string `json:"domain" validate:"required"`
-	LogoURL  string `json:"logo_url" validate:"omitempty"`
-	Timezone string `json:"timezone" validate:"required"`
-	DBUser   string `json:"db_user" validate:"omitempty"`
+	Name       string `json:"name" validate:"required,min=2,max=255"`
+	Code       string `json:"code" validate:"required,min=2,max=20" doc:"Lowercase letters, digits and hyphens"`
+	Domain     string `json:"domain" validate:"required,fqdn"`
+	LogoURL    string `json:"logo_url" validate:"omitempty"`
+	Timezone   string `json:"timezone" validate:"required"`
+	Tenancy    string `json:"tenancy" validate:"omitempty,oneof=dedicated shared"`
+	DBUser     string `json:"db_user" validate:"omitempty,max=63"`
 	DBPassword string `json:"db_password" validate:"omitempty"`
 }
 
 // UpdateSchoolRequest is the request body for updating a school
 type UpdateSchoolRequest struct {
 	Name    string `json:"name" validate:"omitempty,min=2,max=255"`
-	Domain  string `json:"domain" validate:"omitempty"`
+	Domain  string `json:"domain" validate:"omitempty,fqdn" doc:"A new domain must be verified again"`
 	LogoURL string `json:"logo_url" validate:"omitempty"`
 	Status  string `json:"status" validate:"omitempty,oneof=active inactive suspended"`
 }
 
-// CreateSchool handles POST /api/v1/schools
+// SchoolStatsResponse reports the connection pool of a tenant database
+type SchoolStatsResponse struct {
+	SchoolCode string                 `json:"school_code"`
+	Stats      map[string]interface{} `json:"stats"`
+}
+
+// CreateSchoolResponse is a created school and the job provisioning it
+type CreateSchoolResponse struct {
+	School       School           `json:"school"`
+	Provisioning provisioning.Job `json:"provisioning"`
+}
+
+// UndeleteResponse is the status an undeleted school returned to
+type UndeleteResponse struct {
+	Status string `json:"status"`
+}
+
+// PurgeSchoolRequest confirms an early purge of a deleted school
+type PurgeSchoolRequest struct {
+	ConfirmationToken string `json:"confirmation_token" validate:"required" doc:"The purge_token returned when the school was deleted"`
+}
+
+// LogoResponse is the public URL of an uploaded logo
+type LogoResponse struct {
+	URL string `json:"url"`
+}
+
+// CreateSchool handles POST /api/v1/schools. The school is created as
+// provisioning with a pending job; the provisioning worker creates its
+// database and activates it. Poll GET /api/v1/schools/:id/provisioning.
 func (h *SchoolHandler) CreateSchool(c *fiber.Ctx) error {
 	var req CreateSchoolRequest
 
 	// Parse request body
 	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid request body",
-		})
+		return problem.BadRequest(problem.CodeInvalidBody, "Invalid request body")
 	}
 
+	// Domains are matched against request hosts, which are case-insensitive
+	req.Domain = tenant.NormalizeHost(req.Domain)
+
 	// Validate request
 	if err := h.validator.Struct(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": err.Error(),
-		})
+		return problem.FromValidation(err)
+	}
+	// Codes name databases, users and subdomains
+	if err := validateNames(req); err != nil {
+		return err
 	}
 
 	ctx := context.Background()
 
-	// Auto-generate database credentials if not provided
-	dbUser := req.DBUser
-	dbPassword := req.DBPassword
-
-	if dbUser == "" {
-		dbUser = fmt.Sprintf("school_%s_user", req.Code)
+	tenancy := req.Tenancy
+	if tenancy == "" {
+		tenancy = tenant.Dedicated
 	}
 
-	if dbPassword == "" {
-		// Generate a secure random password (16 characters)
-		dbPassword = generateRandomPassword(16)
-	}
+	// Generate database name; it is created on the admin connection's server
+	dbName := tenant.DatabaseName(req.Code)
+	dbHost, dbPort := h.tenantManager.AdminHost()
 
-	// Generate database name
-	dbName := fmt.Sprintf("school_%s_db", req.Code)
+	// Shared schools live in the main database and have no credentials
+	var dbUser, encryptedPassword string
+	if tenancy == tenant.Dedicated {
+		// Auto-generate database credentials if not provided
+		dbUser = req.DBUser
+		dbPassword := req.DBPassword
 
-	// Encrypt password
-	encryptedPassword, err := h.tenantManager.EncryptPassword(dbPassword)
-	if err != nil {
-		log.Printf("Failed to encrypt password: %v\n", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to process school setup",
-		})
-	}
+		if dbUser == "" {
+			dbUser = tenant.UserName(req.Code)
+		}
 
-	// Create tenant database
-	if err := h.tenantManager.CreateTenantDatabase(ctx, h.db, req.Code, dbName, dbUser, dbPassword); err != nil {
-		log.Printf("Failed to create tenant database: %v\n", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to create database",
-		})
-	}
+		var err error
+		if dbPassword == "" {
+			// Generate a secure random password
+			if dbPassword, err = tenant.GeneratePassword(); err != nil {
+				return problem.Internal("Failed to process school setup", err)
+			}
+		}
 
-	// Get tenant connection and run migrations
-	tenantDB, err := h.tenantManager.GetConnection(ctx, req.Code, "postgres", 5432, dbName, dbUser, encryptedPassword)
-	if err != nil {
-		log.Printf("Failed to get tenant connection: %v\n", err)
-		// Try to drop the database since migrations failed
-		h.tenantManager.DropTenantDatabase(ctx, h.db, req.Code, dbName)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to connect to database",
-		})
+		// Encrypt password
+		encryptedPassword, err = h.tenantManager.EncryptPassword(dbPassword)
+		if err != nil {
+			log.Printf("Failed to encrypt password: %v\n", err)
+			return problem.Internal("Failed to process school setup", err)
+		}
 	}
 
-	// Run tenant migrations
-	if err := RunTenantMigrations(ctx, tenantDB); err != nil {
-		log.Printf("Failed to run tenant migrations: %v\n", err)
-		h.tenantManager.DropTenantDatabase(ctx, h.db, req.Code, dbName)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to initialize database schema",
-		})
+	tx, err := h.db.Begin(ctx)
+	if err != nil {
+		return problem.FromDB(err, "School")
 	}
+	defer tx.Rollback(ctx)
 
 	// Insert school record in main database
 	query := `
-	INSERT INTO schools (name, code, db_name, db_user, db_password, db_host, db_port, domain, logo_url, timezone, status)
-	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
-	RETURNING id, name, code, db_name, domain, logo_url, timezone, status, created_at, updated_at
+	INSERT INTO schools (name, code, db_name, tenancy, db_user, db_password, db_host, db_port, domain, logo_url, timezone, status)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+	RETURNING id, name, code, db_name, tenancy, domain, logo_url, timezone, status, created_at, updated_at
 	`
 
-	var school School
-	err = h.db.QueryRow(ctx, query,
+	var resp CreateSchoolResponse
+	school := &resp.School
+	err = tx.QueryRow(ctx, query,
 		req.Name,
 		req.Code,
 		dbName,
+		tenancy,
 		dbUser,
 		encryptedPassword,
-		"postgres",
-		5432,
+		dbHost,
+		dbPort,
 		req.Domain,
 		req.LogoURL,
 		req.Timezone,
-		"active",
+		"provisioning",
 	).Scan(
 		&school.ID,
 		&school.Name,
 		&school.Code,
 		&school.DBName,
+		&school.Tenancy,
 		&school.Domain,
 		&school.LogoURL,
 		&school.Timezone,
@@ -174,42 +236,84 @@ func (h *SchoolHandler) CreateSchool(c *fiber.Ctx) error {
 
 	if err != nil {
 		log.Printf("Failed to insert school: %v\n", err)
-		h.tenantManager.DropTenantDatabase(ctx, h.db, req.Code, dbName)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to save school record",
-		})
+		return problem.FromDB(err, "School")
+	}
+
+	job, err := provisioning.Enqueue(ctx, tx, school.ID)
+	if err != nil {
+		log.Printf("Failed to enqueue provisioning: %v\n", err)
+		return problem.FromDB(err, "Provisioning job")
+	}
+	resp.Provisioning = *job
+
+	if err := tx.Commit(ctx); err != nil {
+		return problem.FromDB(err, "School")
+	}
+
+	c.Location("/api/v1/schools/" + school.ID + "/provisioning")
+	return c.Status(fiber.StatusAccepted).JSON(resp)
+}
+
+// RotateCredentials handles POST /api/v1/schools/:id/rotate-credentials.
+// Services switch to the new password on the school's next request.
+func (h *SchoolHandler) RotateCredentials(c *fiber.Ctx) error {
+	rotation, err := h.rotator.Rotate(c.Context(), c.Params("id"))
+	switch {
+	case errors.Is(err, credentials.ErrShared), errors.Is(err, credentials.ErrNotProvisioned), errors.Is(err, credentials.ErrDeleted):
+		return problem.Conflict(problem.CodeConflict, err.Error())
+	case err != nil:
+		log.Printf("Failed to rotate credentials: %v\n", err)
+		return problem.FromDB(err, "School")
+	}
+	return c.JSON(rotation)
+}
+
+// dbUserPattern allows the database user names Postgres accepts unquoted
+var dbUserPattern = regexp.MustCompile(`^[a-z_][a-z0-9_]{0,62}$`)
+
+// validateNames checks the request's names that end up in DDL; DDL quotes
+// them regardless
+func validateNames(req CreateSchoolRequest) error {
+	p := problem.Unprocessable(problem.CodeValidationFailed, "Request validation failed")
+	if err := tenant.ValidateCode(req.Code); err != nil {
+		p.Errors = append(p.Errors, problem.FieldError{Field: "code", Code: "format", Message: err.Error()})
+	}
+	if req.DBUser != "" && !dbUserPattern.MatchString(req.DBUser) {
+		p.Errors = append(p.Errors, problem.FieldError{Field: "db_user", Code: "format",
+			Message: "must start with a lowercase letter or underscore and contain only lowercase letters, digits and underscores"})
 	}
+	if len(p.Errors) > 0 {
+		return p
+	}
+	return nil
+}
 
-	return c.Status(fiber.StatusCreated).JSON(school)
+// GetProvisioning handles GET /api/v1/schools/:id/provisioning
+func (h *SchoolHandler) GetProvisioning(c *fiber.Ctx) error {
+	job, err := h.jobs.Get(c.Context(), c.Params("id"))
+	if err != nil {
+		return problem.FromDB(err, "Provisioning job")
+	}
+	return c.JSON(job)
 }
 
 // GetSchools handles GET /api/v1/schools
 func (h *SchoolHandler) GetSchools(c *fiber.Ctx) error {
 	ctx := context.Background()
 
-	// Get pagination params
-	limit := c.QueryInt("limit", 10)
-	offset := c.QueryInt("offset", 0)
-
-	// Validate pagination
-	if limit > 100 {
-		limit = 100
+	spec, err := query.FromCtx(c, SchoolListResource)
+	if err != nil {
+		return problem.BadRequest(problem.CodeInvalidQuery, err.Error())
 	}
 
-	query := `
-	SELECT id, name, code, db_name, domain, COALESCE(logo_url, ''), timezone, status, created_at, updated_at
-	FROM schools
-	WHERE status != 'suspended'
-	ORDER BY created_at DESC
-	LIMIT $1 OFFSET $2
-	`
+	sql, args := spec.Query(`
+	SELECT id, name, code, db_name, tenancy, domain, COALESCE(logo_url, ''), timezone, status, created_at, updated_at
+	FROM schools`, []string{"status != 'suspended'"})
 
-	rows, err := h.db.Query(ctx, query, limit, offset)
+	rows, err := h.db.Query(ctx, sql, args...)
 	if err != nil {
 		log.Printf("Failed to fetch schools: %v\n", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to fetch schools",
-		})
+		return problem.Internal("Failed to fetch schools", err)
 	}
 	defer rows.Close()
 
@@ -221,6 +325,7 @@ func (h *SchoolHandler) GetSchools(c *fiber.Ctx) error {
 			&school.Name,
 			&school.Code,
 			&school.DBName,
+			&school.Tenancy,
 			&school.Domain,
 			&school.LogoURL,
 			&school.Timezone,
@@ -234,13 +339,13 @@ func (h *SchoolHandler) GetSchools(c *fiber.Ctx) error {
 		schools = append(schools, school)
 	}
 
-	return c.JSON(fiber.Map{
-		"data": schools,
-		"pagination": fiber.Map{
-			"limit":  limit,
-			"offset": offset,
-		},
-	})
+	page, err := query.NewPage(spec, schools)
+	if err != nil {
+		log.Printf("Failed to build schools page: %v\n", err)
+		return problem.Internal("Failed to fetch schools", err)
+	}
+
+	return c.JSON(page)
 }
 
 // GetSchool handles GET /api/v1/schools/:id
@@ -249,7 +354,7 @@ func (h *SchoolHandler) GetSchool(c *fiber.Ctx) error {
 	ctx := context.Background()
 
 	query := `
-	SELECT id, name, code, db_name, domain, COALESCE(logo_url, ''), timezone, status, created_at, updated_at
+	SELECT id, name, code, db_name, tenancy, domain, COALESCE(logo_url, ''), timezone, status, created_at, updated_at
 	FROM schools
 	WHERE id = $1
 	`
@@ -260,6 +365,7 @@ func (h *SchoolHandler) GetSchool(c *fiber.Ctx) error {
 		&school.Name,
 		&school.Code,
 		&school.DBName,
+		&school.Tenancy,
 		&school.Domain,
 		&school.LogoURL,
 		&school.Timezone,
@@ -269,9 +375,7 @@ func (h *SchoolHandler) GetSchool(c *fiber.Ctx) error {
 	)
 
 	if err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error": "School not found",
-		})
+		return problem.FromDB(err, "School")
 	}
 
 	return c.JSON(school)
@@ -283,9 +387,13 @@ func (h *SchoolHandler) UpdateSchool(c *fiber.Ctx) error {
 	var req UpdateSchoolRequest
 
 	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid request body",
-		})
+		return problem.BadRequest(problem.CodeInvalidBody, "Invalid request body")
+	}
+	req.Domain = tenant.NormalizeHost(req.Domain)
+
+	// Validate request
+	if err := h.validator.Struct(&req); err != nil {
+		return problem.FromValidation(err)
 	}
 
 	ctx := context.Background()
@@ -301,7 +409,10 @@ func (h *SchoolHandler) UpdateSchool(c *fiber.Ctx) error {
 		argIndex++
 	}
 	if req.Domain != "" {
-		updateFields += fmt.Sprintf(", domain = $%d", argIndex)
+		// A changed domain loses its verification
+		updateFields += fmt.Sprintf(`, domain = $%[1]d,
+		domain_verification_token = CASE WHEN domain = $%[1]d THEN domain_verification_token END,
+		domain_verified_at = CASE WHEN domain = $%[1]d THEN domain_verified_at END`, argIndex)
 		args = append(args, req.Domain)
 		argIndex++
 	}
@@ -317,16 +428,15 @@ func (h *SchoolHandler) UpdateSchool(c *fiber.Ctx) error {
 	}
 
 	if updateFields == "" {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "No fields to update",
-		})
+		return problem.BadRequest(problem.CodeBadRequest, "No fields to update")
 	}
 
+	// Deleted schools must be undeleted before they can be changed
 	query := fmt.Sprintf(`
 	UPDATE schools
 	SET updated_at = CURRENT_TIMESTAMP %s
-	WHERE id = $1
-	RETURNING id, name, code, db_name, domain, logo_url, timezone, status, created_at, updated_at
+	WHERE id = $1 AND status NOT IN ('deleted', 'purging', 'archived')
+	RETURNING id, name, code, db_name, tenancy, domain, logo_url, timezone, status, created_at, updated_at
 	`, updateFields)
 
 	var school School
@@ -335,6 +445,7 @@ func (h *SchoolHandler) UpdateSchool(c *fiber.Ctx) error {
 		&school.Name,
 		&school.Code,
 		&school.DBName,
+		&school.Tenancy,
 		&school.Domain,
 		&school.LogoURL,
 		&school.Timezone,
@@ -344,134 +455,136 @@ func (h *SchoolHandler) UpdateSchool(c *fiber.Ctx) error {
 	)
 
 	if err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error": "School not found",
-		})
+		return problem.FromDB(err, "School")
+	}
+	if req.Domain != "" || req.Status != "" {
+		h.domains.Announce(ctx, school.ID)
 	}
 
 	return c.JSON(school)
 }
 
-// DeleteSchool handles DELETE /api/v1/schools/:id
+// DeleteSchool handles DELETE /api/v1/schools/:id. The school stops being
+// served but is only purged after the grace period, or earlier with
+// POST /api/v1/schools/:id/purge and the returned purge_token.
 func (h *SchoolHandler) DeleteSchool(c *fiber.Ctx) error {
-	schoolID := c.Params("id")
-	ctx := context.Background()
-
-	// Get school info first
-	var code, dbName string
-	query := `SELECT code, db_name FROM schools WHERE id = $1`
-	err := h.db.QueryRow(ctx, query, schoolID).Scan(&code, &dbName)
-	if err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error": "School not found",
-		})
+	deletion, err := h.lifecycle.Delete(c.Context(), c.Params("id"), actor(c))
+	switch {
+	case errors.Is(err, lifecycle.ErrNotDeletable):
+		return problem.Conflict(problem.CodeConflict, err.Error())
+	case err != nil:
+		log.Printf("Failed to delete school: %v\n", err)
+		return problem.FromDB(err, "School")
 	}
+	h.domains.Announce(c.Context(), deletion.SchoolID)
+	return c.JSON(deletion)
+}
 
-	// Delete school record
-	deleteQuery := `DELETE FROM schools WHERE id = $1`
-	if _, err := h.db.Exec(ctx, deleteQuery, schoolID); err != nil {
-		log.Printf("Failed to delete school: %v\n", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to delete school",
-		})
+// UndeleteSchool handles POST /api/v1/schools/:id/undelete
+func (h *SchoolHandler) UndeleteSchool(c *fiber.Ctx) error {
+	status, err := h.lifecycle.Undelete(c.Context(), c.Params("id"), actor(c))
+	switch {
+	case errors.Is(err, lifecycle.ErrNotDeleted):
+		return problem.Conflict(problem.CodeConflict, err.Error())
+	case err != nil:
+		log.Printf("Failed to undelete school: %v\n", err)
+		return problem.FromDB(err, "School")
 	}
+	h.domains.Announce(c.Context(), c.Params("id"))
+	return c.JSON(UndeleteResponse{Status: status})
+}
 
-	// Drop tenant database (async, don't wait)
-	go func() {
-		if err := h.tenantManager.DropTenantDatabase(context.Background(), h.db, code, dbName); err != nil {
-			log.Printf("Failed to drop tenant database: %v\n", err)
-		}
-	}()
+// PurgeSchool handles POST /api/v1/schools/:id/purge. The purge, which
+// takes a final backup first, runs in the background.
+func (h *SchoolHandler) PurgeSchool(c *fiber.Ctx) error {
+	var req PurgeSchoolRequest
+	if err := c.BodyParser(&req); err != nil {
+		return problem.BadRequest(problem.CodeInvalidBody, "Invalid request body")
+	}
+	if err := h.validator.Struct(&req); err != nil {
+		return problem.FromValidation(err)
+	}
 
-	return c.JSON(fiber.Map{
-		"message": "School deleted successfully",
+	err := h.lifecycle.Purge(c.Context(), c.Params("id"), req.ConfirmationToken, actor(c))
+	switch {
+	case errors.Is(err, lifecycle.ErrToken):
+		return problem.Forbidden(problem.CodeForbidden, err.Error())
+	case errors.Is(err, lifecycle.ErrNotDeleted):
+		return problem.Conflict(problem.CodeConflict, err.Error())
+	case err != nil:
+		log.Printf("Failed to purge school: %v\n", err)
+		return problem.FromDB(err, "School")
+	}
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"message": "School purge started",
 	})
 }
 
+// DomainChallenge handles POST /api/v1/schools/:id/domain/challenge. It
+// returns the DNS TXT record to publish before verifying the domain.
+func (h *SchoolHandler) DomainChallenge(c *fiber.Ctx) error {
+	challenge, err := h.domains.Challenge(c.Context(), c.Params("id"))
+	if err != nil {
+		return problem.FromDB(err, "School")
+	}
+	return c.JSON(challenge)
+}
+
+// VerifyDomain handles POST /api/v1/schools/:id/domain/verify. Once the
+// challenge record is found, requests for the domain reach the school.
+func (h *SchoolHandler) VerifyDomain(c *fiber.Ctx) error {
+	challenge, err := h.domains.Verify(c.Context(), c.Params("id"))
+	switch {
+	case errors.Is(err, domains.ErrNoChallenge):
+		return problem.Conflict(problem.CodeConflict, err.Error())
+	case errors.Is(err, domains.ErrNotVerified):
+		return problem.Unprocessable(problem.CodeDomainUnverified, err.Error())
+	case err != nil:
+		log.Printf("Failed to verify domain: %v\n", err)
+		return problem.FromDB(err, "School")
+	}
+	return c.JSON(challenge)
+}
+
+// actor is who made the request, as forwarded by the gateway
+func actor(c *fiber.Ctx) string {
+	if id := c.Get("X-User-ID"); id != "" {
+		return "user:" + id
+	}
+	return "api"
+}
+
 // GetSchoolStats handles GET /api/v1/schools/:id/stats
 func (h *SchoolHandler) GetSchoolStats(c *fiber.Ctx) error {
 	schoolCode := c.Params("code")
 
 	stats := h.tenantManager.GetStats(schoolCode)
 	if stats == nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error": "School not found or not connected",
-		})
+		return problem.NotFound("School not found or not connected")
 	}
 
-	return c.JSON(fiber.Map{
-		"school_code": schoolCode,
-		"stats":       stats,
+	return c.JSON(SchoolStatsResponse{
+		SchoolCode: schoolCode,
+		Stats:      stats,
 	})
 }
 
-// UploadLogo handles POST /api/v1/schools/upload-logo
+// UploadLogo handles POST /api/v1/schools/upload-logo. Logos are shown
+// before sign-in, so they are stored under the public prefix and served
+// without a signature.
 func (h *SchoolHandler) UploadLogo(c *fiber.Ctx) error {
-	// Get the uploaded file
-	file, err := c.FormFile("logo")
+	data, err := storage.Upload(c, "logo", storage.LogoPolicy)
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "No file uploaded",
-		})
-	}
-
-	// Validate file type
-	ext := filepath.Ext(file.Filename)
-	allowedExts := map[string]bool{
-		".jpg":  true,
-		".jpeg": true,
-		".png":  true,
-		".gif":  true,
-		".webp": true,
+		return err
 	}
-
-	if !allowedExts[ext] {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "Invalid file type. Allowed: jpg, jpeg, png, gif, webp",
-		})
-	}
-
-	// Validate file size (5MB)
-	if file.Size > 5*1024*1024 {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"error": "File size exceeds 5MB",
-		})
-	}
-
-	// Create uploads directory if it doesn't exist
-	uploadsDir := "/app/uploads"
-	if err := os.MkdirAll(uploadsDir, 0755); err != nil {
-		log.Printf("Failed to create uploads directory: %v\n", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to create uploads directory",
-		})
-	}
-
-	// Generate unique filename
-	filename := fmt.Sprintf("school-logo-%d%s", time.Now().UnixNano(), ext)
-	filePath := filepath.Join(uploadsDir, filename)
-
-	// Save the file
-	if err := c.SaveFile(file, filePath); err != nil {
-		log.Printf("Failed to save file: %v\n", err)
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to save file",
-		})
+	file, err := h.files.Save(c.Context(), storage.PublicPrefix, "logos", data, storage.LogoPolicy)
+	if err != nil {
+		return storage.Problem(err)
 	}
-
-	// Return the URL
-	url := fmt.Sprintf("/uploads/%s", filename)
-	return c.JSON(fiber.Map{
-		"url": url,
-	})
+	return c.JSON(LogoResponse{URL: logoURL(file.Key)})
 }
 
-// generateRandomPassword generates a secure random password
-func generateRandomPassword(length int) string {
-	bytes := make([]byte, length)
-	if _, err := rand.Read(bytes); err != nil {
-		log.Printf("Failed to generate random password: %v\n", err)
-		return "defaultPassword123!" // Fallback
-	}
-	return base64.URLEncoding.EncodeToString(bytes)[:length]
+// logoURL returns the URL of the public file under key
+func logoURL(key string) string {
+	return "/uploads/" + key
 }
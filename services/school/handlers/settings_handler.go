@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+
+	"school-erp/pkg/problem"
+	"school-erp/pkg/settings"
+)
+
+// SettingsHandler handles the per-school settings
+type SettingsHandler struct {
+	store *settings.Store
+}
+
+func NewSettingsHandler(store *settings.Store) *SettingsHandler {
+	return &SettingsHandler{store: store}
+}
+
+// UpdateSettingsRequest replaces a namespace's settings
+type UpdateSettingsRequest struct {
+	Version  *int            `json:"version" doc:"The version the change is based on; the change is refused with 409 when it is not current"`
+	Settings json.RawMessage `json:"settings" doc:"Omitted properties take their defaults; see GET /api/v1/settings/schemas/{namespace}"`
+}
+
+// maxHistory bounds the versions GetSettingsHistory returns
+const maxHistory = 100
+
+// settingsError maps store errors onto problems
+func settingsError(err error) error {
+	var p *problem.Problem
+	switch {
+	case errors.As(err, &p):
+		return p
+	case errors.Is(err, settings.ErrUnknownNamespace):
+		return problem.NotFound(err.Error())
+	case errors.Is(err, settings.ErrVersionConflict):
+		return problem.Conflict(problem.CodeConflict, err.Error())
+	}
+	return problem.FromDB(err, "School")
+}
+
+// ListSettings handles GET /api/v1/schools/:id/settings
+func (h *SettingsHandler) ListSettings(c *fiber.Ctx) error {
+	docs, err := h.store.List(c.Context(), c.Params("id"))
+	if err != nil {
+		return settingsError(err)
+	}
+	return c.JSON(docs)
+}
+
+// GetSettings handles GET /api/v1/schools/:id/settings/:namespace
+func (h *SettingsHandler) GetSettings(c *fiber.Ctx) error {
+	doc, err := h.store.Get(c.Context(), c.Params("id"), c.Params("namespace"))
+	if err != nil {
+		return settingsError(err)
+	}
+	return c.JSON(doc)
+}
+
+// UpdateSettings handles PUT /api/v1/schools/:id/settings/:namespace
+func (h *SettingsHandler) UpdateSettings(c *fiber.Ctx) error {
+	var req UpdateSettingsRequest
+	if err := c.BodyParser(&req); err != nil {
+		return problem.BadRequest(problem.CodeInvalidBody, "Invalid request body")
+	}
+	if len(req.Settings) == 0 {
+		return problem.Unprocessable(problem.CodeValidationFailed, "settings is required")
+	}
+
+	doc, err := h.store.Put(c.Context(), c.Params("id"), c.Params("namespace"), req.Settings, req.Version, actor(c))
+	if err != nil {
+		return settingsError(err)
+	}
+	return c.JSON(doc)
+}
+
+// GetSettingsHistory handles GET /api/v1/schools/:id/settings/:namespace/history
+func (h *SettingsHandler) GetSettingsHistory(c *fiber.Ctx) error {
+	limit := 20
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxHistory {
+			return problem.BadRequest(problem.CodeInvalidQuery, fmt.Sprintf("limit must be between 1 and %d", maxHistory))
+		}
+		limit = n
+	}
+
+	docs, err := h.store.History(c.Context(), c.Params("id"), c.Params("namespace"), limit)
+	if err != nil {
+		return settingsError(err)
+	}
+	return c.JSON(docs)
+}
+
+// GetSettingsSchema handles GET /api/v1/settings/schemas/:namespace
+func (h *SettingsHandler) GetSettingsSchema(c *fiber.Ctx) error {
+	model, err := settings.Schema(c.Params("namespace"))
+	if err != nil {
+		return settingsError(err)
+	}
+	return c.JSON(model)
+}
@@ -0,0 +1,442 @@
+// Package lifecycle deletes schools. A deleted school is no longer served
+// but keeps its database for a grace period, during which it can be
+// undeleted. Then the purge job takes a final backup, drops the database and
+// archives the school; its row stays to keep its code and audit trail.
+//
+//	active, inactive, suspended --Delete--> deleted --Undelete--> (previous)
+//	deleted --grace period or Purge with token--> purging --> archived
+//
+// Shared schools have no database of their own: purging deletes their rows
+// from the shared tables, which the main database's backups cover.
+package lifecycle
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"school-erp/pkg/tenant"
+	"school-erp/school/backup"
+)
+
+// Statuses of the lifecycle, besides those of tenant.Directory
+const (
+	StatusDeleted  = "deleted"
+	StatusPurging  = "purging"
+	StatusArchived = "archived"
+)
+
+var (
+	// ErrNotDeletable is returned for schools that are provisioning, failed
+	// or already deleted
+	ErrNotDeletable = errors.New("school cannot be deleted in its current status")
+	// ErrNotDeleted is returned when undeleting or purging a school that is
+	// not deleted
+	ErrNotDeleted = errors.New("school is not deleted")
+	// ErrToken is returned for a wrong purge confirmation token
+	ErrToken = errors.New("purge confirmation token does not match")
+)
+
+// PurgeActor is the actor the purge job records
+const PurgeActor = "purge-job"
+
+// pgForeignKeyViolation is the SQLSTATE of foreign_key_violation
+const pgForeignKeyViolation = "23503"
+
+// purgeLease is how long a purge may run before another replica retakes it
+const purgeLease = 6 * time.Hour
+
+// Deletion is a deleted school
+type Deletion struct {
+	SchoolID   string    `json:"school_id"`
+	Code       string    `json:"code"`
+	Status     string    `json:"status"`
+	DeletedAt  time.Time `json:"deleted_at"`
+	PurgeAfter time.Time `json:"purge_after"`
+	// PurgeToken confirms an early purge; it is only returned by Delete
+	PurgeToken string `json:"purge_token,omitempty"`
+}
+
+// Manager moves schools through their lifecycle
+type Manager struct {
+	db *pgxpool.Pool
+	tm *tenant.TenantManager
+	// backups takes final backups; dedicated schools are not purged without
+	backups *backup.Service
+	grace   time.Duration
+}
+
+// NewManager returns a Manager that purges deleted schools after grace.
+// backups may be nil, in which case dedicated schools stay deleted.
+func NewManager(db *pgxpool.Pool, tm *tenant.TenantManager, backups *backup.Service, grace time.Duration) *Manager {
+	return &Manager{db: db, tm: tm, backups: backups, grace: grace}
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// checkToken returns ErrToken unless token hashes to hash, the stored hash
+// of a deleted school's purge token
+func checkToken(hash *string, token string) error {
+	if hash == nil || subtle.ConstantTimeCompare([]byte(*hash), []byte(hashToken(token))) != 1 {
+		return ErrToken
+	}
+	return nil
+}
+
+// deletable reports whether a school in status may be deleted; provisioning
+// and failed schools are not, nor are schools deleted already
+func deletable(status string) bool {
+	return status == "active" || status == "inactive" || status == "suspended"
+}
+
+// Delete soft-deletes the school and returns the token that confirms an
+// early purge. It returns pgx.ErrNoRows for unknown schools.
+func (m *Manager) Delete(ctx context.Context, schoolID, actor string) (*Deletion, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return nil, fmt.Errorf("failed to generate token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+
+	tx, err := m.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	d := &Deletion{SchoolID: schoolID, Status: StatusDeleted, PurgeToken: token}
+	var status string
+	if err := tx.QueryRow(ctx, `SELECT code, status FROM schools WHERE id = $1 FOR UPDATE`, schoolID).Scan(&d.Code, &status); err != nil {
+		return nil, err
+	}
+	if !deletable(status) {
+		return nil, fmt.Errorf("%w: %s", ErrNotDeletable, status)
+	}
+	err = tx.QueryRow(ctx, `
+	UPDATE schools
+	SET status = $2, status_before_delete = status, deleted_at = NOW(),
+		purge_after = NOW() + make_interval(secs => $3), purge_token_hash = $4, purge_error = NULL
+	WHERE id = $1 RETURNING deleted_at, purge_after`,
+		schoolID, StatusDeleted, m.grace.Seconds(), hashToken(token),
+	).Scan(&d.DeletedAt, &d.PurgeAfter)
+	if err != nil {
+		return nil, err
+	}
+	if err := audit(ctx, tx, schoolID, actor, "deleted", map[string]any{"status": status, "purge_after": d.PurgeAfter}); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	// Services stop serving the school on its next request; free its pool here
+	m.tm.CloseConnection(d.Code)
+	return d, nil
+}
+
+// Undelete returns a deleted school to its status before Delete and
+// returns that status
+func (m *Manager) Undelete(ctx context.Context, schoolID, actor string) (string, error) {
+	tx, err := m.db.Begin(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback(ctx)
+
+	var status string
+	err = tx.QueryRow(ctx, `
+	UPDATE schools
+	SET status = COALESCE(status_before_delete, 'inactive'), status_before_delete = NULL,
+		deleted_at = NULL, purge_after = NULL, purge_token_hash = NULL, purge_error = NULL
+	WHERE id = $1 AND status = $2 RETURNING status`, schoolID, StatusDeleted,
+	).Scan(&status)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", m.notDeleted(ctx, schoolID)
+	}
+	if err != nil {
+		return "", err
+	}
+	if err := audit(ctx, tx, schoolID, actor, "undeleted", map[string]any{"status": status}); err != nil {
+		return "", err
+	}
+	return status, tx.Commit(ctx)
+}
+
+// notDeleted returns ErrNotDeleted for existing schools and pgx.ErrNoRows
+// otherwise
+func (m *Manager) notDeleted(ctx context.Context, schoolID string) error {
+	var status string
+	if err := m.db.QueryRow(ctx, `SELECT status FROM schools WHERE id = $1`, schoolID).Scan(&status); err != nil {
+		return err
+	}
+	return fmt.Errorf("%w: %s", ErrNotDeleted, status)
+}
+
+// Purge confirms an early purge of a deleted school with the token Delete
+// returned, and starts it in the background. The school is purged by the
+// next run of the purge job if this process stops first.
+func (m *Manager) Purge(ctx context.Context, schoolID, token, actor string) error {
+	tx, err := m.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var hash *string
+	err = tx.QueryRow(ctx, `SELECT purge_token_hash FROM schools WHERE id = $1 AND status = $2 FOR UPDATE`,
+		schoolID, StatusDeleted).Scan(&hash)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return m.notDeleted(ctx, schoolID)
+	}
+	if err != nil {
+		return err
+	}
+	if err := checkToken(hash, token); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `UPDATE schools SET purge_after = NOW() WHERE id = $1`, schoolID); err != nil {
+		return err
+	}
+	if err := audit(ctx, tx, schoolID, actor, "purge_confirmed", map[string]any{}); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+
+	go func() {
+		if _, err := m.PurgeDue(context.Background()); err != nil {
+			log.Printf("Purge of school %s: %v\n", schoolID, err)
+		}
+	}()
+	return nil
+}
+
+// purgeable is a school claimed for purging
+type purgeable struct {
+	id, code, tenancy, dbName, dbUser, dbHost string
+	dbPort                                    int
+	sharedID                                  int64
+}
+
+// claim marks the deleted school due longest ago as purging; it returns nil
+// when none is due. Purges abandoned for purgeLease are taken over.
+func (m *Manager) claim(ctx context.Context) (*purgeable, error) {
+	var p purgeable
+	err := m.db.QueryRow(ctx, `
+	UPDATE schools SET status = $1
+	WHERE id = (
+		SELECT id FROM schools
+		WHERE (status = $2 AND purge_after <= NOW())
+			OR (status = $1 AND updated_at < NOW() - make_interval(secs => $3))
+		ORDER BY purge_after LIMIT 1 FOR UPDATE SKIP LOCKED
+	)
+	RETURNING id::text, code, tenancy, db_name, db_user, db_host, db_port, shared_id`,
+		StatusPurging, StatusDeleted, purgeLease.Seconds(),
+	).Scan(&p.id, &p.code, &p.tenancy, &p.dbName, &p.dbUser, &p.dbHost, &p.dbPort, &p.sharedID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// PurgeDue purges every deleted school whose grace period is over and
+// returns how many were purged. A school that fails is left deleted, with
+// the error in purge_error, and retried by the next run.
+func (m *Manager) PurgeDue(ctx context.Context) (int, error) {
+	purged := 0
+	var failed []string
+	defer func() {
+		// Failed schools were skipped this run; make them due again
+		if len(failed) > 0 {
+			_, _ = m.db.Exec(context.WithoutCancel(ctx),
+				`UPDATE schools SET status = $2 WHERE id::text = ANY($1) AND status = $3`, failed, StatusDeleted, StatusPurging)
+		}
+	}()
+
+	for ctx.Err() == nil {
+		p, err := m.claim(ctx)
+		if err != nil {
+			return purged, fmt.Errorf("failed to claim school: %w", err)
+		}
+		if p == nil {
+			return purged, nil
+		}
+		if err := m.purge(ctx, p); err != nil {
+			log.Printf("Failed to purge school %s: %v\n", p.code, err)
+			failed = append(failed, p.id)
+			// Keep it purging until this run ends, so it is not claimed again
+			_, _ = m.db.Exec(ctx, `UPDATE schools SET purge_error = $2 WHERE id = $1`, p.id, err.Error())
+			continue
+		}
+		log.Printf("Purged school %s\n", p.code)
+		purged++
+	}
+	return purged, ctx.Err()
+}
+
+// dropDatabase drops a dedicated school's database and user on the server
+// of its database, which need not be the main database's
+func (m *Manager) dropDatabase(ctx context.Context, p *purgeable) error {
+	admin, err := m.tm.HostAdmin(ctx, p.dbHost, p.dbPort)
+	if err != nil {
+		return err
+	}
+	defer admin.Close()
+	if err := m.tm.DropTenantDatabase(ctx, admin, p.code, p.dbName); err != nil {
+		return err
+	}
+	return m.tm.DropTenantUser(ctx, admin, p.dbUser)
+}
+
+// purge backs up and drops a claimed school's data and archives it
+func (m *Manager) purge(ctx context.Context, p *purgeable) error {
+	var finalBackup *string
+	switch p.tenancy {
+	case tenant.Dedicated:
+		if m.backups == nil {
+			return errors.New("no backup storage is configured for the final backup")
+		}
+		b, err := m.backups.Backup(ctx, p.id, PurgeActor)
+		if err != nil {
+			return fmt.Errorf("final backup failed: %w", err)
+		}
+		finalBackup = &b.ID
+		if err := m.dropDatabase(ctx, p); err != nil {
+			return err
+		}
+	case tenant.Shared:
+		if err := m.deleteSharedRows(ctx, p.sharedID); err != nil {
+			return err
+		}
+	}
+
+	tx, err := m.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	_, err = tx.Exec(ctx, `
+	UPDATE schools
+	SET status = $2, archived_at = NOW(), final_backup_id = $3, purge_token_hash = NULL, purge_error = NULL
+	WHERE id = $1`, p.id, StatusArchived, finalBackup)
+	if err != nil {
+		return err
+	}
+	// The archived row keeps who the school was, not how it was configured
+	if _, err := tx.Exec(ctx, `DELETE FROM school_settings_history WHERE school_id = $1`, p.id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM school_settings WHERE school_id = $1`, p.id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM school_features WHERE school_id = $1`, p.id); err != nil {
+		return err
+	}
+	if err := audit(ctx, tx, p.id, PurgeActor, "purged", map[string]any{"final_backup_id": finalBackup}); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// deleteSharedRows deletes a shared school's rows from every table under
+// row-level security (see tenant.RLSMigration)
+func (m *Manager) deleteSharedRows(ctx context.Context, sharedID int64) error {
+	tx, err := m.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `
+	SELECT schemaname::text, tablename::text FROM pg_policies WHERE policyname = 'tenant_isolation'`)
+	if err != nil {
+		return err
+	}
+	tables, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (pgx.Identifier, error) {
+		var schema, table string
+		err := row.Scan(&schema, &table)
+		return pgx.Identifier{schema, table}, err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list shared tables: %w", err)
+	}
+	// Tables are deleted from in passes: one referenced by another school
+	// table fails until the referencing rows are gone
+	for len(tables) > 0 {
+		var blocked []pgx.Identifier
+		var lastErr error
+		for _, table := range tables {
+			if err := deleteRows(ctx, tx, table, sharedID); err != nil {
+				var pgErr *pgconn.PgError
+				if !errors.As(err, &pgErr) || pgErr.Code != pgForeignKeyViolation {
+					return fmt.Errorf("failed to delete rows of %s: %w", table.Sanitize(), err)
+				}
+				blocked, lastErr = append(blocked, table), err
+			}
+		}
+		if len(blocked) == len(tables) {
+			return fmt.Errorf("failed to delete rows of %s: %w", blocked[0].Sanitize(), lastErr)
+		}
+		tables = blocked
+	}
+	return tx.Commit(ctx)
+}
+
+// deleteRows deletes the school's rows of table in a savepoint, so that a
+// failure leaves tx usable
+func deleteRows(ctx context.Context, tx pgx.Tx, table pgx.Identifier, sharedID int64) error {
+	sp, err := tx.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer sp.Rollback(ctx)
+	if _, err := sp.Exec(ctx, `DELETE FROM `+table.Sanitize()+` WHERE school_id = $1`, sharedID); err != nil {
+		return err
+	}
+	return sp.Commit(ctx)
+}
+
+// Run purges due schools every interval until ctx is cancelled
+func (m *Manager) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := m.PurgeDue(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("Purge: %v\n", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func audit(ctx context.Context, tx pgx.Tx, schoolID, actor, action string, details map[string]any) error {
+	_, err := tx.Exec(ctx, `
+	INSERT INTO school_audit_log (school_id, actor, action, details) VALUES ($1, $2, $3, $4)`,
+		schoolID, actor, action, details)
+	if err != nil {
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	return nil
+}
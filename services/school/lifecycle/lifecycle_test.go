@@ -0,0 +1,181 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"school-erp/pkg/tenant"
+	"school-erp/school/database"
+)
+
+func TestCheckToken(t *testing.T) {
+	hash := hashToken("right")
+	tests := []struct {
+		name  string
+		hash  *string
+		token string
+		err   error
+	}{
+		{"right token", &hash, "right", nil},
+		{"wrong token", &hash, "wrong", ErrToken},
+		{"empty token", &hash, "", ErrToken},
+		{"no token stored", nil, "right", ErrToken},
+	}
+	for _, tt := range tests {
+		if err := checkToken(tt.hash, tt.token); !errors.Is(err, tt.err) {
+			t.Errorf("%s: checkToken() = %v, want %v", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestDeletable(t *testing.T) {
+	for status, want := range map[string]bool{
+		"active": true, "inactive": true, "suspended": true,
+		"provisioning": false, "failed": false,
+		StatusDeleted: false, StatusPurging: false, StatusArchived: false,
+	} {
+		if got := deletable(status); got != want {
+			t.Errorf("deletable(%q) = %v, want %v", status, got, want)
+		}
+	}
+}
+
+// testManager needs a Postgres superuser DSN of a scratch database in
+// SCHOOL_TEST_DATABASE_URL; it runs the main database's migrations there
+func testManager(t *testing.T) (*Manager, *pgxpool.Pool) {
+	t.Helper()
+	dsn := os.Getenv("SCHOOL_TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("SCHOOL_TEST_DATABASE_URL not set")
+	}
+	db, err := pgxpool.New(context.Background(), dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(db.Close)
+	if err := database.RunMigrations(db); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := tenant.ParseKeyring("test:base64:MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tm := tenant.NewTenantManager(keys, tenant.PoolLimits{MaxConns: 2}, tenant.Admin{})
+	t.Cleanup(tm.CloseAllConnections)
+	return NewManager(db, tm, nil, time.Hour), db
+}
+
+// addSchool adds an active school of tenancy and returns its ID
+func addSchool(t *testing.T, db *pgxpool.Pool, tenancy string) string {
+	t.Helper()
+	code := fmt.Sprintf("lc%d", time.Now().UnixNano()%1e12)
+	var id string
+	err := db.QueryRow(context.Background(), `
+	INSERT INTO schools (name, code, db_name, db_user, db_password, db_host, domain, tenancy)
+	VALUES ($1, $1, $1, '', '', '', $1 || '.test', $2) RETURNING id::text`, code, tenancy,
+	).Scan(&id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func status(t *testing.T, db *pgxpool.Pool, id string) string {
+	t.Helper()
+	var s string
+	if err := db.QueryRow(context.Background(), `SELECT status FROM schools WHERE id = $1`, id).Scan(&s); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestLifecycle(t *testing.T) {
+	m, db := testManager(t)
+	ctx := context.Background()
+	id := addSchool(t, db, tenant.Shared)
+
+	if _, err := db.Exec(ctx, `UPDATE schools SET status = 'suspended' WHERE id = $1`, id); err != nil {
+		t.Fatal(err)
+	}
+	d, err := m.Delete(ctx, id, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Status != StatusDeleted || d.PurgeToken == "" || !d.PurgeAfter.After(d.DeletedAt) {
+		t.Errorf("Delete() = %+v", d)
+	}
+	if _, err := m.Delete(ctx, id, "test"); !errors.Is(err, ErrNotDeletable) {
+		t.Errorf("second Delete() error = %v, want ErrNotDeletable", err)
+	}
+
+	// Undeleting restores the status before the delete
+	if s, err := m.Undelete(ctx, id, "test"); err != nil || s != "suspended" {
+		t.Errorf("Undelete() = %q, %v, want suspended", s, err)
+	}
+	if _, err := m.Undelete(ctx, id, "test"); !errors.Is(err, ErrNotDeleted) {
+		t.Errorf("second Undelete() error = %v, want ErrNotDeleted", err)
+	}
+	if err := m.Purge(ctx, id, d.PurgeToken, "test"); !errors.Is(err, ErrNotDeleted) {
+		t.Errorf("Purge() of an undeleted school error = %v, want ErrNotDeleted", err)
+	}
+	if _, err := m.Undelete(ctx, "00000000-0000-0000-0000-000000000000", "test"); !errors.Is(err, pgx.ErrNoRows) {
+		t.Errorf("Undelete() of an unknown school error = %v, want pgx.ErrNoRows", err)
+	}
+
+	// A new delete has a new token; the old one no longer purges
+	d2, err := m.Delete(ctx, id, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Purge(ctx, id, d.PurgeToken, "test"); !errors.Is(err, ErrToken) {
+		t.Errorf("Purge() with the old token error = %v, want ErrToken", err)
+	}
+	if s := status(t, db, id); s != StatusDeleted {
+		t.Errorf("status after a refused purge = %q, want deleted", s)
+	}
+	if err := m.Purge(ctx, id, d2.PurgeToken, "test"); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for status(t, db, id) != StatusArchived {
+		if time.Now().After(deadline) {
+			t.Fatalf("status = %q, want archived", status(t, db, id))
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if _, err := m.Undelete(ctx, id, "test"); !errors.Is(err, ErrNotDeleted) {
+		t.Errorf("Undelete() of an archived school error = %v, want ErrNotDeleted", err)
+	}
+}
+
+// TestPurgeWithoutBackups leaves dedicated schools deleted when there is no
+// storage for their final backup
+func TestPurgeWithoutBackups(t *testing.T) {
+	m, db := testManager(t)
+	ctx := context.Background()
+	id := addSchool(t, db, tenant.Dedicated)
+
+	if _, err := m.Delete(ctx, id, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(ctx, `UPDATE schools SET purge_after = NOW() WHERE id = $1`, id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.PurgeDue(ctx); err != nil {
+		t.Fatal(err)
+	}
+	var purgeError *string
+	if err := db.QueryRow(ctx, `SELECT purge_error FROM schools WHERE id = $1`, id).Scan(&purgeError); err != nil {
+		t.Fatal(err)
+	}
+	if s := status(t, db, id); s != StatusDeleted || purgeError == nil {
+		t.Errorf("status = %q, purge_error = %v, want deleted with an error", s, purgeError)
+	}
+}
@@ -1,26 +1,50 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"net"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/gofiber/fiber/v2/middleware/logger"
 	"github.com/gofiber/fiber/v2/middleware/recover"
+	"github.com/nats-io/nats.go"
+	"github.com/prometheus/client_golang/prometheus"
 
+	"school-erp/pkg/academic"
+	"school-erp/pkg/calendar"
+	"school-erp/pkg/events"
+	"school-erp/pkg/features"
+	"school-erp/pkg/idempotency"
+	"school-erp/pkg/plans"
+	"school-erp/pkg/problem"
+	"school-erp/pkg/settings"
+	"school-erp/pkg/storage"
+	"school-erp/pkg/tenant"
+	"school-erp/school/backup"
 	"school-erp/school/config"
+	"school-erp/school/credentials"
 	"school-erp/school/database"
-	"school-erp/school/pkg/tenant"
+	"school-erp/school/domains"
+	"school-erp/school/lifecycle"
+	"school-erp/school/messaging"
+	"school-erp/school/provisioning"
 	"school-erp/school/routes"
+	"school-erp/school/usage"
 )
 
 func main() {
 	// Load configuration
-	cfg := config.LoadConfig()
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v\n", err)
+	}
 
 	// Initialize main database connection pool
 	mainDB, err := database.InitDB(cfg)
@@ -34,61 +58,163 @@ func main() {
 		log.Fatalf("Failed to run migrations: %v\n", err)
 	}
 
+	// Tenant passwords are encrypted with the keyring in ENCRYPTION_KEY;
+	// production refuses a weak or padded primary key
+	strict := strings.EqualFold(cfg.Environment, "production")
+	keys, err := tenant.LoadKeyring(cfg.EncryptionKey, strict)
+	if err != nil {
+		log.Fatalf("Invalid ENCRYPTION_KEY: %v", err)
+	}
+	backupKeys := keys
+	if cfg.BackupEncryptionKey != "" {
+		if backupKeys, err = tenant.LoadKeyring(cfg.BackupEncryptionKey, strict); err != nil {
+			log.Fatalf("Invalid BACKUP_ENCRYPTION_KEY: %v", err)
+		}
+	}
+
 	// Create tenant manager for handling multi-tenant connections
-	tenantManager, err := tenant.NewTenantManager(
-		cfg.EncryptionKey,
-		int32(cfg.MaxConnections),
-		int32(cfg.MaxIdleConn),
-		cfg.ConnMaxLifetime,
-		cfg.MainDBPassword,
+	tenantManager := tenant.NewTenantManager(
+		keys,
+		tenant.PoolLimits{
+			MaxConns:            int32(cfg.TenantMaxConns),
+			MaxTotalConns:       int32(cfg.TenantMaxTotalConns),
+			MaxConnLifetime:     cfg.TenantConnMaxLifetime,
+			MaxConnIdleTime:     cfg.TenantConnMaxIdleTime,
+			IdleTimeout:         cfg.TenantPoolIdleTimeout,
+			HealthCheckInterval: cfg.TenantHealthCheckInterval,
+		},
+		tenant.Admin{
+			Host:     cfg.MainDBHost,
+			Port:     cfg.MainDBPort,
+			User:     cfg.MainDBUser,
+			Password: cfg.MainDBPassword,
+			SSLMode:  cfg.MainDBSSLMode,
+		},
+	)
+	defer tenantManager.CloseAllConnections()
+	prometheus.MustRegister(tenantManager)
+
+	// Connect to NATS for SchoolProvisioned, SchoolUpdated,
+	// SchoolSettingsChanged, SchoolFeaturesChanged, SchoolPlanChanged and
+	// AcademicYearChanged events, and the services' SchoolUsageReported
+	// events
+	messaging.ConnectNATS()
+	var publish events.Publisher
+	if messaging.NatsConnection != nil {
+		defer messaging.NatsConnection.Close()
+		publish = messaging.NatsConnection.Publish
+	}
+
+	// Provision new schools in the background
+	workerCtx, stopWorker := context.WithCancel(context.Background())
+	defer stopWorker()
+	worker := provisioning.NewWorker(
+		provisioning.NewPostgresStore(mainDB),
+		provisioning.NewProvisioner(mainDB, tenantManager, publish).Steps(),
+		provisioning.WorkerConfig{
+			Interval:    cfg.ProvisionInterval,
+			Lease:       cfg.ProvisionLease,
+			MaxAttempts: cfg.ProvisionMaxAttempts,
+			Backoff:     cfg.ProvisionBackoff,
+		},
 	)
+	go worker.Run(workerCtx)
+
+	// Bring the databases of existing dedicated schools up to
+	// TenantSchemaVersion
+	go func() {
+		n, err := database.UpgradeTenants(workerCtx, mainDB, tenantManager)
+		if err != nil && workerCtx.Err() == nil {
+			log.Printf("Tenant upgrade: %v\n", err)
+		}
+		log.Printf("✓ Upgraded %d tenant databases to schema version %d\n", n, database.TenantSchemaVersion)
+	}()
+
+	// Rotate database passwords older than CredentialMaxAge
+	if cfg.CredentialMaxAge > 0 && cfg.CredentialRotationInterval > 0 {
+		rotator := credentials.NewRotator(mainDB, tenantManager)
+		go rotator.Run(workerCtx, cfg.CredentialRotationInterval, cfg.CredentialMaxAge)
+	}
+
+	// Purge deleted schools after the grace period. Without backup storage
+	// dedicated schools are not purged, as they get a final backup first.
+	var backups *backup.Service
+	if backupStorage, err := backup.NewStorage(workerCtx, cfg.BackupStorage, cfg.BackupDir, cfg.BackupS3()); err != nil {
+		log.Printf("Backup storage unavailable, dedicated schools will not be purged: %v\n", err)
+	} else {
+		backups = backup.NewService(mainDB, tenantManager, backupStorage, backupKeys, backup.Config{
+			PGDump:    cfg.PGDumpPath,
+			PGRestore: cfg.PGRestorePath,
+			SSLMode:   cfg.MainDBSSLMode,
+			Retention: cfg.BackupRetention,
+			KeepMin:   cfg.BackupKeepMin,
+		})
+	}
+	lc := lifecycle.NewManager(mainDB, tenantManager, backups, cfg.SchoolDeleteGracePeriod)
+	if cfg.PurgeInterval > 0 {
+		go lc.Run(workerCtx, cfg.PurgeInterval)
+	}
+
+	// Delete expired idempotency keys
+	if cfg.IdempotencyPurgeInterval > 0 {
+		go idempotency.NewPostgresStore(mainDB).Run(workerCtx, cfg.IdempotencyPurgeInterval)
+	}
+
+	// Verify custom domains by DNS and announce changes to the services
+	dm := domains.NewService(mainDB, net.DefaultResolver, publish)
+
+	// Per-school settings; changes are announced for the services' caches
+	settingsStore := settings.NewStore(mainDB, publish)
+
+	// Modules and feature flags of schools; changes are announced the same way
+	featureStore := features.NewStore(mainDB, publish)
+
+	// Academic years; changes and rollovers are announced the same way
+	yearStore := academic.NewStore(mainDB, publish)
+
+	// Holiday and working-day calendars, announced the same way
+	calendarStore := calendar.NewStore(mainDB, publish)
+
+	// Uploaded files: logos, and the documents and receipts of the services,
+	// which share the store and the URL secret
+	files, err := storage.OpenFiles(cfg.Storage())
 	if err != nil {
-		log.Fatalf("Failed to create tenant manager: %v", err)
+		log.Fatalf("Failed to open file storage: %v\n", err)
+	}
+
+	// Plans; usage reported by the services is metered, storage sampled and
+	// past months closed into statements
+	planStore := plans.NewStore(mainDB, publish)
+	meter := usage.NewMeter(mainDB, tenantManager, files.Store())
+	if messaging.NatsConnection != nil {
+		if _, err := messaging.NatsConnection.Subscribe(plans.SubjectUsageReported, func(m *nats.Msg) {
+			meter.HandleEvent(m.Data)
+		}); err != nil {
+			log.Printf("Failed to subscribe to %s: %v\n", plans.SubjectUsageReported, err)
+		}
+	}
+	if cfg.UsageSampleInterval > 0 {
+		go meter.Run(workerCtx, cfg.UsageSampleInterval)
+	}
+	if cfg.StatementInterval > 0 {
+		go meter.RunStatements(workerCtx, cfg.StatementInterval)
 	}
-	defer tenantManager.CloseAllConnections()
 
 	// Create Fiber app with default configuration
 	app := fiber.New(fiber.Config{
-		AppName: "School ERP - School Service",
-		Prefork: false, // Set to true for production with multiple cores
+		AppName:      "School ERP - School Service",
+		Prefork:      false, // Set to true for production with multiple cores
+		ErrorHandler: problem.ErrorHandler,
 	})
 
 	// Setup middleware
 	setupMiddleware(app)
 
-	// Welcome route
-	app.Get("/", func(c *fiber.Ctx) error {
-		return c.JSON(fiber.Map{
-			"service": "School ERP School Service",
-			"version": "v1.0.0",
-			"status":  "running",
-			"endpoints": fiber.Map{
-				"health":  "/health",
-				"schools": "/api/v1/schools",
-			},
-		})
-	})
-
 	// Setup routes
-	routes.SetupRoutes(app, mainDB, tenantManager)
-
-	// Serve static files (uploaded logos)
-	app.Static("/uploads", "/app/uploads")
+	routes.SetupRoutes(app, mainDB, tenantManager, lc, dm, settingsStore, featureStore, planStore, meter, yearStore, calendarStore, files)
 
-	// Health check endpoint
-	app.Get("/health", func(c *fiber.Ctx) error {
-		return c.JSON(fiber.Map{
-			"status":  "healthy",
-			"service": "school-service",
-		})
-	})
-
-	// 404 handler
-	app.All("*", func(c *fiber.Ctx) error {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-			"error": "Route not found",
-		})
-	})
+	// Welcome, uploads, health, API document and 404 handler
+	routes.SetupSystemRoutes(app, files)
 
 	// Start server with graceful shutdown
 	port := fmt.Sprintf(":%d", cfg.Port)
@@ -112,6 +238,9 @@ func main() {
 	_ = app.Shutdown()
 
 	log.Println("Running cleanup tasks...")
+	// Stop the provisioning worker, credential rotation, purge and metering jobs;
+	// interrupted jobs resume on next start
+	stopWorker()
 	// Close tenant connections
 	tenantManager.CloseAllConnections()
 	// mainDB.Close() is already deferred in main, but we can rely on that or close here explicitly if we remove defer
@@ -132,8 +261,8 @@ func setupMiddleware(app *fiber.App) {
 	app.Use(cors.New(cors.Config{
 		AllowOrigins:     getAllowedOrigins(),
 		AllowMethods:     "GET,POST,PUT,DELETE,PATCH,OPTIONS",
-		AllowHeaders:     "Content-Type,Authorization,X-Requested-With,X-Tenant-Code",
-		ExposeHeaders:    "Content-Length,X-Total-Count",
+		AllowHeaders:     "Content-Type,Authorization,X-Requested-With,X-Tenant-Code,Idempotency-Key",
+		ExposeHeaders:    "Content-Length,X-Total-Count,Idempotent-Replayed",
 		AllowCredentials: true,
 		MaxAge:           300,
 	}))
@@ -0,0 +1,123 @@
+// Package provisioning creates the databases of new schools in the
+// background. Each school gets a job that a Worker moves through
+// pending → db_created → migrated → seeded → active, recording every state
+// so that a crashed worker's job is resumed from its last completed step.
+package provisioning
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// State is the last completed step of a provisioning job
+type State string
+
+const (
+	Pending   State = "pending"
+	DBCreated State = "db_created"
+	Migrated  State = "migrated"
+	Seeded    State = "seeded"
+	Active    State = "active"
+	// Failed jobs gave up after MaxAttempts and were compensated
+	Failed State = "failed"
+)
+
+// Done reports whether the job will not run again
+func (s State) Done() bool {
+	return s == Active || s == Failed
+}
+
+// Job is the provisioning job of one school
+type Job struct {
+	ID        string    `json:"id"`
+	SchoolID  string    `json:"school_id"`
+	State     State     `json:"state" doc:"pending, db_created, migrated, seeded, active or failed"`
+	Attempts  int       `json:"attempts" doc:"Failed attempts of the current step"`
+	LastError string    `json:"last_error,omitempty"`
+	NextRunAt time.Time `json:"next_run_at"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Store persists jobs for a Worker
+type Store interface {
+	// Claim leases the next due job for lease, or returns nil if none is due.
+	// A job whose worker died is claimed again once its lease expires.
+	Claim(ctx context.Context, lease time.Duration) (*Job, error)
+	// Save records the job's progress. A positive retryIn schedules the job to
+	// run again after that delay. The lease is kept while the job moves on to
+	// its next step and released when it is done or waiting to retry.
+	Save(ctx context.Context, job *Job, retryIn time.Duration) error
+}
+
+// PostgresStore keeps jobs in the provisioning_jobs table of the main database
+type PostgresStore struct {
+	db *pgxpool.Pool
+}
+
+func NewPostgresStore(db *pgxpool.Pool) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+const jobColumns = `id, school_id::text, state, attempts, COALESCE(last_error, ''), next_run_at, created_at, updated_at`
+
+func scanJob(row pgx.Row) (*Job, error) {
+	var j Job
+	if err := row.Scan(&j.ID, &j.SchoolID, &j.State, &j.Attempts, &j.LastError, &j.NextRunAt, &j.CreatedAt, &j.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &j, nil
+}
+
+// Enqueue adds a pending job for a school inserted in the same transaction
+func Enqueue(ctx context.Context, tx pgx.Tx, schoolID string) (*Job, error) {
+	return scanJob(tx.QueryRow(ctx,
+		`INSERT INTO provisioning_jobs (school_id) VALUES ($1) RETURNING `+jobColumns, schoolID))
+}
+
+// Get returns the job of a school
+func (s *PostgresStore) Get(ctx context.Context, schoolID string) (*Job, error) {
+	return scanJob(s.db.QueryRow(ctx,
+		`SELECT `+jobColumns+` FROM provisioning_jobs WHERE school_id = $1`, schoolID))
+}
+
+func (s *PostgresStore) Claim(ctx context.Context, lease time.Duration) (*Job, error) {
+	job, err := scanJob(s.db.QueryRow(ctx, `
+	UPDATE provisioning_jobs SET locked_until = CURRENT_TIMESTAMP + make_interval(secs => $1)
+	WHERE id = (
+		SELECT id FROM provisioning_jobs
+		WHERE state NOT IN ('active', 'failed') AND next_run_at <= CURRENT_TIMESTAMP
+			AND (locked_until IS NULL OR locked_until < CURRENT_TIMESTAMP)
+		ORDER BY next_run_at
+		LIMIT 1
+		FOR UPDATE SKIP LOCKED
+	)
+	RETURNING `+jobColumns, lease.Seconds()))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	return job, err
+}
+
+// Save also marks the school failed when the job has failed
+func (s *PostgresStore) Save(ctx context.Context, job *Job, retryIn time.Duration) error {
+	_, err := s.db.Exec(ctx, `
+	WITH job AS (
+		UPDATE provisioning_jobs SET
+			state = $2,
+			attempts = $3,
+			last_error = NULLIF($4, ''),
+			next_run_at = CURRENT_TIMESTAMP + make_interval(secs => $5),
+			locked_until = CASE WHEN $2 IN ('active', 'failed') OR $5 > 0 THEN NULL ELSE locked_until END,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+		RETURNING school_id, state
+	)
+	UPDATE schools SET status = 'failed'
+	FROM job WHERE schools.id = job.school_id AND job.state = 'failed'`,
+		job.ID, string(job.State), job.Attempts, job.LastError, retryIn.Seconds())
+	return err
+}
@@ -0,0 +1,149 @@
+package provisioning
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"school-erp/pkg/events"
+	"school-erp/pkg/tenant"
+	"school-erp/school/database"
+)
+
+// SubjectSchoolProvisioned is the NATS subject of SchoolProvisioned events
+const SubjectSchoolProvisioned = "SchoolProvisioned"
+
+// SchoolProvisioned is published when a school becomes active
+type SchoolProvisioned struct {
+	SchoolID      string    `json:"school_id"`
+	Code          string    `json:"code"`
+	Name          string    `json:"name"`
+	Tenancy       string    `json:"tenancy"`
+	ProvisionedAt time.Time `json:"provisioned_at"`
+}
+
+// Provisioner implements the steps of a school's provisioning job. Shared
+// schools have no database of their own, so only activation does anything
+// for them.
+type Provisioner struct {
+	db      *pgxpool.Pool
+	tm      *tenant.TenantManager
+	publish events.Publisher
+}
+
+func NewProvisioner(db *pgxpool.Pool, tm *tenant.TenantManager, publish events.Publisher) *Provisioner {
+	return &Provisioner{db: db, tm: tm, publish: publish}
+}
+
+// Steps returns the steps from pending to active
+func (p *Provisioner) Steps() []Step {
+	return []Step{
+		{To: DBCreated, Do: p.createDatabase, Undo: p.dropDatabase},
+		{To: Migrated, Do: p.migrate},
+		{To: Seeded, Do: p.seed},
+		{To: Active, Do: p.activate},
+	}
+}
+
+// school is the schools row a job provisions
+type school struct {
+	ID         string
+	Code       string
+	Name       string
+	Timezone   string
+	Tenancy    string
+	DBName     string
+	DBHost     string
+	DBPort     int
+	DBUser     string
+	DBPassword string // encrypted
+}
+
+func (p *Provisioner) school(ctx context.Context, job *Job) (*school, error) {
+	var s school
+	err := p.db.QueryRow(ctx, `
+	SELECT id::text, code, name, timezone, tenancy, db_name, db_host, db_port, db_user, db_password
+	FROM schools WHERE id = $1`, job.SchoolID,
+	).Scan(&s.ID, &s.Code, &s.Name, &s.Timezone, &s.Tenancy, &s.DBName, &s.DBHost, &s.DBPort, &s.DBUser, &s.DBPassword)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load school: %w", err)
+	}
+	return &s, nil
+}
+
+// connect returns the pool of a dedicated school's database
+func (p *Provisioner) connect(ctx context.Context, s *school) (*pgxpool.Pool, error) {
+	return p.tm.GetConnection(ctx, s.Code, s.DBHost, s.DBPort, s.DBName, s.DBUser, s.DBPassword)
+}
+
+func (p *Provisioner) createDatabase(ctx context.Context, job *Job) error {
+	s, err := p.school(ctx, job)
+	if err != nil || s.Tenancy != tenant.Dedicated {
+		return err
+	}
+	password, err := p.tm.DecryptPassword(s.DBPassword)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt password: %w", err)
+	}
+	return p.tm.CreateTenantDatabase(ctx, p.db, s.Code, s.DBName, s.DBUser, password)
+}
+
+// dropDatabase also removes the database user, which is created per school
+func (p *Provisioner) dropDatabase(ctx context.Context, job *Job) error {
+	s, err := p.school(ctx, job)
+	if err != nil || s.Tenancy != tenant.Dedicated {
+		return err
+	}
+	if err := p.tm.DropTenantDatabase(ctx, p.db, s.Code, s.DBName); err != nil {
+		return err
+	}
+	return p.tm.DropTenantUser(ctx, p.db, s.DBUser)
+}
+
+func (p *Provisioner) migrate(ctx context.Context, job *Job) error {
+	s, err := p.school(ctx, job)
+	if err != nil || s.Tenancy != tenant.Dedicated {
+		return err
+	}
+	db, err := p.connect(ctx, s)
+	if err != nil {
+		return err
+	}
+	return database.RunTenantMigrations(ctx, db)
+}
+
+func (p *Provisioner) seed(ctx context.Context, job *Job) error {
+	s, err := p.school(ctx, job)
+	if err != nil || s.Tenancy != tenant.Dedicated {
+		return err
+	}
+	db, err := p.connect(ctx, s)
+	if err != nil {
+		return err
+	}
+	return database.SeedTenant(ctx, db, s.Code, s.Name, s.Timezone)
+}
+
+// activate makes the school resolvable and announces it. The event is best
+// effort: a publish failure does not fail the job.
+func (p *Provisioner) activate(ctx context.Context, job *Job) error {
+	s, err := p.school(ctx, job)
+	if err != nil {
+		return err
+	}
+	if _, err := p.db.Exec(ctx,
+		`UPDATE schools SET status = 'active' WHERE id = $1 AND status = 'provisioning'`, s.ID); err != nil {
+		return fmt.Errorf("failed to activate school: %w", err)
+	}
+
+	events.Send(p.publish, SubjectSchoolProvisioned, SchoolProvisioned{
+		SchoolID:      s.ID,
+		Code:          s.Code,
+		Name:          s.Name,
+		Tenancy:       s.Tenancy,
+		ProvisionedAt: time.Now().UTC(),
+	})
+	return nil
+}
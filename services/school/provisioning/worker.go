@@ -0,0 +1,149 @@
+package provisioning
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Step moves a job from the state reached by the previous step (Pending for
+// the first) to To. Do may be run again after a crash or a failed attempt,
+// so it must be idempotent.
+type Step struct {
+	To State
+	Do func(ctx context.Context, job *Job) error
+	// Undo reverts Do, also after Do failed halfway, when the job gives up.
+	// It may be nil.
+	Undo func(ctx context.Context, job *Job) error
+}
+
+// WorkerConfig tunes a Worker
+type WorkerConfig struct {
+	// Interval between polls for due jobs
+	Interval time.Duration
+	// Lease reserves a claimed job for one worker; it must exceed the time
+	// all steps of a job take together
+	Lease time.Duration
+	// MaxAttempts of one step before the job is compensated and failed
+	MaxAttempts int
+	// Backoff before the first retry, doubled for every further attempt
+	Backoff time.Duration
+}
+
+// Worker runs provisioning jobs through their steps
+type Worker struct {
+	store Store
+	steps []Step
+	cfg   WorkerConfig
+}
+
+func NewWorker(store Store, steps []Step, cfg WorkerConfig) *Worker {
+	return &Worker{store: store, steps: steps, cfg: cfg}
+}
+
+// Run processes due jobs every Interval until ctx is cancelled
+func (w *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := w.RunOnce(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("Provisioning worker: %v\n", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce processes jobs until none is due and returns how many it processed
+func (w *Worker) RunOnce(ctx context.Context) (int, error) {
+	processed := 0
+	for ctx.Err() == nil {
+		job, err := w.store.Claim(ctx, w.cfg.Lease)
+		if err != nil {
+			return processed, fmt.Errorf("failed to claim job: %w", err)
+		}
+		if job == nil {
+			return processed, nil
+		}
+		if err := w.process(ctx, job); err != nil {
+			return processed, fmt.Errorf("failed to save job %s: %w", job.ID, err)
+		}
+		processed++
+	}
+	return processed, ctx.Err()
+}
+
+// process runs the job's remaining steps until it is active, a step fails or
+// the job gives up
+func (w *Worker) process(ctx context.Context, job *Job) error {
+	for !job.State.Done() {
+		i := w.next(job.State)
+		if i < 0 {
+			job.LastError = fmt.Sprintf("no step follows state %q", job.State)
+			job.State = Failed
+			return w.store.Save(ctx, job, 0)
+		}
+
+		step := w.steps[i]
+		if err := step.Do(ctx, job); err != nil {
+			job.Attempts++
+			job.LastError = fmt.Sprintf("%s: %v", step.To, err)
+			if job.Attempts < w.cfg.MaxAttempts {
+				log.Printf("Provisioning of school %s: %s; retrying\n", job.SchoolID, job.LastError)
+				return w.store.Save(ctx, job, w.backoff(job.Attempts))
+			}
+
+			log.Printf("Provisioning of school %s: %s; giving up\n", job.SchoolID, job.LastError)
+			w.compensate(ctx, job, i)
+			job.State = Failed
+			return w.store.Save(ctx, job, 0)
+		}
+
+		job.State = step.To
+		job.Attempts = 0
+		job.LastError = ""
+		if err := w.store.Save(ctx, job, 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// next returns the index of the step that follows state, or -1
+func (w *Worker) next(state State) int {
+	from := Pending
+	for i, step := range w.steps {
+		if from == state {
+			return i
+		}
+		from = step.To
+	}
+	return -1
+}
+
+// compensate undoes steps last..0 in reverse order. Undo errors are recorded
+// on the job and do not stop the remaining undos.
+func (w *Worker) compensate(ctx context.Context, job *Job, last int) {
+	for i := last; i >= 0; i-- {
+		if w.steps[i].Undo == nil {
+			continue
+		}
+		if err := w.steps[i].Undo(ctx, job); err != nil {
+			log.Printf("Provisioning of school %s: failed to undo %s: %v\n", job.SchoolID, w.steps[i].To, err)
+			job.LastError += fmt.Sprintf("; undo %s: %v", w.steps[i].To, err)
+		}
+	}
+}
+
+func (w *Worker) backoff(attempts int) time.Duration {
+	d := w.cfg.Backoff
+	for i := 1; i < attempts && d < time.Hour; i++ {
+		d *= 2
+	}
+	return d
+}
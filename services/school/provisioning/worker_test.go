@@ -0,0 +1,112 @@
+package provisioning
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// memStore holds one job and records every saved state
+type memStore struct {
+	job     *Job
+	claimed bool
+	saved   []State
+	retryIn time.Duration
+}
+
+func (s *memStore) Claim(context.Context, time.Duration) (*Job, error) {
+	if s.claimed || s.job.State.Done() {
+		return nil, nil
+	}
+	s.claimed = true
+	j := *s.job
+	return &j, nil
+}
+
+func (s *memStore) Save(_ context.Context, job *Job, retryIn time.Duration) error {
+	j := *job
+	s.job = &j
+	s.saved = append(s.saved, job.State)
+	s.retryIn = retryIn
+	return nil
+}
+
+// steps returns the four provisioning steps, logging every Do and Undo call.
+// fail makes the Do of that target state fail.
+func steps(calls *[]string, fail State) []Step {
+	step := func(to State, undo bool) Step {
+		s := Step{To: to, Do: func(context.Context, *Job) error {
+			*calls = append(*calls, "do "+string(to))
+			if to == fail {
+				return errors.New("boom")
+			}
+			return nil
+		}}
+		if undo {
+			s.Undo = func(context.Context, *Job) error {
+				*calls = append(*calls, "undo "+string(to))
+				return nil
+			}
+		}
+		return s
+	}
+	return []Step{step(DBCreated, true), step(Migrated, false), step(Seeded, true), step(Active, false)}
+}
+
+func TestWorker(t *testing.T) {
+	cfg := WorkerConfig{MaxAttempts: 3, Backoff: time.Second}
+
+	cases := []struct {
+		name     string
+		state    State
+		attempts int
+		fail     State
+		calls    []string
+		saved    []State
+		retryIn  time.Duration
+		lastErr  string
+	}{
+		{name: "all steps", state: Pending,
+			calls: []string{"do db_created", "do migrated", "do seeded", "do active"},
+			saved: []State{DBCreated, Migrated, Seeded, Active}},
+		{name: "resumes after last completed step", state: Migrated,
+			calls: []string{"do seeded", "do active"},
+			saved: []State{Seeded, Active}},
+		{name: "failed step is retried with backoff", state: DBCreated, attempts: 1, fail: Migrated,
+			calls:   []string{"do migrated"},
+			saved:   []State{DBCreated},
+			retryIn: 2 * time.Second, lastErr: "migrated: boom"},
+		{name: "gives up and compensates in reverse", state: Migrated, attempts: 2, fail: Seeded,
+			calls: []string{"do seeded", "undo seeded", "undo db_created"},
+			saved: []State{Failed}, lastErr: "seeded: boom"},
+		{name: "unknown state fails", state: "archived",
+			saved: []State{Failed}, lastErr: `no step follows state "archived"`},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			var calls []string
+			store := &memStore{job: &Job{ID: "j1", SchoolID: "s1", State: tc.state, Attempts: tc.attempts}}
+			w := NewWorker(store, steps(&calls, tc.fail), cfg)
+
+			n, err := w.RunOnce(context.Background())
+			if err != nil || n != 1 {
+				t.Fatalf("RunOnce = %d, %v", n, err)
+			}
+			if !reflect.DeepEqual(calls, tc.calls) {
+				t.Errorf("calls = %v, want %v", calls, tc.calls)
+			}
+			if !reflect.DeepEqual(store.saved, tc.saved) {
+				t.Errorf("saved = %v, want %v", store.saved, tc.saved)
+			}
+			if store.retryIn != tc.retryIn {
+				t.Errorf("retryIn = %v, want %v", store.retryIn, tc.retryIn)
+			}
+			if store.job.LastError != tc.lastErr {
+				t.Errorf("last error = %q, want %q", store.job.LastError, tc.lastErr)
+			}
+		})
+	}
+}
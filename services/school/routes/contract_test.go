@@ -0,0 +1,142 @@
+package routes
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"school-erp/pkg/academic"
+	"school-erp/pkg/calendar"
+	"school-erp/pkg/features"
+	"school-erp/pkg/openapi"
+	"school-erp/pkg/plans"
+	"school-erp/pkg/problem"
+	"school-erp/pkg/settings"
+	"school-erp/pkg/storage"
+	"school-erp/pkg/tenant"
+	"school-erp/school/domains"
+	"school-erp/school/lifecycle"
+	"school-erp/school/usage"
+)
+
+// newContractApp mounts every route. There is no database, so only paths
+// that return before touching it are exercised.
+func newContractApp(t *testing.T) *fiber.App {
+	keys, err := tenant.ParseKeyring("contract:base64:MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tm := tenant.NewTenantManager(keys, tenant.PoolLimits{MaxConns: 2, MaxConnLifetime: time.Minute}, tenant.Admin{})
+	app := fiber.New(fiber.Config{ErrorHandler: problem.ErrorHandler})
+	files := storage.NewFiles(storage.NewLocalStore(t.TempDir()), storage.NewSigner("contract", storage.FilesPath), nil, time.Minute)
+	SetupRoutes(app, nil, tm, lifecycle.NewManager(nil, tm, nil, time.Hour), domains.NewService(nil, nil, nil), settings.NewStore(nil, nil), features.NewStore(nil, nil), plans.NewStore(nil, nil), usage.NewMeter(nil, tm, files.Store()), academic.NewStore(nil, nil), calendar.NewStore(nil, nil), files)
+	SetupSystemRoutes(app, files)
+	return app
+}
+
+func TestOperationsCoverEveryRoute(t *testing.T) {
+	doc := openapi.Build(newContractApp(t), APIInfo, Operations)
+	for _, d := range doc.Drift {
+		t.Error(d)
+	}
+}
+
+func TestResponsesMatchSpec(t *testing.T) {
+	app := newContractApp(t)
+	doc := openapi.Build(app, APIInfo, Operations)
+
+	var form bytes.Buffer
+	mw := multipart.NewWriter(&form)
+	part, _ := mw.CreateFormFile("logo", "logo.exe")
+	part.Write([]byte("MZ"))
+	mw.Close()
+
+	cases := []struct {
+		method, path, contentType, body string
+		status                          int
+	}{
+		{"POST", "/api/v1/schools/", "application/json", `{"name":`, 400},
+		{"POST", "/api/v1/schools/", "application/json", `{"name":"A","code":"x"}`, 422},
+		{"POST", "/api/v1/schools/", "application/json", `{"name":"Acme","code":"x'; DROP","domain":"acme.example","timezone":"UTC"}`, 422},
+		{"POST", "/api/v1/schools/", "application/json", `{"name":"Acme","code":"acme","domain":"acme.example","timezone":"UTC","db_user":"a\"b"}`, 422},
+		{"GET", "/api/v1/schools/?sort=password", "", "", 400},
+		{"GET", "/api/v1/schools/?limit=abc", "", "", 400},
+		{"PUT", "/api/v1/schools/8f14e45f-ceea-467f-a0e6-3c9d1c2e3b41", "application/json", `{"status":"archived"}`, 422},
+		{"PUT", "/api/v1/schools/8f14e45f-ceea-467f-a0e6-3c9d1c2e3b41", "application/json", `{"domain":"not a domain"}`, 422},
+		{"POST", "/api/v1/schools/8f14e45f-ceea-467f-a0e6-3c9d1c2e3b41/purge", "application/json", `{}`, 422},
+		{"GET", "/api/v1/schools/unknown/stats", "", "", 404},
+		{"PUT", "/api/v1/schools/8f14e45f-ceea-467f-a0e6-3c9d1c2e3b41/settings/fee", "application/json", `{"settings":{"due_day":31}}`, 422},
+		{"PUT", "/api/v1/schools/8f14e45f-ceea-467f-a0e6-3c9d1c2e3b41/settings/fee", "application/json", `{}`, 422},
+		{"GET", "/api/v1/schools/8f14e45f-ceea-467f-a0e6-3c9d1c2e3b41/settings/colours", "", "", 404},
+		{"GET", "/api/v1/schools/8f14e45f-ceea-467f-a0e6-3c9d1c2e3b41/settings/fee/history?limit=0", "", "", 400},
+		{"GET", "/api/v1/settings/schemas/grading", "", "", 200},
+		{"GET", "/api/v1/settings/schemas/colours", "", "", 404},
+		{"PUT", "/api/v1/schools/8f14e45f-ceea-467f-a0e6-3c9d1c2e3b41/features/transport", "application/json", `{}`, 422},
+		{"PUT", "/api/v1/schools/8f14e45f-ceea-467f-a0e6-3c9d1c2e3b41/features/students", "application/json", `{"enabled":false}`, 409},
+		{"GET", "/api/v1/features/modules", "", "", 200},
+		{"PUT", "/api/v1/features/flags/exams.online", "application/json", `{"rollout_percent":101}`, 422},
+		{"PUT", "/api/v1/features/flags/transport", "application/json", `{"rollout_percent":10}`, 422},
+		{"PUT", "/api/v1/schools/8f14e45f-ceea-467f-a0e6-3c9d1c2e3b41/plan", "application/json", `{}`, 422},
+		{"GET", "/api/v1/schools/8f14e45f-ceea-467f-a0e6-3c9d1c2e3b41/usage/statements/2026-13", "", "", 422},
+		{"PUT", "/api/v1/plans/Gold", "application/json", `{"name":"Gold"}`, 422},
+		{"PUT", "/api/v1/plans/gold", "application/json", `{"name":"Gold","soft_limit_percent":120}`, 422},
+		{"PUT", "/api/v1/plans/gold", "application/json", `{"name":"Gold","modules":["library"]}`, 422},
+		{"POST", "/api/v1/schools/8f14e45f-ceea-467f-a0e6-3c9d1c2e3b41/academic-years", "application/json", `{"name":"2082"}`, 422},
+		{"POST", "/api/v1/schools/8f14e45f-ceea-467f-a0e6-3c9d1c2e3b41/academic-years", "application/json", `{"name":"2082","calendar":"lunar","start_date":"2025-04-14","end_date":"2026-04-13"}`, 422},
+		{"POST", "/api/v1/schools/8f14e45f-ceea-467f-a0e6-3c9d1c2e3b41/academic-years", "application/json", `{"name":"2082","calendar":"gregorian","start_date":"2025-04-14","end_date":"2025-04-13"}`, 422},
+		{"PUT", "/api/v1/schools/8f14e45f-ceea-467f-a0e6-3c9d1c2e3b41/academic-years/1", "application/json", `{"name":"2082","calendar":"gregorian","start_date":"2025-04-14","end_date":"2026-04-13","terms":[{"name":"First","start_date":"2025-01-01","end_date":"2025-06-30"}]}`, 422},
+		{"POST", "/api/v1/schools/8f14e45f-ceea-467f-a0e6-3c9d1c2e3b41/academic-years/rollover", "application/json", `{"start_date":"2025-04-14"}`, 422},
+		{"POST", "/api/v1/schools/8f14e45f-ceea-467f-a0e6-3c9d1c2e3b41/calendar/events", "application/json", `{"kind":"vacation","title":"Dashain","start_date":"2025-09-28"}`, 422},
+		{"POST", "/api/v1/schools/8f14e45f-ceea-467f-a0e6-3c9d1c2e3b41/calendar/events", "application/json", `{"kind":"holiday","title":"Dashain","start_date":"2025-09-28","end_date":"2025-09-27"}`, 422},
+		{"PUT", "/api/v1/schools/8f14e45f-ceea-467f-a0e6-3c9d1c2e3b41/calendar/events/1", "application/json", `{"kind":"weekly_off","title":"Fridays","start_date":"2025-09-28"}`, 422},
+		{"GET", "/api/v1/schools/8f14e45f-ceea-467f-a0e6-3c9d1c2e3b41/calendar/events?from=28-09-2025", "", "", 400},
+		{"POST", "/api/v1/schools/8f14e45f-ceea-467f-a0e6-3c9d1c2e3b41/calendar/ical", "text/calendar", "name,date\nDashain,2025-09-28\n", 422},
+		{"GET", "/api/v1/schools/8f14e45f-ceea-467f-a0e6-3c9d1c2e3b41/calendar/days?from=2025-09-28", "", "", 400},
+		{"GET", "/api/v1/schools/8f14e45f-ceea-467f-a0e6-3c9d1c2e3b41/calendar/days?from=2025-09-28&to=2027-09-28", "", "", 400},
+		{"POST", "/api/v1/schools/upload-logo", "application/json", `{}`, 400},
+		{"POST", "/api/v1/schools/upload-logo", mw.FormDataContentType(), form.String(), 415},
+		{"GET", "/api/v1/files/schools/a/documents/1.pdf?expires=1&signature=x", "", "", 403},
+		{"GET", "/uploads/schools/a/documents/1.pdf", "", "", 404},
+		{"GET", "/uploads/public/logos/missing.png", "", "", 404},
+		{"GET", "/", "", "", 200},
+		{"GET", "/health", "", "", 200},
+		{"GET", "/metrics", "", "", 200},
+		{"GET", "/openapi.json", "", "", 200},
+	}
+
+	for _, tc := range cases {
+		req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+		if tc.contentType != "" {
+			req.Header.Set("Content-Type", tc.contentType)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", tc.method, tc.path, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != tc.status {
+			t.Errorf("%s %s: status %d, want %d: %s", tc.method, tc.path, resp.StatusCode, tc.status, body)
+			continue
+		}
+		path, _, _ := strings.Cut(tc.path, "?")
+		if err := doc.ValidateResponse(tc.method, path, resp.StatusCode, resp.Header.Get("Content-Type"), body); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestUnknownRouteIsProblem(t *testing.T) {
+	resp, err := newContractApp(t).Test(httptest.NewRequest("GET", "/api/v1/nope", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != fiber.StatusNotFound || resp.Header.Get("Content-Type") != problem.ContentType {
+		t.Errorf("got %d %s, want 404 %s", resp.StatusCode, resp.Header.Get("Content-Type"), problem.ContentType)
+	}
+}
@@ -0,0 +1,158 @@
+package routes
+
+import (
+	"school-erp/pkg/academic"
+	"school-erp/pkg/calendar"
+	"school-erp/pkg/features"
+	"school-erp/pkg/idempotency"
+	"school-erp/pkg/openapi"
+	"school-erp/pkg/plans"
+	"school-erp/pkg/settings"
+	"school-erp/pkg/storage"
+	"school-erp/school/credentials"
+	"school-erp/school/domains"
+	"school-erp/school/handlers"
+	"school-erp/school/lifecycle"
+	"school-erp/school/provisioning"
+	"school-erp/school/usage"
+)
+
+// APIInfo describes the school service in its OpenAPI document.
+var APIInfo = openapi.Info{
+	Title:       "School ERP - School Service",
+	Version:     "1.0.0",
+	Description: "School (tenant) management and provisioning.",
+}
+
+var logoUpload = openapi.Raw{
+	ContentType: "multipart/form-data",
+	Schema: &openapi.Schema{
+		Type:       "object",
+		Properties: map[string]*openapi.Schema{"logo": {Type: "string", Format: "binary"}},
+		Required:   []string{"logo"},
+	},
+}
+
+// dateParam is a YYYY-MM-DD date in the query
+func dateParam(name string, required bool) openapi.Param {
+	return openapi.Param{Name: name, In: "query", Required: required, Schema: &openapi.Schema{Type: "string", Format: "date"}}
+}
+
+// Operations documents every route mounted by SetupRoutes and SetupSystemRoutes.
+var Operations = []openapi.Operation{
+	{Method: "POST", Path: "/api/v1/schools/upload-logo", Summary: "Upload a school logo", Tags: []string{"Schools"},
+		Request: logoUpload, Responses: openapi.Responses{200: handlers.LogoResponse{}}},
+	{Method: "POST", Path: "/api/v1/schools/", Summary: "Create a school and start provisioning its database", Tags: []string{"Schools"},
+		Params:  []openapi.Param{{Name: idempotency.HeaderKey, In: "header", Description: "Replays the first response for retries with the same key", Schema: &openapi.Schema{Type: "string"}}},
+		Request: handlers.CreateSchoolRequest{}, Responses: openapi.Responses{202: handlers.CreateSchoolResponse{}}},
+	{Method: "GET", Path: "/api/v1/schools/", Summary: "List schools", Tags: []string{"Schools"},
+		Params: openapi.ListParams(handlers.SchoolListResource), Responses: openapi.Responses{200: openapi.Page(handlers.School{})}},
+	{Method: "GET", Path: "/api/v1/schools/:id", Summary: "Get a school", Tags: []string{"Schools"},
+		Responses: openapi.Responses{200: handlers.School{}}},
+	{Method: "GET", Path: "/api/v1/schools/:id/provisioning", Summary: "Get the provisioning status of a school", Tags: []string{"Schools"},
+		Responses: openapi.Responses{200: provisioning.Job{}}},
+	{Method: "POST", Path: "/api/v1/schools/:id/rotate-credentials", Summary: "Rotate the database password of a dedicated school", Tags: []string{"Schools"},
+		Responses: openapi.Responses{200: credentials.Rotation{}}},
+	{Method: "PUT", Path: "/api/v1/schools/:id", Summary: "Update a school", Tags: []string{"Schools"},
+		Request: handlers.UpdateSchoolRequest{}, Responses: openapi.Responses{200: handlers.School{}}},
+	{Method: "POST", Path: "/api/v1/schools/:id/domain/challenge", Summary: "Get the DNS TXT record that verifies a school's domain", Tags: []string{"Schools"},
+		Responses: openapi.Responses{200: domains.Challenge{}}},
+	{Method: "POST", Path: "/api/v1/schools/:id/domain/verify", Summary: "Verify a school's domain by its DNS TXT record", Tags: []string{"Schools"},
+		Responses: openapi.Responses{200: domains.Challenge{}}},
+	{Method: "DELETE", Path: "/api/v1/schools/:id", Summary: "Delete a school, purging it after the grace period", Tags: []string{"Schools"},
+		Responses: openapi.Responses{200: lifecycle.Deletion{}}},
+	{Method: "POST", Path: "/api/v1/schools/:id/undelete", Summary: "Restore a deleted school within the grace period", Tags: []string{"Schools"},
+		Responses: openapi.Responses{200: handlers.UndeleteResponse{}}},
+	{Method: "POST", Path: "/api/v1/schools/:id/purge", Summary: "Purge a deleted school before the grace period ends", Tags: []string{"Schools"},
+		Request: handlers.PurgeSchoolRequest{}, Responses: openapi.Responses{202: openapi.Message{}}},
+	{Method: "GET", Path: "/api/v1/schools/:code/stats", Summary: "Get tenant connection pool stats", Tags: []string{"Schools"},
+		Responses: openapi.Responses{200: handlers.SchoolStatsResponse{}}},
+	{Method: "GET", Path: "/api/v1/schools/:id/settings", Summary: "Get a school's settings of every namespace", Tags: []string{"Settings"},
+		Responses: openapi.Responses{200: openapi.List(settings.Document{})}},
+	{Method: "GET", Path: "/api/v1/schools/:id/settings/:namespace", Summary: "Get a school's settings of a namespace", Tags: []string{"Settings"},
+		Responses: openapi.Responses{200: settings.Document{}}},
+	{Method: "PUT", Path: "/api/v1/schools/:id/settings/:namespace", Summary: "Store a new version of a school's settings of a namespace", Tags: []string{"Settings"},
+		Request: handlers.UpdateSettingsRequest{}, Responses: openapi.Responses{200: settings.Document{}}},
+	{Method: "GET", Path: "/api/v1/schools/:id/settings/:namespace/history", Summary: "List earlier versions of a school's settings, newest first", Tags: []string{"Settings"},
+		Params:    []openapi.Param{{Name: "limit", In: "query", Description: "At most 100; default 20", Schema: &openapi.Schema{Type: "integer"}}},
+		Responses: openapi.Responses{200: openapi.List(settings.Document{})}},
+	{Method: "GET", Path: "/api/v1/settings/schemas/:namespace", Summary: "Get the JSON schema of a settings namespace", Tags: []string{"Settings"},
+		Responses: openapi.Responses{200: openapi.Any}},
+	{Method: "GET", Path: "/api/v1/schools/:id/features", Summary: "Get whether a school has each module and flag, and why", Tags: []string{"Features"},
+		Responses: openapi.Responses{200: openapi.List(features.Feature{})}},
+	{Method: "PUT", Path: "/api/v1/schools/:id/features/:key", Summary: "Turn a module or flag on or off for a school", Tags: []string{"Features"},
+		Request: handlers.ToggleFeatureRequest{}, Responses: openapi.Responses{200: features.Feature{}}},
+	{Method: "DELETE", Path: "/api/v1/schools/:id/features/:key", Summary: "Return a school's module or flag to its default or rollout", Tags: []string{"Features"},
+		Responses: openapi.Responses{200: features.Feature{}}},
+	{Method: "GET", Path: "/api/v1/features/modules", Summary: "List the modules", Tags: []string{"Features"},
+		Responses: openapi.Responses{200: openapi.List(features.Module{})}},
+	{Method: "GET", Path: "/api/v1/features/flags", Summary: "List the feature flags", Tags: []string{"Features"},
+		Responses: openapi.Responses{200: openapi.List(features.Flag{})}},
+	{Method: "PUT", Path: "/api/v1/features/flags/:key", Summary: "Define a feature flag or change its rollout", Tags: []string{"Features"},
+		Request: handlers.PutFlagRequest{}, Responses: openapi.Responses{200: features.Flag{}}},
+	{Method: "DELETE", Path: "/api/v1/features/flags/:key", Summary: "Delete a feature flag and every school's toggle of it", Tags: []string{"Features"},
+		Responses: openapi.Responses{200: openapi.Message{}}},
+
+	{Method: "PUT", Path: "/api/v1/schools/:id/plan", Summary: "Move a school to another plan", Tags: []string{"Plans"},
+		Request: handlers.AssignPlanRequest{}, Responses: openapi.Responses{200: plans.Plan{}}},
+	{Method: "GET", Path: "/api/v1/schools/:id/usage", Summary: "Get where a school's usage stands against its plan", Tags: []string{"Plans"},
+		Responses: openapi.Responses{200: handlers.UsageResponse{}}},
+	{Method: "GET", Path: "/api/v1/schools/:id/usage/statements", Summary: "List a school's monthly usage statements, newest first", Tags: []string{"Plans"},
+		Responses: openapi.Responses{200: openapi.List(usage.Statement{})}},
+	{Method: "GET", Path: "/api/v1/schools/:id/usage/statements/:month", Summary: "Get a school's usage statement of a month (YYYY-MM)", Tags: []string{"Plans"},
+		Responses: openapi.Responses{200: usage.Statement{}}},
+	{Method: "GET", Path: "/api/v1/plans", Summary: "List the subscription plans", Tags: []string{"Plans"},
+		Responses: openapi.Responses{200: openapi.List(plans.Plan{})}},
+	{Method: "PUT", Path: "/api/v1/plans/:code", Summary: "Create a plan or change its limits and modules", Tags: []string{"Plans"},
+		Request: plans.Plan{}, Responses: openapi.Responses{200: plans.Plan{}}},
+
+	{Method: "GET", Path: "/api/v1/schools/:id/academic-years", Summary: "List a school's academic years with their terms, latest first", Tags: []string{"Academic years"},
+		Responses: openapi.Responses{200: openapi.List(academic.Year{})}},
+	{Method: "POST", Path: "/api/v1/schools/:id/academic-years", Summary: "Add an academic year to a school; its first year becomes current", Tags: []string{"Academic years"},
+		Request: academic.YearInput{}, Responses: openapi.Responses{201: academic.Year{}}},
+	{Method: "GET", Path: "/api/v1/schools/:id/academic-years/current", Summary: "Get a school's current academic year", Tags: []string{"Academic years"},
+		Responses: openapi.Responses{200: academic.Year{}}},
+	{Method: "POST", Path: "/api/v1/schools/:id/academic-years/rollover", Summary: "Close a school's current academic year and start the next, copying its terms", Tags: []string{"Academic years"},
+		Request: academic.RolloverInput{}, Responses: openapi.Responses{201: academic.Year{}}},
+	{Method: "GET", Path: "/api/v1/schools/:id/academic-years/:yearId", Summary: "Get an academic year of a school", Tags: []string{"Academic years"},
+		Responses: openapi.Responses{200: academic.Year{}}},
+	{Method: "PUT", Path: "/api/v1/schools/:id/academic-years/:yearId", Summary: "Replace the name, dates and terms of an academic year that is not closed", Tags: []string{"Academic years"},
+		Request: academic.YearInput{}, Responses: openapi.Responses{200: academic.Year{}}},
+	{Method: "DELETE", Path: "/api/v1/schools/:id/academic-years/:yearId", Summary: "Delete an academic year that is neither current nor closed", Tags: []string{"Academic years"},
+		Responses: openapi.Responses{200: openapi.Message{}}},
+	{Method: "POST", Path: "/api/v1/schools/:id/academic-years/:yearId/activate", Summary: "Make an academic year the school's current year", Tags: []string{"Academic years"},
+		Responses: openapi.Responses{200: academic.Year{}}},
+
+	{Method: "GET", Path: "/api/v1/schools/:id/calendar/events", Summary: "List a school's calendar events, of those running between from and to when given", Tags: []string{"Calendar"},
+		Params:    []openapi.Param{dateParam("from", false), dateParam("to", false)},
+		Responses: openapi.Responses{200: openapi.List(calendar.Event{})}},
+	{Method: "POST", Path: "/api/v1/schools/:id/calendar/events", Summary: "Add a holiday, weekly off, exam, event or working day to a school's calendar, of the school or of some classes", Tags: []string{"Calendar"},
+		Request: calendar.EventInput{}, Responses: openapi.Responses{201: calendar.Event{}}},
+	{Method: "GET", Path: "/api/v1/schools/:id/calendar/events/:eventId", Summary: "Get an event of a school's calendar", Tags: []string{"Calendar"},
+		Responses: openapi.Responses{200: calendar.Event{}}},
+	{Method: "PUT", Path: "/api/v1/schools/:id/calendar/events/:eventId", Summary: "Replace an event of a school's calendar", Tags: []string{"Calendar"},
+		Request: calendar.EventInput{}, Responses: openapi.Responses{200: calendar.Event{}}},
+	{Method: "DELETE", Path: "/api/v1/schools/:id/calendar/events/:eventId", Summary: "Delete an event of a school's calendar", Tags: []string{"Calendar"},
+		Responses: openapi.Responses{200: openapi.Message{}}},
+	{Method: "GET", Path: "/api/v1/schools/:id/calendar/ical", Summary: "Export a school's calendar as iCalendar", Tags: []string{"Calendar"},
+		Responses: openapi.Responses{200: openapi.Raw{ContentType: calendar.ContentType, Schema: &openapi.Schema{Type: "string"}}}},
+	{Method: "POST", Path: "/api/v1/schools/:id/calendar/ical", Summary: "Import an iCalendar document into a school's calendar; events replace those of the same UID, and with replace=true the others are deleted", Tags: []string{"Calendar"},
+		Params:    []openapi.Param{{Name: "replace", In: "query", Schema: &openapi.Schema{Type: "boolean"}}},
+		Request:   openapi.Raw{ContentType: calendar.ContentType, Schema: &openapi.Schema{Type: "string"}},
+		Responses: openapi.Responses{200: calendar.ImportResult{}}},
+	{Method: "GET", Path: "/api/v1/schools/:id/calendar/days", Summary: "List the days from from to to with whether the school, or the class of class_id, works on them", Tags: []string{"Calendar"},
+		Params:    []openapi.Param{dateParam("from", true), dateParam("to", true), {Name: "class_id", In: "query", Schema: &openapi.Schema{Type: "string"}}},
+		Responses: openapi.Responses{200: handlers.WorkingDays{}}},
+
+	{Method: "GET", Path: storage.FilesPath + "/*", Summary: "Download a file by its signed URL", Tags: []string{"Files"},
+		Params:    []openapi.Param{{Name: "expires", In: "query", Required: true, Schema: &openapi.Schema{Type: "integer"}}, {Name: "signature", In: "query", Required: true, Schema: &openapi.Schema{Type: "string"}}},
+		Responses: openapi.Responses{200: openapi.Binary}},
+
+	{Method: "GET", Path: "/", Summary: "Service information", Responses: openapi.Responses{200: openapi.Any}},
+	{Method: "GET", Path: "/uploads/*", Summary: "Download a public file, such as a school logo", Tags: []string{"Files"},
+		Responses: openapi.Responses{200: openapi.Binary}},
+	{Method: "GET", Path: "/health", Summary: "Health check", Responses: openapi.Responses{200: openapi.Health{}}},
+	{Method: "GET", Path: "/metrics", Summary: "Prometheus metrics, including tenant connection pools",
+		Responses: openapi.Responses{200: openapi.Raw{ContentType: "text/plain", Schema: &openapi.Schema{Type: "string"}}}},
+	{Method: "GET", Path: "/openapi.json", Summary: "OpenAPI document", Responses: openapi.Responses{200: openapi.Any}},
+}
@@ -4,25 +4,105 @@ import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/jackc/pgx/v5/pgxpool"
 
+	"school-erp/pkg/academic"
+	"school-erp/pkg/calendar"
+	"school-erp/pkg/features"
+	"school-erp/pkg/idempotency"
+	"school-erp/pkg/plans"
+	"school-erp/pkg/settings"
+	"school-erp/pkg/storage"
+	"school-erp/pkg/tenant"
+	"school-erp/school/domains"
 	"school-erp/school/handlers"
-	"school-erp/school/pkg/tenant"
+	"school-erp/school/lifecycle"
+	"school-erp/school/usage"
 )
 
 // SetupRoutes sets up all application routes
-func SetupRoutes(app *fiber.App, db *pgxpool.Pool, tenantManager *tenant.TenantManager) {
-	// Create handler
-	schoolHandler := handlers.NewSchoolHandler(db, tenantManager)
+func SetupRoutes(app *fiber.App, db *pgxpool.Pool, tenantManager *tenant.TenantManager, lc *lifecycle.Manager, dm *domains.Service, store *settings.Store, flags *features.Store, subscriptions *plans.Store, meter *usage.Meter, years *academic.Store, events *calendar.Store, files *storage.Files) {
+	// Create handlers
+	schoolHandler := handlers.NewSchoolHandler(db, tenantManager, lc, dm, files)
+	settingsHandler := handlers.NewSettingsHandler(store)
+	featuresHandler := handlers.NewFeaturesHandler(flags)
+	plansHandler := handlers.NewPlansHandler(subscriptions, meter)
+	academicHandler := handlers.NewAcademicHandler(years, store)
+	calendarHandler := handlers.NewCalendarHandler(events, store)
+
+	// Retried creates with the same Idempotency-Key replay the first response.
+	// Schools are created by platform administrators, outside any school, so
+	// their keys share one scope
+	idempotent := idempotency.New(idempotency.Config{
+		Store:      idempotency.NewPostgresStore(db),
+		TenantFunc: func(*fiber.Ctx) string { return "" },
+	})
 
 	// API routes
 	api := app.Group("/api/v1")
 
 	// School management endpoints
 	schools := api.Group("/schools")
-	schools.Post("/upload-logo", schoolHandler.UploadLogo)           // Upload school logo
-	schools.Post("/", schoolHandler.CreateSchool)                    // Create school
-	schools.Get("/", schoolHandler.GetSchools)                       // List schools
-	schools.Get("/:id", schoolHandler.GetSchool)                     // Get school by ID
-	schools.Put("/:id", schoolHandler.UpdateSchool)                  // Update school
-	schools.Delete("/:id", schoolHandler.DeleteSchool)               // Delete school
-	schools.Get("/:code/stats", schoolHandler.GetSchoolStats)        // Get school DB stats
+	schools.Post("/upload-logo", schoolHandler.UploadLogo)                   // Upload school logo
+	schools.Post("/", idempotent, schoolHandler.CreateSchool)                // Create school
+	schools.Get("/", schoolHandler.GetSchools)                               // List schools
+	schools.Get("/:id", schoolHandler.GetSchool)                             // Get school by ID
+	schools.Get("/:id/provisioning", schoolHandler.GetProvisioning)          // Get provisioning status
+	schools.Post("/:id/rotate-credentials", schoolHandler.RotateCredentials) // Rotate database password
+	schools.Put("/:id", schoolHandler.UpdateSchool)                          // Update school
+	schools.Post("/:id/domain/challenge", schoolHandler.DomainChallenge)     // Get the domain's verification record
+	schools.Post("/:id/domain/verify", schoolHandler.VerifyDomain)           // Verify the domain
+	schools.Delete("/:id", schoolHandler.DeleteSchool)                       // Delete school
+	schools.Post("/:id/undelete", schoolHandler.UndeleteSchool)              // Undo a delete within the grace period
+	schools.Post("/:id/purge", schoolHandler.PurgeSchool)                    // Purge a deleted school now
+	schools.Get("/:code/stats", schoolHandler.GetSchoolStats)                // Get school DB stats
+
+	// Per-school settings, one versioned document per namespace
+	schools.Get("/:id/settings", settingsHandler.ListSettings)
+	schools.Get("/:id/settings/:namespace", settingsHandler.GetSettings)
+	schools.Put("/:id/settings/:namespace", settingsHandler.UpdateSettings)
+	schools.Get("/:id/settings/:namespace/history", settingsHandler.GetSettingsHistory)
+	api.Get("/settings/schemas/:namespace", settingsHandler.GetSettingsSchema)
+
+	// Modules and feature flags; the gateway and the services refuse the
+	// routes of modules a school has turned off
+	schools.Get("/:id/features", featuresHandler.ListFeatures)
+	schools.Put("/:id/features/:key", featuresHandler.ToggleFeature)
+	schools.Delete("/:id/features/:key", featuresHandler.ResetFeature)
+	api.Get("/features/modules", featuresHandler.ListModules)
+	api.Get("/features/flags", featuresHandler.ListFlags)
+	api.Put("/features/flags/:key", featuresHandler.PutFlag)
+	api.Delete("/features/flags/:key", featuresHandler.DeleteFlag)
+
+	// Subscription plans and metered usage; the services enforce the limits
+	schools.Put("/:id/plan", plansHandler.AssignPlan)
+	schools.Get("/:id/usage", plansHandler.GetUsage)
+	schools.Get("/:id/usage/statements", plansHandler.ListStatements)
+	schools.Get("/:id/usage/statements/:month", plansHandler.GetStatement)
+	api.Get("/plans", plansHandler.ListPlans)
+	api.Put("/plans/:code", plansHandler.PutPlan)
+
+	// Academic years and their terms; the services stamp enrollments,
+	// invoices, exams and attendance with the year they fall in
+	schools.Get("/:id/academic-years", academicHandler.ListYears)
+	schools.Post("/:id/academic-years", academicHandler.CreateYear)
+	schools.Get("/:id/academic-years/current", academicHandler.GetCurrentYear)
+	schools.Post("/:id/academic-years/rollover", academicHandler.Rollover)
+	schools.Get("/:id/academic-years/:yearId", academicHandler.GetYear)
+	schools.Put("/:id/academic-years/:yearId", academicHandler.UpdateYear)
+	schools.Delete("/:id/academic-years/:yearId", academicHandler.DeleteYear)
+	schools.Post("/:id/academic-years/:yearId/activate", academicHandler.ActivateYear)
+
+	// Holidays, weekly offs, exams and events of schools; attendance and fees
+	// count school days by them
+	schools.Get("/:id/calendar/events", calendarHandler.ListEvents)
+	schools.Post("/:id/calendar/events", calendarHandler.CreateEvent)
+	schools.Get("/:id/calendar/events/:eventId", calendarHandler.GetEvent)
+	schools.Put("/:id/calendar/events/:eventId", calendarHandler.UpdateEvent)
+	schools.Delete("/:id/calendar/events/:eventId", calendarHandler.DeleteEvent)
+	schools.Get("/:id/calendar/ical", calendarHandler.ExportCalendar)
+	schools.Post("/:id/calendar/ical", calendarHandler.ImportCalendar)
+	schools.Get("/:id/calendar/days", calendarHandler.GetDays)
+
+	// Private files by signed URL, such as student documents and receipts;
+	// the signature authorizes the download
+	app.Get(storage.FilesPath+"/*", files.Serve())
 }
@@ -0,0 +1,51 @@
+package routes
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"school-erp/pkg/openapi"
+	"school-erp/pkg/problem"
+	"school-erp/pkg/storage"
+)
+
+// SetupSystemRoutes mounts the welcome route, uploaded files, health check,
+// metrics, API document and the 404 handler. Call it after SetupRoutes.
+func SetupSystemRoutes(app *fiber.App, files *storage.Files) {
+	// Welcome route
+	app.Get("/", func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{
+			"service": "School ERP School Service",
+			"version": "v1.0.0",
+			"status":  "running",
+			"endpoints": fiber.Map{
+				"health":  "/health",
+				"metrics": "/metrics",
+				"openapi": "/openapi.json",
+				"schools": "/api/v1/schools",
+			},
+		})
+	})
+
+	// Public files, such as school logos
+	app.Get("/uploads/*", storage.ServePublic(files.Store()))
+
+	// Health check endpoint
+	app.Get("/health", func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{
+			"status":  "healthy",
+			"service": "school-service",
+		})
+	})
+
+	// Prometheus metrics, including tenant connection pools
+	app.Get("/metrics", adaptor.HTTPHandler(promhttp.Handler()))
+
+	app.Get("/openapi.json", openapi.Handler(app, APIInfo, Operations))
+
+	// 404 handler
+	app.All("*", func(c *fiber.Ctx) error {
+		return problem.NotFound("Route not found")
+	})
+}
@@ -0,0 +1,174 @@
+// Package transfer moves a dedicated school between clusters. Export writes
+// a portable archive of the school's metadata, database and uploaded files;
+// Import recreates the school from it on another database host.
+package transfer
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"school-erp/pkg/academic"
+	"school-erp/pkg/settings"
+	"school-erp/pkg/storage"
+	"school-erp/school/database"
+)
+
+// FormatVersion is the version of the archive layout:
+//
+//	manifest.json        the Manifest
+//	data/<table>.copy    each table in COPY text format, in manifest order
+//	uploads/<key>        the school's uploaded files by storage key
+//
+// The archive is a gzip-compressed tar; manifest.json is its first entry.
+const FormatVersion = 1
+
+const manifestName = "manifest.json"
+
+// ErrIncompatible is returned for archives this build cannot import
+var ErrIncompatible = errors.New("archive is not compatible with this version")
+
+// Manifest describes an archive
+type Manifest struct {
+	FormatVersion int       `json:"format_version"`
+	SchemaVersion int       `json:"schema_version"` // database.TenantSchemaVersion of the source
+	ExportedAt    time.Time `json:"exported_at"`
+	School        School    `json:"school"`
+	Tables        []Table   `json:"tables"`
+	// Uploads are the storage keys of the school's logo and files
+	Uploads []string `json:"uploads"`
+	// Settings are the school's current settings; their history stays behind
+	Settings []settings.Document `json:"settings,omitempty"`
+	// Features are the school's own module and flag toggles by key
+	Features map[string]bool `json:"features,omitempty"`
+	// Plan is the code of the school's plan; metered usage stays behind
+	Plan string `json:"plan,omitempty"`
+	// AcademicYears are the school's years with their terms, keeping their
+	// IDs, which the school's records are stamped with
+	AcademicYears []academic.Year `json:"academic_years,omitempty"`
+}
+
+// School is the school's row in the schools table, without its database
+// settings and credentials, which the target cluster assigns
+type School struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Code      string    `json:"code"`
+	Domain    string    `json:"domain"`
+	LogoURL   string    `json:"logo_url"`
+	Timezone  string    `json:"timezone"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Table is a table of the school's database
+type Table struct {
+	Name    string   `json:"name"`
+	Columns []string `json:"columns"`
+	Rows    int64    `json:"rows"`
+}
+
+func dataName(table string) string {
+	return "data/" + table + ".copy"
+}
+
+func uploadName(file string) string {
+	return "uploads/" + file
+}
+
+// archiveWriter writes the entries of an archive
+type archiveWriter struct {
+	gz *gzip.Writer
+	tw *tar.Writer
+}
+
+func newArchiveWriter(w io.Writer) *archiveWriter {
+	gz := gzip.NewWriter(w)
+	return &archiveWriter{gz: gz, tw: tar.NewWriter(gz)}
+}
+
+// add writes an entry of size bytes read from r
+func (a *archiveWriter) add(name string, size int64, modTime time.Time, r io.Reader) error {
+	err := a.tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     size,
+		Mode:     0o600,
+		ModTime:  modTime,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(a.tw, r)
+	return err
+}
+
+func (a *archiveWriter) Close() error {
+	if err := a.tw.Close(); err != nil {
+		return err
+	}
+	return a.gz.Close()
+}
+
+// archiveReader reads an archive's entries in order
+type archiveReader struct {
+	gz *gzip.Reader
+	tr *tar.Reader
+}
+
+// openArchive reads and checks the manifest of an archive
+func openArchive(r io.Reader) (*archiveReader, *Manifest, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, nil, fmt.Errorf("not a school archive: %w", err)
+	}
+	a := &archiveReader{gz: gz, tr: tar.NewReader(gz)}
+
+	hdr, err := a.tr.Next()
+	if err != nil || hdr.Name != manifestName {
+		return nil, nil, fmt.Errorf("not a school archive: %s is missing", manifestName)
+	}
+	var m Manifest
+	if err := json.NewDecoder(a.tr).Decode(&m); err != nil {
+		return nil, nil, fmt.Errorf("invalid %s: %w", manifestName, err)
+	}
+	if m.FormatVersion != FormatVersion {
+		return nil, nil, fmt.Errorf("%w: archive format %d, want %d", ErrIncompatible, m.FormatVersion, FormatVersion)
+	}
+	// Older schemas import into the current tables, which only add to them
+	if m.SchemaVersion > database.TenantSchemaVersion {
+		return nil, nil, fmt.Errorf("%w: archive schema version %d is newer than %d; upgrade the target first",
+			ErrIncompatible, m.SchemaVersion, database.TenantSchemaVersion)
+	}
+	return a, &m, nil
+}
+
+// next returns the next entry, which must be name
+func (a *archiveReader) next(name string) (io.Reader, error) {
+	hdr, err := a.tr.Next()
+	if err != nil {
+		return nil, fmt.Errorf("archive is truncated before %s: %w", name, err)
+	}
+	if hdr.Name != name {
+		return nil, fmt.Errorf("archive has %s where %s was expected", hdr.Name, name)
+	}
+	return a.tr, nil
+}
+
+// checkUpload rejects keys that are not the school's own files: those
+// under its prefix, public logos and logos of before the file store
+func checkUpload(schoolID, key string) error {
+	if err := storage.CheckKey(key); err != nil {
+		return err
+	}
+	legacy := strings.HasPrefix(key, "school-logo-") && !strings.Contains(key, "/")
+	if !legacy && !strings.HasPrefix(key, storage.SchoolPrefix(schoolID)) && !strings.HasPrefix(key, storage.PublicPrefix+"logos/") {
+		return fmt.Errorf("upload %q is not a file of school %s", key, schoolID)
+	}
+	return nil
+}
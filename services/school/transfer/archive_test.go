@@ -0,0 +1,169 @@
+package transfer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"school-erp/pkg/storage"
+	"school-erp/school/database"
+)
+
+func writeTestArchive(t *testing.T, m *Manifest) []byte {
+	t.Helper()
+	spool, files := t.TempDir(), storage.NewLocalStore(t.TempDir())
+	for i, table := range m.Tables {
+		if err := os.WriteFile(filepath.Join(spool, strconv.Itoa(i)), []byte(table.Name+" rows\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, key := range m.Uploads {
+		if err := files.Put(context.Background(), key, strings.NewReader("image"), 5, storage.ContentType(key)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	s := &Service{files: files}
+	if err := s.writeArchive(context.Background(), &buf, m, spool); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestArchiveRoundTrip(t *testing.T) {
+	m := &Manifest{
+		FormatVersion: FormatVersion,
+		SchemaVersion: database.TenantSchemaVersion,
+		ExportedAt:    time.Now().UTC().Truncate(time.Second),
+		School:        School{ID: "7d0c1a5e-0000-4000-8000-000000000001", Code: "EIS", Status: "active"},
+		Tables: []Table{
+			{Name: "students", Columns: []string{"id", "name"}, Rows: 1},
+			{Name: "users", Columns: []string{"id", "email"}, Rows: 1},
+		},
+		Uploads: []string{"school-logo-1.png", "schools/7d0c1a5e-0000-4000-8000-000000000001/documents/1.pdf"},
+	}
+	archive := writeTestArchive(t, m)
+
+	a, got, err := openArchive(bytes.NewReader(archive))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.School != m.School || len(got.Tables) != 2 || !got.ExportedAt.Equal(m.ExportedAt) {
+		t.Fatalf("manifest = %+v", got)
+	}
+	for _, table := range got.Tables {
+		r, err := a.next(dataName(table.Name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data, _ := io.ReadAll(r); string(data) != table.Name+" rows\n" {
+			t.Errorf("%s data = %q", table.Name, data)
+		}
+	}
+	for _, key := range got.Uploads {
+		r, err := a.next(uploadName(key))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data, _ := io.ReadAll(r); string(data) != "image" {
+			t.Errorf("%s = %q", key, data)
+		}
+	}
+}
+
+func TestArchiveCompatibility(t *testing.T) {
+	m := &Manifest{FormatVersion: FormatVersion, SchemaVersion: database.TenantSchemaVersion + 1}
+	if _, _, err := openArchive(bytes.NewReader(writeTestArchive(t, m))); !errors.Is(err, ErrIncompatible) {
+		t.Errorf("archive of newer schema: %v", err)
+	}
+
+	m = &Manifest{FormatVersion: FormatVersion + 1}
+	if _, _, err := openArchive(bytes.NewReader(writeTestArchive(t, m))); !errors.Is(err, ErrIncompatible) {
+		t.Errorf("archive of newer format: %v", err)
+	}
+
+	if _, _, err := openArchive(bytes.NewReader([]byte("not an archive"))); err == nil {
+		t.Error("garbage was accepted")
+	}
+}
+
+func TestCheckUpload(t *testing.T) {
+	const id = "7d0c1a5e-0000-4000-8000-000000000001"
+	for _, key := range []string{"", "..", "../etc/passwd", "a/b", "schools/other/documents/1.pdf", "schools/" + id + "/../other/1.pdf", "public/x.png"} {
+		if checkUpload(id, key) == nil {
+			t.Errorf("%q was accepted", key)
+		}
+	}
+	for _, key := range []string{"school-logo-1.png", "public/logos/ab.png", "schools/" + id + "/documents/ab.pdf"} {
+		if err := checkUpload(id, key); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+// TestTruncateSQL empties every table at once, so that tables referenced by
+// others' foreign keys can be emptied
+func TestTruncateSQL(t *testing.T) {
+	got := truncateSQL([]Table{{Name: "classes"}, {Name: "students"}, {Name: "school_profile"}})
+	want := `TRUNCATE "public"."classes", "public"."students", "public"."school_profile"`
+	if got != want {
+		t.Errorf("truncateSQL() = %s, want %s", got, want)
+	}
+}
+
+// TestTruncateReferencedTables empties a table another references, as
+// loadTables does, in the scratch database of SCHOOL_TEST_DATABASE_URL
+func TestTruncateReferencedTables(t *testing.T) {
+	dsn := os.Getenv("SCHOOL_TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("SCHOOL_TEST_DATABASE_URL not set")
+	}
+	ctx := context.Background()
+	conn, err := pgx.Connect(ctx, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(ctx)
+
+	suffix := strconv.FormatInt(time.Now().UnixNano(), 36)
+	parent, child := "truncate_parent_"+suffix, "truncate_child_"+suffix
+	for _, sql := range []string{
+		`CREATE TABLE ` + parent + ` (id INT PRIMARY KEY)`,
+		`CREATE TABLE ` + child + ` (id INT PRIMARY KEY, parent_id INT REFERENCES ` + parent + `(id))`,
+		`INSERT INTO ` + parent + ` VALUES (1)`,
+		`INSERT INTO ` + child + ` VALUES (1, 1)`,
+	} {
+		if _, err := conn.Exec(ctx, sql); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Cleanup(func() {
+		conn.Exec(context.Background(), `DROP TABLE IF EXISTS `+child+`, `+parent)
+	})
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback(ctx)
+	if _, err := tx.Exec(ctx, `SET LOCAL session_replication_role = replica`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.Exec(ctx, truncateSQL([]Table{{Name: parent}, {Name: child}})); err != nil {
+		t.Fatalf("truncate: %v", err)
+	}
+	var n int
+	if err := tx.QueryRow(ctx, `SELECT count(*) FROM `+child).Scan(&n); err != nil || n != 0 {
+		t.Errorf("%s has %d rows after truncate, %v", child, n, err)
+	}
+}
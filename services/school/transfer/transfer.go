@@ -0,0 +1,537 @@
+package transfer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"school-erp/pkg/academic"
+	"school-erp/pkg/features"
+	"school-erp/pkg/settings"
+	"school-erp/pkg/storage"
+	"school-erp/pkg/tenant"
+	"school-erp/school/database"
+)
+
+var (
+	// ErrShared is returned for shared schools, whose rows live in the main
+	// database
+	ErrShared = errors.New("shared schools cannot be exported")
+	// ErrNotProvisioned is returned while a school's database may not exist
+	ErrNotProvisioned = errors.New("school is not provisioned")
+	// ErrExists is returned when the target cluster already has the school
+	ErrExists = errors.New("a school with this ID, code or domain already exists")
+)
+
+// Service exports schools from and imports them into the cluster of db
+type Service struct {
+	db    *pgxpool.Pool
+	tm    *tenant.TenantManager
+	keys  *tenant.Keyring
+	files storage.Store
+}
+
+// NewService returns a Service; uploaded files are read from and written
+// to files. keys encrypts the passwords of imported schools.
+func NewService(db *pgxpool.Pool, tm *tenant.TenantManager, keys *tenant.Keyring, files storage.Store) *Service {
+	return &Service{db: db, tm: tm, keys: keys, files: files}
+}
+
+// source is a dedicated school's row
+type source struct {
+	School
+	tenancy, dbName, dbHost, dbUser, dbPassword string
+	dbPort                                      int
+}
+
+// Export writes an archive of the school to w. Its database is read in one
+// snapshot; suspend the school first so that no writes are lost.
+func (s *Service) Export(ctx context.Context, code string, w io.Writer, actor string) (*Manifest, error) {
+	var src source
+	err := s.db.QueryRow(ctx, `
+	SELECT id::text, name, code, domain, COALESCE(logo_url, ''), timezone, status, created_at,
+		tenancy, db_name, db_host, db_port, db_user, db_password
+	FROM schools WHERE code = $1`, code,
+	).Scan(&src.ID, &src.Name, &src.Code, &src.Domain, &src.LogoURL, &src.Timezone, &src.Status, &src.CreatedAt,
+		&src.tenancy, &src.dbName, &src.dbHost, &src.dbPort, &src.dbUser, &src.dbPassword)
+	if err != nil {
+		return nil, err
+	}
+	if src.tenancy == tenant.Shared {
+		return nil, ErrShared
+	}
+	if src.Status == "provisioning" || src.Status == "failed" {
+		return nil, ErrNotProvisioned
+	}
+
+	m := &Manifest{
+		FormatVersion: FormatVersion,
+		SchemaVersion: database.TenantSchemaVersion,
+		ExportedAt:    time.Now().UTC(),
+		School:        src.School,
+	}
+
+	// Tables are spooled to temporary files: a tar entry needs its size
+	spool, err := os.MkdirTemp("", "school-export-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(spool)
+	if m.Tables, err = s.dumpTables(ctx, &src, spool); err != nil {
+		return nil, err
+	}
+	docs, err := settings.NewStore(s.db, nil).List(ctx, src.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read settings: %w", err)
+	}
+	for _, d := range docs {
+		if d.Version > 0 {
+			m.Settings = append(m.Settings, d)
+		}
+	}
+	state, err := features.NewStore(s.db, nil).State(ctx, src.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read features: %w", err)
+	}
+	if len(state.Toggles) > 0 {
+		m.Features = state.Toggles
+	}
+	if err := s.db.QueryRow(ctx, `SELECT plan_code FROM schools WHERE id = $1`, src.ID).Scan(&m.Plan); err != nil {
+		return nil, fmt.Errorf("failed to read plan: %w", err)
+	}
+	if m.AcademicYears, err = academic.NewStore(s.db, nil).List(ctx, src.ID); err != nil {
+		return nil, fmt.Errorf("failed to read academic years: %w", err)
+	}
+	if key, ok := strings.CutPrefix(src.LogoURL, "/uploads/"); ok && checkUpload(src.ID, key) == nil {
+		if r, err := s.files.Get(ctx, key); err == nil {
+			r.Close()
+			m.Uploads = append(m.Uploads, key)
+		} else {
+			log.Printf("Skipping logo of school %s: %v\n", code, err)
+		}
+	}
+	files, err := s.files.List(ctx, storage.SchoolPrefix(src.ID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list files: %w", err)
+	}
+	for _, f := range files {
+		m.Uploads = append(m.Uploads, f.Key)
+	}
+
+	if err := s.writeArchive(ctx, w, m, spool); err != nil {
+		return nil, fmt.Errorf("failed to write archive: %w", err)
+	}
+
+	_, err = s.db.Exec(ctx, `
+	INSERT INTO school_audit_log (school_id, actor, action, details) VALUES ($1, $2, 'exported', $3)`,
+		src.ID, actor, map[string]any{"tables": len(m.Tables), "uploads": len(m.Uploads)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to write audit log: %w", err)
+	}
+	return m, nil
+}
+
+// dumpTables copies every table of the school's database into dir
+func (s *Service) dumpTables(ctx context.Context, src *source, dir string) ([]Table, error) {
+	pool, err := s.tm.GetConnection(ctx, src.Code, src.dbHost, src.dbPort, src.dbName, src.dbUser, src.dbPassword)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `
+	SELECT c.table_name, array_agg(c.column_name::text ORDER BY c.ordinal_position)
+	FROM information_schema.columns c
+	JOIN information_schema.tables t USING (table_schema, table_name)
+	WHERE c.table_schema = 'public' AND t.table_type = 'BASE TABLE'
+	GROUP BY c.table_name ORDER BY c.table_name`)
+	if err != nil {
+		return nil, err
+	}
+	tables, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (Table, error) {
+		var t Table
+		err := row.Scan(&t.Name, &t.Columns)
+		return t, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tables: %w", err)
+	}
+
+	for i := range tables {
+		t := &tables[i]
+		f, err := os.Create(filepath.Join(dir, strconv.Itoa(i)))
+		if err != nil {
+			return nil, err
+		}
+		tag, err := tx.Conn().PgConn().CopyTo(ctx, f, copySQL(t, "TO STDOUT"))
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to copy %s: %w", t.Name, err)
+		}
+		t.Rows = tag.RowsAffected()
+	}
+	return tables, nil
+}
+
+func copySQL(t *Table, direction string) string {
+	columns := make([]string, len(t.Columns))
+	for i, c := range t.Columns {
+		columns[i] = pgx.Identifier{c}.Sanitize()
+	}
+	return fmt.Sprintf("COPY %s (%s) %s", pgx.Identifier{"public", t.Name}.Sanitize(), strings.Join(columns, ", "), direction)
+}
+
+// truncateSQL empties tables in one statement: TRUNCATE refuses a table
+// referenced by a foreign key unless the referencing table goes with it,
+// even with triggers off
+func truncateSQL(tables []Table) string {
+	names := make([]string, len(tables))
+	for i, t := range tables {
+		names[i] = pgx.Identifier{"public", t.Name}.Sanitize()
+	}
+	return "TRUNCATE " + strings.Join(names, ", ")
+}
+
+func (s *Service) writeArchive(ctx context.Context, w io.Writer, m *Manifest, spool string) error {
+	a := newArchiveWriter(w)
+	manifest, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := a.add(manifestName, int64(len(manifest)), m.ExportedAt, bytes.NewReader(manifest)); err != nil {
+		return err
+	}
+
+	addFile := func(name, path string) error {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil {
+			return err
+		}
+		return a.add(name, info.Size(), info.ModTime(), f)
+	}
+	for i, t := range m.Tables {
+		if err := addFile(dataName(t.Name), filepath.Join(spool, strconv.Itoa(i))); err != nil {
+			return err
+		}
+	}
+	for _, key := range m.Uploads {
+		data, err := s.readUpload(ctx, key)
+		if err != nil {
+			return err
+		}
+		if err := a.add(uploadName(key), int64(len(data)), m.ExportedAt, bytes.NewReader(data)); err != nil {
+			return err
+		}
+	}
+	return a.Close()
+}
+
+// Target is the database host an imported school's database is created on,
+// with a superuser that can create it and load its rows
+type Target struct {
+	Admin tenant.Admin
+}
+
+// Import creates the school of an archive in this cluster, with its
+// database on target. The school gets a new database password, encrypted
+// with this cluster's keyring, and keeps its ID, code, domain and status.
+// On failure nothing is left behind.
+func (s *Service) Import(ctx context.Context, r io.Reader, target Target, actor string) (m *Manifest, err error) {
+	a, m, err := openArchive(r)
+	if err != nil {
+		return nil, err
+	}
+	sc := m.School
+	if err := tenant.ValidateCode(sc.Code); err != nil {
+		return nil, err
+	}
+	for _, key := range m.Uploads {
+		if err := checkUpload(sc.ID, key); err != nil {
+			return nil, err
+		}
+	}
+
+	dbName, dbUser := tenant.DatabaseName(sc.Code), tenant.UserName(sc.Code)
+	password, err := tenant.GeneratePassword()
+	if err != nil {
+		return nil, err
+	}
+	encrypted, err := s.keys.Encrypt(password)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt password: %w", err)
+	}
+
+	admin, err := pgxpool.New(ctx, target.Admin.DSN("postgres"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to target host: %w", err)
+	}
+	defer admin.Close()
+	// Never adopt, and on failure drop, a database that was already there
+	var exists bool
+	if err := admin.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM pg_database WHERE datname = $1)`, dbName).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("failed to check database: %w", err)
+	}
+	if exists {
+		return nil, fmt.Errorf("%w: database %s exists on %s", ErrExists, dbName, target.Admin.Host)
+	}
+
+	// The school stays provisioning, so that no service serves it, until
+	// its data is in place
+	tag, err := s.db.Exec(ctx, `
+	INSERT INTO schools (id, name, code, db_name, tenancy, db_user, db_password, db_host, db_port,
+		domain, logo_url, timezone, status, created_at, db_password_rotated_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, NULLIF($11, ''), $12, 'provisioning', $13, NOW())
+	ON CONFLICT DO NOTHING`,
+		sc.ID, sc.Name, sc.Code, dbName, tenant.Dedicated, dbUser, encrypted, target.Admin.Host, target.Admin.Port,
+		sc.Domain, sc.LogoURL, sc.Timezone, sc.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create school: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, ErrExists
+	}
+
+	tm := tenant.NewTenantManager(s.keys, tenant.PoolLimits{MaxConns: 2}, target.Admin)
+	defer tm.CloseAllConnections()
+
+	var written []string
+	defer func() {
+		if err == nil {
+			return
+		}
+		bg := context.WithoutCancel(ctx)
+		for _, key := range written {
+			_ = s.files.Delete(bg, key)
+		}
+		if derr := tm.DropTenantDatabase(bg, admin, sc.Code, dbName); derr == nil {
+			_ = tm.DropTenantUser(bg, admin, dbUser)
+		}
+		_, _ = s.db.Exec(bg, `DELETE FROM schools WHERE id = $1`, sc.ID)
+	}()
+
+	if err = tm.CreateTenantDatabase(ctx, admin, sc.Code, dbName, dbUser, password); err != nil {
+		return nil, err
+	}
+	// The school's user owns the tables, as in a provisioned database
+	pool, err := tm.GetConnection(ctx, sc.Code, target.Admin.Host, target.Admin.Port, dbName, dbUser, encrypted)
+	if err != nil {
+		return nil, err
+	}
+	if err = database.RunTenantMigrations(ctx, pool); err != nil {
+		return nil, err
+	}
+	if err = s.loadTables(ctx, a, m, target.Admin.DSN(dbName)); err != nil {
+		return nil, err
+	}
+	// Archives of older schemas keep students' classes as names
+	if err = database.NormalizeTenantClasses(ctx, pool); err != nil {
+		return nil, err
+	}
+	if written, err = s.writeUploads(ctx, a, m); err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+	if _, err = tx.Exec(ctx, `UPDATE schools SET status = $2 WHERE id = $1`, sc.ID, sc.Status); err != nil {
+		return nil, err
+	}
+	for _, d := range m.Settings {
+		if _, err = settings.Parse(d.Namespace, d.Settings); err != nil {
+			return nil, fmt.Errorf("invalid %s settings: %w", d.Namespace, err)
+		}
+		_, err = tx.Exec(ctx, `
+		INSERT INTO school_settings (school_id, namespace, version, data, updated_by, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6)`, sc.ID, d.Namespace, d.Version, []byte(d.Settings), d.UpdatedBy, d.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		_, err = tx.Exec(ctx, `
+		INSERT INTO school_settings_history (school_id, namespace, version, data, changed_by, changed_at)
+		VALUES ($1, $2, $3, $4, $5, $6)`, sc.ID, d.Namespace, d.Version, []byte(d.Settings), d.UpdatedBy, d.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+	}
+	// Schools whose plan the target lacks stay on its default plan
+	if m.Plan != "" {
+		tag, err := tx.Exec(ctx, `
+		UPDATE schools SET plan_code = $2 WHERE id = $1 AND EXISTS (SELECT 1 FROM plans WHERE code = $2)`, sc.ID, m.Plan)
+		if err != nil {
+			return nil, err
+		}
+		if tag.RowsAffected() == 0 {
+			log.Printf("Importing school %s: plan %q is unknown here, keeping the default plan\n", sc.Code, m.Plan)
+		}
+	}
+	for key, enabled := range m.Features {
+		_, err = tx.Exec(ctx, `
+		INSERT INTO school_features (school_id, key, enabled, updated_by) VALUES ($1, $2, $3, $4)`,
+			sc.ID, key, enabled, actor)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, y := range m.AcademicYears {
+		_, err = tx.Exec(ctx, `
+		INSERT INTO academic_years (id, school_id, name, calendar, start_date, end_date, is_current, closed_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+			y.ID, sc.ID, y.Name, y.Calendar, y.StartDate, y.EndDate, y.Current, y.ClosedAt, y.CreatedAt, y.UpdatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to import academic year %s: %w", y.Name, err)
+		}
+		for _, t := range y.Terms {
+			_, err = tx.Exec(ctx, `
+			INSERT INTO academic_terms (id, year_id, name, position, start_date, end_date) VALUES ($1, $2, $3, $4, $5, $6)`,
+				t.ID, y.ID, t.Name, t.Position, t.StartDate, t.EndDate)
+			if err != nil {
+				return nil, fmt.Errorf("failed to import academic year %s: %w", y.Name, err)
+			}
+		}
+	}
+	_, err = tx.Exec(ctx, `
+	INSERT INTO school_audit_log (school_id, actor, action, details) VALUES ($1, $2, 'imported', $3)`,
+		sc.ID, actor, map[string]any{
+			"exported_at":    m.ExportedAt,
+			"schema_version": m.SchemaVersion,
+			"db_host":        target.Admin.Host,
+			"db_port":        target.Admin.Port,
+		})
+	if err != nil {
+		return nil, fmt.Errorf("failed to write audit log: %w", err)
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// loadTables copies the archive's tables into the database as the admin,
+// with triggers and foreign keys off so that tables load in any order, and
+// moves sequences past the loaded rows
+func (s *Service) loadTables(ctx context.Context, a *archiveReader, m *Manifest, dsn string) error {
+	conn, err := pgx.Connect(ctx, dsn)
+	if err != nil {
+		return fmt.Errorf("failed to connect to imported database: %w", err)
+	}
+	defer conn.Close(context.WithoutCancel(ctx))
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+	if _, err := tx.Exec(ctx, `SET LOCAL session_replication_role = replica`); err != nil {
+		return err
+	}
+	// Tables created by migrations, such as school_profile, are replaced
+	if len(m.Tables) > 0 {
+		if _, err := tx.Exec(ctx, truncateSQL(m.Tables)); err != nil {
+			return fmt.Errorf("failed to empty tables: %w", err)
+		}
+	}
+
+	for i := range m.Tables {
+		t := &m.Tables[i]
+		data, err := a.next(dataName(t.Name))
+		if err != nil {
+			return err
+		}
+		tag, err := conn.PgConn().CopyFrom(ctx, data, copySQL(t, "FROM STDIN"))
+		if err != nil {
+			return fmt.Errorf("failed to load %s: %w", t.Name, err)
+		}
+		if tag.RowsAffected() != t.Rows {
+			return fmt.Errorf("table %s: loaded %d rows, archive has %d", t.Name, tag.RowsAffected(), t.Rows)
+		}
+	}
+
+	rows, err := tx.Query(ctx, `
+	SELECT table_name::text, column_name::text, pg_get_serial_sequence(quote_ident(table_name), column_name)
+	FROM information_schema.columns
+	WHERE table_schema = 'public' AND pg_get_serial_sequence(quote_ident(table_name), column_name) IS NOT NULL`)
+	if err != nil {
+		return err
+	}
+	type serial struct{ table, column, sequence string }
+	serials, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (serial, error) {
+		var s serial
+		err := row.Scan(&s.table, &s.column, &s.sequence)
+		return s, err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list sequences: %w", err)
+	}
+	for _, sr := range serials {
+		_, err := tx.Exec(ctx, fmt.Sprintf(`SELECT setval($1, COALESCE(max(%s), 0) + 1, false) FROM %s`,
+			pgx.Identifier{sr.column}.Sanitize(), pgx.Identifier{"public", sr.table}.Sanitize()), sr.sequence)
+		if err != nil {
+			return fmt.Errorf("failed to reset %s: %w", sr.sequence, err)
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+// readUpload reads the uploaded file under key
+func (s *Service) readUpload(ctx context.Context, key string) ([]byte, error) {
+	r, err := s.files.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// writeUploads stores the archive's uploaded files and returns their keys.
+// Existing files are kept: uploaded file keys are unique.
+func (s *Service) writeUploads(ctx context.Context, a *archiveReader, m *Manifest) ([]string, error) {
+	var written []string
+	for _, key := range m.Uploads {
+		r, err := a.next(uploadName(key))
+		if err != nil {
+			return written, err
+		}
+		if existing, err := s.files.Get(ctx, key); err == nil {
+			existing.Close()
+			log.Printf("Keeping existing upload %s\n", key)
+			continue
+		} else if !errors.Is(err, storage.ErrNotFound) {
+			return written, err
+		}
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return written, err
+		}
+		if err := s.files.Put(ctx, key, bytes.NewReader(data), int64(len(data)), storage.ContentType(key)); err != nil {
+			return written, err
+		}
+		written = append(written, key)
+	}
+	return written, nil
+}
@@ -0,0 +1,263 @@
+package usage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"school-erp/pkg/plans"
+)
+
+// ErrInvalidMonth is returned for months not of the form 2006-01
+var ErrInvalidMonth = errors.New("invalid month: use YYYY-MM")
+
+// ErrNoStatement is returned for months of a school without usage
+var ErrNoStatement = errors.New("no statement for the month")
+
+// Line is a statement's usage of one metric
+type Line struct {
+	Metric string `json:"metric"`
+	Unit   string `json:"unit"`
+	// Used is the month's total of counters and peak of gauges
+	Used    int64  `json:"used"`
+	Limit   *int64 `json:"limit" doc:"null is unlimited"`
+	Overage int64  `json:"overage" doc:"Usage past the limit"`
+}
+
+// Statement is a school's usage of a month against its plan. Statements of
+// past months are final; the current month's is a preview that grows.
+type Statement struct {
+	SchoolID    string    `json:"school_id"`
+	Month       string    `json:"month" doc:"YYYY-MM"`
+	Plan        string    `json:"plan"`
+	Lines       []Line    `json:"lines"`
+	Final       bool      `json:"final"`
+	GeneratedAt time.Time `json:"generated_at"`
+}
+
+// ParseMonth parses a statement month of the form 2006-01
+func ParseMonth(s string) (time.Time, error) {
+	t, err := time.Parse("2006-01", s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: %q", ErrInvalidMonth, s)
+	}
+	return t, nil
+}
+
+// lines builds the statement lines of the month's usage against p
+func lines(p *plans.Plan, used map[string]int64) []Line {
+	var out []Line
+	for _, metric := range plans.Metrics() {
+		info, _ := plans.LookupMetric(metric)
+		l := Line{Metric: metric, Unit: info.Unit, Used: used[metric], Limit: p.Limit(metric)}
+		if l.Limit != nil && l.Used > *l.Limit {
+			l.Overage = l.Used - *l.Limit
+		}
+		out = append(out, l)
+	}
+	return out
+}
+
+// monthUsage returns the school's usage of each metric in month. Gauges not
+// reported in the month stand at their last level before it.
+func (m *Meter) monthUsage(ctx context.Context, schoolID string, month time.Time) (map[string]int64, error) {
+	rows, err := m.db.Query(ctx, `
+	SELECT DISTINCT ON (metric) metric, month, value, last FROM school_usage
+	WHERE school_id = $1 AND month <= $2
+	ORDER BY metric, month DESC`, schoolID, month)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	used := map[string]int64{}
+	for rows.Next() {
+		var metric string
+		var at time.Time
+		var value, last int64
+		if err := rows.Scan(&metric, &at, &value, &last); err != nil {
+			return nil, err
+		}
+		switch info, _ := plans.LookupMetric(metric); {
+		case at.Equal(month):
+			used[metric] = value
+		case info.Kind == plans.Gauge:
+			used[metric] = last
+		}
+	}
+	return used, rows.Err()
+}
+
+// Current returns where the school's usage stands against its plan now
+func (m *Meter) Current(ctx context.Context, schoolID string) (*plans.Plan, []plans.Verdict, error) {
+	p, err := plans.NewStore(m.db, nil).ForSchool(ctx, schoolID)
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now()
+	var verdicts []plans.Verdict
+	for _, metric := range plans.Metrics() {
+		used, err := plans.Used(ctx, m.db, schoolID, metric, now)
+		if err != nil {
+			return nil, nil, err
+		}
+		verdicts = append(verdicts, p.Check(metric, used, 0))
+	}
+	return p, verdicts, nil
+}
+
+// Statement returns the school's statement of month: the stored one of a
+// closed month, or a preview of the current month. Past months that were
+// never closed are built from the usage on record against the current plan.
+func (m *Meter) Statement(ctx context.Context, schoolID string, month time.Time) (*Statement, error) {
+	month = plans.MonthOf(month)
+	st := Statement{SchoolID: schoolID, Month: month.Format("2006-01"), Final: true}
+	var data []byte
+	err := m.db.QueryRow(ctx, `
+	SELECT plan_code, lines, generated_at FROM usage_statements WHERE school_id = $1 AND month = $2`,
+		schoolID, month,
+	).Scan(&st.Plan, &data, &st.GeneratedAt)
+	if err == nil {
+		if err := json.Unmarshal(data, &st.Lines); err != nil {
+			return nil, err
+		}
+		return &st, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return nil, err
+	}
+
+	current := plans.MonthOf(time.Now())
+	if month.After(current) {
+		return nil, ErrNoStatement
+	}
+	p, err := plans.NewStore(m.db, nil).ForSchool(ctx, schoolID)
+	if err != nil {
+		return nil, err
+	}
+	used, err := m.monthUsage(ctx, schoolID, month)
+	if err != nil {
+		return nil, err
+	}
+	if len(used) == 0 && month.Before(current) {
+		return nil, ErrNoStatement
+	}
+	st.Plan = p.Code
+	st.Lines = lines(p, used)
+	st.Final = month.Before(current)
+	st.GeneratedAt = time.Now().UTC()
+	return &st, nil
+}
+
+// Statements lists the school's statements, newest first, starting with the
+// preview of the current month
+func (m *Meter) Statements(ctx context.Context, schoolID string) ([]Statement, error) {
+	preview, err := m.Statement(ctx, schoolID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	rows, err := m.db.Query(ctx, `
+	SELECT month, plan_code, lines, generated_at FROM usage_statements
+	WHERE school_id = $1 ORDER BY month DESC`, schoolID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []Statement{*preview}
+	for rows.Next() {
+		st := Statement{SchoolID: schoolID, Final: true}
+		var month time.Time
+		var data []byte
+		if err := rows.Scan(&month, &st.Plan, &data, &st.GeneratedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &st.Lines); err != nil {
+			return nil, err
+		}
+		st.Month = month.Format("2006-01")
+		out = append(out, st)
+	}
+	return out, rows.Err()
+}
+
+// Close stores the statements of every school with usage in months before
+// now that has none yet, against the plan the school is on when it runs.
+// It returns the number of statements stored.
+func (m *Meter) Close(ctx context.Context, now time.Time) (int, error) {
+	rows, err := m.db.Query(ctx, `
+	SELECT DISTINCT u.school_id::text, u.month FROM school_usage u
+	WHERE u.month < $1 AND NOT EXISTS (
+		SELECT 1 FROM usage_statements s WHERE s.school_id = u.school_id AND s.month = u.month)
+	ORDER BY u.month`, plans.MonthOf(now))
+	if err != nil {
+		return 0, err
+	}
+	type open struct {
+		schoolID string
+		month    time.Time
+	}
+	var months []open
+	for rows.Next() {
+		var o open
+		if err := rows.Scan(&o.schoolID, &o.month); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		months = append(months, o)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	store := plans.NewStore(m.db, nil)
+	closed := 0
+	for _, o := range months {
+		p, err := store.ForSchool(ctx, o.schoolID)
+		if err != nil {
+			return closed, err
+		}
+		used, err := m.monthUsage(ctx, o.schoolID, o.month)
+		if err != nil {
+			return closed, err
+		}
+		data, err := json.Marshal(lines(p, used))
+		if err != nil {
+			return closed, err
+		}
+		_, err = m.db.Exec(ctx, `
+		INSERT INTO usage_statements (school_id, month, plan_code, lines)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (school_id, month) DO NOTHING`, o.schoolID, o.month, p.Code, data)
+		if err != nil {
+			return closed, err
+		}
+		closed++
+	}
+	return closed, nil
+}
+
+// RunStatements closes past months every interval until ctx is done
+func (m *Meter) RunStatements(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if n, err := m.Close(ctx, time.Now()); err != nil && ctx.Err() == nil {
+			log.Printf("Usage statements: %v\n", err)
+		} else if n > 0 {
+			log.Printf("Usage statements: closed %d\n", n)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package usage
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"school-erp/pkg/plans"
+)
+
+func TestLines(t *testing.T) {
+	students, sms := int64(100), int64(50)
+	p := &plans.Plan{Code: "free", MaxStudents: &students, SMSCredits: &sms}
+
+	got := lines(p, map[string]int64{plans.MetricStudents: 120, plans.MetricSMS: 20, plans.MetricStorage: 1 << 30})
+	if len(got) != len(plans.Metrics()) {
+		t.Fatalf("lines = %+v", got)
+	}
+	for _, l := range got {
+		switch l.Metric {
+		case plans.MetricStudents:
+			if l.Used != 120 || l.Overage != 20 || l.Unit != "students" {
+				t.Errorf("students line = %+v", l)
+			}
+		case plans.MetricSMS:
+			if l.Overage != 0 {
+				t.Errorf("sms line = %+v", l)
+			}
+		case plans.MetricStorage:
+			if l.Limit != nil || l.Overage != 0 {
+				t.Errorf("unlimited storage line = %+v", l)
+			}
+		}
+	}
+}
+
+func TestParseMonth(t *testing.T) {
+	m, err := ParseMonth("2026-02")
+	if err != nil || !m.Equal(time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("ParseMonth = %v, %v", m, err)
+	}
+	for _, s := range []string{"", "2026-13", "2026-02-01", "feb"} {
+		if _, err := ParseMonth(s); !errors.Is(err, ErrInvalidMonth) {
+			t.Errorf("%q: err = %v", s, err)
+		}
+	}
+}
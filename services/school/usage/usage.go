@@ -0,0 +1,144 @@
+// Package usage meters how much of their plans schools use, from the
+// UsageReported events of the services and by sampling the size of tenant
+// databases and stored files, and closes each month's usage into a statement.
+package usage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"school-erp/pkg/plans"
+	"school-erp/pkg/storage"
+	"school-erp/pkg/tenant"
+)
+
+// ErrUnknownMetric is returned for reports of metrics that are not metered
+var ErrUnknownMetric = errors.New("unknown metric")
+
+// Meter records usage in school_usage of the main database: the month's
+// total of counters, and the peak and last level of gauges
+type Meter struct {
+	db    *pgxpool.Pool
+	tm    *tenant.TenantManager
+	files storage.Store
+}
+
+// NewMeter creates a meter; files is the store the services keep uploads in
+func NewMeter(db *pgxpool.Pool, tm *tenant.TenantManager, files storage.Store) *Meter {
+	return &Meter{db: db, tm: tm, files: files}
+}
+
+// Record adds a report to the school's usage of its month
+func (m *Meter) Record(ctx context.Context, e plans.UsageReported) error {
+	info, ok := plans.LookupMetric(e.Metric)
+	if !ok {
+		return fmt.Errorf("%w %q", ErrUnknownMetric, e.Metric)
+	}
+	if e.At.IsZero() {
+		e.At = time.Now()
+	}
+
+	merge := `GREATEST(school_usage.value, EXCLUDED.value)`
+	if info.Kind == plans.Counter {
+		merge = `school_usage.value + EXCLUDED.value`
+	}
+	_, err := m.db.Exec(ctx, `
+	INSERT INTO school_usage (school_id, metric, month, value, last)
+	VALUES ($1, $2, $3, $4, $4)
+	ON CONFLICT (school_id, metric, month) DO UPDATE
+	SET value = `+merge+`, last = EXCLUDED.last, updated_at = CURRENT_TIMESTAMP`,
+		e.SchoolID, e.Metric, plans.MonthOf(e.At), e.Value)
+	return err
+}
+
+// HandleEvent records a UsageReported message; failures are logged
+func (m *Meter) HandleEvent(data []byte) {
+	var e plans.UsageReported
+	if err := json.Unmarshal(data, &e); err != nil {
+		log.Printf("Invalid %s event: %v\n", plans.SubjectUsageReported, err)
+		return
+	}
+	if err := m.Record(context.Background(), e); err != nil {
+		log.Printf("Failed to record %s usage of school %s: %v\n", e.Metric, e.SchoolID, err)
+	}
+}
+
+// SampleStorage records the storage each school uses: the size of its
+// files, plus that of its database when it is dedicated. The rows of
+// shared-tenancy schools sit in tables with other schools' and are not
+// sized. It returns the number of schools sampled.
+func (m *Meter) SampleStorage(ctx context.Context) (int, error) {
+	rows, err := m.db.Query(ctx, `
+	SELECT id::text, code, tenancy, db_host, db_port, db_name, db_user, db_password
+	FROM schools WHERE status IN ($1, $2)`,
+		tenant.StatusActive, tenant.StatusSuspended)
+	if err != nil {
+		return 0, err
+	}
+	var schools []tenant.School
+	for rows.Next() {
+		var s tenant.School
+		if err := rows.Scan(&s.ID, &s.Code, &s.Tenancy, &s.DBHost, &s.DBPort, &s.DBName, &s.DBUser, &s.DBPassword); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		schools = append(schools, s)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	sampled := 0
+	for _, s := range schools {
+		if ctx.Err() != nil {
+			return sampled, ctx.Err()
+		}
+		size, err := storage.Size(ctx, m.files, storage.SchoolPrefix(s.ID))
+		if err != nil {
+			log.Printf("Storage sampling: failed to size the files of %s: %v\n", s.Code, err)
+			continue
+		}
+		if s.Tenancy == tenant.Dedicated {
+			pool, err := m.tm.GetConnection(ctx, s.Code, s.DBHost, s.DBPort, s.DBName, s.DBUser, s.DBPassword)
+			if err != nil {
+				log.Printf("Storage sampling: failed to connect to %s: %v\n", s.Code, err)
+				continue
+			}
+			var dbSize int64
+			if err := pool.QueryRow(ctx, `SELECT pg_database_size(current_database())`).Scan(&dbSize); err != nil {
+				log.Printf("Storage sampling: failed to size %s: %v\n", s.Code, err)
+				continue
+			}
+			size += dbSize
+		}
+		if err := m.Record(ctx, plans.UsageReported{SchoolID: s.ID, Metric: plans.MetricStorage, Value: size}); err != nil {
+			return sampled, err
+		}
+		sampled++
+	}
+	return sampled, nil
+}
+
+// Run samples storage every interval until ctx is done
+func (m *Meter) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := m.SampleStorage(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("Storage sampling: %v\n", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}